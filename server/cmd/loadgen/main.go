@@ -0,0 +1,376 @@
+// loadgen drives a configurable mix of relay traffic and reports latency
+// percentiles and throughput per operation, for sizing Redis and checking
+// the performance impact of changes
+//
+//	loadgen -server http://localhost:8080 -duration 60s -concurrency 32 \
+//	        -mix create=1,send=6,receive=3,subscribe=1 -subscribers 50 [-rate 500] [-json]
+//
+// Mix operations:
+//
+//	create     create a queue (it joins the pool the other operations use)
+//	send       send a -payload byte message to a pool queue
+//	receive    receive from a pool queue after its last cursor, then ack (reported as "ack")
+//	subscribe  open a WebSocket, subscribe and hang up (connection churn)
+//
+// Each of the -subscribers holds a WebSocket subscription for the whole run;
+// "ws_deliver" is the time from a send starting to its push arriving.
+//
+// The relay limits queue creation per client address. Against a relay that
+// lists this host in TRUSTED_PROXIES, -forwarded-for gives every request a
+// random address; otherwise expect 429s for create beyond the first few.
+// Pool queues are deleted when the run ends.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"privmsg-relay/pkg/client"
+)
+
+// generator holds the shared state of one run
+type generator struct {
+	server       string
+	client       *client.Client
+	stats        *recorder
+	payloadSize  int
+	queueTTL     time.Duration
+	forwardedFor bool
+
+	mu      sync.Mutex
+	queues  []*client.Queue
+	cursors map[string]string // Receive position per queue ID
+}
+
+func main() {
+	server := flag.String("server", getEnv("RELAY_URL", "http://localhost:8080"), "relay base URL")
+	duration := flag.Duration("duration", 30*time.Second, "how long to generate load")
+	concurrency := flag.Int("concurrency", 16, "concurrent workers running the mix")
+	rate := flag.Float64("rate", 0, "target mix operations per second across all workers (0 = as fast as possible)")
+	mixSpec := flag.String("mix", "create=1,send=6,receive=3", "operation weights: create, send, receive, subscribe")
+	poolSize := flag.Int("queues", 20, "queues created up front for send, receive and subscribe")
+	subscribers := flag.Int("subscribers", 0, "WebSocket subscriptions held open for the whole run")
+	payloadSize := flag.Int("payload", 1024, "message size in bytes (at least 8)")
+	queueTTL := flag.Duration("queue-ttl", time.Hour, "lifetime of created queues, in case cleanup fails")
+	forwardedFor := flag.Bool("forwarded-for", false, "send a random X-Forwarded-For per request (relay must trust this host)")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	mix, err := parseMix(*mixSpec)
+	if err != nil {
+		fatal(err)
+	}
+	if *concurrency < 1 || *poolSize < 1 {
+		fatal(errors.New("-concurrency and -queues must be at least 1"))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	g := &generator{
+		server:       *server,
+		stats:        newRecorder(),
+		payloadSize:  *payloadSize,
+		queueTTL:     *queueTTL,
+		forwardedFor: *forwardedFor,
+		cursors:      make(map[string]string),
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = *concurrency + *subscribers
+	g.client = client.New(*server, client.WithHTTPClient(&http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &headerTransport{next: transport, header: g.header},
+	}))
+
+	// The pool is set up before the clock starts
+	fmt.Fprintf(os.Stderr, "creating %d queues\n", *poolSize)
+	for i := 0; i < *poolSize; i++ {
+		if err := g.createQueue(ctx); err != nil {
+			if len(g.queues) == 0 {
+				fatal(fmt.Errorf("cannot create queues: %w", err))
+			}
+			fmt.Fprintf(os.Stderr, "stopped at %d queues: %v\n", len(g.queues), err)
+			break
+		}
+	}
+	defer g.cleanup()
+
+	runCtx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < *subscribers; i++ {
+		q := g.queues[i%len(g.queues)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.subscriber(runCtx, q)
+		}()
+	}
+
+	tokens := pace(runCtx, *rate)
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.worker(runCtx, mix, tokens)
+		}()
+	}
+
+	go g.progress(runCtx, start)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	rows := g.stats.report(elapsed)
+	if *asJSON {
+		writeJSON(os.Stdout, rows, elapsed)
+	} else {
+		writeTable(os.Stdout, rows, elapsed)
+	}
+}
+
+// worker runs mix operations until the run ends
+func (g *generator) worker(ctx context.Context, mix *mix, tokens <-chan struct{}) {
+	for {
+		if tokens != nil {
+			select {
+			case <-tokens:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		op := mix.pick()
+		start := time.Now()
+		err := g.run(ctx, op)
+		if err != nil && ctx.Err() != nil {
+			return // Cut off by the end of the run, not a relay failure
+		}
+		g.stats.record(op, time.Since(start), err)
+	}
+}
+
+// run performs one mix operation
+func (g *generator) run(ctx context.Context, op string) error {
+	switch op {
+	case "create":
+		return g.createQueue(ctx)
+	case "send":
+		q := g.pick()
+		_, err := g.client.Send(ctx, q.QueueID, q.SendToken, newPayload(g.payloadSize))
+		return err
+	case "receive":
+		return g.receive(ctx)
+	case "subscribe":
+		return g.subscribeOnce(ctx)
+	}
+	return fmt.Errorf("unknown operation %q", op)
+}
+
+func (g *generator) createQueue(ctx context.Context) error {
+	q, err := g.client.CreateQueue(ctx, &client.CreateQueueOptions{TTL: int64(g.queueTTL / time.Second)})
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	g.queues = append(g.queues, q)
+	g.mu.Unlock()
+	return nil
+}
+
+// receive reads a pool queue from where the last receive stopped and acks
+// what it got, so sends do not fill the queue
+func (g *generator) receive(ctx context.Context) error {
+	q := g.pick()
+	g.mu.Lock()
+	cursor := g.cursors[q.QueueID]
+	g.mu.Unlock()
+
+	result, err := g.client.Receive(ctx, q.QueueID, q.AccessToken, cursor)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	g.cursors[q.QueueID] = result.NextCursor
+	g.mu.Unlock()
+
+	ids := make([]string, 0, len(result.Messages))
+	for _, message := range result.Messages {
+		if !message.System {
+			ids = append(ids, message.ID)
+		}
+	}
+	if len(ids) > 0 {
+		start := time.Now()
+		_, err := g.client.Ack(ctx, q.QueueID, q.AccessToken, ids...)
+		if err == nil || ctx.Err() == nil {
+			g.stats.record("ack", time.Since(start), err)
+		}
+	}
+	return nil
+}
+
+// pick returns a random pool queue
+func (g *generator) pick() *client.Queue {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.queues[rand.IntN(len(g.queues))]
+}
+
+// cleanup deletes every queue the run created
+func (g *generator) cleanup() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	g.mu.Lock()
+	queues := g.queues
+	g.mu.Unlock()
+
+	failed := 0
+	for _, q := range queues {
+		if err := g.client.DeleteQueue(ctx, q.QueueID, q.AccessToken); err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d queues not deleted; they expire after -queue-ttl\n", failed, len(queues))
+	}
+}
+
+// progress prints a line to stderr every few seconds
+func (g *generator) progress(ctx context.Context, start time.Time) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			calls, failed := g.stats.total()
+			elapsed := time.Since(start)
+			fmt.Fprintf(os.Stderr, "%5s  %d calls  %.1f/s  %d failed\n",
+				elapsed.Round(time.Second), calls, float64(calls)/elapsed.Seconds(), failed)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pace returns a channel that yields rate tokens per second, or nil for no
+// limit; ticks no worker is free for are dropped
+func pace(ctx context.Context, rate float64) <-chan struct{} {
+	if rate <= 0 {
+		return nil
+	}
+	interval := time.Duration(float64(time.Second) / rate)
+	if interval <= 0 {
+		interval = time.Nanosecond
+	}
+	tokens := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case tokens <- struct{}{}:
+				default:
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return tokens
+}
+
+// mix picks operations in proportion to their weights
+type mix struct {
+	ops     []string
+	weights []int
+	total   int
+}
+
+func parseMix(spec string) (*mix, error) {
+	m := &mix{}
+	for _, part := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		weight, err := strconv.Atoi(value)
+		if !ok || err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid mix entry %q, want op=weight", part)
+		}
+		switch name {
+		case "create", "send", "receive", "subscribe":
+		default:
+			return nil, fmt.Errorf("unknown mix operation %q", name)
+		}
+		if weight > 0 {
+			m.ops = append(m.ops, name)
+			m.weights = append(m.weights, weight)
+			m.total += weight
+		}
+	}
+	if m.total == 0 {
+		return nil, errors.New("the mix has no operations")
+	}
+	return m, nil
+}
+
+func (m *mix) pick() string {
+	n := rand.IntN(m.total)
+	for i, weight := range m.weights {
+		if n < weight {
+			return m.ops[i]
+		}
+		n -= weight
+	}
+	return m.ops[len(m.ops)-1]
+}
+
+// headerTransport adds per-request headers to every HTTP call
+type headerTransport struct {
+	next   http.RoundTripper
+	header func() http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	extra := t.header()
+	if len(extra) == 0 {
+		return t.next.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	for name, values := range extra {
+		req.Header[name] = values
+	}
+	return t.next.RoundTrip(req)
+}
+
+// randomIP returns an address from 10.0.0.0/8
+func randomIP() string {
+	return fmt.Sprintf("10.%d.%d.%d", rand.IntN(256), rand.IntN(256), 1+rand.IntN(254))
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "loadgen: %v\n", err)
+	os.Exit(1)
+}
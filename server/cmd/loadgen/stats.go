@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"privmsg-relay/pkg/client"
+)
+
+// recorder collects latencies and failures per operation
+type recorder struct {
+	mu  sync.Mutex
+	ops map[string]*opStats
+}
+
+type opStats struct {
+	latencies []time.Duration // Successful calls only
+	errors    map[string]int  // By HTTP status or "network"/"other"
+}
+
+func newRecorder() *recorder {
+	return &recorder{ops: make(map[string]*opStats)}
+}
+
+// record notes one call; failed calls are counted but not timed, so a wall
+// of fast 429s cannot flatter the percentiles
+func (r *recorder) record(op string, latency time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := r.ops[op]
+	if stats == nil {
+		stats = &opStats{errors: make(map[string]int)}
+		r.ops[op] = stats
+	}
+	if err != nil {
+		stats.errors[errorClass(err)]++
+		return
+	}
+	stats.latencies = append(stats.latencies, latency)
+}
+
+// total returns the calls and failures so far, for progress lines
+func (r *recorder) total() (calls, failed int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stats := range r.ops {
+		calls += len(stats.latencies)
+		for _, n := range stats.errors {
+			calls += n
+			failed += n
+		}
+	}
+	return calls, failed
+}
+
+// errorClass buckets an error for the report
+func errorClass(err error) string {
+	var apiErr *client.APIError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &apiErr):
+		return strconv.Itoa(apiErr.StatusCode)
+	case errors.As(err, &netErr):
+		return "network"
+	default:
+		return "other"
+	}
+}
+
+// opReport is one row of the final report
+type opReport struct {
+	Op         string         `json:"op"`
+	OK         int            `json:"ok"`
+	Failed     int            `json:"failed"`
+	Errors     map[string]int `json:"errors,omitempty"`
+	Throughput float64        `json:"per_second"` // Successful calls per second
+	P50        float64        `json:"p50_ms"`
+	P90        float64        `json:"p90_ms"`
+	P99        float64        `json:"p99_ms"`
+	Max        float64        `json:"max_ms"`
+}
+
+// report summarizes everything recorded over elapsed
+func (r *recorder) report(elapsed time.Duration) []opReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.ops))
+	for name := range r.ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rows := make([]opReport, 0, len(names))
+	for _, name := range names {
+		stats := r.ops[name]
+		latencies := append([]time.Duration(nil), stats.latencies...)
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+		row := opReport{Op: name, OK: len(latencies), Errors: stats.errors}
+		for _, n := range stats.errors {
+			row.Failed += n
+		}
+		if elapsed > 0 {
+			row.Throughput = float64(row.OK) / elapsed.Seconds()
+		}
+		if len(latencies) > 0 {
+			row.P50 = millis(percentile(latencies, 0.50))
+			row.P90 = millis(percentile(latencies, 0.90))
+			row.P99 = millis(percentile(latencies, 0.99))
+			row.Max = millis(latencies[len(latencies)-1])
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// percentile picks the nearest-rank value from sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// writeTable prints the report for a terminal
+func writeTable(w io.Writer, rows []opReport, elapsed time.Duration) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\tok\tfailed\tper sec\tp50 ms\tp90 ms\tp99 ms\tmax ms\terrors\t")
+	for _, row := range rows {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%.2f\t%.2f\t%.2f\t%.2f\t%s\t\n",
+			row.Op, row.OK, row.Failed, row.Throughput, row.P50, row.P90, row.P99, row.Max, formatErrors(row.Errors))
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nelapsed %s\n", elapsed.Round(time.Millisecond))
+}
+
+// writeJSON prints the report for scripts and dashboards
+func writeJSON(w io.Writer, rows []opReport, elapsed time.Duration) error {
+	return json.NewEncoder(w).Encode(struct {
+		ElapsedSeconds float64    `json:"elapsed_seconds"`
+		Ops            []opReport `json:"ops"`
+	}{elapsed.Seconds(), rows})
+}
+
+func formatErrors(errors map[string]int) string {
+	if len(errors) == 0 {
+		return "-"
+	}
+	classes := make([]string, 0, len(errors))
+	for class := range errors {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	out := ""
+	for i, class := range classes {
+		if i > 0 {
+			out += " "
+		}
+		out += fmt.Sprintf("%s=%d", class, errors[class])
+	}
+	return out
+}
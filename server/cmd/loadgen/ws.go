@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"privmsg-relay/internal/queue"
+	"privmsg-relay/pkg/client"
+)
+
+// wsURL turns the relay base URL into its WebSocket endpoint
+func wsURL(server string) string {
+	server = strings.TrimRight(server, "/")
+	if rest, ok := strings.CutPrefix(server, "https://"); ok {
+		return "wss://" + rest + "/v1/ws"
+	}
+	return "ws://" + strings.TrimPrefix(server, "http://") + "/v1/ws"
+}
+
+// dialSubscribed opens a WebSocket, waits for hello and subscribes to q
+// The relay does not confirm subscriptions, so the latency covers the
+// handshake and the hello frame
+func (g *generator) dialSubscribed(ctx context.Context, q *client.Queue) (*websocket.Conn, error) {
+	dialer := websocket.Dialer{
+		Subprotocols:     []string{queue.WSProtocol},
+		HandshakeTimeout: 10 * time.Second,
+	}
+	conn, resp, err := dialer.DialContext(ctx, wsURL(g.server), g.header())
+	if err != nil {
+		if resp != nil {
+			return nil, &client.APIError{StatusCode: resp.StatusCode, Message: "websocket handshake refused"}
+		}
+		return nil, err
+	}
+
+	var hello queue.WSMessage
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if err := conn.ReadJSON(&hello); err != nil || hello.Type != queue.WSTypeHello {
+		conn.Close()
+		return nil, errors.New("no hello frame")
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	subscribe := queue.WSMessage{Type: queue.WSTypeSubscribe, QueueID: q.QueueID, AccessToken: q.AccessToken, Timestamp: time.Now()}
+	if err := conn.WriteJSON(subscribe); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// subscribeOnce is the "subscribe" mix operation: connect, subscribe and
+// hang up, which measures connection churn rather than delivery
+func (g *generator) subscribeOnce(ctx context.Context) error {
+	conn, err := g.dialSubscribed(ctx, g.pick())
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// subscriber holds one connection open for the whole run, timing how long
+// each pushed message took from send to delivery and acking it so the
+// queue does not fill up
+func (g *generator) subscriber(ctx context.Context, q *client.Queue) {
+	for ctx.Err() == nil {
+		start := time.Now()
+		conn, err := g.dialSubscribed(ctx, q)
+		g.stats.record("ws_connect", time.Since(start), err)
+		if err != nil {
+			sleep(ctx, time.Second)
+			continue
+		}
+
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				break
+			}
+			var frame queue.WSMessage
+			if json.Unmarshal(data, &frame) != nil {
+				continue
+			}
+			switch frame.Type {
+			case queue.WSTypeMessage:
+				if sentAt, ok := sentTime(frame.Payload); ok {
+					g.stats.record("ws_deliver", time.Since(sentAt), nil)
+				}
+				conn.WriteJSON(queue.WSMessage{
+					Type: queue.WSTypeAck, QueueID: q.QueueID, AccessToken: q.AccessToken,
+					MessageID: frame.MessageID, Timestamp: time.Now(),
+				})
+			case queue.WSTypeError:
+				g.stats.record("ws_deliver", 0, &client.APIError{StatusCode: frame.Code, Message: frame.Error})
+			}
+		}
+		stop()
+		conn.Close()
+	}
+}
+
+// newPayload stamps the send time into the first 8 bytes, so subscribers
+// can measure end-to-end delivery; the rest is filler
+func newPayload(size int) []byte {
+	if size < 8 {
+		size = 8
+	}
+	payload := make([]byte, size)
+	binary.BigEndian.PutUint64(payload, uint64(time.Now().UnixNano()))
+	return payload
+}
+
+// sentTime reads the stamp newPayload wrote
+func sentTime(payload []byte) (time.Time, bool) {
+	if len(payload) < 8 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(payload))), true
+}
+
+// header carries the spoofed client address, when enabled
+func (g *generator) header() http.Header {
+	header := http.Header{}
+	if g.forwardedFor {
+		header.Set("X-Forwarded-For", randomIP())
+	}
+	return header
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// keychainEntry is everything needed to use one queue again later
+type keychainEntry struct {
+	Server      string    `json:"server"`
+	QueueID     string    `json:"queue_id"`
+	AccessToken string    `json:"access_token"`
+	SendToken   string    `json:"send_token,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at,omitempty"`
+	Cursor      string    `json:"cursor,omitempty"` // Where watch resumes
+}
+
+// keychain is a local file of named queues and their tokens
+// The file is readable by its owner only; the tokens in it are as good as
+// the queues themselves
+type keychain struct {
+	path    string
+	Entries map[string]*keychainEntry `json:"queues"`
+}
+
+// defaultKeychainPath is privmsg/keychain.json in the user config directory
+func defaultKeychainPath() string {
+	if path := os.Getenv("PRIVMSG_KEYCHAIN"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "privmsg-keychain.json"
+	}
+	return filepath.Join(dir, "privmsg", "keychain.json")
+}
+
+// openKeychain loads the keychain at path; a missing file is an empty keychain
+func openKeychain(path string) (*keychain, error) {
+	k := &keychain{path: path, Entries: make(map[string]*keychainEntry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, k); err != nil {
+		return nil, fmt.Errorf("invalid keychain %s: %w", path, err)
+	}
+	if k.Entries == nil {
+		k.Entries = make(map[string]*keychainEntry)
+	}
+	return k, nil
+}
+
+// get returns the named entry or an error naming the keychain
+func (k *keychain) get(name string) (*keychainEntry, error) {
+	entry, ok := k.Entries[name]
+	if !ok {
+		return nil, fmt.Errorf("no queue named %q in %s", name, k.path)
+	}
+	return entry, nil
+}
+
+// save writes the keychain atomically with owner-only permissions
+func (k *keychain) save() error {
+	if err := os.MkdirAll(filepath.Dir(k.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(k.path), ".keychain-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), k.path)
+}
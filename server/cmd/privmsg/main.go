@@ -0,0 +1,337 @@
+// privmsg is a command-line client for the relay, for scripts, testing and
+// headless bots
+//
+//	privmsg create-queue -name inbox [-ttl 168h] [-require-send-token]
+//	privmsg send -name inbox "hello"            (or -file F, or stdin)
+//	privmsg send -queue ID [-token SEND_TOKEN] < payload.bin
+//	privmsg watch -name inbox [-ack] [-json] [-once]
+//	privmsg ack -name inbox MESSAGE_ID...
+//	privmsg delete-queue -name inbox
+//
+// Queues created here are kept by name, with their tokens, in a keychain
+// file (PRIVMSG_KEYCHAIN, by default privmsg/keychain.json in the user
+// config directory). Payloads are sent as given: encrypt them first, e.g.
+// with age or gpg, if the relay operator should not read them.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"privmsg-relay/pkg/client"
+)
+
+// watchWait is how long each watch poll waits for a message; it stays below
+// the SDK's 30-second HTTP timeout
+const watchWait = 25 * time.Second
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "create-queue":
+		err = runCreateQueue(ctx, os.Args[2:])
+	case "send":
+		err = runSend(ctx, os.Args[2:])
+	case "watch":
+		err = runWatch(ctx, os.Args[2:])
+	case "ack":
+		err = runAck(ctx, os.Args[2:])
+	case "delete-queue":
+		err = runDeleteQueue(ctx, os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "privmsg: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: privmsg create-queue -name NAME [-ttl 168h] [-max-messages N] [-require-send-token] [-burn-after-read] [-server URL]")
+	fmt.Fprintln(os.Stderr, "       privmsg send (-name NAME | -queue ID [-token SEND_TOKEN] [-server URL]) [-ttl 1h] [-file F | MESSAGE...]")
+	fmt.Fprintln(os.Stderr, "       privmsg watch -name NAME [-ack] [-json] [-once]")
+	fmt.Fprintln(os.Stderr, "       privmsg ack -name NAME MESSAGE_ID...")
+	fmt.Fprintln(os.Stderr, "       privmsg delete-queue -name NAME")
+	fmt.Fprintln(os.Stderr, "every command also takes -keychain FILE")
+	os.Exit(2)
+}
+
+// commonFlags are accepted by every command
+type commonFlags struct {
+	server   *string
+	keychain *string
+}
+
+func newFlagSet(name string) (*flag.FlagSet, commonFlags) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	return fs, commonFlags{
+		server:   fs.String("server", getEnv("RELAY_URL", "http://localhost:8080"), "relay base URL"),
+		keychain: fs.String("keychain", defaultKeychainPath(), "file the queue tokens are kept in"),
+	}
+}
+
+// newClient returns an SDK client that retries transient failures
+func newClient(server string) *client.Client {
+	return client.New(server, client.WithInterceptors(client.Retry(3, time.Second)))
+}
+
+// openEntry loads the keychain and the queue named by -name
+func openEntry(flags commonFlags, name string) (*keychain, *keychainEntry, error) {
+	if name == "" {
+		usage()
+	}
+	k, err := openKeychain(*flags.keychain)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry, err := k.get(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return k, entry, nil
+}
+
+func runCreateQueue(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("create-queue")
+	name := fs.String("name", "", "name to keep the queue under")
+	ttl := fs.Duration("ttl", 0, "queue lifetime (0 = relay default)")
+	maxMessages := fs.Int("max-messages", 0, "messages held at once (0 = relay default)")
+	requireSendToken := fs.Bool("require-send-token", false, "reject sends without the send token")
+	burnAfterRead := fs.Bool("burn-after-read", false, "delete messages as soon as they are received")
+	broadcast := fs.Bool("broadcast", false, "one writer, readers with their own tokens and cursors")
+	fs.Parse(args)
+
+	if *name == "" {
+		usage()
+	}
+	k, err := openKeychain(*flags.keychain)
+	if err != nil {
+		return err
+	}
+	if _, exists := k.Entries[*name]; exists {
+		return fmt.Errorf("a queue named %q already exists in %s", *name, k.path)
+	}
+
+	q, err := newClient(*flags.server).CreateQueue(ctx, &client.CreateQueueOptions{
+		RequireSendToken: *requireSendToken,
+		BurnAfterRead:    *burnAfterRead,
+		Broadcast:        *broadcast,
+		TTL:              int64(*ttl / time.Second),
+		MaxMessages:      *maxMessages,
+	})
+	if err != nil {
+		return err
+	}
+
+	k.Entries[*name] = &keychainEntry{
+		Server:      strings.TrimRight(*flags.server, "/"),
+		QueueID:     q.QueueID,
+		AccessToken: q.AccessToken,
+		SendToken:   q.SendToken,
+		ExpiresAt:   q.ExpiresAt,
+	}
+	if err := k.save(); err != nil {
+		return fmt.Errorf("queue %s created but not saved: %w", q.QueueID, err)
+	}
+
+	// Senders need the ID (and send token); the access token stays in the keychain
+	fmt.Printf("queue_id    %s\n", q.QueueID)
+	if q.SendToken != "" {
+		fmt.Printf("send_token  %s\n", q.SendToken)
+	}
+	fmt.Printf("expires_at  %s\n", q.ExpiresAt.Format(time.RFC3339))
+	return nil
+}
+
+func runSend(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("send")
+	name := fs.String("name", "", "queue from the keychain")
+	queueID := fs.String("queue", "", "queue ID, for queues not in the keychain")
+	token := fs.String("token", "", "send token, for send-token queues not in the keychain")
+	ttl := fs.Duration("ttl", 0, "message lifetime (0 = relay default)")
+	file := fs.String("file", "", "read the payload from a file (- for stdin)")
+	fs.Parse(args)
+
+	server, id, sendToken := *flags.server, *queueID, *token
+	switch {
+	case *name != "" && id == "":
+		_, entry, err := openEntry(flags, *name)
+		if err != nil {
+			return err
+		}
+		server, id, sendToken = entry.Server, entry.QueueID, entry.SendToken
+	case *name == "" && id != "":
+	default:
+		usage()
+	}
+
+	payload, err := readPayload(*file, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	result, err := newClient(server).SendWithTTL(ctx, id, sendToken, payload, *ttl)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s seq=%d expires_at=%s\n", result.MessageID, result.Seq, result.ExpiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// readPayload takes the payload from a file, the arguments or stdin, in
+// that order of preference
+func readPayload(file string, args []string) ([]byte, error) {
+	switch {
+	case file == "-":
+		return io.ReadAll(os.Stdin)
+	case file != "":
+		return os.ReadFile(file)
+	case len(args) > 0:
+		return []byte(strings.Join(args, " ")), nil
+	default:
+		return io.ReadAll(os.Stdin)
+	}
+}
+
+// watchedMessage is one -json output line
+type watchedMessage struct {
+	ID         string    `json:"id"`
+	Seq        int64     `json:"seq"`
+	ReceivedAt time.Time `json:"received_at"`
+	Payload    []byte    `json:"payload"`
+	System     bool      `json:"system,omitempty"`
+}
+
+func runWatch(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("watch")
+	name := fs.String("name", "", "queue from the keychain")
+	ack := fs.Bool("ack", false, "delete messages once printed")
+	asJSON := fs.Bool("json", false, "print one JSON object per message (payload in base64)")
+	once := fs.Bool("once", false, "exit once the queue is drained instead of waiting for more")
+	fs.Parse(args)
+
+	k, entry, err := openEntry(flags, *name)
+	if err != nil {
+		return err
+	}
+	c := newClient(entry.Server)
+	encoder := json.NewEncoder(os.Stdout)
+
+	for {
+		wait := watchWait
+		if *once {
+			wait = 0
+		}
+		result, err := c.ReceiveWait(ctx, entry.QueueID, entry.AccessToken, entry.Cursor, wait)
+		if ctx.Err() != nil {
+			return nil // Interrupted
+		}
+		if err != nil {
+			return err
+		}
+
+		ids := make([]string, 0, len(result.Messages))
+		for _, message := range result.Messages {
+			switch {
+			case *asJSON:
+				encoder.Encode(watchedMessage{message.ID, message.Seq, message.ReceivedAt, message.Payload, message.System})
+			case message.System:
+				fmt.Fprintf(os.Stderr, "relay notice: %s\n", message.Payload)
+			default:
+				fmt.Printf("%s\n", message.Payload)
+			}
+			ids = append(ids, message.ID)
+		}
+		if *ack && len(ids) > 0 {
+			if _, err := c.Ack(ctx, entry.QueueID, entry.AccessToken, ids...); err != nil {
+				return fmt.Errorf("ack failed: %w", err)
+			}
+		}
+
+		// Remember the position so the next watch resumes after these messages
+		if result.NextCursor != "" && result.NextCursor != entry.Cursor {
+			entry.Cursor = result.NextCursor
+			if err := k.save(); err != nil {
+				return err
+			}
+		}
+		if *once && !result.HasMore {
+			return nil
+		}
+	}
+}
+
+func runAck(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("ack")
+	name := fs.String("name", "", "queue from the keychain")
+	fs.Parse(args)
+
+	_, entry, err := openEntry(flags, *name)
+	if err != nil {
+		return err
+	}
+	ids := fs.Args()
+	if len(ids) == 0 {
+		usage()
+	}
+
+	result, err := newClient(entry.Server).Ack(ctx, entry.QueueID, entry.AccessToken, ids...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("acked %d of %d\n", len(result.Acked), len(ids))
+	if len(result.Acked) < len(ids) {
+		return errors.New("some messages were already gone")
+	}
+	return nil
+}
+
+func runDeleteQueue(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("delete-queue")
+	name := fs.String("name", "", "queue from the keychain")
+	fs.Parse(args)
+
+	k, entry, err := openEntry(flags, *name)
+	if err != nil {
+		return err
+	}
+
+	// A queue that already expired only needs forgetting
+	err = newClient(entry.Server).DeleteQueue(ctx, entry.QueueID, entry.AccessToken)
+	var apiErr *client.APIError
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound) {
+		return err
+	}
+
+	delete(k.Entries, *name)
+	if err := k.save(); err != nil {
+		return err
+	}
+	fmt.Printf("queue %s deleted\n", *name)
+	return nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -2,52 +2,552 @@ package main
 
 import (
 	"context"
-	"log"
+	"crypto/ed25519"
+	"crypto/tls"
+	"flag"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"privmsg-relay/internal/anontoken"
+	"privmsg-relay/internal/atrest"
+	"privmsg-relay/internal/authhook"
+	"privmsg-relay/internal/blobstore"
 	"privmsg-relay/internal/config"
+	"privmsg-relay/internal/egress"
+	"privmsg-relay/internal/federation"
+	"privmsg-relay/internal/identity"
+	"privmsg-relay/internal/logging"
+	"privmsg-relay/internal/noise"
+	"privmsg-relay/internal/onion"
+	"privmsg-relay/internal/policy"
+	"privmsg-relay/internal/push"
 	"privmsg-relay/internal/queue"
+	"privmsg-relay/internal/realip"
 	"privmsg-relay/internal/relay"
+	"privmsg-relay/internal/secrets"
+	"privmsg-relay/internal/tracing"
+	"privmsg-relay/internal/webhook"
 
 	"github.com/redis/go-redis/v9"
 )
 
 func main() {
-	log.Println("Starting Privacy-Focused Messaging Relay Server...")
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML config file; environment variables override it")
+	flag.Parse()
 
 	// Load configuration
-	cfg := config.Load()
-	log.Printf("Configuration loaded: Port=%d, Redis=%s", cfg.Port, cfg.RedisAddr)
+	cfg, err := config.LoadFile(*configFile)
+	if err != nil {
+		fatal("Failed to load configuration", "error", err)
+	}
+	if err := logging.Setup(os.Stderr, cfg.LogFormat, cfg.LogLevel); err != nil {
+		fatal("Invalid logging configuration", "error", err)
+	}
+	slog.Info("Starting Privacy-Focused Messaging Relay Server...")
+	slog.Info("Configuration loaded", "port", cfg.Port, "redis", cfg.RedisAddr)
+
+	// Fetch secrets named by vault://, awssm:// and KMS references
+	ctx := context.Background()
+	resolver, err := secrets.New(ctx, secrets.Options{
+		Vault: secrets.VaultOptions{
+			Addr:      cfg.VaultAddr,
+			Token:     cfg.VaultToken,
+			TokenFile: cfg.VaultTokenFile,
+			RoleID:    cfg.VaultRoleID,
+			SecretID:  cfg.VaultSecretID,
+			Namespace: cfg.VaultNamespace,
+		},
+		AWS: secrets.AWSOptions{
+			Region:       cfg.AWSRegion,
+			AccessKey:    cfg.AWSAccessKey,
+			SecretKey:    cfg.AWSSecretKey,
+			SessionToken: cfg.AWSSessionToken,
+		},
+	})
+	if err != nil {
+		fatal("Failed to set up secret stores", "error", err)
+	}
+	if cfg.VaultAddr != "" {
+		slog.Info("Vault secret store enabled", "addr", cfg.VaultAddr)
+	}
+	if cfg.AWSRegion != "" {
+		slog.Info("AWS secret store enabled", "region", cfg.AWSRegion)
+	}
+	if cfg.VaultAddr != "" || cfg.AWSRegion != "" {
+		go resolver.Run(ctx, cfg.SecretsRefresh)
+	}
 
 	// Connect to Redis
-	redisClient := redis.NewClient(&redis.Options{
+	redisOpts := &redis.Options{
 		Addr:     cfg.RedisAddr,
 		Password: cfg.RedisPass,
 		DB:       cfg.RedisDB,
-	})
+	}
+	if secrets.IsReference(cfg.RedisPass) {
+		if _, err := resolver.Resolve(ctx, cfg.RedisPass); err != nil {
+			fatal("Failed to fetch Redis password", "error", err)
+		}
+		// New connections use the latest password
+		redisOpts.Password = ""
+		redisOpts.CredentialsProvider = func() (string, string) {
+			return "", resolver.Value(cfg.RedisPass)
+		}
+	}
+	redisClient := redis.NewClient(redisOpts)
+
+	// Export traces of HTTP, WebSocket and Redis work
+	stopTracing := func(context.Context) error { return nil }
+	if cfg.TracingEndpoint != "" {
+		var err error
+		stopTracing, err = tracing.Setup(ctx, tracing.Options{
+			Endpoint:    cfg.TracingEndpoint,
+			SampleRatio: cfg.TracingSampleRatio,
+			ServiceName: "privmsg-relay",
+		})
+		if err != nil {
+			fatal("Failed to set up tracing", "error", err)
+		}
+		if err := tracing.InstrumentRedis(redisClient); err != nil {
+			fatal("Failed to set up tracing", "error", err)
+		}
+		slog.Info("Tracing enabled", "endpoint", cfg.TracingEndpoint, "sample_ratio", cfg.TracingSampleRatio)
+	}
 
 	// Test Redis connection
-	ctx := context.Background()
 	if err := redisClient.Ping(ctx).Err(); err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+		fatal("Failed to connect to Redis", "error", err)
 	}
-	log.Println("Connected to Redis successfully")
+	slog.Info("Connected to Redis successfully")
 
 	// Create queue manager
 	queueManager := queue.NewManager(redisClient)
+	queueManager.SetQueueLimits(cfg.QueueMaxTTL, cfg.QueueMaxMessages, cfg.QueueMaxMessageSize)
+	queueManager.SetMessageMaxTTL(cfg.MessageMaxTTL)
+	queueManager.SetQueueDefaults(cfg.QueueDefaultTTL, cfg.QueueDefaultMaxMessages, cfg.QueueDefaultMaxMessageSize)
+	queueManager.SetMessageTTL(cfg.MessageDefaultTTL)
+	queueManager.SetClockSkew(cfg.ClockSkew)
+	queueManager.SetQuotas(queue.Quotas{
+		MaxQueues:            cfg.QuotaMaxQueues,
+		MaxStoredBytes:       cfg.QuotaMaxStoredBytes,
+		MaxMessagesPerSecond: cfg.QuotaMaxMessagesPerSecond,
+	})
+	if cfg.JournalRetention > 0 {
+		queueManager.EnableJournal(cfg.JournalRetention)
+		slog.Info("Event journal enabled", "retention", cfg.JournalRetention)
+	}
+	if cfg.ReceiptRetention > 0 {
+		queueManager.EnableReceipts(cfg.ReceiptRetention)
+		slog.Info("Delivery receipts enabled", "retention", cfg.ReceiptRetention)
+	}
+	if cfg.MixMaxDelay > 0 {
+		queueManager.EnableMixing(cfg.MixMaxDelay)
+		slog.Info("Mixed delivery enabled", "max_delay", cfg.MixMaxDelay)
+	}
+	if cfg.MacaroonSecret != "" {
+		if len(cfg.MacaroonSecret) < 32 {
+			fatal("MACAROON_SECRET must be at least 32 characters")
+		}
+		queueManager.EnableMacaroons([]byte(cfg.MacaroonSecret))
+		slog.Info("Macaroon tokens enabled")
+	}
+	if (cfg.TenantKeyRequired || len(cfg.TenantTiers) > 0) && !cfg.Tenancy {
+		fatal("TENANT_KEY_REQUIRED and TENANT_TIERS need TENANCY=true")
+	}
+	if cfg.Tenancy {
+		tiers, err := queue.ParseTiers(cfg.TenantTiers)
+		if err != nil {
+			fatal("Invalid TENANT_TIERS", "error", err)
+		}
+		if err := queueManager.SetTenantTiers(tiers, cfg.TenantDefaultTier); err != nil {
+			fatal("Invalid TENANT_DEFAULT_TIER", "error", err)
+		}
+		queueManager.EnableTenancy()
+		slog.Info("Tenancy enabled", "key_required", cfg.TenantKeyRequired, "tiers", len(tiers), "default_tier", cfg.TenantDefaultTier)
+	}
+	if cfg.AtRestKeyFile != "" {
+		kek, err := resolver.KeyWrapper(ctx, cfg.AtRestKeyFile)
+		if err != nil {
+			fatal("Failed to load at-rest key", "error", err)
+		}
+		var previous []atrest.KeyWrapper
+		for _, path := range cfg.AtRestPreviousKeyFiles {
+			key, err := resolver.KeyWrapper(ctx, path)
+			if err != nil {
+				fatal("Failed to load previous at-rest key", "error", err)
+			}
+			previous = append(previous, key)
+		}
+		if err := queueManager.EnableAtRest(ctx, kek, previous...); err != nil {
+			fatal("Failed to enable encryption at rest", "error", err)
+		}
+		slog.Info("Encryption at rest enabled", "kek_id", kek.ID())
+
+		go func() {
+			ticker := time.NewTicker(10 * time.Minute)
+			defer ticker.Stop()
+			for range ticker.C {
+				if n, err := queueManager.SweepAtRest(ctx); err != nil {
+					slog.Error("At-rest sweep failed", "error", err)
+				} else if n > 0 {
+					slog.Info("Resealed values at rest", "count", n)
+				}
+			}
+		}()
+	}
+
+	// Open object storage for the archival tier
+	var blobStore blobstore.Store
+	if cfg.BlobStoreURL != "" {
+		var err error
+		blobStore, err = blobstore.Open(cfg.BlobStoreURL, blobstore.S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		})
+		if err != nil {
+			fatal("Failed to open blob store", "error", err)
+		}
+		slog.Info("Blob store opened", "url", cfg.BlobStoreURL)
+	}
+	if blobStore != nil && cfg.ArchiveAfter > 0 {
+		queueManager.EnableArchive(blobStore, cfg.ArchiveAfter)
+		slog.Info("Archiving old payloads", "after", cfg.ArchiveAfter)
+
+		go func() {
+			ticker := time.NewTicker(10 * time.Minute)
+			defer ticker.Stop()
+			for range ticker.C {
+				if n, err := queueManager.ArchiveOldMessages(); err != nil {
+					slog.Error("Archive failed", "error", err)
+				} else if n > 0 {
+					slog.Info("Archived messages", "count", n)
+				}
+			}
+		}()
+	}
+
+	if blobStore != nil && cfg.OffloadAbove > 0 {
+		queueManager.EnableOffload(blobStore, cfg.OffloadAbove)
+		slog.Info("Offloading large payloads to the blob store", "above_bytes", cfg.OffloadAbove)
+	}
+
+	if blobStore != nil && cfg.HibernateAfter > 0 {
+		queueManager.EnableHibernation(blobStore, cfg.HibernateAfter)
+		slog.Info("Hibernating idle queues", "after", cfg.HibernateAfter)
+
+		go func() {
+			ticker := time.NewTicker(1 * time.Hour)
+			defer ticker.Stop()
+			for range ticker.C {
+				if n, err := queueManager.HibernateIdleQueues(); err != nil {
+					slog.Error("Hibernation failed", "error", err)
+				} else if n > 0 {
+					slog.Info("Hibernated idle queues", "count", n)
+				}
+			}
+		}()
+	}
+
+	// Set up anonymous rate-limit tokens
+	serverOpts := relay.Options{
+		UniformErrors:     cfg.UniformErrors,
+		AdminToken:        cfg.AdminToken,
+		AdminConsole:      cfg.AdminConsole,
+		TenantKeyRequired: cfg.TenantKeyRequired,
+		WSCompression:     cfg.WSCompression,
+		AccessLog:         cfg.LogRequests,
+		Pprof:             cfg.Pprof,
+		PprofAddr:         cfg.PprofAddr,
+
+		WSMaxConnectionsPerIP: cfg.WSMaxConnectionsPerIP,
+		WSMaxSubscriptions:    cfg.WSMaxSubscriptions,
+		WSSignalMaxBytes:      cfg.WSSignalMaxBytes,
+		WSSignalRate:          cfg.WSSignalRate,
+		WSCoverMinInterval:    cfg.WSCoverMinInterval,
+
+		Limits: relay.HTTPLimits{
+			ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+			ReadTimeout:       cfg.HTTPReadTimeout,
+			WriteTimeout:      cfg.HTTPWriteTimeout,
+			IdleTimeout:       cfg.HTTPIdleTimeout,
+			MaxHeaderBytes:    cfg.HTTPMaxHeaderBytes,
+		},
+	}
+	if cfg.AnonTokensEnabled {
+		issuerKey, err := anontoken.LoadKey(cfg.AnonTokenKeyFile)
+		if err != nil {
+			fatal("Failed to load anonymous token key", "error", err)
+		}
+		serverOpts.AnonTokens = anontoken.NewService(issuerKey, redisClient)
+		serverOpts.AnonTokenIssuerSecret = cfg.AnonTokenIssuerSecret
+		slog.Info("Anonymous tokens enabled", "key_id", serverOpts.AnonTokens.KeyID())
+	}
+	if cfg.VoucherKeyFile != "" {
+		voucherKey, err := anontoken.LoadKey(cfg.VoucherKeyFile)
+		if err != nil {
+			fatal("Failed to load voucher key", "error", err)
+		}
+		serverOpts.Vouchers = anontoken.NewService(voucherKey, redisClient)
+		if serverOpts.AnonTokens != nil && serverOpts.AnonTokens.KeyID() == serverOpts.Vouchers.KeyID() {
+			fatal("VOUCHER_KEY_FILE must hold another key than ANON_TOKEN_KEY_FILE, or rate-limit tokens would pass as vouchers")
+		}
+		serverOpts.Vouchers.SetSpentTTL(cfg.VoucherValidity)
+		serverOpts.VoucherIssuerSecret = cfg.VoucherIssuerSecret
+		queueManager.EnableVouchers(queue.VoucherLimits{
+			MaxMessages:    cfg.VoucherMaxMessages,
+			MaxMessageSize: cfg.VoucherMaxMessageSize,
+			TTL:            cfg.VoucherTTL,
+		})
+		slog.Info("Vouchers enabled", "key_id", serverOpts.Vouchers.KeyID(), "max_messages", cfg.VoucherMaxMessages,
+			"max_message_size", cfg.VoucherMaxMessageSize, "ttl", cfg.VoucherTTL)
+	}
+
+	// Set up enterprise authentication hook
+	if cfg.AuthHookPlugin != "" {
+		hook, err := authhook.LoadPlugin(cfg.AuthHookPlugin)
+		if err != nil {
+			fatal("Failed to load auth plugin", "error", err)
+		}
+		serverOpts.AuthHook = hook
+		slog.Info("Auth hook plugin loaded", "path", cfg.AuthHookPlugin)
+	} else if cfg.AuthHookURL != "" {
+		serverOpts.AuthHook = authhook.NewHTTPHook(cfg.AuthHookURL, cfg.AuthHookTimeout)
+		slog.Info("Auth hook enabled", "url", cfg.AuthHookURL)
+	}
+
+	// Honor client addresses reported by trusted reverse proxies
+	if len(cfg.TrustedProxies) > 0 {
+		resolver, err := realip.NewResolver(cfg.TrustedProxies)
+		if err != nil {
+			fatal("Failed to parse TRUSTED_PROXIES", "error", err)
+		}
+		serverOpts.RealIP = resolver
+		serverOpts.ProxyProtocol = cfg.ProxyProtocol
+		slog.Info("Trusting client addresses from proxies", "proxies", strings.Join(cfg.TrustedProxies, ", "))
+	} else if cfg.ProxyProtocol {
+		fatal("PROXY_PROTOCOL requires TRUSTED_PROXIES")
+	}
+
+	// Serve TLS directly when a certificate is configured
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		tlsOpts := relay.TLSOptions{
+			CertFile:     cfg.TLSCertFile,
+			KeyFile:      cfg.TLSKeyFile,
+			ClientCAFile: cfg.TLSClientCAFile,
+			RequireCert:  cfg.TLSRequireClientCert,
+		}
+		if secrets.IsReference(cfg.TLSCertFile) || secrets.IsReference(cfg.TLSKeyFile) {
+			cert, err := resolver.Certificate(ctx, cfg.TLSCertFile, cfg.TLSKeyFile)
+			if err != nil {
+				fatal("Failed to fetch TLS certificate", "error", err)
+			}
+			tlsOpts.GetCertificate = cert.GetCertificate
+		}
+		tlsConfig, err := relay.LoadTLSConfig(tlsOpts)
+		if err != nil {
+			fatal("Failed to load TLS configuration", "error", err)
+		}
+		serverOpts.TLS = tlsConfig
+		slog.Info("TLS enabled", "certificate", cfg.TLSCertFile)
+		if cfg.TLSClientCAFile != "" {
+			slog.Info("Client certificates checked", "ca_file", cfg.TLSClientCAFile)
+		}
+	} else if len(cfg.ACMEDomains) > 0 {
+		tlsConfig, challenge, err := relay.LoadACMEConfig(relay.ACMEOptions{
+			Domains:  cfg.ACMEDomains,
+			CacheDir: cfg.ACMECacheDir,
+			Email:    cfg.ACMEEmail,
+		})
+		if err != nil {
+			fatal("Failed to set up ACME", "error", err)
+		}
+		serverOpts.TLS = tlsConfig
+		serverOpts.ACMEChallenge = challenge
+		serverOpts.ACMEHTTPPort = cfg.ACMEHTTPPort
+		slog.Info("Automatic certificates enabled", "domains", strings.Join(cfg.ACMEDomains, ", "))
+	}
+
+	// Profiles on the main port are only for operators
+	if cfg.Pprof {
+		if cfg.PprofAddr == "" && cfg.AdminToken == "" {
+			fatal("PPROF requires ADMIN_TOKEN or PPROF_ADDR")
+		}
+		slog.Info("Profiling enabled", "addr", cfg.PprofAddr)
+	}
+
+	// Announce when the unversioned API paths go away
+	if cfg.LegacyAPISunset != "" {
+		sunset, err := time.Parse(time.DateOnly, cfg.LegacyAPISunset)
+		if err != nil {
+			fatal("Invalid LEGACY_API_SUNSET, expected YYYY-MM-DD", "error", err)
+		}
+		serverOpts.LegacySunset = sunset
+	}
+
+	// Load accept/reject policy
+	if cfg.PolicyFile != "" {
+		engine, err := policy.Load(cfg.PolicyFile)
+		if err != nil {
+			fatal("Failed to load policy", "error", err)
+		}
+		serverOpts.Policy = engine
+		slog.Info("Policy loaded", "path", cfg.PolicyFile)
+	}
+
+	// Requests to user-supplied URLs and to region peers go through the SSRF guard
+	var egressClient *http.Client
+	var egressPolicy *egress.Policy
+	var egressDial egress.DialFunc
+	if cfg.WebhooksEnabled || cfg.PushUnifiedPush || cfg.PushVAPIDKeyFile != "" || cfg.Region != "" {
+		egressClient, egressPolicy, egressDial = newEgress(cfg)
+	}
+
+	// Set up multi-region forwarding
+	if cfg.Region != "" {
+		if err := queueManager.SetRegion(cfg.Region); err != nil {
+			fatal("Invalid REGION", "region", cfg.Region, "error", err)
+		}
+		peers, err := federation.ParsePeers(cfg.RegionPeers)
+		if err != nil {
+			fatal("Invalid region peers", "error", err)
+		}
+		serverOpts.Federation = federation.NewForwarder(cfg.Region, peers, egressDial)
+		if len(cfg.RegionPeerPins) > 0 {
+			peerTLS, err := federation.LoadPeerTLS(cfg.RegionTLSCertFile, cfg.RegionTLSKeyFile, cfg.RegionPeerPins)
+			if err != nil {
+				fatal("Failed to load region TLS configuration", "error", err)
+			}
+			if err := serverOpts.Federation.EnableMTLS(peerTLS); err != nil {
+				fatal("Invalid region peer pins", "error", err)
+			}
+			// Peers' certificates are checked against the pins, not a CA
+			if serverOpts.TLS == nil {
+				fatal("REGION_PEER_PINS requires TLS_CERT_FILE or ACME_DOMAINS")
+			}
+			if serverOpts.TLS.ClientAuth == tls.NoClientCert {
+				serverOpts.TLS.ClientAuth = tls.RequestClientCert
+			}
+			slog.Info("Region peers authenticated by pinned certificates", "pins", len(cfg.RegionPeerPins))
+		}
+		go serverOpts.Federation.StartProbing(ctx, cfg.RegionProbe)
+		slog.Info("Multi-region mode", "region", cfg.Region, "peers", len(peers))
+	}
+
+	// Post new messages to the webhooks queue owners register
+	if cfg.WebhooksEnabled {
+		serverOpts.Webhooks = webhook.NewDispatcher(queueManager, egressClient, egressPolicy, webhook.Options{
+			Workers:     cfg.WebhookWorkers,
+			MaxFailures: cfg.WebhookMaxFailures,
+		})
+		go serverOpts.Webhooks.Run(ctx)
+		slog.Info("Webhooks enabled", "workers", cfg.WebhookWorkers, "max_failures", cfg.WebhookMaxFailures)
+	}
+
+	// Wake apps through FCM, APNs, UnifiedPush, ntfy and Web Push
+	providers := make(map[queue.PushPlatform]push.Provider)
+	if cfg.PushFCMCredentials != "" {
+		fcm, err := push.NewFCM(cfg.PushFCMCredentials)
+		if err != nil {
+			fatal("Failed to set up FCM", "error", err)
+		}
+		providers[queue.PushFCM] = fcm
+	}
+	if cfg.PushAPNsKeyFile != "" {
+		apns, err := push.NewAPNs(push.APNsOptions{
+			KeyFile: cfg.PushAPNsKeyFile,
+			KeyID:   cfg.PushAPNsKeyID,
+			TeamID:  cfg.PushAPNsTeamID,
+			Topic:   cfg.PushAPNsTopic,
+			Sandbox: cfg.PushAPNsSandbox,
+		})
+		if err != nil {
+			fatal("Failed to set up APNs", "error", err)
+		}
+		providers[queue.PushAPNs] = apns
+	}
+	if cfg.PushUnifiedPush {
+		providers[queue.PushUnifiedPush] = push.NewUnifiedPush(egressClient, egressPolicy)
+	}
+	if cfg.PushNtfyServer != "" {
+		ntfy, err := push.NewNtfy(cfg.PushNtfyServer)
+		if err != nil {
+			fatal("Failed to set up ntfy", "error", err)
+		}
+		providers[queue.PushNtfy] = ntfy
+	}
+	if cfg.PushVAPIDKeyFile != "" {
+		webPush, err := push.NewWebPush(cfg.PushVAPIDKeyFile, cfg.PushVAPIDSubject, egressClient, egressPolicy)
+		if err != nil {
+			fatal("Failed to set up Web Push", "error", err)
+		}
+		providers[queue.PushWebPush] = webPush
+	}
+	if len(providers) > 0 {
+		serverOpts.Push = push.NewDispatcher(queueManager, providers, push.Options{MinInterval: cfg.PushMinInterval})
+		go serverOpts.Push.Run(ctx)
+		slog.Info("Push wake-ups enabled",
+			"fcm", providers[queue.PushFCM] != nil,
+			"apns", providers[queue.PushAPNs] != nil,
+			"unifiedpush", providers[queue.PushUnifiedPush] != nil,
+			"ntfy", providers[queue.PushNtfy] != nil,
+			"webpush", providers[queue.PushWebPush] != nil)
+	}
+
+	// Server time and operator notices are signed with the relay identity key
+	signingKey, err := identity.LoadKey(cfg.IdentityKeyFile)
+	if err != nil {
+		fatal("Failed to load identity key", "error", err)
+	}
+	if cfg.IdentityKeyFile == "" {
+		slog.Warn("IDENTITY_KEY_FILE not set, signing key is ephemeral")
+	}
+	queueManager.EnableSignedTime(signingKey)
+	serverOpts.IdentityKey = signingKey
+	if cfg.OnionRouting {
+		serverOpts.OnionKey = onion.DeriveKey(signingKey)
+		slog.Info("Onion routing enabled", "key_id", identity.KeyID(serverOpts.OnionKey.Public[:]))
+	}
+	if cfg.WSNoise {
+		public, private := identity.X25519(signingKey)
+		serverOpts.WSNoiseKey = &noise.Keypair{Public: public, Private: private}
+		slog.Info("Noise WebSocket transport enabled", "key_id", identity.KeyID(public[:]))
+	}
+	if cfg.TransparencyLog {
+		queueManager.EnableTransparency(signingKey)
+		if err := queueManager.LogServerKey(ctx); err != nil {
+			slog.Warn("Failed to log identity key", "error", err)
+		}
+		slog.Info("Key transparency log enabled", "key_id", identity.KeyID(signingKey.Public().(ed25519.PublicKey)))
+	}
+	if cfg.AdminToken != "" {
+		queueManager.EnableNotices(signingKey)
+		slog.Info("Operator notices enabled", "key_id", identity.KeyID(queueManager.NoticePublicKey()))
+	}
 
 	// Create relay server
-	server := relay.NewServer(queueManager)
+	server := relay.NewServer(queueManager, serverOpts)
+	if cfg.AdminToken != "" {
+		go server.RelayNotices(ctx)
+	}
+	if cfg.MixMaxDelay > 0 {
+		go server.ReleaseMixBatches(ctx)
+	}
 
 	// Start cleanup routine for expired queues
 	go func() {
 		ticker := time.NewTicker(1 * time.Hour)
 		defer ticker.Stop()
 		for range ticker.C {
-			queueManager.CleanupExpiredQueues()
+			if _, err := queueManager.CleanupExpiredQueues(); err != nil {
+				slog.Error("Cleanup failed", "error", err)
+			}
 		}
 	}()
 
@@ -55,38 +555,61 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
+	drained := make(chan struct{})
 	go func() {
 		<-sigChan
-		log.Println("Shutting down server...")
+		slog.Info("Shutting down server...")
 
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.DrainTimeout)
 		defer cancel()
 
 		if err := server.Shutdown(shutdownCtx); err != nil {
-			log.Printf("Error during shutdown: %v", err)
-		}
-
-		if err := redisClient.Close(); err != nil {
-			log.Printf("Error closing Redis connection: %v", err)
+			slog.Error("Error during shutdown", "error", err)
 		}
-
-		os.Exit(0)
+		close(drained)
 	}()
 
 	// Start server
-	log.Printf("Server starting on port %d", cfg.Port)
-	log.Println("Ready to accept connections!")
-	log.Println("")
-	log.Println("API Endpoints:")
-	log.Println("  POST   /queue/create          - Create a new message queue")
-	log.Println("  POST   /queue/{id}/send       - Send a message to a queue")
-	log.Println("  GET    /queue/{id}/receive    - Receive messages from a queue")
-	log.Println("  DELETE /queue/{id}             - Delete a queue")
-	log.Println("  GET    /ws                     - WebSocket endpoint for real-time messages")
-	log.Println("  GET    /health                 - Health check")
-	log.Println("")
+	slog.Info("Server starting", "port", cfg.Port, "request_logging", cfg.LogRequests)
 
 	if err := server.Start(cfg.Port); err != nil {
-		log.Fatalf("Server error: %v", err)
+		fatal("Server error", "error", err)
+	}
+
+	// Start returns when the listener closes; wait for requests to drain
+	<-drained
+	if err := redisClient.Close(); err != nil {
+		slog.Error("Error closing Redis connection", "error", err)
+	}
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := stopTracing(flushCtx); err != nil {
+		slog.Error("Error flushing traces", "error", err)
 	}
+	slog.Info("Server stopped")
+}
+
+// newEgress builds the guarded client and policy for requests to URLs
+// queue owners supply, and the guarded dialer for region peers
+func newEgress(cfg *config.Config) (*http.Client, *egress.Policy, egress.DialFunc) {
+	policy := &egress.Policy{
+		AllowPrivate: cfg.EgressAllowPrivate,
+		AllowHTTP:    cfg.EgressAllowHTTP,
+		MaxRedirects: cfg.EgressMaxRedirects,
+	}
+	if err := policy.ParseAllowlist(cfg.EgressAllowlist); err != nil {
+		fatal("Invalid EGRESS_ALLOWLIST", "error", err)
+	}
+	resolver := egress.SystemResolver()
+	if cfg.DoHURL != "" {
+		resolver = egress.NewDoHResolver(cfg.DoHURL)
+		slog.Info("Outbound DNS lookups via DoH", "url", cfg.DoHURL)
+	}
+	return egress.NewClient(resolver, policy), policy, egress.NewDialer(resolver, policy)
+}
+
+// fatal logs at error level and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// messageOverhead approximates the JSON and Redis bookkeeping around a payload
+// when there are no stored messages to sample
+const messageOverhead = 256
+
+// capacityResponse mirrors GET /admin/capacity
+type capacityResponse struct {
+	Storage struct {
+		Keys                int64 `json:"keys"`
+		Queues              int   `json:"queues"`
+		Messages            int   `json:"messages"`
+		UsedMemory          int64 `json:"used_memory"`
+		MaxMemory           int64 `json:"max_memory"`
+		SampledQueues       int   `json:"sampled_queues"`
+		SampledMessages     int   `json:"sampled_messages"`
+		BytesPerQueue       int64 `json:"bytes_per_queue"`
+		BytesPerMessage     int64 `json:"bytes_per_message"`
+		MaxMessagesPerQueue int   `json:"max_messages_per_queue"`
+		MaxMessageSize      int   `json:"max_message_size"`
+	} `json:"storage"`
+	Node struct {
+		WSConnections  int    `json:"ws_connections"`
+		HeapBytes      uint64 `json:"heap_bytes"`
+		BytesPerWSConn int64  `json:"bytes_per_ws_connection"`
+	} `json:"node"`
+}
+
+// capacityReport is the structured output of relayctl capacity
+type capacityReport struct {
+	Current struct {
+		Keys          int64   `json:"keys"`
+		Queues        int     `json:"queues"`
+		Messages      int     `json:"messages"`
+		UsedMemory    int64   `json:"used_memory"`
+		MaxMemory     int64   `json:"max_memory"`
+		MemoryUsed    float64 `json:"memory_used_fraction,omitempty"`
+		WSConnections int     `json:"ws_connections"`
+		NodeHeapBytes uint64  `json:"node_heap_bytes"`
+	} `json:"current"`
+	Footprint struct {
+		BytesPerQueue   int64 `json:"bytes_per_queue"`
+		BytesPerMessage int64 `json:"bytes_per_message"`
+		BytesPerWSConn  int64 `json:"bytes_per_ws_connection"`
+		Estimated       bool  `json:"estimated"` // Too few keys to sample; derived from flags
+	} `json:"footprint"`
+	Headroom struct {
+		Bytes          int64 `json:"bytes"` // -1 when Redis has no maxmemory
+		Messages       int64 `json:"messages"`
+		Queues         int64 `json:"queues"`           // At the planned messages per queue
+		FullQueues     int64 `json:"full_queues"`      // Queues filled to the configured limits
+		FullQueueBytes int64 `json:"full_queue_bytes"` // One queue at max messages of max size
+	} `json:"headroom"`
+	Projection struct {
+		Users            int64 `json:"users"`
+		MessagesPerQueue int64 `json:"messages_per_queue"`
+		Online           int64 `json:"online"`
+		RedisBytes       int64 `json:"redis_bytes"`
+		WSBytes          int64 `json:"ws_bytes"`
+		Nodes            int64 `json:"nodes"`
+	} `json:"projection"`
+}
+
+func runCapacity(args []string) error {
+	fs := flag.NewFlagSet("capacity", flag.ExitOnError)
+	server := fs.String("server", getEnv("RELAY_URL", "http://localhost:8080"), "relay base URL")
+	sample := fs.Int("sample", 200, "keys to sample per kind for memory sizes (max 1000)")
+	users := fs.Int64("users", 0, "planned users, one queue each (0 = current queue count)")
+	perQueue := fs.Int64("messages-per-queue", 10, "planned pending messages per queue")
+	online := fs.Float64("online", 0.3, "fraction of users holding a WebSocket at peak")
+	payload := fs.Int64("payload-size", 1024, "payload size assumed when there are no messages to sample")
+	nodeMemory := fs.Int64("node-memory", 1<<30, "memory per relay node budgeted for WebSockets, in bytes")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		return fmt.Errorf("ADMIN_TOKEN not set")
+	}
+
+	query := url.Values{"sample": {fmt.Sprint(*sample)}}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(*server, "/")+"/v1/admin/capacity?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	var measured capacityResponse
+	if err := json.NewDecoder(resp.Body).Decode(&measured); err != nil {
+		return fmt.Errorf("failed to decode capacity: %w", err)
+	}
+
+	report := projectCapacity(measured, *users, *perQueue, *online, *payload, *nodeMemory)
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	printCapacity(report)
+	return nil
+}
+
+// projectCapacity turns measurements into headroom and a sizing projection
+func projectCapacity(m capacityResponse, users, perQueue int64, online float64, payload, nodeMemory int64) capacityReport {
+	var r capacityReport
+	st := m.Storage
+
+	r.Current.Keys = st.Keys
+	r.Current.Queues = st.Queues
+	r.Current.Messages = st.Messages
+	r.Current.UsedMemory = st.UsedMemory
+	r.Current.MaxMemory = st.MaxMemory
+	if st.MaxMemory > 0 {
+		r.Current.MemoryUsed = float64(st.UsedMemory) / float64(st.MaxMemory)
+	}
+	r.Current.WSConnections = m.Node.WSConnections
+	r.Current.NodeHeapBytes = m.Node.HeapBytes
+
+	// Payloads are stored base64 encoded inside the message JSON
+	r.Footprint.BytesPerQueue = st.BytesPerQueue
+	r.Footprint.BytesPerMessage = st.BytesPerMessage
+	r.Footprint.BytesPerWSConn = m.Node.BytesPerWSConn
+	if st.SampledQueues == 0 {
+		r.Footprint.BytesPerQueue = 512
+		r.Footprint.Estimated = true
+	}
+	if st.SampledMessages == 0 {
+		r.Footprint.BytesPerMessage = payload*4/3 + messageOverhead
+		r.Footprint.Estimated = true
+	}
+
+	perQueueBytes := r.Footprint.BytesPerQueue + perQueue*r.Footprint.BytesPerMessage
+	r.Headroom.FullQueueBytes = r.Footprint.BytesPerQueue +
+		int64(st.MaxMessagesPerQueue)*(int64(st.MaxMessageSize)*4/3+messageOverhead)
+
+	r.Headroom.Bytes = -1
+	if st.MaxMemory > 0 {
+		free := max(st.MaxMemory-st.UsedMemory, 0)
+		r.Headroom.Bytes = free
+		r.Headroom.Messages = free / r.Footprint.BytesPerMessage
+		r.Headroom.Queues = free / perQueueBytes
+		r.Headroom.FullQueues = free / r.Headroom.FullQueueBytes
+	}
+
+	if users <= 0 {
+		users = int64(st.Queues)
+	}
+	r.Projection.Users = users
+	r.Projection.MessagesPerQueue = perQueue
+	r.Projection.Online = int64(float64(users) * online)
+	r.Projection.RedisBytes = users * perQueueBytes
+	r.Projection.WSBytes = r.Projection.Online * r.Footprint.BytesPerWSConn
+	if nodeMemory > 0 {
+		r.Projection.Nodes = max((r.Projection.WSBytes+nodeMemory-1)/nodeMemory, 1)
+	}
+	return r
+}
+
+func printCapacity(r capacityReport) {
+	fmt.Println("Current")
+	fmt.Printf("  keys               %d (%d queues, %d messages)\n", r.Current.Keys, r.Current.Queues, r.Current.Messages)
+	if r.Current.MaxMemory > 0 {
+		fmt.Printf("  redis memory       %s of %s (%.1f%%)\n", humanBytes(r.Current.UsedMemory), humanBytes(r.Current.MaxMemory), r.Current.MemoryUsed*100)
+	} else {
+		fmt.Printf("  redis memory       %s (no maxmemory set)\n", humanBytes(r.Current.UsedMemory))
+	}
+	fmt.Printf("  ws connections     %d on this node (heap %s)\n", r.Current.WSConnections, humanBytes(int64(r.Current.NodeHeapBytes)))
+
+	fmt.Println("Footprint")
+	if r.Footprint.Estimated {
+		fmt.Println("  (partly estimated: too few keys to sample)")
+	}
+	fmt.Printf("  per queue          %s\n", humanBytes(r.Footprint.BytesPerQueue))
+	fmt.Printf("  per message        %s\n", humanBytes(r.Footprint.BytesPerMessage))
+	fmt.Printf("  per ws connection  %s (estimate)\n", humanBytes(r.Footprint.BytesPerWSConn))
+
+	fmt.Println("Headroom")
+	if r.Headroom.Bytes < 0 {
+		fmt.Println("  unbounded: set maxmemory in Redis to get a headroom projection")
+	} else {
+		fmt.Printf("  free memory        %s\n", humanBytes(r.Headroom.Bytes))
+		fmt.Printf("  more messages      %d\n", r.Headroom.Messages)
+		fmt.Printf("  more queues        %d at %d messages each\n", r.Headroom.Queues, r.Projection.MessagesPerQueue)
+		fmt.Printf("  full queues        %d at configured limits (%s each)\n", r.Headroom.FullQueues, humanBytes(r.Headroom.FullQueueBytes))
+	}
+
+	fmt.Printf("Projection for %d users (%d online)\n", r.Projection.Users, r.Projection.Online)
+	fmt.Printf("  redis              %s\n", humanBytes(r.Projection.RedisBytes))
+	fmt.Printf("  websockets         %s across %d node(s)\n", humanBytes(r.Projection.WSBytes), r.Projection.Nodes)
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
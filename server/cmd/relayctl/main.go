@@ -0,0 +1,235 @@
+// relayctl is the operator CLI for the relay's /admin API
+//
+//	ADMIN_TOKEN=... relayctl bulk -op freeze -file ids.txt [-dry-run]
+//	ADMIN_TOKEN=... relayctl bulk -op extend -extend 72h -file ids.txt
+//	ADMIN_TOKEN=... relayctl notice -kind degraded -message "..." -until 2h
+//	ADMIN_TOKEN=... relayctl notice -clear
+//	ADMIN_TOKEN=... relayctl capacity -users 100000 [-json]
+//	ADMIN_TOKEN=... relayctl queue -id ID [-delete]
+//	ADMIN_TOKEN=... relayctl stats
+//	ADMIN_TOKEN=... relayctl cleanup
+//	ADMIN_TOKEN=... relayctl at-rest [-rotate]
+//	ADMIN_TOKEN=... relayctl tenant -list | -tiers | -create NAME [-tier T]
+//	ADMIN_TOKEN=... relayctl tenant -id ID [-delete | -new-key | -revoke-key KEYID | -tier T | -usage [-period 2026-09]]
+//
+// The ID file holds one queue ID per line; "-" reads from stdin.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "bulk":
+		err = runBulk(os.Args[2:])
+	case "notice":
+		err = runNotice(os.Args[2:])
+	case "capacity":
+		err = runCapacity(os.Args[2:])
+	case "queue":
+		err = runQueue(os.Args[2:])
+	case "stats":
+		err = runStats(os.Args[2:])
+	case "cleanup":
+		err = runCleanup(os.Args[2:])
+	case "at-rest":
+		err = runAtRest(os.Args[2:])
+	case "tenant":
+		err = runTenant(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "relayctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: relayctl bulk -op freeze|unfreeze|delete|extend -file IDS [-extend 24h] [-dry-run] [-server URL]")
+	fmt.Fprintln(os.Stderr, "       relayctl notice -kind info|degraded|maintenance|upgrade -message TEXT [-until 2h] [-min-version V] [-server URL]")
+	fmt.Fprintln(os.Stderr, "       relayctl notice -clear [-server URL]")
+	fmt.Fprintln(os.Stderr, "       relayctl capacity [-users N] [-messages-per-queue N] [-online 0.3] [-json] [-server URL]")
+	fmt.Fprintln(os.Stderr, "       relayctl queue -id ID [-delete] [-server URL]")
+	fmt.Fprintln(os.Stderr, "       relayctl stats|cleanup [-server URL]")
+	fmt.Fprintln(os.Stderr, "       relayctl at-rest [-rotate] [-server URL]")
+	fmt.Fprintln(os.Stderr, "       relayctl tenant -list | -tiers | -create NAME [-tier T] [-server URL]")
+	fmt.Fprintln(os.Stderr, "       relayctl tenant -id ID [-delete | -new-key | -revoke-key KEYID | -tier T | -usage [-period 2026-09]] [-server URL]")
+	os.Exit(2)
+}
+
+// bulkLine is one line of the streamed /admin/bulk response
+type bulkLine struct {
+	QueueID string          `json:"queue_id"`
+	Status  string          `json:"status"`
+	Error   string          `json:"error"`
+	Summary json.RawMessage `json:"summary"`
+}
+
+func runBulk(args []string) error {
+	fs := flag.NewFlagSet("bulk", flag.ExitOnError)
+	server := fs.String("server", getEnv("RELAY_URL", "http://localhost:8080"), "relay base URL")
+	op := fs.String("op", "", "operation: freeze, unfreeze, delete or extend")
+	file := fs.String("file", "", "file of queue IDs, one per line (- for stdin)")
+	extend := fs.String("extend", "", "duration to add for -op extend, e.g. 72h")
+	dryRun := fs.Bool("dry-run", false, "report which queues would be affected without changing them")
+	fs.Parse(args)
+
+	if *op == "" || *file == "" {
+		usage()
+	}
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		return fmt.Errorf("ADMIN_TOKEN not set")
+	}
+
+	var ids io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		ids = f
+	}
+
+	query := url.Values{"op": {*op}}
+	if *extend != "" {
+		query.Set("extend", *extend)
+	}
+	if *dryRun {
+		query.Set("dry_run", "true")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(*server, "/")+"/v1/admin/bulk?"+query.Encode(), ids)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "text/plain")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	// Print progress as the server streams results
+	scanner := bufio.NewScanner(resp.Body)
+	n := 0
+	for scanner.Scan() {
+		var line bulkLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return fmt.Errorf("unexpected response line: %s", scanner.Text())
+		}
+		if line.Summary != nil {
+			fmt.Printf("summary: %s\n", line.Summary)
+			var summary struct {
+				Stopped string `json:"stopped"`
+			}
+			if json.Unmarshal(line.Summary, &summary) == nil && summary.Stopped != "" {
+				return fmt.Errorf("stopped after %d queue IDs: %s", n, summary.Stopped)
+			}
+			return nil
+		}
+
+		n++
+		if line.Error != "" {
+			fmt.Printf("[%d] %s %s: %s\n", n, line.QueueID, line.Status, line.Error)
+		} else {
+			fmt.Printf("[%d] %s %s\n", n, line.QueueID, line.Status)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("response ended before summary (connection lost)")
+}
+
+func runNotice(args []string) error {
+	fs := flag.NewFlagSet("notice", flag.ExitOnError)
+	server := fs.String("server", getEnv("RELAY_URL", "http://localhost:8080"), "relay base URL")
+	kind := fs.String("kind", "info", "notice kind: info, degraded, maintenance or upgrade")
+	message := fs.String("message", "", "human-readable notice text")
+	until := fs.Duration("until", 0, "how long the notice stays active (default relay maximum)")
+	minVersion := fs.String("min-version", "", "minimum client version, for -kind upgrade")
+	clear := fs.Bool("clear", false, "withdraw the active notice")
+	fs.Parse(args)
+
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		return fmt.Errorf("ADMIN_TOKEN not set")
+	}
+
+	method := http.MethodDelete
+	var body io.Reader
+	if !*clear {
+		if *message == "" {
+			usage()
+		}
+		req := map[string]interface{}{
+			"kind":    *kind,
+			"message": *message,
+		}
+		if *until > 0 {
+			req["until"] = time.Now().Add(*until).UTC()
+		}
+		if *minVersion != "" {
+			req["min_client_version"] = *minVersion
+		}
+		data, _ := json.Marshal(req)
+		method, body = http.MethodPost, bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(*server, "/")+"/v1/admin/notice", body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	if *clear {
+		fmt.Println("notice cleared")
+	} else {
+		fmt.Printf("notice published: %s\n", strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
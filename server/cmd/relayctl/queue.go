@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// runQueue shows or deletes a single queue
+func runQueue(args []string) error {
+	fs := flag.NewFlagSet("queue", flag.ExitOnError)
+	server := fs.String("server", getEnv("RELAY_URL", "http://localhost:8080"), "relay base URL")
+	id := fs.String("id", "", "queue ID")
+	drop := fs.Bool("delete", false, "delete the queue and disconnect its subscribers")
+	fs.Parse(args)
+
+	if *id == "" {
+		usage()
+	}
+
+	method := http.MethodGet
+	if *drop {
+		method = http.MethodDelete
+	}
+	body, err := adminRequest(method, *server, "/v1/admin/queue/"+url.PathEscape(*id))
+	if err != nil {
+		return err
+	}
+	if *drop {
+		fmt.Printf("queue %s deleted\n", *id)
+		return nil
+	}
+	return printJSON(body)
+}
+
+// runStats prints the aggregate counters behind the console
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	server := fs.String("server", getEnv("RELAY_URL", "http://localhost:8080"), "relay base URL")
+	fs.Parse(args)
+
+	body, err := adminRequest(http.MethodGet, *server, "/v1/admin/stats")
+	if err != nil {
+		return err
+	}
+	return printJSON(body)
+}
+
+// runCleanup triggers the periodic cleanup immediately
+func runCleanup(args []string) error {
+	fs := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	server := fs.String("server", getEnv("RELAY_URL", "http://localhost:8080"), "relay base URL")
+	fs.Parse(args)
+
+	body, err := adminRequest(http.MethodPost, *server, "/v1/admin/cleanup")
+	if err != nil {
+		return err
+	}
+	return printJSON(body)
+}
+
+// runAtRest lists the at-rest data keys, or rotates to a fresh one
+func runAtRest(args []string) error {
+	fs := flag.NewFlagSet("at-rest", flag.ExitOnError)
+	server := fs.String("server", getEnv("RELAY_URL", "http://localhost:8080"), "relay base URL")
+	rotate := fs.Bool("rotate", false, "seal new writes with a fresh data key")
+	fs.Parse(args)
+
+	method, path := http.MethodGet, "/v1/admin/at-rest"
+	if *rotate {
+		method, path = http.MethodPost, "/v1/admin/at-rest/rotate"
+	}
+	body, err := adminRequest(method, *server, path)
+	if err != nil {
+		return err
+	}
+	return printJSON(body)
+}
+
+// adminRequest sends a bodiless admin request and returns the response body
+func adminRequest(method, server, path string) ([]byte, error) {
+	return adminJSONRequest(method, server, path, nil)
+}
+
+// adminJSONRequest sends an admin request with payload (if not nil) as JSON
+func adminJSONRequest(method, server, path string, payload interface{}) ([]byte, error) {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("ADMIN_TOKEN not set")
+	}
+
+	var reader io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(server, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+func printJSON(body []byte) error {
+	var out bytes.Buffer
+	if err := json.Indent(&out, body, "", "  "); err != nil {
+		return fmt.Errorf("unexpected response: %s", body)
+	}
+	fmt.Println(out.String())
+	return nil
+}
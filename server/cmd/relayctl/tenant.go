@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// runTenant lists, creates or deletes tenants, issues or revokes their API
+// keys and shows or changes their quota tiers and usage
+func runTenant(args []string) error {
+	fs := flag.NewFlagSet("tenant", flag.ExitOnError)
+	server := fs.String("server", getEnv("RELAY_URL", "http://localhost:8080"), "relay base URL")
+	list := fs.Bool("list", false, "list tenants")
+	tiers := fs.Bool("tiers", false, "list the quota tiers")
+	create := fs.String("create", "", "register a tenant with this name")
+	tier := fs.String("tier", "", "tier for -create, or move the tenant to this tier (- for unlimited)")
+	showUsage := fs.Bool("usage", false, "show the tenant's usage")
+	period := fs.String("period", "", "month for -usage, e.g. 2026-09 (default this month)")
+	id := fs.String("id", "", "tenant ID")
+	drop := fs.Bool("delete", false, "revoke the tenant's API keys and delete it")
+	newKey := fs.Bool("new-key", false, "issue an API key (shown only once)")
+	revokeKey := fs.String("revoke-key", "", "revoke the API key with this ID")
+	fs.Parse(args)
+
+	var body []byte
+	var err error
+	switch {
+	case *list:
+		body, err = adminRequest(http.MethodGet, *server, "/v1/admin/tenants")
+	case *tiers:
+		body, err = adminRequest(http.MethodGet, *server, "/v1/admin/tiers")
+	case *create != "":
+		body, err = adminJSONRequest(http.MethodPost, *server, "/v1/admin/tenants", map[string]string{"name": *create, "tier": *tier})
+	case *id == "":
+		usage()
+	case *drop:
+		if _, err := adminRequest(http.MethodDelete, *server, "/v1/admin/tenants/"+url.PathEscape(*id)); err != nil {
+			return err
+		}
+		fmt.Printf("tenant %s deleted\n", *id)
+		return nil
+	case *newKey:
+		body, err = adminRequest(http.MethodPost, *server, "/v1/admin/tenants/"+url.PathEscape(*id)+"/keys")
+	case *revokeKey != "":
+		if _, err := adminRequest(http.MethodDelete, *server, "/v1/admin/tenants/"+url.PathEscape(*id)+"/keys/"+url.PathEscape(*revokeKey)); err != nil {
+			return err
+		}
+		fmt.Printf("API key %s revoked\n", *revokeKey)
+		return nil
+	case *tier != "":
+		name := *tier
+		if name == "-" {
+			name = ""
+		}
+		body, err = adminJSONRequest(http.MethodPut, *server, "/v1/admin/tenants/"+url.PathEscape(*id)+"/tier", map[string]string{"tier": name})
+	case *showUsage:
+		path := "/v1/admin/tenants/" + url.PathEscape(*id) + "/usage"
+		if *period != "" {
+			path += "?" + url.Values{"period": {*period}}.Encode()
+		}
+		body, err = adminRequest(http.MethodGet, *server, path)
+	default:
+		body, err = adminRequest(http.MethodGet, *server, "/v1/admin/tenants/"+url.PathEscape(*id))
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(body)
+}
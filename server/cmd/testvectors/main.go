@@ -0,0 +1,29 @@
+// testvectors prints the protocol test vectors as JSON
+//
+//	go run ./cmd/testvectors > pkg/testvectors/vectors.json
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"privmsg-relay/pkg/testvectors"
+)
+
+func main() {
+	vectors, err := testvectors.All()
+	if err != nil {
+		log.Fatalf("Failed to build test vectors: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(map[string]interface{}{
+		"version": 1,
+		"vectors": vectors,
+	}); err != nil {
+		log.Fatalf("Failed to write test vectors: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package anontoken
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// testKey is shared by the tests; 1024 bits keeps generation quick
+var testKey = func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// issueToken runs the client and issuer sides of one issuance
+func issueToken(t *testing.T) *Token {
+	t.Helper()
+	state, blinded, err := Blind(&testKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blindSig, err := signBlinded(testKey, blinded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := Finalize(&testKey.PublicKey, state, blindSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestBlindSignRoundTrip(t *testing.T) {
+	token := issueToken(t)
+	if err := verify(&testKey.PublicKey, token); err != nil {
+		t.Fatalf("verify = %v", err)
+	}
+	decoded, err := DecodeToken(EncodeToken(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(&testKey.PublicKey, decoded); err != nil {
+		t.Fatalf("verify after encoding = %v", err)
+	}
+}
+
+func TestSignBlindedMatchesUnblindedExponent(t *testing.T) {
+	// Blinding inside signBlinded must not change the signature
+	for range 5 {
+		m, err := rand.Int(rand.Reader, testKey.N)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Sign() == 0 {
+			continue
+		}
+		got, err := signBlinded(testKey, m.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := new(big.Int).Exp(m, testKey.D, testKey.N)
+		if new(big.Int).SetBytes(got).Cmp(want) != 0 {
+			t.Fatalf("signBlinded(%x) differs from m^d mod n", m)
+		}
+	}
+}
+
+func TestSignBlindedRejectsOutOfRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		blinded []byte
+	}{
+		{"empty", nil},
+		{"zero", []byte{0, 0}},
+		{"modulus", testKey.N.Bytes()},
+		{"above modulus", new(big.Int).Add(testKey.N, big.NewInt(1)).Bytes()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := signBlinded(testKey, tt.blinded); !errors.Is(err, ErrInvalidBlindData) {
+				t.Errorf("signBlinded error = %v, want %v", err, ErrInvalidBlindData)
+			}
+		})
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	token := issueToken(t)
+	other, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := func(b []byte) []byte {
+		out := append([]byte{}, b...)
+		out[len(out)-1] ^= 1
+		return out
+	}
+	tests := []struct {
+		name  string
+		pub   *rsa.PublicKey
+		token *Token
+	}{
+		{"other key", &other.PublicKey, token},
+		{"tampered nonce", &testKey.PublicKey, &Token{Nonce: flipped(token.Nonce), Signature: token.Signature}},
+		{"tampered signature", &testKey.PublicKey, &Token{Nonce: token.Nonce, Signature: flipped(token.Signature)}},
+		{"short nonce", &testKey.PublicKey, &Token{Nonce: token.Nonce[1:], Signature: token.Signature}},
+		{"short signature", &testKey.PublicKey, &Token{Nonce: token.Nonce, Signature: token.Signature[1:]}},
+		{"signature above modulus", &testKey.PublicKey, &Token{Nonce: token.Nonce, Signature: bytesOf(0xff, len(token.Signature))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verify(tt.pub, tt.token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("verify error = %v, want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestDecodeTokenMalformed(t *testing.T) {
+	for _, encoded := range []string{"", "not base64!", EncodeToken(&Token{Nonce: make([]byte, NonceSize)})} {
+		if _, err := DecodeToken(encoded); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("DecodeToken(%q) error = %v, want %v", encoded, err, ErrInvalidToken)
+		}
+	}
+}
+
+func bytesOf(b byte, n int) []byte {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = b
+	}
+	return out
+}
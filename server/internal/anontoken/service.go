@@ -0,0 +1,134 @@
+package anontoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SpentTokenTTL is how long redeemed nonces are remembered
+// Rotate the issuer key at least this often so old tokens can't be replayed
+const SpentTokenTTL = 30 * 24 * time.Hour
+
+// Service issues blind-signed tokens and redeems them exactly once
+type Service struct {
+	key      *rsa.PrivateKey
+	keyID    string
+	redis    *redis.Client
+	ctx      context.Context
+	spentTTL time.Duration
+}
+
+// NewService creates a token service using the given issuer key
+func NewService(key *rsa.PrivateKey, redisClient *redis.Client) *Service {
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	sum := sha256.Sum256(der)
+
+	return &Service{
+		key:      key,
+		keyID:    hex.EncodeToString(sum[:8]),
+		redis:    redisClient,
+		ctx:      context.Background(),
+		spentTTL: SpentTokenTTL,
+	}
+}
+
+// SetSpentTTL changes how long redeemed nonces are remembered, for tokens
+// held longer than SpentTokenTTL before they are redeemed
+func (s *Service) SetSpentTTL(ttl time.Duration) {
+	s.spentTTL = ttl
+}
+
+// LoadKey reads a PEM-encoded RSA issuer key, or generates an ephemeral one if path is empty
+// Ephemeral keys invalidate all outstanding tokens on restart
+func LoadKey(path string) (*rsa.PrivateKey, error) {
+	if path == "" {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read issuer key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("issuer key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse issuer key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("issuer key is not an RSA key")
+	}
+	return key, nil
+}
+
+// KeyID identifies the current issuer key
+func (s *Service) KeyID() string {
+	return s.keyID
+}
+
+// PublicKeyDER returns the issuer public key in PKIX DER form for clients
+func (s *Service) PublicKeyDER() []byte {
+	der, _ := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	return der
+}
+
+// Issue signs a client-blinded message
+func (s *Service) Issue(blinded []byte) ([]byte, error) {
+	return signBlinded(s.key, blinded)
+}
+
+// Redeem verifies a token and marks it spent; each token works exactly once
+func (s *Service) Redeem(token *Token) error {
+	if err := verify(&s.key.PublicKey, token); err != nil {
+		return err
+	}
+
+	spentKey := fmt.Sprintf("anontoken:spent:%s:%s", s.keyID, hex.EncodeToString(token.Nonce))
+	fresh, err := s.redis.SetNX(s.ctx, spentKey, 1, s.spentTTL).Result()
+	if err != nil {
+		return fmt.Errorf("failed to record token redemption: %w", err)
+	}
+	if !fresh {
+		return ErrTokenSpent
+	}
+
+	return nil
+}
+
+// EncodeToken serializes a token as base64url(nonce || signature)
+func EncodeToken(token *Token) string {
+	raw := append(append([]byte{}, token.Nonce...), token.Signature...)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeToken parses a token produced by EncodeToken
+func DecodeToken(encoded string) (*Token, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(raw) <= NonceSize {
+		return nil, ErrInvalidToken
+	}
+	return &Token{
+		Nonce:     raw[:NonceSize],
+		Signature: raw[NonceSize:],
+	}, nil
+}
@@ -0,0 +1,31 @@
+package anontoken
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedeemOnce(t *testing.T) {
+	addr := os.Getenv("REDIS_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_TEST_ADDR not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("Redis at %s unreachable: %v", addr, err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	service := NewService(testKey, client)
+	token := issueToken(t)
+	if err := service.Redeem(token); err != nil {
+		t.Fatalf("first Redeem = %v", err)
+	}
+	if err := service.Redeem(token); !errors.Is(err, ErrTokenSpent) {
+		t.Fatalf("second Redeem = %v, want %v", err, ErrTokenSpent)
+	}
+}
@@ -0,0 +1,195 @@
+package apispec
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidJSON is returned for a request body that is not JSON at all
+var ErrInvalidJSON = errors.New("invalid request body")
+
+// ValidationError names the first part of a request that broke the spec
+type ValidationError struct {
+	Field  string // Parameter name, or a path such as messages[2].payload
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return "request body " + e.Reason
+	}
+	return e.Field + " " + e.Reason
+}
+
+// Schema is the subset of an OpenAPI 3.0 schema object that is enforced
+// Properties not listed are allowed, as the JSON decoder ignores them
+type Schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Format     string             `json:"format"`
+	Nullable   bool               `json:"nullable"`
+	Enum       []interface{}      `json:"enum"`
+	Required   []string           `json:"required"`
+	Properties map[string]*Schema `json:"properties"`
+	Items      *Schema            `json:"items"`
+	OneOf      []*Schema          `json:"oneOf"`
+	Minimum    *float64           `json:"minimum"`
+	Maximum    *float64           `json:"maximum"`
+	MinLength  *int               `json:"minLength"`
+	MaxLength  *int               `json:"maxLength"`
+	MinItems   *int               `json:"minItems"`
+	MaxItems   *int               `json:"maxItems"`
+
+	resolving, resolved bool
+}
+
+// validate checks a value decoded with json.Decoder.UseNumber
+func (s *Schema) validate(v interface{}, field string) error {
+	fail := func(format string, args ...interface{}) error {
+		return &ValidationError{Field: field, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if v == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return fail("must not be null")
+	}
+
+	if len(s.OneOf) > 0 {
+		for _, option := range s.OneOf {
+			if option.validate(v, field) == nil {
+				return nil
+			}
+		}
+		return fail("does not match any allowed shape")
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			return fail("must be an object")
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				return &ValidationError{Field: join(field, name), Reason: "is required"}
+			}
+		}
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names) // Report the same field first every time
+		for _, name := range names {
+			if value, ok := object[name]; ok {
+				if err := s.Properties[name].validate(value, join(field, name)); err != nil {
+					return err
+				}
+			}
+		}
+
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return fail("must be an array")
+		}
+		if s.MinItems != nil && len(items) < *s.MinItems {
+			if *s.MinItems == 1 {
+				return fail("must not be empty")
+			}
+			return fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			return fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", field, i)); err != nil {
+					return err
+				}
+			}
+		}
+
+	case "string":
+		text, ok := v.(string)
+		if !ok {
+			return fail("must be a string")
+		}
+		length := utf8.RuneCountInString(text)
+		if s.MinLength != nil && length < *s.MinLength {
+			return fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fail("must be at most %d characters", *s.MaxLength)
+		}
+		switch s.Format {
+		case "byte":
+			if _, err := base64.StdEncoding.DecodeString(text); err != nil {
+				return fail("must be standard base64")
+			}
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, text); err != nil {
+				return fail("must be an RFC 3339 timestamp")
+			}
+		}
+
+	case "integer", "number":
+		number, ok := v.(json.Number)
+		if !ok {
+			return fail("must be %s", article(s.Type))
+		}
+		value, err := number.Float64()
+		if err != nil {
+			return fail("must be %s", article(s.Type))
+		}
+		if s.Type == "integer" {
+			if _, err := number.Int64(); err != nil {
+				return fail("must be an integer")
+			}
+		}
+		if s.Minimum != nil && value < *s.Minimum {
+			return fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && value > *s.Maximum {
+			return fail("must be at most %v", *s.Maximum)
+		}
+
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fail("must be true or false")
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		for _, allowed := range s.Enum {
+			if reflect.DeepEqual(allowed, v) {
+				return nil
+			}
+		}
+		return fail("must be one of %v", s.Enum)
+	}
+	return nil
+}
+
+// article prefixes a type name with "a" or "an"
+func article(typeName string) string {
+	if typeName == "integer" {
+		return "an integer"
+	}
+	return "a " + typeName
+}
+
+// join extends a field path with a property name
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
@@ -0,0 +1,335 @@
+// Package apispec checks HTTP requests against an OpenAPI 3 document
+//
+// Only the parts of OpenAPI the relay's own document uses are understood:
+// path templates, query and header parameters, JSON request bodies and the
+// schema keywords listed on Schema. Anything else is accepted unchecked
+package apispec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Spec is a parsed OpenAPI document
+type Spec struct {
+	paths []*pathItem
+}
+
+// Operation is one method on one path
+type Operation struct {
+	ID          string
+	Parameters  []*Parameter
+	RequestBody *RequestBody
+}
+
+// Parameter is a query, header or path parameter
+type Parameter struct {
+	Name     string
+	In       string
+	Required bool
+	Schema   *Schema
+}
+
+// RequestBody lists the accepted media types and their schemas
+type RequestBody struct {
+	Required bool
+	Content  map[string]*Schema
+}
+
+// pathItem is a path template and its operations by method
+type pathItem struct {
+	segments   []string // "{name}" matches any single segment
+	literals   int      // Segments that are not parameters, to prefer /queue/create over /queue/{id}
+	operations map[string]*Operation
+}
+
+// document mirrors the parts of the OpenAPI JSON that are read
+type document struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema    `json:"schemas"`
+		Parameters map[string]*parameter `json:"parameters"`
+	} `json:"components"`
+}
+
+type parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []*parameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool `json:"required"`
+		Content  map[string]struct {
+			Schema *Schema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+}
+
+// methods are the path item keys that hold operations
+var methods = map[string]string{
+	"get": http.MethodGet, "put": http.MethodPut, "post": http.MethodPost,
+	"delete": http.MethodDelete, "patch": http.MethodPatch, "head": http.MethodHead,
+	"options": http.MethodOptions,
+}
+
+// Load parses an OpenAPI 3 JSON document and resolves its local references
+func Load(data []byte) (*Spec, error) {
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	r := &resolver{schemas: doc.Components.Schemas}
+
+	spec := &Spec{}
+	for path, raw := range doc.Paths {
+		item := &pathItem{segments: splitPath(path), operations: make(map[string]*Operation)}
+		for _, segment := range item.segments {
+			if !isTemplate(segment) {
+				item.literals++
+			}
+		}
+
+		var shared []*parameter
+		if params, ok := raw["parameters"]; ok {
+			if err := json.Unmarshal(params, &shared); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		for key, body := range raw {
+			method, ok := methods[key]
+			if !ok {
+				continue
+			}
+			var op operation
+			if err := json.Unmarshal(body, &op); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			parsed, err := r.operation(&op, shared, doc.Components.Parameters)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			item.operations[method] = parsed
+		}
+		spec.paths = append(spec.paths, item)
+	}
+	return spec, nil
+}
+
+// MustLoad is Load for documents compiled into the binary
+func MustLoad(data []byte) *Spec {
+	spec, err := Load(data)
+	if err != nil {
+		panic(err)
+	}
+	return spec
+}
+
+// Find returns the operation for a method and a path relative to the
+// document's server URL, or nil when the document does not describe it
+func (s *Spec) Find(method, path string) *Operation {
+	segments := splitPath(path)
+	var best *pathItem
+	for _, item := range s.paths {
+		if item.operations[method] == nil || !item.matches(segments) {
+			continue
+		}
+		if best == nil || item.literals > best.literals {
+			best = item
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.operations[method]
+}
+
+func (p *pathItem) matches(segments []string) bool {
+	if len(segments) != len(p.segments) {
+		return false
+	}
+	for i, segment := range p.segments {
+		if segments[i] == "" || (!isTemplate(segment) && segment != segments[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateParams checks the query and header parameters of r
+func (o *Operation) ValidateParams(r *http.Request) error {
+	query := r.URL.Query()
+	for _, param := range o.Parameters {
+		var value string
+		var present bool
+		switch param.In {
+		case "query":
+			present = query.Has(param.Name)
+			value = query.Get(param.Name)
+		case "header":
+			value = r.Header.Get(param.Name)
+			present = value != ""
+		default:
+			continue // Path parameters are matched by the router
+		}
+
+		if !present {
+			if param.Required {
+				return &ValidationError{Field: param.Name, Reason: "is required"}
+			}
+			continue
+		}
+		if param.Schema == nil {
+			continue
+		}
+		v, err := param.Schema.coerce(value)
+		if err != nil {
+			return &ValidationError{Field: param.Name, Reason: err.Error()}
+		}
+		if err := param.Schema.validate(v, param.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateJSON checks a JSON request body; an empty body is only an error
+// when the operation requires one
+func (o *Operation) ValidateJSON(data []byte) error {
+	if o.RequestBody == nil {
+		return nil
+	}
+	schema := o.RequestBody.Content["application/json"]
+	if schema == nil {
+		return nil
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		if o.RequestBody.Required {
+			return &ValidationError{Field: "request body", Reason: "is required"}
+		}
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return ErrInvalidJSON
+	}
+	return schema.validate(v, "")
+}
+
+// coerce converts a parameter's text to the type its schema names
+func (s *Schema) coerce(value string) (interface{}, error) {
+	switch s.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("must be %s", article(s.Type))
+		}
+		return json.Number(value), nil
+	case "boolean":
+		if value != "true" && value != "false" {
+			return nil, errors.New("must be true or false")
+		}
+		return value == "true", nil
+	}
+	return value, nil
+}
+
+// resolver replaces $ref entries with the components they name
+type resolver struct {
+	schemas map[string]*Schema
+}
+
+func (r *resolver) operation(op *operation, shared []*parameter, components map[string]*parameter) (*Operation, error) {
+	parsed := &Operation{ID: op.OperationID}
+	for _, param := range append(append([]*parameter{}, shared...), op.Parameters...) {
+		if param.Ref != "" {
+			name, ok := strings.CutPrefix(param.Ref, "#/components/parameters/")
+			if !ok || components[name] == nil {
+				return nil, fmt.Errorf("unresolved reference %q", param.Ref)
+			}
+			param = components[name]
+		}
+		schema, err := r.schema(param.Schema)
+		if err != nil {
+			return nil, err
+		}
+		name := param.Name
+		if param.In == "header" {
+			name = http.CanonicalHeaderKey(name)
+		}
+		parsed.Parameters = append(parsed.Parameters, &Parameter{
+			Name: name, In: param.In, Required: param.Required, Schema: schema,
+		})
+	}
+
+	if op.RequestBody != nil {
+		parsed.RequestBody = &RequestBody{Required: op.RequestBody.Required, Content: make(map[string]*Schema)}
+		for mediaType, content := range op.RequestBody.Content {
+			schema, err := r.schema(content.Schema)
+			if err != nil {
+				return nil, err
+			}
+			parsed.RequestBody.Content[mediaType] = schema
+		}
+	}
+	return parsed, nil
+}
+
+// schema resolves references in s and everything below it, in place
+func (r *resolver) schema(s *Schema) (*Schema, error) {
+	if s == nil {
+		return nil, nil
+	}
+	if s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/")
+		if !ok || r.schemas[name] == nil {
+			return nil, fmt.Errorf("unresolved reference %q", s.Ref)
+		}
+		target := r.schemas[name]
+		if target.resolving {
+			return target, nil // Recursive schema; already being resolved
+		}
+		return r.schema(target)
+	}
+	if s.resolved {
+		return s, nil
+	}
+	s.resolving = true
+	defer func() { s.resolving, s.resolved = false, true }()
+
+	var err error
+	for name, property := range s.Properties {
+		if s.Properties[name], err = r.schema(property); err != nil {
+			return nil, err
+		}
+	}
+	if s.Items, err = r.schema(s.Items); err != nil {
+		return nil, err
+	}
+	for i, option := range s.OneOf {
+		if s.OneOf[i], err = r.schema(option); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+func isTemplate(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
@@ -0,0 +1,243 @@
+// Package atrest encrypts what the relay keeps in Redis
+//
+// Values are sealed with XChaCha20-Poly1305 under a data key. Data keys are
+// stored in Redis only wrapped (encrypted) by a key-encryption key that
+// never enters Redis: a file, or a KMS or Vault key behind KeyWrapper. A
+// Redis snapshot therefore holds ciphertext and wrapped keys only. Every
+// sealed value names its data key, so keys can be rotated while older
+// values stay readable until they are sealed again.
+package atrest
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+var (
+	ErrUnknownKey = errors.New("value sealed with an unknown data key")
+	ErrDecrypt    = errors.New("failed to decrypt value")
+)
+
+// KeySize is the size of data keys and file key-encryption keys
+const KeySize = chacha20poly1305.KeySize
+
+// magic starts every sealed value; plaintext JSON never starts with a NUL
+var magic = []byte("\x00atr1")
+
+// KeyWrapper holds the key-encryption key that protects data keys
+type KeyWrapper interface {
+	ID() string // Stable name of the key-encryption key, stored with each wrapped data key
+	Wrap(ctx context.Context, dataKey []byte) ([]byte, error)
+	Unwrap(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// FileKey is a key-encryption key held in a local file
+type FileKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// LoadFileKey reads a key-encryption key: 32 random bytes, base64-encoded
+// (e.g. from openssl rand -base64 32)
+func LoadFileKey(path string) (*FileKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read at-rest key: %w", err)
+	}
+	key, err := ParseFileKey(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// ParseFileKey decodes a key-encryption key in the LoadFileKey format,
+// e.g. one fetched from a secret store
+func ParseFileKey(encoded string) (*FileKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != KeySize {
+		return nil, fmt.Errorf("at-rest key must be %d base64-encoded bytes", KeySize)
+	}
+	return NewFileKey(key)
+}
+
+// NewFileKey wraps data keys with key
+func NewFileKey(key []byte) (*FileKey, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &FileKey{id: "file:" + hex.EncodeToString(sum[:8]), aead: aead}, nil
+}
+
+// ID names the key by a hash of it, so a different file is noticed
+func (k *FileKey) ID() string {
+	return k.id
+}
+
+// Wrap encrypts a data key
+func (k *FileKey) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize(), k.aead.NonceSize()+len(dataKey)+k.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(nonce, nonce, dataKey, []byte(k.id)), nil
+}
+
+// Unwrap decrypts a data key
+func (k *FileKey) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < k.aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	dataKey, err := k.aead.Open(nil, wrapped[:k.aead.NonceSize()], wrapped[k.aead.NonceSize():], []byte(k.id))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return dataKey, nil
+}
+
+// NewDataKey returns a random data key and an ID for it
+func NewDataKey() (id string, key []byte, err error) {
+	key = make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", nil, err
+	}
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	return hex.EncodeToString(raw), key, nil
+}
+
+// Keyring holds unwrapped data keys and which one seals new values
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[string]cipher.AEAD
+	current string
+}
+
+// NewKeyring returns an empty keyring
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string]cipher.AEAD)}
+}
+
+// Add makes a data key available for opening values
+func (k *Keyring) Add(id string, key []byte) error {
+	if id == "" || len(id) > 255 {
+		return errors.New("invalid data key ID")
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	k.keys[id] = aead
+	k.mu.Unlock()
+	return nil
+}
+
+// Remove forgets a retired data key
+func (k *Keyring) Remove(id string) {
+	k.mu.Lock()
+	delete(k.keys, id)
+	k.mu.Unlock()
+}
+
+// Has reports whether the keyring holds a data key
+func (k *Keyring) Has(id string) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[id] != nil
+}
+
+// SetCurrent picks the data key new values are sealed with
+func (k *Keyring) SetCurrent(id string) {
+	k.mu.Lock()
+	k.current = id
+	k.mu.Unlock()
+}
+
+// Current returns the ID of the data key new values are sealed with
+func (k *Keyring) Current() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current
+}
+
+// Seal encrypts a value under the current data key, bound to the Redis
+// key it is stored at so it cannot be moved to another
+func (k *Keyring) Seal(key string, plaintext []byte) ([]byte, error) {
+	k.mu.RLock()
+	id, aead := k.current, k.keys[k.current]
+	k.mu.RUnlock()
+	if aead == nil {
+		return nil, ErrUnknownKey
+	}
+
+	header := make([]byte, 0, len(magic)+1+len(id))
+	header = append(append(append(header, magic...), byte(len(id))), id...)
+	out := make([]byte, len(header)+aead.NonceSize(), len(header)+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	copy(out, header)
+	nonce := out[len(header):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, plaintext, append(header, key...)), nil
+}
+
+// Open decrypts a sealed value read from the Redis key it was sealed for
+func (k *Keyring) Open(key string, data []byte) ([]byte, error) {
+	id, ok := KeyID(data)
+	if !ok {
+		return nil, ErrDecrypt
+	}
+	k.mu.RLock()
+	aead := k.keys[id]
+	k.mu.RUnlock()
+	if aead == nil {
+		return nil, ErrUnknownKey
+	}
+
+	headerSize := len(magic) + 1 + len(id)
+	if len(data) < headerSize+aead.NonceSize()+aead.Overhead() {
+		return nil, ErrDecrypt
+	}
+	header := data[:headerSize]
+	nonce := data[headerSize : headerSize+aead.NonceSize()]
+	ad := append(append([]byte{}, header...), key...)
+	plaintext, err := aead.Open(nil, nonce, data[headerSize+aead.NonceSize():], ad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// Sealed reports whether a stored value was sealed by a Keyring
+func Sealed(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// KeyID returns the data key a sealed value names
+func KeyID(data []byte) (string, bool) {
+	if !Sealed(data) || len(data) < len(magic)+1 {
+		return "", false
+	}
+	size := int(data[len(magic)])
+	if size == 0 || len(data) < len(magic)+1+size {
+		return "", false
+	}
+	return string(data[len(magic)+1 : len(magic)+1+size]), true
+}
@@ -0,0 +1,110 @@
+package authhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"plugin"
+	"time"
+)
+
+var (
+	ErrDenied = errors.New("denied by authentication hook")
+)
+
+// Operation identifies the privileged action being authorized
+type Operation string
+
+const (
+	OpCreateQueue Operation = "create_queue"
+	OpDeleteQueue Operation = "delete_queue"
+)
+
+// CredentialHeader carries the deployment-specific credential (e.g. an SSO bearer token)
+// It is separate from Authorization, which holds queue access tokens
+const CredentialHeader = "X-Auth-Token"
+
+// Request describes an operation awaiting authorization
+// Hooks see the enterprise credential, never queue access tokens or payloads
+type Request struct {
+	Operation  Operation `json:"operation"`
+	QueueID    string    `json:"queue_id,omitempty"`
+	Credential string    `json:"credential"`
+	ClientIP   string    `json:"client_ip"`
+}
+
+// Hook decides whether a privileged operation may proceed
+// Return nil to allow, ErrDenied (or an error wrapping it) to reject
+// Any other error is treated as a hook failure and the request is rejected
+type Hook interface {
+	Authorize(ctx context.Context, req *Request) error
+}
+
+// HTTPHook delegates authorization to an external HTTP service
+// The service receives the Request as JSON and answers 2xx to allow, 401/403 to deny
+type HTTPHook struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPHook creates a hook that POSTs to url
+func NewHTTPHook(url string, timeout time.Duration) *HTTPHook {
+	return &HTTPHook{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Authorize implements Hook
+func (h *HTTPHook) Authorize(ctx context.Context, req *Request) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("auth hook unreachable: %w", err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return ErrDenied
+	default:
+		return fmt.Errorf("auth hook returned %s", resp.Status)
+	}
+}
+
+// LoadPlugin opens a Go plugin exporting `var Hook authhook.Hook`
+// The plugin must be built from within this module since authhook is internal
+// Plugins require a cgo-enabled build with identical dependency versions
+func LoadPlugin(path string) (Hook, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open auth plugin: %w", err)
+	}
+
+	sym, err := p.Lookup("Hook")
+	if err != nil {
+		return nil, fmt.Errorf("auth plugin has no Hook symbol: %w", err)
+	}
+
+	// Lookup returns a pointer to the exported variable
+	hook, ok := sym.(*Hook)
+	if !ok || *hook == nil {
+		return nil, errors.New("auth plugin Hook has wrong type")
+	}
+	return *hook, nil
+}
@@ -0,0 +1,35 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotFound    = errors.New("blob not found")
+	ErrNotIncluded = errors.New("blob store not included in this build (built with -tags minimal)")
+)
+
+// Store is a minimal object store for encrypted payloads
+// Blobs are opaque ciphertext; the store never needs to understand them
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Sweeper is implemented by stores that can expire old blobs themselves
+// Object stores like S3 should use a bucket lifecycle rule instead
+type Sweeper interface {
+	Sweep(ctx context.Context, olderThan time.Duration) (int, error)
+}
+
+// S3Options holds credentials and endpoint settings for S3-compatible stores
+type S3Options struct {
+	Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com or http://minio:9000
+	Region    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool // Use endpoint/bucket/key instead of bucket.endpoint/key (MinIO)
+}
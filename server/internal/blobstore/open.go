@@ -0,0 +1,28 @@
+//go:build !minimal
+
+package blobstore
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Open creates a store from a URL:
+//
+//	file:///var/lib/relay/blobs   - local filesystem
+//	s3://bucket-name/optional/prefix - S3-compatible object storage
+func Open(rawURL string, s3opts S3Options) (Store, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blob store URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return NewFSStore(u.Path)
+	case "s3":
+		return NewS3Store(u.Host, u.Path, s3opts)
+	default:
+		return nil, fmt.Errorf("unsupported blob store scheme %q", u.Scheme)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build minimal
+
+package blobstore
+
+// Open always fails in minimal builds, so archival and hibernation can't be enabled
+func Open(rawURL string, s3opts S3Options) (Store, error) {
+	return nil, ErrNotIncluded
+}
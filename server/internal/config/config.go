@@ -1,8 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds the server configuration
@@ -11,30 +15,455 @@ type Config struct {
 	RedisAddr string
 	RedisPass string
 	RedisDB   int
+
+	// Logging
+	LogFormat   string // "text" or "json"
+	LogLevel    string // "debug", "info", "warn" or "error"
+	LogRequests bool   // One access log line per request (false = strict no-request-logging mode)
+
+	// OpenTelemetry tracing
+	TracingEndpoint    string  // OTLP/HTTP collector URL (empty = disabled)
+	TracingSampleRatio float64 // Fraction of new traces recorded
+
+	// Live profiling
+	Pprof     bool   // Serve net/http/pprof at /debug/pprof
+	PprofAddr string // Separate listener for profiles (empty = main port behind ADMIN_TOKEN)
+
+	// Removal date of the unversioned API paths, YYYY-MM-DD (empty = not announced)
+	LegacyAPISunset string
+
+	// Time in-flight requests get to finish on shutdown
+	DrainTimeout time.Duration
+
+	// HTTP server limits against slow or oversized clients (0 = no limit)
+	HTTPReadHeaderTimeout time.Duration // Time to send the request headers
+	HTTPReadTimeout       time.Duration // Time to send the whole request, body included
+	HTTPWriteTimeout      time.Duration // Time to receive the response; must exceed the 30s long-poll
+	HTTPIdleTimeout       time.Duration // Keep-alive connections idle longer are closed
+	HTTPMaxHeaderBytes    int           // Largest request header block
+
+	// Native TLS (both files empty = plain HTTP, e.g. behind a proxy)
+	TLSCertFile          string // PEM certificate chain
+	TLSKeyFile           string // PEM private key
+	TLSClientCAFile      string // PEM CAs that sign client certificates (empty = no client auth)
+	TLSRequireClientCert bool   // Reject clients without a certificate when TLSClientCAFile is set
+
+	// Automatic certificates (ignored when TLSCertFile is set)
+	ACMEDomains  []string // Host names to obtain Let's Encrypt certificates for (empty = disabled)
+	ACMECacheDir string   // Persistent directory for ACME account keys and certificates
+	ACMEEmail    string   // Contact address for expiry notices
+	ACMEHTTPPort int      // Port serving HTTP-01 challenges and redirecting to HTTPS
+
+	// Reverse proxies allowed to report the client address
+	TrustedProxies []string // CIDRs or IPs whose X-Forwarded-For / X-Real-IP are honored
+	ProxyProtocol  bool     // Trusted proxies send a PROXY protocol v1/v2 header first
+
+	// Hide whether a queue exists from callers without a valid token
+	UniformErrors bool
+
+	// Attenuable capability tokens
+	MacaroonSecret string // Root secret for macaroons (empty = disabled)
+
+	// Encryption at rest of queue records and messages in Redis
+	AtRestKeyFile          string   // Base64 32-byte key-encryption key, or a Vault transit / AWS KMS key (empty = disabled)
+	AtRestPreviousKeyFiles []string // Replaced key-encryption keys, kept until their data keys are rewrapped
+
+	// Secret stores for vault://, awssm://, vault-transit:// and awskms:// references in
+	// REDIS_PASS, TLS_CERT_FILE, TLS_KEY_FILE and the AT_REST_* keys
+	VaultAddr       string        // Vault server URL (empty = disabled)
+	VaultToken      string        // Static Vault token
+	VaultTokenFile  string        // File holding the token, e.g. a Vault Agent sink
+	VaultRoleID     string        // AppRole role ID, instead of a token
+	VaultSecretID   string        // AppRole secret ID
+	VaultNamespace  string        // Vault Enterprise namespace
+	AWSRegion       string        // Region for Secrets Manager and KMS IDs that are not ARNs (empty = disabled)
+	AWSAccessKey    string        // AWS access key ID
+	AWSSecretKey    string        // AWS secret access key
+	AWSSessionToken string        // Session token for temporary credentials
+	SecretsRefresh  time.Duration // How often fetched secrets are read again
+
+	// Operator API
+	AdminToken      string // Bearer token for /admin (empty = admin API disabled)
+	AdminConsole    bool   // Serve the embedded web console at /admin/console
+	IdentityKeyFile string // PEM Ed25519 key for signing notices and GET /time (empty = ephemeral)
+	TransparencyLog bool   // Record identity keys and prekey uploads in an auditable Merkle log
+
+	// Tenants with operator-issued API keys
+	Tenancy           bool     // Attribute queues created with a Tenant-Key to its tenant
+	TenantKeyRequired bool     // Refuse queue creation without a valid tenant key
+	TenantTiers       []string // Quota tiers, e.g. free:queues=1000;messages=100000;bytes=1000000000;messages_per_second=10
+	TenantDefaultTier string   // Tier new tenants get (empty = unlimited)
+
+	// Tolerance for client clocks when checking client-supplied deadlines
+	ClockSkew time.Duration
+
+	// Server-wide quotas, across all replicas (0 = unlimited)
+	QuotaMaxQueues            int   // Live queues
+	QuotaMaxStoredBytes       int64 // Redis used_memory above which sends and creates are refused
+	QuotaMaxMessagesPerSecond int   // Accepted sends per second
+
+	// Server defaults for options clients leave unset (clamped to the maximums below)
+	QueueDefaultTTL            time.Duration // Queue lifetime
+	QueueDefaultMaxMessages    int           // Messages held at once
+	QueueDefaultMaxMessageSize int           // Largest payload in bytes
+	MessageDefaultTTL          time.Duration // Message lifetime when the sender sets none
+
+	// Server maximums for client-requested queue options
+	QueueMaxTTL         time.Duration // Longest queue lifetime a client may request
+	QueueMaxMessages    int           // Largest max_messages a client may request
+	QueueMaxMessageSize int           // Largest max_message_size a client may request
+	MessageMaxTTL       time.Duration // Longest message lifetime, including sender-chosen TTLs
+
+	// WebSocket delivery
+	WSCompression         bool          // Negotiate permessage-deflate with clients that offer it
+	WSMaxConnectionsPerIP int           // Concurrent WebSocket connections per client IP (0 = unlimited)
+	WSMaxSubscriptions    int           // Queues one WebSocket connection may subscribe to (0 = unlimited)
+	WSSignalMaxBytes      int           // Largest ephemeral signal payload (0 = signaling disabled)
+	WSSignalRate          int           // Signals per second one connection may send (0 = unlimited)
+	WSCoverMinInterval    time.Duration // Shortest mean gap between decoy frames a client may ask for (0 = cover traffic disabled)
+	WSNoise               bool          // Offer Noise-encrypted subprotocols, keyed by the identity key
+
+	// Mixed delivery
+	MixMaxDelay time.Duration // Longest a mixed-delivery queue holds a batch of messages (0 = mixed delivery disabled)
+
+	// Delivery debugging
+	JournalRetention time.Duration // Event journal retention (0 = disabled)
+	ReceiptRetention time.Duration // How long delivery receipts outlive their message (0 = no receipts)
+
+	// Object storage (archival tier)
+	BlobStoreURL   string        // file:///path or s3://bucket/prefix (empty = disabled)
+	S3Endpoint     string        // S3-compatible endpoint (default AWS for S3Region)
+	S3Region       string        // S3 region
+	S3AccessKey    string        // S3 access key ID
+	S3SecretKey    string        // S3 secret access key
+	S3PathStyle    bool          // Path-style addressing (MinIO)
+	ArchiveAfter   time.Duration // Spill payloads older than this to the blob store (0 = never)
+	OffloadAbove   int           // Write payloads larger than this many bytes to the blob store at send (0 = never)
+	HibernateAfter time.Duration // Move queues idle this long to the blob store (0 = never)
+
+	// Outbound (webhook/federation) settings
+	DoHURL             string   // DNS-over-HTTPS endpoint for outbound lookups (empty = system resolver)
+	EgressAllowPrivate bool     // Allow outbound requests to private/internal ranges
+	EgressAllowHTTP    bool     // Allow plain http:// callback URLs
+	EgressAllowlist    []string // CIDRs or hostnames exempt from the internal-range deny list
+	EgressMaxRedirects int      // Redirects followed on outbound requests
+
+	// Outbound webhooks
+	WebhooksEnabled    bool // Let queue owners register a webhook for new messages
+	WebhookWorkers     int  // Concurrent deliveries per replica
+	WebhookMaxFailures int  // Failed attempts in a row before a webhook is disabled
+
+	// Mobile push wake-ups
+	PushFCMCredentials string        // Firebase service account key file (empty = FCM off)
+	PushAPNsKeyFile    string        // .p8 token signing key (empty = APNs off)
+	PushAPNsKeyID      string        // Key ID of the .p8 key
+	PushAPNsTeamID     string        // Apple developer team ID
+	PushAPNsTopic      string        // App bundle ID
+	PushAPNsSandbox    bool          // Use the APNs development environment
+	PushUnifiedPush    bool          // Wake devices at UnifiedPush endpoint URLs they register
+	PushNtfyServer     string        // ntfy server whose topics devices may register (empty = ntfy off)
+	PushVAPIDKeyFile   string        // P-256 key for Web Push; must not change (empty = Web Push off)
+	PushVAPIDSubject   string        // mailto: or https: contact sent to browser push services
+	PushMinInterval    time.Duration // Least time between wake-ups for one queue
+
+	// Anonymous rate-limit tokens
+	AnonTokensEnabled     bool
+	AnonTokenKeyFile      string // PEM RSA issuer key (empty = ephemeral key)
+	AnonTokenIssuerSecret string // Bearer secret for the attester allowed to request issuance
+
+	// Blind-signed vouchers that raise a queue's limits
+	VoucherKeyFile        string        // PEM RSA issuer key, not the anonymous token key (empty = vouchers disabled)
+	VoucherIssuerSecret   string        // Bearer secret for the seller allowed to request issuance
+	VoucherValidity       time.Duration // How long redeemed vouchers are remembered; rotate the key at least this often
+	VoucherMaxMessages    int           // Message cap of a queue a voucher was redeemed for
+	VoucherMaxMessageSize int           // Payload cap in bytes of such a queue
+	VoucherTTL            time.Duration // Lifetime of such a queue, from redemption
+
+	// Enterprise authentication hook (both empty = account-free public mode)
+	AuthHookURL     string        // External HTTP authorization service
+	AuthHookPlugin  string        // Path to a Go plugin exporting Hook
+	AuthHookTimeout time.Duration // Timeout for HTTP hook calls
+
+	// Accept/reject policy
+	PolicyFile string // Starlark script defining allow(req) (empty = accept everything)
+
+	// Multi-region deployment
+	Region      string        // Local region tag embedded in new queue IDs (empty = single region)
+	RegionPeers []string      // Sibling regions as region=url pairs
+	RegionProbe time.Duration // How often sibling regions are health-checked
+
+	// Mutual TLS between regions
+	RegionTLSCertFile string   // PEM certificate presented to sibling regions
+	RegionTLSKeyFile  string   // Its private key
+	RegionPeerPins    []string // region=pin pairs allowed to send federation traffic (empty = peers not authenticated)
+
+	// Onion routing
+	OnionRouting bool // Accept onion-routed sends, with a key derived from the identity key
 }
 
 // Load loads configuration from environment variables
 func Load() *Config {
-	return &Config{
-		Port:      getEnvInt("PORT", 8080),
-		RedisAddr: getEnv("REDIS_ADDR", "localhost:6379"),
-		RedisPass: getEnv("REDIS_PASS", ""),
-		RedisDB:   getEnvInt("REDIS_DB", 0),
+	return (&loader{}).load()
+}
+
+// LoadFile loads configuration from a YAML (.yaml, .yml) or TOML (.toml)
+// file whose keys are the environment variable names, in any case
+// Environment variables override the file; an empty path is the same as Load
+func LoadFile(path string) (*Config, error) {
+	if path == "" {
+		return Load(), nil
+	}
+	values, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &loader{file: values, used: make(map[string]bool)}
+	cfg := l.load()
+
+	// A misspelled key would otherwise be silently ignored
+	var unknown []string
+	for key := range values {
+		if !l.used[key] {
+			unknown = append(unknown, strings.ToLower(key))
+		}
 	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown settings in %s: %s", path, strings.Join(unknown, ", "))
+	}
+	return cfg, nil
+}
+
+// loader reads settings from the environment, then the config file
+type loader struct {
+	file map[string]string // Upper-cased keys (nil = environment only)
+	used map[string]bool   // File keys that name a setting
 }
 
-func getEnv(key, defaultValue string) string {
+// lookup returns the value for key, or "" if it is set nowhere
+func (l *loader) lookup(key string) string {
+	if l.used != nil {
+		l.used[key] = true
+	}
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
+	return l.file[key]
+}
+
+func (l *loader) load() *Config {
+	return &Config{
+		Port:      l.getEnvInt("PORT", 8080),
+		RedisAddr: l.getEnv("REDIS_ADDR", "localhost:6379"),
+		RedisPass: l.getEnv("REDIS_PASS", ""),
+		RedisDB:   l.getEnvInt("REDIS_DB", 0),
+
+		LogFormat:   l.getEnv("LOG_FORMAT", "text"),
+		LogLevel:    l.getEnv("LOG_LEVEL", "info"),
+		LogRequests: l.getEnvBool("LOG_REQUESTS", true),
+
+		TracingEndpoint:    l.getEnv("TRACING_ENDPOINT", ""),
+		TracingSampleRatio: l.getEnvFloat("TRACING_SAMPLE_RATIO", 0.1),
+
+		Pprof:     l.getEnvBool("PPROF", false),
+		PprofAddr: l.getEnv("PPROF_ADDR", ""),
+
+		LegacyAPISunset: l.getEnv("LEGACY_API_SUNSET", ""),
+
+		DrainTimeout: l.getEnvDuration("DRAIN_TIMEOUT", 10*time.Second),
+
+		HTTPReadHeaderTimeout: l.getEnvDuration("HTTP_READ_HEADER_TIMEOUT", 10*time.Second),
+		HTTPReadTimeout:       l.getEnvDuration("HTTP_READ_TIMEOUT", 60*time.Second),
+		HTTPWriteTimeout:      l.getEnvDuration("HTTP_WRITE_TIMEOUT", 90*time.Second),
+		HTTPIdleTimeout:       l.getEnvDuration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+		HTTPMaxHeaderBytes:    l.getEnvInt("HTTP_MAX_HEADER_BYTES", 64*1024),
+
+		TLSCertFile:          l.getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:           l.getEnv("TLS_KEY_FILE", ""),
+		TLSClientCAFile:      l.getEnv("TLS_CLIENT_CA_FILE", ""),
+		TLSRequireClientCert: l.getEnvBool("TLS_REQUIRE_CLIENT_CERT", true),
+
+		ACMEDomains:  l.getEnvList("ACME_DOMAINS"),
+		ACMECacheDir: l.getEnv("ACME_CACHE_DIR", "acme-cache"),
+		ACMEEmail:    l.getEnv("ACME_EMAIL", ""),
+		ACMEHTTPPort: l.getEnvInt("ACME_HTTP_PORT", 80),
+
+		TrustedProxies: l.getEnvList("TRUSTED_PROXIES"),
+		ProxyProtocol:  l.getEnvBool("PROXY_PROTOCOL", false),
+
+		UniformErrors: l.getEnvBool("UNIFORM_ERRORS", false),
+
+		MacaroonSecret: l.getEnv("MACAROON_SECRET", ""),
+
+		AtRestKeyFile:          l.getEnv("AT_REST_KEY_FILE", ""),
+		AtRestPreviousKeyFiles: l.getEnvList("AT_REST_PREVIOUS_KEY_FILES"),
+
+		VaultAddr:       l.getEnv("VAULT_ADDR", ""),
+		VaultToken:      l.getEnv("VAULT_TOKEN", ""),
+		VaultTokenFile:  l.getEnv("VAULT_TOKEN_FILE", ""),
+		VaultRoleID:     l.getEnv("VAULT_ROLE_ID", ""),
+		VaultSecretID:   l.getEnv("VAULT_SECRET_ID", ""),
+		VaultNamespace:  l.getEnv("VAULT_NAMESPACE", ""),
+		AWSRegion:       l.getEnv("AWS_REGION", ""),
+		AWSAccessKey:    l.getEnv("AWS_ACCESS_KEY_ID", ""),
+		AWSSecretKey:    l.getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		AWSSessionToken: l.getEnv("AWS_SESSION_TOKEN", ""),
+		SecretsRefresh:  l.getEnvDuration("SECRETS_REFRESH", 5*time.Minute),
+
+		AdminToken:      l.getEnv("ADMIN_TOKEN", ""),
+		AdminConsole:    l.getEnvBool("ADMIN_CONSOLE", false),
+		IdentityKeyFile: l.getEnv("IDENTITY_KEY_FILE", ""),
+		TransparencyLog: l.getEnvBool("TRANSPARENCY_LOG", false),
+
+		Tenancy:           l.getEnvBool("TENANCY", false),
+		TenantKeyRequired: l.getEnvBool("TENANT_KEY_REQUIRED", false),
+		TenantTiers:       l.getEnvList("TENANT_TIERS"),
+		TenantDefaultTier: l.getEnv("TENANT_DEFAULT_TIER", ""),
+
+		ClockSkew: l.getEnvDuration("CLOCK_SKEW", 5*time.Minute),
+
+		QuotaMaxQueues:            l.getEnvInt("QUOTA_MAX_QUEUES", 0),
+		QuotaMaxStoredBytes:       int64(l.getEnvInt("QUOTA_MAX_STORED_BYTES", 0)),
+		QuotaMaxMessagesPerSecond: l.getEnvInt("QUOTA_MAX_MESSAGES_PER_SECOND", 0),
+
+		QueueDefaultTTL:            l.getEnvDuration("QUEUE_DEFAULT_TTL", 7*24*time.Hour),
+		QueueDefaultMaxMessages:    l.getEnvInt("QUEUE_DEFAULT_MAX_MESSAGES", 1000),
+		QueueDefaultMaxMessageSize: l.getEnvInt("QUEUE_DEFAULT_MAX_MESSAGE_SIZE", 4*1024*1024),
+		MessageDefaultTTL:          l.getEnvDuration("MESSAGE_DEFAULT_TTL", 24*time.Hour),
+
+		QueueMaxTTL:         l.getEnvDuration("QUEUE_MAX_TTL", 30*24*time.Hour),
+		QueueMaxMessages:    l.getEnvInt("QUEUE_MAX_MESSAGES", 1000),
+		QueueMaxMessageSize: l.getEnvInt("QUEUE_MAX_MESSAGE_SIZE", 4*1024*1024),
+		MessageMaxTTL:       l.getEnvDuration("MESSAGE_MAX_TTL", 24*time.Hour),
+
+		WSCompression:         l.getEnvBool("WS_COMPRESSION", true),
+		WSMaxConnectionsPerIP: l.getEnvInt("WS_MAX_CONNECTIONS_PER_IP", 32),
+		WSMaxSubscriptions:    l.getEnvInt("WS_MAX_SUBSCRIPTIONS", 100),
+		WSSignalMaxBytes:      l.getEnvInt("WS_SIGNAL_MAX_BYTES", 1024),
+		WSSignalRate:          l.getEnvInt("WS_SIGNAL_RATE", 10),
+		WSCoverMinInterval:    l.getEnvDuration("WS_COVER_MIN_INTERVAL", 5*time.Second),
+		WSNoise:               l.getEnvBool("WS_NOISE", true),
+
+		MixMaxDelay: l.getEnvDuration("MIX_MAX_DELAY", 30*time.Second),
+
+		JournalRetention: l.getEnvDuration("JOURNAL_RETENTION", 0),
+		ReceiptRetention: l.getEnvDuration("RECEIPT_RETENTION", 24*time.Hour),
+
+		BlobStoreURL:   l.getEnv("BLOB_STORE", ""),
+		S3Endpoint:     l.getEnv("S3_ENDPOINT", ""),
+		S3Region:       l.getEnv("S3_REGION", "us-east-1"),
+		S3AccessKey:    l.getEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretKey:    l.getEnv("S3_SECRET_ACCESS_KEY", ""),
+		S3PathStyle:    l.getEnvBool("S3_PATH_STYLE", false),
+		ArchiveAfter:   l.getEnvDuration("ARCHIVE_AFTER", 0),
+		OffloadAbove:   l.getEnvInt("OFFLOAD_ABOVE", 0),
+		HibernateAfter: l.getEnvDuration("HIBERNATE_AFTER", 0),
+
+		DoHURL:             l.getEnv("DOH_URL", ""),
+		EgressAllowPrivate: l.getEnvBool("EGRESS_ALLOW_PRIVATE", false),
+		EgressAllowHTTP:    l.getEnvBool("EGRESS_ALLOW_HTTP", false),
+		EgressAllowlist:    l.getEnvList("EGRESS_ALLOWLIST"),
+		EgressMaxRedirects: l.getEnvInt("EGRESS_MAX_REDIRECTS", 0),
+
+		WebhooksEnabled:    l.getEnvBool("WEBHOOKS_ENABLED", false),
+		WebhookWorkers:     l.getEnvInt("WEBHOOK_WORKERS", 8),
+		WebhookMaxFailures: l.getEnvInt("WEBHOOK_MAX_FAILURES", 20),
+
+		PushFCMCredentials: l.getEnv("PUSH_FCM_CREDENTIALS", ""),
+		PushAPNsKeyFile:    l.getEnv("PUSH_APNS_KEY_FILE", ""),
+		PushAPNsKeyID:      l.getEnv("PUSH_APNS_KEY_ID", ""),
+		PushAPNsTeamID:     l.getEnv("PUSH_APNS_TEAM_ID", ""),
+		PushAPNsTopic:      l.getEnv("PUSH_APNS_TOPIC", ""),
+		PushAPNsSandbox:    l.getEnvBool("PUSH_APNS_SANDBOX", false),
+		PushUnifiedPush:    l.getEnvBool("PUSH_UNIFIEDPUSH", false),
+		PushNtfyServer:     l.getEnv("PUSH_NTFY_SERVER", ""),
+		PushVAPIDKeyFile:   l.getEnv("PUSH_VAPID_KEY_FILE", ""),
+		PushVAPIDSubject:   l.getEnv("PUSH_VAPID_SUBJECT", ""),
+		PushMinInterval:    l.getEnvDuration("PUSH_MIN_INTERVAL", 10*time.Second),
+
+		AnonTokensEnabled:     l.getEnvBool("ANON_TOKENS_ENABLED", false),
+		AnonTokenKeyFile:      l.getEnv("ANON_TOKEN_KEY_FILE", ""),
+		AnonTokenIssuerSecret: l.getEnv("ANON_TOKEN_ISSUER_SECRET", ""),
+
+		VoucherKeyFile:        l.getEnv("VOUCHER_KEY_FILE", ""),
+		VoucherIssuerSecret:   l.getEnv("VOUCHER_ISSUER_SECRET", ""),
+		VoucherValidity:       l.getEnvDuration("VOUCHER_VALIDITY", 365*24*time.Hour),
+		VoucherMaxMessages:    l.getEnvInt("VOUCHER_MAX_MESSAGES", 10000),
+		VoucherMaxMessageSize: l.getEnvInt("VOUCHER_MAX_MESSAGE_SIZE", 16*1024*1024),
+		VoucherTTL:            l.getEnvDuration("VOUCHER_TTL", 90*24*time.Hour),
+
+		AuthHookURL:     l.getEnv("AUTH_HOOK_URL", ""),
+		AuthHookPlugin:  l.getEnv("AUTH_HOOK_PLUGIN", ""),
+		AuthHookTimeout: l.getEnvDuration("AUTH_HOOK_TIMEOUT", 5*time.Second),
+
+		PolicyFile: l.getEnv("POLICY_FILE", ""),
+
+		Region:      l.getEnv("REGION", ""),
+		RegionPeers: l.getEnvList("REGION_PEERS"),
+		RegionProbe: l.getEnvDuration("REGION_PROBE_INTERVAL", 30*time.Second),
+
+		RegionTLSCertFile: l.getEnv("REGION_TLS_CERT_FILE", ""),
+		RegionTLSKeyFile:  l.getEnv("REGION_TLS_KEY_FILE", ""),
+		RegionPeerPins:    l.getEnvList("REGION_PEER_PINS"),
+
+		OnionRouting: l.getEnvBool("ONION_ROUTING", true),
+	}
+}
+
+func (l *loader) getEnv(key, defaultValue string) string {
+	if value := l.lookup(key); value != "" {
+		return value
+	}
 	return defaultValue
 }
 
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
+func (l *loader) getEnvInt(key string, defaultValue int) int {
+	if value := l.lookup(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
 			return intValue
 		}
 	}
 	return defaultValue
 }
+
+func (l *loader) getEnvFloat(key string, defaultValue float64) float64 {
+	if value := l.lookup(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+func (l *loader) getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := l.lookup(key); value != "" {
+		if durationValue, err := time.ParseDuration(value); err == nil {
+			return durationValue
+		}
+	}
+	return defaultValue
+}
+
+func (l *loader) getEnvBool(key string, defaultValue bool) bool {
+	if value := l.lookup(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func (l *loader) getEnvList(key string) []string {
+	value := l.lookup(key)
+	if value == "" {
+		return nil
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,92 @@
+package egress
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// NewClient creates an HTTP client for outbound requests (webhooks, federation)
+// Hostnames are resolved through resolver, every resolved address is checked
+// against policy, and the connection is pinned to the address that passed the
+// check so a DNS rebind between validation and dial can't redirect it
+func NewClient(resolver Resolver, policy *Policy) *http.Client {
+	if policy == nil {
+		policy = DefaultPolicy()
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil, // Never route outbound traffic through an env-configured proxy
+		DialContext:           NewDialer(resolver, policy),
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   30 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > policy.MaxRedirects {
+				return ErrTooManyRedirect
+			}
+			// Redirect targets get the same scrutiny as the original URL
+			_, err := policy.ValidateURL(req.URL.String())
+			return err
+		},
+	}
+}
+
+// DialFunc dials like net.Dialer.DialContext
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// NewDialer returns the dial function NewClient's transport uses, for
+// transports that need their own TLS or pooling settings
+func NewDialer(resolver Resolver, policy *Policy) DialFunc {
+	if policy == nil {
+		policy = DefaultPolicy()
+	}
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return guardedDialer(dialer, resolver, policy)
+}
+
+// guardedDialer returns a DialContext func that looks up the host with
+// resolver and dials only the addresses the policy allows
+func guardedDialer(dialer *net.Dialer, resolver Resolver, policy *Policy) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs, err := resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("%w for %s", ErrNoAddresses, host)
+		}
+
+		addrs = policy.filterAddrs(host, addrs)
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrDestinationDeny, host)
+		}
+
+		var lastErr error
+		for _, ip := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
@@ -0,0 +1,175 @@
+package egress
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrInvalidURL      = errors.New("invalid callback URL")
+	ErrDestinationDeny = errors.New("destination address not allowed")
+	ErrTooManyRedirect = errors.New("too many redirects")
+)
+
+// deniedPrefixes are ranges outbound requests may never reach unless allowlisted:
+// loopback, RFC1918, CGNAT, link-local (incl. cloud metadata 169.254.169.254),
+// unique-local, multicast and other special-purpose blocks, and the IPv6
+// transition ranges that embed an IPv4 address (NAT64, 6to4, Teredo), which
+// could otherwise carry a request to any internal IPv4 host
+var deniedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/32"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// Policy restricts where outbound requests may go
+type Policy struct {
+	AllowPrivate bool           // Skip the default deny list entirely (trusted deployments only)
+	AllowHTTP    bool           // Permit plain http:// callback URLs
+	Allowlist    []netip.Prefix // Ranges permitted even if they fall in a denied range
+	AllowHosts   []string       // Hostnames permitted regardless of what they resolve to
+	MaxRedirects int            // Redirects followed per request (0 = none)
+}
+
+// DefaultPolicy denies internal ranges, requires HTTPS and follows no redirects
+func DefaultPolicy() *Policy {
+	return &Policy{}
+}
+
+// ParseAllowlist splits a list of CIDRs, IPs and hostnames into a policy's allowlists
+func (p *Policy) ParseAllowlist(entries []string) error {
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			p.Allowlist = append(p.Allowlist, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			p.Allowlist = append(p.Allowlist, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		if strings.ContainsAny(entry, "/:") {
+			return fmt.Errorf("invalid allowlist entry %q", entry)
+		}
+		p.AllowHosts = append(p.AllowHosts, strings.ToLower(entry))
+	}
+	return nil
+}
+
+// ValidateURL checks a user-supplied callback URL before it's stored
+// Resolution is repeated (and pinned) at dial time, so this is only a first filter
+func (p *Policy) ValidateURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if !p.AllowHTTP {
+			return nil, fmt.Errorf("%w: https required", ErrInvalidURL)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported scheme %q", ErrInvalidURL, u.Scheme)
+	}
+
+	if u.User != nil {
+		return nil, fmt.Errorf("%w: credentials in URL not allowed", ErrInvalidURL)
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return nil, fmt.Errorf("%w: missing host", ErrInvalidURL)
+	}
+
+	// Literal IPs can be rejected immediately
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !p.AllowedAddr(addr) {
+			return nil, ErrDestinationDeny
+		}
+	} else if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		if !p.allowedHost(host) {
+			return nil, ErrDestinationDeny
+		}
+	}
+
+	return u, nil
+}
+
+// AllowedAddr reports whether a resolved address may be dialed
+func (p *Policy) AllowedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	for _, prefix := range p.Allowlist {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	if p.AllowPrivate {
+		return true
+	}
+
+	for _, prefix := range deniedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Policy) allowedHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range p.AllowHosts {
+		if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// filterAddrs drops resolved addresses the policy doesn't allow
+func (p *Policy) filterAddrs(host string, addrs []net.IPAddr) []net.IPAddr {
+	if p.allowedHost(host) {
+		return addrs
+	}
+
+	allowed := addrs[:0:0]
+	for _, ipAddr := range addrs {
+		addr, ok := netip.AddrFromSlice(ipAddr.IP)
+		if ok && p.AllowedAddr(addr) {
+			allowed = append(allowed, ipAddr)
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,220 @@
+package egress
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var (
+	ErrNoAddresses = errors.New("no addresses found")
+)
+
+// Resolver resolves hostnames for outbound connections
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// SystemResolver returns the resolver configured on the host
+func SystemResolver() Resolver {
+	return net.DefaultResolver
+}
+
+// DoHResolver resolves hostnames over DNS-over-HTTPS (RFC 8484)
+// Lookups never touch the local network resolver, so the operator's network
+// cannot observe which hosts the relay talks to
+type DoHResolver struct {
+	endpoint string
+	client   *http.Client
+
+	cache      map[string]cachedAnswer
+	cacheMutex sync.Mutex
+}
+
+type cachedAnswer struct {
+	addrs     []net.IPAddr
+	expiresAt time.Time
+}
+
+// Answer cache limits
+// The TTL caps how long an answer is trusted regardless of record TTL; the
+// entry cap bounds memory when callers look up many distinct hosts
+const (
+	maxCacheTTL     = 5 * time.Minute
+	maxCacheEntries = 1024
+)
+
+// NewDoHResolver creates a resolver that sends queries to the given DoH endpoint
+// (e.g. https://cloudflare-dns.com/dns-query). The endpoint host itself is
+// resolved with the system resolver, so prefer an IP literal if that matters.
+func NewDoHResolver(endpoint string) *DoHResolver {
+	return &DoHResolver{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		cache:    make(map[string]cachedAnswer),
+	}
+}
+
+// LookupIPAddr resolves host to its A and AAAA records
+func (r *DoHResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	// IP literals don't need resolving
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IPAddr{{IP: ip}}, nil
+	}
+
+	// Serve from cache if fresh, dropping the entry if not
+	r.cacheMutex.Lock()
+	cached, ok := r.cache[host]
+	if ok && !time.Now().Before(cached.expiresAt) {
+		delete(r.cache, host)
+		ok = false
+	}
+	r.cacheMutex.Unlock()
+	if ok {
+		return cached.addrs, nil
+	}
+
+	var addrs []net.IPAddr
+	ttl := maxCacheTTL
+	var lastErr error
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		found, recordTTL, err := r.query(ctx, host, qtype)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		addrs = append(addrs, found...)
+		if len(found) > 0 && recordTTL < ttl {
+			ttl = recordTTL
+		}
+	}
+
+	if len(addrs) == 0 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, fmt.Errorf("%w for %s", ErrNoAddresses, host)
+	}
+
+	r.store(host, cachedAnswer{addrs: addrs, expiresAt: time.Now().Add(ttl)})
+	return addrs, nil
+}
+
+// store caches an answer, making room first when the cache is full: expired
+// entries go, then the one closest to expiring
+func (r *DoHResolver) store(host string, answer cachedAnswer) {
+	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+
+	if _, ok := r.cache[host]; !ok && len(r.cache) >= maxCacheEntries {
+		now := time.Now()
+		for name, cached := range r.cache {
+			if !now.Before(cached.expiresAt) {
+				delete(r.cache, name)
+			}
+		}
+		if len(r.cache) >= maxCacheEntries {
+			var soonest string
+			for name, cached := range r.cache {
+				if soonest == "" || cached.expiresAt.Before(r.cache[soonest].expiresAt) {
+					soonest = name
+				}
+			}
+			delete(r.cache, soonest)
+		}
+	}
+	r.cache[host] = answer
+}
+
+// query performs a single DoH query for one record type
+func (r *DoHResolver) query(ctx context.Context, host string, qtype dnsmessage.Type) ([]net.IPAddr, time.Duration, error) {
+	name, err := dnsmessage.NewName(dnsFQDN(host))
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid hostname: %w", err)
+	}
+
+	// RFC 8484 recommends ID 0 to maximize HTTP cache friendliness
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  name,
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to pack DNS query: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(packed))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("DoH request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DoH server returned %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read DoH response: %w", err)
+	}
+
+	var answer dnsmessage.Message
+	if err := answer.Unpack(body); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse DoH response: %w", err)
+	}
+	if answer.RCode != dnsmessage.RCodeSuccess {
+		return nil, 0, fmt.Errorf("DNS lookup for %s failed: %s", host, answer.RCode)
+	}
+
+	var addrs []net.IPAddr
+	ttl := maxCacheTTL
+	for _, rr := range answer.Answers {
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			addrs = append(addrs, net.IPAddr{IP: net.IP(body.A[:])})
+		case *dnsmessage.AAAAResource:
+			addrs = append(addrs, net.IPAddr{IP: net.IP(body.AAAA[:])})
+		default:
+			continue
+		}
+		if recordTTL := time.Duration(rr.Header.TTL) * time.Second; recordTTL < ttl {
+			ttl = recordTTL
+		}
+	}
+
+	return addrs, ttl, nil
+}
+
+func dnsFQDN(host string) string {
+	if len(host) > 0 && host[len(host)-1] == '.' {
+		return host
+	}
+	return host + "."
+}
+
+// NewResolver returns a DoH resolver when dohURL is set, otherwise the system resolver
+func NewResolver(dohURL string) Resolver {
+	if dohURL == "" {
+		return SystemResolver()
+	}
+	return NewDoHResolver(dohURL)
+}
@@ -0,0 +1,113 @@
+package egress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dohServer answers every A query with 192.0.2.1 and every AAAA query with
+// nothing, counting the queries it sees
+func dohServer(t *testing.T, queries *atomic.Int64) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var query dnsmessage.Message
+		if err := query.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		queries.Add(1)
+		answer := dnsmessage.Message{
+			Header:    dnsmessage.Header{Response: true, RecursionAvailable: true},
+			Questions: query.Questions,
+		}
+		if q := query.Questions[0]; q.Type == dnsmessage.TypeA {
+			answer.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 60},
+				Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+			}}
+		}
+		packed, err := answer.Pack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(packed)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDoHResolverCache(t *testing.T) {
+	var queries atomic.Int64
+	r := NewDoHResolver(dohServer(t, &queries).URL)
+	ctx := context.Background()
+
+	addrs, err := r.LookupIPAddr(ctx, "hooks.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0].IP.String() != "192.0.2.1" {
+		t.Fatalf("addrs = %v, want [192.0.2.1]", addrs)
+	}
+	if _, err := r.LookupIPAddr(ctx, "hooks.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if got := queries.Load(); got != 2 {
+		t.Errorf("queries = %d, want 2 (A and AAAA, then served from cache)", got)
+	}
+
+	// An expired answer is dropped and looked up again
+	r.cache["hooks.example.com"] = cachedAnswer{addrs: addrs, expiresAt: time.Now().Add(-time.Second)}
+	r.cache["stale.example.com"] = cachedAnswer{addrs: addrs, expiresAt: time.Now().Add(-time.Second)}
+	if _, err := r.LookupIPAddr(ctx, "stale.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if got := queries.Load(); got != 4 {
+		t.Errorf("queries = %d, want 4 after an expired entry", got)
+	}
+	if cached := r.cache["stale.example.com"]; !time.Now().Before(cached.expiresAt) {
+		t.Error("expired entry was not replaced")
+	}
+}
+
+func TestDoHResolverCacheIsBounded(t *testing.T) {
+	var queries atomic.Int64
+	r := NewDoHResolver(dohServer(t, &queries).URL)
+	ctx := context.Background()
+
+	// Fill the cache, leaving one entry expired and one about to expire
+	for i := range maxCacheEntries {
+		r.cache[fmt.Sprintf("host%d.example.com", i)] = cachedAnswer{expiresAt: time.Now().Add(time.Hour)}
+	}
+	r.cache["host0.example.com"] = cachedAnswer{expiresAt: time.Now().Add(-time.Second)}
+	r.cache["host1.example.com"] = cachedAnswer{expiresAt: time.Now().Add(time.Minute)}
+
+	for _, host := range []string{"new1.example.com", "new2.example.com"} {
+		if _, err := r.LookupIPAddr(ctx, host); err != nil {
+			t.Fatal(err)
+		}
+		if len(r.cache) > maxCacheEntries {
+			t.Fatalf("cache holds %d entries, cap is %d", len(r.cache), maxCacheEntries)
+		}
+	}
+	for _, host := range []string{"host0.example.com", "host1.example.com"} {
+		if _, ok := r.cache[host]; ok {
+			t.Errorf("%s should have been evicted", host)
+		}
+	}
+	for _, host := range []string{"host2.example.com", "new1.example.com", "new2.example.com"} {
+		if _, ok := r.cache[host]; !ok {
+			t.Errorf("%s should still be cached", host)
+		}
+	}
+}
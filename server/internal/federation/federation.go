@@ -0,0 +1,132 @@
+//go:build !minimal
+
+package federation
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"privmsg-relay/internal/queue"
+)
+
+// Forwarder relays requests for queues homed in other regions
+// Storage stays single-homed: the receiving region never persists foreign queues
+type Forwarder struct {
+	region    string
+	peers     map[string]*Peer
+	transport *http.Transport
+	probes    probeState
+	peerTLS   *PeerTLS // Mutual TLS with pinned peers (nil = peers are not authenticated)
+}
+
+// ParsePeers parses "region=url" pairs (e.g. "us1=https://us1.example.com")
+func ParsePeers(entries []string) (map[string]*Peer, error) {
+	peers := make(map[string]*Peer)
+	for _, entry := range entries {
+		region, rawURL, ok := strings.Cut(entry, "=")
+		if !ok || region == "" || rawURL == "" {
+			return nil, fmt.Errorf("invalid region peer %q (want region=url)", entry)
+		}
+		if !queue.ValidRegion(region) {
+			return nil, fmt.Errorf("region peer %q: %w", entry, queue.ErrInvalidRegion)
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid URL for region %s: %q", region, rawURL)
+		}
+		peers[region] = &Peer{Region: region, URL: u}
+	}
+	return peers, nil
+}
+
+// NewForwarder creates a forwarder for the local region that connects to
+// peers with dial, normally the egress guard's dialer (nil = a plain one)
+func NewForwarder(region string, peers map[string]*Peer, dial func(ctx context.Context, network, addr string) (net.Conn, error)) *Forwarder {
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	return &Forwarder{
+		region: region,
+		peers:  peers,
+		probes: probeState{results: make(map[string]RegionStatus)},
+		transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dial,
+			MaxIdleConnsPerHost: 32,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// Region returns the local region tag
+func (f *Forwarder) Region() string {
+	return f.region
+}
+
+// Peers returns the configured sibling regions
+func (f *Forwarder) Peers() map[string]*Peer {
+	return f.peers
+}
+
+// IsLocal reports whether a queue's home region is this one
+// Queues without a region tag are always local
+func (f *Forwarder) IsLocal(homeRegion string) bool {
+	return homeRegion == "" || homeRegion == f.region
+}
+
+// Forward proxies the request unchanged to the queue's home region
+func (f *Forwarder) Forward(w http.ResponseWriter, r *http.Request, homeRegion string) error {
+	peer, ok := f.peers[homeRegion]
+	if !ok {
+		return ErrUnknownRegion
+	}
+
+	// A request that was already forwarded once must not bounce again
+	if r.Header.Get(ForwardedHeader) != "" {
+		return fmt.Errorf("%w: %s (loop detected)", ErrUnknownRegion, homeRegion)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(peer.URL)
+			pr.Out.Host = peer.URL.Host
+			pr.Out.Header.Set(ForwardedHeader, f.region)
+		},
+		Transport: f.transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.Warn("Federation forward failed", "region", homeRegion, "error", err)
+			http.Error(w, "home region unavailable", http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+	return nil
+}
+
+// Post sends body to path on a peer region, for requests this relay makes
+// itself rather than proxies (e.g. onion layers passed to the next hop)
+// The request names this region in ForwardedHeader, so the peer can check
+// the certificate against it
+func (f *Forwarder) Post(ctx context.Context, region, path string, header http.Header, body []byte) (*http.Response, error) {
+	peer, ok := f.peers[region]
+	if !ok {
+		return nil, ErrUnknownRegion
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer.URL.JoinPath(path).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set(ForwardedHeader, f.region)
+	return (&http.Client{Transport: f.transport}).Do(req)
+}
@@ -0,0 +1,48 @@
+//go:build minimal
+
+package federation
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Forwarder is a placeholder; forwarding is excluded from minimal builds
+type Forwarder struct{}
+
+// ParsePeers always fails in minimal builds, so multi-region mode can't be enabled
+func ParsePeers(entries []string) (map[string]*Peer, error) {
+	return nil, ErrNotIncluded
+}
+
+// PeerTLS is a placeholder; federation is excluded from minimal builds
+type PeerTLS struct{}
+
+// LoadPeerTLS always fails in minimal builds
+func LoadPeerTLS(certFile, keyFile string, pins []string) (*PeerTLS, error) {
+	return nil, ErrNotIncluded
+}
+
+// NewForwarder is never reached because ParsePeers fails
+func NewForwarder(region string, peers map[string]*Peer, dial func(ctx context.Context, network, addr string) (net.Conn, error)) *Forwarder {
+	return &Forwarder{}
+}
+
+func (f *Forwarder) Region() string                                    { return "" }
+func (f *Forwarder) Peers() map[string]*Peer                           { return nil }
+func (f *Forwarder) IsLocal(homeRegion string) bool                    { return true }
+func (f *Forwarder) StartProbing(ctx context.Context, _ time.Duration) {}
+func (f *Forwarder) Regions() []RegionStatus                           { return nil }
+func (f *Forwarder) EnableMTLS(peerTLS *PeerTLS) error                 { return ErrNotIncluded }
+func (f *Forwarder) VerifyPeer(*tls.ConnectionState, string) error     { return nil }
+
+func (f *Forwarder) Forward(w http.ResponseWriter, r *http.Request, homeRegion string) error {
+	return ErrNotIncluded
+}
+
+func (f *Forwarder) Post(ctx context.Context, region, path string, header http.Header, body []byte) (*http.Response, error) {
+	return nil, ErrNotIncluded
+}
@@ -0,0 +1,98 @@
+//go:build !minimal
+
+package federation
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// probeState holds the latest health probe results per region
+type probeState struct {
+	results map[string]RegionStatus
+	mutex   sync.RWMutex
+}
+
+// StartProbing periodically checks every peer's /readyz endpoint until ctx is done
+func (f *Forwarder) StartProbing(ctx context.Context, interval time.Duration) {
+	f.probeAll(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.probeAll(ctx)
+		}
+	}
+}
+
+func (f *Forwarder) probeAll(ctx context.Context) {
+	client := &http.Client{Transport: f.transport, Timeout: 5 * time.Second}
+
+	var wg sync.WaitGroup
+	for _, peer := range f.peers {
+		wg.Add(1)
+		go func(peer *Peer) {
+			defer wg.Done()
+
+			status := RegionStatus{
+				Region:    peer.Region,
+				URL:       peer.URL.String(),
+				CheckedAt: time.Now(),
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer.URL.JoinPath("/readyz").String(), nil)
+			if err == nil {
+				start := time.Now()
+				resp, err := client.Do(req)
+				if err == nil {
+					resp.Body.Close()
+					status.Healthy = resp.StatusCode == http.StatusOK
+					status.LatencyMS = time.Since(start).Milliseconds()
+				}
+			}
+
+			f.probes.mutex.Lock()
+			f.probes.results[peer.Region] = status
+			f.probes.mutex.Unlock()
+		}(peer)
+	}
+	wg.Wait()
+}
+
+// Regions returns the local region and the last known state of every peer,
+// healthy regions first, then by latency
+func (f *Forwarder) Regions() []RegionStatus {
+	regions := []RegionStatus{{
+		Region:  f.region,
+		Local:   true,
+		Healthy: true,
+	}}
+
+	f.probes.mutex.RLock()
+	for _, peer := range f.peers {
+		status, ok := f.probes.results[peer.Region]
+		if !ok {
+			// Not probed yet
+			status = RegionStatus{Region: peer.Region, URL: peer.URL.String()}
+		}
+		regions = append(regions, status)
+	}
+	f.probes.mutex.RUnlock()
+
+	sort.SliceStable(regions[1:], func(i, j int) bool {
+		a, b := regions[1+i], regions[1+j]
+		if a.Healthy != b.Healthy {
+			return a.Healthy
+		}
+		return a.LatencyMS < b.LatencyMS
+	})
+
+	return regions
+}
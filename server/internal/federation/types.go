@@ -0,0 +1,32 @@
+package federation
+
+import (
+	"errors"
+	"net/url"
+	"time"
+)
+
+var (
+	ErrUnknownRegion  = errors.New("unknown home region")
+	ErrNotIncluded    = errors.New("federation not included in this build (built with -tags minimal)")
+	ErrPeerNotAllowed = errors.New("peer certificate not allowed")
+)
+
+// ForwardedHeader marks requests relayed by a sibling region, preventing forwarding loops
+const ForwardedHeader = "X-Privmsg-Forwarded-By"
+
+// Peer is a sibling deployment in another region
+type Peer struct {
+	Region string
+	URL    *url.URL
+}
+
+// RegionStatus describes a deployment endpoint for client-side selection
+type RegionStatus struct {
+	Region    string    `json:"region"`
+	URL       string    `json:"url,omitempty"`
+	Local     bool      `json:"local"`
+	Healthy   bool      `json:"healthy"`
+	LatencyMS int64     `json:"latency_ms,omitempty"` // Round-trip from this region, a rough proximity hint
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+}
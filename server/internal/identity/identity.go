@@ -0,0 +1,71 @@
+// Package identity holds the relay's long-term Ed25519 signing key
+//
+// Clients pin the public key to verify server-originated statements such
+// as operator notices, independent of the TLS certificate.
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// LoadKey reads a PEM-encoded PKCS#8 Ed25519 key, or generates an ephemeral one if path is empty
+// Ephemeral keys change on every restart, so clients cannot pin them
+func LoadKey(path string) (ed25519.PrivateKey, error) {
+	if path == "" {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing key is not PEM encoded")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not an Ed25519 key")
+	}
+	return key, nil
+}
+
+// KeyID derives a short identifier for a public key
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// X25519 converts the identity key into an X25519 key pair for key
+// agreement (onion layers, Noise handshakes), as libsodium's
+// crypto_sign_ed25519_sk_to_curve25519 does; the public half is the
+// Montgomery form of the Ed25519 public key, so a client that pins the
+// identity key can check it
+func X25519(key ed25519.PrivateKey) (public, private [32]byte) {
+	digest := sha512.Sum512(key.Seed())
+	copy(private[:], digest[:32])
+	private[0] &= 248
+	private[31] &= 127
+	private[31] |= 64
+	derived, _ := curve25519.X25519(private[:], curve25519.Basepoint) // Only fails for low-order points
+	copy(public[:], derived)
+	return public, private
+}
@@ -0,0 +1,55 @@
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+)
+
+// Signed responses
+// Critical responses carry an Ed25519 signature by the identity key over a
+// statement binding the request, the status and the body, so a proxy that
+// terminates TLS cannot alter them or answer one request with another's
+// response. A client that sends NonceHeader gets it bound in too, so an old
+// response cannot be replayed
+const (
+	SignatureHeader = "X-Privmsg-Signature" // Base64 Ed25519 over ResponseStatement
+	SignedAtHeader  = "X-Privmsg-Signed-At" // Unix seconds
+	KeyIDHeader     = "X-Privmsg-Key-ID"
+	NonceHeader     = "X-Privmsg-Nonce" // Set by the client, at most MaxNonceLength printable ASCII characters
+	MaxNonceLength  = 64
+)
+
+// ResponseStatement is what a response signature covers:
+//
+//	privmsg-response-v1 \n method \n path \n status \n signed-at \n nonce \n hex SHA-256 of body
+func ResponseStatement(method, path string, status int, signedAt int64, nonce string, body []byte) []byte {
+	digest := sha256.Sum256(body)
+	statement := "privmsg-response-v1\n" + method + "\n" + path + "\n" + strconv.Itoa(status) + "\n" +
+		strconv.FormatInt(signedAt, 10) + "\n" + nonce + "\n" + hex.EncodeToString(digest[:])
+	return []byte(statement)
+}
+
+// ValidNonce reports whether a client nonce may go into a statement
+func ValidNonce(nonce string) bool {
+	if len(nonce) > MaxNonceLength {
+		return false
+	}
+	for i := 0; i < len(nonce); i++ {
+		if nonce[i] < 0x21 || nonce[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyResponse checks a response signature header against the pinned key
+func VerifyResponse(pub ed25519.PublicKey, method, path string, status int, signedAt int64, nonce string, body []byte, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(pub, ResponseStatement(method, path, status, signedAt, nonce, body), sig)
+}
@@ -0,0 +1,108 @@
+// Package macaroon implements minimal HMAC-chained bearer tokens
+//
+// A macaroon is an identifier, a list of caveats and a signature. The
+// signature starts as HMAC(rootKey, id) and every caveat is chained in as
+// sig = HMAC(sig, caveat). Anyone holding a macaroon can append caveats to
+// narrow it without talking to the issuer, but nobody can remove one
+// without the root key.
+package macaroon
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Prefix marks a bearer token as a macaroon rather than an opaque token
+const Prefix = "mac."
+
+var (
+	ErrMalformed    = errors.New("malformed macaroon")
+	ErrBadSignature = errors.New("macaroon signature mismatch")
+)
+
+// Macaroon is an attenuable bearer credential
+type Macaroon struct {
+	ID      string   `json:"id"`
+	Caveats []string `json:"c,omitempty"`
+	Sig     []byte   `json:"s"`
+}
+
+// New mints a macaroon with no caveats
+func New(rootKey []byte, id string) *Macaroon {
+	return &Macaroon{ID: id, Sig: mac(rootKey, id)}
+}
+
+// AddCaveat narrows the macaroon; it does not need the root key
+func (m *Macaroon) AddCaveat(caveat string) {
+	m.Caveats = append(m.Caveats, caveat)
+	m.Sig = mac(m.Sig, caveat)
+}
+
+// Verify recomputes the signature chain and runs check on every caveat
+// All caveats must pass; unknown caveats must be rejected by check
+func (m *Macaroon) Verify(rootKey []byte, check func(caveat string) error) error {
+	sig := mac(rootKey, m.ID)
+	for _, caveat := range m.Caveats {
+		sig = mac(sig, caveat)
+	}
+	if !hmac.Equal(sig, m.Sig) {
+		return ErrBadSignature
+	}
+
+	for _, caveat := range m.Caveats {
+		if err := check(caveat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encode serializes the macaroon as a header-safe bearer token
+func (m *Macaroon) Encode() string {
+	data, _ := json.Marshal(m)
+	return Prefix + base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Is reports whether a bearer token looks like a macaroon
+func Is(token string) bool {
+	return strings.HasPrefix(token, Prefix)
+}
+
+// Decode parses a token produced by Encode
+func Decode(token string) (*Macaroon, error) {
+	if !Is(token) {
+		return nil, ErrMalformed
+	}
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, Prefix))
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	var m Macaroon
+	if err := json.Unmarshal(data, &m); err != nil || m.ID == "" || len(m.Sig) != sha256.Size {
+		return nil, ErrMalformed
+	}
+	return &m, nil
+}
+
+// Attenuate decodes token, appends caveats and re-encodes it
+func Attenuate(token string, caveats ...string) (string, error) {
+	m, err := Decode(token)
+	if err != nil {
+		return "", err
+	}
+	for _, caveat := range caveats {
+		m.AddCaveat(caveat)
+	}
+	return m.Encode(), nil
+}
+
+func mac(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
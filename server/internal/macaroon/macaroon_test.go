@@ -0,0 +1,95 @@
+package macaroon
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var rootKey = []byte("0123456789abcdef0123456789abcdef")
+
+// acceptAll passes every caveat and records what it saw
+func acceptAll(seen *[]string) func(string) error {
+	return func(caveat string) error {
+		*seen = append(*seen, caveat)
+		return nil
+	}
+}
+
+func TestVerify(t *testing.T) {
+	errDenied := errors.New("denied")
+	attenuated := New(rootKey, "queue")
+	attenuated.AddCaveat("op = receive")
+	attenuated.AddCaveat("time < 2030-01-01T00:00:00Z")
+
+	stripped := *attenuated
+	stripped.Caveats = stripped.Caveats[:1] // Drops the time caveat but keeps its signature
+
+	tests := []struct {
+		name    string
+		mac     *Macaroon
+		key     []byte
+		check   func(string) error
+		want    error
+		caveats []string
+	}{
+		{"root", New(rootKey, "queue"), rootKey, nil, nil, nil},
+		{"attenuated", attenuated, rootKey, nil, nil, []string{"op = receive", "time < 2030-01-01T00:00:00Z"}},
+		{"wrong root key", attenuated, []byte("another root key entirely......."), nil, ErrBadSignature, nil},
+		{"caveat removed", &stripped, rootKey, nil, ErrBadSignature, nil},
+		{"caveat rejected", attenuated, rootKey, func(string) error { return errDenied }, errDenied, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen []string
+			check := tt.check
+			if check == nil {
+				check = acceptAll(&seen)
+			}
+			if err := tt.mac.Verify(tt.key, check); err != tt.want {
+				t.Fatalf("Verify() = %v, want %v", err, tt.want)
+			}
+			if strings.Join(seen, "|") != strings.Join(tt.caveats, "|") {
+				t.Errorf("checked caveats %q, want %q", seen, tt.caveats)
+			}
+		})
+	}
+}
+
+func TestAttenuateRoundTrip(t *testing.T) {
+	token, err := Attenuate(New(rootKey, "queue").Encode(), "op = send")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Is(token) {
+		t.Fatalf("Is(%q) = false", token)
+	}
+	decoded, err := Decode(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen []string
+	if err := decoded.Verify(rootKey, acceptAll(&seen)); err != nil || len(seen) != 1 || seen[0] != "op = send" {
+		t.Errorf("Verify() = %v with caveats %q, want nil with [op = send]", err, seen)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"no prefix", "opaque-access-token"},
+		{"bad base64", Prefix + "!!!"},
+		{"not json", Prefix + "bm90IGpzb24"},
+		{"no id", Prefix + "eyJzIjoiIn0"},
+		{"short signature", Prefix + "eyJpZCI6InF1ZXVlIiwicyI6IkFBQUEifQ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.token); err != ErrMalformed {
+				t.Errorf("Decode() error = %v, want %v", err, ErrMalformed)
+			}
+		})
+	}
+}
@@ -0,0 +1,402 @@
+// Package noise implements the Noise XX and IK handshakes with 25519,
+// ChaChaPoly and SHA256, and the transport ciphers they produce
+//
+// It follows revision 34 of the Noise Protocol Framework
+// (https://noiseprotocol.org/noise.html) and covers only what the relay's
+// WebSocket transport needs: no pre-shared keys and no fallback patterns.
+package noise
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+var (
+	ErrHandshake = errors.New("noise handshake failed")
+	ErrDecrypt   = errors.New("noise message failed authentication")
+)
+
+// Message limits
+const (
+	MaxMessageSize = 65535                      // Largest handshake or transport message
+	TagSize        = chacha20poly1305.Overhead  // Added to every encrypted message
+	MaxPlaintext   = MaxMessageSize - TagSize   // Largest transport plaintext
+	keySize        = chacha20poly1305.KeySize   // Also DHLEN and HASHLEN
+	maxNonce       = ^uint64(0)                 // Reserved; a cipher that reaches it is spent
+	suffix         = "_25519_ChaChaPoly_SHA256" // Every protocol name ends with this
+)
+
+// Pattern is a handshake pattern: who sends which tokens in which message
+type Pattern struct {
+	Name         string
+	preResponder bool // The initiator knows the responder's static key in advance
+	messages     [][]string
+}
+
+var (
+	// XX: neither side knows the other's static key beforehand
+	XX = &Pattern{Name: "XX", messages: [][]string{
+		{"e"},
+		{"e", "ee", "s", "es"},
+		{"s", "se"},
+	}}
+
+	// IK: the initiator already knows the responder's static key, so the
+	// handshake takes one round trip
+	IK = &Pattern{Name: "IK", preResponder: true, messages: [][]string{
+		{"e", "es", "s", "ss"},
+		{"e", "ee", "se"},
+	}}
+)
+
+// Keypair is an X25519 key pair
+type Keypair struct {
+	Public  [32]byte
+	Private [32]byte
+}
+
+// GenerateKeypair returns a fresh random key pair
+func GenerateKeypair() (*Keypair, error) {
+	key := &Keypair{}
+	if _, err := rand.Read(key.Private[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	public, err := curve25519.X25519(key.Private[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	copy(key.Public[:], public)
+	return key, nil
+}
+
+func dh(key *Keypair, public []byte) ([]byte, error) {
+	shared, err := curve25519.X25519(key.Private[:], public)
+	if err != nil {
+		return nil, ErrHandshake // Low-order point
+	}
+	return shared, nil
+}
+
+// CipherState encrypts one direction of a session
+// It is not safe for concurrent use
+type CipherState struct {
+	aead cipher.AEAD
+	n    uint64
+}
+
+func newCipherState(key []byte) *CipherState {
+	aead, _ := chacha20poly1305.New(key) // Only fails for a wrong key size
+	return &CipherState{aead: aead}
+}
+
+func (c *CipherState) nonce() []byte {
+	var nonce [chacha20poly1305.NonceSize]byte
+	binary.LittleEndian.PutUint64(nonce[4:], c.n)
+	return nonce[:]
+}
+
+// Encrypt appends the encryption of plaintext to out
+func (c *CipherState) Encrypt(out, ad, plaintext []byte) ([]byte, error) {
+	if c.n == maxNonce {
+		return nil, errors.New("noise cipher exhausted")
+	}
+	out = c.aead.Seal(out, c.nonce(), plaintext, ad)
+	c.n++
+	return out, nil
+}
+
+// Decrypt appends the decryption of ciphertext to out
+func (c *CipherState) Decrypt(out, ad, ciphertext []byte) ([]byte, error) {
+	if c.n == maxNonce {
+		return nil, errors.New("noise cipher exhausted")
+	}
+	out, err := c.aead.Open(out, c.nonce(), ciphertext, ad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	c.n++
+	return out, nil
+}
+
+// symmetricState is the chaining key, handshake hash and current cipher
+type symmetricState struct {
+	cipher *CipherState // nil until the first MixKey
+	ck     [keySize]byte
+	h      [keySize]byte
+}
+
+func (s *symmetricState) initialize(protocolName string) {
+	if len(protocolName) <= keySize {
+		copy(s.h[:], protocolName)
+	} else {
+		s.h = sha256.Sum256([]byte(protocolName))
+	}
+	s.ck = s.h
+}
+
+func (s *symmetricState) mixHash(data []byte) {
+	hash := sha256.New()
+	hash.Write(s.h[:])
+	hash.Write(data)
+	hash.Sum(s.h[:0])
+}
+
+func (s *symmetricState) mixKey(ikm []byte) {
+	ck, key := hkdf(s.ck[:], ikm)
+	s.ck = ck
+	s.cipher = newCipherState(key[:])
+}
+
+func (s *symmetricState) encryptAndHash(out, plaintext []byte) ([]byte, error) {
+	if s.cipher == nil {
+		out = append(out, plaintext...)
+		s.mixHash(plaintext)
+		return out, nil
+	}
+	start := len(out)
+	out, err := s.cipher.Encrypt(out, s.h[:], plaintext)
+	if err != nil {
+		return nil, err
+	}
+	s.mixHash(out[start:])
+	return out, nil
+}
+
+func (s *symmetricState) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	if s.cipher == nil {
+		s.mixHash(ciphertext)
+		return append([]byte(nil), ciphertext...), nil
+	}
+	plaintext, err := s.cipher.Decrypt(nil, s.h[:], ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	s.mixHash(ciphertext)
+	return plaintext, nil
+}
+
+// split derives the two transport ciphers, initiator-to-responder first
+func (s *symmetricState) split() (*CipherState, *CipherState) {
+	first, second := hkdf(s.ck[:], nil)
+	return newCipherState(first[:]), newCipherState(second[:])
+}
+
+// hkdf is Noise's HKDF with two outputs
+func hkdf(chainingKey, ikm []byte) (out1, out2 [keySize]byte) {
+	extract := hmac.New(sha256.New, chainingKey)
+	extract.Write(ikm)
+	tempKey := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, tempKey)
+	expand.Write([]byte{0x01})
+	expand.Sum(out1[:0])
+
+	expand.Reset()
+	expand.Write(out1[:])
+	expand.Write([]byte{0x02})
+	expand.Sum(out2[:0])
+	return out1, out2
+}
+
+// Config sets up one side of a handshake
+type Config struct {
+	Pattern      *Pattern
+	Initiator    bool
+	Prologue     []byte   // Data both sides must agree on, e.g. the negotiated protocol
+	Static       *Keypair // This side's long-term key
+	RemoteStatic []byte   // The responder's static key, for an IK initiator
+}
+
+// HandshakeState runs one handshake
+type HandshakeState struct {
+	symmetric symmetricState
+	pattern   *Pattern
+	initiator bool
+	s, e      *Keypair
+	rs, re    []byte
+	step      int
+}
+
+// NewHandshake starts a handshake
+func NewHandshake(config Config) (*HandshakeState, error) {
+	if config.Static == nil {
+		return nil, errors.New("noise: a static key is required")
+	}
+	hs := &HandshakeState{
+		pattern:   config.Pattern,
+		initiator: config.Initiator,
+		s:         config.Static,
+	}
+	if config.Pattern.preResponder && config.Initiator {
+		if len(config.RemoteStatic) != keySize {
+			return nil, errors.New("noise: IK needs the responder's static key")
+		}
+		hs.rs = config.RemoteStatic
+	}
+
+	hs.symmetric.initialize("Noise_" + config.Pattern.Name + suffix)
+	hs.symmetric.mixHash(config.Prologue)
+	if config.Pattern.preResponder {
+		if config.Initiator {
+			hs.symmetric.mixHash(hs.rs)
+		} else {
+			hs.symmetric.mixHash(hs.s.Public[:])
+		}
+	}
+	return hs, nil
+}
+
+// myTurn reports whether this side writes the next message
+func (hs *HandshakeState) myTurn() bool {
+	return (hs.step%2 == 0) == hs.initiator
+}
+
+// Finished reports whether every handshake message has been exchanged
+func (hs *HandshakeState) Finished() bool {
+	return hs.step == len(hs.pattern.messages)
+}
+
+// WriteMessage produces this side's next handshake message
+func (hs *HandshakeState) WriteMessage(payload []byte) ([]byte, error) {
+	if hs.Finished() || !hs.myTurn() {
+		return nil, errors.New("noise: not this side's turn to write")
+	}
+
+	var message []byte
+	for _, token := range hs.pattern.messages[hs.step] {
+		switch token {
+		case "e":
+			e, err := GenerateKeypair()
+			if err != nil {
+				return nil, err
+			}
+			hs.e = e
+			message = append(message, e.Public[:]...)
+			hs.symmetric.mixHash(e.Public[:])
+		case "s":
+			var err error
+			if message, err = hs.symmetric.encryptAndHash(message, hs.s.Public[:]); err != nil {
+				return nil, err
+			}
+		default:
+			if err := hs.mixDH(token); err != nil {
+				return nil, err
+			}
+		}
+	}
+	message, err := hs.symmetric.encryptAndHash(message, payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(message) > MaxMessageSize {
+		return nil, errors.New("noise: handshake message too large")
+	}
+	hs.step++
+	return message, nil
+}
+
+// ReadMessage consumes the other side's next handshake message and
+// returns its payload
+func (hs *HandshakeState) ReadMessage(message []byte) ([]byte, error) {
+	if hs.Finished() || hs.myTurn() {
+		return nil, ErrHandshake
+	}
+	if len(message) > MaxMessageSize {
+		return nil, ErrHandshake
+	}
+
+	for _, token := range hs.pattern.messages[hs.step] {
+		switch token {
+		case "e":
+			if len(message) < keySize {
+				return nil, ErrHandshake
+			}
+			hs.re = append([]byte(nil), message[:keySize]...)
+			message = message[keySize:]
+			hs.symmetric.mixHash(hs.re)
+		case "s":
+			size := keySize
+			if hs.symmetric.cipher != nil {
+				size += TagSize
+			}
+			if len(message) < size {
+				return nil, ErrHandshake
+			}
+			rs, err := hs.symmetric.decryptAndHash(message[:size])
+			if err != nil {
+				return nil, ErrHandshake
+			}
+			hs.rs = rs
+			message = message[size:]
+		default:
+			if err := hs.mixDH(token); err != nil {
+				return nil, err
+			}
+		}
+	}
+	payload, err := hs.symmetric.decryptAndHash(message)
+	if err != nil {
+		return nil, ErrHandshake
+	}
+	hs.step++
+	return payload, nil
+}
+
+// mixDH performs a DH token from this side's point of view
+func (hs *HandshakeState) mixDH(token string) error {
+	var local *Keypair
+	var remote []byte
+	switch token {
+	case "ee":
+		local, remote = hs.e, hs.re
+	case "ss":
+		local, remote = hs.s, hs.rs
+	case "es": // Initiator's ephemeral with responder's static
+		if hs.initiator {
+			local, remote = hs.e, hs.rs
+		} else {
+			local, remote = hs.s, hs.re
+		}
+	case "se": // Initiator's static with responder's ephemeral
+		if hs.initiator {
+			local, remote = hs.s, hs.re
+		} else {
+			local, remote = hs.e, hs.rs
+		}
+	}
+	if local == nil || len(remote) != keySize {
+		return ErrHandshake
+	}
+	shared, err := dh(local, remote)
+	if err != nil {
+		return err
+	}
+	hs.symmetric.mixKey(shared)
+	return nil
+}
+
+// Split returns the transport ciphers once the handshake is finished,
+// already oriented for this side
+func (hs *HandshakeState) Split() (send, receive *CipherState, err error) {
+	if !hs.Finished() {
+		return nil, nil, errors.New("noise: handshake not finished")
+	}
+	toResponder, toInitiator := hs.symmetric.split()
+	if hs.initiator {
+		return toResponder, toInitiator, nil
+	}
+	return toInitiator, toResponder, nil
+}
+
+// RemoteStatic returns the other side's static key, once it is known
+func (hs *HandshakeState) RemoteStatic() []byte {
+	return hs.rs
+}
@@ -0,0 +1,148 @@
+// Package onion opens the layers of messages routed through several relays
+//
+// A sender picks a route of up to MaxHops relays and wraps its message once
+// per relay, innermost layer first. Each relay can open only its own layer,
+// which names either the next relay (a federation region) or, at the last
+// hop, the destination queue. The first relay sees the sender but not the
+// queue, the last sees the queue but not the sender, and none sees both.
+//
+// A layer is framed like a sealed-sender envelope:
+//
+//	version (1) | ephemeral X25519 public key (32) | nonce (24) | box (16+)
+//
+// The box is NaCl crypto_box from the ephemeral key to the relay's onion
+// key and holds one of
+//
+//	0x01 | region length (1) | region | next layer    forward
+//	0x02 | Delivery as JSON                          deliver
+package onion
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"privmsg-relay/internal/identity"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// ErrInvalidOnion is returned for a layer this relay cannot open
+var ErrInvalidOnion = errors.New("invalid onion layer")
+
+// Layer framing
+const (
+	Version     = 0x01
+	MaxHops     = 3 // Relays one message may pass through
+	MaxRegion   = 255
+	Overhead    = 1 + 32 + 24 + box.Overhead // Framing and box around each layer's content
+	MaxOverhead = Overhead + 2 + MaxRegion   // Most a forward layer adds to the layer inside it
+
+	kindForward = 0x01
+	kindDeliver = 0x02
+)
+
+// HopsHeader counts the relays a forwarded layer has already passed;
+// requests from clients carry none
+const HopsHeader = "X-Privmsg-Onion-Hops"
+
+// Delivery is the innermost layer: what the last relay sends, and where
+type Delivery struct {
+	QueueID    string `json:"queue_id"`
+	SendToken  string `json:"send_token,omitempty"`
+	Payload    []byte `json:"payload"`
+	TTLSeconds int64  `json:"ttl_seconds,omitempty"`
+}
+
+// Layer is one opened layer: Next and Inner to forward, or Delivery
+type Layer struct {
+	Next     string
+	Inner    []byte
+	Delivery *Delivery
+}
+
+// Key is a relay's X25519 onion key
+type Key struct {
+	Public  [32]byte
+	Private [32]byte
+}
+
+// DeriveKey turns the relay's Ed25519 identity key into its onion key (see
+// identity.X25519)
+func DeriveKey(identityKey ed25519.PrivateKey) *Key {
+	public, private := identity.X25519(identityKey)
+	return &Key{Public: public, Private: private}
+}
+
+// Forward wraps inner, the next relay's layer, for the relay holding
+// relayKey, telling it to pass inner on to region next
+func Forward(relayKey *[32]byte, next string, inner []byte) ([]byte, error) {
+	if next == "" || len(next) > MaxRegion {
+		return nil, fmt.Errorf("region name must be 1 to %d bytes", MaxRegion)
+	}
+	content := make([]byte, 0, 2+len(next)+len(inner))
+	content = append(content, kindForward, byte(len(next)))
+	content = append(content, next...)
+	content = append(content, inner...)
+	return seal(relayKey, content)
+}
+
+// Deliver wraps the innermost layer for the last relay on the route
+func Deliver(relayKey *[32]byte, delivery Delivery) ([]byte, error) {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal delivery: %w", err)
+	}
+	return seal(relayKey, append([]byte{kindDeliver}, data...))
+}
+
+func seal(relayKey *[32]byte, content []byte) ([]byte, error) {
+	ephemeralPublic, ephemeralPrivate, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	layer := make([]byte, 0, Overhead+len(content))
+	layer = append(layer, Version)
+	layer = append(layer, ephemeralPublic[:]...)
+	layer = append(layer, nonce[:]...)
+	return box.Seal(layer, content, &nonce, relayKey, ephemeralPrivate), nil
+}
+
+// Open removes this relay's layer
+func (k *Key) Open(layer []byte) (*Layer, error) {
+	if len(layer) < Overhead || layer[0] != Version {
+		return nil, ErrInvalidOnion
+	}
+	var ephemeralPublic [32]byte
+	var nonce [24]byte
+	copy(ephemeralPublic[:], layer[1:33])
+	copy(nonce[:], layer[33:57])
+	content, ok := box.Open(nil, layer[57:], &nonce, &ephemeralPublic, &k.Private)
+	if !ok || len(content) == 0 {
+		return nil, ErrInvalidOnion
+	}
+
+	switch content[0] {
+	case kindForward:
+		if len(content) < 2 || content[1] == 0 || len(content) < 2+int(content[1]) {
+			return nil, ErrInvalidOnion
+		}
+		end := 2 + int(content[1])
+		return &Layer{Next: string(content[2:end]), Inner: content[end:]}, nil
+	case kindDeliver:
+		var delivery Delivery
+		if err := json.Unmarshal(content[1:], &delivery); err != nil || delivery.QueueID == "" {
+			return nil, ErrInvalidOnion
+		}
+		return &Layer{Delivery: &delivery}, nil
+	default:
+		return nil, ErrInvalidOnion
+	}
+}
@@ -0,0 +1,333 @@
+// Package pbwire encodes relay wire types as Protocol Buffers
+//
+// The schema is relay.proto in this directory. Encoding is hand-written
+// against the protobuf wire format so the relay needs no protobuf runtime;
+// timestamps use the google.protobuf.Timestamp layout, so generated code
+// in any language decodes these bodies directly.
+package pbwire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"privmsg-relay/internal/queue"
+)
+
+// ContentType is the media type for protobuf bodies
+const ContentType = "application/x-protobuf"
+
+var (
+	ErrUnsupported = errors.New("no protobuf encoding for this type")
+	ErrMalformed   = errors.New("malformed protobuf message")
+)
+
+// Wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Marshal encodes a pointer to a supported wire type
+func Marshal(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case *queue.SendMessageRequest:
+		var b []byte
+		b = appendBytes(b, 1, v.Payload)
+		b = appendInt64(b, 2, v.TTLSeconds)
+		b = appendString(b, 3, string(v.Priority))
+		return b, nil
+	case *queue.SendMessageResponse:
+		var b []byte
+		b = appendString(b, 1, v.MessageID)
+		b = appendInt64(b, 2, v.Seq)
+		b = appendTime(b, 3, v.SentAt)
+		b = appendTime(b, 4, v.ExpiresAt)
+		b = appendString(b, 5, v.PayloadHash)
+		b = appendString(b, 6, v.ReceiptToken)
+		return b, nil
+	case *queue.Message:
+		return appendMessage(nil, v), nil
+	case *queue.ReceiveMessagesResponse:
+		var b []byte
+		for i := range v.Messages {
+			b = appendEmbedded(b, 1, appendMessage(nil, &v.Messages[i]))
+		}
+		b = appendBool(b, 2, v.HasMore)
+		b = appendString(b, 3, v.NextCursor)
+		if v.InvisibleUntil != nil {
+			b = appendTime(b, 4, *v.InvisibleUntil)
+		}
+		return b, nil
+	case *queue.ReceiveCountResponse:
+		var b []byte
+		b = appendInt64(b, 1, int64(v.Count))
+		b = appendString(b, 2, v.NextCursor)
+		return b, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupported, v)
+	}
+}
+
+// Unmarshal decodes data into a pointer to a supported wire type
+// Unknown fields are skipped, as protobuf requires
+func Unmarshal(data []byte, v interface{}) error {
+	switch v := v.(type) {
+	case *queue.SendMessageRequest:
+		*v = queue.SendMessageRequest{}
+		return parse(data, func(field int, f value) error {
+			switch field {
+			case 1:
+				v.Payload = f.bytes()
+			case 2:
+				v.TTLSeconds = int64(f.varint)
+			case 3:
+				v.Priority = queue.Priority(f.raw)
+			}
+			return nil
+		})
+	case *queue.SendMessageResponse:
+		*v = queue.SendMessageResponse{}
+		return parse(data, func(field int, f value) (err error) {
+			switch field {
+			case 1:
+				v.MessageID = string(f.raw)
+			case 2:
+				v.Seq = int64(f.varint)
+			case 3:
+				v.SentAt, err = parseTime(f.raw)
+			case 4:
+				v.ExpiresAt, err = parseTime(f.raw)
+			case 5:
+				v.PayloadHash = string(f.raw)
+			case 6:
+				v.ReceiptToken = string(f.raw)
+			}
+			return err
+		})
+	case *queue.Message:
+		return parseMessage(data, v)
+	case *queue.ReceiveMessagesResponse:
+		*v = queue.ReceiveMessagesResponse{Messages: []queue.Message{}}
+		return parse(data, func(field int, f value) error {
+			switch field {
+			case 1:
+				var message queue.Message
+				if err := parseMessage(f.raw, &message); err != nil {
+					return err
+				}
+				v.Messages = append(v.Messages, message)
+			case 2:
+				v.HasMore = f.varint != 0
+			case 3:
+				v.NextCursor = string(f.raw)
+			case 4:
+				until, err := parseTime(f.raw)
+				if err != nil {
+					return err
+				}
+				v.InvisibleUntil = &until
+			}
+			return nil
+		})
+	case *queue.ReceiveCountResponse:
+		*v = queue.ReceiveCountResponse{}
+		return parse(data, func(field int, f value) error {
+			switch field {
+			case 1:
+				v.Count = int(f.varint)
+			case 2:
+				v.NextCursor = string(f.raw)
+			}
+			return nil
+		})
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupported, v)
+	}
+}
+
+func appendMessage(b []byte, m *queue.Message) []byte {
+	b = appendString(b, 1, m.ID)
+	b = appendString(b, 2, m.QueueID)
+	b = appendInt64(b, 3, m.Seq)
+	b = appendBytes(b, 4, m.Payload)
+	b = appendTime(b, 5, m.ReceivedAt)
+	b = appendTime(b, 6, m.ExpiresAt)
+	b = appendString(b, 7, m.PayloadHash)
+	b = appendBool(b, 8, m.System)
+	b = appendString(b, 9, m.SenderID)
+	b = appendString(b, 10, string(m.Priority))
+	return b
+}
+
+func parseMessage(data []byte, m *queue.Message) error {
+	*m = queue.Message{}
+	return parse(data, func(field int, f value) (err error) {
+		switch field {
+		case 1:
+			m.ID = string(f.raw)
+		case 2:
+			m.QueueID = string(f.raw)
+		case 3:
+			m.Seq = int64(f.varint)
+		case 4:
+			m.Payload = f.bytes()
+		case 5:
+			m.ReceivedAt, err = parseTime(f.raw)
+		case 6:
+			m.ExpiresAt, err = parseTime(f.raw)
+		case 7:
+			m.PayloadHash = string(f.raw)
+		case 8:
+			m.System = f.varint != 0
+		case 9:
+			m.SenderID = string(f.raw)
+		case 10:
+			m.Priority = queue.Priority(f.raw)
+		}
+		return err
+	})
+}
+
+// Encoding; proto3 omits fields holding their zero value
+
+func appendTag(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func appendInt64(b []byte, field int, n int64) []byte {
+	if n == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireVarint)
+	return binary.AppendUvarint(b, uint64(n))
+}
+
+func appendBool(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return append(appendTag(b, field, wireVarint), 1)
+}
+
+func appendBytes(b []byte, field int, data []byte) []byte {
+	if len(data) == 0 {
+		return b
+	}
+	return appendEmbedded(b, field, data)
+}
+
+func appendString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// appendEmbedded writes a length-delimited field even when empty, as
+// repeated and message fields must be present to be counted
+func appendEmbedded(b []byte, field int, data []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// appendTime writes a google.protobuf.Timestamp; the zero time is omitted
+func appendTime(b []byte, field int, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	var ts []byte
+	ts = appendInt64(ts, 1, t.Unix())
+	ts = appendInt64(ts, 2, int64(t.Nanosecond()))
+	return appendEmbedded(b, field, ts)
+}
+
+// Decoding
+
+// value is one decoded field; raw holds length-delimited contents and
+// aliases the input
+type value struct {
+	varint uint64
+	raw    []byte
+}
+
+// bytes copies a bytes field so it does not alias the request buffer
+func (f value) bytes() []byte {
+	if len(f.raw) == 0 {
+		return nil
+	}
+	return append([]byte(nil), f.raw...)
+}
+
+// parse walks the fields of one message
+func parse(data []byte, visit func(field int, f value) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 || tag>>3 == 0 || tag>>3 > math.MaxInt32 {
+			return ErrMalformed
+		}
+		data = data[n:]
+
+		var f value
+		switch tag & 7 {
+		case wireVarint:
+			f.varint, n = binary.Uvarint(data)
+			if n <= 0 {
+				return ErrMalformed
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return ErrMalformed
+			}
+			data = data[8:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return ErrMalformed
+			}
+			f.raw = data[n : n+int(length)]
+			data = data[n+int(length):]
+		case wireFixed32:
+			if len(data) < 4 {
+				return ErrMalformed
+			}
+			data = data[4:]
+		default:
+			return ErrMalformed
+		}
+
+		if err := visit(int(tag>>3), f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseTime decodes a google.protobuf.Timestamp
+func parseTime(data []byte) (time.Time, error) {
+	var seconds, nanos int64
+	err := parse(data, func(field int, f value) error {
+		switch field {
+		case 1:
+			seconds = int64(f.varint)
+		case 2:
+			nanos = int64(f.varint)
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if nanos < 0 || nanos >= int64(time.Second) {
+		return time.Time{}, ErrMalformed
+	}
+	return time.Unix(seconds, nanos).UTC(), nil
+}
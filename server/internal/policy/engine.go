@@ -0,0 +1,87 @@
+//go:build !minimal
+
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// maxSteps bounds the work a single policy evaluation may do
+const maxSteps = 100000
+
+// Engine evaluates an operator-supplied Starlark policy
+//
+// The script must define a function `allow(req)` where req has the fields
+// action, size, rate_class, namespace and channel. It returns True to accept,
+// False to reject, or a string to reject with that reason:
+//
+//	def allow(req):
+//	    if req.action == "send" and req.size > 1024 * 1024 and req.rate_class == "ip":
+//	        return "large messages require a token"
+//	    return True
+type Engine struct {
+	allowFn *starlark.Function
+	mutex   sync.Mutex // Starlark values from one module must not be used concurrently
+}
+
+// Load compiles the policy script at path
+func Load(path string) (*Engine, error) {
+	thread := &starlark.Thread{Name: "policy-load"}
+	thread.SetMaxExecutionSteps(maxSteps)
+
+	globals, err := starlark.ExecFile(thread, path, nil, starlark.StringDict{
+		"struct": starlark.NewBuiltin("struct", starlarkstruct.Make),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policy: %w", err)
+	}
+
+	fn, ok := globals["allow"].(*starlark.Function)
+	if !ok {
+		return nil, errors.New("policy must define allow(req)")
+	}
+	if fn.NumParams() != 1 {
+		return nil, errors.New("policy allow() must take exactly one argument")
+	}
+
+	// Freeze globals so evaluations can't mutate shared state
+	globals.Freeze()
+
+	return &Engine{allowFn: fn}, nil
+}
+
+// Evaluate runs the policy against one request
+// Script errors fail closed
+func (e *Engine) Evaluate(input Input) Decision {
+	req := starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"action":     starlark.String(input.Action),
+		"size":       starlark.MakeInt(input.Size),
+		"rate_class": starlark.String(input.RateClass),
+		"namespace":  starlark.String(input.Namespace),
+		"channel":    starlark.String(input.Channel),
+	})
+
+	thread := &starlark.Thread{Name: "policy"}
+	thread.SetMaxExecutionSteps(maxSteps)
+
+	e.mutex.Lock()
+	result, err := starlark.Call(thread, e.allowFn, starlark.Tuple{req}, nil)
+	e.mutex.Unlock()
+	if err != nil {
+		return Decision{Allow: false, Reason: "policy evaluation failed"}
+	}
+
+	switch v := result.(type) {
+	case starlark.Bool:
+		return Decision{Allow: bool(v)}
+	case starlark.String:
+		return Decision{Allow: false, Reason: string(v)}
+	default:
+		return Decision{Allow: false, Reason: "policy returned " + result.Type()}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build minimal
+
+package policy
+
+// Engine is a placeholder; the Starlark engine is excluded from minimal builds
+type Engine struct{}
+
+// Load always fails in minimal builds
+func Load(path string) (*Engine, error) {
+	return nil, ErrNotIncluded
+}
+
+// Evaluate is never reached because Load fails
+func (e *Engine) Evaluate(input Input) Decision {
+	return Decision{Allow: true}
+}
@@ -0,0 +1,39 @@
+package policy
+
+import (
+	"errors"
+)
+
+var (
+	ErrDenied      = errors.New("rejected by policy")
+	ErrNotIncluded = errors.New("policy engine not included in this build (built with -tags minimal)")
+)
+
+// Actions the policy is consulted on
+const (
+	ActionCreate = "create"
+	ActionSend   = "send"
+)
+
+// Channels a request can arrive on
+const (
+	ChannelHTTP       = "http"
+	ChannelWS         = "ws"
+	ChannelFederation = "federation" // Forwarded by a sibling region, including onion layers
+)
+
+// Input is the request metadata exposed to policy scripts
+// It deliberately carries no payload bytes, tokens or client addresses
+type Input struct {
+	Action    string // "create" or "send"
+	Size      int    // Payload size in bytes (0 for create)
+	RateClass string // "ip" for ordinary clients, "token" for anonymous-token holders
+	Namespace string // Tenant the request acts for: the creating tenant, or the one owning the queue (empty when none)
+	Channel   string // Transport the request arrived on ("http", "ws", "federation")
+}
+
+// Decision is the outcome of evaluating a policy
+type Decision struct {
+	Allow  bool
+	Reason string
+}
@@ -0,0 +1,143 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"privmsg-relay/internal/queue"
+)
+
+const (
+	apnsProduction = "https://api.push.apple.com"
+	apnsSandbox    = "https://api.sandbox.push.apple.com"
+
+	// Apple rejects provider tokens older than an hour and throttles ones
+	// refreshed more often than every 20 minutes
+	apnsTokenLifetime = 50 * time.Minute
+)
+
+// APNsOptions identifies the app and the token-based signing key
+type APNsOptions struct {
+	KeyFile string // .p8 key downloaded from the Apple developer portal
+	KeyID   string
+	TeamID  string
+	Topic   string // The app's bundle ID
+	Sandbox bool   // Use the development environment
+}
+
+// APNs sends background pushes through Apple's HTTP/2 provider API
+type APNs struct {
+	opts          APNsOptions
+	endpoint      string
+	key           *ecdsa.PrivateKey
+	client        *http.Client
+	providerToken cachedToken
+}
+
+// NewAPNs loads the signing key; the key is ES256 on P-256 as Apple issues it
+func NewAPNs(opts APNsOptions) (*APNs, error) {
+	if opts.KeyID == "" || opts.TeamID == "" || opts.Topic == "" {
+		return nil, errors.New("APNs needs a key ID, team ID and topic")
+	}
+	data, err := os.ReadFile(opts.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read APNs key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("APNs key file contains no PEM block")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APNs key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("APNs key is not an ECDSA key")
+	}
+
+	endpoint := apnsProduction
+	if opts.Sandbox {
+		endpoint = apnsSandbox
+	}
+	return &APNs{
+		opts:     opts,
+		endpoint: endpoint,
+		key:      key,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Send delivers a background push that wakes the app with only the tag
+func (a *APNs) Send(ctx context.Context, device queue.PushDevice) error {
+	providerToken, err := a.providerToken.get(a.signProviderToken)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"aps": map[string]int{"content-available": 1},
+		"tag": device.Tag,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint+"/3/device/"+device.Token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+providerToken)
+	req.Header.Set("apns-topic", a.opts.Topic)
+	req.Header.Set("apns-push-type", "background")
+	req.Header.Set("apns-priority", "5") // Background pushes must not use 10
+	req.Header.Set("apns-collapse-id", "privmsg-wake")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var reason struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&reason)
+	if resp.StatusCode == http.StatusGone || reason.Reason == "BadDeviceToken" || reason.Reason == "Unregistered" {
+		return ErrUnregistered
+	}
+	return fmt.Errorf("APNs returned %d %s", resp.StatusCode, reason.Reason)
+}
+
+// signProviderToken creates the ES256 JWT APNs authenticates the relay with
+func (a *APNs) signProviderToken() (string, time.Time, error) {
+	now := time.Now()
+	token, err := signJWT("ES256", a.opts.KeyID, map[string]any{
+		"iss": a.opts.TeamID,
+		"iat": now.Unix(),
+	}, func(digest []byte) ([]byte, error) {
+		r, s, err := ecdsa.Sign(rand.Reader, a.key, digest)
+		if err != nil {
+			return nil, err
+		}
+		// JWS wants the raw 64-byte r||s, not ASN.1
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+	})
+	return token, now.Add(apnsTokenLifetime), err
+}
@@ -0,0 +1,206 @@
+// Package push wakes apps through FCM, APNs, UnifiedPush, ntfy or Web Push
+// when one of their queues receives a message
+//
+// Pushes are content-free: they carry no payload, sender, message ID or
+// queue ID, only the opaque tag the app chose when it registered. The app
+// then fetches and decrypts its messages from the relay as usual.
+package push
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"privmsg-relay/internal/logging"
+	"privmsg-relay/internal/queue"
+)
+
+// ErrUnregistered means the push service no longer knows the device token,
+// so the registration should be dropped
+var ErrUnregistered = errors.New("device token no longer registered")
+
+const (
+	pollInterval = time.Second
+	sendTimeout  = 10 * time.Second
+)
+
+// Provider delivers a wake-up to one device
+type Provider interface {
+	Send(ctx context.Context, device queue.PushDevice) error
+}
+
+// Validator is implemented by providers whose device tokens must be
+// checked before they are stored
+type Validator interface {
+	ValidateToken(token string) error
+}
+
+// Options tunes the dispatcher
+type Options struct {
+	Workers     int           // Concurrent queues being woken per replica (default 8)
+	MinInterval time.Duration // Least time between wake-ups for one queue (0 = every message)
+}
+
+// Dispatcher sends the wake-ups queues have pending
+// Every replica may run one; pending wake-ups are claimed in Redis
+type Dispatcher struct {
+	manager     *queue.Manager
+	providers   map[queue.PushPlatform]Provider
+	workers     int
+	minInterval time.Duration
+}
+
+// NewDispatcher creates a dispatcher for the configured providers
+func NewDispatcher(manager *queue.Manager, providers map[queue.PushPlatform]Provider, opts Options) *Dispatcher {
+	if opts.Workers <= 0 {
+		opts.Workers = 8
+	}
+	return &Dispatcher{
+		manager:     manager,
+		providers:   providers,
+		workers:     opts.Workers,
+		minInterval: opts.MinInterval,
+	}
+}
+
+// Supports reports whether devices on platform can be woken
+func (d *Dispatcher) Supports(platform queue.PushPlatform) bool {
+	return d.providers[platform] != nil
+}
+
+// ValidateToken checks a device token with the platform's provider, if it
+// has rules beyond what the queue package enforces
+func (d *Dispatcher) ValidateToken(platform queue.PushPlatform, token string) error {
+	if v, ok := d.providers[platform].(Validator); ok {
+		return v.ValidateToken(token)
+	}
+	return nil
+}
+
+// VAPIDPublicKey returns the key browsers subscribe with, or "" if Web
+// Push is not enabled
+func (d *Dispatcher) VAPIDPublicKey() string {
+	if w, ok := d.providers[queue.PushWebPush].(*WebPush); ok {
+		return w.PublicKey()
+	}
+	return ""
+}
+
+// Run sends due wake-ups until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	slots := make(chan struct{}, d.workers)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		free := cap(slots) - len(slots)
+		if free == 0 {
+			continue
+		}
+		due, err := d.manager.DuePushes(ctx, free)
+		if err != nil {
+			slog.Error("Loading due pushes failed", "error", err)
+		}
+		for _, queueID := range due {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(queueID string) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				d.wake(ctx, queueID)
+			}(queueID)
+		}
+	}
+}
+
+// wake pushes to every device registered on the queue
+// A failed push is not retried: the next message brings another, and the
+// app still syncs whenever it is opened
+func (d *Dispatcher) wake(ctx context.Context, queueID string) {
+	devices, err := d.manager.PushTargets(ctx, queueID, d.minInterval)
+	if err != nil {
+		if !errors.Is(err, queue.ErrQueueNotFound) {
+			slog.Error("Loading push devices failed", "queue", logging.QueueRef(queueID), "error", err)
+		}
+		return
+	}
+
+	for _, device := range devices {
+		provider := d.providers[device.Platform]
+		if provider == nil {
+			continue // Registered before the operator removed the provider
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err := provider.Send(sendCtx, device)
+		cancel()
+
+		switch {
+		case errors.Is(err, ErrUnregistered):
+			d.manager.RemovePushDevice(ctx, queueID, device.ID)
+			slog.Debug("Removed unregistered push device", "queue", logging.QueueRef(queueID), "platform", device.Platform)
+		case err != nil:
+			slog.Warn("Push failed", "queue", logging.QueueRef(queueID), "platform", device.Platform, "error", err)
+		}
+	}
+}
+
+// signJWT builds a compact JWS over claims; APNs and Google OAuth both
+// authenticate servers with short-lived JWTs
+func signJWT(alg, keyID string, claims any, sign func(digest []byte) ([]byte, error)) (string, error) {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := sign(digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// cachedToken is a bearer token reused until shortly before it expires
+type cachedToken struct {
+	mu        sync.Mutex
+	value     string
+	expiresAt time.Time
+}
+
+// get returns the cached token, calling refresh when it is missing or stale
+func (c *cachedToken) get(refresh func() (string, time.Time, error)) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.value != "" && time.Until(c.expiresAt) > time.Minute {
+		return c.value, nil
+	}
+	value, expiresAt, err := refresh()
+	if err != nil {
+		return "", err
+	}
+	c.value, c.expiresAt = value, expiresAt
+	return value, nil
+}
@@ -0,0 +1,101 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"privmsg-relay/internal/egress"
+	"privmsg-relay/internal/queue"
+)
+
+// UnifiedPush posts wake-ups to UnifiedPush endpoints: URLs the app gets
+// from a distributor such as ntfy, for devices without Google services
+// The endpoint is user-supplied, so requests go through the egress guard
+type UnifiedPush struct {
+	client *http.Client
+	policy *egress.Policy
+}
+
+// NewUnifiedPush creates the provider; client should enforce policy
+func NewUnifiedPush(client *http.Client, policy *egress.Policy) *UnifiedPush {
+	return &UnifiedPush{client: client, policy: policy}
+}
+
+// ValidateToken checks the endpoint URL against the egress policy
+func (u *UnifiedPush) ValidateToken(token string) error {
+	_, err := u.policy.ValidateURL(token)
+	return err
+}
+
+func (u *UnifiedPush) Send(ctx context.Context, device queue.PushDevice) error {
+	return postWake(ctx, u.client, device.Token, device.Tag)
+}
+
+// ntfyTopic matches the topic names ntfy accepts
+var ntfyTopic = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Ntfy posts wake-ups to topics on one operator-chosen ntfy server, for
+// apps that subscribe to a topic directly rather than through UnifiedPush
+type Ntfy struct {
+	server string
+	client *http.Client
+}
+
+// NewNtfy creates the provider for the ntfy server at serverURL
+func NewNtfy(serverURL string) (*Ntfy, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid ntfy server URL %q", serverURL)
+	}
+	return &Ntfy{
+		server: strings.TrimRight(serverURL, "/"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// ValidateToken checks the token is a topic name, not a path or URL
+func (n *Ntfy) ValidateToken(token string) error {
+	if !ntfyTopic.MatchString(token) {
+		return errors.New("ntfy topics are 1-64 letters, digits, - or _")
+	}
+	return nil
+}
+
+func (n *Ntfy) Send(ctx context.Context, device queue.PushDevice) error {
+	return postWake(ctx, n.client, n.server+"/"+device.Token, device.Tag)
+}
+
+// postWake sends the tag as a plain body; a 404 or 410 means the endpoint
+// or topic is gone
+func postWake(ctx context.Context, client *http.Client, endpoint, tag string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(tag))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("TTL", "86400")
+	req.Header.Set("Urgency", "high")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrUnregistered
+	default:
+		return fmt.Errorf("push endpoint returned %d", resp.StatusCode)
+	}
+}
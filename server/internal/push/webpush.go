@@ -0,0 +1,256 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"privmsg-relay/internal/egress"
+	"privmsg-relay/internal/queue"
+)
+
+// VAPID tokens may live up to 24 hours; push services reject longer ones
+const vapidTokenLifetime = 12 * time.Hour
+
+// WebPush sends wake-ups to browser push subscriptions, encrypted per
+// RFC 8291 and authenticated with a VAPID key (RFC 8292)
+// Endpoints are user-supplied, so requests go through the egress guard
+type WebPush struct {
+	key       *ecdsa.PrivateKey
+	publicKey []byte // Uncompressed point, the browser's applicationServerKey
+	subject   string
+	client    *http.Client
+	policy    *egress.Policy
+
+	mu     sync.Mutex
+	tokens map[string]*cachedToken // By push service origin
+}
+
+// NewWebPush loads the VAPID key, a PEM-encoded P-256 key (PKCS#8 or SEC 1)
+// The key must stay the same across restarts: browsers bind subscriptions
+// to it. subject is a mailto: or https: contact for push service operators
+func NewWebPush(keyFile, subject string, client *http.Client, policy *egress.Policy) (*WebPush, error) {
+	if !strings.HasPrefix(subject, "mailto:") && !strings.HasPrefix(subject, "https://") {
+		return nil, errors.New("VAPID subject must be a mailto: or https: URL")
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VAPID key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("VAPID key file contains no PEM block")
+	}
+	var key *ecdsa.PrivateKey
+	if block.Type == "EC PRIVATE KEY" {
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	} else {
+		var parsed any
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			var ok bool
+			if key, ok = parsed.(*ecdsa.PrivateKey); !ok {
+				err = errors.New("not an ECDSA key")
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID key: %w", err)
+	}
+	ecdhKey, err := key.ECDH()
+	if err != nil || ecdhKey.Curve() != ecdh.P256() {
+		return nil, errors.New("VAPID key must be on P-256")
+	}
+
+	return &WebPush{
+		key:       key,
+		publicKey: ecdhKey.PublicKey().Bytes(),
+		subject:   subject,
+		client:    client,
+		policy:    policy,
+		tokens:    make(map[string]*cachedToken),
+	}, nil
+}
+
+// PublicKey returns the base64url key browsers pass to pushManager.subscribe
+func (w *WebPush) PublicKey() string {
+	return base64.RawURLEncoding.EncodeToString(w.publicKey)
+}
+
+// ValidateToken checks the subscription endpoint against the egress policy
+func (w *WebPush) ValidateToken(token string) error {
+	_, err := w.policy.ValidateURL(token)
+	return err
+}
+
+// Send posts the tag, encrypted to the subscription's keys, to its endpoint
+func (w *WebPush) Send(ctx context.Context, device queue.PushDevice) error {
+	if device.Keys == nil {
+		return ErrUnregistered
+	}
+	endpoint, err := url.Parse(device.Token)
+	if err != nil {
+		return err
+	}
+	origin := endpoint.Scheme + "://" + endpoint.Host
+	token, err := w.token(origin).get(func() (string, time.Time, error) { return w.signVAPID(origin) })
+	if err != nil {
+		return err
+	}
+	body, err := encryptWebPush(device.Keys, []byte(device.Tag))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, device.Token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "vapid t="+token+", k="+w.PublicKey())
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", "86400")
+	req.Header.Set("Urgency", "high")
+	req.Header.Set("Topic", "privmsg-wake") // Replaces an undelivered earlier wake-up
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrUnregistered
+	default:
+		return fmt.Errorf("push service returned %d", resp.StatusCode)
+	}
+}
+
+// token returns the VAPID token cache for a push service; tokens are
+// scoped to the service's origin
+func (w *WebPush) token(origin string) *cachedToken {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	t := w.tokens[origin]
+	if t == nil {
+		t = &cachedToken{}
+		w.tokens[origin] = t
+	}
+	return t
+}
+
+// signVAPID creates the ES256 JWT that identifies the relay to a push service
+func (w *WebPush) signVAPID(audience string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(vapidTokenLifetime)
+	token, err := signJWT("ES256", "", map[string]any{
+		"aud": audience,
+		"exp": expiresAt.Unix(),
+		"sub": w.subject,
+	}, func(digest []byte) ([]byte, error) {
+		r, s, err := ecdsa.Sign(rand.Reader, w.key, digest)
+		if err != nil {
+			return nil, err
+		}
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+	})
+	return token, expiresAt, err
+}
+
+// encryptWebPush encrypts plaintext as a single aes128gcm record (RFC 8188)
+// with keys derived as RFC 8291 describes
+func encryptWebPush(keys *queue.WebPushKeys, plaintext []byte) ([]byte, error) {
+	uaPublicBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(keys.P256dh, "="))
+	if err != nil {
+		return nil, err
+	}
+	authSecret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(keys.Auth, "="))
+	if err != nil {
+		return nil, err
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// A fresh sender key per message, so pushes cannot be linked by key
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := "WebPush: info\x00" + string(uaPublicBytes) + string(asPublic)
+	ikm, err := hkdfDerive(sharedSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	cek, err := hkdfDerive(ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdfDerive(ikm, salt, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// Header: salt, record size, key ID length, then the sender public key
+	out := make([]byte, 0, 16+4+1+len(asPublic)+len(plaintext)+1+gcm.Overhead())
+	out = append(out, salt...)
+	out = binary.BigEndian.AppendUint32(out, 4096)
+	out = append(out, byte(len(asPublic)))
+	out = append(out, asPublic...)
+	// 0x02 marks the last (and only) record
+	return gcm.Seal(out, nonce, append(plaintext, 0x02), nil), nil
+}
+
+// hkdfDerive runs HKDF-SHA256 extract and expand
+func hkdfDerive(secret, salt []byte, info string, length int) ([]byte, error) {
+	prk, err := hkdf.Extract(sha256.New, secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	return hkdf.Expand(sha256.New, prk, info, length)
+}
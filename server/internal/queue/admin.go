@@ -0,0 +1,148 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrQueueFrozen = errors.New("queue is frozen")
+)
+
+// Operator actions below bypass access tokens. They are only reachable
+// through the admin API and never reveal message contents
+
+// QueueInfo is what an operator may see of a queue: metadata and counts,
+// never tokens or payloads
+type QueueInfo struct {
+	ID                string    `json:"id"`
+	CreatedAt         time.Time `json:"created_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	LastActive        time.Time `json:"last_active"`
+	Messages          int64     `json:"messages"` // In Redis; a hibernated queue's messages are in the blob store
+	Tokens            int64     `json:"tokens"`   // Issued sub-tokens
+	SendTokenRequired bool      `json:"send_token_required"`
+	BurnAfterRead     bool      `json:"burn_after_read"`
+	Presence          bool      `json:"presence"`
+	Broadcast         bool      `json:"broadcast"`
+	SealedSender      bool      `json:"sealed_sender"`
+	MixDelivery       bool      `json:"mix_delivery"`
+	Frozen            bool      `json:"frozen"`
+	Hibernated        bool      `json:"hibernated"`
+	MaxMessages       int       `json:"max_messages,omitempty"`
+	MaxMessageSize    int       `json:"max_message_size,omitempty"`
+	TenantID          string    `json:"tenant_id,omitempty"`
+	Elevated          bool      `json:"elevated,omitempty"`
+}
+
+// InspectQueue returns a queue's metadata (without waking it)
+func (m *Manager) InspectQueue(queueID string) (*QueueInfo, error) {
+	queue, err := m.loadQueue(m.ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := m.redis.Pipeline()
+	messages := pipe.LLen(m.ctx, fmt.Sprintf("queue:%s:messages", queueID))
+	tokens := pipe.HLen(m.ctx, fmt.Sprintf("queue:%s:tokens", queueID))
+	if _, err := pipe.Exec(m.ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to count queue contents: %w", err)
+	}
+
+	return &QueueInfo{
+		ID:                queue.ID,
+		CreatedAt:         queue.CreatedAt,
+		ExpiresAt:         queue.ExpiresAt,
+		LastActive:        queue.LastActive,
+		Messages:          messages.Val(),
+		Tokens:            tokens.Val(),
+		SendTokenRequired: queue.SendToken != "",
+		BurnAfterRead:     queue.BurnAfterRead,
+		Presence:          queue.Presence,
+		Broadcast:         queue.Broadcast,
+		SealedSender:      queue.SealedSender,
+		MixDelivery:       queue.MixDelivery,
+		Frozen:            queue.Frozen,
+		Hibernated:        queue.Hibernated,
+		MaxMessages:       queue.MaxMessages,
+		MaxMessageSize:    queue.MaxMessageSize,
+		TenantID:          queue.TenantID,
+		Elevated:          queue.Elevated,
+	}, nil
+}
+
+// QueueExists reports whether a queue record exists (without waking it)
+func (m *Manager) QueueExists(queueID string) (bool, error) {
+	_, err := m.loadQueue(m.ctx, queueID)
+	if err == ErrQueueNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SetFrozen freezes or unfreezes a queue; frozen queues reject new messages
+func (m *Manager) SetFrozen(queueID string, frozen bool) error {
+	queue, err := m.loadQueue(m.ctx, queueID)
+	if err != nil {
+		return err
+	}
+	flag := "0"
+	if frozen {
+		flag = "1"
+	}
+	return m.setQueueState(m.ctx, queue, "frozen", flag)
+}
+
+// AdminDeleteQueue deletes a queue and everything attached to it
+func (m *Manager) AdminDeleteQueue(queueID string) error {
+	if _, err := m.loadQueue(m.ctx, queueID); err != nil {
+		return err
+	}
+	m.purgeQueue(m.ctx, queueID)
+	return nil
+}
+
+// ExtendQueue pushes a queue's expiry back by extra, refreshing its key and token TTLs
+func (m *Manager) ExtendQueue(queueID string, extra time.Duration) (time.Time, error) {
+	queue, err := m.changeQueue(m.ctx, queueID, func(queue *Queue) error {
+		return m.setExpiry(m.ctx, queue, queue.ExpiresAt.Add(extra))
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return queue.ExpiresAt, nil
+}
+
+// setExpiry stores a queue with a new expiry and moves the expiry of its
+// tokens, message list and farewell along
+func (m *Manager) setExpiry(ctx context.Context, queue *Queue, expiresAt time.Time) error {
+	queue.ExpiresAt = expiresAt
+	if err := m.updateQueue(ctx, queue); err != nil {
+		return err
+	}
+
+	ttl := time.Until(queue.ExpiresAt)
+	indexKey := fmt.Sprintf("queue:%s:tokens", queue.ID)
+	tokens, _ := m.redis.HVals(ctx, indexKey).Result()
+
+	pipe := m.redis.TxPipeline()
+	for _, token := range tokens {
+		pipe.Expire(ctx, fmt.Sprintf("token:%s", token), ttl)
+	}
+	pipe.Expire(ctx, indexKey, ttl)
+	pipe.Expire(ctx, fmt.Sprintf("queue:%s:messages", queue.ID), ttl)
+	pipe.Expire(ctx, fmt.Sprintf("queue:%s:seq", queue.ID), ttl)
+	pipe.Expire(ctx, queueStateKey(queue.ID), ttl)
+	pipe.Expire(ctx, farewellKey(queue.ID), ttl+FarewellRetention)
+	if queue.TenantID != "" {
+		pipe.ZAddXX(ctx, tenantQueuesKey(queue.TenantID), redis.Z{Score: float64(queue.ExpiresAt.Unix()), Member: queue.ID})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to extend token TTLs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"privmsg-relay/internal/atrest"
+	"privmsg-relay/internal/blobstore"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// EnableArchive spills payloads of messages older than after to store,
+// keeping only the message envelope in Redis until it's received or expires
+func (m *Manager) EnableArchive(store blobstore.Store, after time.Duration) {
+	m.archive = store
+	m.archiveAfter = after
+}
+
+// EnableOffload writes payloads larger than above bytes to store as they
+// are sent, so big messages never occupy Redis memory
+// It shares the archive's store and can be combined with EnableArchive
+func (m *Manager) EnableOffload(store blobstore.Store, above int) {
+	m.archive = store
+	m.offloadAbove = above
+}
+
+// archiveKey is where an archived payload lives in the blob store
+func archiveKey(queueID, messageID string) string {
+	return fmt.Sprintf("archive/%s/%s", queueID, messageID)
+}
+
+// ArchiveOldMessages moves cold payloads out of Redis and returns how many were moved
+func (m *Manager) ArchiveOldMessages() (int, error) {
+	if m.archive == nil || m.archiveAfter <= 0 {
+		return 0, nil
+	}
+
+	archived := 0
+	cutoff := time.Now().Add(-m.archiveAfter)
+
+	iter := m.redis.Scan(m.ctx, 0, "message:*", 500).Iterator()
+	for iter.Next(m.ctx) {
+		messageKey := iter.Val()
+
+		messageData, err := m.redis.Get(m.ctx, messageKey).Result()
+		if err != nil {
+			continue // Expired between SCAN and GET
+		}
+
+		var message Message
+		if err := m.decode(m.ctx, messageKey, messageData, &message); err != nil {
+			continue
+		}
+		if message.ArchiveRef != "" || message.ReceivedAt.After(cutoff) {
+			continue
+		}
+
+		// Upload first; the Redis copy stays authoritative until the blob is safe
+		if err := m.putArchived(m.ctx, &message); err != nil {
+			return archived, fmt.Errorf("failed to archive message: %w", err)
+		}
+		ref := message.ArchiveRef
+		stub, err := m.encode(messageKey, message)
+		if err != nil {
+			continue
+		}
+
+		// Keep the original expiry; XX so an acked message isn't resurrected
+		err = m.redis.SetArgs(m.ctx, messageKey, stub, redis.SetArgs{KeepTTL: true, Mode: "XX"}).Err()
+		if err != nil {
+			m.archive.Delete(m.ctx, ref)
+			continue
+		}
+		archived++
+	}
+
+	return archived, iter.Err()
+}
+
+// offload moves a new message's payload to the blob store when it is over
+// the offload threshold
+func (m *Manager) offload(ctx context.Context, message *Message) error {
+	if m.archive == nil || m.offloadAbove <= 0 || len(message.Payload) <= m.offloadAbove {
+		return nil
+	}
+
+	if err := m.putArchived(ctx, message); err != nil {
+		return fmt.Errorf("failed to offload payload: %w", err)
+	}
+	return nil
+}
+
+// putArchived writes a message's payload to the blob store, sealed like
+// the values in Redis when encryption is on, and leaves a stub in message
+func (m *Manager) putArchived(ctx context.Context, message *Message) error {
+	ref := archiveKey(message.QueueID, message.ID)
+	sealed, err := m.seal(ref, message.Payload)
+	if err != nil {
+		return err
+	}
+	if err := m.archive.Put(ctx, ref, sealed); err != nil {
+		return err
+	}
+	message.ArchiveSize = len(message.Payload)
+	message.ArchiveKey, _ = atrest.KeyID(sealed)
+	message.Payload = nil
+	message.ArchiveRef = ref
+	return nil
+}
+
+// resealArchived seals an archived payload again with the current data key
+func (m *Manager) resealArchived(ctx context.Context, message *Message) error {
+	data, err := m.archive.Get(ctx, message.ArchiveRef)
+	if err != nil {
+		return err
+	}
+	payload, err := m.open(ctx, message.ArchiveRef, data)
+	if err != nil {
+		return err
+	}
+	sealed, err := m.seal(message.ArchiveRef, payload)
+	if err != nil {
+		return err
+	}
+	if err := m.archive.Put(ctx, message.ArchiveRef, sealed); err != nil {
+		return err
+	}
+	message.ArchiveKey, _ = atrest.KeyID(sealed)
+	return nil
+}
+
+// hydrate restores an archived payload into message
+func (m *Manager) hydrate(ctx context.Context, message *Message) error {
+	if message.ArchiveRef == "" {
+		return nil
+	}
+	if m.archive == nil {
+		return blobstore.ErrNotFound
+	}
+
+	data, err := m.archive.Get(ctx, message.ArchiveRef)
+	if err != nil {
+		return err
+	}
+	payload, err := m.open(ctx, message.ArchiveRef, data)
+	if err != nil {
+		return err
+	}
+	message.Payload = payload
+	message.ArchiveRef = ""
+	message.ArchiveSize = 0
+	message.ArchiveKey = ""
+	return nil
+}
+
+// deleteArchived removes a message's archived payload, if any
+func (m *Manager) deleteArchived(queueID, messageID string) {
+	if m.archive == nil {
+		return
+	}
+	m.archive.Delete(m.ctx, archiveKey(queueID, messageID))
+}
@@ -0,0 +1,358 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"privmsg-relay/internal/atrest"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrAtRestDisabled is returned by the at-rest admin calls when encryption is off
+var ErrAtRestDisabled = errors.New("encryption at rest disabled")
+
+const (
+	atRestKeysKey    = "atrest:keys"    // Wrapped data keys by ID
+	atRestCurrentKey = "atrest:current" // ID of the data key new values are sealed with
+
+	// A replaced data key is deleted once a sweep finds nothing sealed with
+	// it and every replica has had time to switch to its successor
+	atRestRetireAfter = time.Hour
+)
+
+// dataKeyRecord is stored in atRestKeysKey
+type dataKeyRecord struct {
+	Wrapped   []byte    `json:"wrapped"`
+	KEKID     string    `json:"kek_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AtRestKey describes a data key without revealing it
+type AtRestKey struct {
+	ID        string    `json:"id"`
+	KEKID     string    `json:"kek_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Current   bool      `json:"current"`
+}
+
+// AtRestStatus is returned by GET /admin/at-rest
+type AtRestStatus struct {
+	KEKID string      `json:"kek_id"` // Key-encryption key new data keys are wrapped with
+	Keys  []AtRestKey `json:"keys"`
+}
+
+// reencryptScript replaces a value only if nobody wrote it since it was read
+var reencryptScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[2], 'KEEPTTL')
+	return 1
+end
+return 0
+`)
+
+// EnableAtRest seals queue records and messages with data keys wrapped by
+// kek; previous key-encryption keys only unwrap data keys, which are then
+// wrapped again with kek
+func (m *Manager) EnableAtRest(ctx context.Context, kek atrest.KeyWrapper, previous ...atrest.KeyWrapper) error {
+	m.atRest = atrest.NewKeyring()
+	m.atRestKEK = kek
+	m.atRestKEKs = map[string]atrest.KeyWrapper{kek.ID(): kek}
+	for _, wrapper := range previous {
+		m.atRestKEKs[wrapper.ID()] = wrapper
+	}
+
+	if err := m.loadDataKeys(ctx); err != nil {
+		return err
+	}
+	if m.atRest.Current() != "" {
+		return nil
+	}
+
+	// First start with encryption: whoever sets the current key first wins
+	id, err := m.newDataKey(ctx)
+	if err != nil {
+		return err
+	}
+	if err := m.redis.SetNX(ctx, atRestCurrentKey, id, 0).Err(); err != nil {
+		return fmt.Errorf("failed to store data key: %w", err)
+	}
+	return m.loadDataKeys(ctx)
+}
+
+// newDataKey generates and stores a wrapped data key, returning its ID
+func (m *Manager) newDataKey(ctx context.Context) (string, error) {
+	id, key, err := atrest.NewDataKey()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrapped, err := m.atRestKEK.Wrap(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	data, err := json.Marshal(dataKeyRecord{Wrapped: wrapped, KEKID: m.atRestKEK.ID(), CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return "", err
+	}
+	if err := m.redis.HSet(ctx, atRestKeysKey, id, data).Err(); err != nil {
+		return "", fmt.Errorf("failed to store data key: %w", err)
+	}
+	return id, nil
+}
+
+// loadDataKeys unwraps data keys the keyring does not hold yet and picks
+// up the current key, which another replica may have rotated
+func (m *Manager) loadDataKeys(ctx context.Context) error {
+	records, err := m.redis.HGetAll(ctx, atRestKeysKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to load data keys: %w", err)
+	}
+	for id, data := range records {
+		if m.atRest.Has(id) {
+			continue
+		}
+		var record dataKeyRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			return fmt.Errorf("failed to parse data key %s: %w", id, err)
+		}
+		wrapper := m.atRestKEKs[record.KEKID]
+		if wrapper == nil {
+			return fmt.Errorf("data key %s is wrapped with unknown key %s", id, record.KEKID)
+		}
+		key, err := wrapper.Unwrap(ctx, record.Wrapped)
+		if err != nil {
+			return fmt.Errorf("failed to unwrap data key %s: %w", id, err)
+		}
+		if err := m.atRest.Add(id, key); err != nil {
+			return err
+		}
+
+		// Move data keys off a retired key-encryption key
+		if record.KEKID != m.atRestKEK.ID() {
+			if record.Wrapped, err = m.atRestKEK.Wrap(ctx, key); err != nil {
+				return fmt.Errorf("failed to wrap data key: %w", err)
+			}
+			record.KEKID = m.atRestKEK.ID()
+			if data, err := json.Marshal(record); err == nil {
+				m.redis.HSet(ctx, atRestKeysKey, id, data)
+			}
+			slog.Info("Rewrapped data key", "id", id, "kek_id", record.KEKID)
+		}
+	}
+
+	current, err := m.redis.Get(ctx, atRestCurrentKey).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to load data keys: %w", err)
+	}
+	if current != "" && !m.atRest.Has(current) {
+		return fmt.Errorf("current data key %s is missing", current)
+	}
+	m.atRest.SetCurrent(current)
+	return nil
+}
+
+// seal encrypts a value about to be stored at key, when encryption is on
+func (m *Manager) seal(key string, plaintext []byte) ([]byte, error) {
+	if m.atRest == nil {
+		return plaintext, nil
+	}
+	sealed, err := m.atRest.Seal(key, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt %s: %w", strings.SplitN(key, ":", 2)[0], err)
+	}
+	return sealed, nil
+}
+
+// open decrypts a value read from key; values written before encryption
+// was turned on are returned as they are
+func (m *Manager) open(ctx context.Context, key string, data []byte) ([]byte, error) {
+	if !atrest.Sealed(data) {
+		return data, nil
+	}
+	if m.atRest == nil {
+		return nil, errors.New("value is encrypted but AT_REST_KEY_FILE is not set")
+	}
+	plaintext, err := m.atRest.Open(key, data)
+	if err == atrest.ErrUnknownKey {
+		// Sealed by a replica that rotated since we last looked
+		if err := m.loadDataKeys(ctx); err != nil {
+			return nil, err
+		}
+		plaintext, err = m.atRest.Open(key, data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", strings.SplitN(key, ":", 2)[0], err)
+	}
+	return plaintext, nil
+}
+
+// encode marshals v and seals it for key
+func (m *Manager) encode(key string, v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return m.seal(key, data)
+}
+
+// decode opens a value read from key and unmarshals it into v
+func (m *Manager) decode(ctx context.Context, key, data string, v interface{}) error {
+	plaintext, err := m.open(ctx, key, []byte(data))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plaintext, v)
+}
+
+// RotateAtRestKey makes a fresh data key current; values sealed with older
+// keys are sealed again by the next sweeps
+func (m *Manager) RotateAtRestKey(ctx context.Context) (*AtRestStatus, error) {
+	if m.atRest == nil {
+		return nil, ErrAtRestDisabled
+	}
+	id, err := m.newDataKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.redis.Set(ctx, atRestCurrentKey, id, 0).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store data key: %w", err)
+	}
+	if err := m.loadDataKeys(ctx); err != nil {
+		return nil, err
+	}
+	slog.Info("Rotated data key", "id", id)
+	return m.AtRestStatus(ctx)
+}
+
+// AtRestStatus lists the data keys
+func (m *Manager) AtRestStatus(ctx context.Context) (*AtRestStatus, error) {
+	if m.atRest == nil {
+		return nil, ErrAtRestDisabled
+	}
+	records, err := m.redis.HGetAll(ctx, atRestKeysKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load data keys: %w", err)
+	}
+	current, _ := m.redis.Get(ctx, atRestCurrentKey).Result()
+
+	status := &AtRestStatus{KEKID: m.atRestKEK.ID(), Keys: []AtRestKey{}}
+	for id, data := range records {
+		var record dataKeyRecord
+		if json.Unmarshal([]byte(data), &record) != nil {
+			continue
+		}
+		status.Keys = append(status.Keys, AtRestKey{ID: id, KEKID: record.KEKID, CreatedAt: record.CreatedAt, Current: id == current})
+	}
+	sort.Slice(status.Keys, func(i, j int) bool { return status.Keys[i].CreatedAt.Before(status.Keys[j].CreatedAt) })
+	return status, nil
+}
+
+// SweepAtRest seals every queue record, message and archived payload not
+// yet sealed with the current data key, then deletes data keys nothing
+// uses any more
+// It returns how many values were sealed again
+func (m *Manager) SweepAtRest(ctx context.Context) (int, error) {
+	if m.atRest == nil {
+		return 0, nil
+	}
+	if err := m.loadDataKeys(ctx); err != nil {
+		return 0, err
+	}
+	current := m.atRest.Current()
+
+	resealed := 0
+	inUse := make(map[string]bool)
+	for _, pattern := range []string{"queue:*", "message:*"} {
+		iter := m.redis.Scan(ctx, 0, pattern, 500).Iterator()
+		for iter.Next(ctx) {
+			key := iter.Val()
+			// Only queue records (queue:{id}), not queue:{id}:messages and friends
+			if pattern == "queue:*" && strings.Contains(strings.TrimPrefix(key, "queue:"), ":") {
+				continue
+			}
+
+			data, err := m.redis.Get(ctx, key).Bytes()
+			if err != nil {
+				continue // Expired since the scan
+			}
+			id, ok := atrest.KeyID(data)
+			upToDate := ok && id == current
+			if upToDate && (pattern != "message:*" || m.archive == nil) {
+				continue
+			} else if ok && !upToDate {
+				inUse[id] = true
+			}
+
+			plaintext, err := m.open(ctx, key, data)
+			if err != nil {
+				slog.Error("Failed to open value for resealing", "key", key, "error", err)
+				continue
+			}
+
+			// An archived payload is sealed on its own and may lag its stub
+			if pattern == "message:*" && m.archive != nil {
+				var message Message
+				if json.Unmarshal(plaintext, &message) == nil && message.ArchiveRef != "" && message.ArchiveKey != current {
+					if err := m.resealArchived(ctx, &message); err != nil {
+						slog.Error("Failed to reseal archived payload", "key", key, "error", err)
+						inUse[message.ArchiveKey] = true
+					} else if plaintext, err = json.Marshal(message); err != nil {
+						return resealed, err
+					}
+					upToDate = false
+				}
+			}
+			if upToDate {
+				continue
+			}
+
+			sealed, err := m.seal(key, plaintext)
+			if err != nil {
+				return resealed, err
+			}
+			swapped, err := reencryptScript.Run(ctx, m.redis, []string{key}, data, sealed).Int()
+			if err != nil {
+				return resealed, fmt.Errorf("failed to reseal value: %w", err)
+			}
+			if swapped == 1 {
+				resealed++
+			} else if id, ok := atrest.KeyID(data); ok {
+				// Changed under us; look again next sweep
+				inUse[id] = true
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return resealed, fmt.Errorf("failed to scan %s: %w", pattern, err)
+		}
+	}
+
+	m.retireDataKeys(ctx, current, inUse)
+	return resealed, nil
+}
+
+// retireDataKeys deletes data keys that are neither current nor in use,
+// once the current key is old enough that no replica still seals with them
+func (m *Manager) retireDataKeys(ctx context.Context, current string, inUse map[string]bool) {
+	records, err := m.redis.HGetAll(ctx, atRestKeysKey).Result()
+	if err != nil {
+		return
+	}
+	var currentRecord dataKeyRecord
+	if json.Unmarshal([]byte(records[current]), &currentRecord) != nil || time.Since(currentRecord.CreatedAt) < atRestRetireAfter {
+		return
+	}
+	for id := range records {
+		if id == current || inUse[id] {
+			continue
+		}
+		m.redis.HDel(ctx, atRestKeysKey, id)
+		m.atRest.Remove(id)
+		slog.Info("Retired data key", "id", id)
+	}
+}
@@ -0,0 +1,139 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrInvalidBroadcast is returned for a broadcast queue that asks to be burn-after-read
+var ErrInvalidBroadcast = errors.New("broadcast queues cannot be burn-after-read")
+
+// MaxReadersPerBroadcast caps the access tokens of a broadcast queue, in
+// place of MaxTokensPerQueue
+const MaxReadersPerBroadcast = 1000
+
+// Broadcast queues have one writer (the send token holder) and many
+// readers, each with their own access token. A reader's cursor, kept in
+// queue:{id}:cursors as token ID -> sequence number, is the last message
+// it acked; receives start after it. A message is deleted once every
+// reader's cursor has passed it, or when it expires
+
+func cursorsKey(queueID string) string {
+	return fmt.Sprintf("queue:%s:cursors", queueID)
+}
+
+// advanceCursorScript moves a reader's cursor forward, never back
+var advanceCursorScript = redis.NewScript(`
+local current = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+if tonumber(ARGV[2]) > current then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+end
+return 1
+`)
+
+// addReader starts a cursor for a new reader token, so messages are kept
+// until it has read them too
+func (m *Manager) addReader(ctx context.Context, queue *Queue, accessToken string) {
+	pipe := m.redis.TxPipeline()
+	pipe.HSetNX(ctx, cursorsKey(queue.ID), tokenID(accessToken), 0)
+	pipe.ExpireAt(ctx, cursorsKey(queue.ID), queue.ExpiresAt)
+	pipe.Exec(ctx)
+}
+
+// readerCursor returns the sequence number a reader has acked up to
+func (m *Manager) readerCursor(ctx context.Context, queueID, accessToken string) int64 {
+	cursor, err := m.redis.HGet(ctx, cursorsKey(queueID), tokenID(accessToken)).Int64()
+	if err != nil {
+		return 0
+	}
+	return cursor
+}
+
+// ackBroadcast moves a reader's cursor up to the acked message and
+// deletes whatever every reader has now passed; acking a message that is
+// already gone is not an error
+func (m *Manager) ackBroadcast(ctx context.Context, queue *Queue, accessToken, messageID string) error {
+	messageKey := fmt.Sprintf("message:%s:%s", queue.ID, messageID)
+	data, err := m.redis.Get(ctx, messageKey).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get message: %w", err)
+	}
+	var message Message
+	if err := m.decode(ctx, messageKey, data, &message); err != nil {
+		return fmt.Errorf("failed to decode message: %w", err)
+	}
+
+	err = advanceCursorScript.Run(ctx, m.redis, []string{cursorsKey(queue.ID)}, tokenID(accessToken), message.Seq).Err()
+	if err != nil {
+		return fmt.Errorf("failed to advance cursor: %w", err)
+	}
+	m.redis.ExpireAt(ctx, cursorsKey(queue.ID), queue.ExpiresAt)
+
+	m.pruneBroadcast(ctx, queue.ID)
+	return nil
+}
+
+// pruneBroadcast deletes the messages every reader has acked
+// With no readers yet, messages wait for their TTL
+func (m *Manager) pruneBroadcast(ctx context.Context, queueID string) {
+	cursors, err := m.redis.HVals(ctx, cursorsKey(queueID)).Result()
+	if err != nil || len(cursors) == 0 {
+		return
+	}
+	var floor int64 = -1
+	for _, value := range cursors {
+		cursor, _ := strconv.ParseInt(value, 10, 64)
+		if floor < 0 || cursor < floor {
+			floor = cursor
+		}
+	}
+	if floor <= 0 {
+		return
+	}
+
+	// Messages are listed in send order, so stop at the first one still unread
+	listKey := fmt.Sprintf("queue:%s:messages", queueID)
+	messageIDs, err := m.redis.LRange(ctx, listKey, 0, -1).Result()
+	if err != nil {
+		return
+	}
+	for _, msgID := range messageIDs {
+		messageKey := fmt.Sprintf("message:%s:%s", queueID, msgID)
+		data, err := m.redis.Get(ctx, messageKey).Result()
+		if err == redis.Nil && m.isPending(ctx, queueID, msgID) {
+			return // Still being stored, so nobody has read it
+		}
+		if err == redis.Nil {
+			m.redis.LRem(ctx, listKey, 1, msgID)
+			m.RecordEvent(queueID, EventExpired, msgID)
+			continue
+		}
+		if err != nil {
+			return
+		}
+		var message Message
+		if m.decode(ctx, messageKey, data, &message) != nil || message.Seq > floor {
+			return
+		}
+
+		m.redis.Del(ctx, messageKey)
+		m.redis.LRem(ctx, listKey, 1, msgID)
+		m.deleteArchived(queueID, msgID)
+		m.RecordEvent(queueID, EventAcked, msgID)
+	}
+}
+
+// forgetReader drops a revoked reader's cursor so it no longer holds
+// messages back
+func (m *Manager) forgetReader(ctx context.Context, queueID, revokeID string) {
+	if removed, _ := m.redis.HDel(ctx, cursorsKey(queueID), revokeID).Result(); removed > 0 {
+		m.pruneBroadcast(ctx, queueID)
+	}
+}
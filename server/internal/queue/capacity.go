@@ -0,0 +1,128 @@
+package queue
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCapacitySample bounds how many keys a capacity report measures
+const maxCapacitySample = 1000
+
+// CapacitySample is a point-in-time measurement of Redis usage for sizing
+// Per-key sizes come from MEMORY USAGE on a sample, never from key contents
+type CapacitySample struct {
+	Keys     int64 `json:"keys"` // Whole database, including tokens and rate limits
+	Queues   int   `json:"queues"`
+	Messages int   `json:"messages"`
+
+	UsedMemory int64 `json:"used_memory"` // Bytes, from INFO memory
+	MaxMemory  int64 `json:"max_memory"`  // Bytes (0 = Redis has no maxmemory limit)
+
+	SampledQueues   int   `json:"sampled_queues"`
+	SampledMessages int   `json:"sampled_messages"`
+	BytesPerQueue   int64 `json:"bytes_per_queue"`   // Mean queue record size, excluding messages
+	BytesPerMessage int64 `json:"bytes_per_message"` // Mean stored message size
+
+	// Configured limits the projections are made against
+	MaxMessagesPerQueue int   `json:"max_messages_per_queue"`
+	MaxMessageSize      int   `json:"max_message_size"`
+	MaxMessageTTL       int64 `json:"max_message_ttl_seconds"`
+	MaxQueueTTL         int64 `json:"max_queue_ttl_seconds"`
+
+	SampledAt time.Time `json:"sampled_at"`
+}
+
+// Capacity measures current key counts and per-key memory, sampling up to
+// sampleSize queue records and messages
+func (m *Manager) Capacity(sampleSize int) (*CapacitySample, error) {
+	if sampleSize <= 0 || sampleSize > maxCapacitySample {
+		sampleSize = maxCapacitySample
+	}
+
+	stats, err := m.Stats()
+	if err != nil {
+		return nil, err
+	}
+	sample := &CapacitySample{
+		Queues:   stats.Queues,
+		Messages: stats.Messages,
+
+		MaxMessagesPerQueue: m.maxMessages,
+		MaxMessageSize:      m.maxMessageSize,
+		MaxMessageTTL:       int64(m.maxMessageTTL / time.Second),
+		MaxQueueTTL:         int64(m.maxQueueTTL / time.Second),
+		SampledAt:           time.Now(),
+	}
+
+	if sample.Keys, err = m.redis.DBSize(m.ctx).Result(); err != nil {
+		return nil, fmt.Errorf("failed to count keys: %w", err)
+	}
+
+	info, err := m.redis.Info(m.ctx, "memory").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memory info: %w", err)
+	}
+	sample.UsedMemory = infoField(info, "used_memory")
+	sample.MaxMemory = infoField(info, "maxmemory")
+
+	sample.SampledQueues, sample.BytesPerQueue, err = m.sampleMemory("queue:*", sampleSize, func(key string) bool {
+		return strings.Count(key, ":") == 1
+	})
+	if err != nil {
+		return nil, err
+	}
+	sample.SampledMessages, sample.BytesPerMessage, err = m.sampleMemory("message:*", sampleSize, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return sample, nil
+}
+
+// sampleMemory averages MEMORY USAGE over up to n keys matching pattern
+func (m *Manager) sampleMemory(pattern string, n int, keep func(string) bool) (int, int64, error) {
+	var keys []string
+	iter := m.redis.Scan(m.ctx, 0, pattern, 500).Iterator()
+	for len(keys) < n && iter.Next(m.ctx) {
+		if keep == nil || keep(iter.Val()) {
+			keys = append(keys, iter.Val())
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to scan %s: %w", pattern, err)
+	}
+	if len(keys) == 0 {
+		return 0, 0, nil
+	}
+
+	var total int64
+	measured := 0
+	for _, key := range keys {
+		usage, err := m.redis.MemoryUsage(m.ctx, key).Result()
+		if err != nil {
+			continue // Expired since the scan
+		}
+		total += usage
+		measured++
+	}
+	if measured == 0 {
+		return 0, 0, nil
+	}
+	return measured, total / int64(measured), nil
+}
+
+// infoField reads an integer field from an INFO section
+func infoField(info, name string) int64 {
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if ok && key == name {
+			n, _ := strconv.ParseInt(value, 10, 64)
+			return n
+		}
+	}
+	return 0
+}
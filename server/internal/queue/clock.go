@@ -0,0 +1,82 @@
+package queue
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"privmsg-relay/internal/identity"
+)
+
+var (
+	ErrSignedTimeDisabled = errors.New("signed time disabled")
+	ErrInvalidNonce       = errors.New("invalid nonce")
+)
+
+// DefaultClockSkew is how far a client clock may run behind or ahead of the
+// relay before client-supplied timestamps are judged against it
+const DefaultClockSkew = 5 * time.Minute
+
+// maxNonceLength caps the nonce echoed in a signed time statement
+const maxNonceLength = 64
+
+// ServerTime is the statement signed by GET /time
+type ServerTime struct {
+	Time           time.Time `json:"time"`
+	Nonce          string    `json:"nonce,omitempty"` // Echoed from the request, so a stale answer cannot be replayed
+	MaxSkewSeconds int64     `json:"max_skew_seconds"`
+}
+
+// SignedTime carries the ServerTime JSON exactly as signed
+// Clients verify Signature over Payload with the pinned relay key, then parse Payload
+type SignedTime struct {
+	Payload   []byte `json:"payload"`   // JSON-encoded ServerTime
+	Signature []byte `json:"signature"` // Ed25519 over Payload
+	KeyID     string `json:"key_id"`
+	PublicKey []byte `json:"public_key"` // For clients that have not pinned the key yet
+}
+
+// SetClockSkew sets the tolerance applied to client-supplied deadlines
+func (m *Manager) SetClockSkew(skew time.Duration) {
+	m.clockSkew = skew
+}
+
+// EnableSignedTime turns on signed time statements using key
+func (m *Manager) EnableSignedTime(key ed25519.PrivateKey) {
+	m.timeKey = key
+}
+
+// beforeDeadline reports whether a client-supplied deadline has not passed,
+// allowing for the configured clock skew
+func (m *Manager) beforeDeadline(deadline time.Time) bool {
+	return time.Now().Before(deadline.Add(m.clockSkew))
+}
+
+// SignServerTime returns the relay's current time signed with its identity key
+func (m *Manager) SignServerTime(nonce string) (*SignedTime, error) {
+	if m.timeKey == nil {
+		return nil, ErrSignedTimeDisabled
+	}
+	if len(nonce) > maxNonceLength {
+		return nil, ErrInvalidNonce
+	}
+
+	payload, err := json.Marshal(ServerTime{
+		Time:           time.Now().UTC(),
+		Nonce:          nonce,
+		MaxSkewSeconds: int64(m.clockSkew / time.Second),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal server time: %w", err)
+	}
+
+	pub := m.timeKey.Public().(ed25519.PublicKey)
+	return &SignedTime{
+		Payload:   payload,
+		Signature: ed25519.Sign(m.timeKey, payload),
+		KeyID:     identity.KeyID(pub),
+		PublicKey: pub,
+	}, nil
+}
@@ -0,0 +1,122 @@
+package queue
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrInvalidCursor is returned for a receive cursor the relay did not issue
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursorPrefix versions the cursor format so it can change without
+// misreading cursors held by existing clients
+const cursorPrefix = "s1:"
+
+// EncodeCursor returns the opaque cursor that resumes after seq
+// Clients must treat cursors as opaque; only the relay interprets them
+func EncodeCursor(seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.FormatInt(seq, 10)))
+}
+
+// DecodeCursor returns the sequence number a cursor resumes after
+// The empty cursor starts from the beginning of the queue
+func DecodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	value, ok := strings.CutPrefix(string(raw), cursorPrefix)
+	if !ok {
+		return 0, ErrInvalidCursor
+	}
+	seq, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return seq, nil
+}
+
+// seqReservation is how long a send may take to store its message after
+// taking its place in the list; a place held longer is from a send that
+// failed, and its list entry is then swept like an expired message's
+const seqReservation = 30 * time.Second
+
+func pendingMessagesKey(queueID string) string {
+	return fmt.Sprintf("queue:%s:pending", queueID)
+}
+
+// reserveSeqScript takes the next sequence number and the next place in the
+// message list in one step, so the list stays in sequence order and a
+// cursor never moves past a message that is still being stored
+// KEYS: seq counter, message list, pending zset
+// ARGV: message ID, now, deadline (unix ms)
+var reserveSeqScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[3], '-inf', ARGV[2])
+local seq = redis.call('INCR', KEYS[1])
+redis.call('RPUSH', KEYS[2], ARGV[1])
+redis.call('ZADD', KEYS[3], ARGV[3], ARGV[1])
+return seq
+`)
+
+// reserveSeq lists a message that is about to be stored and returns its
+// sequence number; settleSeq must follow once it is stored or failed to be
+func (m *Manager) reserveSeq(ctx context.Context, queueID, messageID string) (int64, error) {
+	now := time.Now()
+	keys := []string{
+		fmt.Sprintf("queue:%s:seq", queueID),
+		fmt.Sprintf("queue:%s:messages", queueID),
+		pendingMessagesKey(queueID),
+	}
+	seq, err := reserveSeqScript.Run(ctx, m.redis, keys, messageID, now.UnixMilli(), now.Add(seqReservation).UnixMilli()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to assign sequence number: %w", err)
+	}
+	return seq, nil
+}
+
+// settleSeq ends a reservation; a message that was not stored leaves the
+// list again
+func (m *Manager) settleSeq(ctx context.Context, queueID, messageID string, stored bool) {
+	if !stored {
+		m.redis.LRem(ctx, fmt.Sprintf("queue:%s:messages", queueID), 1, messageID)
+	}
+	m.redis.ZRem(ctx, pendingMessagesKey(queueID), messageID)
+}
+
+// isPending reports whether a listed message is still being stored
+func (m *Manager) isPending(ctx context.Context, queueID, messageID string) bool {
+	deadline, err := m.redis.ZScore(ctx, pendingMessagesKey(queueID), messageID).Result()
+	return err == nil && int64(deadline) > time.Now().UnixMilli()
+}
+
+// withoutPending drops the messages still being stored from a listing
+func (m *Manager) withoutPending(ctx context.Context, queueID string, messageIDs []string) []string {
+	pending, err := m.redis.ZRangeByScore(ctx, pendingMessagesKey(queueID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return messageIDs
+	}
+	skip := make(map[string]bool, len(pending))
+	for _, id := range pending {
+		skip[id] = true
+	}
+	kept := messageIDs[:0]
+	for _, id := range messageIDs {
+		if !skip[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
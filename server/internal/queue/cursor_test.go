@@ -0,0 +1,90 @@
+package queue
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, seq := range []int64{0, 1, 42, 1 << 40, 1<<63 - 1} {
+		cursor := EncodeCursor(seq)
+		got, err := DecodeCursor(cursor)
+		if err != nil {
+			t.Errorf("DecodeCursor(EncodeCursor(%d)): %v", seq, err)
+			continue
+		}
+		if got != seq {
+			t.Errorf("DecodeCursor(EncodeCursor(%d)) = %d", seq, got)
+		}
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	raw := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name   string
+		cursor string
+		want   int64
+		err    error
+	}{
+		{"empty starts at the beginning", "", 0, nil},
+		{"issued cursor", raw("s1:17"), 17, nil},
+		{"not base64", "not a cursor!", 0, ErrInvalidCursor},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("s1:17")), 0, ErrInvalidCursor},
+		{"missing version", raw("17"), 0, ErrInvalidCursor},
+		{"unknown version", raw("s2:17"), 0, ErrInvalidCursor},
+		{"not a number", raw("s1:seventeen"), 0, ErrInvalidCursor},
+		{"negative", raw("s1:-1"), 0, ErrInvalidCursor},
+		{"overflow", raw("s1:9223372036854775808"), 0, ErrInvalidCursor},
+		{"bare message ID", "0f8e6c1a-5c39-4a5e-9a55-3d2c9f1e7b20", 0, ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeCursor(tt.cursor)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("DecodeCursor(%q) error = %v, want %v", tt.cursor, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("DecodeCursor(%q) = %d, want %d", tt.cursor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReceiveStopsAtPendingMessage(t *testing.T) {
+	m := testManager(t)
+	ctx := context.Background()
+	created := createTestQueue(t, m, CreateQueueRequest{})
+	queueID := created.QueueID
+
+	before := sendTestMessages(t, m, queueID, 1)
+	// A send that has taken its place in the list but not stored yet
+	seq, err := m.reserveSeq(ctx, queueID, "pending-message")
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := sendTestMessages(t, m, queueID, 1)
+
+	response, err := m.ReceiveMessages(ctx, queueID, created.AccessToken, ReceiveOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Messages) != 1 || response.Messages[0].ID != before[0] {
+		t.Fatalf("received %d messages, want only the one before the pending send", len(response.Messages))
+	}
+	if next, _ := DecodeCursor(response.NextCursor); next >= seq {
+		t.Fatalf("cursor moved to seq %d, past the pending seq %d", next, seq)
+	}
+
+	// Once the send gives up, the cursor picks up the message after it
+	m.settleSeq(ctx, queueID, "pending-message", false)
+	response, err = m.ReceiveMessages(ctx, queueID, created.AccessToken, ReceiveOptions{Cursor: response.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Messages) != 1 || response.Messages[0].ID != after[0] {
+		t.Fatalf("received %d messages after the cursor, want the one sent after the pending send", len(response.Messages))
+	}
+}
@@ -0,0 +1,263 @@
+package queue
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrInvalidDiscovery = errors.New("invalid discovery request")
+	ErrTooManyHashes    = errors.New("too many discovery hashes")
+)
+
+// Contact discovery limits
+const (
+	MaxDiscoveryHashesPerQueue = 5  // Identifiers (phone, email, ...) one queue can be found by
+	MaxDiscoveryPrefixes       = 50 // Buckets one lookup may ask for
+	DiscoveryPrefixSize        = 2  // Bytes of the identifier hash that pick its bucket
+	discoveryTagSize           = 8  // Bytes of the hash, after the prefix, kept to tell bucket entries apart
+)
+
+// Contact discovery lets someone who knows an identifier (a phone number,
+// an email address) find the queue registered for it, without the relay
+// keeping the identifier or learning who was looked up
+//
+// Clients hash identifiers as SHA-256(salt || normalized identifier), with
+// the relay's salt from GET /discovery. A registration is filed under the
+// hash's first DiscoveryPrefixSize bytes (its bucket) and the next
+// discoveryTagSize bytes (its tag); the queue ID is sealed with AES-256-GCM
+// under SHA-256("privmsg-discovery-v1" || hash), so the stored entry names
+// the queue only to someone who can produce the full hash. A lookup sends
+// bucket prefixes only and gets back every entry in those buckets; the
+// client picks out its tag and opens the sealed queue ID itself
+
+// discoverySaltKey holds the relay-wide salt, created on first use
+const discoverySaltKey = "discovery:salt"
+
+// DiscoveryInfoResponse tells clients how to hash identifiers
+type DiscoveryInfoResponse struct {
+	Salt       []byte `json:"salt"`
+	PrefixSize int    `json:"prefix_size"` // Bytes of the hash that name its bucket
+}
+
+// DiscoveryRequest registers the identifier hashes a queue can be found by
+type DiscoveryRequest struct {
+	Hashes []string `json:"hashes"` // Hex SHA-256(salt || identifier); replaces any earlier ones
+}
+
+// DiscoveryLookupRequest asks for the entries in some buckets
+type DiscoveryLookupRequest struct {
+	Prefixes []string `json:"prefixes"` // Hex, DiscoveryPrefixSize bytes each
+}
+
+// DiscoveryEntry is one registration in a bucket
+type DiscoveryEntry struct {
+	Tag           string `json:"tag"`             // Hex hash bytes after the prefix
+	SealedQueueID []byte `json:"sealed_queue_id"` // Nonce || AES-256-GCM ciphertext of the queue ID
+}
+
+// DiscoveryLookupResponse maps each requested prefix to its bucket
+type DiscoveryLookupResponse struct {
+	Buckets map[string][]DiscoveryEntry `json:"buckets"`
+}
+
+// discoveryBucketKey is the set of entry keys filed under a prefix
+func discoveryBucketKey(prefix string) string {
+	return fmt.Sprintf("discovery:bucket:%s", prefix)
+}
+
+// discoveryEntryKey holds one sealed queue ID and expires with its queue
+func discoveryEntryKey(prefix, tag string) string {
+	return fmt.Sprintf("discovery:entry:%s:%s", prefix, tag)
+}
+
+// queueDiscoveryKey lists a queue's entry keys so they can be withdrawn
+func queueDiscoveryKey(queueID string) string {
+	return fmt.Sprintf("queue:%s:discovery", queueID)
+}
+
+// DiscoveryInfo returns the salt clients hash identifiers with
+func (m *Manager) DiscoveryInfo(ctx context.Context) (*DiscoveryInfoResponse, error) {
+	salt, err := m.redis.Get(ctx, discoverySaltKey).Bytes()
+	if err == redis.Nil {
+		// Racing relays may both generate one; SETNX keeps the first
+		fresh := make([]byte, 32)
+		if _, err := rand.Read(fresh); err != nil {
+			return nil, fmt.Errorf("failed to generate discovery salt: %w", err)
+		}
+		m.redis.SetNX(ctx, discoverySaltKey, fresh, 0)
+		salt, err = m.redis.Get(ctx, discoverySaltKey).Bytes()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load discovery salt: %w", err)
+	}
+	return &DiscoveryInfoResponse{Salt: salt, PrefixSize: DiscoveryPrefixSize}, nil
+}
+
+// RegisterDiscovery makes the queue findable by the given identifier
+// hashes, replacing any it was findable by before (requires admin)
+// An identifier registered by two queues finds the one registered last
+func (m *Manager) RegisterDiscovery(ctx context.Context, queueID, accessToken string, req DiscoveryRequest) error {
+	duress, err := underDuress(m.authorize(ctx, queueID, accessToken, CapAdmin))
+	if err != nil {
+		return err
+	}
+	if len(req.Hashes) == 0 {
+		return ErrInvalidDiscovery
+	}
+	if len(req.Hashes) > MaxDiscoveryHashesPerQueue {
+		return ErrTooManyHashes
+	}
+	hashes := make([][]byte, 0, len(req.Hashes))
+	for _, encoded := range req.Hashes {
+		hash, err := hex.DecodeString(encoded)
+		if err != nil || len(hash) != sha256.Size {
+			return ErrInvalidDiscovery
+		}
+		hashes = append(hashes, hash)
+	}
+	if duress {
+		return nil // A wiped queue is never made findable
+	}
+
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return err
+	}
+	m.withdrawDiscovery(ctx, queueID)
+
+	ttl := time.Until(queue.ExpiresAt)
+	pipe := m.redis.TxPipeline()
+	for _, hash := range hashes {
+		sealed, err := sealDiscovery(hash, queueID)
+		if err != nil {
+			return err
+		}
+		prefix := hex.EncodeToString(hash[:DiscoveryPrefixSize])
+		tag := hex.EncodeToString(hash[DiscoveryPrefixSize : DiscoveryPrefixSize+discoveryTagSize])
+		entryKey := discoveryEntryKey(prefix, tag)
+
+		pipe.Set(ctx, entryKey, sealed, ttl)
+		pipe.SAdd(ctx, discoveryBucketKey(prefix), entryKey)
+		pipe.SAdd(ctx, queueDiscoveryKey(queueID), entryKey)
+	}
+	pipe.ExpireAt(ctx, queueDiscoveryKey(queueID), queue.ExpiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to register discovery: %w", err)
+	}
+	return nil
+}
+
+// UnregisterDiscovery stops the queue being findable (requires admin)
+func (m *Manager) UnregisterDiscovery(ctx context.Context, queueID, accessToken string) error {
+	// Under duress the entries were withdrawn with the queue; again is harmless
+	if _, err := underDuress(m.authorize(ctx, queueID, accessToken, CapAdmin)); err != nil {
+		return err
+	}
+	m.withdrawDiscovery(ctx, queueID)
+	return nil
+}
+
+// withdrawDiscovery deletes a queue's entries; bucket sets drop them on
+// their next lookup
+func (m *Manager) withdrawDiscovery(ctx context.Context, queueID string) {
+	entryKeys, _ := m.redis.SMembers(ctx, queueDiscoveryKey(queueID)).Result()
+	if len(entryKeys) > 0 {
+		m.redis.Del(ctx, entryKeys...)
+	}
+	m.redis.Del(ctx, queueDiscoveryKey(queueID))
+}
+
+// LookupDiscovery returns every entry in the requested buckets
+// clientIP is allowed MaxDiscoveryLookupsPerHour lookups unless exempt
+// (an anonymous token was redeemed)
+func (m *Manager) LookupDiscovery(ctx context.Context, clientIP string, exempt bool, req DiscoveryLookupRequest) (*DiscoveryLookupResponse, error) {
+	if len(req.Prefixes) == 0 || len(req.Prefixes) > MaxDiscoveryPrefixes {
+		return nil, ErrInvalidDiscovery
+	}
+	for _, prefix := range req.Prefixes {
+		decoded, err := hex.DecodeString(prefix)
+		if err != nil || len(decoded) != DiscoveryPrefixSize || prefix != hex.EncodeToString(decoded) {
+			return nil, ErrInvalidDiscovery
+		}
+	}
+
+	if !exempt {
+		allowed, err := m.allowRate("discovery", clientIP, MaxDiscoveryLookupsPerHour, time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, ErrRateLimitExceeded
+		}
+	}
+
+	response := &DiscoveryLookupResponse{Buckets: make(map[string][]DiscoveryEntry, len(req.Prefixes))}
+	for _, prefix := range req.Prefixes {
+		entries, err := m.discoveryBucket(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		response.Buckets[prefix] = entries
+	}
+	return response, nil
+}
+
+// discoveryBucket loads one bucket, dropping entries whose queue is gone
+func (m *Manager) discoveryBucket(ctx context.Context, prefix string) ([]DiscoveryEntry, error) {
+	bucketKey := discoveryBucketKey(prefix)
+	entryKeys, err := m.redis.SMembers(ctx, bucketKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load discovery bucket: %w", err)
+	}
+
+	entries := []DiscoveryEntry{}
+	if len(entryKeys) == 0 {
+		return entries, nil
+	}
+	values, err := m.redis.MGet(ctx, entryKeys...).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to load discovery entries: %w", err)
+	}
+	tagStart := len(discoveryEntryKey(prefix, ""))
+	for i, value := range values {
+		sealed, ok := value.(string)
+		if !ok {
+			m.redis.SRem(ctx, bucketKey, entryKeys[i])
+			continue
+		}
+		entries = append(entries, DiscoveryEntry{
+			Tag:           entryKeys[i][tagStart:],
+			SealedQueueID: []byte(sealed),
+		})
+	}
+	return entries, nil
+}
+
+// sealDiscovery encrypts a queue ID under a key only the identifier's
+// full hash produces
+func sealDiscovery(hash []byte, queueID string) ([]byte, error) {
+	key := sha256.Sum256(append([]byte("privmsg-discovery-v1"), hash...))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to seal discovery entry: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seal discovery entry: %w", err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to seal discovery entry: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, []byte(queueID), nil), nil
+}
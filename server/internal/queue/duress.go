@@ -0,0 +1,219 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// duressError is what authorize returns for a duress token
+// Every operation answers it with a decoy, the way an intact queue holding
+// nothing would answer; anything that does not reads it as a missing queue
+type duressError struct{}
+
+func (duressError) Error() string        { return ErrQueueNotFound.Error() }
+func (duressError) Is(target error) bool { return target == ErrQueueNotFound }
+
+var errDuress error = duressError{}
+
+// underDuress separates authorize's duress answer from real failures, so
+// an operation can run its own validation before answering with a decoy
+func underDuress(err error) (bool, error) {
+	if err == errDuress {
+		return true, nil
+	}
+	return false, err
+}
+
+// duressDecoy is what a wiped queue goes on showing its duress token: the
+// lifetime and tokens it had, and whether it took send tokens
+type duressDecoy struct {
+	CreatedAt  time.Time   `json:"created_at"`
+	ExpiresAt  time.Time   `json:"expires_at"`
+	LastActive time.Time   `json:"last_active"`
+	SendToken  bool        `json:"send_token,omitempty"`
+	Tokens     []TokenInfo `json:"tokens"`
+}
+
+// issueDuressToken mints a token indistinguishable from the access token:
+// it is listed with the same scopes, but presenting it destroys the queue
+func (m *Manager) issueDuressToken(ctx context.Context, queueID string, ttl time.Duration) (string, error) {
+	duressToken, err := generateRandomID(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate duress token: %w", err)
+	}
+	record := tokenRecord{QueueID: queueID, Scopes: AllCapabilities, Duress: true}
+	if err := m.storeTokenRecord(ctx, duressToken, record, ttl); err != nil {
+		return "", err
+	}
+	return duressToken, nil
+}
+
+// wipeUnderDuress destroys a queue, its messages, tokens and farewell, then
+// keeps the duress token alone until the queue would have expired, holding
+// the decoy it answers with from then on
+func (m *Manager) wipeUnderDuress(ctx context.Context, queueID, duressToken string) {
+	tokenKey := fmt.Sprintf("token:%s", duressToken)
+	ttl, err := m.redis.TTL(ctx, tokenKey).Result()
+	if err != nil {
+		slog.Error("Failed to read duress token", "error", err)
+	}
+
+	decoy := &duressDecoy{ExpiresAt: time.Now().Add(ttl), Tokens: []TokenInfo{}}
+	if tokens, err := m.listTokens(ctx, queueID); err == nil {
+		decoy.Tokens = tokens
+	}
+	if queue, err := m.loadQueue(ctx, queueID); err == nil {
+		decoy.CreatedAt, decoy.ExpiresAt, decoy.LastActive = queue.CreatedAt, queue.ExpiresAt, queue.LastActive
+		decoy.SendToken = queue.SendToken != ""
+	}
+
+	m.purgeQueue(ctx, queueID)
+	m.redis.Del(ctx, farewellKey(queueID))
+
+	if ttl <= 0 {
+		return
+	}
+	data, err := json.Marshal(tokenRecord{QueueID: queueID, Scopes: AllCapabilities, Duress: true, Decoy: decoy})
+	if err != nil {
+		return
+	}
+	m.redis.Set(ctx, tokenKey, data, ttl)
+}
+
+// decoy returns what a duress token shows of its wiped queue
+func (m *Manager) decoy(ctx context.Context, duressToken string) *duressDecoy {
+	record, err := m.lookupToken(ctx, duressToken)
+	if err != nil || record == nil || record.Decoy == nil {
+		return &duressDecoy{Tokens: []TokenInfo{}}
+	}
+	return record.Decoy
+}
+
+// listed reports whether the decoy lists a token by its handle
+func (d *duressDecoy) listed(id string) bool {
+	return slices.ContainsFunc(d.Tokens, func(token TokenInfo) bool { return token.TokenID == id })
+}
+
+// mintDecoyToken answers a mint under duress with a token that is a decoy
+// of the same wiped queue, limited to the scopes asked for
+func (m *Manager) mintDecoyToken(ctx context.Context, queueID, duressToken string, scopes []Capability) (*MintTokenResponse, error) {
+	decoy := m.decoy(ctx, duressToken)
+	ttl := time.Until(decoy.ExpiresAt)
+	if ttl <= 0 {
+		return nil, ErrQueueNotFound
+	}
+
+	newToken, err := generateRandomID(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+	record := tokenRecord{QueueID: queueID, Scopes: scopes, Duress: true, Decoy: decoy}
+	if err := m.storeTokenRecord(ctx, newToken, record, ttl); err != nil {
+		return nil, err
+	}
+
+	return &MintTokenResponse{
+		TokenID:     tokenID(newToken),
+		AccessToken: newToken,
+		Scopes:      scopes,
+		ExpiresAt:   decoy.ExpiresAt,
+	}, nil
+}
+
+// revokeDecoyToken answers a revoke under duress for the tokens the wiped
+// queue had; handled is false for anything else, which RevokeToken looks up
+// in the index like any revoke
+// Revoking the presented token itself ends it, as it would on a live queue
+func (m *Manager) revokeDecoyToken(ctx context.Context, duressToken, revokeID string) (handled bool, err error) {
+	switch {
+	case revokeID == MacaroonsTokenID:
+		return true, nil
+	case revokeID == tokenID(duressToken):
+		return true, m.redis.Del(ctx, fmt.Sprintf("token:%s", duressToken)).Err()
+	case m.decoy(ctx, duressToken).listed(revokeID):
+		return true, nil
+	}
+	return false, nil
+}
+
+// decoySendLinks answers MintSendLinks under duress: links that look real
+// but were never stored, so sending with one finds no queue, as any send
+// to the wiped queue does
+func (m *Manager) decoySendLinks(ctx context.Context, queueID, duressToken string, req SendLinksRequest) (*SendLinksResponse, error) {
+	decoy := m.decoy(ctx, duressToken)
+	if !decoy.SendToken {
+		return nil, ErrSendLinksUnavailable
+	}
+	count := req.Count
+	if count == 0 {
+		count = 1
+	}
+	if count < 0 || count > MaxSendLinksPerRequest || req.TTLSeconds < 0 {
+		return nil, ErrInvalidSendLinks
+	}
+
+	expiresAt := decoy.ExpiresAt
+	if req.TTLSeconds > 0 {
+		if requested := time.Now().Add(time.Duration(req.TTLSeconds) * time.Second); requested.Before(expiresAt) {
+			expiresAt = requested
+		}
+	}
+	links := make([]SendLink, 0, count)
+	for i := 0; i < count; i++ {
+		token, err := generateRandomID(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate send link: %w", err)
+		}
+		links = append(links, SendLink{SendToken: token, ExpiresAt: expiresAt})
+	}
+	return &SendLinksResponse{
+		SendURL: fmt.Sprintf("/v1/queue/%s/send", queueID),
+		Links:   links,
+	}, nil
+}
+
+// decoyMembers answers AddMembers under duress with send tokens that were
+// never stored
+func (m *Manager) decoyMembers(ctx context.Context, duressToken string, req MembersRequest) (*MembersResponse, error) {
+	if !m.decoy(ctx, duressToken).SendToken {
+		return nil, ErrMembersUnavailable
+	}
+	count := req.Count
+	if count == 0 {
+		count = 1
+	}
+	if count < 0 || count > MaxMembersPerRequest {
+		return nil, ErrInvalidMembers
+	}
+
+	members := make([]Member, 0, count)
+	for i := 0; i < count; i++ {
+		token, err := generateRandomID(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate send token: %w", err)
+		}
+		members = append(members, Member{MemberID: memberID(token), SendToken: token})
+	}
+	return &MembersResponse{Members: members}, nil
+}
+
+// decoyElevation answers ElevateQueue under duress with the limits and
+// lifetime the voucher would have given the queue
+func (m *Manager) decoyElevation(ctx context.Context, duressToken string) *VoucherResponse {
+	queue := &Queue{ExpiresAt: m.decoy(ctx, duressToken).ExpiresAt}
+	queue.MaxMessages = max(m.messageLimit(queue), m.vouchers.MaxMessages)
+	queue.MaxMessageSize = max(m.sizeLimit(queue), m.vouchers.MaxMessageSize)
+	queue.Elevated = true
+	if expiresAt := time.Now().Add(m.vouchers.TTL); expiresAt.After(queue.ExpiresAt) {
+		queue.ExpiresAt = expiresAt
+	}
+	return &VoucherResponse{
+		ExpiresAt:      queue.ExpiresAt,
+		MaxMessages:    m.messageLimit(queue),
+		MaxMessageSize: m.sizeLimit(queue),
+	}
+}
@@ -0,0 +1,222 @@
+package queue
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestDuressAnswersLikeAnEmptyQueue runs every operation once with the
+// access token of a fresh, empty queue and once with the duress token of a
+// queue holding a message; both must answer alike, and the duress call must
+// wipe its queue
+func TestDuressAnswersLikeAnEmptyQueue(t *testing.T) {
+	m := testManager(t)
+	m.EnableJournal(time.Hour)
+	hash := sha256.Sum256([]byte("alice@example.com"))
+
+	tests := []struct {
+		name string
+		op   func(ctx context.Context, queueID, token string) error
+	}{
+		{"receive", func(ctx context.Context, queueID, token string) error {
+			received, err := m.ReceiveMessages(ctx, queueID, token, ReceiveOptions{})
+			if err == nil && len(received.Messages) > 0 {
+				return errors.New("messages received")
+			}
+			return err
+		}},
+		{"count", func(ctx context.Context, queueID, token string) error {
+			counted, err := m.CountMessages(ctx, queueID, token, ReceiveOptions{})
+			if err == nil && counted.Count > 0 {
+				return errors.New("messages counted")
+			}
+			return err
+		}},
+		{"get message", func(ctx context.Context, queueID, token string) error {
+			_, err := m.GetMessage(ctx, queueID, "missing", token)
+			return err
+		}},
+		{"info", func(ctx context.Context, queueID, token string) error {
+			info, err := m.QueueInfo(ctx, queueID, token)
+			if err == nil && info.MessageCount > 0 {
+				return errors.New("messages in info")
+			}
+			return err
+		}},
+		{"ack", func(ctx context.Context, queueID, token string) error {
+			return m.DeleteMessage(ctx, queueID, "missing", token)
+		}},
+		{"purge", func(ctx context.Context, queueID, token string) error {
+			purged, err := m.PurgeMessages(ctx, queueID, token)
+			if err == nil && purged.Purged > 0 {
+				return errors.New("messages purged")
+			}
+			return err
+		}},
+		{"list tokens", func(ctx context.Context, queueID, token string) error {
+			listed, err := m.ListTokens(ctx, queueID, token)
+			if err == nil && len(listed.Tokens) != 2 {
+				return errors.New("not the access and duress tokens")
+			}
+			return err
+		}},
+		{"mint token", func(ctx context.Context, queueID, token string) error {
+			_, err := m.MintToken(ctx, queueID, token, nil)
+			return err
+		}},
+		{"mint invalid scopes", func(ctx context.Context, queueID, token string) error {
+			_, err := m.MintToken(ctx, queueID, token, []Capability{"nonsense"})
+			return err
+		}},
+		{"revoke unknown token", func(ctx context.Context, queueID, token string) error {
+			return m.RevokeToken(ctx, queueID, token, "missing")
+		}},
+		{"send links", func(ctx context.Context, queueID, token string) error {
+			_, err := m.MintSendLinks(ctx, queueID, token, SendLinksRequest{Count: 2})
+			return err
+		}},
+		{"add members", func(ctx context.Context, queueID, token string) error {
+			_, err := m.AddMembers(ctx, queueID, token, MembersRequest{})
+			return err
+		}},
+		{"list members", func(ctx context.Context, queueID, token string) error {
+			_, err := m.ListMembers(ctx, queueID, token)
+			return err
+		}},
+		{"revoke member", func(ctx context.Context, queueID, token string) error {
+			return m.RevokeMember(ctx, queueID, token, "missing")
+		}},
+		{"set farewell", func(ctx context.Context, queueID, token string) error {
+			return m.SetFarewell(ctx, queueID, token, []byte("gone fishing"))
+		}},
+		{"empty farewell", func(ctx context.Context, queueID, token string) error {
+			return m.SetFarewell(ctx, queueID, token, nil)
+		}},
+		{"clear farewell", func(ctx context.Context, queueID, token string) error {
+			return m.ClearFarewell(ctx, queueID, token)
+		}},
+		{"presence", func(ctx context.Context, queueID, token string) error {
+			return m.SetPresence(ctx, queueID, token, true)
+		}},
+		{"set webhook", func(ctx context.Context, queueID, token string) error {
+			_, err := m.SetWebhook(ctx, queueID, token, WebhookRequest{URL: "https://hooks.example.com/in"})
+			return err
+		}},
+		{"get webhook", func(ctx context.Context, queueID, token string) error {
+			_, err := m.GetWebhook(ctx, queueID, token)
+			return err
+		}},
+		{"delete webhook", func(ctx context.Context, queueID, token string) error {
+			return m.DeleteWebhook(ctx, queueID, token)
+		}},
+		{"register push", func(ctx context.Context, queueID, token string) error {
+			_, err := m.RegisterPush(ctx, queueID, token, PushRequest{Platform: PushFCM, Token: "device"})
+			return err
+		}},
+		{"list push", func(ctx context.Context, queueID, token string) error {
+			_, err := m.ListPush(ctx, queueID, token)
+			return err
+		}},
+		{"unregister push", func(ctx context.Context, queueID, token string) error {
+			return m.UnregisterPush(ctx, queueID, token, "missing")
+		}},
+		{"register discovery", func(ctx context.Context, queueID, token string) error {
+			return m.RegisterDiscovery(ctx, queueID, token, DiscoveryRequest{Hashes: []string{hex.EncodeToString(hash[:])}})
+		}},
+		{"unregister discovery", func(ctx context.Context, queueID, token string) error {
+			return m.UnregisterDiscovery(ctx, queueID, token)
+		}},
+		{"upload prekeys", func(ctx context.Context, queueID, token string) error {
+			_, err := m.UploadPrekeys(ctx, queueID, token, PrekeyUploadRequest{IdentityKey: []byte("identity")})
+			return err
+		}},
+		{"prekey status", func(ctx context.Context, queueID, token string) error {
+			status, err := m.PrekeyStatus(ctx, queueID, token)
+			if err == nil && (status.IdentityKey || status.OneTimePrekeys > 0) {
+				return errors.New("prekeys reported")
+			}
+			return err
+		}},
+		{"journal", func(ctx context.Context, queueID, token string) error {
+			_, err := m.GetJournal(ctx, queueID, token)
+			return err
+		}},
+		{"delete queue", func(ctx context.Context, queueID, token string) error {
+			return m.DeleteQueue(ctx, queueID, token)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			req := CreateQueueRequest{RequireSendToken: true, DuressToken: true}
+
+			intact := createTestQueue(t, m, req)
+			want := tt.op(ctx, intact.QueueID, intact.AccessToken)
+
+			coerced := createTestQueue(t, m, req)
+			if _, err := m.SendMessage(ctx, coerced.QueueID, []byte("secret"), SendOptions{SendToken: coerced.SendToken}); err != nil {
+				t.Fatal(err)
+			}
+			got := tt.op(ctx, coerced.QueueID, coerced.DuressToken)
+			if !errors.Is(got, want) && !(got != nil && want != nil && got.Error() == want.Error()) {
+				t.Errorf("with the duress token: %v, with the access token: %v", got, want)
+			}
+
+			// The queue is gone for its owner and its senders
+			if _, err := m.ReceiveMessages(ctx, coerced.QueueID, coerced.AccessToken, ReceiveOptions{}); !errors.Is(err, ErrInvalidAccessToken) {
+				t.Errorf("receive with the access token after duress: %v, want %v", err, ErrInvalidAccessToken)
+			}
+			if _, err := m.SendMessage(ctx, coerced.QueueID, []byte("hello"), SendOptions{SendToken: coerced.SendToken}); !errors.Is(err, ErrQueueNotFound) {
+				t.Errorf("send after duress: %v, want %v", err, ErrQueueNotFound)
+			}
+		})
+	}
+}
+
+func TestDuressDecoyKeepsTheQueueShape(t *testing.T) {
+	m := testManager(t)
+	ctx := context.Background()
+	created := createTestQueue(t, m, CreateQueueRequest{DuressToken: true})
+	sendTestMessages(t, m, created.QueueID, 2)
+
+	info, err := m.QueueInfo(ctx, created.QueueID, created.DuressToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.MessageCount != 0 || !info.ExpiresAt.Equal(created.ExpiresAt) || info.CreatedAt.IsZero() {
+		t.Errorf("decoy info = %+v, want an empty queue expiring at %v", info, created.ExpiresAt)
+	}
+
+	// Tokens minted under duress are decoys with the scopes asked for
+	minted, err := m.MintToken(ctx, created.QueueID, created.DuressToken, []Capability{CapReceive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received, err := m.ReceiveMessages(ctx, created.QueueID, minted.AccessToken, ReceiveOptions{}); err != nil || len(received.Messages) != 0 {
+		t.Errorf("receive with a minted decoy = %v, %v", received, err)
+	}
+	if _, err := m.ListTokens(ctx, created.QueueID, minted.AccessToken); !errors.Is(err, ErrInsufficientScope) {
+		t.Errorf("admin call with a receive-only decoy: %v, want %v", err, ErrInsufficientScope)
+	}
+	listed, err := m.ListTokens(ctx, created.QueueID, created.DuressToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Tokens) != 3 {
+		t.Errorf("listed %d tokens, want the access, duress and minted ones", len(listed.Tokens))
+	}
+
+	// Deleting the queue with the duress token ends the decoy, as a delete would
+	if err := m.DeleteQueue(ctx, created.QueueID, created.DuressToken); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{created.DuressToken, minted.AccessToken} {
+		if _, err := m.ReceiveMessages(ctx, created.QueueID, token, ReceiveOptions{}); !errors.Is(err, ErrInvalidAccessToken) {
+			t.Errorf("receive after delete: %v, want %v", err, ErrInvalidAccessToken)
+		}
+	}
+}
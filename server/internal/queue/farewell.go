@@ -0,0 +1,94 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrFarewellTooLarge = errors.New("farewell payload too large")
+	ErrInvalidFarewell  = errors.New("farewell payload required")
+)
+
+const (
+	MaxFarewellSize   = 4 * 1024            // Farewells are a short encrypted note, not a message
+	FarewellRetention = 30 * 24 * time.Hour // How long a farewell outlives its queue
+)
+
+// FarewellRequest sets the payload senders receive once the queue is gone
+type FarewellRequest struct {
+	Payload []byte `json:"payload"` // Encrypted by the owner; opaque to the relay
+}
+
+// QueueGoneResponse is the send error body for a deleted or expired queue
+// that left a farewell behind
+type QueueGoneResponse struct {
+	Error    string `json:"error"`
+	Farewell []byte `json:"farewell"`
+}
+
+// QueueGoneError is returned instead of ErrQueueNotFound when the missing
+// queue left a farewell; it unwraps to ErrQueueNotFound
+type QueueGoneError struct {
+	Farewell []byte
+}
+
+func (e *QueueGoneError) Error() string { return ErrQueueNotFound.Error() }
+func (e *QueueGoneError) Unwrap() error { return ErrQueueNotFound }
+
+func farewellKey(queueID string) string {
+	return fmt.Sprintf("queue:%s:farewell", queueID)
+}
+
+// SetFarewell stores an encrypted note delivered to senders after the queue
+// is deleted or expires (requires admin)
+func (m *Manager) SetFarewell(ctx context.Context, queueID, accessToken string, payload []byte) error {
+	duress, err := underDuress(m.authorize(ctx, queueID, accessToken, CapAdmin))
+	if err != nil {
+		return err
+	}
+	if len(payload) == 0 {
+		return ErrInvalidFarewell
+	}
+	if len(payload) > MaxFarewellSize {
+		return ErrFarewellTooLarge
+	}
+	if duress {
+		return nil // Nobody is left to say farewell to
+	}
+
+	queue, err := m.loadQueue(ctx, queueID)
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Until(queue.ExpiresAt) + FarewellRetention
+	if err := m.redis.Set(ctx, farewellKey(queueID), payload, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store farewell: %w", err)
+	}
+	return nil
+}
+
+// ClearFarewell removes the queue's farewell (requires admin)
+func (m *Manager) ClearFarewell(ctx context.Context, queueID, accessToken string) error {
+	// Under duress the farewell is already gone, and clearing it again is harmless
+	if _, err := underDuress(m.authorize(ctx, queueID, accessToken, CapAdmin)); err != nil {
+		return err
+	}
+	if err := m.redis.Del(ctx, farewellKey(queueID)).Err(); err != nil {
+		return fmt.Errorf("failed to clear farewell: %w", err)
+	}
+	return nil
+}
+
+// queueGone returns the error for a send to a missing queue: a
+// QueueGoneError carrying the farewell if one was left, else ErrQueueNotFound
+func (m *Manager) queueGone(ctx context.Context, queueID string) error {
+	payload, err := m.redis.Get(ctx, farewellKey(queueID)).Bytes()
+	if err != nil {
+		return ErrQueueNotFound // Includes redis.Nil: no farewell was left
+	}
+	return &QueueGoneError{Farewell: payload}
+}
@@ -0,0 +1,50 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// healthProbeKey is written by readiness checks; it never holds user data
+const healthProbeKey = "health:probe"
+
+// CheckResult is the outcome of one readiness check
+type CheckResult struct {
+	OK        bool    `json:"ok"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"` // Generic; the cause is returned separately for logging
+	cause     error
+}
+
+// Cause returns the underlying error of a failed check
+func (c CheckResult) Cause() error {
+	return c.cause
+}
+
+// CheckReadiness reports whether Redis answers and accepts writes
+// A replica promoted away from, or an instance at maxmemory, still answers
+// PING but cannot store messages, hence the separate storage check
+func (m *Manager) CheckReadiness(ctx context.Context) map[string]CheckResult {
+	results := make(map[string]CheckResult, 2)
+
+	start := time.Now()
+	if err := m.redis.Ping(ctx).Err(); err != nil {
+		results["redis"] = CheckResult{Error: "ping failed", cause: err}
+		results["storage"] = CheckResult{Error: "not checked"}
+		return results
+	}
+	results["redis"] = CheckResult{OK: true, LatencyMS: elapsedMS(start)}
+
+	start = time.Now()
+	if err := m.redis.Set(ctx, healthProbeKey, start.Unix(), time.Minute).Err(); err != nil {
+		results["storage"] = CheckResult{Error: "write failed", cause: err}
+	} else {
+		results["storage"] = CheckResult{OK: true, LatencyMS: elapsedMS(start)}
+	}
+	return results
+}
+
+// elapsedMS returns the milliseconds elapsed since start
+func elapsedMS(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
@@ -0,0 +1,247 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"privmsg-relay/internal/blobstore"
+)
+
+// How long hibernating or waking holds the per-queue lock, and how long
+// wakers wait for it
+const (
+	wakeLockTTL  = 30 * time.Second
+	wakeWaitStep = 100 * time.Millisecond
+)
+
+// hibernatedQueue is the snapshot written to the blob store
+// Messages are kept as their stored JSON so nothing is re-encoded
+type hibernatedQueue struct {
+	QueueID  string            `json:"queue_id"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// EnableHibernation moves queues idle for longer than idleAfter to store,
+// leaving only the queue record (and its tokens) in Redis
+func (m *Manager) EnableHibernation(store blobstore.Store, idleAfter time.Duration) {
+	m.hibernateStore = store
+	m.hibernateAfter = idleAfter
+}
+
+func hibernateKey(queueID string) string {
+	return fmt.Sprintf("hibernate/%s", queueID)
+}
+
+// hibernateLockKey is held while a queue is hibernated or woken, so the two
+// never run over the same queue at once
+func hibernateLockKey(queueID string) string {
+	return fmt.Sprintf("queue:%s:waking", queueID)
+}
+
+// HibernateIdleQueues snapshots idle queues to the blob store and returns how many were hibernated
+func (m *Manager) HibernateIdleQueues() (int, error) {
+	if m.hibernateStore == nil {
+		return 0, nil
+	}
+
+	hibernated := 0
+	cutoff := time.Now().Add(-m.hibernateAfter)
+
+	iter := m.redis.Scan(m.ctx, 0, "queue:*", 500).Iterator()
+	for iter.Next(m.ctx) {
+		// Only queue records (queue:{id}), not queue:{id}:messages and friends
+		queueID := strings.TrimPrefix(iter.Val(), "queue:")
+		if strings.Contains(queueID, ":") {
+			continue
+		}
+
+		queue, err := m.loadQueue(m.ctx, queueID)
+		if err != nil {
+			continue
+		}
+		if queue.Hibernated || queue.LastActive.After(cutoff) {
+			continue
+		}
+
+		done, err := m.hibernate(queue.ID, cutoff)
+		if err != nil {
+			return hibernated, err
+		}
+		if done {
+			hibernated++
+		}
+	}
+
+	return hibernated, iter.Err()
+}
+
+// hibernate writes one queue's messages to the blob store and drops them
+// from Redis, unless it is being woken or was active since cutoff
+// Only the messages in the snapshot are dropped; any sent meanwhile stay
+func (m *Manager) hibernate(queueID string, cutoff time.Time) (bool, error) {
+	lockKey := hibernateLockKey(queueID)
+	acquired, err := m.redis.SetNX(m.ctx, lockKey, 1, wakeLockTTL).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to lock queue: %w", err)
+	}
+	if !acquired {
+		return false, nil // Being woken; it is not idle
+	}
+	defer m.redis.Del(m.ctx, lockKey)
+
+	queue, err := m.loadQueue(m.ctx, queueID)
+	if err != nil || queue.Hibernated || queue.LastActive.After(cutoff) {
+		return false, nil
+	}
+
+	listKey := fmt.Sprintf("queue:%s:messages", queue.ID)
+	messageIDs, err := m.redis.LRange(m.ctx, listKey, 0, -1).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to read message list: %w", err)
+	}
+
+	snapshot := hibernatedQueue{QueueID: queue.ID, Messages: []json.RawMessage{}}
+	var snapshotted []string
+	for _, msgID := range messageIDs {
+		messageKey := fmt.Sprintf("message:%s:%s", queue.ID, msgID)
+		messageData, err := m.redis.Get(m.ctx, messageKey).Result()
+		if err != nil {
+			continue // Expired
+		}
+		// Snapshots outlive data keys, so they hold messages unsealed
+		plaintext, err := m.open(m.ctx, messageKey, []byte(messageData))
+		if err != nil {
+			return false, fmt.Errorf("failed to open message: %w", err)
+		}
+		snapshot.Messages = append(snapshot.Messages, json.RawMessage(plaintext))
+		snapshotted = append(snapshotted, msgID)
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+
+	// Upload before deleting anything so a failed upload loses nothing
+	if err := m.hibernateStore.Put(m.ctx, hibernateKey(queue.ID), data); err != nil {
+		return false, fmt.Errorf("failed to store snapshot: %w", err)
+	}
+
+	queue.Hibernated = true
+	if err := m.updateQueue(m.ctx, queue); err != nil {
+		m.hibernateStore.Delete(m.ctx, hibernateKey(queue.ID))
+		if err == ErrQueueChanged || err == ErrQueueNotFound {
+			return false, nil // Changed or deleted under us; look again next sweep
+		}
+		return false, fmt.Errorf("failed to mark queue hibernated: %w", err)
+	}
+
+	pipe := m.redis.TxPipeline()
+	for _, msgID := range snapshotted {
+		pipe.Del(m.ctx, fmt.Sprintf("message:%s:%s", queue.ID, msgID))
+		pipe.LRem(m.ctx, listKey, 1, msgID)
+	}
+	_, err = pipe.Exec(m.ctx)
+	return err == nil, err
+}
+
+// wake restores a hibernated queue's messages into Redis
+// Concurrent callers wait for whoever holds the wake lock
+func (m *Manager) wake(ctx context.Context, queue *Queue) error {
+	if m.hibernateStore == nil {
+		return errors.New("queue is hibernated but no store is configured")
+	}
+
+	lockKey := hibernateLockKey(queue.ID)
+	acquired, err := m.redis.SetNX(ctx, lockKey, 1, wakeLockTTL).Result()
+	if err != nil {
+		return fmt.Errorf("failed to lock queue: %w", err)
+	}
+	if !acquired {
+		return m.waitForWake(ctx, queue)
+	}
+	defer m.redis.Del(ctx, lockKey)
+
+	// Someone may have finished waking it since it was loaded
+	current, err := m.loadQueue(ctx, queue.ID)
+	if err != nil {
+		return err
+	}
+	*queue = *current
+	if !queue.Hibernated {
+		return nil
+	}
+
+	data, err := m.hibernateStore.Get(ctx, hibernateKey(queue.ID))
+	if err != nil && err != blobstore.ErrNotFound {
+		return fmt.Errorf("failed to load snapshot: %w", err)
+	}
+
+	var snapshot hibernatedQueue
+	if err == nil {
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return fmt.Errorf("failed to parse snapshot: %w", err)
+		}
+	}
+
+	listKey := fmt.Sprintf("queue:%s:messages", queue.ID)
+	pipe := m.redis.TxPipeline()
+	for _, raw := range snapshot.Messages {
+		var message Message
+		if err := json.Unmarshal(raw, &message); err != nil {
+			continue
+		}
+
+		// Messages that expired while hibernated stay gone
+		ttl := time.Until(message.ExpiresAt)
+		if ttl <= 0 {
+			continue
+		}
+		messageKey := fmt.Sprintf("message:%s:%s", queue.ID, message.ID)
+		sealed, err := m.seal(messageKey, raw)
+		if err != nil {
+			return fmt.Errorf("failed to seal message: %w", err)
+		}
+		pipe.Set(ctx, messageKey, sealed, ttl)
+		pipe.RPush(ctx, listKey, message.ID)
+	}
+	pipe.ExpireAt(ctx, listKey, queue.ExpiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to restore messages: %w", err)
+	}
+
+	queue.Hibernated = false
+	if err := m.updateQueue(ctx, queue); err != nil {
+		return err
+	}
+
+	m.hibernateStore.Delete(ctx, hibernateKey(queue.ID))
+	return nil
+}
+
+// waitForWake blocks until another caller finishes waking the queue, or
+// wakes it itself once the lock is free and it is still hibernated (the
+// holder was hibernating it)
+func (m *Manager) waitForWake(ctx context.Context, queue *Queue) error {
+	deadline := time.Now().Add(wakeLockTTL)
+	for time.Now().Before(deadline) {
+		time.Sleep(wakeWaitStep)
+
+		current, err := m.loadQueue(ctx, queue.ID)
+		if err != nil {
+			return err
+		}
+		*queue = *current
+		if !queue.Hibernated {
+			return nil
+		}
+		if locked, err := m.redis.Exists(ctx, hibernateLockKey(queue.ID)).Result(); err == nil && locked == 0 {
+			return m.wake(ctx, queue)
+		}
+	}
+	return errors.New("timed out waiting for queue to wake")
+}
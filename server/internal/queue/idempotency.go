@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrInvalidIdempotencyKey  = errors.New("idempotency key must be 1 to 255 characters")
+	ErrIdempotencyKeyReused   = errors.New("idempotency key reused with a different payload")
+	ErrIdempotencyKeyInFlight = errors.New("a request with this idempotency key is in progress")
+)
+
+const (
+	IdempotencyKeyTTL     = time.Hour        // How long a completed send can be replayed
+	idempotencyPendingTTL = 30 * time.Second // Lock held while the first attempt runs
+	maxIdempotencyKeyLen  = 255
+	idempotencyPending    = "pending"
+)
+
+// idempotencyRecord is what a completed send leaves behind for replays
+type idempotencyRecord struct {
+	PayloadHash string               `json:"payload_sha256"`
+	Response    *SendMessageResponse `json:"response"`
+}
+
+// sendOnce is send keyed by a client-chosen Idempotency-Key: a retry
+// with the same key and payload returns the original response (with
+// Replayed set) instead of storing the message again
+func (m *Manager) sendOnce(ctx context.Context, queueID string, payload []byte, opts SendOptions) (*SendMessageResponse, error) {
+	idempotencyKey, sendToken := opts.IdempotencyKey, opts.SendToken
+	if idempotencyKey == "" || len(idempotencyKey) > maxIdempotencyKeyLen {
+		return nil, ErrInvalidIdempotencyKey
+	}
+
+	// Keys are hashed with the send token, so a replay needs the same credential
+	// and arbitrary client strings never end up in key names
+	sum := sha256.Sum256([]byte(sendToken + "\x00" + idempotencyKey))
+	key := fmt.Sprintf("idempotency:%s:%s", queueID, hex.EncodeToString(sum[:]))
+	payloadHash := PayloadHash(payload)
+
+	// Take the lock, or find the earlier attempt's outcome
+	acquired, err := m.redis.SetNX(ctx, key, idempotencyPending, idempotencyPendingTTL).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	if !acquired {
+		return m.replayIdempotent(ctx, key, payloadHash)
+	}
+
+	response, err := m.send(ctx, queueID, payload, opts)
+	if err != nil {
+		// Failed sends are not remembered, so the client can retry them
+		m.redis.Del(ctx, key)
+		return nil, err
+	}
+
+	data, err := json.Marshal(idempotencyRecord{PayloadHash: payloadHash, Response: response})
+	if err == nil {
+		err = m.redis.Set(ctx, key, data, IdempotencyKeyTTL).Err()
+	}
+	if err != nil {
+		// The message is stored; losing the record only weakens a later replay
+		m.redis.Del(ctx, key)
+	}
+	return response, nil
+}
+
+// replayIdempotent returns the stored response for a key that is already taken
+func (m *Manager) replayIdempotent(ctx context.Context, key, payloadHash string) (*SendMessageResponse, error) {
+	data, err := m.redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		// The first attempt failed and released the key between our calls
+		return nil, ErrIdempotencyKeyInFlight
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read idempotency key: %w", err)
+	}
+	if data == idempotencyPending {
+		return nil, ErrIdempotencyKeyInFlight
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal([]byte(data), &record); err != nil || record.Response == nil {
+		return nil, fmt.Errorf("failed to unmarshal idempotency record: %w", err)
+	}
+	if record.PayloadHash != payloadHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	record.Response.Replayed = true
+	return record.Response, nil
+}
@@ -0,0 +1,14 @@
+package queue
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// PayloadHash returns the hex SHA-256 of a payload as stored at send time
+// Receivers compare it against the bytes they got back to catch corruption
+// or truncation before attempting decryption
+func PayloadHash(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
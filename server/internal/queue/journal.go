@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// JournalEventType is a protocol-level event recorded for delivery debugging
+type JournalEventType string
+
+const (
+	EventStored   JournalEventType = "stored"   // Message accepted and persisted
+	EventNotified JournalEventType = "notified" // Message pushed to a WebSocket subscriber
+	EventFetched  JournalEventType = "fetched"  // Message returned by a receive call
+	EventAcked    JournalEventType = "acked"    // Message deleted by the owner
+	EventPosted   JournalEventType = "posted"   // Message accepted by the queue's webhook
+	EventExpired  JournalEventType = "expired"  // Message found expired before it was acked
+)
+
+// maxJournalEvents caps the journal length per queue
+const maxJournalEvents = 1000
+
+// JournalEvent records that something happened to a message
+// Only IDs and timestamps are kept - never payloads, IPs or tokens
+type JournalEvent struct {
+	Type      JournalEventType `json:"type"`
+	MessageID string           `json:"message_id"`
+	At        time.Time        `json:"at"`
+}
+
+// JournalResponse is returned when the owner queries the journal
+type JournalResponse struct {
+	Events    []JournalEvent `json:"events"`
+	Retention int64          `json:"retention_seconds"`
+}
+
+// EnableJournal turns on event journaling with the given retention
+func (m *Manager) EnableJournal(retention time.Duration) {
+	m.journalRetention = retention
+}
+
+// RecordEvent advances the message's status and appends an event
+// to the queue's journal (each a no-op when disabled)
+func (m *Manager) RecordEvent(queueID string, eventType JournalEventType, messageID string) {
+	m.advanceStatus(queueID, eventType, messageID)
+	if m.journalRetention <= 0 {
+		return
+	}
+
+	data, err := json.Marshal(JournalEvent{
+		Type:      eventType,
+		MessageID: messageID,
+		At:        time.Now(),
+	})
+	if err != nil {
+		return
+	}
+
+	journalKey := fmt.Sprintf("queue:%s:journal", queueID)
+	pipe := m.redis.TxPipeline()
+	pipe.RPush(m.ctx, journalKey, data)
+	pipe.LTrim(m.ctx, journalKey, -maxJournalEvents, -1)
+	pipe.Expire(m.ctx, journalKey, m.journalRetention)
+	pipe.Exec(m.ctx)
+}
+
+// GetJournal returns the queue's recent events (requires valid access token)
+func (m *Manager) GetJournal(ctx context.Context, queueID, accessToken string) (*JournalResponse, error) {
+	if m.journalRetention <= 0 {
+		return nil, ErrJournalDisabled
+	}
+
+	// Verify access token grants receive; under duress the journal was
+	// wiped with the queue, so it reads as empty
+	if _, err := underDuress(m.authorize(ctx, queueID, accessToken, CapReceive)); err != nil {
+		return nil, err
+	}
+
+	journalKey := fmt.Sprintf("queue:%s:journal", queueID)
+	entries, err := m.redis.LRange(ctx, journalKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	// Drop anything older than retention (the list TTL is refreshed on every write)
+	cutoff := time.Now().Add(-m.journalRetention)
+	events := []JournalEvent{}
+	for _, entry := range entries {
+		var event JournalEvent
+		if err := json.Unmarshal([]byte(entry), &event); err != nil {
+			continue
+		}
+		if event.At.Before(cutoff) {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	return &JournalResponse{
+		Events:    events,
+		Retention: int64(m.journalRetention / time.Second),
+	}, nil
+}
@@ -0,0 +1,130 @@
+package queue
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidQueueLimits = errors.New("invalid queue limits")
+)
+
+// Bounds on what clients may request at queue creation
+const (
+	MinQueueTTL        = time.Hour           // Shortest lifetime a client may request
+	DefaultMaxQueueTTL = 30 * 24 * time.Hour // Longest lifetime unless configured otherwise
+	MinMessageSize     = 1024                // Smallest max_message_size a client may request
+)
+
+// SetMessageMaxTTL caps how long any message may live, including sender-chosen TTLs
+func (m *Manager) SetMessageMaxTTL(maxTTL time.Duration) {
+	if maxTTL > 0 {
+		m.maxMessageTTL = maxTTL
+	}
+}
+
+// SetMessageTTL sets how long messages live when the sender doesn't say
+func (m *Manager) SetMessageTTL(ttl time.Duration) {
+	if ttl > 0 {
+		m.defaultMessageTTL = ttl
+	}
+}
+
+// messageTTL resolves a sender-requested lifetime (0 = default) against the server cap
+func (m *Manager) messageTTL(requested time.Duration) time.Duration {
+	ttl := m.defaultMessageTTL
+	if requested > 0 {
+		ttl = requested
+	}
+	return min(ttl, m.maxMessageTTL)
+}
+
+// SetQueueLimits sets the server maximums for client-requested queue options
+// Zero values keep the defaults
+func (m *Manager) SetQueueLimits(maxTTL time.Duration, maxMessages, maxMessageSize int) {
+	if maxTTL > 0 {
+		m.maxQueueTTL = maxTTL
+	}
+	if maxMessages > 0 {
+		m.maxMessages = maxMessages
+	}
+	if maxMessageSize > 0 {
+		m.maxMessageSize = maxMessageSize
+	}
+}
+
+// SetQueueDefaults sets the options a queue gets when its creator leaves
+// them unset; they are still clamped to the server maximums
+// Zero values keep the built-in defaults
+func (m *Manager) SetQueueDefaults(ttl time.Duration, maxMessages, maxMessageSize int) {
+	if ttl > 0 {
+		m.defaultQueueTTL = ttl
+	}
+	if maxMessages > 0 {
+		m.defaultMaxMessages = maxMessages
+	}
+	if maxMessageSize > 0 {
+		m.defaultMaxMessageSize = maxMessageSize
+	}
+}
+
+// MaxMessageSize is the largest payload any queue accepts, counting queues
+// a voucher was redeemed for
+func (m *Manager) MaxMessageSize() int {
+	if m.vouchers != nil {
+		return max(m.maxMessageSize, m.vouchers.MaxMessageSize)
+	}
+	return m.maxMessageSize
+}
+
+// resolveLimits validates requested options and clamps them to server maximums
+func (m *Manager) resolveLimits(req CreateQueueRequest) (ttl time.Duration, maxMessages, maxMessageSize int, err error) {
+	if req.TTL < 0 || req.MaxMessages < 0 || req.MaxMessageSize < 0 {
+		return 0, 0, 0, ErrInvalidQueueLimits
+	}
+
+	ttl = m.defaultQueueTTL
+	if req.TTL > 0 {
+		ttl = time.Duration(req.TTL) * time.Second
+	}
+	ttl = max(MinQueueTTL, min(ttl, m.maxQueueTTL))
+
+	maxMessages = m.defaultMaxMessages
+	if req.MaxMessages > 0 {
+		maxMessages = req.MaxMessages
+	}
+	maxMessages = min(maxMessages, m.maxMessages)
+
+	maxMessageSize = m.defaultMaxMessageSize
+	if req.MaxMessageSize > 0 {
+		maxMessageSize = req.MaxMessageSize
+	}
+	maxMessageSize = max(MinMessageSize, min(maxMessageSize, m.maxMessageSize))
+
+	return ttl, maxMessages, maxMessageSize, nil
+}
+
+// messageLimit is the effective message cap for a queue
+// Queues created before per-queue limits fall back to the server defaults
+func (m *Manager) messageLimit(queue *Queue) int {
+	limit := queue.MaxMessages
+	if limit == 0 {
+		limit = m.defaultMaxMessages
+	}
+	if queue.Elevated && m.vouchers != nil {
+		return min(limit, max(m.maxMessages, m.vouchers.MaxMessages))
+	}
+	return min(limit, m.maxMessages)
+}
+
+// sizeLimit is the effective payload size cap for a queue
+func (m *Manager) sizeLimit(queue *Queue) int {
+	limit := queue.MaxMessageSize
+	if limit == 0 {
+		limit = m.defaultMaxMessageSize
+	}
+	if queue.Elevated && m.vouchers != nil {
+		return min(limit, max(m.maxMessageSize, m.vouchers.MaxMessageSize))
+	}
+	return min(limit, m.maxMessageSize)
+}
@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"privmsg-relay/internal/macaroon"
+)
+
+var (
+	ErrMacaroonsDisabled = errors.New("macaroons disabled")
+	ErrMacaroonMinting   = errors.New("macaroons cannot mint or revoke credentials, use an access token")
+)
+
+// Caveats understood by the relay:
+//
+//	time < 2026-01-02T15:04:05Z   valid until the given instant (plus the clock skew allowance)
+//	op = receive,send             only for the listed capabilities
+//
+// A macaroon never mints or revokes credentials, even with admin: tokens,
+// send links, members and macaroons are issued to access token holders only
+const (
+	caveatTime = "time < "
+	caveatOp   = "op = "
+)
+
+// MacaroonResponse carries a queue's root macaroon
+type MacaroonResponse struct {
+	Macaroon string `json:"macaroon"`
+}
+
+// EnableMacaroons turns on macaroon verification; secret must stay stable
+// across restarts and replicas or outstanding macaroons stop verifying
+func (m *Manager) EnableMacaroons(secret []byte) {
+	m.macaroonSecret = secret
+}
+
+// macaroonRootKey derives the per-queue root key from the queue's macaroon
+// generation; bumping the generation revokes every macaroon minted before
+func (m *Manager) macaroonRootKey(queue *Queue) []byte {
+	h := hmac.New(sha256.New, m.macaroonSecret)
+	h.Write([]byte("queue:" + queue.ID))
+	if queue.MacaroonGeneration > 0 {
+		h.Write([]byte(":generation:" + strconv.Itoa(queue.MacaroonGeneration)))
+	}
+	return h.Sum(nil)
+}
+
+// rootMacaroon mints a caveat-free macaroon granting every capability
+func (m *Manager) rootMacaroon(queue *Queue) string {
+	return macaroon.New(m.macaroonRootKey(queue), queue.ID).Encode()
+}
+
+// revokeMacaroons invalidates every macaroon of a queue, root or attenuated
+func (m *Manager) revokeMacaroons(ctx context.Context, queueID string) error {
+	_, err := m.changeQueue(ctx, queueID, func(queue *Queue) error {
+		queue.MacaroonGeneration++
+		return m.updateQueue(ctx, queue)
+	})
+	return err
+}
+
+// authorizeMinting checks accessToken may mint or revoke credentials: it
+// must grant admin and must not be a macaroon. Nothing minted carries the
+// caller's caveats, so a macaroon holder could otherwise shed them all,
+// expiry included
+func (m *Manager) authorizeMinting(ctx context.Context, queueID, accessToken string) error {
+	if err := m.authorize(ctx, queueID, accessToken, CapAdmin); err != nil {
+		return err
+	}
+	if m.macaroonSecret != nil && macaroon.Is(accessToken) {
+		return ErrMacaroonMinting
+	}
+	return nil
+}
+
+// IssueMacaroon returns the root macaroon for a queue to an admin token holder
+func (m *Manager) IssueMacaroon(ctx context.Context, queueID, accessToken string) (*MacaroonResponse, error) {
+	if m.macaroonSecret == nil {
+		return nil, ErrMacaroonsDisabled
+	}
+
+	// Verify access token grants admin and is not itself a macaroon; under
+	// duress the macaroon is well formed but its queue is gone
+	if err := m.authorizeMinting(ctx, queueID, accessToken); err == errDuress {
+		return &MacaroonResponse{Macaroon: m.rootMacaroon(&Queue{ID: queueID})}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MacaroonResponse{Macaroon: m.rootMacaroon(queue)}, nil
+}
+
+// verifyMacaroon checks a macaroon bearer token for queue and capability
+func (m *Manager) verifyMacaroon(queue *Queue, token string, capability Capability) error {
+	mac, err := macaroon.Decode(token)
+	if err != nil || mac.ID != queue.ID {
+		return ErrInvalidAccessToken
+	}
+
+	err = mac.Verify(m.macaroonRootKey(queue), func(caveat string) error {
+		switch {
+		case strings.HasPrefix(caveat, caveatTime):
+			deadline, err := time.Parse(time.RFC3339, strings.TrimPrefix(caveat, caveatTime))
+			if err != nil || !m.beforeDeadline(deadline) {
+				return ErrInvalidAccessToken
+			}
+		case strings.HasPrefix(caveat, caveatOp):
+			for _, op := range strings.Split(strings.TrimPrefix(caveat, caveatOp), ",") {
+				if Capability(strings.TrimSpace(op)) == capability {
+					return nil
+				}
+			}
+			return ErrInsufficientScope
+		default:
+			// Unknown caveats fail closed
+			return ErrInvalidAccessToken
+		}
+		return nil
+	})
+	if err == macaroon.ErrBadSignature {
+		return ErrInvalidAccessToken
+	}
+	return err
+}
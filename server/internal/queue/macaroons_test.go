@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"privmsg-relay/internal/macaroon"
+)
+
+var testMacaroonSecret = []byte("test-macaroon-secret-0123456789ab")
+
+// attenuate narrows a macaroon, failing the test if it cannot be decoded
+func attenuate(t *testing.T, token string, caveats ...string) string {
+	t.Helper()
+	narrowed, err := macaroon.Attenuate(token, caveats...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return narrowed
+}
+
+func TestVerifyMacaroon(t *testing.T) {
+	m := NewManager(nil)
+	m.EnableMacaroons(testMacaroonSecret)
+	queue := &Queue{ID: "4f1d0c9a6b2e8d7f"}
+	root := m.rootMacaroon(queue)
+	future := caveatTime + time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	past := caveatTime + time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	other := &Queue{ID: "9e8d7c6b5a4f3e2d"}
+	revoked := &Queue{ID: queue.ID, MacaroonGeneration: 1}
+
+	tests := []struct {
+		name       string
+		queue      *Queue
+		token      string
+		capability Capability
+		want       error
+	}{
+		{"root", queue, root, CapAdmin, nil},
+		{"op allows", queue, attenuate(t, root, caveatOp+"receive,send"), CapSend, nil},
+		{"op forbids", queue, attenuate(t, root, caveatOp+"receive"), CapSend, ErrInsufficientScope},
+		{"before deadline", queue, attenuate(t, root, future), CapReceive, nil},
+		{"after deadline", queue, attenuate(t, root, past), CapReceive, ErrInvalidAccessToken},
+		{"bad deadline", queue, attenuate(t, root, caveatTime+"tomorrow"), CapReceive, ErrInvalidAccessToken},
+		{"unknown caveat", queue, attenuate(t, root, "ip = 203.0.113.7"), CapReceive, ErrInvalidAccessToken},
+		{"other queue", other, root, CapReceive, ErrInvalidAccessToken},
+		{"revoked generation", revoked, root, CapReceive, ErrInvalidAccessToken},
+		{"not a macaroon", queue, "opaque-access-token", CapReceive, ErrInvalidAccessToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.verifyMacaroon(tt.queue, tt.token, tt.capability); err != tt.want {
+				t.Errorf("verifyMacaroon() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMacaroonCannotMintPastItsDeadline(t *testing.T) {
+	m := testManager(t)
+	m.EnableMacaroons(testMacaroonSecret)
+	ctx := context.Background()
+	created := createTestQueue(t, m, CreateQueueRequest{RequireSendToken: true})
+
+	root, err := m.IssueMacaroon(ctx, created.QueueID, created.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	limited := attenuate(t, root.Macaroon, caveatTime+deadline)
+
+	// Good for admin work until the deadline
+	if _, err := m.ListTokens(ctx, created.QueueID, limited); err != nil {
+		t.Fatalf("ListTokens() with a live macaroon: %v", err)
+	}
+
+	// But nothing it could mint would carry the deadline, so it mints nothing
+	mints := []struct {
+		name string
+		mint func() error
+	}{
+		{"access token", func() error {
+			_, err := m.MintToken(ctx, created.QueueID, limited, []Capability{CapAdmin})
+			return err
+		}},
+		{"root macaroon", func() error {
+			_, err := m.IssueMacaroon(ctx, created.QueueID, limited)
+			return err
+		}},
+		{"send links", func() error {
+			_, err := m.MintSendLinks(ctx, created.QueueID, limited, SendLinksRequest{Count: 1})
+			return err
+		}},
+		{"members", func() error {
+			_, err := m.AddMembers(ctx, created.QueueID, limited, MembersRequest{Count: 1})
+			return err
+		}},
+		{"revoke", func() error {
+			return m.RevokeToken(ctx, created.QueueID, limited, MacaroonsTokenID)
+		}},
+	}
+	for _, tt := range mints {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.mint(); !errors.Is(err, ErrMacaroonMinting) {
+				t.Errorf("error = %v, want %v", err, ErrMacaroonMinting)
+			}
+		})
+	}
+
+	// The access token itself still mints
+	if _, err := m.MintToken(ctx, created.QueueID, created.AccessToken, nil); err != nil {
+		t.Errorf("MintToken() with the access token: %v", err)
+	}
+}
@@ -2,45 +2,153 @@ package queue
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"time"
 
+	"privmsg-relay/internal/atrest"
+	"privmsg-relay/internal/blobstore"
+	"privmsg-relay/internal/macaroon"
+
 	"github.com/redis/go-redis/v9"
 )
 
 var (
 	ErrQueueNotFound      = errors.New("queue not found")
 	ErrInvalidAccessToken = errors.New("invalid access token")
+	ErrInvalidSendToken   = errors.New("invalid send token")
 	ErrQueueFull          = errors.New("queue is full")
 	ErrMessageTooLarge    = errors.New("message too large")
 	ErrRateLimitExceeded  = errors.New("rate limit exceeded")
+	ErrJournalDisabled    = errors.New("event journal disabled")
+	ErrMessageNotFound    = errors.New("message not found")
+	ErrQueueChanged       = errors.New("queue changed concurrently, retry")
 )
 
 // Manager handles queue and message operations
 type Manager struct {
 	redis *redis.Client
 	ctx   context.Context
+
+	journalRetention time.Duration // Zero disables the event journal
+	receiptRetention time.Duration // How long status records outlive their message (0 = no tracking)
+	region           string        // Home-region tag embedded in new queue IDs
+
+	// Archival tier for cold and large payloads (nil = everything stays in Redis)
+	archive      blobstore.Store
+	archiveAfter time.Duration // Spill payloads older than this (0 = never)
+	offloadAbove int           // Store payloads larger than this in the blob store at send (0 = never)
+
+	// Hibernation tier for idle queues (nil = disabled)
+	hibernateStore blobstore.Store
+	hibernateAfter time.Duration
+
+	// Server secret for macaroon root keys (nil = macaroons rejected)
+	macaroonSecret []byte
+
+	// Signing key for operator notices (nil = notices disabled)
+	noticeKey ed25519.PrivateKey
+
+	// Signing key for GET /time (nil = disabled) and tolerance for client clocks
+	timeKey   ed25519.PrivateKey
+	clockSkew time.Duration
+
+	// Signing key for key transparency tree heads (nil = log disabled)
+	transparencyKey ed25519.PrivateKey
+
+	// Data keys sealing queue records and messages in Redis (nil = plaintext)
+	// and the key-encryption keys they are wrapped with, by ID
+	atRest     *atrest.Keyring
+	atRestKEK  atrest.KeyWrapper
+	atRestKEKs map[string]atrest.KeyWrapper
+
+	// Attribute queues to operator-issued tenant API keys, and the quota
+	// tiers tenants can be put on
+	tenancy     bool
+	tiers       map[string]Tier
+	defaultTier string
+
+	// Limits a redeemed voucher raises a queue to (nil = vouchers disabled)
+	vouchers *VoucherLimits
+
+	// Server defaults for options clients leave unset
+	defaultQueueTTL       time.Duration
+	defaultMessageTTL     time.Duration
+	defaultMaxMessages    int
+	defaultMaxMessageSize int
+
+	// Server maximums for client-requested queue options
+	maxQueueTTL    time.Duration
+	maxMessages    int
+	maxMessageSize int
+	maxMessageTTL  time.Duration
+
+	// Longest a mixed-delivery batch is held (0 = mixed delivery disabled)
+	mixMaxDelay time.Duration
+
+	// Aggregate stats for the operator console
+	stats statsCache
+
+	// Server-wide quotas and the usage they are checked against
+	quotas     Quotas
+	quotaUsage quotaUsage
 }
 
 // NewManager creates a new queue manager with Redis storage
 func NewManager(redisClient *redis.Client) *Manager {
 	return &Manager{
-		redis: redisClient,
-		ctx:   context.Background(),
+		redis:          redisClient,
+		ctx:            context.Background(),
+		maxQueueTTL:    DefaultMaxQueueTTL,
+		maxMessages:    MaxMessagesInQueue,
+		maxMessageSize: MaxMessageSize,
+		maxMessageTTL:  MessageTTL,
+		clockSkew:      DefaultClockSkew,
+
+		defaultQueueTTL:       QueueTTL,
+		defaultMessageTTL:     MessageTTL,
+		defaultMaxMessages:    MaxMessagesInQueue,
+		defaultMaxMessageSize: MaxMessageSize,
 	}
 }
 
 // CreateQueue creates a new message queue with random ID and access token
-func (m *Manager) CreateQueue() (*CreateQueueResponse, error) {
+func (m *Manager) CreateQueue(ctx context.Context, req CreateQueueRequest) (*CreateQueueResponse, error) {
+	if err := m.checkMaintenance(ctx, true); err != nil {
+		return nil, err
+	}
+	if err := m.checkCreateQuota(); err != nil {
+		return nil, err
+	}
+	if req.TenantID != "" {
+		if err := m.checkTenantQuota(ctx, req.TenantID, -1); err != nil {
+			return nil, err
+		}
+	}
+
+	ttl, maxMessages, maxMessageSize, err := m.resolveLimits(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Broadcast && req.BurnAfterRead {
+		return nil, ErrInvalidBroadcast
+	}
+	if req.MixDelivery && m.mixMaxDelay <= 0 {
+		return nil, ErrMixUnavailable
+	}
+
 	// Generate random 256-bit queue ID
 	queueID, err := generateRandomID(32) // 32 bytes = 256 bits
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate queue ID: %w", err)
 	}
+	queueID = m.withRegion(queueID)
 
 	// Generate random access token
 	accessToken, err := generateRandomID(32)
@@ -48,8 +156,18 @@ func (m *Manager) CreateQueue() (*CreateQueueResponse, error) {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
+	// Generate send token if the owner wants authenticated sends; a
+	// broadcast queue's only writer is whoever holds it
+	var sendToken string
+	if req.RequireSendToken || req.Broadcast {
+		sendToken, err = generateRandomID(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate send token: %w", err)
+		}
+	}
+
 	now := time.Now()
-	expiresAt := now.Add(QueueTTL)
+	expiresAt := now.Add(ttl)
 
 	queue := &Queue{
 		ID:          queueID,
@@ -58,57 +176,145 @@ func (m *Manager) CreateQueue() (*CreateQueueResponse, error) {
 		CreatedAt:   now,
 		ExpiresAt:   expiresAt,
 		LastActive:  now,
+		SendToken:   sendToken,
+
+		BurnAfterRead:  req.BurnAfterRead,
+		Broadcast:      req.Broadcast,
+		SealedSender:   req.SealedSender,
+		MixDelivery:    req.MixDelivery,
+		MaxMessages:    maxMessages,
+		MaxMessageSize: maxMessageSize,
+		TenantID:       req.TenantID,
 	}
 
 	// Store queue in Redis
 	queueKey := fmt.Sprintf("queue:%s", queueID)
-	queueData, err := json.Marshal(queue)
+	queueData, err := m.encode(queueKey, queue)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal queue: %w", err)
 	}
 
 	// Set with TTL
-	err = m.redis.Set(m.ctx, queueKey, queueData, QueueTTL).Err()
+	err = m.redis.Set(ctx, queueKey, queueData, ttl).Err()
 	if err != nil {
 		return nil, fmt.Errorf("failed to store queue: %w", err)
 	}
 
 	// Store access token mapping (for authentication)
-	tokenKey := fmt.Sprintf("token:%s", accessToken)
-	err = m.redis.Set(m.ctx, tokenKey, queueID, QueueTTL).Err()
-	if err != nil {
-		return nil, fmt.Errorf("failed to store access token: %w", err)
+	if err := m.storeToken(ctx, queueID, accessToken, AllCapabilities, ttl); err != nil {
+		return nil, err
+	}
+	if queue.TenantID != "" {
+		m.trackTenantQueue(ctx, queue)
+		m.meterTenant(ctx, queue.TenantID, 1, 0, 0)
+	}
+	var duressToken string
+	if req.DuressToken {
+		if duressToken, err = m.issueDuressToken(ctx, queueID, ttl); err != nil {
+			return nil, err
+		}
 	}
 
-	return &CreateQueueResponse{
+	resp := &CreateQueueResponse{
 		QueueID:     queueID,
 		AccessToken: accessToken,
-		QueueURL:    fmt.Sprintf("/queue/%s", queueID),
+		SendToken:   sendToken,
+		DuressToken: duressToken,
+		QueueURL:    fmt.Sprintf("/v1/queue/%s", queueID),
 		ExpiresAt:   expiresAt,
-	}, nil
+
+		MaxMessages:    maxMessages,
+		MaxMessageSize: maxMessageSize,
+	}
+	if m.macaroonSecret != nil {
+		resp.Macaroon = m.rootMacaroon(queue)
+	}
+	return resp, nil
 }
 
 // SendMessage sends an encrypted message to a queue
-func (m *Manager) SendMessage(queueID string, payload []byte) (*SendMessageResponse, error) {
-	// Validate payload size
-	if len(payload) > MaxMessageSize {
+func (m *Manager) SendMessage(ctx context.Context, queueID string, payload []byte, opts SendOptions) (*SendMessageResponse, error) {
+	if !opts.Priority.valid() {
+		return nil, ErrInvalidPriority
+	}
+	if opts.IdempotencyKey != "" {
+		return m.sendOnce(ctx, queueID, payload, opts)
+	}
+	return m.send(ctx, queueID, payload, opts)
+}
+
+// send stores one message
+// opts.SendToken is only checked for queues created with RequireSendToken;
+// opts.TTL sets the message lifetime (0 = server default), capped by the
+// server maximum
+func (m *Manager) send(ctx context.Context, queueID string, payload []byte, opts SendOptions) (*SendMessageResponse, error) {
+	sendToken := opts.SendToken
+	// Reject anything over the server maximum before touching Redis
+	if len(payload) > m.MaxMessageSize() {
+		return nil, ErrMessageTooLarge
+	}
+
+	// Check if queue exists (a deleted or expired queue may have left a farewell)
+	queue, err := m.getQueue(ctx, queueID)
+	if err == ErrQueueNotFound {
+		return nil, m.queueGone(ctx, queueID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate payload size against the queue's own limit
+	if len(payload) > m.sizeLimit(queue) {
 		return nil, ErrMessageTooLarge
 	}
 
-	// Check if queue exists
-	queue, err := m.getQueue(queueID)
+	if queue.SealedSender {
+		if err := checkSealedEnvelope(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	// Frozen queues accept nothing new
+	if queue.Frozen {
+		return nil, ErrQueueFrozen
+	}
+	if err := m.checkMaintenance(ctx, false); err != nil {
+		return nil, err
+	}
+
+	// Check send authorization
+	viaSendLink, member, err := m.checkSendToken(ctx, queue, sendToken)
 	if err != nil {
 		return nil, err
 	}
 
+	// A member token still authorizes the send, but on a sealed-sender
+	// queue the message must not say which member it came from
+	if queue.SealedSender {
+		member = ""
+	}
+
 	// Check if queue is full
-	messageCount, err := m.getMessageCount(queueID)
+	messageCount, err := m.getMessageCount(ctx, queueID)
 	if err != nil {
 		return nil, err
 	}
-	if messageCount >= MaxMessagesInQueue {
+	if messageCount >= m.messageLimit(queue) {
 		return nil, ErrQueueFull
 	}
+	if err := m.checkSendQuota(ctx, len(payload)); err != nil {
+		return nil, err
+	}
+	if queue.TenantID != "" {
+		if err := m.checkTenantQuota(ctx, queue.TenantID, len(payload)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Spend the send link only once the message is certain to be accepted
+	if viaSendLink && !m.consumeSendLink(ctx, queueID, sendToken) {
+		return nil, ErrInvalidSendToken
+	}
 
 	// Create message
 	messageID, err := generateRandomID(16)
@@ -117,103 +323,222 @@ func (m *Manager) SendMessage(queueID string, payload []byte) (*SendMessageRespo
 	}
 
 	now := time.Now()
+	ttl := m.messageTTL(opts.TTL)
 	message := Message{
 		ID:         messageID,
 		QueueID:    queueID,
 		Payload:    payload,
 		ReceivedAt: now,
-		ExpiresAt:  now.Add(MessageTTL),
+		ExpiresAt:  now.Add(ttl),
+
+		PayloadHash: PayloadHash(payload),
+		SenderID:    member,
+	}
+	if opts.Priority == PriorityHigh {
+		message.Priority = PriorityHigh
 	}
 
-	// Store message in Redis
-	messageKey := fmt.Sprintf("message:%s:%s", queueID, messageID)
-	messageData, err := json.Marshal(message)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	// Large payloads go straight to the blob store; Redis keeps the envelope
+	if err := m.offload(ctx, &message); err != nil {
+		return nil, err
+	}
+
+	// Issue the sender's receipt first; a receipt for a message that then
+	// fails to store just expires
+	var receiptToken string
+	if m.receiptRetention > 0 {
+		if receiptToken, err = m.createStatus(ctx, &message, ttl); err != nil {
+			return nil, err
+		}
 	}
 
-	err = m.redis.Set(m.ctx, messageKey, messageData, MessageTTL).Err()
+	// Sequence numbers never repeat, so receivers can spot gaps left by expired messages
+	// The number comes with the message's place in the list, which receives
+	// stop at until the message is stored
+	seq, err := m.reserveSeq(ctx, queueID, messageID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to store message: %w", err)
+		return nil, err
 	}
+	message.Seq = seq
 
-	// Add message ID to queue's message list
-	listKey := fmt.Sprintf("queue:%s:messages", queueID)
-	err = m.redis.RPush(m.ctx, listKey, messageID).Err()
+	// Store message in Redis
+	messageKey := fmt.Sprintf("message:%s:%s", queueID, messageID)
+	messageData, err := m.encode(messageKey, message)
+	if err == nil {
+		err = m.redis.Set(ctx, messageKey, messageData, ttl).Err()
+	}
+	m.settleSeq(ctx, queueID, messageID, err == nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to add message to queue: %w", err)
+		return nil, fmt.Errorf("failed to store message: %w", err)
 	}
 
-	// Set expiry on message list
-	m.redis.Expire(m.ctx, listKey, QueueTTL)
+	// Message list and counter live as long as the queue
+	m.redis.ExpireAt(ctx, fmt.Sprintf("queue:%s:messages", queueID), queue.ExpiresAt)
+	m.redis.ExpireAt(ctx, fmt.Sprintf("queue:%s:seq", queueID), queue.ExpiresAt)
 
 	// Update queue's last active time
-	queue.LastActive = now
-	m.updateQueue(queue)
+	m.touchQueue(ctx, queue, now)
+
+	if queue.TenantID != "" {
+		m.meterTenant(ctx, queue.TenantID, 0, 1, int64(len(payload)))
+	}
+
+	m.RecordEvent(queueID, EventStored, messageID)
+
+	// The dispatcher posts it to the owner's webhook, if one is registered;
+	// on a mixed-delivery queue that waits for the batch release
+	if m.mixing(queue) {
+		m.scheduleMixRelease(ctx, queueID, now)
+	} else {
+		if queue.Webhook != nil {
+			m.scheduleWebhook(ctx, WebhookDelivery{QueueID: queueID, MessageID: messageID}, now)
+		}
+		if len(queue.PushDevices) > 0 {
+			m.schedulePush(ctx, queueID, now)
+		}
+	}
 
 	return &SendMessageResponse{
 		MessageID: messageID,
+		Seq:       seq,
 		SentAt:    now,
+		ExpiresAt: message.ExpiresAt,
+
+		PayloadHash:  message.PayloadHash,
+		ReceiptToken: receiptToken,
+
+		BurnAfterRead: queue.BurnAfterRead,
+		Held:          m.mixing(queue),
 	}, nil
 }
 
+// checkSendToken verifies a sender may post to queue; a macaroon with send
+// capability, a group member's token or a send link also works. viaSendLink
+// reports that sendToken is a one-time send link the caller must consume
+// once the send succeeds; member is the member ID when a member sent it
+func (m *Manager) checkSendToken(ctx context.Context, queue *Queue, sendToken string) (viaSendLink bool, member string, err error) {
+	if queue.SendToken == "" {
+		return false, "", nil
+	}
+	if m.macaroonSecret != nil && macaroon.Is(sendToken) {
+		if m.verifyMacaroon(queue, sendToken, CapSend) != nil {
+			return false, "", ErrInvalidSendToken
+		}
+		return false, "", nil
+	}
+	if subtle.ConstantTimeCompare([]byte(queue.SendToken), []byte(sendToken)) != 1 {
+		if member := m.lookupMember(ctx, queue.ID, sendToken); member != "" {
+			return false, member, nil
+		}
+		if !m.hasSendLink(ctx, queue.ID, sendToken) {
+			return false, "", ErrInvalidSendToken
+		}
+		return true, "", nil
+	}
+	return false, "", nil
+}
+
 // ReceiveMessages retrieves messages from a queue (requires valid access token)
-func (m *Manager) ReceiveMessages(queueID, accessToken string, since string, limit int) (*ReceiveMessagesResponse, error) {
-	// Verify access token
-	valid, err := m.verifyAccessToken(queueID, accessToken)
+// With opts.Wait set it long-polls until a message arrives, the wait
+// elapses or ctx is cancelled
+func (m *Manager) ReceiveMessages(ctx context.Context, queueID, accessToken string, opts ReceiveOptions) (*ReceiveMessagesResponse, error) {
+	after, err := DecodeCursor(opts.Cursor)
 	if err != nil {
 		return nil, err
 	}
-	if !valid {
-		return nil, ErrInvalidAccessToken
+	if opts.VisibilityTimeout > 0 && after > 0 {
+		return nil, ErrCursorWithVisibility
+	}
+	visibility := min(opts.VisibilityTimeout, MaxVisibilityTimeout)
+
+	response, err := m.receive(ctx, queueID, accessToken, after, opts.Limit, visibility, opts.SkipLeased)
+	if err != nil || opts.Wait <= 0 || len(response.Messages) > 0 {
+		return response, err
+	}
+
+	deadline := time.Now().Add(min(opts.Wait, MaxReceiveWait))
+	ticker := time.NewTicker(receivePollInterval)
+	defer ticker.Stop()
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return response, nil
+		case <-ticker.C:
+		}
+
+		// Cheap check first; only re-read once a message past the cursor was queued
+		if seq, err := m.redis.Get(ctx, fmt.Sprintf("queue:%s:seq", queueID)).Int64(); err != nil || seq <= after {
+			continue
+		}
+		response, err = m.receive(ctx, queueID, accessToken, after, opts.Limit, visibility, opts.SkipLeased)
+		if err != nil || len(response.Messages) > 0 {
+			return response, err
+		}
+	}
+	return response, nil
+}
+
+// receive reads one page of messages with sequence numbers above after
+// With visibility set it skips messages another receive has leased and
+// leases the ones it returns for that long; with skipLeased it only skips
+func (m *Manager) receive(ctx context.Context, queueID, accessToken string, after int64, limit int, visibility time.Duration, skipLeased bool) (*ReceiveMessagesResponse, error) {
+	// Verify access token grants receive; a duress token reads as an empty queue
+	if err := m.authorize(ctx, queueID, accessToken, CapReceive); err == errDuress {
+		return &ReceiveMessagesResponse{Messages: []Message{}, NextCursor: EncodeCursor(after)}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Load queue (wakes it if hibernated)
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+	if visibility > 0 && (queue.Broadcast || queue.BurnAfterRead) {
+		return nil, ErrVisibilityUnsupported
+	}
+	until := invisibleUntil(visibility) // Taken before any lease, so every lease lasts at least until then
+
+	// Broadcast readers never see again what they have acked
+	if queue.Broadcast {
+		after = max(after, m.readerCursor(ctx, queueID, accessToken))
+	}
+
+	// Mixed-delivery queues show nothing past the last released batch
+	released := int64(math.MaxInt64)
+	if m.mixing(queue) {
+		released = m.mixReleased(ctx, queueID)
 	}
 
 	// Get message IDs from queue
 	listKey := fmt.Sprintf("queue:%s:messages", queueID)
-	messageIDs, err := m.redis.LRange(m.ctx, listKey, 0, -1).Result()
+	messageIDs, err := m.redis.LRange(ctx, listKey, 0, -1).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return &ReceiveMessagesResponse{
-				Messages: []Message{},
-				HasMore:  false,
+				Messages:   []Message{},
+				HasMore:    false,
+				NextCursor: EncodeCursor(after),
 			}, nil
 		}
 		return nil, fmt.Errorf("failed to get message list: %w", err)
 	}
 
 	// Set default limit
-	if limit == 0 || limit > 100 {
-		limit = 100
+	if limit <= 0 || limit > MaxReceiveLimit {
+		limit = MaxReceiveLimit
 	}
 
-	// Retrieve messages
+	// Retrieve messages, leading with any operator notice this queue hasn't seen
 	messages := []Message{}
-	sinceFound := since == "" // If no 'since', start from beginning
-
-	// First pass: try to find the 'since' message
-	sinceMessageInQueue := false
-	if since != "" {
-		for _, msgID := range messageIDs {
-			if msgID == since {
-				sinceMessageInQueue = true
-				break
-			}
-		}
-		// If 'since' message not found in queue (expired/deleted), fetch all messages
-		if !sinceMessageInQueue {
-			sinceFound = true // Treat as if no 'since' was specified
-		}
+	if notice := m.noticeMessage(ctx, queueID); notice != nil {
+		messages = append(messages, *notice)
 	}
+	// The cursor is a sequence number rather than a message ID, so it stays
+	// valid after the message it points at expires or is acked
+	next := after
 
 	for i, msgID := range messageIDs {
-		// Skip until we find 'since' message
-		if !sinceFound {
-			if msgID == since {
-				sinceFound = true
-			}
-			continue
-		}
-
 		// Check limit
 		if len(messages) >= limit {
 			break
@@ -221,121 +546,573 @@ func (m *Manager) ReceiveMessages(queueID, accessToken string, since string, lim
 
 		// Get message
 		messageKey := fmt.Sprintf("message:%s:%s", queueID, msgID)
-		messageData, err := m.redis.Get(m.ctx, messageKey).Result()
+		messageData, err := m.redis.Get(ctx, messageKey).Result()
+		if err == redis.Nil && m.isPending(ctx, queueID, msgID) {
+			// Still being stored: stop here, or the cursor would move past it
+			break
+		}
+		if err == redis.Nil {
+			// Stored since it was listed, or expired
+			messageData, err = m.redis.Get(ctx, messageKey).Result()
+		}
 		if err != nil {
 			if err == redis.Nil {
 				// Message expired, remove from list
-				m.redis.LRem(m.ctx, listKey, 1, msgID)
+				m.redis.LRem(ctx, listKey, 1, msgID)
+				m.RecordEvent(queueID, EventExpired, msgID)
 				continue
 			}
 			return nil, fmt.Errorf("failed to get message: %w", err)
 		}
 
 		var message Message
-		err = json.Unmarshal([]byte(messageData), &message)
+		err = m.decode(ctx, messageKey, messageData, &message)
 		if err != nil {
 			continue // Skip malformed messages
 		}
 
+		// Skip messages already returned under this cursor (unsequenced
+		// messages from before sequencing are always returned)
+		if message.Seq > 0 && message.Seq <= after {
+			continue
+		}
+		if message.Seq > released {
+			continue
+		}
+
+		// Competing consumers each take a lease; a leased message stays hidden until it runs out
+		if visibility > 0 {
+			leased, err := m.leaseMessage(ctx, queueID, msgID, visibility)
+			if err != nil {
+				return nil, err
+			}
+			if !leased {
+				continue // Another consumer holds it
+			}
+		} else if skipLeased && m.Leased(ctx, queueID, msgID) {
+			continue
+		}
+
+		// Bring archived payloads back from the blob store; a message that
+		// cannot be loaded stays queued for a later receive
+		if err := m.hydrate(ctx, &message); err != nil {
+			m.releaseLease(ctx, queueID, msgID)
+			continue
+		}
+
+		// Burn-after-read queues take the message atomically so only one
+		// reader ever sees it, once it is certain to reach this one
+		if queue.BurnAfterRead {
+			claimed, err := m.redis.Del(ctx, messageKey).Result()
+			if err != nil {
+				return nil, fmt.Errorf("failed to claim message: %w", err)
+			}
+			if claimed == 0 {
+				continue // Another reader took it first
+			}
+		}
+
 		messages = append(messages, message)
+		m.RecordEvent(queueID, EventFetched, message.ID)
+		next = max(next, message.Seq)
+
+		if queue.BurnAfterRead {
+			m.redis.LRem(ctx, listKey, 1, msgID)
+			m.deleteArchived(queueID, msgID)
+			m.RecordEvent(queueID, EventAcked, msgID)
+		}
 
 		// If this is the last message in our limit, check if there are more
 		if i < len(messageIDs)-1 && len(messages) >= limit {
+			prioritize(messages)
 			return &ReceiveMessagesResponse{
-				Messages: messages,
-				HasMore:  true,
+				Messages:       messages,
+				HasMore:        true,
+				NextCursor:     EncodeCursor(next),
+				InvisibleUntil: until,
 			}, nil
 		}
 	}
 
 	// Update queue's last active time
-	queue, _ := m.getQueue(queueID)
-	if queue != nil {
-		queue.LastActive = time.Now()
-		m.updateQueue(queue)
-	}
+	m.touchQueue(ctx, queue, time.Now())
 
+	prioritize(messages)
 	return &ReceiveMessagesResponse{
-		Messages: messages,
-		HasMore:  false,
+		Messages:       messages,
+		HasMore:        false,
+		NextCursor:     EncodeCursor(next),
+		InvisibleUntil: until,
 	}, nil
 }
 
+// GetMessage returns one message by ID (requires receive)
+// Burn-after-read messages are claimed by the read, as with ReceiveMessages
+func (m *Manager) GetMessage(ctx context.Context, queueID, messageID, accessToken string) (*Message, error) {
+	// Verify access token grants receive; a duress token finds nothing
+	if err := m.authorize(ctx, queueID, accessToken, CapReceive); err == errDuress {
+		return nil, ErrMessageNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Load queue (wakes it if hibernated)
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+
+	messageKey := fmt.Sprintf("message:%s:%s", queueID, messageID)
+	messageData, err := m.redis.Get(ctx, messageKey).Result()
+	if err == redis.Nil {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+
+	var message Message
+	if err := m.decode(ctx, messageKey, messageData, &message); err != nil {
+		return nil, fmt.Errorf("failed to decode message: %w", err)
+	}
+
+	// Bring an archived payload back from the blob store
+	if err := m.hydrate(ctx, &message); err != nil {
+		return nil, fmt.Errorf("failed to load archived payload: %w", err)
+	}
+
+	// Burn-after-read messages are claimed only once loaded, so a failed
+	// load leaves them for a retry; a concurrent reader may win the claim
+	if queue.BurnAfterRead {
+		claimed, err := m.redis.Del(ctx, messageKey).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim message: %w", err)
+		}
+		if claimed == 0 {
+			return nil, ErrMessageNotFound
+		}
+	}
+	m.RecordEvent(queueID, EventFetched, message.ID)
+
+	if queue.BurnAfterRead {
+		m.redis.LRem(ctx, fmt.Sprintf("queue:%s:messages", queueID), 1, messageID)
+		m.deleteArchived(queueID, messageID)
+		m.RecordEvent(queueID, EventAcked, messageID)
+	}
+
+	// Update queue's last active time
+	m.touchQueue(ctx, queue, time.Now())
+
+	return &message, nil
+}
+
+// CountMessages reports how many messages a receive with opts would return,
+// without delivering them (limit and wait are ignored)
+// Nothing is marked fetched and burn-after-read messages are left in place
+func (m *Manager) CountMessages(ctx context.Context, queueID, accessToken string, opts ReceiveOptions) (*ReceiveCountResponse, error) {
+	after, err := DecodeCursor(opts.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	if opts.VisibilityTimeout > 0 && after > 0 {
+		return nil, ErrCursorWithVisibility
+	}
+
+	// Verify access token grants receive
+	if err := m.authorize(ctx, queueID, accessToken, CapReceive); err == errDuress {
+		return &ReceiveCountResponse{NextCursor: EncodeCursor(after)}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Load queue (wakes it if hibernated)
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+	released := int64(math.MaxInt64)
+	if m.mixing(queue) {
+		released = m.mixReleased(ctx, queueID)
+	}
+
+	listKey := fmt.Sprintf("queue:%s:messages", queueID)
+	messageIDs, err := m.redis.LRange(ctx, listKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message list: %w", err)
+	}
+
+	response := &ReceiveCountResponse{NextCursor: EncodeCursor(after)}
+	if len(messageIDs) == 0 {
+		return response, nil
+	}
+
+	messageKeys := make([]string, len(messageIDs))
+	for i, msgID := range messageIDs {
+		messageKeys[i] = fmt.Sprintf("message:%s:%s", queueID, msgID)
+	}
+	values, err := m.redis.MGet(ctx, messageKeys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	// Same selection as receive: existing, released messages past the
+	// cursor, and with a visibility timeout only those nobody has leased
+	var leases []*redis.IntCmd
+	pipe := m.redis.Pipeline()
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var message Message
+		if err := m.decode(ctx, messageKeys[i], data, &message); err != nil {
+			continue
+		}
+		if message.Seq > 0 && message.Seq <= after {
+			continue
+		}
+		if message.Seq > released {
+			continue
+		}
+		if opts.VisibilityTimeout > 0 {
+			leases = append(leases, pipe.Exists(ctx, leaseKey(queueID, messageIDs[i])))
+			continue
+		}
+		response.Count++
+	}
+	if len(leases) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, fmt.Errorf("failed to check leases: %w", err)
+		}
+		for _, leased := range leases {
+			if leased.Val() == 0 {
+				response.Count++
+			}
+		}
+	}
+
+	return response, nil
+}
+
+// QueueInfo reports message count and size for a queue (requires receive)
+func (m *Manager) QueueInfo(ctx context.Context, queueID, accessToken string) (*QueueInfoResponse, error) {
+	// Verify access token grants receive; a duress token sees the wiped queue empty
+	if err := m.authorize(ctx, queueID, accessToken, CapReceive); err == errDuress {
+		decoy := m.decoy(ctx, accessToken)
+		return &QueueInfoResponse{CreatedAt: decoy.CreatedAt, ExpiresAt: decoy.ExpiresAt, LastActive: decoy.LastActive}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Load queue (wakes it if hibernated)
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+
+	listKey := fmt.Sprintf("queue:%s:messages", queueID)
+	messageIDs, err := m.redis.LRange(ctx, listKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message list: %w", err)
+	}
+
+	info := &QueueInfoResponse{
+		CreatedAt:  queue.CreatedAt,
+		ExpiresAt:  queue.ExpiresAt,
+		LastActive: queue.LastActive,
+	}
+	if len(messageIDs) == 0 {
+		return info, nil
+	}
+
+	messageKeys := make([]string, len(messageIDs))
+	for i, msgID := range messageIDs {
+		messageKeys[i] = fmt.Sprintf("message:%s:%s", queueID, msgID)
+	}
+	values, err := m.redis.MGet(ctx, messageKeys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	// Count only messages that still exist; the list can trail expirations
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var message Message
+		if err := m.decode(ctx, messageKeys[i], data, &message); err != nil {
+			continue
+		}
+		info.MessageCount++
+		info.TotalBytes += int64(len(message.Payload) + message.ArchiveSize)
+	}
+
+	return info, nil
+}
+
 // DeleteMessage deletes a message from the queue after it's been received
-func (m *Manager) DeleteMessage(queueID, messageID, accessToken string) error {
-	// Verify access token
-	valid, err := m.verifyAccessToken(queueID, accessToken)
+func (m *Manager) DeleteMessage(ctx context.Context, queueID, messageID, accessToken string) error {
+	// Verify access token grants ack; acking what is not there succeeds
+	if err := m.authorize(ctx, queueID, accessToken, CapAck); err == errDuress {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// On a broadcast queue an ack only moves this reader's cursor
+	queue, err := m.getQueue(ctx, queueID)
 	if err != nil {
 		return err
 	}
-	if !valid {
-		return ErrInvalidAccessToken
+	if queue.Broadcast {
+		return m.ackBroadcast(ctx, queue, accessToken, messageID)
 	}
 
 	// Delete message
 	messageKey := fmt.Sprintf("message:%s:%s", queueID, messageID)
-	err = m.redis.Del(m.ctx, messageKey).Err()
+	err = m.redis.Del(ctx, messageKey).Err()
 	if err != nil {
 		return fmt.Errorf("failed to delete message: %w", err)
 	}
 
 	// Remove from queue's message list
 	listKey := fmt.Sprintf("queue:%s:messages", queueID)
-	err = m.redis.LRem(m.ctx, listKey, 1, messageID).Err()
+	err = m.redis.LRem(ctx, listKey, 1, messageID).Err()
 	if err != nil {
 		return fmt.Errorf("failed to remove message from list: %w", err)
 	}
 
+	m.deleteArchived(queueID, messageID)
+	m.releaseLease(ctx, queueID, messageID)
+	m.RecordEvent(queueID, EventAcked, messageID)
+
 	return nil
 }
 
-// DeleteQueue deletes a queue and all its messages
-func (m *Manager) DeleteQueue(queueID, accessToken string) error {
-	// Verify access token
-	valid, err := m.verifyAccessToken(queueID, accessToken)
+// PurgeMessages deletes every pending message but keeps the queue and its tokens
+// Messages that arrive while the purge runs are left in place
+// On a broadcast queue this clears every reader's backlog, so it needs admin
+func (m *Manager) PurgeMessages(ctx context.Context, queueID, accessToken string) (*PurgeMessagesResponse, error) {
+	// Verify access token grants ack; a duress token purges nothing
+	if err := m.authorize(ctx, queueID, accessToken, CapAck); err == errDuress {
+		return &PurgeMessagesResponse{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Load queue (wakes it if hibernated)
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+	if queue.Broadcast {
+		if err := m.authorize(ctx, queueID, accessToken, CapAdmin); err != nil {
+			return nil, err
+		}
+	}
+
+	listKey := fmt.Sprintf("queue:%s:messages", queueID)
+	messageIDs, err := m.redis.LRange(ctx, listKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message list: %w", err)
+	}
+	messageIDs = m.withoutPending(ctx, queueID, messageIDs)
+
+	response := &PurgeMessagesResponse{}
+	if len(messageIDs) == 0 {
+		return response, nil
+	}
+
+	// Remove each listed ID rather than the whole list, so a concurrent send survives
+	pipe := m.redis.TxPipeline()
+	deletes := make([]*redis.IntCmd, len(messageIDs))
+	for i, msgID := range messageIDs {
+		deletes[i] = pipe.Del(ctx, fmt.Sprintf("message:%s:%s", queueID, msgID))
+		pipe.LRem(ctx, listKey, 1, msgID)
+		pipe.Del(ctx, leaseKey(queueID, msgID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to purge messages: %w", err)
+	}
+
+	for i, msgID := range messageIDs {
+		m.deleteArchived(queueID, msgID)
+		if deletes[i].Val() > 0 {
+			response.Purged++
+			m.RecordEvent(queueID, EventAcked, msgID)
+		}
+	}
+
+	m.touchQueue(ctx, queue, time.Now())
+
+	return response, nil
+}
+
+// ClaimMessage deletes a burn-after-read message before it is pushed to subscribers
+// Returns false if a concurrent receive already took it
+func (m *Manager) ClaimMessage(ctx context.Context, queueID, messageID string) (bool, error) {
+	messageKey := fmt.Sprintf("message:%s:%s", queueID, messageID)
+	deleted, err := m.redis.Del(ctx, messageKey).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim message: %w", err)
+	}
+	if deleted == 0 {
+		return false, nil
+	}
+
+	listKey := fmt.Sprintf("queue:%s:messages", queueID)
+	m.redis.LRem(ctx, listKey, 1, messageID)
+	m.deleteArchived(queueID, messageID)
+	return true, nil
+}
+
+// RequeueMessage puts back a burn-after-read message that was claimed for a
+// WebSocket push but never acknowledged, so it can be delivered again
+// Other queues keep messages until they are acked, so nothing is done for them
+func (m *Manager) RequeueMessage(ctx context.Context, queueID string, message *Message) error {
+	queue, err := m.getQueue(ctx, queueID)
+	if err == ErrQueueNotFound {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	if !valid {
-		return ErrInvalidAccessToken
+	ttl := time.Until(message.ExpiresAt)
+	if !queue.BurnAfterRead || ttl <= 0 {
+		return nil
+	}
+
+	restored := *message
+	if err := m.offload(ctx, &restored); err != nil {
+		return err
+	}
+	messageKey := fmt.Sprintf("message:%s:%s", queueID, message.ID)
+	messageData, err := m.encode(messageKey, restored)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	// Several connections may hold the same unacked message; restore it once
+	stored, err := m.redis.SetNX(ctx, messageKey, messageData, ttl).Result()
+	if err != nil {
+		return fmt.Errorf("failed to store message: %w", err)
+	}
+	if !stored {
+		return nil
+	}
+
+	// It is older than anything sent since, so it goes back at the front
+	listKey := fmt.Sprintf("queue:%s:messages", queueID)
+	if err := m.redis.LPush(ctx, listKey, message.ID).Err(); err != nil {
+		return fmt.Errorf("failed to add message to queue: %w", err)
+	}
+	m.redis.ExpireAt(ctx, listKey, queue.ExpiresAt)
+	return nil
+}
+
+// DeleteQueue deletes a queue and all its messages
+func (m *Manager) DeleteQueue(ctx context.Context, queueID, accessToken string) error {
+	// Verify access token grants admin; a duress token deletes what is left
+	// of its wiped queue, itself and any tokens minted with it
+	if _, err := underDuress(m.authorize(ctx, queueID, accessToken, CapAdmin)); err != nil {
+		return err
+	}
+
+	m.purgeQueue(ctx, queueID)
+
+	// Also delete the presented token, for queues predating the token index
+	tokenKey := fmt.Sprintf("token:%s", accessToken)
+	m.redis.Del(ctx, tokenKey)
+
+	return nil
+}
+
+// purgeQueue removes a queue, its messages, journal and tokens (but not its farewell)
+func (m *Manager) purgeQueue(ctx context.Context, queueID string) {
+	// Stop counting the queue against its tenant
+	if queue, err := m.loadQueue(ctx, queueID); err == nil && queue.TenantID != "" {
+		m.redis.ZRem(ctx, tenantQueuesKey(queue.TenantID), queueID)
 	}
 
 	// Get all message IDs
 	listKey := fmt.Sprintf("queue:%s:messages", queueID)
-	messageIDs, _ := m.redis.LRange(m.ctx, listKey, 0, -1).Result()
+	messageIDs, _ := m.redis.LRange(ctx, listKey, 0, -1).Result()
 
 	// Delete all messages
 	for _, msgID := range messageIDs {
 		messageKey := fmt.Sprintf("message:%s:%s", queueID, msgID)
-		m.redis.Del(m.ctx, messageKey)
+		m.redis.Del(ctx, messageKey)
+		m.redis.Del(ctx, messageStatusKey(queueID, msgID))
+		m.releaseLease(ctx, queueID, msgID)
+		m.deleteArchived(queueID, msgID)
 	}
 
-	// Delete message list
-	m.redis.Del(m.ctx, listKey)
+	// Delete message list, sequence counter, journal, batch state, send links, members, cursors, prekeys, discovery entries and webhook state
+	m.redis.Del(ctx, listKey)
+	m.redis.Del(ctx, fmt.Sprintf("queue:%s:seq", queueID), pendingMessagesKey(queueID))
+	m.redis.Del(ctx, fmt.Sprintf("queue:%s:journal", queueID))
+	m.redis.Del(ctx, mixReleasedKey(queueID))
+	m.redis.ZRem(ctx, mixDueKey, queueID)
+	m.redis.Del(ctx, fmt.Sprintf("queue:%s:sendlinks", queueID))
+	m.redis.Del(ctx, membersKey(queueID))
+	m.redis.Del(ctx, cursorsKey(queueID))
+	m.redis.Del(ctx, prekeysKey(queueID), oneTimePrekeysKey(queueID))
+	m.withdrawDiscovery(ctx, queueID)
+	m.redis.Del(ctx, webhookStateKey(queueID))
+	m.deleteUploads(ctx, queueID)
+
+	// Keep the farewell for senders who have not heard the queue is gone
+	m.redis.Expire(ctx, farewellKey(queueID), FarewellRetention)
 
 	// Delete queue
 	queueKey := fmt.Sprintf("queue:%s", queueID)
-	m.redis.Del(m.ctx, queueKey)
-
-	// Delete access token
-	tokenKey := fmt.Sprintf("token:%s", accessToken)
-	m.redis.Del(m.ctx, tokenKey)
+	m.redis.Del(ctx, queueKey, queueStateKey(queueID))
+	if m.hibernateStore != nil {
+		m.hibernateStore.Delete(ctx, hibernateKey(queueID))
+	}
 
-	return nil
+	// Delete all access tokens
+	m.deleteAllTokens(queueID)
 }
 
 // CleanupExpiredQueues removes expired queues and messages
-func (m *Manager) CleanupExpiredQueues() error {
+// It returns the number of archived payloads swept
+func (m *Manager) CleanupExpiredQueues() (int, error) {
 	// This is handled automatically by Redis TTL
-	// But we can also implement manual cleanup here if needed
-	return nil
+	// Archived payloads outlive their Redis stubs, so sweep stores that support it
+	if sweeper, ok := m.archive.(blobstore.Sweeper); ok {
+		swept, err := sweeper.Sweep(m.ctx, m.maxMessageTTL)
+		if err != nil {
+			return swept, fmt.Errorf("failed to sweep archive: %w", err)
+		}
+		return swept, nil
+	}
+	return 0, nil
 }
 
 // Helper functions
 
-func (m *Manager) getQueue(queueID string) (*Queue, error) {
+func (m *Manager) getQueue(ctx context.Context, queueID string) (*Queue, error) {
+	queue, err := m.loadQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Transparently bring hibernated queues back on first access
+	if queue.Hibernated {
+		if err := m.wake(ctx, queue); err != nil {
+			return nil, err
+		}
+	}
+
+	return queue, nil
+}
+
+// loadQueue reads the queue record without waking it
+func (m *Manager) loadQueue(ctx context.Context, queueID string) (*Queue, error) {
 	queueKey := fmt.Sprintf("queue:%s", queueID)
-	queueData, err := m.redis.Get(m.ctx, queueKey).Result()
+	queueData, err := m.redis.Get(ctx, queueKey).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return nil, ErrQueueNotFound
@@ -344,17 +1121,39 @@ func (m *Manager) getQueue(queueID string) (*Queue, error) {
 	}
 
 	var queue Queue
-	err = json.Unmarshal([]byte(queueData), &queue)
+	err = m.decode(ctx, queueKey, queueData, &queue)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal queue: %w", err)
 	}
+	queue.stored = queueData
+
+	if err := m.loadQueueState(ctx, &queue); err != nil {
+		return nil, err
+	}
 
 	return &queue, nil
 }
 
-func (m *Manager) updateQueue(queue *Queue) error {
+// updateQueueScript replaces a queue record only if nobody wrote it since
+// it was read; -1 means the queue is gone, 0 that it changed
+var updateQueueScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if not current then
+	return -1
+end
+if current ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// updateQueue stores a queue record loaded with loadQueue, failing with
+// ErrQueueChanged if it was written in the meantime and ErrQueueNotFound if
+// it was deleted, so a stale copy never overwrites a newer one
+func (m *Manager) updateQueue(ctx context.Context, queue *Queue) error {
 	queueKey := fmt.Sprintf("queue:%s", queue.ID)
-	queueData, err := json.Marshal(queue)
+	queueData, err := m.encode(queueKey, queue)
 	if err != nil {
 		return err
 	}
@@ -362,28 +1161,91 @@ func (m *Manager) updateQueue(queue *Queue) error {
 	// Update with remaining TTL
 	ttl := time.Until(queue.ExpiresAt)
 	if ttl < 0 {
-		ttl = QueueTTL
+		ttl = m.defaultQueueTTL
+	}
+
+	stored, err := updateQueueScript.Run(ctx, m.redis, []string{queueKey}, queue.stored, queueData, ttl.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("failed to update queue: %w", err)
 	}
+	switch stored {
+	case -1:
+		return ErrQueueNotFound
+	case 0:
+		return ErrQueueChanged
+	}
+	queue.stored = string(queueData)
+	return nil
+}
 
-	return m.redis.Set(m.ctx, queueKey, queueData, ttl).Err()
+// queueUpdateAttempts bounds how often changeQueue retries a lost race
+const queueUpdateAttempts = 5
+
+// changeQueue loads a queue and hands it to change, which saves it with
+// updateQueue; when another writer got there first it loads the queue again
+// and retries
+func (m *Manager) changeQueue(ctx context.Context, queueID string, change func(*Queue) error) (*Queue, error) {
+	for attempt := 1; ; attempt++ {
+		queue, err := m.loadQueue(ctx, queueID)
+		if err != nil {
+			return nil, err
+		}
+		err = change(queue)
+		if err == ErrQueueChanged && attempt < queueUpdateAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return queue, nil
+	}
 }
 
-func (m *Manager) verifyAccessToken(queueID, accessToken string) (bool, error) {
-	tokenKey := fmt.Sprintf("token:%s", accessToken)
-	storedQueueID, err := m.redis.Get(m.ctx, tokenKey).Result()
+// queueStateKey holds the fields of a queue that change often or from the
+// admin API, kept apart from the record so setting them never rewrites it
+func queueStateKey(queueID string) string {
+	return fmt.Sprintf("queue:%s:state", queueID)
+}
+
+// loadQueueState overlays the separately stored state onto a queue record;
+// records written before the state key existed keep their own values
+func (m *Manager) loadQueueState(ctx context.Context, queue *Queue) error {
+	state, err := m.redis.HMGet(ctx, queueStateKey(queue.ID), "last_active", "frozen").Result()
 	if err != nil {
-		if err == redis.Nil {
-			return false, nil
+		return fmt.Errorf("failed to get queue state: %w", err)
+	}
+	if lastActive, ok := state[0].(string); ok {
+		if nanos, err := strconv.ParseInt(lastActive, 10, 64); err == nil {
+			queue.LastActive = time.Unix(0, nanos)
 		}
-		return false, fmt.Errorf("failed to verify token: %w", err)
 	}
+	if frozen, ok := state[1].(string); ok {
+		queue.Frozen = frozen == "1"
+	}
+	return nil
+}
+
+// setQueueState stores one state field, living as long as the queue
+func (m *Manager) setQueueState(ctx context.Context, queue *Queue, field string, value interface{}) error {
+	stateKey := queueStateKey(queue.ID)
+	pipe := m.redis.TxPipeline()
+	pipe.HSet(ctx, stateKey, field, value)
+	pipe.ExpireAt(ctx, stateKey, queue.ExpiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to update queue state: %w", err)
+	}
+	return nil
+}
 
-	return storedQueueID == queueID, nil
+// touchQueue records activity on a queue without rewriting its record
+func (m *Manager) touchQueue(ctx context.Context, queue *Queue, at time.Time) {
+	queue.LastActive = at
+	m.setQueueState(ctx, queue, "last_active", at.UnixNano())
 }
 
-func (m *Manager) getMessageCount(queueID string) (int, error) {
+func (m *Manager) getMessageCount(ctx context.Context, queueID string) (int, error) {
 	listKey := fmt.Sprintf("queue:%s:messages", queueID)
-	count, err := m.redis.LLen(m.ctx, listKey).Result()
+	count, err := m.redis.LLen(ctx, listKey).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return 0, nil
@@ -0,0 +1,93 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"privmsg-relay/internal/blobstore"
+)
+
+// memoryStore is an in-memory blob store whose reads can be made to fail
+type memoryStore struct {
+	mu       sync.Mutex
+	blobs    map[string][]byte
+	failGets bool
+}
+
+func (s *memoryStore) Put(ctx context.Context, key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.blobs == nil {
+		s.blobs = make(map[string][]byte)
+	}
+	s.blobs[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failGets {
+		return nil, errors.New("blob store unavailable")
+	}
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, blobstore.ErrNotFound
+	}
+	return data, nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
+
+func (s *memoryStore) setFailGets(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failGets = fail
+}
+
+func TestBurnAfterReadKeepsMessageWhenLoadFails(t *testing.T) {
+	m := testManager(t)
+	store := &memoryStore{}
+	m.EnableOffload(store, 8) // Every test payload goes to the store
+	ctx := context.Background()
+	created := createTestQueue(t, m, CreateQueueRequest{BurnAfterRead: true})
+	ids := sendTestMessages(t, m, created.QueueID, 1)
+
+	store.setFailGets(true)
+	if got := receivedIDs(t, m, created, ReceiveOptions{}); len(got) != 0 {
+		t.Fatalf("receive with the store down got %v, want none", got)
+	}
+	if _, err := m.GetMessage(ctx, created.QueueID, ids[0], created.AccessToken); err == nil {
+		t.Fatal("GetMessage() with the store down succeeded")
+	}
+
+	// Nothing was burned while the payload could not be loaded
+	store.setFailGets(false)
+	if got := receivedIDs(t, m, created, ReceiveOptions{}); len(got) != 1 || got[0] != ids[0] {
+		t.Fatalf("receive after recovery got %v, want [%s]", got, ids[0])
+	}
+	if got := receivedIDs(t, m, created, ReceiveOptions{}); len(got) != 0 {
+		t.Errorf("second receive got %v, want none: the first one burned it", got)
+	}
+}
+
+func TestBurnAfterReadGetMessageClaimsOnce(t *testing.T) {
+	m := testManager(t)
+	ctx := context.Background()
+	created := createTestQueue(t, m, CreateQueueRequest{BurnAfterRead: true})
+	ids := sendTestMessages(t, m, created.QueueID, 1)
+
+	if _, err := m.GetMessage(ctx, created.QueueID, ids[0], created.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetMessage(ctx, created.QueueID, ids[0], created.AccessToken); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("second GetMessage() error = %v, want %v", err, ErrMessageNotFound)
+	}
+}
@@ -0,0 +1,153 @@
+package queue
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrMembersUnavailable = errors.New("member send tokens require a queue created with require_send_token")
+	ErrTooManyMembers     = errors.New("too many members")
+	ErrInvalidMembers     = errors.New("invalid member request")
+	ErrMemberNotFound     = errors.New("member not found")
+)
+
+// Group member limits
+const (
+	MaxMembersPerRequest = 50
+	MaxMembersPerQueue   = 256
+)
+
+// MembersRequest asks for send tokens for group members
+type MembersRequest struct {
+	Count int `json:"count,omitempty"` // How many members to add (default 1)
+}
+
+// Member is one group member's send credential
+type Member struct {
+	MemberID  string `json:"member_id"`            // Public handle, stamped on the member's messages as sender_id
+	SendToken string `json:"send_token,omitempty"` // The secret (shown only once)
+}
+
+// MembersResponse lists group members; send tokens appear only when minted
+type MembersResponse struct {
+	Members []Member `json:"members"`
+}
+
+// memberID derives a member's public handle from its send token, so the
+// raw credential is never stored
+func memberID(sendToken string) string {
+	sum := sha256.Sum256([]byte(sendToken))
+	return hex.EncodeToString(sum[:8])
+}
+
+func membersKey(queueID string) string {
+	return fmt.Sprintf("queue:%s:members", queueID)
+}
+
+// AddMembers mints a send token per group member (requires an admin
+// access token; macaroons are refused)
+// Members are kept in queue:{id}:members, a hash of member ID -> time added
+// (unix seconds); each member can be revoked without touching the others
+func (m *Manager) AddMembers(ctx context.Context, queueID, accessToken string, req MembersRequest) (*MembersResponse, error) {
+	if err := m.authorizeMinting(ctx, queueID, accessToken); err == errDuress {
+		return m.decoyMembers(ctx, accessToken, req)
+	} else if err != nil {
+		return nil, err
+	}
+
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+	if queue.SendToken == "" {
+		return nil, ErrMembersUnavailable
+	}
+
+	count := req.Count
+	if count == 0 {
+		count = 1
+	}
+	if count < 0 || count > MaxMembersPerRequest {
+		return nil, ErrInvalidMembers
+	}
+
+	existing, err := m.redis.HLen(ctx, membersKey(queueID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count members: %w", err)
+	}
+	if int(existing)+count > MaxMembersPerQueue {
+		return nil, ErrTooManyMembers
+	}
+
+	members := make([]Member, 0, count)
+	fields := make(map[string]interface{}, count)
+	for i := 0; i < count; i++ {
+		token, err := generateRandomID(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate send token: %w", err)
+		}
+		members = append(members, Member{MemberID: memberID(token), SendToken: token})
+		fields[memberID(token)] = time.Now().Unix()
+	}
+
+	pipe := m.redis.TxPipeline()
+	pipe.HSet(ctx, membersKey(queueID), fields)
+	pipe.ExpireAt(ctx, membersKey(queueID), queue.ExpiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to store members: %w", err)
+	}
+
+	return &MembersResponse{Members: members}, nil
+}
+
+// ListMembers returns the IDs of a queue's group members (requires admin)
+func (m *Manager) ListMembers(ctx context.Context, queueID, accessToken string) (*MembersResponse, error) {
+	// Under duress the members were wiped with the queue, so none are listed
+	if _, err := underDuress(m.authorize(ctx, queueID, accessToken, CapAdmin)); err != nil {
+		return nil, err
+	}
+
+	ids, err := m.redis.HKeys(ctx, membersKey(queueID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members: %w", err)
+	}
+	members := make([]Member, 0, len(ids))
+	for _, id := range ids {
+		members = append(members, Member{MemberID: id})
+	}
+	return &MembersResponse{Members: members}, nil
+}
+
+// RevokeMember invalidates one member's send token (requires an admin
+// access token; macaroons are refused)
+func (m *Manager) RevokeMember(ctx context.Context, queueID, accessToken, revokeID string) error {
+	// Under duress the members were wiped with the queue, so none is found
+	if _, err := underDuress(m.authorizeMinting(ctx, queueID, accessToken)); err != nil {
+		return err
+	}
+
+	removed, err := m.redis.HDel(ctx, membersKey(queueID), revokeID).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to revoke member: %w", err)
+	}
+	if removed == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+// lookupMember returns the member ID for a send token of the queue ("" if none)
+func (m *Manager) lookupMember(ctx context.Context, queueID, sendToken string) string {
+	id := memberID(sendToken)
+	if exists, err := m.redis.HExists(ctx, membersKey(queueID), id).Result(); err != nil || !exists {
+		return ""
+	}
+	return id
+}
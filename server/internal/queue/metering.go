@@ -0,0 +1,285 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTenantQuotaExceeded = errors.New("tenant quota exceeded")
+	ErrTenantRateLimited   = errors.New("tenant rate limit exceeded")
+	ErrUnknownTier         = errors.New("unknown tier")
+	ErrInvalidPeriod       = errors.New("invalid usage period (want YYYY-MM)")
+)
+
+// usageRetention is how long monthly usage is kept, so last year's bills
+// can still be checked
+const usageRetention = 400 * 24 * time.Hour
+
+// usagePeriodLayout formats billing periods, which are UTC calendar months
+const usagePeriodLayout = "2006-01"
+
+// Tier is a set of per-tenant quotas (0 = unlimited)
+type Tier struct {
+	Name              string `json:"name"`
+	Queues            int64  `json:"queues,omitempty"`              // Queues created per month
+	Messages          int64  `json:"messages,omitempty"`            // Messages relayed per month
+	Bytes             int64  `json:"bytes,omitempty"`               // Payload bytes stored per month
+	MessagesPerSecond int    `json:"messages_per_second,omitempty"` // Accepted sends, across the tenant's queues
+}
+
+// TenantUsage is what a tenant used in one billing period
+type TenantUsage struct {
+	Period   string `json:"period"` // YYYY-MM, UTC
+	Queues   int64  `json:"queues"`
+	Messages int64  `json:"messages"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// TenantUsageResponse is returned by GET /admin/tenants/{tenantID}/usage
+type TenantUsageResponse struct {
+	TenantID string `json:"tenant_id"`
+	TenantUsage
+	Tier *Tier `json:"tier,omitempty"` // Quotas the tenant is held to now (nil = unlimited)
+}
+
+// SetTenantTierRequest is sent to PUT /admin/tenants/{tenantID}/tier
+type SetTenantTierRequest struct {
+	Tier string `json:"tier"` // Empty = unlimited
+}
+
+// TenantQuotaError is returned when a tenant reached one of its tier's quotas
+type TenantQuotaError struct {
+	Quota      string        // queues, messages, bytes or messages_per_second
+	RetryAfter time.Duration // Until the month or second the quota counts ends
+}
+
+func (e *TenantQuotaError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Unwrap(), e.Quota)
+}
+
+func (e *TenantQuotaError) Unwrap() error {
+	if e.Quota == "messages_per_second" {
+		return ErrTenantRateLimited
+	}
+	return ErrTenantQuotaExceeded
+}
+
+// ParseTiers parses tier definitions such as
+// "free:queues=1000;messages=100000;bytes=1000000000;messages_per_second=10"
+// Quotas left out are unlimited
+func ParseTiers(entries []string) (map[string]Tier, error) {
+	tiers := make(map[string]Tier)
+	for _, entry := range entries {
+		name, spec, _ := strings.Cut(entry, ":")
+		if name = strings.TrimSpace(name); name == "" {
+			return nil, fmt.Errorf("invalid tier %q (want name:quota=N;...)", entry)
+		}
+		tier := Tier{Name: name}
+		for _, field := range strings.Split(spec, ";") {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			key, value, _ := strings.Cut(field, "=")
+			n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid quota %q in tier %s", field, name)
+			}
+			switch strings.TrimSpace(key) {
+			case "queues":
+				tier.Queues = n
+			case "messages":
+				tier.Messages = n
+			case "bytes":
+				tier.Bytes = n
+			case "messages_per_second":
+				tier.MessagesPerSecond = int(n)
+			default:
+				return nil, fmt.Errorf("unknown quota %q in tier %s", key, name)
+			}
+		}
+		tiers[name] = tier
+	}
+	return tiers, nil
+}
+
+// SetTenantTiers configures the tiers tenants can be put on; new tenants
+// get defaultTier unless created with another
+func (m *Manager) SetTenantTiers(tiers map[string]Tier, defaultTier string) error {
+	if _, ok := tiers[defaultTier]; defaultTier != "" && !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownTier, defaultTier)
+	}
+	m.tiers = tiers
+	m.defaultTier = defaultTier
+	return nil
+}
+
+// Tiers returns the configured tiers by name
+func (m *Manager) Tiers() []Tier {
+	tiers := make([]Tier, 0, len(m.tiers))
+	for _, tier := range m.tiers {
+		tiers = append(tiers, tier)
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].Name < tiers[j].Name })
+	return tiers
+}
+
+// DefaultTier returns the tier new tenants get ("" = unlimited)
+func (m *Manager) DefaultTier() string {
+	return m.defaultTier
+}
+
+// SetTenantTier moves a tenant to another tier; quotas apply from the next
+// request on, against the usage already counted this month
+func (m *Manager) SetTenantTier(ctx context.Context, tenantID, tier string) (*Tenant, error) {
+	if !m.tenancy {
+		return nil, ErrTenancyDisabled
+	}
+	if _, ok := m.tiers[tier]; tier != "" && !ok {
+		return nil, ErrUnknownTier
+	}
+	tenant, err := m.tenantRecord(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	tenant.Tier = tier
+	data, err := json.Marshal(tenant)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.redis.Set(ctx, tenantKey(tenantID), data, 0).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store tenant: %w", err)
+	}
+	return m.GetTenant(ctx, tenantID)
+}
+
+// GetTenantUsage returns a tenant's usage in period (YYYY-MM; empty = this
+// month) and the quotas it is held to now
+func (m *Manager) GetTenantUsage(ctx context.Context, tenantID, period string) (*TenantUsageResponse, error) {
+	if !m.tenancy {
+		return nil, ErrTenancyDisabled
+	}
+	at := time.Now().UTC()
+	if period != "" {
+		var err error
+		if at, err = time.Parse(usagePeriodLayout, period); err != nil {
+			return nil, ErrInvalidPeriod
+		}
+	}
+	tenant, err := m.tenantRecord(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := m.tenantUsage(ctx, tenantID, at)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &TenantUsageResponse{TenantID: tenantID, TenantUsage: *usage}
+	if tier, ok := m.tenantTier(tenant); ok {
+		resp.Tier = &tier
+	}
+	return resp, nil
+}
+
+func tenantUsageKey(tenantID string, at time.Time) string {
+	return fmt.Sprintf("tenant:%s:usage:%s", tenantID, at.UTC().Format(usagePeriodLayout))
+}
+
+// tenantUsage reads the usage counted in the month containing at
+func (m *Manager) tenantUsage(ctx context.Context, tenantID string, at time.Time) (*TenantUsage, error) {
+	fields, err := m.redis.HGetAll(ctx, tenantUsageKey(tenantID, at)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant usage: %w", err)
+	}
+	usage := &TenantUsage{Period: at.UTC().Format(usagePeriodLayout)}
+	usage.Queues, _ = strconv.ParseInt(fields["queues"], 10, 64)
+	usage.Messages, _ = strconv.ParseInt(fields["messages"], 10, 64)
+	usage.Bytes, _ = strconv.ParseInt(fields["bytes"], 10, 64)
+	return usage, nil
+}
+
+// tenantTier returns the tier a tenant is held to; a tier no longer
+// configured falls back to the default tier
+func (m *Manager) tenantTier(tenant *Tenant) (Tier, bool) {
+	if tenant.Tier == "" {
+		return Tier{}, false
+	}
+	if tier, ok := m.tiers[tenant.Tier]; ok {
+		return tier, true
+	}
+	tier, ok := m.tiers[m.defaultTier]
+	return tier, ok
+}
+
+// checkTenantQuota fails a queue creation (size < 0) or a send of size
+// bytes that would take the tenant over its tier's quotas
+// Concurrent requests may overshoot a monthly quota by a few; Redis errors
+// are ignored here, the request itself will report them
+func (m *Manager) checkTenantQuota(ctx context.Context, tenantID string, size int) error {
+	tenant, err := m.tenantRecord(ctx, tenantID)
+	if err != nil {
+		return nil // Deleted tenants' queues live on unmetered
+	}
+	tier, ok := m.tenantTier(tenant)
+	if !ok {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	usage, err := m.tenantUsage(ctx, tenantID, now)
+	if err != nil {
+		return nil
+	}
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC).Sub(now)
+	if size < 0 {
+		if tier.Queues > 0 && usage.Queues >= tier.Queues {
+			return &TenantQuotaError{Quota: "queues", RetryAfter: nextMonth}
+		}
+		return nil
+	}
+	if tier.Messages > 0 && usage.Messages >= tier.Messages {
+		return &TenantQuotaError{Quota: "messages", RetryAfter: nextMonth}
+	}
+	if tier.Bytes > 0 && usage.Bytes+int64(size) > tier.Bytes {
+		return &TenantQuotaError{Quota: "bytes", RetryAfter: nextMonth}
+	}
+
+	if tier.MessagesPerSecond > 0 {
+		key := fmt.Sprintf("tenant:%s:sends:%d", tenantID, now.Unix())
+		count, err := m.redis.Incr(ctx, key).Result()
+		if err != nil {
+			return nil
+		}
+		if count == 1 {
+			m.redis.Expire(ctx, key, 2*time.Second)
+		}
+		if count > int64(tier.MessagesPerSecond) {
+			return &TenantQuotaError{Quota: "messages_per_second", RetryAfter: now.Truncate(time.Second).Add(time.Second).Sub(now)}
+		}
+	}
+	return nil
+}
+
+// meterTenant adds to a tenant's usage this month
+func (m *Manager) meterTenant(ctx context.Context, tenantID string, queues, messages, bytes int64) {
+	key := tenantUsageKey(tenantID, time.Now())
+	pipe := m.redis.TxPipeline()
+	if queues > 0 {
+		pipe.HIncrBy(ctx, key, "queues", queues)
+	}
+	if messages > 0 {
+		pipe.HIncrBy(ctx, key, "messages", messages)
+	}
+	if bytes > 0 {
+		pipe.HIncrBy(ctx, key, "bytes", bytes)
+	}
+	pipe.Expire(ctx, key, usageRetention)
+	pipe.Exec(ctx)
+}
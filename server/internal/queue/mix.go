@@ -0,0 +1,157 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	mathrand "math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrMixUnavailable is returned for mix_delivery when the relay has mixing disabled
+var ErrMixUnavailable = errors.New("mixed delivery is disabled on this relay")
+
+// Mixed delivery trades latency for resistance to timing correlation
+//
+// A mixed-delivery queue holds new messages back: receives, event streams
+// and WebSocket subscribers see nothing past the last released batch. The
+// first message after a release opens a batch and draws its release time
+// uniformly from (0, mixMaxDelay]; everything sent until then goes out
+// with it, so an observer who sees a message arrive cannot tell which
+// later delivery carried it. Webhooks and push wake-ups wait for the
+// release too
+
+// mixDueKey is a sorted set of queue IDs by the time their open batch is released
+const mixDueKey = "mix:due"
+
+// MixBatch is a released batch, ready to push to subscribers
+type MixBatch struct {
+	Messages      []Message
+	BurnAfterRead bool // Queue mode, so the relay can claim each message before pushing it
+}
+
+// mixReleasedKey holds the highest sequence number released so far
+func mixReleasedKey(queueID string) string {
+	return fmt.Sprintf("queue:%s:mix:released", queueID)
+}
+
+// EnableMixing lets queues opt into mixed delivery, holding each batch at
+// most maxDelay
+func (m *Manager) EnableMixing(maxDelay time.Duration) {
+	m.mixMaxDelay = maxDelay
+}
+
+// mixing reports whether the queue's messages are held for release; should
+// the relay stop mixing, its mixed-delivery queues deliver at once again
+func (m *Manager) mixing(queue *Queue) bool {
+	return queue.MixDelivery && m.mixMaxDelay > 0
+}
+
+// scheduleMixRelease opens a batch for the queue unless one is already open
+func (m *Manager) scheduleMixRelease(ctx context.Context, queueID string, now time.Time) {
+	at := now.Add(time.Duration(mathrand.Int64N(int64(m.mixMaxDelay))) + 1)
+	m.redis.ZAddNX(ctx, mixDueKey, redis.Z{Score: float64(at.UnixMilli()), Member: queueID})
+}
+
+// mixReleased returns the highest sequence number a receive may return
+func (m *Manager) mixReleased(ctx context.Context, queueID string) int64 {
+	released, _ := m.redis.Get(ctx, mixReleasedKey(queueID)).Int64()
+	return released
+}
+
+// DueMixBatches claims up to limit queues whose open batch is due
+func (m *Manager) DueMixBatches(ctx context.Context, limit int) ([]string, error) {
+	members, err := m.redis.ZRangeByScore(ctx, mixDueKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read due batches: %w", err)
+	}
+
+	var due []string
+	for _, queueID := range members {
+		removed, err := m.redis.ZRem(ctx, mixDueKey, queueID).Result()
+		if err != nil {
+			return due, fmt.Errorf("failed to claim batch: %w", err)
+		}
+		if removed > 0 {
+			due = append(due, queueID)
+		}
+	}
+	return due, nil
+}
+
+// ReleaseMixBatch makes a claimed queue's held messages visible and returns
+// them for pushing; webhook deliveries and push wake-ups are scheduled now
+// A replica that dies between claiming and releasing leaves the batch held
+// until the queue's next message opens another
+func (m *Manager) ReleaseMixBatch(ctx context.Context, queueID string) (*MixBatch, error) {
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+	released := m.mixReleased(ctx, queueID)
+
+	listKey := fmt.Sprintf("queue:%s:messages", queueID)
+	messageIDs, err := m.redis.LRange(ctx, listKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message list: %w", err)
+	}
+	batch := &MixBatch{BurnAfterRead: queue.BurnAfterRead}
+	if len(messageIDs) == 0 {
+		return batch, nil
+	}
+
+	messageKeys := make([]string, len(messageIDs))
+	for i, msgID := range messageIDs {
+		messageKeys[i] = fmt.Sprintf("message:%s:%s", queueID, msgID)
+	}
+	values, err := m.redis.MGet(ctx, messageKeys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	// Everything stored past the last release, expired messages aside
+	last := released
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var message Message
+		if err := m.decode(ctx, messageKeys[i], data, &message); err != nil || message.Seq <= released {
+			continue
+		}
+		if err := m.hydrate(ctx, &message); err != nil {
+			continue
+		}
+		batch.Messages = append(batch.Messages, message)
+		last = max(last, message.Seq)
+	}
+	if last == released {
+		return batch, nil
+	}
+
+	pipe := m.redis.TxPipeline()
+	pipe.Set(ctx, mixReleasedKey(queueID), last, 0)
+	pipe.ExpireAt(ctx, mixReleasedKey(queueID), queue.ExpiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to release batch: %w", err)
+	}
+
+	now := time.Now()
+	for _, message := range batch.Messages {
+		if queue.Webhook != nil {
+			m.scheduleWebhook(ctx, WebhookDelivery{QueueID: queueID, MessageID: message.ID}, now)
+		}
+	}
+	if len(queue.PushDevices) > 0 {
+		m.schedulePush(ctx, queueID, now)
+	}
+	return batch, nil
+}
@@ -0,0 +1,233 @@
+package queue
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"privmsg-relay/internal/identity"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrNoticesDisabled = errors.New("operator notices disabled")
+	ErrInvalidNotice   = errors.New("invalid notice")
+)
+
+// NoticeKind tells clients how to react to an operator notice
+type NoticeKind string
+
+const (
+	NoticeInfo        NoticeKind = "info"        // Informational, no action needed
+	NoticeDegraded    NoticeKind = "degraded"    // Service is degraded until Until
+	NoticeMaintenance NoticeKind = "maintenance" // Planned downtime until Until
+	NoticeUpgrade     NoticeKind = "upgrade"     // Clients below MinClientVersion should upgrade
+)
+
+// MaxNoticeDuration caps how long a notice without an end time stays active
+const MaxNoticeDuration = 7 * 24 * time.Hour
+
+const (
+	noticeKey     = "notice:current"
+	noticeChannel = "notices"
+)
+
+// Notice is a machine-readable operator announcement
+type Notice struct {
+	ID               string     `json:"id"`
+	Kind             NoticeKind `json:"kind"`
+	Message          string     `json:"message"`
+	Until            time.Time  `json:"until"`
+	MinClientVersion string     `json:"min_client_version,omitempty"`
+	IssuedAt         time.Time  `json:"issued_at"`
+}
+
+// SignedNotice carries the notice JSON exactly as signed
+// Clients verify Signature over Payload with the pinned relay key, then parse Payload
+type SignedNotice struct {
+	Payload   []byte  `json:"payload"`   // JSON-encoded Notice
+	Signature []byte  `json:"signature"` // Ed25519 over Payload
+	KeyID     string  `json:"key_id"`
+	Notice    *Notice `json:"-"`
+}
+
+// NoticeRequest is sent by operators to publish a notice
+type NoticeRequest struct {
+	Kind             NoticeKind `json:"kind"`
+	Message          string     `json:"message"`
+	Until            time.Time  `json:"until,omitempty"`
+	MinClientVersion string     `json:"min_client_version,omitempty"`
+}
+
+// EnableNotices turns on operator notices signed with key
+func (m *Manager) EnableNotices(key ed25519.PrivateKey) {
+	m.noticeKey = key
+}
+
+// NoticePublicKey returns the key clients verify notices with (nil if disabled)
+func (m *Manager) NoticePublicKey() ed25519.PublicKey {
+	if m.noticeKey == nil {
+		return nil
+	}
+	return m.noticeKey.Public().(ed25519.PublicKey)
+}
+
+// PublishNotice signs a notice, makes it current and pushes it to every replica
+func (m *Manager) PublishNotice(req NoticeRequest) (*SignedNotice, error) {
+	if m.noticeKey == nil {
+		return nil, ErrNoticesDisabled
+	}
+
+	switch req.Kind {
+	case NoticeInfo, NoticeDegraded, NoticeMaintenance, NoticeUpgrade:
+	default:
+		return nil, ErrInvalidNotice
+	}
+	if req.Message == "" {
+		return nil, ErrInvalidNotice
+	}
+
+	now := time.Now()
+	until := req.Until
+	if until.IsZero() || until.Sub(now) > MaxNoticeDuration {
+		until = now.Add(MaxNoticeDuration)
+	}
+	if !until.After(now) {
+		return nil, ErrInvalidNotice
+	}
+
+	id, err := generateRandomID(8)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate notice ID: %w", err)
+	}
+
+	notice := &Notice{
+		ID:               id,
+		Kind:             req.Kind,
+		Message:          req.Message,
+		Until:            until,
+		MinClientVersion: req.MinClientVersion,
+		IssuedAt:         now,
+	}
+	payload, err := json.Marshal(notice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notice: %w", err)
+	}
+
+	signed := &SignedNotice{
+		Payload:   payload,
+		Signature: ed25519.Sign(m.noticeKey, payload),
+		KeyID:     identity.KeyID(m.NoticePublicKey()),
+		Notice:    notice,
+	}
+	data, err := json.Marshal(signed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notice: %w", err)
+	}
+
+	if err := m.redis.Set(m.ctx, noticeKey, data, time.Until(until)).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store notice: %w", err)
+	}
+	if err := m.redis.Publish(m.ctx, noticeChannel, data).Err(); err != nil {
+		return nil, fmt.Errorf("failed to publish notice: %w", err)
+	}
+
+	return signed, nil
+}
+
+// ClearNotice withdraws the current notice
+func (m *Manager) ClearNotice() error {
+	if m.noticeKey == nil {
+		return ErrNoticesDisabled
+	}
+	if err := m.redis.Del(m.ctx, noticeKey).Err(); err != nil {
+		return fmt.Errorf("failed to clear notice: %w", err)
+	}
+	return nil
+}
+
+// CurrentNotice returns the active notice, or nil if there is none
+func (m *Manager) CurrentNotice() (*SignedNotice, error) {
+	if m.noticeKey == nil {
+		return nil, nil
+	}
+
+	data, err := m.redis.Get(m.ctx, noticeKey).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load notice: %w", err)
+	}
+	return parseSignedNotice(data)
+}
+
+// SubscribeNotices delivers notices published by any replica until ctx is done
+func (m *Manager) SubscribeNotices(ctx context.Context) <-chan *SignedNotice {
+	out := make(chan *SignedNotice)
+	pubsub := m.redis.Subscribe(ctx, noticeChannel)
+
+	go func() {
+		defer close(out)
+		defer pubsub.Close()
+
+		for msg := range pubsub.Channel() {
+			signed, err := parseSignedNotice([]byte(msg.Payload))
+			if err != nil {
+				slog.Warn("Ignoring malformed notice", "error", err)
+				continue
+			}
+			select {
+			case out <- signed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// noticeMessage returns the current notice as a synthetic system message,
+// once per queue, so polling clients see it on their next receive
+func (m *Manager) noticeMessage(ctx context.Context, queueID string) *Message {
+	signed, err := m.CurrentNotice()
+	if err != nil || signed == nil {
+		return nil
+	}
+
+	deliveredKey := fmt.Sprintf("notice:%s:delivered", signed.Notice.ID)
+	added, err := m.redis.SAdd(ctx, deliveredKey, queueID).Result()
+	if err != nil || added == 0 {
+		return nil
+	}
+	m.redis.ExpireAt(ctx, deliveredKey, signed.Notice.Until)
+
+	payload, _ := json.Marshal(signed)
+	return &Message{
+		ID:         "notice-" + signed.Notice.ID,
+		QueueID:    queueID,
+		Payload:    payload,
+		ReceivedAt: signed.Notice.IssuedAt,
+		ExpiresAt:  signed.Notice.Until,
+		System:     true,
+	}
+}
+
+func parseSignedNotice(data []byte) (*SignedNotice, error) {
+	var signed SignedNotice
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, fmt.Errorf("failed to parse notice: %w", err)
+	}
+	var notice Notice
+	if err := json.Unmarshal(signed.Payload, &notice); err != nil {
+		return nil, fmt.Errorf("failed to parse notice payload: %w", err)
+	}
+	signed.Notice = &notice
+	return &signed, nil
+}
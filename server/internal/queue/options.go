@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// ErrInvalidPriority is returned for a priority other than normal or high
+var ErrInvalidPriority = errors.New(`priority must be "normal" or "high"`)
+
+// Priority orders the messages one receive returns
+// High-priority messages come first; sequence numbers and cursors are
+// untouched, so a receive never skips a normal message to reach them
+type Priority string
+
+const (
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+)
+
+// valid reports whether p names a priority (empty means normal)
+func (p Priority) valid() bool {
+	return p == "" || p == PriorityNormal || p == PriorityHigh
+}
+
+// Receive limits
+const (
+	MaxReceiveLimit      = 100                    // Most messages one receive returns
+	MaxReceiveWait       = 30 * time.Second       // Longest a receive may long-poll
+	MaxVisibilityTimeout = 12 * time.Hour         // Longest a receive may hide the messages it returns
+	receivePollInterval  = 250 * time.Millisecond // How often a long-poll rechecks the queue
+)
+
+// SendOptions configures SendMessage; the zero value is a plain send
+type SendOptions struct {
+	SendToken      string        // Send token, send link or macaroon (only checked for RequireSendToken queues)
+	TTL            time.Duration // Message lifetime (0 = server default), capped by the server maximum
+	Priority       Priority      // PriorityHigh delivers ahead of normal messages (empty = PriorityNormal)
+	IdempotencyKey string        // Retries with the same key return the original response
+}
+
+// ReceiveOptions configures ReceiveMessages; the zero value returns up to
+// MaxReceiveLimit messages from the start of the queue without waiting
+type ReceiveOptions struct {
+	Cursor string        // Opaque next_cursor from an earlier receive (empty = from the start)
+	Limit  int           // Most messages to return (0 = MaxReceiveLimit)
+	Wait   time.Duration // Long-poll up to Wait (capped at MaxReceiveWait) when nothing is pending
+
+	// Hide the returned messages from other receives until acked or until
+	// the timeout passes, so competing consumers can drain one queue
+	// (0 = off; capped at MaxVisibilityTimeout; not with Cursor)
+	VisibilityTimeout time.Duration
+
+	// Leave out messages a visibility-timeout consumer holds, for push
+	// deliveries that should not hand them to a second reader
+	SkipLeased bool
+}
+
+// prioritize moves high-priority messages ahead of normal ones, keeping
+// relay notices first and sequence order within each group
+func prioritize(messages []Message) {
+	slices.SortStableFunc(messages, func(a, b Message) int {
+		return priorityRank(a) - priorityRank(b)
+	})
+}
+
+func priorityRank(message Message) int {
+	switch {
+	case message.System:
+		return 0
+	case message.Priority == PriorityHigh:
+		return 1
+	}
+	return 2
+}
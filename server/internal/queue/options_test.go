@@ -0,0 +1,71 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPrioritize(t *testing.T) {
+	messages := []Message{
+		{ID: "notice", System: true},
+		{ID: "n1", Seq: 1},
+		{ID: "h2", Seq: 2, Priority: PriorityHigh},
+		{ID: "n3", Seq: 3},
+		{ID: "h4", Seq: 4, Priority: PriorityHigh},
+	}
+	prioritize(messages)
+
+	var order []string
+	for _, message := range messages {
+		order = append(order, message.ID)
+	}
+	if got, want := strings.Join(order, " "), "notice h2 h4 n1 n3"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+}
+
+func TestSendPriority(t *testing.T) {
+	m := testManager(t)
+	ctx := context.Background()
+	created := createTestQueue(t, m, CreateQueueRequest{})
+
+	send := func(priority Priority) string {
+		t.Helper()
+		sent, err := m.SendMessage(ctx, created.QueueID, []byte("message body"), SendOptions{Priority: priority})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sent.MessageID
+	}
+	normal := send("")
+	explicit := send(PriorityNormal)
+	urgent := send(PriorityHigh)
+
+	if _, err := m.SendMessage(ctx, created.QueueID, []byte("message body"), SendOptions{Priority: "urgent"}); !errors.Is(err, ErrInvalidPriority) {
+		t.Errorf("SendMessage() with an unknown priority: error = %v, want %v", err, ErrInvalidPriority)
+	}
+
+	response, err := m.ReceiveMessages(ctx, created.QueueID, created.AccessToken, ReceiveOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Messages) != 3 {
+		t.Fatalf("received %d messages, want 3", len(response.Messages))
+	}
+	want := []struct {
+		id       string
+		priority Priority
+	}{{urgent, PriorityHigh}, {normal, ""}, {explicit, ""}}
+	for i, w := range want {
+		if got := response.Messages[i]; got.ID != w.id || got.Priority != w.priority {
+			t.Errorf("message %d = %s (priority %q), want %s (priority %q)", i, got.ID, got.Priority, w.id, w.priority)
+		}
+	}
+
+	// The cursor still covers every message returned, urgent or not
+	if response.NextCursor != EncodeCursor(3) {
+		t.Errorf("NextCursor = %q, want the cursor after seq 3", response.NextCursor)
+	}
+}
@@ -0,0 +1,235 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"privmsg-relay/internal/transparency"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrInvalidPrekeys = errors.New("invalid prekey upload")
+	ErrTooManyPrekeys = errors.New("too many one-time prekeys")
+	ErrNoPrekeyBundle = errors.New("no prekey bundle uploaded")
+)
+
+// Prekey limits
+const (
+	MaxPrekeySize     = 2048 // Largest key or signature in bytes, room for post-quantum keys
+	MaxOneTimePrekeys = 100  // One-time prekeys a queue holds at once
+)
+
+// Prekey is a public key the recipient published for session setup
+type Prekey struct {
+	KeyID     uint32 `json:"key_id"`
+	PublicKey []byte `json:"public_key"`
+}
+
+// SignedPrekey is a medium-term prekey signed with the identity key
+// The relay stores the signature as-is; senders verify it
+type SignedPrekey struct {
+	KeyID     uint32 `json:"key_id"`
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+}
+
+// PrekeyUploadRequest publishes keys for X3DH-style session setup
+// The identity key and signed prekey replace any earlier ones; one-time
+// prekeys are added to those not yet claimed
+type PrekeyUploadRequest struct {
+	IdentityKey    []byte        `json:"identity_key,omitempty"`
+	SignedPrekey   *SignedPrekey `json:"signed_prekey,omitempty"`
+	OneTimePrekeys []Prekey      `json:"one_time_prekeys,omitempty"`
+}
+
+// PrekeyStatusResponse tells the owner when to upload more one-time prekeys
+type PrekeyStatusResponse struct {
+	IdentityKey    bool  `json:"identity_key"`
+	SignedPrekey   bool  `json:"signed_prekey"`
+	OneTimePrekeys int64 `json:"one_time_prekeys"` // Not yet claimed
+}
+
+// PrekeyBundle is what a sender claims to start a session
+type PrekeyBundle struct {
+	IdentityKey   []byte        `json:"identity_key"`
+	SignedPrekey  *SignedPrekey `json:"signed_prekey"`
+	OneTimePrekey *Prekey       `json:"one_time_prekey,omitempty"` // Absent once they run out
+}
+
+// prekeysKey holds the identity key and signed prekey; oneTimePrekeysKey
+// is a list of unclaimed one-time prekeys, oldest first
+func prekeysKey(queueID string) string {
+	return fmt.Sprintf("queue:%s:prekeys", queueID)
+}
+
+func oneTimePrekeysKey(queueID string) string {
+	return fmt.Sprintf("queue:%s:prekeys:onetime", queueID)
+}
+
+func validPrekey(key []byte) bool {
+	return len(key) > 0 && len(key) <= MaxPrekeySize
+}
+
+// UploadPrekeys publishes the owner's prekeys (requires admin)
+func (m *Manager) UploadPrekeys(ctx context.Context, queueID, accessToken string, req PrekeyUploadRequest) (*PrekeyStatusResponse, error) {
+	duress, err := underDuress(m.authorize(ctx, queueID, accessToken, CapAdmin))
+	if err != nil {
+		return nil, err
+	}
+
+	if req.IdentityKey == nil && req.SignedPrekey == nil && len(req.OneTimePrekeys) == 0 {
+		return nil, ErrInvalidPrekeys
+	}
+	if req.IdentityKey != nil && !validPrekey(req.IdentityKey) {
+		return nil, ErrInvalidPrekeys
+	}
+	if req.SignedPrekey != nil && (!validPrekey(req.SignedPrekey.PublicKey) || !validPrekey(req.SignedPrekey.Signature)) {
+		return nil, ErrInvalidPrekeys
+	}
+	if len(req.OneTimePrekeys) > MaxOneTimePrekeys {
+		return nil, ErrTooManyPrekeys
+	}
+	encoded := make([]interface{}, 0, len(req.OneTimePrekeys))
+	for _, prekey := range req.OneTimePrekeys {
+		if !validPrekey(prekey.PublicKey) {
+			return nil, ErrInvalidPrekeys
+		}
+		data, err := json.Marshal(prekey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal prekey: %w", err)
+		}
+		encoded = append(encoded, data)
+	}
+	if duress {
+		// Report the upload as stored, but neither keep nor log it
+		return &PrekeyStatusResponse{
+			IdentityKey:    req.IdentityKey != nil,
+			SignedPrekey:   req.SignedPrekey != nil,
+			OneTimePrekeys: int64(len(encoded)),
+		}, nil
+	}
+
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(encoded) > 0 {
+		held, err := m.redis.LLen(ctx, oneTimePrekeysKey(queueID)).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to count prekeys: %w", err)
+		}
+		if int(held)+len(encoded) > MaxOneTimePrekeys {
+			return nil, ErrTooManyPrekeys
+		}
+	}
+
+	// Logged first: a bundle served without a log entry would defeat the log
+	if err := m.appendLog(ctx, LogEntry{
+		Kind:           LogKindPrekeys,
+		Subject:        transparency.QueueSubject(queueID),
+		IdentityKey:    req.IdentityKey,
+		SignedPrekey:   req.SignedPrekey,
+		OneTimePrekeys: req.OneTimePrekeys,
+	}); err != nil {
+		return nil, err
+	}
+
+	pipe := m.redis.TxPipeline()
+	if req.IdentityKey != nil {
+		pipe.HSet(ctx, prekeysKey(queueID), "identity_key", req.IdentityKey)
+	}
+	if req.SignedPrekey != nil {
+		data, err := json.Marshal(req.SignedPrekey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal signed prekey: %w", err)
+		}
+		pipe.HSet(ctx, prekeysKey(queueID), "signed_prekey", data)
+	}
+	if len(encoded) > 0 {
+		pipe.RPush(ctx, oneTimePrekeysKey(queueID), encoded...)
+	}
+	pipe.ExpireAt(ctx, prekeysKey(queueID), queue.ExpiresAt)
+	pipe.ExpireAt(ctx, oneTimePrekeysKey(queueID), queue.ExpiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to store prekeys: %w", err)
+	}
+
+	return m.prekeyStatus(ctx, queueID)
+}
+
+// PrekeyStatus reports what the owner has published (requires admin)
+func (m *Manager) PrekeyStatus(ctx context.Context, queueID, accessToken string) (*PrekeyStatusResponse, error) {
+	// Under duress the prekeys were wiped with the queue, so none are reported
+	if _, err := underDuress(m.authorize(ctx, queueID, accessToken, CapAdmin)); err != nil {
+		return nil, err
+	}
+	return m.prekeyStatus(ctx, queueID)
+}
+
+func (m *Manager) prekeyStatus(ctx context.Context, queueID string) (*PrekeyStatusResponse, error) {
+	pipe := m.redis.Pipeline()
+	identity := pipe.HExists(ctx, prekeysKey(queueID), "identity_key")
+	signed := pipe.HExists(ctx, prekeysKey(queueID), "signed_prekey")
+	oneTime := pipe.LLen(ctx, oneTimePrekeysKey(queueID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to load prekey status: %w", err)
+	}
+	return &PrekeyStatusResponse{
+		IdentityKey:    identity.Val(),
+		SignedPrekey:   signed.Val(),
+		OneTimePrekeys: oneTime.Val(),
+	}, nil
+}
+
+// ClaimPrekeys hands a sender the recipient's bundle, consuming one
+// one-time prekey so no two senders ever get the same one; sendToken is
+// checked as for a send, but a send link is not used up
+// Each queue answers at most MaxPrekeyClaimsPerHour claims an hour so
+// nobody can drain the one-time prekeys
+func (m *Manager) ClaimPrekeys(ctx context.Context, queueID, sendToken string) (*PrekeyBundle, error) {
+	queue, err := m.loadQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := m.checkSendToken(ctx, queue, sendToken); err != nil {
+		return nil, err
+	}
+
+	fields, err := m.redis.HGetAll(ctx, prekeysKey(queueID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load prekeys: %w", err)
+	}
+	if fields["identity_key"] == "" || fields["signed_prekey"] == "" {
+		return nil, ErrNoPrekeyBundle
+	}
+	bundle := &PrekeyBundle{IdentityKey: []byte(fields["identity_key"])}
+	if err := json.Unmarshal([]byte(fields["signed_prekey"]), &bundle.SignedPrekey); err != nil {
+		return nil, fmt.Errorf("failed to decode signed prekey: %w", err)
+	}
+
+	allowed, err := m.allowRate("prekey", queueID, MaxPrekeyClaimsPerHour, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrRateLimitExceeded
+	}
+
+	data, err := m.redis.LPop(ctx, oneTimePrekeysKey(queueID)).Bytes()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to claim prekey: %w", err)
+	}
+	if err == nil {
+		var prekey Prekey
+		if json.Unmarshal(data, &prekey) == nil {
+			bundle.OneTimePrekey = &prekey
+		}
+	}
+	return bundle, nil
+}
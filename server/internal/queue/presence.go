@@ -0,0 +1,59 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrPresenceDisabled is returned when a queue's owner has not opted into presence
+var ErrPresenceDisabled = errors.New("presence not enabled for this queue")
+
+// SetPresence lets the owner opt the queue into presence queries, or back
+// out (requires admin); queues start opted out
+func (m *Manager) SetPresence(ctx context.Context, queueID, accessToken string, enabled bool) error {
+	if err := m.authorize(ctx, queueID, accessToken, CapAdmin); err == errDuress {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return err
+	}
+
+	queue.Presence = enabled
+	if err := m.updateQueue(ctx, queue); err != nil {
+		return fmt.Errorf("failed to update presence: %w", err)
+	}
+	return nil
+}
+
+// AuthorizePresence checks that sendToken may ask whether the queue has a
+// connected subscriber: the owner must have opted in, and each queue
+// answers at most MaxPresenceQueriesPerMin queries a minute so nobody can
+// trace when the recipient comes and goes
+// The token is checked first so an opted-out queue looks the same to a
+// stranger as an opted-in one
+func (m *Manager) AuthorizePresence(ctx context.Context, queueID, sendToken string) error {
+	queue, err := m.loadQueue(ctx, queueID)
+	if err != nil {
+		return err
+	}
+	if _, _, err := m.checkSendToken(ctx, queue, sendToken); err != nil {
+		return err
+	}
+	if !queue.Presence {
+		return ErrPresenceDisabled
+	}
+
+	allowed, err := m.allowRate("presence", queueID, MaxPresenceQueriesPerMin, time.Minute)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrRateLimitExceeded
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package queue
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrInvalidPushDevice  = errors.New("invalid push registration")
+	ErrTooManyPushDevices = errors.New("too many push registrations")
+	ErrPushDeviceNotFound = errors.New("push registration not found")
+)
+
+const (
+	MaxPushDevices     = 10   // Devices woken per queue
+	MaxPushTokenLength = 4096 // Generous; FCM tokens are ~160 bytes, APNs 64 hex digits
+	MaxPushTagLength   = 64
+)
+
+// pushDueKey is a sorted set of queues with a wake-up pending, scored by
+// when it is due; a queue is in it at most once, so bursts coalesce
+const pushDueKey = "push:due"
+
+// PushPlatform names the service that delivers a wake-up
+type PushPlatform string
+
+const (
+	PushFCM  PushPlatform = "fcm"  // Firebase Cloud Messaging (Android, web)
+	PushAPNs PushPlatform = "apns" // Apple Push Notification service
+
+	PushUnifiedPush PushPlatform = "unifiedpush" // Token is the endpoint URL from the app's distributor
+	PushNtfy        PushPlatform = "ntfy"        // Token is a topic on the relay's ntfy server
+	PushWebPush     PushPlatform = "webpush"     // Token is the browser subscription endpoint; needs Keys
+)
+
+// WebPushKeys are a browser subscription's encryption keys, base64url
+// encoded as PushSubscription.toJSON() returns them
+type WebPushKeys struct {
+	P256dh string `json:"p256dh"` // Subscriber's P-256 public key, uncompressed
+	Auth   string `json:"auth"`   // 16-byte authentication secret
+}
+
+// PushDevice is a device woken when its queue receives a message
+type PushDevice struct {
+	ID        string       `json:"id"` // Derived from the token; names the registration for removal
+	Platform  PushPlatform `json:"platform"`
+	Token     string       `json:"token"`
+	Tag       string       `json:"tag,omitempty"` // Opaque to the relay, echoed in every push
+	Keys      *WebPushKeys `json:"keys,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// PushRequest registers a device for wake-ups
+// Tag lets an app with several queues tell which one has mail without the
+// relay sending the queue ID through Google or Apple
+type PushRequest struct {
+	Platform PushPlatform `json:"platform"`
+	Token    string       `json:"token"`
+	Tag      string       `json:"tag,omitempty"`
+	Keys     *WebPushKeys `json:"keys,omitempty"` // Web Push only
+}
+
+// PushRegistration is a registered device as shown to the owner (no token)
+type PushRegistration struct {
+	ID        string       `json:"id"`
+	Platform  PushPlatform `json:"platform"`
+	Tag       string       `json:"tag,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// PushListResponse lists a queue's registered devices
+type PushListResponse struct {
+	Devices []PushRegistration `json:"devices"`
+}
+
+// valid checks the keys decode to a P-256 point and a 16-byte secret
+func (k *WebPushKeys) valid() bool {
+	if k == nil {
+		return false
+	}
+	p256dh, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.P256dh, "="))
+	if err != nil {
+		return false
+	}
+	auth, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.Auth, "="))
+	if err != nil || len(auth) != 16 {
+		return false
+	}
+	_, err = ecdh.P256().NewPublicKey(p256dh)
+	return err == nil
+}
+
+func pushDeviceID(platform PushPlatform, token string) string {
+	sum := sha256.Sum256([]byte(string(platform) + ":" + token))
+	return hex.EncodeToString(sum[:8])
+}
+
+func pushQuietKey(queueID string) string {
+	return fmt.Sprintf("queue:%s:push:quiet", queueID)
+}
+
+// RegisterPush adds a device to wake on new messages; registering the same
+// token again updates its tag (requires receive)
+func (m *Manager) RegisterPush(ctx context.Context, queueID, accessToken string, req PushRequest) (*PushRegistration, error) {
+	duress, err := underDuress(m.authorize(ctx, queueID, accessToken, CapReceive))
+	if err != nil {
+		return nil, err
+	}
+	switch req.Platform {
+	case PushFCM, PushAPNs, PushUnifiedPush, PushNtfy, PushWebPush:
+	default:
+		return nil, fmt.Errorf("%w: unknown platform %q", ErrInvalidPushDevice, req.Platform)
+	}
+	if req.Token == "" || len(req.Token) > MaxPushTokenLength || len(req.Tag) > MaxPushTagLength {
+		return nil, ErrInvalidPushDevice
+	}
+	// APNs tokens go into the request path, so only their hex form is accepted
+	if _, err := hex.DecodeString(req.Token); req.Platform == PushAPNs && err != nil {
+		return nil, fmt.Errorf("%w: APNs tokens are hex", ErrInvalidPushDevice)
+	}
+	if req.Platform == PushWebPush && !req.Keys.valid() {
+		return nil, fmt.Errorf("%w: Web Push needs the subscription's p256dh and auth keys", ErrInvalidPushDevice)
+	}
+	if req.Platform != PushWebPush {
+		req.Keys = nil
+	}
+
+	device := PushDevice{
+		ID:        pushDeviceID(req.Platform, req.Token),
+		Platform:  req.Platform,
+		Token:     req.Token,
+		Tag:       req.Tag,
+		Keys:      req.Keys,
+		CreatedAt: time.Now(),
+	}
+	if duress {
+		return device.registration(), nil // Nothing is left to wake
+	}
+
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]PushDevice, 0, len(queue.PushDevices)+1)
+	for _, existing := range queue.PushDevices {
+		if existing.ID != device.ID {
+			devices = append(devices, existing)
+		}
+	}
+	if len(devices) >= MaxPushDevices {
+		return nil, ErrTooManyPushDevices
+	}
+	queue.PushDevices = append(devices, device)
+	if err := m.updateQueue(ctx, queue); err != nil {
+		return nil, fmt.Errorf("failed to store push registration: %w", err)
+	}
+
+	return device.registration(), nil
+}
+
+// ListPush returns the devices woken by the queue (requires receive)
+func (m *Manager) ListPush(ctx context.Context, queueID, accessToken string) (*PushListResponse, error) {
+	if err := m.authorize(ctx, queueID, accessToken, CapReceive); err == errDuress {
+		return &PushListResponse{Devices: []PushRegistration{}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	queue, err := m.loadQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &PushListResponse{Devices: make([]PushRegistration, 0, len(queue.PushDevices))}
+	for _, device := range queue.PushDevices {
+		response.Devices = append(response.Devices, *device.registration())
+	}
+	return response, nil
+}
+
+// UnregisterPush stops waking a device (requires receive)
+func (m *Manager) UnregisterPush(ctx context.Context, queueID, accessToken, deviceID string) error {
+	if err := m.authorize(ctx, queueID, accessToken, CapReceive); err == errDuress {
+		return ErrPushDeviceNotFound // The decoy has no devices
+	} else if err != nil {
+		return err
+	}
+	return m.RemovePushDevice(ctx, queueID, deviceID)
+}
+
+// RemovePushDevice drops a registration, e.g. once the push service reports
+// the token is no longer valid
+func (m *Manager) RemovePushDevice(ctx context.Context, queueID, deviceID string) error {
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return err
+	}
+
+	devices := queue.PushDevices[:0]
+	for _, device := range queue.PushDevices {
+		if device.ID != deviceID {
+			devices = append(devices, device)
+		}
+	}
+	if len(devices) == len(queue.PushDevices) {
+		return ErrPushDeviceNotFound
+	}
+	queue.PushDevices = devices
+	if err := m.updateQueue(ctx, queue); err != nil {
+		return fmt.Errorf("failed to remove push registration: %w", err)
+	}
+	return nil
+}
+
+func (d *PushDevice) registration() *PushRegistration {
+	return &PushRegistration{ID: d.ID, Platform: d.Platform, Tag: d.Tag, CreatedAt: d.CreatedAt}
+}
+
+// schedulePush marks the queue as needing a wake-up; one already pending covers it
+func (m *Manager) schedulePush(ctx context.Context, queueID string, at time.Time) {
+	m.redis.ZAddNX(ctx, pushDueKey, redis.Z{Score: float64(at.UnixMilli()), Member: queueID})
+}
+
+// DuePushes claims up to limit queues whose wake-up is due
+func (m *Manager) DuePushes(ctx context.Context, limit int) ([]string, error) {
+	members, err := m.redis.ZRangeByScore(ctx, pushDueKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read due pushes: %w", err)
+	}
+
+	var due []string
+	for _, queueID := range members {
+		removed, err := m.redis.ZRem(ctx, pushDueKey, queueID).Result()
+		if err != nil {
+			return due, fmt.Errorf("failed to claim push: %w", err)
+		}
+		if removed > 0 {
+			due = append(due, queueID)
+		}
+	}
+	return due, nil
+}
+
+// PushTargets returns the devices to wake for a claimed queue
+// A queue woken less than minInterval ago gets nothing now; its wake-up is
+// put back for when the interval ends, so the last message still gets one
+func (m *Manager) PushTargets(ctx context.Context, queueID string, minInterval time.Duration) ([]PushDevice, error) {
+	queue, err := m.loadQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+	if len(queue.PushDevices) == 0 {
+		return nil, nil
+	}
+
+	if minInterval > 0 {
+		first, err := m.redis.SetNX(ctx, pushQuietKey(queueID), 1, minInterval).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to check push interval: %w", err)
+		}
+		if !first {
+			wait, _ := m.redis.PTTL(ctx, pushQuietKey(queueID)).Result()
+			if wait <= 0 {
+				wait = minInterval
+			}
+			m.schedulePush(ctx, queueID, time.Now().Add(wait))
+			return nil, nil
+		}
+	}
+	return queue.PushDevices, nil
+}
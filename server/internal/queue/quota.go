@@ -0,0 +1,137 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrOverCapacity = errors.New("relay over capacity")
+)
+
+// quotaRefresh is how long measured usage is trusted before re-measuring
+const quotaRefresh = 5 * time.Second
+
+// Quotas are server-wide limits, shared by every replica (0 = unlimited)
+// They protect the one Redis instance everyone's mailboxes live in, so
+// going over them fails new work instead of risking an out-of-memory Redis
+type Quotas struct {
+	MaxQueues            int   // Live queues
+	MaxStoredBytes       int64 // Redis used_memory
+	MaxMessagesPerSecond int   // Accepted sends, across all queues
+}
+
+// CapacityError is returned when a quota is reached
+type CapacityError struct {
+	Quota      string        // queues, storage or messages_per_second
+	RetryAfter time.Duration // When the quota is next re-evaluated
+}
+
+func (e *CapacityError) Error() string {
+	return fmt.Sprintf("%s: %s quota reached", ErrOverCapacity, e.Quota)
+}
+
+func (e *CapacityError) Unwrap() error {
+	return ErrOverCapacity
+}
+
+// quotaUsage caches the measurements quotas are checked against, so the
+// hot path never waits on a keyspace scan
+type quotaUsage struct {
+	mu         sync.Mutex
+	queues     int
+	usedMemory int64
+	measuredAt time.Time
+	measuring  bool
+}
+
+// SetQuotas enables server-wide quotas
+func (m *Manager) SetQuotas(quotas Quotas) {
+	m.quotas = quotas
+}
+
+// checkCreateQuota fails queue creation when the relay is full
+func (m *Manager) checkCreateQuota() error {
+	if m.quotas.MaxQueues <= 0 && m.quotas.MaxStoredBytes <= 0 {
+		return nil
+	}
+	queues, usedMemory := m.usage()
+	if m.quotas.MaxQueues > 0 && queues >= m.quotas.MaxQueues {
+		return &CapacityError{Quota: "queues", RetryAfter: quotaRefresh}
+	}
+	if m.quotas.MaxStoredBytes > 0 && usedMemory >= m.quotas.MaxStoredBytes {
+		return &CapacityError{Quota: "storage", RetryAfter: quotaRefresh}
+	}
+	return nil
+}
+
+// checkSendQuota fails a send of size bytes when storage is full or the
+// relay-wide send rate is exceeded
+// Redis errors are ignored here; the send itself will report them
+func (m *Manager) checkSendQuota(ctx context.Context, size int) error {
+	if m.quotas.MaxStoredBytes > 0 {
+		if _, usedMemory := m.usage(); usedMemory+int64(size) > m.quotas.MaxStoredBytes {
+			return &CapacityError{Quota: "storage", RetryAfter: quotaRefresh}
+		}
+	}
+
+	if m.quotas.MaxMessagesPerSecond > 0 {
+		now := time.Now()
+		key := fmt.Sprintf("quota:sends:%d", now.Unix())
+		count, err := m.redis.Incr(ctx, key).Result()
+		if err != nil {
+			return nil
+		}
+		if count == 1 {
+			m.redis.Expire(ctx, key, 2*time.Second)
+		}
+		if count > int64(m.quotas.MaxMessagesPerSecond) {
+			return &CapacityError{Quota: "messages_per_second", RetryAfter: now.Truncate(time.Second).Add(time.Second).Sub(now)}
+		}
+	}
+	return nil
+}
+
+// usage returns the last measurements, starting a new one in the
+// background when they are stale; before the first measurement everything
+// reads as zero
+func (m *Manager) usage() (queues int, usedMemory int64) {
+	m.quotaUsage.mu.Lock()
+	defer m.quotaUsage.mu.Unlock()
+
+	if time.Since(m.quotaUsage.measuredAt) >= quotaRefresh && !m.quotaUsage.measuring {
+		m.quotaUsage.measuring = true
+		go m.measureUsage()
+	}
+	return m.quotaUsage.queues, m.quotaUsage.usedMemory
+}
+
+// measureUsage refreshes the cached queue count and Redis memory use
+// A failed measurement keeps the previous values
+func (m *Manager) measureUsage() {
+	queues, usedMemory := -1, int64(-1)
+	if m.quotas.MaxQueues > 0 {
+		if stats, err := m.Stats(); err == nil {
+			queues = stats.Queues
+		}
+	}
+	if m.quotas.MaxStoredBytes > 0 {
+		if info, err := m.redis.Info(m.ctx, "memory").Result(); err == nil {
+			usedMemory = infoField(info, "used_memory")
+		}
+	}
+
+	m.quotaUsage.mu.Lock()
+	defer m.quotaUsage.mu.Unlock()
+	if queues >= 0 {
+		m.quotaUsage.queues = queues
+	}
+	if usedMemory >= 0 {
+		m.quotaUsage.usedMemory = usedMemory
+	}
+	m.quotaUsage.measuredAt = time.Now()
+	m.quotaUsage.measuring = false
+}
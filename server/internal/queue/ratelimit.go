@@ -0,0 +1,39 @@
+package queue
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// CheckCreateRateLimit enforces MaxQueuesPerIP queue creations per client IP per hour
+func (m *Manager) CheckCreateRateLimit(clientIP string) error {
+	allowed, err := m.allowRate("create", clientIP, MaxQueuesPerIP, time.Hour)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrRateLimitExceeded
+	}
+	return nil
+}
+
+// allowRate counts one hit against a fixed window and reports whether it is within limit
+// Subjects are hashed so raw client IPs never land in Redis
+func (m *Manager) allowRate(action, subject string, limit int, window time.Duration) (bool, error) {
+	sum := sha256.Sum256([]byte(subject))
+	key := fmt.Sprintf("ratelimit:%s:%s", action, hex.EncodeToString(sum[:16]))
+
+	count, err := m.redis.Incr(m.ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to update rate limit: %w", err)
+	}
+
+	// First hit in the window starts the clock
+	if count == 1 {
+		m.redis.Expire(m.ctx, key, window)
+	}
+
+	return count <= int64(limit), nil
+}
@@ -0,0 +1,48 @@
+package queue
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidRegion is returned for a region tag that cannot be embedded in queue IDs
+var ErrInvalidRegion = errors.New("invalid region tag (want 1-32 lowercase letters and digits)")
+
+// regionSeparator splits the home-region tag from the random part of a queue ID
+const regionSeparator = "-"
+
+// regionPattern is what a region tag may look like; HomeRegion cuts IDs at
+// the first separator, so a tag must not contain one
+var regionPattern = regexp.MustCompile(`^[a-z0-9]{1,32}$`)
+
+// ValidRegion reports whether tag can serve as a home-region tag
+func ValidRegion(tag string) bool {
+	return regionPattern.MatchString(tag)
+}
+
+// SetRegion makes new queues carry the given home-region tag in their ID
+func (m *Manager) SetRegion(region string) error {
+	if !ValidRegion(region) {
+		return ErrInvalidRegion
+	}
+	m.region = region
+	return nil
+}
+
+// HomeRegion returns the region tag embedded in a queue ID ("" for untagged IDs)
+func HomeRegion(queueID string) string {
+	region, _, found := strings.Cut(queueID, regionSeparator)
+	if !found {
+		return ""
+	}
+	return region
+}
+
+// withRegion prefixes a freshly generated queue ID with the local region tag
+func (m *Manager) withRegion(queueID string) string {
+	if m.region == "" {
+		return queueID
+	}
+	return m.region + regionSeparator + queueID
+}
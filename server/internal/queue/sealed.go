@@ -0,0 +1,31 @@
+package queue
+
+import "errors"
+
+// ErrInvalidEnvelope is returned for a payload sent to a sealed-sender
+// queue that is not framed as a sealed envelope
+var ErrInvalidEnvelope = errors.New("payload is not a sealed-sender envelope")
+
+// Sealed-sender envelope layout:
+//
+//	version (1) | ephemeral X25519 public key (32) | nonce (24) | box (16+)
+//
+// The box is NaCl crypto_box from the ephemeral key to the recipient's
+// identity key. Everything that names the sender, including its sender
+// certificate, is inside it, so only the recipient can tell who wrote a
+// message and only the recipient verifies the certificate. The relay checks
+// the framing and nothing else
+const (
+	SealedEnvelopeVersion = 0x01
+	SealedEnvelopeMinSize = 1 + 32 + 24 + 16
+)
+
+// checkSealedEnvelope rejects payloads that cannot be sealed envelopes, so
+// a misconfigured client cannot send a readable header to a queue whose
+// owner asked for sealed sender
+func checkSealedEnvelope(payload []byte) error {
+	if len(payload) < SealedEnvelopeMinSize || payload[0] != SealedEnvelopeVersion {
+		return ErrInvalidEnvelope
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// testManager returns a Manager on the Redis at REDIS_TEST_ADDR, skipping
+// the test when none is configured
+func testManager(t *testing.T) *Manager {
+	t.Helper()
+	addr := os.Getenv("REDIS_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_TEST_ADDR not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("Redis at %s unreachable: %v", addr, err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return NewManager(client)
+}
+
+// sealedEnvelope returns a payload framed like a sealed envelope
+func sealedEnvelope() []byte {
+	payload := bytes.Repeat([]byte{0xab}, SealedEnvelopeMinSize+8)
+	payload[0] = SealedEnvelopeVersion
+	return payload
+}
+
+func TestCheckSealedEnvelope(t *testing.T) {
+	short := sealedEnvelope()[:SealedEnvelopeMinSize-1]
+	wrongVersion := sealedEnvelope()
+	wrongVersion[0] = 0x02
+
+	tests := []struct {
+		name    string
+		payload []byte
+		want    error
+	}{
+		{"envelope", sealedEnvelope(), nil},
+		{"smallest envelope", sealedEnvelope()[:SealedEnvelopeMinSize], nil},
+		{"empty", nil, ErrInvalidEnvelope},
+		{"too short", short, ErrInvalidEnvelope},
+		{"wrong version", wrongVersion, ErrInvalidEnvelope},
+		{"plaintext", []byte(`{"from":"alice","text":"hello there, this is long enough to pass the size check"}`), ErrInvalidEnvelope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkSealedEnvelope(tt.payload); err != tt.want {
+				t.Errorf("checkSealedEnvelope() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSealedSendRejectsPlainPayload(t *testing.T) {
+	m := testManager(t)
+	ctx := context.Background()
+
+	created, err := m.CreateQueue(ctx, CreateQueueRequest{SealedSender: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.DeleteQueue(ctx, created.QueueID, created.AccessToken) })
+
+	_, err = m.SendMessage(ctx, created.QueueID, []byte("hello from alice, in the clear and long enough"), SendOptions{})
+	if !errors.Is(err, ErrInvalidEnvelope) {
+		t.Fatalf("SendMessage() error = %v, want %v", err, ErrInvalidEnvelope)
+	}
+}
+
+// sendAsMember stores one envelope sent with a member token and returns the
+// queue, the member and the stored message
+func sendAsMember(t *testing.T, m *Manager, sealed bool) (*CreateQueueResponse, Member, *Message) {
+	t.Helper()
+	ctx := context.Background()
+
+	created, err := m.CreateQueue(ctx, CreateQueueRequest{RequireSendToken: true, SealedSender: sealed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.DeleteQueue(ctx, created.QueueID, created.AccessToken) })
+
+	members, err := m.AddMembers(ctx, created.QueueID, created.AccessToken, MembersRequest{Count: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	member := members.Members[0]
+
+	sent, err := m.SendMessage(ctx, created.QueueID, sealedEnvelope(), SendOptions{SendToken: member.SendToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := m.GetMessage(ctx, created.QueueID, sent.MessageID, created.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created, member, message
+}
+
+func TestSealedSendKeepsNoSender(t *testing.T) {
+	m := testManager(t)
+	m.EnableReceipts(time.Hour)
+	m.EnableJournal(time.Hour)
+	ctx := context.Background()
+
+	created, member, message := sendAsMember(t, m, true)
+	if message.SenderID != "" {
+		t.Errorf("SenderID = %q, want none on a sealed-sender queue", message.SenderID)
+	}
+
+	// Nothing in Redis but the member list itself may name the member or
+	// hold its token: not the message, its receipt, the journal or stats
+	iter := m.redis.Scan(ctx, 0, "*", 500).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if key == membersKey(created.QueueID) {
+			continue
+		}
+		dump := key + " " + redisValue(t, m, key)
+		if strings.Contains(dump, member.MemberID) || strings.Contains(dump, member.SendToken) {
+			t.Errorf("%s holds the sender's member ID or token", key)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnsealedSendNamesMember(t *testing.T) {
+	m := testManager(t)
+
+	// The control case: the same send on an ordinary queue is attributed
+	_, member, message := sendAsMember(t, m, false)
+	if message.SenderID != member.MemberID {
+		t.Errorf("SenderID = %q, want %q", message.SenderID, member.MemberID)
+	}
+}
+
+// redisValue renders whatever a key holds as text
+func redisValue(t *testing.T, m *Manager, key string) string {
+	t.Helper()
+	ctx := context.Background()
+	kind, err := m.redis.Type(ctx, key).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value interface{}
+	switch kind {
+	case "string":
+		value, err = m.redis.Get(ctx, key).Result()
+	case "list":
+		value, err = m.redis.LRange(ctx, key, 0, -1).Result()
+	case "hash":
+		value, err = m.redis.HGetAll(ctx, key).Result()
+	case "set":
+		value, err = m.redis.SMembers(ctx, key).Result()
+	case "zset":
+		value, err = m.redis.ZRangeWithScores(ctx, key, 0, -1).Result()
+	case "none":
+		return "" // Expired while scanning
+	}
+	if err != nil && err != redis.Nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprint(value)
+}
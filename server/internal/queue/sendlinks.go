@@ -0,0 +1,162 @@
+package queue
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrSendLinksUnavailable = errors.New("send links require a queue created with require_send_token")
+	ErrTooManySendLinks     = errors.New("too many outstanding send links")
+	ErrInvalidSendLinks     = errors.New("invalid send link request")
+)
+
+// Send link limits
+const (
+	MaxSendLinksPerRequest = 50
+	MaxSendLinksPerQueue   = 500
+)
+
+// SendLinksRequest asks for single-use send credentials
+type SendLinksRequest struct {
+	Count      int   `json:"count,omitempty"`       // How many links to mint (default 1)
+	TTLSeconds int64 `json:"ttl_seconds,omitempty"` // Link lifetime (default and cap: the queue's remaining lifetime)
+}
+
+// SendLink is a credential that allows posting exactly one message
+type SendLink struct {
+	SendToken string    `json:"send_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SendLinksResponse is returned after minting send links
+type SendLinksResponse struct {
+	SendURL string     `json:"send_url"` // Where to POST with the send token as bearer
+	Links   []SendLink `json:"links"`
+}
+
+// sendLinkID hashes a link token so the raw credential is never stored
+func sendLinkID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:16])
+}
+
+// MintSendLinks creates single-use send credentials for a send-token queue
+// Links are kept in queue:{id}:sendlinks, a hash of link ID -> expiry (unix seconds)
+func (m *Manager) MintSendLinks(ctx context.Context, queueID, accessToken string, req SendLinksRequest) (*SendLinksResponse, error) {
+	// Verify access token grants admin and is not a macaroon
+	if err := m.authorizeMinting(ctx, queueID, accessToken); err == errDuress {
+		return m.decoySendLinks(ctx, queueID, accessToken, req)
+	} else if err != nil {
+		return nil, err
+	}
+
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+	if queue.SendToken == "" {
+		return nil, ErrSendLinksUnavailable
+	}
+
+	count := req.Count
+	if count == 0 {
+		count = 1
+	}
+	if count < 0 || count > MaxSendLinksPerRequest || req.TTLSeconds < 0 {
+		return nil, ErrInvalidSendLinks
+	}
+
+	expiresAt := queue.ExpiresAt
+	if req.TTLSeconds > 0 {
+		if requested := time.Now().Add(time.Duration(req.TTLSeconds) * time.Second); requested.Before(expiresAt) {
+			expiresAt = requested
+		}
+	}
+
+	indexKey := fmt.Sprintf("queue:%s:sendlinks", queueID)
+	if err := m.pruneSendLinks(ctx, indexKey); err != nil {
+		return nil, err
+	}
+	outstanding, err := m.redis.HLen(ctx, indexKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count send links: %w", err)
+	}
+	if int(outstanding)+count > MaxSendLinksPerQueue {
+		return nil, ErrTooManySendLinks
+	}
+
+	links := make([]SendLink, 0, count)
+	fields := make(map[string]interface{}, count)
+	for i := 0; i < count; i++ {
+		token, err := generateRandomID(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate send link: %w", err)
+		}
+		links = append(links, SendLink{SendToken: token, ExpiresAt: expiresAt})
+		fields[sendLinkID(token)] = expiresAt.Unix()
+	}
+
+	pipe := m.redis.TxPipeline()
+	pipe.HSet(ctx, indexKey, fields)
+	pipe.ExpireAt(ctx, indexKey, queue.ExpiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to store send links: %w", err)
+	}
+
+	return &SendLinksResponse{
+		SendURL: fmt.Sprintf("/v1/queue/%s/send", queueID),
+		Links:   links,
+	}, nil
+}
+
+// pruneSendLinks drops expired links so they stop counting toward
+// MaxSendLinksPerQueue
+func (m *Manager) pruneSendLinks(ctx context.Context, indexKey string) error {
+	links, err := m.redis.HGetAll(ctx, indexKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list send links: %w", err)
+	}
+	now := time.Now().Unix()
+	var expired []string
+	for id, expiry := range links {
+		if unix, err := strconv.ParseInt(expiry, 10, 64); err != nil || now >= unix {
+			expired = append(expired, id)
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	if err := m.redis.HDel(ctx, indexKey, expired...).Err(); err != nil {
+		return fmt.Errorf("failed to prune send links: %w", err)
+	}
+	return nil
+}
+
+// hasSendLink reports whether token is an unexpired send link for the queue
+func (m *Manager) hasSendLink(ctx context.Context, queueID, token string) bool {
+	indexKey := fmt.Sprintf("queue:%s:sendlinks", queueID)
+	expiry, err := m.redis.HGet(ctx, indexKey, sendLinkID(token)).Result()
+	if err != nil {
+		return false
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	return err == nil && time.Now().Unix() < unix
+}
+
+// consumeSendLink invalidates a send link; only the first caller gets true
+func (m *Manager) consumeSendLink(ctx context.Context, queueID, token string) bool {
+	indexKey := fmt.Sprintf("queue:%s:sendlinks", queueID)
+	removed, err := m.redis.HDel(ctx, indexKey, sendLinkID(token)).Result()
+	if err != nil && err != redis.Nil {
+		return false
+	}
+	return removed == 1
+}
@@ -0,0 +1,18 @@
+package queue
+
+import "context"
+
+// AuthorizeSignal checks that sendToken may send to a queue, without
+// spending a send link, so the relay can pass the sender's ephemeral
+// signals to its subscribers
+func (m *Manager) AuthorizeSignal(ctx context.Context, queueID, sendToken string) error {
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return err
+	}
+	if queue.Frozen {
+		return ErrQueueFrozen
+	}
+	_, _, err = m.checkSendToken(ctx, queue, sendToken)
+	return err
+}
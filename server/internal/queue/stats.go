@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statsCacheTTL bounds how often aggregate stats rescan the keyspace
+const statsCacheTTL = 30 * time.Second
+
+// Stats are aggregate counters; they never identify individual queues
+type Stats struct {
+	Queues           int                     `json:"queues"`
+	Messages         int                     `json:"messages"`
+	RateLimitBuckets map[string]int          `json:"rate_limit_buckets"`  // Active limit windows per action
+	RateLimited      map[string]int          `json:"rate_limited"`        // Windows currently over their limit
+	Lifecycle        map[MessageStatus]int64 `json:"lifecycle,omitempty"` // Messages that ever reached each status (receipts only)
+	ComputedAt       time.Time               `json:"computed_at"`
+}
+
+type statsCache struct {
+	mu    sync.Mutex
+	stats *Stats
+}
+
+// rateLimits maps rate-limit actions to their per-window limits
+var rateLimits = map[string]int{
+	"create":    MaxQueuesPerIP,
+	"presence":  MaxPresenceQueriesPerMin,
+	"prekey":    MaxPrekeyClaimsPerHour,
+	"discovery": MaxDiscoveryLookupsPerHour,
+}
+
+// Stats scans the keyspace for aggregate counts, cached for statsCacheTTL
+func (m *Manager) Stats() (*Stats, error) {
+	m.stats.mu.Lock()
+	defer m.stats.mu.Unlock()
+
+	if m.stats.stats != nil && time.Since(m.stats.stats.ComputedAt) < statsCacheTTL {
+		return m.stats.stats, nil
+	}
+
+	stats := &Stats{
+		RateLimitBuckets: map[string]int{},
+		RateLimited:      map[string]int{},
+		ComputedAt:       time.Now(),
+	}
+
+	// queue:{id} has exactly one colon; sub-keys like queue:{id}:messages have more
+	err := m.scan("queue:*", func(key string) {
+		if strings.Count(key, ":") == 1 {
+			stats.Queues++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.scan("message:*", func(string) { stats.Messages++ }); err != nil {
+		return nil, err
+	}
+
+	var limitedKeys []string
+	err = m.scan("ratelimit:*", func(key string) {
+		parts := strings.SplitN(key, ":", 3)
+		if len(parts) != 3 {
+			return
+		}
+		stats.RateLimitBuckets[parts[1]]++
+		if _, ok := rateLimits[parts[1]]; ok {
+			limitedKeys = append(limitedKeys, key)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range limitedKeys {
+		action := strings.SplitN(key, ":", 3)[1]
+		count, err := m.redis.Get(m.ctx, key).Int()
+		if err == nil && count > rateLimits[action] {
+			stats.RateLimited[action]++
+		}
+	}
+
+	if m.receiptRetention > 0 {
+		if stats.Lifecycle, err = m.lifecycleStats(); err != nil {
+			return nil, err
+		}
+	}
+
+	m.stats.stats = stats
+	return stats, nil
+}
+
+// scan calls fn for every key matching pattern
+func (m *Manager) scan(pattern string, fn func(key string)) error {
+	iter := m.redis.Scan(m.ctx, 0, pattern, 500).Iterator()
+	for iter.Next(m.ctx) {
+		fn(iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to scan %s: %w", pattern, err)
+	}
+	return nil
+}
+
+// Ping measures the Redis round trip
+func (m *Manager) Ping() (time.Duration, error) {
+	start := time.Now()
+	if err := m.redis.Ping(m.ctx).Err(); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
@@ -0,0 +1,191 @@
+package queue
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrReceiptsDisabled = errors.New("delivery receipts disabled")
+	ErrReceiptNotFound  = errors.New("receipt not found")
+)
+
+// ReceiptTokenPrefix marks receipt tokens so they are not confused with queue tokens
+const ReceiptTokenPrefix = "rcpt_"
+
+// lifecycleStatsKey counts messages that reached each status, relay-wide
+const lifecycleStatsKey = "stats:lifecycle"
+
+// MessageStatus is how far a message has got towards its recipient
+type MessageStatus string
+
+const (
+	StatusStored    MessageStatus = "stored"    // Accepted, not yet delivered
+	StatusDelivered MessageStatus = "delivered" // Pushed to a WebSocket or event stream subscriber
+	StatusFetched   MessageStatus = "fetched"   // Returned by a receive call
+	StatusAcked     MessageStatus = "acked"     // Deleted by the recipient (or by reading it, on burn-after-read queues)
+	StatusExpired   MessageStatus = "expired"   // Expired before it was acked
+)
+
+// statusRanks orders statuses; a message only ever moves forward, and the
+// two final statuses never replace each other
+var statusRanks = map[MessageStatus]int{
+	StatusStored:    0,
+	StatusDelivered: 1,
+	StatusFetched:   2,
+	StatusAcked:     3,
+	StatusExpired:   3,
+}
+
+// statusEvents maps journal events to the status they move a message to
+var statusEvents = map[JournalEventType]MessageStatus{
+	EventNotified: StatusDelivered,
+	EventFetched:  StatusFetched,
+	EventAcked:    StatusAcked,
+	EventExpired:  StatusExpired,
+}
+
+// ReceiptResponse is what the sender learns from a receipt
+// It deliberately carries nothing about the queue or the recipient
+type ReceiptResponse struct {
+	Status MessageStatus `json:"status"`
+}
+
+// statusKey holds a message's status record, keyed by a hash of its
+// receipt token so a Redis dump does not hand out working tokens
+func statusKey(tokenHash string) string {
+	return "receipt:" + tokenHash
+}
+
+// messageStatusKey links a message to its status record; it lives as long
+// as the record so an expiry noticed after the fact still lands
+func messageStatusKey(queueID, messageID string) string {
+	return fmt.Sprintf("queue:%s:receipt:%s", queueID, messageID)
+}
+
+func hashReceiptToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// advanceStatusScript moves a status record to a later status, never back,
+// never recreating one that has already expired, and counts the move
+var advanceStatusScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local rank = tonumber(redis.call('HGET', KEYS[1], 'rank') or '0')
+if rank >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'status', ARGV[2], 'rank', ARGV[1])
+redis.call('HINCRBY', KEYS[2], ARGV[2], 1)
+return 1
+`)
+
+// EnableReceipts tracks every message's status and issues its sender a
+// receipt token; status records outlive their message by retention
+func (m *Manager) EnableReceipts(retention time.Duration) {
+	m.receiptRetention = retention
+}
+
+// createStatus starts tracking a new message and returns its receipt token
+func (m *Manager) createStatus(ctx context.Context, message *Message, ttl time.Duration) (string, error) {
+	token, err := generateRandomID(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate receipt token: %w", err)
+	}
+	token = ReceiptTokenPrefix + token
+	tokenHash := hashReceiptToken(token)
+
+	pipe := m.redis.TxPipeline()
+	pipe.HSet(ctx, statusKey(tokenHash),
+		"status", string(StatusStored),
+		"rank", statusRanks[StatusStored],
+		"expires_at", message.ExpiresAt.Unix())
+	pipe.Expire(ctx, statusKey(tokenHash), ttl+m.receiptRetention)
+	pipe.Set(ctx, messageStatusKey(message.QueueID, message.ID), tokenHash, ttl+m.receiptRetention)
+	pipe.HIncrBy(ctx, lifecycleStatsKey, string(StatusStored), 1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", fmt.Errorf("failed to store message status: %w", err)
+	}
+	return token, nil
+}
+
+// advanceStatus updates the status of the message an event happened to
+func (m *Manager) advanceStatus(queueID string, eventType JournalEventType, messageID string) {
+	if m.receiptRetention <= 0 {
+		return
+	}
+	status, ok := statusEvents[eventType]
+	if !ok {
+		return
+	}
+
+	linkKey := messageStatusKey(queueID, messageID)
+	tokenHash, err := m.redis.Get(m.ctx, linkKey).Result()
+	if err != nil {
+		return // Untracked, or the message is already gone
+	}
+	advanceStatusScript.Run(m.ctx, m.redis, []string{statusKey(tokenHash), lifecycleStatsKey}, statusRanks[status], string(status))
+	if statusRanks[status] == statusRanks[StatusAcked] {
+		m.redis.Del(m.ctx, linkKey)
+	}
+}
+
+// GetReceipt reports a message's status to whoever holds its receipt
+// token; once it reports acked or expired the record is deleted
+func (m *Manager) GetReceipt(ctx context.Context, token string) (*ReceiptResponse, error) {
+	if m.receiptRetention <= 0 {
+		return nil, ErrReceiptsDisabled
+	}
+	if !strings.HasPrefix(token, ReceiptTokenPrefix) {
+		return nil, ErrReceiptNotFound
+	}
+
+	key := statusKey(hashReceiptToken(token))
+	fields, err := m.redis.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load receipt: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, ErrReceiptNotFound
+	}
+
+	// Redis drops expired messages silently, so expiry is noticed here
+	status := MessageStatus(fields["status"])
+	expiresAt, _ := strconv.ParseInt(fields["expires_at"], 10, 64)
+	if statusRanks[status] < statusRanks[StatusAcked] && time.Now().Unix() >= expiresAt {
+		status = StatusExpired
+		advanceStatusScript.Run(ctx, m.redis, []string{key, lifecycleStatsKey}, statusRanks[status], string(status))
+	}
+	if statusRanks[status] == statusRanks[StatusAcked] {
+		m.redis.Del(ctx, key)
+	}
+
+	return &ReceiptResponse{Status: status}, nil
+}
+
+// lifecycleStats returns how many messages have reached each status
+func (m *Manager) lifecycleStats() (map[MessageStatus]int64, error) {
+	counts, err := m.redis.HGetAll(m.ctx, lifecycleStatsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lifecycle stats: %w", err)
+	}
+	if len(counts) == 0 {
+		return nil, nil
+	}
+	stats := make(map[MessageStatus]int64, len(counts))
+	for status, count := range counts {
+		stats[MessageStatus(status)], _ = strconv.ParseInt(count, 10, 64)
+	}
+	return stats, nil
+}
@@ -0,0 +1,363 @@
+package queue
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrTenancyDisabled   = errors.New("tenancy disabled")
+	ErrTenantNotFound    = errors.New("tenant not found")
+	ErrTenantKeyNotFound = errors.New("tenant API key not found")
+	ErrInvalidTenant     = errors.New("invalid tenant request")
+	ErrInvalidTenantKey  = errors.New("invalid tenant API key")
+	ErrTenantKeyRequired = errors.New("tenant API key required")
+	ErrTooManyTenantKeys = errors.New("too many tenant API keys")
+)
+
+// Tenant limits
+const (
+	MaxTenantNameLength = 100
+	MaxTenantKeys       = 20
+
+	tenantKeyPrefix = "tk_" // Marks tenant API keys, so they are told apart from queue tokens
+)
+
+// Tenant is an organization a hosting operator issued API keys to
+// The relay only learns which tenant created a queue, never who uses it
+type Tenant struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	CreatedAt time.Time    `json:"created_at"`
+	Tier      string       `json:"tier,omitempty"`  // Quotas the tenant is held to (empty = unlimited)
+	Queues    int64        `json:"queues"`          // Live queues created with the tenant's keys
+	Usage     *TenantUsage `json:"usage,omitempty"` // This month's usage
+	Keys      []TenantKey  `json:"keys"`
+}
+
+// TenantKey describes an API key without revealing it
+type TenantKey struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	APIKey    string    `json:"api_key,omitempty"` // The secret (shown only once)
+}
+
+// CreateTenantRequest is sent to POST /admin/tenants
+type CreateTenantRequest struct {
+	Name string `json:"name"`
+	Tier string `json:"tier,omitempty"` // Default: the relay's default tier
+}
+
+// tenantKeyRecord is stored at tenantkey:{key ID}
+type tenantKeyRecord struct {
+	TenantID  string    `json:"tenant_id"`
+	Hash      string    `json:"hash"` // Hex SHA-256 of the API key
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const tenantsKey = "tenants" // Set of tenant IDs
+
+func tenantKey(tenantID string) string {
+	return fmt.Sprintf("tenant:%s", tenantID)
+}
+
+// tenantKeysKey is the set of a tenant's API key IDs
+func tenantKeysKey(tenantID string) string {
+	return fmt.Sprintf("tenant:%s:keys", tenantID)
+}
+
+// tenantQueuesKey is a sorted set of the tenant's queue IDs, scored by expiry
+func tenantQueuesKey(tenantID string) string {
+	return fmt.Sprintf("tenant:%s:queues", tenantID)
+}
+
+func tenantAPIKeyKey(keyID string) string {
+	return fmt.Sprintf("tenantkey:%s", keyID)
+}
+
+// tenantKeyID derives an API key's public ID, so the key is never stored
+func tenantKeyID(apiKey string) (id, hash string) {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8]), hex.EncodeToString(sum[:])
+}
+
+// EnableTenancy lets operators issue tenant API keys and attributes queues
+// created with one to its tenant
+func (m *Manager) EnableTenancy() {
+	m.tenancy = true
+}
+
+// TenancyEnabled reports whether tenant API keys are accepted
+func (m *Manager) TenancyEnabled() bool {
+	return m.tenancy
+}
+
+// CreateTenant registers a tenant; it has no API keys yet
+func (m *Manager) CreateTenant(ctx context.Context, req CreateTenantRequest) (*Tenant, error) {
+	if !m.tenancy {
+		return nil, ErrTenancyDisabled
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > MaxTenantNameLength {
+		return nil, ErrInvalidTenant
+	}
+	tier := req.Tier
+	if tier == "" {
+		tier = m.defaultTier
+	} else if _, ok := m.tiers[tier]; !ok {
+		return nil, ErrUnknownTier
+	}
+
+	id, err := generateRandomID(8)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate tenant ID: %w", err)
+	}
+	tenant := &Tenant{ID: id, Name: name, CreatedAt: time.Now().UTC(), Tier: tier, Keys: []TenantKey{}}
+	data, err := json.Marshal(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := m.redis.TxPipeline()
+	pipe.Set(ctx, tenantKey(id), data, 0)
+	pipe.SAdd(ctx, tenantsKey, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to store tenant: %w", err)
+	}
+	return tenant, nil
+}
+
+// GetTenant returns a tenant with its live queue count, this month's usage
+// and API keys
+func (m *Manager) GetTenant(ctx context.Context, tenantID string) (*Tenant, error) {
+	if !m.tenancy {
+		return nil, ErrTenancyDisabled
+	}
+	tenant, err := m.tenantRecord(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if tenant.Queues, err = m.countTenantQueues(ctx, tenantID); err != nil {
+		return nil, err
+	}
+	if tenant.Usage, err = m.tenantUsage(ctx, tenantID, time.Now()); err != nil {
+		return nil, err
+	}
+	keyIDs, err := m.redis.SMembers(ctx, tenantKeysKey(tenantID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenant API keys: %w", err)
+	}
+	tenant.Keys = []TenantKey{}
+	for _, keyID := range keyIDs {
+		record, err := m.tenantKeyRecord(ctx, keyID)
+		if err != nil {
+			continue // Revoked concurrently
+		}
+		tenant.Keys = append(tenant.Keys, TenantKey{ID: keyID, CreatedAt: record.CreatedAt})
+	}
+	sort.Slice(tenant.Keys, func(i, j int) bool { return tenant.Keys[i].CreatedAt.Before(tenant.Keys[j].CreatedAt) })
+	return tenant, nil
+}
+
+// ListTenants returns every tenant, oldest first
+func (m *Manager) ListTenants(ctx context.Context) ([]Tenant, error) {
+	if !m.tenancy {
+		return nil, ErrTenancyDisabled
+	}
+	ids, err := m.redis.SMembers(ctx, tenantsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	tenants := make([]Tenant, 0, len(ids))
+	for _, id := range ids {
+		tenant, err := m.GetTenant(ctx, id)
+		if err == ErrTenantNotFound {
+			continue // Deleted concurrently
+		}
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, *tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].CreatedAt.Before(tenants[j].CreatedAt) })
+	return tenants, nil
+}
+
+// DeleteTenant revokes a tenant's API keys and forgets it; its queues live
+// on until they expire, attributed to no one and unmetered, and its usage
+// records until they expire
+func (m *Manager) DeleteTenant(ctx context.Context, tenantID string) error {
+	if !m.tenancy {
+		return ErrTenancyDisabled
+	}
+	if _, err := m.redis.Get(ctx, tenantKey(tenantID)).Result(); err == redis.Nil {
+		return ErrTenantNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to get tenant: %w", err)
+	}
+
+	keyIDs, err := m.redis.SMembers(ctx, tenantKeysKey(tenantID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list tenant API keys: %w", err)
+	}
+	pipe := m.redis.TxPipeline()
+	for _, keyID := range keyIDs {
+		pipe.Del(ctx, tenantAPIKeyKey(keyID))
+	}
+	pipe.Del(ctx, tenantKeysKey(tenantID), tenantQueuesKey(tenantID), tenantKey(tenantID))
+	pipe.SRem(ctx, tenantsKey, tenantID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete tenant: %w", err)
+	}
+	return nil
+}
+
+// CreateTenantKey issues an API key for a tenant
+func (m *Manager) CreateTenantKey(ctx context.Context, tenantID string) (*TenantKey, error) {
+	if !m.tenancy {
+		return nil, ErrTenancyDisabled
+	}
+	if _, err := m.redis.Get(ctx, tenantKey(tenantID)).Result(); err == redis.Nil {
+		return nil, ErrTenantNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get tenant: %w", err)
+	}
+	count, err := m.redis.SCard(ctx, tenantKeysKey(tenantID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tenant API keys: %w", err)
+	}
+	if count >= MaxTenantKeys {
+		return nil, ErrTooManyTenantKeys
+	}
+
+	secret, err := generateRandomID(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	apiKey := tenantKeyPrefix + secret
+	keyID, hash := tenantKeyID(apiKey)
+	record := tenantKeyRecord{TenantID: tenantID, Hash: hash, CreatedAt: time.Now().UTC()}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := m.redis.TxPipeline()
+	pipe.Set(ctx, tenantAPIKeyKey(keyID), data, 0)
+	pipe.SAdd(ctx, tenantKeysKey(tenantID), keyID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to store API key: %w", err)
+	}
+	return &TenantKey{ID: keyID, CreatedAt: record.CreatedAt, APIKey: apiKey}, nil
+}
+
+// RevokeTenantKey invalidates one of a tenant's API keys
+func (m *Manager) RevokeTenantKey(ctx context.Context, tenantID, keyID string) error {
+	if !m.tenancy {
+		return ErrTenancyDisabled
+	}
+	record, err := m.tenantKeyRecord(ctx, keyID)
+	if err != nil || record.TenantID != tenantID {
+		return ErrTenantKeyNotFound
+	}
+
+	pipe := m.redis.TxPipeline()
+	pipe.Del(ctx, tenantAPIKeyKey(keyID))
+	pipe.SRem(ctx, tenantKeysKey(tenantID), keyID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return nil
+}
+
+// AuthenticateTenant returns the tenant an API key belongs to
+func (m *Manager) AuthenticateTenant(ctx context.Context, apiKey string) (string, error) {
+	if !m.tenancy {
+		return "", ErrTenancyDisabled
+	}
+	if !strings.HasPrefix(apiKey, tenantKeyPrefix) {
+		return "", ErrInvalidTenantKey
+	}
+	keyID, hash := tenantKeyID(apiKey)
+	record, err := m.tenantKeyRecord(ctx, keyID)
+	if err == ErrTenantKeyNotFound {
+		return "", ErrInvalidTenantKey
+	}
+	if err != nil {
+		return "", err
+	}
+	if subtle.ConstantTimeCompare([]byte(record.Hash), []byte(hash)) != 1 {
+		return "", ErrInvalidTenantKey
+	}
+	return record.TenantID, nil
+}
+
+// QueueTenant returns the tenant that owns a queue, or "" for none
+func (m *Manager) QueueTenant(ctx context.Context, queueID string) string {
+	queue, err := m.loadQueue(ctx, queueID)
+	if err != nil {
+		return ""
+	}
+	return queue.TenantID
+}
+
+// tenantRecord loads a tenant as stored, without its counts and keys
+func (m *Manager) tenantRecord(ctx context.Context, tenantID string) (*Tenant, error) {
+	data, err := m.redis.Get(ctx, tenantKey(tenantID)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrTenantNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant: %w", err)
+	}
+	var tenant Tenant
+	if err := json.Unmarshal(data, &tenant); err != nil {
+		return nil, fmt.Errorf("failed to decode tenant: %w", err)
+	}
+	return &tenant, nil
+}
+
+func (m *Manager) tenantKeyRecord(ctx context.Context, keyID string) (*tenantKeyRecord, error) {
+	data, err := m.redis.Get(ctx, tenantAPIKeyKey(keyID)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrTenantKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	var record tenantKeyRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode API key: %w", err)
+	}
+	return &record, nil
+}
+
+// trackTenantQueue counts a new queue against its tenant until it expires
+func (m *Manager) trackTenantQueue(ctx context.Context, queue *Queue) {
+	m.redis.ZAdd(ctx, tenantQueuesKey(queue.TenantID), redis.Z{Score: float64(queue.ExpiresAt.Unix()), Member: queue.ID})
+}
+
+// countTenantQueues drops expired queues from the tenant's set and counts the rest
+func (m *Manager) countTenantQueues(ctx context.Context, tenantID string) (int64, error) {
+	key := tenantQueuesKey(tenantID)
+	pipe := m.redis.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(time.Now().Unix(), 10))
+	count := pipe.ZCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to count tenant queues: %w", err)
+	}
+	return count.Val(), nil
+}
@@ -0,0 +1,336 @@
+package queue
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"privmsg-relay/internal/macaroon"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrTokenNotFound      = errors.New("token not found")
+	ErrTooManyTokens      = errors.New("too many access tokens")
+	ErrInsufficientScope  = errors.New("token lacks required scope")
+	ErrInvalidTokenScopes = errors.New("invalid token scopes")
+)
+
+// MaxTokensPerQueue caps how many access tokens a queue can have at once
+const MaxTokensPerQueue = 16
+
+// MacaroonsTokenID is the token handle that revokes all of a queue's
+// macaroons at once, since they are not listed like access tokens
+const MacaroonsTokenID = "macaroons"
+
+// Capability is an operation an access token may perform on its queue
+type Capability string
+
+const (
+	CapReceive Capability = "receive" // Read messages (HTTP receive, WS subscribe)
+	CapAck     Capability = "ack"     // Delete individual messages after processing
+	CapAdmin   Capability = "admin"   // Delete the queue, manage tokens
+	CapSend    Capability = "send"    // Post messages (macaroons only; opaque send tokens are separate)
+)
+
+// AllCapabilities is granted to the token issued at queue creation
+var AllCapabilities = []Capability{CapReceive, CapAck, CapAdmin}
+
+// DefaultMintScopes is granted to minted tokens when no scopes are requested:
+// enough for a second device to drain the mailbox, but not to destroy it
+var DefaultMintScopes = []Capability{CapReceive, CapAck}
+
+// MintTokenRequest optionally restricts what a minted token can do
+type MintTokenRequest struct {
+	Scopes []Capability `json:"scopes,omitempty"`
+}
+
+// MintTokenResponse is returned after minting an additional access token
+type MintTokenResponse struct {
+	TokenID     string       `json:"token_id"`     // Public handle used to revoke the token
+	AccessToken string       `json:"access_token"` // The new secret (shown only once)
+	Scopes      []Capability `json:"scopes"`       // What the token may do
+	ExpiresAt   time.Time    `json:"expires_at"`   // Tokens live as long as the queue
+}
+
+// TokenInfo describes an access token without revealing it
+type TokenInfo struct {
+	TokenID string       `json:"token_id"`
+	Scopes  []Capability `json:"scopes"`
+}
+
+// ListTokensResponse lists a queue's access tokens
+type ListTokensResponse struct {
+	Tokens []TokenInfo `json:"tokens"`
+}
+
+// tokenRecord is stored under token:{accessToken}
+type tokenRecord struct {
+	QueueID string       `json:"queue_id"`
+	Scopes  []Capability `json:"scopes"`
+	Duress  bool         `json:"duress,omitempty"` // Wipes the queue when presented
+	Decoy   *duressDecoy `json:"decoy,omitempty"`  // What a duress token shows once the queue is wiped
+}
+
+func (t *tokenRecord) has(capability Capability) bool {
+	for _, scope := range t.Scopes {
+		if scope == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenID derives a non-secret handle for an access token
+func tokenID(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return hex.EncodeToString(sum[:8])
+}
+
+// validScopes checks that every scope is known and the list is non-empty
+func validScopes(scopes []Capability) bool {
+	if len(scopes) == 0 {
+		return false
+	}
+	for _, scope := range scopes {
+		switch scope {
+		case CapReceive, CapAck, CapAdmin:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// lookupToken loads the record for an access token (nil if unknown)
+func (m *Manager) lookupToken(ctx context.Context, accessToken string) (*tokenRecord, error) {
+	tokenKey := fmt.Sprintf("token:%s", accessToken)
+	data, err := m.redis.Get(ctx, tokenKey).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to verify token: %w", err)
+	}
+
+	// Tokens created before scopes existed store the bare queue ID
+	if len(data) == 0 || data[0] != '{' {
+		return &tokenRecord{QueueID: data, Scopes: AllCapabilities}, nil
+	}
+
+	var record tokenRecord
+	if err := json.Unmarshal([]byte(data), &record); err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+	return &record, nil
+}
+
+// authorize checks that accessToken belongs to queueID and grants capability
+func (m *Manager) authorize(ctx context.Context, queueID, accessToken string, capability Capability) error {
+	if m.macaroonSecret != nil && macaroon.Is(accessToken) {
+		queue, err := m.loadQueue(ctx, queueID)
+		if err != nil {
+			return err
+		}
+		return m.verifyMacaroon(queue, accessToken, capability)
+	}
+
+	record, err := m.lookupToken(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		// Compare against a dummy so unknown tokens take the same path as wrong-queue tokens
+		record = &tokenRecord{}
+	}
+	if subtle.ConstantTimeCompare([]byte(record.QueueID), []byte(queueID)) != 1 {
+		return ErrInvalidAccessToken
+	}
+	if record.Duress {
+		if record.Decoy == nil {
+			m.wipeUnderDuress(ctx, queueID, accessToken)
+		} else if !record.has(capability) {
+			return ErrInsufficientScope // Tokens minted under duress keep their scopes
+		}
+		return errDuress
+	}
+	if !record.has(capability) {
+		return ErrInsufficientScope
+	}
+	return nil
+}
+
+// storeToken persists an access token and adds it to the queue's token index
+func (m *Manager) storeToken(ctx context.Context, queueID, accessToken string, scopes []Capability, ttl time.Duration) error {
+	return m.storeTokenRecord(ctx, accessToken, tokenRecord{QueueID: queueID, Scopes: scopes}, ttl)
+}
+
+// storeTokenRecord persists a token record and indexes it under its queue
+func (m *Manager) storeTokenRecord(ctx context.Context, accessToken string, record tokenRecord, ttl time.Duration) error {
+	tokenKey := fmt.Sprintf("token:%s", accessToken)
+	indexKey := fmt.Sprintf("queue:%s:tokens", record.QueueID)
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal token: %w", err)
+	}
+
+	pipe := m.redis.TxPipeline()
+	pipe.Set(ctx, tokenKey, data, ttl)
+	pipe.HSet(ctx, indexKey, tokenID(accessToken), accessToken)
+	pipe.Expire(ctx, indexKey, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store access token: %w", err)
+	}
+	return nil
+}
+
+// MintToken creates an additional, optionally restricted access token for a queue
+func (m *Manager) MintToken(ctx context.Context, queueID, accessToken string, scopes []Capability) (*MintTokenResponse, error) {
+	// Verify access token grants admin and is not a macaroon
+	duress, err := underDuress(m.authorizeMinting(ctx, queueID, accessToken))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(scopes) == 0 {
+		scopes = DefaultMintScopes
+	}
+	if !validScopes(scopes) {
+		return nil, ErrInvalidTokenScopes
+	}
+	if duress {
+		return m.mintDecoyToken(ctx, queueID, accessToken, scopes)
+	}
+
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+
+	indexKey := fmt.Sprintf("queue:%s:tokens", queueID)
+	count, err := m.redis.HLen(ctx, indexKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tokens: %w", err)
+	}
+	limit := MaxTokensPerQueue
+	if queue.Broadcast {
+		limit = MaxReadersPerBroadcast
+	}
+	if count >= int64(limit) {
+		return nil, ErrTooManyTokens
+	}
+
+	newToken, err := generateRandomID(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	ttl := time.Until(queue.ExpiresAt)
+	if ttl <= 0 {
+		return nil, ErrQueueNotFound
+	}
+	if err := m.storeToken(ctx, queueID, newToken, scopes, ttl); err != nil {
+		return nil, err
+	}
+	if queue.Broadcast && (&tokenRecord{Scopes: scopes}).has(CapReceive) {
+		m.addReader(ctx, queue, newToken)
+	}
+
+	return &MintTokenResponse{
+		TokenID:     tokenID(newToken),
+		AccessToken: newToken,
+		Scopes:      scopes,
+		ExpiresAt:   queue.ExpiresAt,
+	}, nil
+}
+
+// ListTokens describes all access tokens for a queue
+func (m *Manager) ListTokens(ctx context.Context, queueID, accessToken string) (*ListTokensResponse, error) {
+	// Verify access token grants admin
+	duress, err := underDuress(m.authorize(ctx, queueID, accessToken, CapAdmin))
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := m.listTokens(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+	if duress {
+		// Tokens minted under duress are indexed like any other
+		tokens = append(slices.Clone(m.decoy(ctx, accessToken).Tokens), tokens...)
+	}
+	return &ListTokensResponse{Tokens: tokens}, nil
+}
+
+// listTokens describes the tokens in a queue's index
+func (m *Manager) listTokens(ctx context.Context, queueID string) ([]TokenInfo, error) {
+	indexKey := fmt.Sprintf("queue:%s:tokens", queueID)
+	index, err := m.redis.HGetAll(ctx, indexKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens: %w", err)
+	}
+
+	tokens := []TokenInfo{}
+	for id, token := range index {
+		record, err := m.lookupToken(ctx, token)
+		if err != nil || record == nil {
+			continue
+		}
+		tokens = append(tokens, TokenInfo{TokenID: id, Scopes: record.Scopes})
+	}
+	return tokens, nil
+}
+
+// RevokeToken invalidates one access token of a queue by its handle, or
+// every macaroon of the queue for the handle MacaroonsTokenID
+func (m *Manager) RevokeToken(ctx context.Context, queueID, accessToken, revokeID string) error {
+	// Verify access token grants admin and is not a macaroon
+	duress, err := underDuress(m.authorizeMinting(ctx, queueID, accessToken))
+	if err != nil {
+		return err
+	}
+	if duress {
+		if handled, err := m.revokeDecoyToken(ctx, accessToken, revokeID); handled {
+			return err
+		}
+	} else if revokeID == MacaroonsTokenID {
+		return m.revokeMacaroons(ctx, queueID)
+	}
+
+	indexKey := fmt.Sprintf("queue:%s:tokens", queueID)
+	revoked, err := m.redis.HGet(ctx, indexKey, revokeID).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return ErrTokenNotFound
+		}
+		return fmt.Errorf("failed to look up token: %w", err)
+	}
+
+	pipe := m.redis.TxPipeline()
+	pipe.Del(ctx, fmt.Sprintf("token:%s", revoked))
+	pipe.HDel(ctx, indexKey, revokeID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	m.forgetReader(ctx, queueID, revokeID)
+	return nil
+}
+
+// deleteAllTokens removes every access token of a queue
+func (m *Manager) deleteAllTokens(queueID string) {
+	indexKey := fmt.Sprintf("queue:%s:tokens", queueID)
+	tokens, _ := m.redis.HVals(m.ctx, indexKey).Result()
+	for _, token := range tokens {
+		m.redis.Del(m.ctx, fmt.Sprintf("token:%s", token))
+	}
+	m.redis.Del(m.ctx, indexKey)
+}
@@ -0,0 +1,452 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"privmsg-relay/internal/identity"
+	"privmsg-relay/internal/transparency"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrTransparencyDisabled = errors.New("key transparency log disabled")
+	ErrInvalidLogRange      = errors.New("invalid log range")
+	ErrInconsistentTreeHead = errors.New("tree head is not consistent with this log")
+)
+
+// Key transparency limits
+const (
+	MaxLogEntries       = 100 // Entries per page of GET /transparency/entries and lookups
+	MaxGossipedHeads    = 100 // Tree heads kept for GET /transparency/gossip
+	MaxGossipPerHour    = 60  // Tree heads one client IP may gossip an hour
+	LogKindServerKey    = "server_key"
+	LogKindPrekeys      = "prekeys"
+	ktLeavesKey         = "kt:leaves" // Entries exactly as hashed, oldest first
+	ktNodesKey          = "kt:nodes"  // Hashes of complete subtrees by "size:start"; they never change
+	ktGossipKey         = "kt:gossip"
+	ktSubjectKeyPattern = "kt:subject:%s" // Indexes of a subject's entries, oldest first
+)
+
+// LogEntry is one leaf of the key transparency log
+// Prekey entries record what the owner uploaded; the relay never checks
+// the signed prekey's signature, so clients verify it as for a claim
+type LogEntry struct {
+	Kind           string        `json:"kind"`    // LogKindServerKey or LogKindPrekeys
+	Subject        string        `json:"subject"` // transparency.SubjectServer or transparency.QueueSubject
+	IdentityKey    []byte        `json:"identity_key,omitempty"`
+	SignedPrekey   *SignedPrekey `json:"signed_prekey,omitempty"`
+	OneTimePrekeys []Prekey      `json:"one_time_prekeys,omitempty"`
+	LoggedAt       time.Time     `json:"logged_at"`
+}
+
+// LogRecord is a stored entry and its position
+type LogRecord struct {
+	Index int64  `json:"index"`
+	Entry []byte `json:"entry"` // JSON-encoded LogEntry, exactly as hashed into the leaf
+}
+
+// InclusionProof shows that the entry at LeafIndex is in the tree of TreeSize leaves
+type InclusionProof struct {
+	LeafIndex int64               `json:"leaf_index"`
+	TreeSize  int64               `json:"tree_size"`
+	AuditPath []transparency.Hash `json:"audit_path"`
+}
+
+// ConsistencyProof shows that the tree of Second leaves extends the tree of First
+type ConsistencyProof struct {
+	First  int64               `json:"first"`
+	Second int64               `json:"second"`
+	Proof  []transparency.Hash `json:"proof"`
+}
+
+// GossipedHead is a signed tree head a client saw, from this relay or another
+type GossipedHead struct {
+	PublicKey []byte                       `json:"public_key"` // Ed25519 key of the relay that signed Head
+	Head      *transparency.SignedTreeHead `json:"head"`
+}
+
+// appendLogScript pushes an entry and indexes it under its subject
+var appendLogScript = redis.NewScript(`
+local index = redis.call('RPUSH', KEYS[1], ARGV[1]) - 1
+redis.call('RPUSH', KEYS[2], index)
+return index
+`)
+
+func ktSubjectKey(subject string) string {
+	return fmt.Sprintf(ktSubjectKeyPattern, subject)
+}
+
+// EnableTransparency turns on the key transparency log, signing tree heads with key
+func (m *Manager) EnableTransparency(key ed25519.PrivateKey) {
+	m.transparencyKey = key
+}
+
+// appendLog adds an entry; logging is a no-op while the log is disabled
+func (m *Manager) appendLog(ctx context.Context, entry LogEntry) error {
+	if m.transparencyKey == nil {
+		return nil
+	}
+	entry.LoggedAt = time.Now().UTC()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal log entry: %w", err)
+	}
+	if err := appendLogScript.Run(ctx, m.redis, []string{ktLeavesKey, ktSubjectKey(entry.Subject)}, data).Err(); err != nil {
+		return fmt.Errorf("failed to append log entry: %w", err)
+	}
+	return nil
+}
+
+// LogServerKey records the relay's identity key unless it is already the
+// latest server key in the log; called once at startup
+func (m *Manager) LogServerKey(ctx context.Context) error {
+	if m.transparencyKey == nil {
+		return ErrTransparencyDisabled
+	}
+	pub := m.transparencyKey.Public().(ed25519.PublicKey)
+
+	latest, err := m.redis.LIndex(ctx, ktSubjectKey(transparency.SubjectServer), -1).Int64()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to read log: %w", err)
+	}
+	if err == nil {
+		data, err := m.redis.LIndex(ctx, ktLeavesKey, latest).Bytes()
+		if err != nil {
+			return fmt.Errorf("failed to read log: %w", err)
+		}
+		var entry LogEntry
+		if json.Unmarshal(data, &entry) == nil && bytes.Equal(entry.IdentityKey, pub) {
+			return nil
+		}
+	}
+
+	return m.appendLog(ctx, LogEntry{
+		Kind:        LogKindServerKey,
+		Subject:     transparency.SubjectServer,
+		IdentityKey: pub,
+	})
+}
+
+// logSize returns the number of entries in the log
+func (m *Manager) logSize(ctx context.Context) (int64, error) {
+	size, err := m.redis.LLen(ctx, ktLeavesKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read log size: %w", err)
+	}
+	return size, nil
+}
+
+// subtreeHash returns the hash of the size leaves from start; complete
+// subtrees are cached, so each costs one lookup once computed
+func (m *Manager) subtreeHash(ctx context.Context, start, size int64) (transparency.Hash, error) {
+	if size&(size-1) != 0 {
+		k := transparency.Split(size)
+		left, err := m.subtreeHash(ctx, start, k)
+		if err != nil {
+			return transparency.Hash{}, err
+		}
+		right, err := m.subtreeHash(ctx, start+k, size-k)
+		if err != nil {
+			return transparency.Hash{}, err
+		}
+		return transparency.NodeHash(left, right), nil
+	}
+
+	field := fmt.Sprintf("%d:%d", size, start)
+	cached, err := m.redis.HGet(ctx, ktNodesKey, field).Bytes()
+	if err == nil && len(cached) == transparency.HashSize {
+		return transparency.Hash(cached), nil
+	}
+	if err != nil && err != redis.Nil {
+		return transparency.Hash{}, fmt.Errorf("failed to read log node: %w", err)
+	}
+
+	var hash transparency.Hash
+	if size == 1 {
+		entry, err := m.redis.LIndex(ctx, ktLeavesKey, start).Bytes()
+		if err != nil {
+			return transparency.Hash{}, fmt.Errorf("failed to read log entry: %w", err)
+		}
+		hash = transparency.LeafHash(entry)
+	} else {
+		left, err := m.subtreeHash(ctx, start, size/2)
+		if err != nil {
+			return transparency.Hash{}, err
+		}
+		right, err := m.subtreeHash(ctx, start+size/2, size/2)
+		if err != nil {
+			return transparency.Hash{}, err
+		}
+		hash = transparency.NodeHash(left, right)
+	}
+	m.redis.HSet(ctx, ktNodesKey, field, hash[:])
+	return hash, nil
+}
+
+// rootHash returns the root of the tree of the first size entries
+func (m *Manager) rootHash(ctx context.Context, size int64) (transparency.Hash, error) {
+	if size == 0 {
+		return transparency.EmptyRoot, nil
+	}
+	return m.subtreeHash(ctx, 0, size)
+}
+
+// TreeHead signs the log's current size and root
+func (m *Manager) TreeHead(ctx context.Context) (*transparency.SignedTreeHead, error) {
+	if m.transparencyKey == nil {
+		return nil, ErrTransparencyDisabled
+	}
+	size, err := m.logSize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	root, err := m.rootHash(ctx, size)
+	if err != nil {
+		return nil, err
+	}
+	pub := m.transparencyKey.Public().(ed25519.PublicKey)
+	return transparency.Sign(m.transparencyKey, transparency.TreeHead{
+		TreeSize:  size,
+		RootHash:  root,
+		Timestamp: time.Now().UTC(),
+	}, identity.KeyID(pub))
+}
+
+// LogEntries returns entries start to end, end exclusive, at most MaxLogEntries
+func (m *Manager) LogEntries(ctx context.Context, start, end int64) ([]LogRecord, error) {
+	if m.transparencyKey == nil {
+		return nil, ErrTransparencyDisabled
+	}
+	if start < 0 || end <= start || end-start > MaxLogEntries {
+		return nil, ErrInvalidLogRange
+	}
+	values, err := m.redis.LRange(ctx, ktLeavesKey, start, end-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log: %w", err)
+	}
+	records := make([]LogRecord, len(values))
+	for i, value := range values {
+		records[i] = LogRecord{Index: start + int64(i), Entry: []byte(value)}
+	}
+	return records, nil
+}
+
+// LogLookup returns a subject's latest MaxLogEntries entries, oldest first
+func (m *Manager) LogLookup(ctx context.Context, subject string) ([]LogRecord, error) {
+	if m.transparencyKey == nil {
+		return nil, ErrTransparencyDisabled
+	}
+	if !transparency.ValidSubject(subject) {
+		return nil, ErrInvalidLogRange
+	}
+	indexes, err := m.redis.LRange(ctx, ktSubjectKey(subject), -MaxLogEntries, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log: %w", err)
+	}
+
+	pipe := m.redis.Pipeline()
+	cmds := make([]*redis.StringCmd, len(indexes))
+	positions := make([]int64, len(indexes))
+	for i, index := range indexes {
+		positions[i], _ = strconv.ParseInt(index, 10, 64)
+		cmds[i] = pipe.LIndex(ctx, ktLeavesKey, positions[i])
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to read log: %w", err)
+	}
+	records := make([]LogRecord, 0, len(indexes))
+	for i, cmd := range cmds {
+		if data, err := cmd.Bytes(); err == nil {
+			records = append(records, LogRecord{Index: positions[i], Entry: data})
+		}
+	}
+	return records, nil
+}
+
+// InclusionProof proves the entry at index is in the tree of size entries
+func (m *Manager) InclusionProof(ctx context.Context, index, size int64) (*InclusionProof, error) {
+	if m.transparencyKey == nil {
+		return nil, ErrTransparencyDisabled
+	}
+	current, err := m.logSize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= size || size > current {
+		return nil, ErrInvalidLogRange
+	}
+
+	path, err := m.inclusionPath(ctx, index, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	return &InclusionProof{LeafIndex: index, TreeSize: size, AuditPath: path}, nil
+}
+
+// inclusionPath is PATH from RFC 6962, section 2.1.1, over the size
+// entries from start
+func (m *Manager) inclusionPath(ctx context.Context, index, start, size int64) ([]transparency.Hash, error) {
+	if size == 1 {
+		return []transparency.Hash{}, nil
+	}
+	k := transparency.Split(size)
+	var path []transparency.Hash
+	var sibling transparency.Hash
+	var err error
+	if index < k {
+		if path, err = m.inclusionPath(ctx, index, start, k); err != nil {
+			return nil, err
+		}
+		sibling, err = m.subtreeHash(ctx, start+k, size-k)
+	} else {
+		if path, err = m.inclusionPath(ctx, index-k, start+k, size-k); err != nil {
+			return nil, err
+		}
+		sibling, err = m.subtreeHash(ctx, start, k)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(path, sibling), nil
+}
+
+// ConsistencyProof proves the tree of second entries extends the tree of first
+func (m *Manager) ConsistencyProof(ctx context.Context, first, second int64) (*ConsistencyProof, error) {
+	if m.transparencyKey == nil {
+		return nil, ErrTransparencyDisabled
+	}
+	current, err := m.logSize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if first < 0 || first > second || second > current {
+		return nil, ErrInvalidLogRange
+	}
+
+	proof := []transparency.Hash{}
+	if first > 0 && first < second {
+		if proof, err = m.subproof(ctx, first, 0, second, true); err != nil {
+			return nil, err
+		}
+	}
+	return &ConsistencyProof{First: first, Second: second, Proof: proof}, nil
+}
+
+// subproof is SUBPROOF from RFC 6962, section 2.1.2, over the size
+// entries from start; complete is true while the first tree's root is a
+// node of this subtree the verifier already knows
+func (m *Manager) subproof(ctx context.Context, first, start, size int64, complete bool) ([]transparency.Hash, error) {
+	if first == size {
+		if complete {
+			return []transparency.Hash{}, nil
+		}
+		hash, err := m.subtreeHash(ctx, start, size)
+		if err != nil {
+			return nil, err
+		}
+		return []transparency.Hash{hash}, nil
+	}
+
+	k := transparency.Split(size)
+	var proof []transparency.Hash
+	var sibling transparency.Hash
+	var err error
+	if first <= k {
+		if proof, err = m.subproof(ctx, first, start, k, complete); err != nil {
+			return nil, err
+		}
+		sibling, err = m.subtreeHash(ctx, start+k, size-k)
+	} else {
+		if proof, err = m.subproof(ctx, first-k, start+k, size-k, false); err != nil {
+			return nil, err
+		}
+		sibling, err = m.subtreeHash(ctx, start, k)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(proof, sibling), nil
+}
+
+// Gossip records a tree head a client saw so others can compare theirs
+// A head signed by this relay must match its own log: one that does not is
+// proof the relay showed someone a different log, so it is kept anyway and
+// reported as ErrInconsistentTreeHead
+func (m *Manager) Gossip(ctx context.Context, clientIP string, gossiped GossipedHead) error {
+	if m.transparencyKey == nil {
+		return ErrTransparencyDisabled
+	}
+	if gossiped.Head == nil {
+		return transparency.ErrInvalidTreeHead
+	}
+	head, err := gossiped.Head.Open(gossiped.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	allowed, err := m.allowRate("gossip", clientIP, MaxGossipPerHour, time.Hour)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrRateLimitExceeded
+	}
+
+	var conflict error
+	if bytes.Equal(gossiped.PublicKey, m.transparencyKey.Public().(ed25519.PublicKey)) {
+		size, err := m.logSize(ctx)
+		if err != nil {
+			return err
+		}
+		if head.TreeSize > size {
+			conflict = ErrInconsistentTreeHead
+		} else if root, err := m.rootHash(ctx, head.TreeSize); err != nil {
+			return err
+		} else if root != head.RootHash {
+			conflict = ErrInconsistentTreeHead
+		}
+		if conflict != nil {
+			slog.Error("Gossiped tree head does not match the log", "tree_size", head.TreeSize, "log_size", size)
+		}
+	}
+
+	data, err := json.Marshal(gossiped)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tree head: %w", err)
+	}
+	pipe := m.redis.TxPipeline()
+	pipe.LPush(ctx, ktGossipKey, data)
+	pipe.LTrim(ctx, ktGossipKey, 0, MaxGossipedHeads-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store tree head: %w", err)
+	}
+	return conflict
+}
+
+// GossipedHeads returns the latest gossiped tree heads, newest first
+func (m *Manager) GossipedHeads(ctx context.Context) ([]GossipedHead, error) {
+	if m.transparencyKey == nil {
+		return nil, ErrTransparencyDisabled
+	}
+	values, err := m.redis.LRange(ctx, ktGossipKey, 0, MaxGossipedHeads-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree heads: %w", err)
+	}
+	heads := make([]GossipedHead, 0, len(values))
+	for _, value := range values {
+		var head GossipedHead
+		if json.Unmarshal([]byte(value), &head) == nil {
+			heads = append(heads, head)
+		}
+	}
+	return heads, nil
+}
@@ -8,12 +8,35 @@ import (
 // Each queue is identified by a random 256-bit ID and access token
 // The server has NO knowledge of who created the queue or who will receive from it
 type Queue struct {
-	ID          string    `json:"id"`           // Random 256-bit ID (hex-encoded)
-	AccessToken string    `json:"-"`            // Token required to read messages (never sent over network)
-	Messages    []Message `json:"-"`            // Encrypted messages in the queue
-	CreatedAt   time.Time `json:"created_at"`   // When the queue was created
-	ExpiresAt   time.Time `json:"expires_at"`   // When the queue will be auto-deleted
-	LastActive  time.Time `json:"last_active"`  // Last time a message was sent or received
+	ID          string    `json:"id"`          // Random 256-bit ID (hex-encoded)
+	AccessToken string    `json:"-"`           // Token required to read messages (never sent over network)
+	Messages    []Message `json:"-"`           // Encrypted messages in the queue
+	CreatedAt   time.Time `json:"created_at"`  // When the queue was created
+	ExpiresAt   time.Time `json:"expires_at"`  // When the queue will be auto-deleted
+	LastActive  time.Time `json:"last_active"` // Last time a message was sent or received (kept in the state key)
+
+	SendToken  string `json:"send_token,omitempty"` // If set, senders must present this token
+	Hibernated bool   `json:"hibernated,omitempty"` // Messages live in the blob store until next access
+	Frozen     bool   `json:"frozen,omitempty"`     // Operator-frozen: new messages are rejected (kept in the state key)
+
+	BurnAfterRead bool `json:"burn_after_read,omitempty"` // Messages are deleted as soon as they are delivered
+	Presence      bool `json:"presence,omitempty"`        // Senders may ask whether a subscriber is connected
+	Broadcast     bool `json:"broadcast,omitempty"`       // One writer, many readers with their own cursors
+	SealedSender  bool `json:"sealed_sender,omitempty"`   // Only sealed envelopes accepted; nothing about senders is kept
+	MixDelivery   bool `json:"mix_delivery,omitempty"`    // Messages are held back and released in randomly timed batches
+
+	MaxMessages    int `json:"max_messages,omitempty"`     // Per-queue message cap (0 = server default)
+	MaxMessageSize int `json:"max_message_size,omitempty"` // Per-queue payload cap in bytes (0 = server default)
+
+	TenantID string `json:"tenant_id,omitempty"` // Tenant whose API key created the queue (empty = none)
+	Elevated bool   `json:"elevated,omitempty"`  // A voucher was redeemed: limits may exceed the server maximums up to the voucher's
+
+	MacaroonGeneration int `json:"macaroon_generation,omitempty"` // Mixed into the macaroon root key; bumped to revoke every macaroon
+
+	Webhook     *Webhook     `json:"webhook,omitempty"`      // Endpoint new messages are posted to (nil = none)
+	PushDevices []PushDevice `json:"push_devices,omitempty"` // Devices woken by new messages
+
+	stored string // The record as read from Redis, for updateQueue's compare-and-set
 }
 
 // Message represents an encrypted message in a queue
@@ -21,46 +44,140 @@ type Queue struct {
 type Message struct {
 	ID         string    `json:"id"`          // Unique message ID
 	QueueID    string    `json:"queue_id"`    // Which queue this message belongs to
+	Seq        int64     `json:"seq"`         // Per-queue sequence number, strictly increasing from 1 (0 = system message)
 	Payload    []byte    `json:"payload"`     // Encrypted message payload (E2E encrypted)
 	ReceivedAt time.Time `json:"received_at"` // When the server received this message
 	ExpiresAt  time.Time `json:"expires_at"`  // When this message will be auto-deleted
+
+	PayloadHash string `json:"payload_sha256,omitempty"` // Hex SHA-256 of Payload, computed when the message was accepted
+	ArchiveRef  string `json:"archive_ref,omitempty"`    // Blob store key when the payload was spilled out of Redis
+	ArchiveSize int    `json:"archive_size,omitempty"`   // Payload length while archived
+	ArchiveKey  string `json:"archive_key,omitempty"`    // Data key the archived payload is sealed with (empty = plaintext)
+	System      bool   `json:"system,omitempty"`         // Relay-generated (e.g. a signed operator notice), not E2E encrypted
+	SenderID    string `json:"sender_id,omitempty"`      // Group member who sent it (see AddMembers); empty for other senders and on sealed-sender queues
+
+	Priority Priority `json:"priority,omitempty"` // PriorityHigh when sent ahead of normal messages (empty = normal)
 }
 
 // CreateQueueRequest is sent by clients to create a new receive queue
 type CreateQueueRequest struct {
-	// No fields needed - server generates everything randomly
+	// IDs and tokens are generated randomly by the server
+	RequireSendToken bool `json:"require_send_token,omitempty"` // Issue a send token and reject unauthenticated sends
+	BurnAfterRead    bool `json:"burn_after_read,omitempty"`    // Delete messages the moment they are delivered (no ack)
+	Broadcast        bool `json:"broadcast,omitempty"`          // One writer (implies require_send_token), readers ack independently
+	SealedSender     bool `json:"sealed_sender,omitempty"`      // Accept only sealed envelopes and never attribute messages to senders
+	MixDelivery      bool `json:"mix_delivery,omitempty"`       // Release messages in randomly timed batches rather than at once
+	DuressToken      bool `json:"duress_token,omitempty"`       // Also issue a token that destroys the queue when presented
+
+	// Optional lifetime and limits, clamped to the server maximums
+	TTL            int64 `json:"ttl,omitempty"`              // Queue lifetime in seconds (default set by the server)
+	MaxMessages    int   `json:"max_messages,omitempty"`     // Messages held at once (default set by the server)
+	MaxMessageSize int   `json:"max_message_size,omitempty"` // Largest payload in bytes (default set by the server)
+
+	TenantID string `json:"-"` // Set by the server from a tenant API key, never by the client
 }
 
 // CreateQueueResponse is returned after creating a queue
 type CreateQueueResponse struct {
-	QueueID     string    `json:"queue_id"`      // The queue ID (share this with sender)
-	AccessToken string    `json:"access_token"`  // Token to receive messages (keep private!)
-	QueueURL    string    `json:"queue_url"`     // Full URL to the queue
-	ExpiresAt   time.Time `json:"expires_at"`    // When the queue expires
+	QueueID     string    `json:"queue_id"`               // The queue ID (share this with sender)
+	AccessToken string    `json:"access_token"`           // Token to receive messages (keep private!)
+	SendToken   string    `json:"send_token,omitempty"`   // Token senders must present (share with senders only)
+	DuressToken string    `json:"duress_token,omitempty"` // Hand over under coercion: any call with it wipes the queue and answers as if it were empty
+	Macaroon    string    `json:"macaroon,omitempty"`     // Root macaroon to attenuate offline (if enabled)
+	QueueURL    string    `json:"queue_url"`              // Full URL to the queue
+	ExpiresAt   time.Time `json:"expires_at"`             // When the queue expires
+
+	MaxMessages    int `json:"max_messages"`     // Effective message cap
+	MaxMessageSize int `json:"max_message_size"` // Effective payload cap in bytes
+}
+
+// QueueInfoResponse summarizes a queue without returning its messages
+type QueueInfoResponse struct {
+	MessageCount int       `json:"message_count"`
+	TotalBytes   int64     `json:"total_bytes"` // Sum of encrypted payload sizes
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	LastActive   time.Time `json:"last_active"`
 }
 
 // SendMessageRequest is sent to post a message to a queue
 type SendMessageRequest struct {
-	Payload []byte `json:"payload"` // Encrypted message payload
+	Payload    []byte   `json:"payload"`               // Encrypted message payload
+	TTLSeconds int64    `json:"ttl_seconds,omitempty"` // Optional shorter lifetime (capped by server policy)
+	Priority   Priority `json:"priority,omitempty"`    // "high" to deliver ahead of normal messages (default "normal")
 }
 
 // SendMessageResponse is returned after sending a message
 type SendMessageResponse struct {
-	MessageID string    `json:"message_id"`  // ID of the sent message
-	SentAt    time.Time `json:"sent_at"`     // When the message was received by server
+	MessageID string    `json:"message_id"` // ID of the sent message
+	Seq       int64     `json:"seq"`        // Per-queue sequence number of the sent message
+	SentAt    time.Time `json:"sent_at"`    // When the message was received by server
+	ExpiresAt time.Time `json:"expires_at"` // When the message will be auto-deleted
+
+	PayloadHash  string `json:"payload_sha256"`          // Hex SHA-256 of the payload as stored
+	ReceiptToken string `json:"receipt_token,omitempty"` // Poll GET /receipt/{token} for delivery status (if enabled)
+
+	BurnAfterRead bool `json:"-"` // Queue mode, so the relay can claim the message before pushing it
+	Held          bool `json:"-"` // Mixed-delivery queue: subscribers hear of it when its batch is released
+	Replayed      bool `json:"-"` // Returned from an earlier send with the same Idempotency-Key
+}
+
+// MaxBatchSize caps the items in one batch send or batch ack request
+const MaxBatchSize = 100
+
+// BatchSendRequest posts several messages to one queue in a single call
+type BatchSendRequest struct {
+	Messages []SendMessageRequest `json:"messages"`
+}
+
+// BatchAckRequest deletes several received messages in a single call
+type BatchAckRequest struct {
+	MessageIDs []string `json:"message_ids"`
+}
+
+// BatchItemResult is the outcome of one batch item
+// Items are applied in order and independently: a failed item does not
+// roll back earlier ones, so clients retry only the items that failed
+type BatchItemResult struct {
+	Index    int                  `json:"index"`              // Position in the request
+	Status   int                  `json:"status"`             // HTTP status the item would get as a single request
+	Error    string               `json:"error,omitempty"`    // Set when Status is not 2xx
+	Message  *SendMessageResponse `json:"message,omitempty"`  // Batch send only
+	Farewell []byte               `json:"farewell,omitempty"` // Batch send to a queue that left a farewell
+}
+
+// BatchResponse reports every item of a batch request
+type BatchResponse struct {
+	Results   []BatchItemResult `json:"results"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
 }
 
 // ReceiveMessagesRequest is used to retrieve messages from a queue
 type ReceiveMessagesRequest struct {
 	AccessToken string `json:"access_token"` // Required to authenticate
-	Since       string `json:"since"`        // Optional: only get messages after this ID
+	Cursor      string `json:"cursor"`       // Optional: next_cursor from the previous receive
 	Limit       int    `json:"limit"`        // Optional: max number of messages to return
 }
 
 // ReceiveMessagesResponse contains messages from the queue
 type ReceiveMessagesResponse struct {
-	Messages []Message `json:"messages"` // List of encrypted messages
-	HasMore  bool      `json:"has_more"` // Whether there are more messages available
+	Messages   []Message `json:"messages"`    // List of encrypted messages
+	HasMore    bool      `json:"has_more"`    // Whether there are more messages available
+	NextCursor string    `json:"next_cursor"` // Pass as ?cursor= to resume after the last message returned
+
+	InvisibleUntil *time.Time `json:"invisible_until,omitempty"` // With a visibility timeout: when unacked messages reappear
+}
+
+// ReceiveCountResponse is returned by a count_only receive
+type ReceiveCountResponse struct {
+	Count      int    `json:"count"`       // Messages a receive with the same cursor would return (ignoring limit)
+	NextCursor string `json:"next_cursor"` // The cursor that was counted from, unchanged
+}
+
+// PurgeMessagesResponse is returned after clearing a queue's pending messages
+type PurgeMessagesResponse struct {
+	Purged int `json:"purged"` // Number of messages deleted
 }
 
 // DeleteQueueRequest is used to delete a queue
@@ -72,13 +189,18 @@ type DeleteQueueRequest struct {
 type WSMessageType string
 
 const (
-	WSTypeSubscribe   WSMessageType = "subscribe"    // Client subscribes to queue updates
-	WSTypeUnsubscribe WSMessageType = "unsubscribe"  // Client unsubscribes from queue
-	WSTypeMessage     WSMessageType = "message"      // Server sends new message to client
-	WSTypeAck         WSMessageType = "ack"          // Client acknowledges message receipt
-	WSTypeError       WSMessageType = "error"        // Error message
-	WSTypePing        WSMessageType = "ping"         // Keep-alive ping
-	WSTypePong        WSMessageType = "pong"         // Keep-alive pong
+	WSTypeSubscribe   WSMessageType = "subscribe"   // Client subscribes to queue updates
+	WSTypeUnsubscribe WSMessageType = "unsubscribe" // Client unsubscribes from queue
+	WSTypeMessage     WSMessageType = "message"     // Server sends new message to client
+	WSTypeAck         WSMessageType = "ack"         // Client acknowledges message receipt
+	WSTypeError       WSMessageType = "error"       // Error message
+	WSTypePing        WSMessageType = "ping"        // Keep-alive ping
+	WSTypePong        WSMessageType = "pong"        // Keep-alive pong
+	WSTypeNotice      WSMessageType = "notice"      // Signed operator notice broadcast to every client
+	WSTypeHello       WSMessageType = "hello"       // First frame on a connection, naming the protocol in use
+	WSTypeSignal      WSMessageType = "signal"      // Ephemeral payload relayed between a queue's connections, never stored
+	WSTypePresence    WSMessageType = "presence"    // Sender asks whether a queue has a connected subscriber; the answer has Online set
+	WSTypeCover       WSMessageType = "cover"       // Decoy with random padding; a client sets Interval to ask the relay for them
 )
 
 // WSMessage is the structure for WebSocket messages
@@ -87,22 +209,34 @@ type WSMessage struct {
 	QueueID     string        `json:"queue_id,omitempty"`
 	AccessToken string        `json:"access_token,omitempty"`
 	MessageID   string        `json:"message_id,omitempty"`
+	Seq         int64         `json:"seq,omitempty"`
+	Cursor      string        `json:"cursor,omitempty"` // Subscribe: resume after this receive cursor; message: cursor after this message
 	Payload     []byte        `json:"payload,omitempty"`
+	PayloadHash string        `json:"payload_sha256,omitempty"`
+	SenderID    string        `json:"sender_id,omitempty"` // Message: the group member who sent it
 	Error       string        `json:"error,omitempty"`
+	Code        int           `json:"code,omitempty"` // Error: the HTTP status the same failure would get
+	Notice      *SignedNotice `json:"notice,omitempty"`
+	Protocol    string        `json:"protocol,omitempty"` // Hello: the negotiated subprotocol
+	Online      *bool         `json:"online,omitempty"`   // Presence answer: a subscriber is connected to this relay
+	Interval    *int          `json:"interval,omitempty"` // Cover request: mean seconds between decoys (0 stops them)
 	Timestamp   time.Time     `json:"timestamp"`
 }
 
-// Queue lifecycle constants
+// Queue lifecycle defaults, used unless the operator configures others
 const (
-	QueueTTL          = 7 * 24 * time.Hour  // Queues expire after 7 days of inactivity
-	MessageTTL        = 24 * time.Hour       // Undelivered messages expire after 24 hours
-	MaxMessagesInQueue = 1000                 // Maximum messages per queue
-	MaxMessageSize    = 4 * 1024 * 1024      // 4MB max message size
+	QueueTTL           = 7 * 24 * time.Hour // Queues expire after 7 days of inactivity
+	MessageTTL         = 24 * time.Hour     // Undelivered messages expire after 24 hours
+	MaxMessagesInQueue = 1000               // Maximum messages per queue
+	MaxMessageSize     = 4 * 1024 * 1024    // 4MB max message size
 )
 
 // Rate limiting constants
 const (
-	MaxQueuesPerIP         = 10   // Max queue creations per IP per hour
-	MaxMessagesSendPerHour = 100  // Max messages sent to a single queue per hour
-	MaxMessagesRecvPerHour = 1000 // Max messages received from a queue per hour
+	MaxQueuesPerIP             = 10   // Max queue creations per IP per hour
+	MaxMessagesSendPerHour     = 100  // Max messages sent to a single queue per hour
+	MaxMessagesRecvPerHour     = 1000 // Max messages received from a queue per hour
+	MaxPresenceQueriesPerMin   = 6    // Max presence queries answered per queue per minute
+	MaxPrekeyClaimsPerHour     = 100  // Max prekey bundles claimed from a queue per hour
+	MaxDiscoveryLookupsPerHour = 20   // Max contact discovery lookups per IP per hour
 )
@@ -0,0 +1,286 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrUploadNotFound       = errors.New("upload not found")
+	ErrUploadOffsetMismatch = errors.New("upload offset does not match")
+	ErrUploadIncomplete     = errors.New("upload is not complete")
+	ErrTooManyUploads       = errors.New("too many uploads in progress for this queue")
+	ErrInvalidUpload        = errors.New("invalid upload request")
+)
+
+// Upload limits
+const (
+	UploadTTL          = 24 * time.Hour // Unfinished uploads are dropped after a day
+	MaxUploadsPerQueue = 10             // Uploads in progress per queue at once
+)
+
+// CreateUploadRequest starts a chunked upload of one message payload
+type CreateUploadRequest struct {
+	Size       int64 `json:"size"`                  // Total payload length in bytes
+	TTLSeconds int64 `json:"ttl_seconds,omitempty"` // Lifetime of the message once committed
+}
+
+// UploadStatus reports how much of an upload the relay holds
+// Clients resume an interrupted upload by appending from Offset
+type UploadStatus struct {
+	UploadID  string    `json:"upload_id"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"` // Bytes received so far
+	ExpiresAt time.Time `json:"expires_at"`
+
+	Committed *SendMessageResponse `json:"committed,omitempty"` // Set once the message was sent
+}
+
+// upload is the stored state of one upload; the bytes live in a separate key
+type upload struct {
+	Size       int64                `json:"size"`
+	TTLSeconds int64                `json:"ttl_seconds,omitempty"`
+	ExpiresAt  time.Time            `json:"expires_at"`
+	Committed  *SendMessageResponse `json:"committed,omitempty"`
+}
+
+func uploadKey(queueID, uploadID string) string {
+	return fmt.Sprintf("upload:%s:%s", queueID, uploadID)
+}
+
+func uploadDataKey(queueID, uploadID string) string {
+	return fmt.Sprintf("upload:%s:%s:data", queueID, uploadID)
+}
+
+func uploadsKey(queueID string) string {
+	return fmt.Sprintf("queue:%s:uploads", queueID)
+}
+
+// appendScript appends a chunk only at the expected offset, so a retried
+// chunk can never be stored twice
+// Returns {1, length} on success, {0, length} on an offset mismatch,
+// {-1, length} when the chunk would overrun the size and {-2, 0} when the
+// upload does not exist
+var appendScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return {-2, 0}
+end
+local length = redis.call('STRLEN', KEYS[2])
+if length ~= tonumber(ARGV[1]) then
+	return {0, length}
+end
+if length + string.len(ARGV[2]) > tonumber(ARGV[3]) then
+	return {-1, length}
+end
+length = redis.call('APPEND', KEYS[2], ARGV[2])
+redis.call('PEXPIREAT', KEYS[2], ARGV[4])
+return {1, length}
+`)
+
+// CreateUpload starts a chunked upload to a queue
+// The sender is authorized now and again at commit; the returned upload ID
+// is the only credential needed to append chunks
+func (m *Manager) CreateUpload(ctx context.Context, queueID, sendToken string, req CreateUploadRequest) (*UploadStatus, error) {
+	if req.Size <= 0 || req.TTLSeconds < 0 {
+		return nil, ErrInvalidUpload
+	}
+	if req.Size > int64(m.MaxMessageSize()) {
+		return nil, ErrMessageTooLarge
+	}
+
+	queue, err := m.getQueue(ctx, queueID)
+	if err == ErrQueueNotFound {
+		return nil, m.queueGone(ctx, queueID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req.Size > int64(m.sizeLimit(queue)) {
+		return nil, ErrMessageTooLarge
+	}
+	if queue.Frozen {
+		return nil, ErrQueueFrozen
+	}
+	if _, _, err := m.checkSendToken(ctx, queue, sendToken); err != nil {
+		return nil, err
+	}
+
+	// Forget uploads that expired before reaching the cap
+	uploadIDs, err := m.redis.SMembers(ctx, uploadsKey(queueID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list uploads: %w", err)
+	}
+	active := 0
+	for _, id := range uploadIDs {
+		if m.redis.Exists(ctx, uploadKey(queueID, id)).Val() == 0 {
+			m.redis.SRem(ctx, uploadsKey(queueID), id)
+			continue
+		}
+		active++
+	}
+	if active >= MaxUploadsPerQueue {
+		return nil, ErrTooManyUploads
+	}
+
+	uploadID, err := generateRandomID(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate upload ID: %w", err)
+	}
+	state := upload{
+		Size:       req.Size,
+		TTLSeconds: req.TTLSeconds,
+		ExpiresAt:  time.Now().Add(UploadTTL),
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal upload: %w", err)
+	}
+
+	pipe := m.redis.TxPipeline()
+	pipe.Set(ctx, uploadKey(queueID, uploadID), data, UploadTTL)
+	pipe.SAdd(ctx, uploadsKey(queueID), uploadID)
+	pipe.ExpireAt(ctx, uploadsKey(queueID), queue.ExpiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to store upload: %w", err)
+	}
+
+	return &UploadStatus{UploadID: uploadID, Size: state.Size, ExpiresAt: state.ExpiresAt}, nil
+}
+
+// GetUpload reports an upload's progress
+func (m *Manager) GetUpload(ctx context.Context, queueID, uploadID string) (*UploadStatus, error) {
+	state, err := m.loadUpload(ctx, queueID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	return m.uploadStatus(ctx, queueID, uploadID, state)
+}
+
+// AppendUpload stores the chunk that starts at offset
+// On ErrUploadOffsetMismatch the returned status holds the offset to
+// resume from
+func (m *Manager) AppendUpload(ctx context.Context, queueID, uploadID string, offset int64, chunk []byte) (*UploadStatus, error) {
+	state, err := m.loadUpload(ctx, queueID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if state.Committed != nil {
+		return nil, ErrUploadOffsetMismatch
+	}
+
+	result, err := appendScript.Run(ctx, m.redis,
+		[]string{uploadKey(queueID, uploadID), uploadDataKey(queueID, uploadID)},
+		offset, chunk, state.Size, state.ExpiresAt.UnixMilli(),
+	).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to append chunk: %w", err)
+	}
+
+	status := &UploadStatus{UploadID: uploadID, Size: state.Size, Offset: result[1], ExpiresAt: state.ExpiresAt}
+	switch result[0] {
+	case 1:
+		return status, nil
+	case 0:
+		return status, ErrUploadOffsetMismatch
+	case -1:
+		return status, ErrMessageTooLarge
+	default:
+		return nil, ErrUploadNotFound
+	}
+}
+
+// CommitUpload sends the completed upload as one message and returns the
+// send response with the payload (for notifying subscribers)
+// Committing again returns the original response with Replayed set
+func (m *Manager) CommitUpload(ctx context.Context, queueID, uploadID, sendToken string) (*SendMessageResponse, []byte, error) {
+	state, err := m.loadUpload(ctx, queueID, uploadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if state.Committed != nil {
+		replay := *state.Committed
+		replay.Replayed = true
+		return &replay, nil, nil
+	}
+
+	payload, err := m.redis.Get(ctx, uploadDataKey(queueID, uploadID)).Bytes()
+	if err != nil && err != redis.Nil {
+		return nil, nil, fmt.Errorf("failed to load upload: %w", err)
+	}
+	if int64(len(payload)) != state.Size {
+		return nil, nil, ErrUploadIncomplete
+	}
+
+	// The message only becomes visible here; a failed send leaves the
+	// upload in place so the commit can be retried
+	response, err := m.send(ctx, queueID, payload, SendOptions{SendToken: sendToken, TTL: time.Duration(state.TTLSeconds) * time.Second})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Keep the response so a retried commit is answered, not re-sent
+	state.Committed = response
+	if data, err := json.Marshal(state); err == nil {
+		m.redis.Set(ctx, uploadKey(queueID, uploadID), data, time.Until(state.ExpiresAt))
+	}
+	m.redis.Del(ctx, uploadDataKey(queueID, uploadID))
+	m.redis.SRem(ctx, uploadsKey(queueID), uploadID)
+
+	return response, payload, nil
+}
+
+// AbortUpload discards an upload and the chunks received so far
+func (m *Manager) AbortUpload(ctx context.Context, queueID, uploadID string) error {
+	deleted, err := m.redis.Del(ctx, uploadKey(queueID, uploadID), uploadDataKey(queueID, uploadID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	if deleted == 0 {
+		return ErrUploadNotFound
+	}
+	m.redis.SRem(ctx, uploadsKey(queueID), uploadID)
+	return nil
+}
+
+func (m *Manager) loadUpload(ctx context.Context, queueID, uploadID string) (*upload, error) {
+	data, err := m.redis.Get(ctx, uploadKey(queueID, uploadID)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load upload: %w", err)
+	}
+	var state upload
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode upload: %w", err)
+	}
+	return &state, nil
+}
+
+func (m *Manager) uploadStatus(ctx context.Context, queueID, uploadID string, state *upload) (*UploadStatus, error) {
+	status := &UploadStatus{UploadID: uploadID, Size: state.Size, ExpiresAt: state.ExpiresAt, Committed: state.Committed}
+	if state.Committed != nil {
+		status.Offset = state.Size
+		return status, nil
+	}
+	offset, err := m.redis.StrLen(ctx, uploadDataKey(queueID, uploadID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	status.Offset = offset
+	return status, nil
+}
+
+// deleteUploads drops every upload in progress for a queue being purged
+func (m *Manager) deleteUploads(ctx context.Context, queueID string) {
+	uploadIDs, _ := m.redis.SMembers(ctx, uploadsKey(queueID)).Result()
+	for _, id := range uploadIDs {
+		m.redis.Del(ctx, uploadKey(queueID, id), uploadDataKey(queueID, id))
+	}
+	m.redis.Del(ctx, uploadsKey(queueID))
+}
@@ -0,0 +1,50 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrVisibilityUnsupported = errors.New("visibility timeout not supported on broadcast or burn-after-read queues")
+	ErrCursorWithVisibility  = errors.New("use either a cursor or a visibility timeout, not both")
+)
+
+// leaseKey marks a message as handed to one consumer; it lives as long as
+// the visibility timeout, so the message reappears when it runs out
+// It sits outside message:* so scans over messages never see it
+func leaseKey(queueID, messageID string) string {
+	return fmt.Sprintf("lease:%s:%s", queueID, messageID)
+}
+
+// leaseMessage hides a message from other visibility-timeout receives for
+// timeout; false means another consumer holds it
+func (m *Manager) leaseMessage(ctx context.Context, queueID, messageID string, timeout time.Duration) (bool, error) {
+	leased, err := m.redis.SetNX(ctx, leaseKey(queueID, messageID), 1, timeout).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to lease message: %w", err)
+	}
+	return leased, nil
+}
+
+// releaseLease drops a message's lease once it is acked or gone
+func (m *Manager) releaseLease(ctx context.Context, queueID, messageID string) {
+	m.redis.Del(ctx, leaseKey(queueID, messageID))
+}
+
+// Leased reports whether a visibility-timeout consumer holds a message
+func (m *Manager) Leased(ctx context.Context, queueID, messageID string) bool {
+	leased, err := m.redis.Exists(ctx, leaseKey(queueID, messageID)).Result()
+	return err == nil && leased > 0
+}
+
+// invisibleUntil is when messages leased from now on for visibility reappear
+func invisibleUntil(visibility time.Duration) *time.Time {
+	if visibility <= 0 {
+		return nil
+	}
+	until := time.Now().Add(visibility)
+	return &until
+}
@@ -0,0 +1,121 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// createTestQueue creates a queue that is deleted when the test ends
+func createTestQueue(t *testing.T, m *Manager, req CreateQueueRequest) *CreateQueueResponse {
+	t.Helper()
+	ctx := context.Background()
+	created, err := m.CreateQueue(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.DeleteQueue(ctx, created.QueueID, created.AccessToken) })
+	return created
+}
+
+// sendTestMessages sends count messages and returns their IDs in order
+func sendTestMessages(t *testing.T, m *Manager, queueID string, count int) []string {
+	t.Helper()
+	var ids []string
+	for i := 0; i < count; i++ {
+		sent, err := m.SendMessage(context.Background(), queueID, []byte("message body"), SendOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, sent.MessageID)
+	}
+	return ids
+}
+
+// receivedIDs receives with opts and returns the message IDs in order
+func receivedIDs(t *testing.T, m *Manager, created *CreateQueueResponse, opts ReceiveOptions) []string {
+	t.Helper()
+	response, err := m.ReceiveMessages(context.Background(), created.QueueID, created.AccessToken, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, message := range response.Messages {
+		ids = append(ids, message.ID)
+	}
+	return ids
+}
+
+func TestVisibilityTimeoutSplitsMessagesBetweenConsumers(t *testing.T) {
+	m := testManager(t)
+	created := createTestQueue(t, m, CreateQueueRequest{})
+	ids := sendTestMessages(t, m, created.QueueID, 2)
+
+	lease := ReceiveOptions{Limit: 1, VisibilityTimeout: time.Minute}
+	first := receivedIDs(t, m, created, lease)
+	second := receivedIDs(t, m, created, lease)
+	third := receivedIDs(t, m, created, lease)
+	if len(first) != 1 || first[0] != ids[0] || len(second) != 1 || second[0] != ids[1] || len(third) != 0 {
+		t.Fatalf("consumers got %v, %v, %v; want [%s], [%s], []", first, second, third, ids[0], ids[1])
+	}
+
+	// A push delivery leaves both out; a plain receive still lists them
+	if skipped := receivedIDs(t, m, created, ReceiveOptions{SkipLeased: true}); len(skipped) != 0 {
+		t.Errorf("SkipLeased receive got %v, want none", skipped)
+	}
+	if plain := receivedIDs(t, m, created, ReceiveOptions{}); len(plain) != 2 {
+		t.Errorf("plain receive got %v, want both", plain)
+	}
+}
+
+func TestVisibilityTimeoutReleasesOnExpiryAndAck(t *testing.T) {
+	m := testManager(t)
+	created := createTestQueue(t, m, CreateQueueRequest{})
+	ids := sendTestMessages(t, m, created.QueueID, 1)
+
+	if got := receivedIDs(t, m, created, ReceiveOptions{VisibilityTimeout: 50 * time.Millisecond}); len(got) != 1 {
+		t.Fatalf("first receive got %v, want [%s]", got, ids[0])
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	// The lease ran out, so the message is back for the next consumer
+	got := receivedIDs(t, m, created, ReceiveOptions{VisibilityTimeout: time.Minute})
+	if len(got) != 1 || got[0] != ids[0] {
+		t.Fatalf("receive after expiry got %v, want [%s]", got, ids[0])
+	}
+
+	// Acking deletes it and drops the lease with it
+	ctx := context.Background()
+	if err := m.DeleteMessage(ctx, created.QueueID, ids[0], created.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	if m.Leased(ctx, created.QueueID, ids[0]) {
+		t.Error("lease outlived the acked message")
+	}
+}
+
+func TestVisibilityTimeoutRefusals(t *testing.T) {
+	m := testManager(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		req  CreateQueueRequest
+		opts ReceiveOptions
+		want error
+	}{
+		{"with cursor", CreateQueueRequest{}, ReceiveOptions{Cursor: EncodeCursor(1), VisibilityTimeout: time.Minute}, ErrCursorWithVisibility},
+		{"burn after read", CreateQueueRequest{BurnAfterRead: true}, ReceiveOptions{VisibilityTimeout: time.Minute}, ErrVisibilityUnsupported},
+		{"broadcast", CreateQueueRequest{Broadcast: true}, ReceiveOptions{VisibilityTimeout: time.Minute}, ErrVisibilityUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created := createTestQueue(t, m, tt.req)
+			_, err := m.ReceiveMessages(ctx, created.QueueID, created.AccessToken, tt.opts)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ReceiveMessages() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
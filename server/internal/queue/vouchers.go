@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrVouchersDisabled = errors.New("vouchers disabled")
+	ErrInvalidVoucher   = errors.New("invalid voucher")
+	ErrVoucherSpent     = errors.New("voucher already redeemed")
+)
+
+// VoucherLimits are what a queue may use once a voucher was redeemed for
+// it; they may exceed the server maximums
+type VoucherLimits struct {
+	MaxMessages    int
+	MaxMessageSize int
+	TTL            time.Duration // Queue lifetime from redemption
+}
+
+// RedeemVoucherRequest is sent to POST /queue/{queueID}/voucher
+type RedeemVoucherRequest struct {
+	Voucher string `json:"voucher"` // Unblinded voucher, encoded like a Private-Token
+}
+
+// VoucherResponse is returned after a voucher was redeemed
+type VoucherResponse struct {
+	ExpiresAt      time.Time `json:"expires_at"`
+	MaxMessages    int       `json:"max_messages"`
+	MaxMessageSize int       `json:"max_message_size"`
+}
+
+// EnableVouchers lets queue owners redeem vouchers for limits
+func (m *Manager) EnableVouchers(limits VoucherLimits) {
+	m.vouchers = &limits
+}
+
+// ElevateQueue raises a queue's limits to the voucher limits and extends
+// its lifetime to the voucher TTL from now (requires admin)
+// redeem spends the voucher; it runs only once the caller is known to own
+// a live queue, so a wrong token never costs a voucher
+// Limits never shrink; redeeming another voucher renews the lifetime
+func (m *Manager) ElevateQueue(ctx context.Context, queueID, accessToken string, redeem func() error) (*VoucherResponse, error) {
+	if m.vouchers == nil {
+		return nil, ErrVouchersDisabled
+	}
+	duress, err := underDuress(m.authorize(ctx, queueID, accessToken, CapAdmin))
+	if err != nil {
+		return nil, err
+	}
+	if !duress {
+		if _, err := m.loadQueue(ctx, queueID); err != nil {
+			return nil, err
+		}
+	}
+	if err := redeem(); err != nil {
+		return nil, err
+	}
+	if duress {
+		return m.decoyElevation(ctx, accessToken), nil
+	}
+
+	queue, err := m.changeQueue(ctx, queueID, func(queue *Queue) error {
+		queue.MaxMessages = max(m.messageLimit(queue), m.vouchers.MaxMessages)
+		queue.MaxMessageSize = max(m.sizeLimit(queue), m.vouchers.MaxMessageSize)
+		queue.Elevated = true
+		if expiresAt := time.Now().Add(m.vouchers.TTL); expiresAt.After(queue.ExpiresAt) {
+			return m.setExpiry(ctx, queue, expiresAt)
+		}
+		return m.updateQueue(ctx, queue)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &VoucherResponse{
+		ExpiresAt:      queue.ExpiresAt,
+		MaxMessages:    m.messageLimit(queue),
+		MaxMessageSize: m.sizeLimit(queue),
+	}, nil
+}
@@ -0,0 +1,321 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrNoWebhook      = errors.New("no webhook registered")
+	ErrInvalidWebhook = errors.New("webhook URL required")
+)
+
+// webhookDueKey is a sorted set of pending deliveries scored by the time
+// they are due; any replica may claim one by removing it
+const webhookDueKey = "webhooks:due"
+
+// WebhookSecretPrefix marks webhook signing secrets, as in the Standard Webhooks spec
+const WebhookSecretPrefix = "whsec_"
+
+// Webhook is the HTTPS endpoint a queue's new messages are posted to
+type Webhook struct {
+	URL           string    `json:"url"`
+	Secret        string    `json:"secret"`                    // HMAC key, shown to the owner once
+	AckOnDelivery bool      `json:"ack_on_delivery,omitempty"` // Delete messages the endpoint accepted
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// WebhookRequest registers a webhook, replacing any previous one
+// The URL is checked against the relay's egress policy before it is stored
+type WebhookRequest struct {
+	URL           string `json:"url"`
+	AckOnDelivery bool   `json:"ack_on_delivery,omitempty"`
+}
+
+// WebhookStatus describes a queue's webhook and its recent deliveries
+// Secret is only returned when the webhook is registered
+type WebhookStatus struct {
+	URL             string     `json:"url"`
+	Secret          string     `json:"secret,omitempty"`
+	AckOnDelivery   bool       `json:"ack_on_delivery"`
+	CreatedAt       time.Time  `json:"created_at"`
+	Failures        int        `json:"consecutive_failures"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastDeliveredAt *time.Time `json:"last_delivered_at,omitempty"`
+	DisabledAt      *time.Time `json:"disabled_at,omitempty"` // Set after too many failures; register again to re-enable
+}
+
+// WebhookDelivery is one pending post of a message to its queue's webhook
+type WebhookDelivery struct {
+	QueueID   string
+	MessageID string
+	Attempt   int // Failed attempts so far
+}
+
+func webhookStateKey(queueID string) string {
+	return fmt.Sprintf("queue:%s:webhook", queueID)
+}
+
+// member encodes a delivery for the due set; IDs never contain spaces
+func (d WebhookDelivery) member() string {
+	return fmt.Sprintf("%s %s %d", d.QueueID, d.MessageID, d.Attempt)
+}
+
+func parseWebhookDelivery(member string) (WebhookDelivery, bool) {
+	parts := strings.Split(member, " ")
+	if len(parts) != 3 {
+		return WebhookDelivery{}, false
+	}
+	attempt, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return WebhookDelivery{}, false
+	}
+	return WebhookDelivery{QueueID: parts[0], MessageID: parts[1], Attempt: attempt}, true
+}
+
+// SetWebhook registers the endpoint new messages are posted to, with a
+// fresh signing secret, and clears any failure history (requires admin)
+func (m *Manager) SetWebhook(ctx context.Context, queueID, accessToken string, req WebhookRequest) (*WebhookStatus, error) {
+	duress, err := underDuress(m.authorize(ctx, queueID, accessToken, CapAdmin))
+	if err != nil {
+		return nil, err
+	}
+	if req.URL == "" {
+		return nil, ErrInvalidWebhook
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	webhook := &Webhook{
+		URL:           req.URL,
+		Secret:        WebhookSecretPrefix + base64.StdEncoding.EncodeToString(key),
+		AckOnDelivery: req.AckOnDelivery,
+		CreatedAt:     time.Now(),
+	}
+	if duress {
+		// Nothing is stored, and nothing will ever be posted
+		return &WebhookStatus{URL: webhook.URL, Secret: webhook.Secret, AckOnDelivery: webhook.AckOnDelivery, CreatedAt: webhook.CreatedAt}, nil
+	}
+
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+	queue.Webhook = webhook
+	if err := m.updateQueue(ctx, queue); err != nil {
+		return nil, fmt.Errorf("failed to store webhook: %w", err)
+	}
+	m.redis.Del(ctx, webhookStateKey(queueID))
+
+	return &WebhookStatus{
+		URL:           queue.Webhook.URL,
+		Secret:        queue.Webhook.Secret,
+		AckOnDelivery: queue.Webhook.AckOnDelivery,
+		CreatedAt:     queue.Webhook.CreatedAt,
+	}, nil
+}
+
+// GetWebhook returns the queue's webhook and delivery state, without the secret (requires admin)
+func (m *Manager) GetWebhook(ctx context.Context, queueID, accessToken string) (*WebhookStatus, error) {
+	if err := m.authorize(ctx, queueID, accessToken, CapAdmin); err == errDuress {
+		return nil, ErrNoWebhook
+	} else if err != nil {
+		return nil, err
+	}
+	queue, err := m.loadQueue(ctx, queueID)
+	if err != nil {
+		return nil, err
+	}
+	if queue.Webhook == nil {
+		return nil, ErrNoWebhook
+	}
+
+	status := &WebhookStatus{
+		URL:           queue.Webhook.URL,
+		AckOnDelivery: queue.Webhook.AckOnDelivery,
+		CreatedAt:     queue.Webhook.CreatedAt,
+	}
+	state, err := m.redis.HGetAll(ctx, webhookStateKey(queueID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhook state: %w", err)
+	}
+	status.Failures, _ = strconv.Atoi(state["failures"])
+	status.LastError = state["last_error"]
+	status.LastDeliveredAt = parseStateTime(state["last_delivered_at"])
+	status.DisabledAt = parseStateTime(state["disabled_at"])
+	return status, nil
+}
+
+// DeleteWebhook stops posting messages; pending deliveries are dropped (requires admin)
+func (m *Manager) DeleteWebhook(ctx context.Context, queueID, accessToken string) error {
+	if err := m.authorize(ctx, queueID, accessToken, CapAdmin); err == errDuress {
+		return ErrNoWebhook
+	} else if err != nil {
+		return err
+	}
+	queue, err := m.getQueue(ctx, queueID)
+	if err != nil {
+		return err
+	}
+	if queue.Webhook == nil {
+		return ErrNoWebhook
+	}
+
+	queue.Webhook = nil
+	if err := m.updateQueue(ctx, queue); err != nil {
+		return fmt.Errorf("failed to remove webhook: %w", err)
+	}
+	m.redis.Del(ctx, webhookStateKey(queueID))
+	return nil
+}
+
+// scheduleWebhook queues a delivery to be attempted at the given time
+func (m *Manager) scheduleWebhook(ctx context.Context, delivery WebhookDelivery, at time.Time) error {
+	err := m.redis.ZAdd(ctx, webhookDueKey, redis.Z{Score: float64(at.UnixMilli()), Member: delivery.member()}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to schedule webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// RetryWebhook schedules another attempt at a failed delivery
+func (m *Manager) RetryWebhook(ctx context.Context, delivery WebhookDelivery, at time.Time) error {
+	delivery.Attempt++
+	return m.scheduleWebhook(ctx, delivery, at)
+}
+
+// DueWebhooks claims up to limit deliveries that are due
+// Each is removed from the schedule as it is claimed, so every delivery goes
+// to exactly one replica; a replica that dies mid-post loses that attempt
+func (m *Manager) DueWebhooks(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	members, err := m.redis.ZRangeByScore(ctx, webhookDueKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read due webhooks: %w", err)
+	}
+
+	var due []WebhookDelivery
+	for _, member := range members {
+		removed, err := m.redis.ZRem(ctx, webhookDueKey, member).Result()
+		if err != nil {
+			return due, fmt.Errorf("failed to claim webhook delivery: %w", err)
+		}
+		if removed == 0 {
+			continue // Another replica claimed it
+		}
+		if delivery, ok := parseWebhookDelivery(member); ok {
+			due = append(due, delivery)
+		}
+	}
+	return due, nil
+}
+
+// WebhookTarget loads what a delivery posts: the webhook and the message
+// ErrNoWebhook means the webhook was removed or disabled since the delivery
+// was scheduled, ErrMessageNotFound that the message is already gone
+func (m *Manager) WebhookTarget(ctx context.Context, delivery WebhookDelivery) (*Webhook, *Message, error) {
+	queue, err := m.getQueue(ctx, delivery.QueueID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if queue.Webhook == nil {
+		return nil, nil, ErrNoWebhook
+	}
+	disabled, err := m.redis.HExists(ctx, webhookStateKey(delivery.QueueID), "disabled_at").Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load webhook state: %w", err)
+	}
+	if disabled {
+		return nil, nil, ErrNoWebhook
+	}
+
+	messageKey := fmt.Sprintf("message:%s:%s", delivery.QueueID, delivery.MessageID)
+	messageData, err := m.redis.Get(ctx, messageKey).Result()
+	if err == redis.Nil {
+		return nil, nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	var message Message
+	if err := m.decode(ctx, messageKey, messageData, &message); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode message: %w", err)
+	}
+	if err := m.hydrate(ctx, &message); err != nil {
+		return nil, nil, fmt.Errorf("failed to load archived payload: %w", err)
+	}
+	return queue.Webhook, &message, nil
+}
+
+// WebhookSucceeded resets the failure count after the endpoint accepted a
+// message, and deletes the message if the owner asked for that or the
+// queue is burn-after-read
+func (m *Manager) WebhookSucceeded(ctx context.Context, delivery WebhookDelivery) {
+	m.RecordEvent(delivery.QueueID, EventPosted, delivery.MessageID)
+
+	queue, err := m.loadQueue(ctx, delivery.QueueID)
+	if err != nil {
+		return
+	}
+	stateKey := webhookStateKey(delivery.QueueID)
+	pipe := m.redis.TxPipeline()
+	pipe.HSet(ctx, stateKey, "failures", 0, "last_delivered_at", time.Now().Format(time.RFC3339))
+	pipe.HDel(ctx, stateKey, "last_error")
+	pipe.ExpireAt(ctx, stateKey, queue.ExpiresAt)
+	pipe.Exec(ctx)
+
+	if queue.BurnAfterRead || (queue.Webhook != nil && queue.Webhook.AckOnDelivery) {
+		if claimed, _ := m.ClaimMessage(ctx, delivery.QueueID, delivery.MessageID); claimed {
+			m.RecordEvent(delivery.QueueID, EventAcked, delivery.MessageID)
+		}
+	}
+}
+
+// WebhookFailed records a failed attempt and disables the webhook once
+// maxFailures attempts in a row have failed (0 = never)
+func (m *Manager) WebhookFailed(ctx context.Context, delivery WebhookDelivery, reason string, maxFailures int) (disabled bool, err error) {
+	queue, err := m.loadQueue(ctx, delivery.QueueID)
+	if err != nil {
+		return false, err
+	}
+
+	stateKey := webhookStateKey(delivery.QueueID)
+	pipe := m.redis.TxPipeline()
+	failures := pipe.HIncrBy(ctx, stateKey, "failures", 1)
+	pipe.HSet(ctx, stateKey, "last_error", reason)
+	pipe.ExpireAt(ctx, stateKey, queue.ExpiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("failed to record webhook failure: %w", err)
+	}
+
+	if maxFailures <= 0 || failures.Val() < int64(maxFailures) {
+		return false, nil
+	}
+	// Only the attempt that crossed the threshold reports the disabling
+	set, err := m.redis.HSetNX(ctx, stateKey, "disabled_at", time.Now().Format(time.RFC3339)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to disable webhook: %w", err)
+	}
+	return set, nil
+}
+
+func parseStateTime(value string) *time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
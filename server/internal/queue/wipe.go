@@ -0,0 +1,127 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"privmsg-relay/internal/macaroon"
+)
+
+// ErrInvalidWipe is returned for a wipe request without tokens or with too many
+var ErrInvalidWipe = errors.New("invalid wipe request")
+
+// MaxWipeTokens caps the access tokens one wipe request may carry
+const MaxWipeTokens = 100
+
+// WipeRequest proves possession of the tokens whose queues are to be destroyed
+type WipeRequest struct {
+	AccessTokens []string `json:"access_tokens"` // Admin tokens or macaroons, one or more per queue
+}
+
+// WipeResponse lists what a wipe destroyed
+type WipeResponse struct {
+	QueueIDs []string  `json:"queue_ids"`
+	WipedAt  time.Time `json:"wiped_at"`
+}
+
+// WipeTargets returns the queues a wipe would destroy, checking that every
+// token grants admin on its queue; one bad token fails the whole request
+func (m *Manager) WipeTargets(ctx context.Context, req WipeRequest) ([]string, error) {
+	if len(req.AccessTokens) == 0 || len(req.AccessTokens) > MaxWipeTokens {
+		return nil, ErrInvalidWipe
+	}
+
+	seen := make(map[string]bool)
+	for _, accessToken := range req.AccessTokens {
+		var queueID string
+		if m.macaroonSecret != nil && macaroon.Is(accessToken) {
+			mac, err := macaroon.Decode(accessToken)
+			if err != nil {
+				return nil, ErrInvalidAccessToken
+			}
+			queue, err := m.loadQueue(ctx, mac.ID)
+			if err == ErrQueueNotFound {
+				return nil, ErrInvalidAccessToken
+			} else if err != nil {
+				return nil, err
+			}
+			if err := m.verifyMacaroon(queue, accessToken, CapAdmin); err != nil {
+				return nil, err
+			}
+			queueID = mac.ID
+		} else {
+			record, err := m.lookupToken(ctx, accessToken)
+			if err != nil {
+				return nil, err
+			}
+			if record == nil {
+				return nil, ErrInvalidAccessToken
+			}
+			// A duress token destroys its queue anyway
+			if !record.has(CapAdmin) && !record.Duress {
+				return nil, ErrInsufficientScope
+			}
+			queueID = record.QueueID
+		}
+		seen[queueID] = true
+	}
+
+	queueIDs := make([]string, 0, len(seen))
+	for queueID := range seen {
+		queueIDs = append(queueIDs, queueID)
+	}
+	sort.Strings(queueIDs)
+	return queueIDs, nil
+}
+
+// Wipe destroys every queue the tokens grant admin on, with its messages,
+// tokens, push registrations, webhook and farewell
+// The queue records, which hold the push registrations and webhooks, and
+// every token mapping go in one transaction, so no queue outlives another
+// and nothing is deleted if a token is bad; the rest is swept afterwards
+func (m *Manager) Wipe(ctx context.Context, req WipeRequest) (*WipeResponse, error) {
+	queueIDs, err := m.WipeTargets(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := make([][]string, len(queueIDs))
+	for i, queueID := range queueIDs {
+		indexes[i], err = m.redis.HVals(ctx, fmt.Sprintf("queue:%s:tokens", queueID)).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tokens: %w", err)
+		}
+	}
+
+	pipe := m.redis.TxPipeline()
+	for i, queueID := range queueIDs {
+		if queue, err := m.loadQueue(ctx, queueID); err == nil && queue.TenantID != "" {
+			pipe.ZRem(ctx, tenantQueuesKey(queue.TenantID), queueID)
+		}
+		pipe.Del(ctx, fmt.Sprintf("queue:%s", queueID), queueStateKey(queueID))
+		pipe.Del(ctx, fmt.Sprintf("queue:%s:tokens", queueID))
+		pipe.Del(ctx, farewellKey(queueID))
+		pipe.Del(ctx, pushQuietKey(queueID))
+		for _, token := range indexes[i] {
+			pipe.Del(ctx, fmt.Sprintf("token:%s", token))
+		}
+	}
+	// Tokens predating the token index are only known from the request
+	for _, accessToken := range req.AccessTokens {
+		if !macaroon.Is(accessToken) {
+			pipe.Del(ctx, fmt.Sprintf("token:%s", accessToken))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to wipe queues: %w", err)
+	}
+
+	for _, queueID := range queueIDs {
+		m.purgeQueue(ctx, queueID)
+		m.redis.Del(ctx, farewellKey(queueID))
+	}
+	return &WipeResponse{QueueIDs: queueIDs, WipedAt: time.Now().UTC()}, nil
+}
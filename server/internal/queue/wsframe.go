@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// WebSocket subprotocols, offered by clients in Sec-WebSocket-Protocol
+// A client that offers none is treated as speaking WSProtocol
+const (
+	WSProtocol = "privmsg.v1" // JSON text frames
+
+	// Like WSProtocol, but message frames are sent as binary frames
+	// carrying the raw ciphertext; every other frame stays JSON text
+	WSBinaryProtocol = "privmsg.binary.v1"
+
+	// Like WSBinaryProtocol, but inside a Noise session: the connection
+	// opens with a Noise_IK or Noise_XX handshake (25519, ChaChaPoly,
+	// SHA256) against the relay's static key, and every frame after it is
+	// encrypted. Offered only by relays with WS_NOISE set
+	WSNoiseIKProtocol = "privmsg.noise-ik.v1"
+	WSNoiseXXProtocol = "privmsg.noise-xx.v1"
+)
+
+// WSProtocols lists the subprotocols the relay speaks, most preferred first
+var WSProtocols = []string{WSBinaryProtocol, WSProtocol}
+
+// ErrInvalidBinaryFrame is returned for a binary frame that cannot be parsed
+var ErrInvalidBinaryFrame = errors.New("invalid binary frame")
+
+// EncodeWSBinary lays out a message frame as a 4-byte big-endian header
+// length, the frame without its payload as JSON, then the payload bytes
+func EncodeWSBinary(frame WSMessage) ([]byte, error) {
+	payload := frame.Payload
+	frame.Payload = nil
+	header, err := json.Marshal(frame)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal frame header: %w", err)
+	}
+
+	data := make([]byte, 4, 4+len(header)+len(payload))
+	binary.BigEndian.PutUint32(data, uint32(len(header)))
+	data = append(data, header...)
+	return append(data, payload...), nil
+}
+
+// DecodeWSBinary parses a frame produced by EncodeWSBinary
+func DecodeWSBinary(data []byte) (WSMessage, error) {
+	var frame WSMessage
+	if len(data) < 4 {
+		return frame, ErrInvalidBinaryFrame
+	}
+	headerLen := binary.BigEndian.Uint32(data)
+	if uint64(headerLen) > uint64(len(data)-4) {
+		return frame, ErrInvalidBinaryFrame
+	}
+	if err := json.Unmarshal(data[4:4+headerLen], &frame); err != nil {
+		return frame, ErrInvalidBinaryFrame
+	}
+	frame.Payload = data[4+headerLen:]
+	return frame, nil
+}
@@ -0,0 +1,105 @@
+// Package realip recovers the client address behind trusted reverse proxies
+//
+// Forwarding headers and PROXY protocol headers are honored only when the
+// connection comes from a configured proxy range; anyone else could forge
+// them to dodge per-IP limits
+package realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolver decides which peers may speak for the client
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// NewResolver parses trusted proxy CIDRs and single addresses
+func NewResolver(entries []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			r.trusted = append(r.trusted, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		r.trusted = append(r.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return r, nil
+}
+
+// Trusted reports whether addr belongs to a trusted proxy
+func (r *Resolver) Trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that sent req
+// Behind trusted proxies this is the right-most X-Forwarded-For entry that
+// is not itself a trusted proxy, or X-Real-IP when there is no such header
+func (r *Resolver) ClientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !r.Trusted(peer) {
+		return host
+	}
+
+	// Entries are appended by each hop, so only the right end is trustworthy
+	var hops []string
+	for _, header := range req.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break // Whatever is left of garbage cannot be trusted
+		}
+		client = addr.Unmap().String()
+		if !r.Trusted(addr) {
+			return client
+		}
+	}
+	if client != "" {
+		return client // Every hop is a trusted proxy; the left-most is closest to the client
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSpace(req.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap().String()
+	}
+	return host
+}
+
+// Middleware rewrites RemoteAddr to the resolved client address, so every
+// later handler and log line sees the real client
+func (r *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if ip := r.ClientIP(req); ip != "" {
+			port := "0"
+			if _, p, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+				port = p
+			}
+			req.RemoteAddr = net.JoinHostPort(ip, port)
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,45 @@
+package relay
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestAccessLogKeepsNoSender(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	router := chi.NewRouter()
+	router.Use(accessLog)
+	router.Post("/queue/{queueID}/send", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	const (
+		queueID   = "4f1d0c9a6b2e8d7f"
+		sendToken = "member-send-token-0123456789"
+		sender    = "203.0.113.7"
+	)
+	req := httptest.NewRequest(http.MethodPost, "/queue/"+queueID+"/send?send_token="+sendToken, strings.NewReader(`{}`))
+	req.RemoteAddr = sender + ":50000"
+	req.Header.Set("Authorization", "Bearer "+sendToken)
+	req.Header.Set("X-Forwarded-For", sender)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := logs.String()
+	if !strings.Contains(line, "route=/queue/{queueID}/send") || !strings.Contains(line, "status=201") {
+		t.Fatalf("access log line missing route or status: %s", line)
+	}
+	for _, secret := range []string{queueID, sendToken, sender} {
+		if strings.Contains(line, secret) {
+			t.Errorf("access log holds %q: %s", secret, line)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package relay
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"privmsg-relay/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Bulk operation names accepted by POST /admin/bulk
+const (
+	bulkFreeze   = "freeze"
+	bulkUnfreeze = "unfreeze"
+	bulkDelete   = "delete"
+	bulkExtend   = "extend"
+)
+
+// maxBulkLineLength bounds a single queue ID line in a bulk request
+const maxBulkLineLength = 256
+
+// BulkItemResult reports the outcome for one queue ID
+type BulkItemResult struct {
+	QueueID   string     `json:"queue_id"`
+	Status    string     `json:"status"` // ok, would_apply, not_found, error
+	Error     string     `json:"error,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// BulkSummary is the final line of a bulk response
+type BulkSummary struct {
+	Operation string `json:"operation"`
+	DryRun    bool   `json:"dry_run"`
+	Total     int    `json:"total"`
+	Applied   int    `json:"applied"`
+	NotFound  int    `json:"not_found"`
+	Failed    int    `json:"failed"`
+	Stopped   string `json:"stopped,omitempty"` // Why the run ended before the end of the list; Total says how far it got
+}
+
+// bulkItemWriteWait bounds writing one bulk result line; the response as a
+// whole is not bounded by the server's timeouts
+const bulkItemWriteWait = 10 * time.Second
+
+// requireAdmin guards operator endpoints with the configured admin token
+// The admin surface doesn't exist at all when no token is configured
+// Browsers (the console) may present the token as the Basic auth password
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		token := bearerToken(r)
+		if _, password, ok := r.BasicAuth(); ok {
+			token = password
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			if s.adminConsole {
+				w.Header().Set("WWW-Authenticate", `Basic realm="relay admin"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAdminBulk applies an operation to every queue ID in the request body
+// (one per line, # comments allowed) and streams one JSON result per line,
+// followed by a summary line that is written even when the run stops early
+// Like event streams it is exempt from the request timeout
+//
+//	POST /admin/bulk?op=freeze|unfreeze|delete|extend[&extend=24h][&dry_run=true]
+func (s *Server) handleAdminBulk(w http.ResponseWriter, r *http.Request) {
+	op := r.URL.Query().Get("op")
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	var extend time.Duration
+	switch op {
+	case bulkFreeze, bulkUnfreeze, bulkDelete:
+	case bulkExtend:
+		var err error
+		extend, err = time.ParseDuration(r.URL.Query().Get("extend"))
+		if err != nil || extend <= 0 {
+			http.Error(w, "extend requires a positive duration, e.g. extend=24h", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "op must be one of freeze, unfreeze, delete, extend", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+
+	// Long lists outlive the server's read and write timeouts: lift the
+	// read deadline, and renew the write deadline for every line instead
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	writeLine := func(v interface{}) {
+		rc.SetWriteDeadline(time.Now().Add(bulkItemWriteWait))
+		encoder.Encode(v)
+		rc.Flush()
+	}
+
+	summary := BulkSummary{Operation: op, DryRun: dryRun}
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, maxBulkLineLength), maxBulkLineLength)
+
+	for scanner.Scan() {
+		if err := r.Context().Err(); err != nil {
+			summary.Stopped = err.Error()
+			break
+		}
+
+		queueID := strings.TrimSpace(scanner.Text())
+		if queueID == "" || strings.HasPrefix(queueID, "#") {
+			continue
+		}
+		summary.Total++
+
+		result := s.applyBulk(op, queueID, extend, dryRun)
+		switch result.Status {
+		case "ok", "would_apply":
+			summary.Applied++
+		case "not_found":
+			summary.NotFound++
+		default:
+			summary.Failed++
+		}
+
+		writeLine(result)
+	}
+
+	if err := scanner.Err(); err != nil {
+		summary.Stopped = "failed to read ID list: " + err.Error()
+	}
+	writeLine(map[string]BulkSummary{"summary": summary})
+}
+
+// applyBulk runs one bulk operation against a single queue
+func (s *Server) applyBulk(op, queueID string, extend time.Duration, dryRun bool) BulkItemResult {
+	result := BulkItemResult{QueueID: queueID}
+
+	if dryRun {
+		exists, err := s.queueManager.QueueExists(queueID)
+		switch {
+		case err != nil:
+			result.Status, result.Error = "error", err.Error()
+		case !exists:
+			result.Status = "not_found"
+		default:
+			result.Status = "would_apply"
+		}
+		return result
+	}
+
+	var err error
+	switch op {
+	case bulkFreeze:
+		err = s.queueManager.SetFrozen(queueID, true)
+	case bulkUnfreeze:
+		err = s.queueManager.SetFrozen(queueID, false)
+	case bulkDelete:
+		err = s.queueManager.AdminDeleteQueue(queueID)
+	case bulkExtend:
+		var expiresAt time.Time
+		expiresAt, err = s.queueManager.ExtendQueue(queueID, extend)
+		if err == nil {
+			result.ExpiresAt = &expiresAt
+		}
+	}
+
+	switch {
+	case err == queue.ErrQueueNotFound:
+		result.Status = "not_found"
+	case err != nil:
+		result.Status, result.Error = "error", err.Error()
+	default:
+		result.Status = "ok"
+	}
+	return result
+}
+
+// handleAdminInspectQueue shows one queue's metadata and counts
+//
+//	GET /admin/queue/{queueID}
+func (s *Server) handleAdminInspectQueue(w http.ResponseWriter, r *http.Request) {
+	info, err := s.queueManager.InspectQueue(chi.URLParam(r, "queueID"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// handleAdminDeleteQueue deletes a queue without its token and disconnects
+// its live subscribers
+//
+//	DELETE /admin/queue/{queueID}
+func (s *Server) handleAdminDeleteQueue(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	if err := s.queueManager.AdminDeleteQueue(queueID); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.dropSubscribers(queueID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminCleanup runs the periodic cleanup now
+//
+//	POST /admin/cleanup
+func (s *Server) handleAdminCleanup(w http.ResponseWriter, r *http.Request) {
+	swept, err := s.queueManager.CleanupExpiredQueues()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"archived_payloads_swept": swept})
+}
+
+// handleAtRestStatus lists the data keys sealing queue records and messages
+//
+//	GET /admin/at-rest
+func (s *Server) handleAtRestStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := s.queueManager.AtRestStatus(r.Context())
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleRotateAtRestKey switches new writes to a fresh data key
+//
+//	POST /admin/at-rest/rotate
+func (s *Server) handleRotateAtRestKey(w http.ResponseWriter, r *http.Request) {
+	status, err := s.queueManager.RotateAtRestKey(r.Context())
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// dropSubscribers stops pushing a queue's messages: WebSocket connections
+// forget the queue and event streams end
+func (s *Server) dropSubscribers(queueID string) {
+	s.wsMutex.Lock()
+	clients := s.wsConnections[queueID]
+	delete(s.wsConnections, queueID)
+	for _, stream := range s.sseStreams[queueID] {
+		stream.close() // The stream's handler unsubscribes on the way out
+	}
+	s.wsMutex.Unlock()
+
+	for _, client := range clients {
+		client.release(queueID) // Nothing left to redeliver into
+	}
+}
@@ -0,0 +1,138 @@
+package relay
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"privmsg-relay/internal/anontoken"
+)
+
+type contextKey string
+
+// ctxRateLimitExempt marks requests that redeemed a valid anonymous token
+const ctxRateLimitExempt contextKey = "rate-limit-exempt"
+
+// Header carrying a redeemable anonymous token
+const privateTokenHeader = "Private-Token"
+
+// IssueTokenRequest carries a client-blinded token nonce
+type IssueTokenRequest struct {
+	BlindedMessage []byte `json:"blinded_message"`
+}
+
+// IssueTokenResponse carries the blind signature over the request
+type IssueTokenResponse struct {
+	KeyID          string `json:"key_id"`
+	BlindSignature []byte `json:"blind_signature"`
+}
+
+// TokenKeyResponse publishes the issuer key clients blind against
+type TokenKeyResponse struct {
+	KeyID     string `json:"key_id"`
+	PublicKey []byte `json:"public_key"` // PKIX DER
+}
+
+func (s *Server) handleTokenKey(w http.ResponseWriter, r *http.Request) {
+	writeIssuerKey(w, s.anonTokens)
+}
+
+// writeIssuerKey publishes the key of a blind-signing service
+func writeIssuerKey(w http.ResponseWriter, service *anontoken.Service) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TokenKeyResponse{
+		KeyID:     service.KeyID(),
+		PublicKey: service.PublicKeyDER(),
+	})
+}
+
+// handleIssueToken blind-signs a token for a trusted attester
+// The attester (e.g. an app-store-verified client backend) authenticates with
+// the issuer secret; the relay never learns which token it signed
+func (s *Server) handleIssueToken(w http.ResponseWriter, r *http.Request) {
+	issueBlind(w, r, s.anonTokens, s.anonTokenIssuerSecret)
+}
+
+// issueBlind blind-signs the request's message with service for the holder
+// of issuerSecret (empty = issuance disabled)
+func issueBlind(w http.ResponseWriter, r *http.Request, service *anontoken.Service, issuerSecret string) {
+	if issuerSecret == "" {
+		http.Error(w, "token issuance disabled", http.StatusNotFound)
+		return
+	}
+
+	secret := bearerToken(r)
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(issuerSecret)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req IssueTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	signature, err := service.Issue(req.BlindedMessage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(IssueTokenResponse{
+		KeyID:          service.KeyID(),
+		BlindSignature: signature,
+	})
+}
+
+// redeemAnonToken exempts a request from per-IP limits if it carries a valid,
+// unspent anonymous token. Requests without the header pass through unchanged
+func (s *Server) redeemAnonToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoded := strings.TrimSpace(r.Header.Get(privateTokenHeader))
+		if encoded == "" || s.anonTokens == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, err := anontoken.DecodeToken(encoded)
+		if err == nil {
+			err = s.anonTokens.Redeem(token)
+		}
+		if err != nil {
+			if err == anontoken.ErrInvalidToken || err == anontoken.ErrTokenSpent {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ctxRateLimitExempt, true)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// redeemForPolicy redeems anonymous tokens on routes without a per-IP limit,
+// where a token only moves the request into the policy's "token" rate class
+// Without a policy it would lift nothing, so the header is ignored and the
+// token is left unspent
+func (s *Server) redeemForPolicy(next http.Handler) http.Handler {
+	redeem := s.redeemAnonToken(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.policy == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		redeem.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitExempt reports whether the request redeemed an anonymous token
+func rateLimitExempt(r *http.Request) bool {
+	exempt, _ := r.Context().Value(ctxRateLimitExempt).(bool)
+	return exempt
+}
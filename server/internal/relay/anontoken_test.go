@@ -0,0 +1,89 @@
+package relay
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"privmsg-relay/internal/anontoken"
+	"privmsg-relay/internal/policy"
+	"privmsg-relay/internal/queue"
+)
+
+// issueAnonToken runs a full blind issuance against service
+func issueAnonToken(t *testing.T, service *anontoken.Service, pub *rsa.PublicKey) *anontoken.Token {
+	t.Helper()
+	state, blinded, err := anontoken.Blind(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blindSig, err := service.Issue(blinded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := anontoken.Finalize(pub, state, blindSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestAnonTokenSpentOnlyWhereItLiftsALimit(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(t.TempDir(), "policy.star")
+	if err := os.WriteFile(script, []byte("def allow(req):\n    return True\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	engine, err := policy.Load(script)
+	if errors.Is(err, policy.ErrNotIncluded) {
+		t.Skip("policy engine not in this build")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		policy *policy.Engine
+		spent  bool
+	}{
+		{"no policy", nil, false},
+		{"policy loaded", engine, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := testRedis(t)
+			service := anontoken.NewService(key, client)
+			m, server := testServerWith(t, client, Options{AnonTokens: service, Policy: tt.policy})
+			created := createTestQueue(t, m)
+			token := issueAnonToken(t, service, &key.PublicKey)
+
+			body, _ := json.Marshal(queue.SendMessageRequest{Payload: []byte("hello")})
+			req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/queue/"+created.QueueID+"/send", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(privateTokenHeader, anontoken.EncodeToken(token))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("send: status %d", resp.StatusCode)
+			}
+
+			err = service.Redeem(token)
+			if spent := errors.Is(err, anontoken.ErrTokenSpent); spent != tt.spent {
+				t.Errorf("token spent by send = %v, want %v (Redeem: %v)", spent, tt.spent, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package relay
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"privmsg-relay/internal/authhook"
+)
+
+// authorize runs the deployment's auth hook for a privileged operation
+// Returns false (after writing the response) if the request must not proceed
+// Public builds have no hook configured and every request passes
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, op authhook.Operation, queueID string) bool {
+	if s.authHook == nil {
+		return true
+	}
+
+	err := s.authHook.Authorize(r.Context(), &authhook.Request{
+		Operation:  op,
+		QueueID:    queueID,
+		Credential: r.Header.Get(authhook.CredentialHeader),
+		ClientIP:   clientIP(r),
+	})
+	if err == nil {
+		return true
+	}
+
+	if errors.Is(err, authhook.ErrDenied) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+	} else {
+		// Fail closed when the hook itself is broken
+		slog.Error("Auth hook failed", "error", err)
+		http.Error(w, "authentication service unavailable", http.StatusServiceUnavailable)
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"privmsg-relay/internal/policy"
+	"privmsg-relay/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleSendBatch posts several messages to a queue, reporting each one
+func (s *Server) handleSendBatch(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	sendToken := bearerToken(r)
+
+	var req queue.BatchSendRequest
+	if err := decodeBody(r, &req, queue.MaxBatchSize*s.maxBinaryBody()); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if !checkBatchSize(w, len(req.Messages)) {
+		return
+	}
+
+	namespace := s.queueNamespace(r.Context(), queueID)
+	results := make([]queue.BatchItemResult, len(req.Messages))
+	for i, item := range req.Messages {
+		results[i] = s.sendBatchItem(r, queueID, sendToken, namespace, item)
+		results[i].Index = i
+	}
+	writeBatch(w, r, results)
+}
+
+// sendBatchItem runs one batch item through the same checks as a single send
+func (s *Server) sendBatchItem(r *http.Request, queueID, sendToken, namespace string, item queue.SendMessageRequest) queue.BatchItemResult {
+	if item.TTLSeconds < 0 {
+		return queue.BatchItemResult{Status: http.StatusBadRequest, Error: "ttl_seconds must not be negative"}
+	}
+	if err := s.policyError(r, policy.ActionSend, len(item.Payload), namespace); err != nil {
+		return queue.BatchItemResult{Status: http.StatusForbidden, Error: err.Error()}
+	}
+
+	response, err := s.queueManager.SendMessage(r.Context(), queueID, item.Payload, queue.SendOptions{
+		SendToken: sendToken,
+		TTL:       time.Duration(item.TTLSeconds) * time.Second,
+		Priority:  item.Priority,
+	})
+	if err != nil {
+		return s.batchError(err)
+	}
+
+	if !response.Held {
+		s.notifySubscribers(queueID, &queue.Message{
+			ID:         response.MessageID,
+			QueueID:    queueID,
+			Seq:        response.Seq,
+			Payload:    item.Payload,
+			ReceivedAt: response.SentAt,
+			ExpiresAt:  response.ExpiresAt,
+
+			PayloadHash: response.PayloadHash,
+		}, response.BurnAfterRead)
+	}
+
+	return queue.BatchItemResult{Status: http.StatusCreated, Message: response}
+}
+
+// handleAckBatch deletes several received messages, reporting each one
+func (s *Server) handleAckBatch(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	var req queue.BatchAckRequest
+	if err := decodeBody(r, &req, s.maxBinaryBody()); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if !checkBatchSize(w, len(req.MessageIDs)) {
+		return
+	}
+
+	results := make([]queue.BatchItemResult, len(req.MessageIDs))
+	for i, messageID := range req.MessageIDs {
+		if messageID == "" {
+			results[i] = queue.BatchItemResult{Status: http.StatusBadRequest, Error: "message ID required"}
+		} else if err := s.queueManager.DeleteMessage(r.Context(), queueID, messageID, accessToken); err != nil {
+			results[i] = s.batchError(err)
+		} else {
+			s.acked(queueID, messageID)
+			results[i] = queue.BatchItemResult{Status: http.StatusNoContent}
+		}
+		results[i].Index = i
+	}
+	writeBatch(w, r, results)
+}
+
+// checkBatchSize rejects empty and oversized batches as a whole
+func checkBatchSize(w http.ResponseWriter, n int) bool {
+	if n == 0 || n > queue.MaxBatchSize {
+		http.Error(w, fmt.Sprintf("batch must have 1 to %d items", queue.MaxBatchSize), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// batchError reports err for one item exactly as a single request would
+func (s *Server) batchError(err error) queue.BatchItemResult {
+	status, message := s.errorResponse(err)
+	result := queue.BatchItemResult{Status: status, Error: message}
+	var gone *queue.QueueGoneError
+	if errors.As(err, &gone) {
+		result.Farewell = gone.Farewell
+	}
+	return result
+}
+
+// writeBatch sends 200 when every item succeeded and 207 when any failed;
+// the status of the batch as a whole never implies a rollback
+func writeBatch(w http.ResponseWriter, r *http.Request, results []queue.BatchItemResult) {
+	response := queue.BatchResponse{Results: results}
+	for _, result := range results {
+		if result.Status >= 200 && result.Status < 300 {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+
+	status := http.StatusOK
+	if response.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+
+	writeBody(w, r, status, response)
+}
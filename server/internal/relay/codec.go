@@ -0,0 +1,131 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"privmsg-relay/internal/pbwire"
+	"privmsg-relay/internal/wirefmt"
+)
+
+// envelopeOverhead is what a binary envelope may add around its payload
+const envelopeOverhead = 64 * 1024
+
+// maxBinaryBody bounds non-JSON single-message request bodies, which are
+// read whole; batches allow one per item
+func (s *Server) maxBinaryBody() int64 {
+	return int64(s.queueManager.MaxMessageSize()) + envelopeOverhead
+}
+
+// errBodyTooLarge is returned by decodeBody for oversized binary bodies
+var errBodyTooLarge = errors.New("request body too large")
+
+// codec is a body encoding besides JSON
+type codec struct {
+	contentType string
+	marshal     func(v interface{}) ([]byte, error)
+	unmarshal   func(data []byte, v interface{}) error
+}
+
+// codecs maps media types (including common aliases) to encodings
+var codecs = map[string]codec{
+	pbwire.ContentType:         {pbwire.ContentType, pbwire.Marshal, pbwire.Unmarshal},
+	wirefmt.ContentTypeCBOR:    {wirefmt.ContentTypeCBOR, wirefmt.MarshalCBOR, wirefmt.UnmarshalCBOR},
+	wirefmt.ContentTypeMsgPack: {wirefmt.ContentTypeMsgPack, wirefmt.MarshalMsgPack, wirefmt.UnmarshalMsgPack},
+	"application/x-msgpack":    {wirefmt.ContentTypeMsgPack, wirefmt.MarshalMsgPack, wirefmt.UnmarshalMsgPack},
+	"application/vnd.msgpack":  {wirefmt.ContentTypeMsgPack, wirefmt.MarshalMsgPack, wirefmt.UnmarshalMsgPack},
+}
+
+// decodeBody parses a request body in the format named by Content-Type
+// (JSON when absent or unrecognized); binary bodies over limit are rejected
+func decodeBody(r *http.Request, v interface{}, limit int64) error {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	c, ok := codecs[contentType]
+	if !ok {
+		return json.NewDecoder(r.Body).Decode(v)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > limit {
+		return errBodyTooLarge
+	}
+	return c.unmarshal(data, v)
+}
+
+// writeBodyError answers a decodeBody failure
+func writeBodyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errBodyTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "invalid request body", http.StatusBadRequest)
+}
+
+// writeBody sends a response in the client's most preferred format that
+// can encode v, falling back to JSON
+func writeBody(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Add("Vary", "Accept")
+	for _, mediaType := range acceptedTypes(r) {
+		if mediaType == "application/json" {
+			break
+		}
+		c, ok := codecs[mediaType]
+		if !ok {
+			continue
+		}
+		data, err := c.marshal(v)
+		if err != nil {
+			continue // No encoding for this type in that format
+		}
+		w.Header().Set("Content-Type", c.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(status)
+		w.Write(data)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// acceptedTypes lists the media types in the Accept header, most preferred
+// first; entries with q=0 are dropped and wildcards keep the JSON default
+func acceptedTypes(r *http.Request) []string {
+	type entry struct {
+		mediaType string
+		quality   float64
+	}
+	var entries []entry
+	for _, item := range strings.Split(r.Header.Get("Accept"), ",") {
+		name, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			entries = append(entries, entry{name, quality})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].quality > entries[j].quality })
+
+	types := make([]string, len(entries))
+	for i, e := range entries {
+		types[i] = e.mediaType
+	}
+	return types
+}
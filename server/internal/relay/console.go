@@ -0,0 +1,184 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"privmsg-relay/internal/queue"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// requestCounters tracks aggregate request outcomes for the console
+type requestCounters struct {
+	total   atomic.Int64
+	success atomic.Int64 // 1xx-3xx
+	client  atomic.Int64 // 4xx
+	limited atomic.Int64 // 429
+	server  atomic.Int64 // 5xx
+	started time.Time
+}
+
+// countRequests records the status class of every response
+func (s *Server) countRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		s.counters.total.Add(1)
+		switch status := ww.Status(); {
+		case status == http.StatusTooManyRequests:
+			s.counters.limited.Add(1)
+			s.counters.client.Add(1)
+		case status >= 500:
+			s.counters.server.Add(1)
+		case status >= 400:
+			s.counters.client.Add(1)
+		default:
+			s.counters.success.Add(1)
+		}
+	})
+}
+
+// NodeStats describes this replica
+type NodeStats struct {
+	Uptime        string `json:"uptime"`
+	Goroutines    int    `json:"goroutines"`
+	HeapBytes     uint64 `json:"heap_bytes"`
+	RedisOK       bool   `json:"redis_ok"`
+	RedisLatency  string `json:"redis_latency,omitempty"`
+	WSConnections int    `json:"ws_connections"`
+	WSQueues      int    `json:"ws_queues"` // Queues with at least one subscriber
+}
+
+// RequestStats are aggregate request counts since start
+type RequestStats struct {
+	Total       int64 `json:"total"`
+	Success     int64 `json:"success"`
+	ClientError int64 `json:"client_error"`
+	RateLimited int64 `json:"rate_limited"`
+	ServerError int64 `json:"server_error"`
+}
+
+// StatsResponse is returned by GET /admin/stats
+type StatsResponse struct {
+	Node        NodeStats          `json:"node"`
+	Requests    RequestStats       `json:"requests"`
+	Storage     *queue.Stats       `json:"storage,omitempty"`
+	Maintenance *queue.Maintenance `json:"maintenance,omitempty"`
+}
+
+// handleAdminStats reports node health and aggregate metrics (no per-queue data)
+func (s *Server) handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	s.wsMutex.RLock()
+	node := NodeStats{
+		Uptime:        time.Since(s.counters.started).Round(time.Second).String(),
+		Goroutines:    runtime.NumGoroutine(),
+		HeapBytes:     mem.HeapAlloc,
+		WSConnections: len(s.wsClients),
+		WSQueues:      len(s.wsConnections),
+	}
+	s.wsMutex.RUnlock()
+
+	if latency, err := s.queueManager.Ping(); err == nil {
+		node.RedisOK = true
+		node.RedisLatency = latency.String()
+	}
+
+	response := StatsResponse{
+		Node: node,
+		Requests: RequestStats{
+			Total:       s.counters.total.Load(),
+			Success:     s.counters.success.Load(),
+			ClientError: s.counters.client.Load(),
+			RateLimited: s.counters.limited.Load(),
+			ServerError: s.counters.server.Load(),
+		},
+	}
+	if node.RedisOK {
+		response.Storage, _ = s.queueManager.Stats()
+		response.Maintenance, _ = s.queueManager.GetMaintenance()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	state, err := s.queueManager.GetMaintenance()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+func (s *Server) handleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var state queue.Maintenance
+	if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.queueManager.SetMaintenance(state); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// wsConnectionEstimate approximates the memory one idle WebSocket costs a node:
+// the upgrader's read and write buffers, the handler goroutine's stack and
+// connection bookkeeping
+const wsConnectionEstimate = 1024 + 1024 + 8*1024 + 4*1024
+
+// CapacityResponse is returned by GET /admin/capacity
+type CapacityResponse struct {
+	Storage *queue.CapacitySample `json:"storage"`
+	Node    NodeCapacity          `json:"node"`
+}
+
+// NodeCapacity describes this replica's connection footprint
+type NodeCapacity struct {
+	WSConnections  int    `json:"ws_connections"`
+	HeapBytes      uint64 `json:"heap_bytes"`
+	BytesPerWSConn int64  `json:"bytes_per_ws_connection"` // Estimate, see wsConnectionEstimate
+}
+
+// handleAdminCapacity samples storage and node usage for capacity planning
+func (s *Server) handleAdminCapacity(w http.ResponseWriter, r *http.Request) {
+	sampleSize, _ := strconv.Atoi(r.URL.Query().Get("sample"))
+	storage, err := s.queueManager.Capacity(sampleSize)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	s.wsMutex.RLock()
+	connections := len(s.wsClients)
+	s.wsMutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CapacityResponse{
+		Storage: storage,
+		Node: NodeCapacity{
+			WSConnections:  connections,
+			HeapBytes:      mem.HeapAlloc,
+			BytesPerWSConn: wsConnectionEstimate,
+		},
+	})
+}
@@ -0,0 +1,22 @@
+//go:build !minimal
+
+package relay
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// consoleIncluded reports whether the web console is compiled in
+const consoleIncluded = true
+
+//go:embed console.html
+var consoleHTML []byte
+
+// handleConsole serves the embedded operator console
+func (s *Server) handleConsole(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(consoleHTML)
+}
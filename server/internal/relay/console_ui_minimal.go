@@ -0,0 +1,13 @@
+//go:build minimal
+
+package relay
+
+import "net/http"
+
+// consoleIncluded reports whether the web console is compiled in
+const consoleIncluded = false
+
+// handleConsole is never routed in minimal builds
+func (s *Server) handleConsole(w http.ResponseWriter, r *http.Request) {
+	http.NotFound(w, r)
+}
@@ -0,0 +1,106 @@
+package relay
+
+import (
+	"crypto/rand"
+	"errors"
+	mathrand "math/rand/v2"
+	"net/http"
+	"time"
+
+	"privmsg-relay/internal/queue"
+
+	"github.com/gorilla/websocket"
+)
+
+// Cover traffic bounds
+const (
+	wsCoverMaxInterval = time.Hour // Longest mean gap a client may ask for
+	wsCoverMaxPadding  = 2048      // Largest random payload in a decoy frame
+)
+
+// errCoverDisabled is reported when the operator turned cover traffic off
+var errCoverDisabled = errors.New("cover traffic disabled")
+
+// handleCover sets how often the relay pushes decoys to this connection
+// A cover frame without an interval is a client's own decoy (say, the
+// answer it sends to each decoy so its acks have cover too) and is dropped
+func (s *Server) handleCover(client *wsClient, msg *queue.WSMessage) {
+	if msg.Interval == nil {
+		return
+	}
+	if client.cover == nil {
+		client.writeError(msg, http.StatusNotFound, errCoverDisabled.Error())
+		return
+	}
+
+	mean := time.Duration(*msg.Interval) * time.Second
+	switch {
+	case mean <= 0:
+		mean = 0
+	case mean < s.wsCoverMinInterval:
+		mean = s.wsCoverMinInterval
+	case mean > wsCoverMaxInterval:
+		mean = wsCoverMaxInterval
+	}
+
+	// Only the latest interval matters, so replace one still unread
+	select {
+	case <-client.cover:
+	default:
+	}
+	client.cover <- mean
+}
+
+// coverTraffic pushes decoy frames at random times, mean apart on average,
+// until done is closed; a mean of zero pauses it
+// Gaps are exponentially distributed, so decoys arrive like real messages
+// from an independent sender and their timing gives nothing away
+func (c *wsClient) coverTraffic(done <-chan struct{}) {
+	var mean time.Duration
+	timer := time.NewTimer(0)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case mean = <-c.cover:
+			timer.Stop()
+			if mean > 0 {
+				timer.Reset(coverDelay(mean))
+			}
+		case <-timer.C:
+			if c.writeDecoy() != nil {
+				return
+			}
+			timer.Reset(coverDelay(mean))
+		}
+	}
+}
+
+// coverDelay draws the gap before the next decoy
+func coverDelay(mean time.Duration) time.Duration {
+	return time.Duration(mathrand.ExpFloat64() * float64(mean))
+}
+
+// writeDecoy sends a cover frame of random length, encoded like a message
+// frame so binary connections see the same kind of frame as for a message
+func (c *wsClient) writeDecoy() error {
+	padding := make([]byte, mathrand.IntN(wsCoverMaxPadding+1))
+	rand.Read(padding)
+	frame := queue.WSMessage{
+		Type:      queue.WSTypeCover,
+		Payload:   padding,
+		Timestamp: time.Now(),
+	}
+
+	if !c.binary {
+		return c.writeJSON(frame)
+	}
+	data, err := queue.EncodeWSBinary(frame)
+	if err != nil {
+		return err
+	}
+	return c.write(websocket.BinaryMessage, data)
+}
@@ -0,0 +1,73 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"privmsg-relay/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleDiscoveryInfo publishes the salt identifiers are hashed with
+func (s *Server) handleDiscoveryInfo(w http.ResponseWriter, r *http.Request) {
+	response, err := s.queueManager.DiscoveryInfo(r.Context())
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleRegisterDiscovery makes a queue findable by identifier hashes
+func (s *Server) handleRegisterDiscovery(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	var req queue.DiscoveryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.queueManager.RegisterDiscovery(r.Context(), queueID, accessToken, req); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleUnregisterDiscovery(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	if err := s.queueManager.UnregisterDiscovery(r.Context(), queueID, accessToken); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDiscoveryLookup returns whole buckets; the client finds its
+// contacts in them, so the relay never learns which ones it was after
+func (s *Server) handleDiscoveryLookup(w http.ResponseWriter, r *http.Request) {
+	var req queue.DiscoveryLookupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := s.queueManager.LookupDiscovery(r.Context(), clientIP(r), rateLimitExempt(r), req)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,165 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"privmsg-relay/internal/queue"
+	"privmsg-relay/internal/transparency"
+)
+
+// errNotFoundOrDenied replaces access errors when uniform errors are enabled
+var errNotFoundOrDenied = errors.New("queue not found or access denied")
+
+// errorStatus maps manager errors to HTTP status codes
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, queue.ErrQueueNotFound),
+		errors.Is(err, queue.ErrTokenNotFound),
+		errors.Is(err, queue.ErrMessageNotFound),
+		errors.Is(err, queue.ErrUploadNotFound),
+		errors.Is(err, queue.ErrJournalDisabled),
+		errors.Is(err, queue.ErrMacaroonsDisabled),
+		errors.Is(err, queue.ErrNoticesDisabled),
+		errors.Is(err, queue.ErrSignedTimeDisabled),
+		errors.Is(err, queue.ErrTransparencyDisabled),
+		errors.Is(err, queue.ErrAtRestDisabled),
+		errors.Is(err, queue.ErrTenancyDisabled),
+		errors.Is(err, queue.ErrTenantNotFound),
+		errors.Is(err, queue.ErrTenantKeyNotFound),
+		errors.Is(err, queue.ErrVouchersDisabled),
+		errors.Is(err, queue.ErrNoWebhook),
+		errors.Is(err, queue.ErrPushDeviceNotFound),
+		errors.Is(err, queue.ErrReceiptsDisabled),
+		errors.Is(err, queue.ErrReceiptNotFound),
+		errors.Is(err, queue.ErrPresenceDisabled),
+		errors.Is(err, queue.ErrMemberNotFound),
+		errors.Is(err, queue.ErrNoPrekeyBundle):
+		return http.StatusNotFound
+	case errors.Is(err, queue.ErrInvalidAccessToken),
+		errors.Is(err, queue.ErrInvalidSendToken),
+		errors.Is(err, queue.ErrInvalidTenantKey),
+		errors.Is(err, queue.ErrTenantKeyRequired):
+		return http.StatusUnauthorized
+	case errors.Is(err, queue.ErrInsufficientScope),
+		errors.Is(err, queue.ErrMacaroonMinting),
+		errors.Is(err, queue.ErrQueueFrozen):
+		return http.StatusForbidden
+	case errors.Is(err, queue.ErrTenantQuotaExceeded):
+		return http.StatusPaymentRequired
+	case errors.Is(err, queue.ErrQueueFull),
+		errors.Is(err, queue.ErrRateLimitExceeded),
+		errors.Is(err, queue.ErrTenantRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, queue.ErrMessageTooLarge),
+		errors.Is(err, queue.ErrFarewellTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, queue.ErrIdempotencyKeyReused):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, queue.ErrMaintenance),
+		errors.Is(err, queue.ErrOverCapacity):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, queue.ErrQueueChanged),
+		errors.Is(err, queue.ErrTooManyTokens),
+		errors.Is(err, queue.ErrTooManySendLinks),
+		errors.Is(err, queue.ErrIdempotencyKeyInFlight),
+		errors.Is(err, queue.ErrUploadOffsetMismatch),
+		errors.Is(err, queue.ErrUploadIncomplete),
+		errors.Is(err, queue.ErrTooManyUploads),
+		errors.Is(err, queue.ErrTooManyPushDevices),
+		errors.Is(err, queue.ErrTooManyMembers),
+		errors.Is(err, queue.ErrTooManyPrekeys),
+		errors.Is(err, queue.ErrTooManyHashes),
+		errors.Is(err, queue.ErrTooManyTenantKeys),
+		errors.Is(err, queue.ErrVoucherSpent),
+		errors.Is(err, queue.ErrInconsistentTreeHead):
+		return http.StatusConflict
+	case errors.Is(err, queue.ErrInvalidTokenScopes),
+		errors.Is(err, queue.ErrInvalidTenant),
+		errors.Is(err, queue.ErrUnknownTier),
+		errors.Is(err, queue.ErrInvalidPeriod),
+		errors.Is(err, queue.ErrInvalidVoucher),
+		errors.Is(err, queue.ErrInvalidNotice),
+		errors.Is(err, queue.ErrInvalidQueueLimits),
+		errors.Is(err, queue.ErrSendLinksUnavailable),
+		errors.Is(err, queue.ErrInvalidSendLinks),
+		errors.Is(err, queue.ErrInvalidNonce),
+		errors.Is(err, queue.ErrInvalidIdempotencyKey),
+		errors.Is(err, queue.ErrInvalidPriority),
+		errors.Is(err, queue.ErrInvalidFarewell),
+		errors.Is(err, queue.ErrInvalidCursor),
+		errors.Is(err, queue.ErrCursorWithVisibility),
+		errors.Is(err, queue.ErrVisibilityUnsupported),
+		errors.Is(err, queue.ErrInvalidUpload),
+		errors.Is(err, queue.ErrInvalidWebhook),
+		errors.Is(err, queue.ErrInvalidPushDevice),
+		errors.Is(err, queue.ErrMembersUnavailable),
+		errors.Is(err, queue.ErrInvalidMembers),
+		errors.Is(err, queue.ErrInvalidBroadcast),
+		errors.Is(err, queue.ErrInvalidPrekeys),
+		errors.Is(err, queue.ErrInvalidEnvelope),
+		errors.Is(err, queue.ErrInvalidDiscovery),
+		errors.Is(err, queue.ErrMixUnavailable),
+		errors.Is(err, queue.ErrInvalidLogRange),
+		errors.Is(err, queue.ErrInvalidWipe),
+		errors.Is(err, transparency.ErrInvalidTreeHead):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// isAccessError reports whether err reveals queue existence or token validity
+func isAccessError(err error) bool {
+	return errors.Is(err, queue.ErrQueueNotFound) ||
+		errors.Is(err, queue.ErrInvalidAccessToken) ||
+		errors.Is(err, queue.ErrInvalidSendToken) ||
+		errors.Is(err, queue.ErrInsufficientScope)
+}
+
+// writeError sends the HTTP error response for a manager error
+// In uniform mode a missing queue and a bad token are indistinguishable,
+// so probing random IDs tells an attacker nothing
+func (s *Server) writeError(w http.ResponseWriter, err error) {
+	// The owner chose to leave a farewell, so it is delivered even in uniform mode
+	var gone *queue.QueueGoneError
+	if errors.As(err, &gone) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusGone)
+		json.NewEncoder(w).Encode(queue.QueueGoneResponse{Error: "queue gone", Farewell: gone.Farewell})
+		return
+	}
+
+	// Tell clients when a full relay, or a tenant's quota, is worth trying again
+	var overCapacity *queue.CapacityError
+	if errors.As(err, &overCapacity) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(overCapacity.RetryAfter.Seconds()))))
+	}
+	var overQuota *queue.TenantQuotaError
+	if errors.As(err, &overQuota) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(overQuota.RetryAfter.Seconds()))))
+	}
+
+	status, message := s.errorResponse(err)
+	if status >= http.StatusInternalServerError {
+		// The client only sees the request ID; the cause stays in the logs
+		slog.Error("Request failed", "request_id", w.Header().Get(requestIDHeader), "status", status, "error", err)
+	}
+	http.Error(w, message, status)
+}
+
+// errorResponse returns the status and message writeError would send,
+// for reporting per-item errors inside batch responses
+func (s *Server) errorResponse(err error) (int, string) {
+	if errors.As(err, new(*queue.QueueGoneError)) {
+		return http.StatusGone, "queue gone"
+	}
+	if s.uniformErrors && isAccessError(err) {
+		return http.StatusNotFound, errNotFoundOrDenied.Error()
+	}
+	return errorStatus(err), err.Error()
+}
@@ -0,0 +1,214 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"privmsg-relay/internal/logging"
+	"privmsg-relay/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Server-Sent Events tuning
+const (
+	sseBuffer    = 64               // Messages queued per stream before it is dropped as lagging
+	sseHeartbeat = 25 * time.Second // Comment frames keep idle proxies from closing the stream
+	sseRetry     = 2 * time.Second  // Reconnect delay suggested to EventSource
+)
+
+// sseStream is one open event stream for a queue
+// The stream is closed when the client falls behind or the server shuts
+// down; EventSource then reconnects with Last-Event-ID and catches up
+type sseStream struct {
+	messages  chan *queue.Message
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newSSEStream() *sseStream {
+	return &sseStream{
+		messages: make(chan *queue.Message, sseBuffer),
+		done:     make(chan struct{}),
+	}
+}
+
+// push queues a message without blocking the sender
+func (c *sseStream) push(message *queue.Message) bool {
+	select {
+	case c.messages <- message:
+		return true
+	default:
+		c.close()
+		return false
+	}
+}
+
+func (c *sseStream) close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// handleEvents streams new messages for a queue as Server-Sent Events
+// Each event ID is a receive cursor, so a reconnect with Last-Event-ID
+// (or ?cursor=) resumes exactly where the stream left off
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	cursor := r.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = r.URL.Query().Get("cursor")
+	}
+	after, err := queue.DecodeCursor(cursor)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	// Authorize before subscribing: pushing a burn-after-read message to the
+	// stream claims it, so an unauthorized stream must never see one
+	if _, err := s.queueManager.CountMessages(r.Context(), queueID, accessToken, queue.ReceiveOptions{}); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	// Subscribe before catching up so nothing sent in between is missed;
+	// duplicates are dropped by sequence number below
+	stream := newSSEStream()
+	s.subscribeStream(queueID, stream)
+	defer s.unsubscribeStream(queueID, stream)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds())
+
+	// Streams outlive the server's read and write timeouts: lift the read
+	// deadline, and renew the write deadline for every event instead
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	send := func(message *queue.Message) error {
+		if message.Seq > 0 && message.Seq <= after {
+			return nil
+		}
+		if err := writeEvent(w, message); err != nil {
+			return err
+		}
+		after = max(after, message.Seq)
+		return nil
+	}
+
+	// Catch up on everything queued after the cursor
+	for {
+		backlog, err := s.queueManager.ReceiveMessages(r.Context(), queueID, accessToken, queue.ReceiveOptions{Cursor: queue.EncodeCursor(after), SkipLeased: true})
+		if err != nil {
+			return
+		}
+		for i := range backlog.Messages {
+			if err := send(&backlog.Messages[i]); err != nil {
+				return
+			}
+		}
+		if !backlog.HasMore {
+			break
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		slog.Warn("Event stream cannot flush", "queue", logging.QueueRef(queueID), "error", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		rc.SetWriteDeadline(time.Now().Add(sseHeartbeat + wsWriteWait))
+		select {
+		case <-r.Context().Done():
+			return
+		case <-stream.done:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case message := <-stream.messages:
+			if err := send(message); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes one message event; system messages carry no ID so
+// they do not move the client's Last-Event-ID
+func writeEvent(w http.ResponseWriter, message *queue.Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if message.Seq > 0 {
+		if _, err := fmt.Fprintf(w, "id: %s\n", queue.EncodeCursor(message.Seq)); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+	return err
+}
+
+// subscribeStream adds an event stream to a queue's subscriber list
+func (s *Server) subscribeStream(queueID string, stream *sseStream) {
+	s.wsMutex.Lock()
+	defer s.wsMutex.Unlock()
+	s.sseStreams[queueID] = append(s.sseStreams[queueID], stream)
+}
+
+// unsubscribeStream removes an event stream from a queue's subscriber list
+func (s *Server) unsubscribeStream(queueID string, stream *sseStream) {
+	s.wsMutex.Lock()
+	defer s.wsMutex.Unlock()
+
+	streams := s.sseStreams[queueID]
+	for i, c := range streams {
+		if c == stream {
+			s.sseStreams[queueID] = append(streams[:i], streams[i+1:]...)
+			break
+		}
+	}
+	if len(s.sseStreams[queueID]) == 0 {
+		delete(s.sseStreams, queueID)
+	}
+}
+
+// isWebSocketUpgrade reports whether r asks to switch to a WebSocket; the
+// header value is case-insensitive
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// requestTimeout bounds ordinary requests to d
+// WebSocket upgrades and event streams are long-lived and end when the
+// client disconnects, and bulk admin runs stream progress for as long as
+// their list takes, so they are exempt
+func requestTimeout(d time.Duration) func(http.Handler) http.Handler {
+	timeout := middleware.Timeout(d)
+	return func(next http.Handler) http.Handler {
+		bounded := timeout(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isWebSocketUpgrade(r) || r.Header.Get("Accept") == "text/event-stream" || unversionedPath(r.URL.Path) == "/admin/bulk" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			bounded.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequestTimeoutExemptions(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	})
+	handler := requestTimeout(10 * time.Millisecond)(slow)
+
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		want   int
+	}{
+		{"ordinary", "/v1/queue/abc/receive", nil, http.StatusGatewayTimeout},
+		{"websocket", "/v1/ws", http.Header{"Upgrade": {"websocket"}}, http.StatusOK},
+		{"websocket mixed case", "/v1/ws", http.Header{"Upgrade": {"WebSocket"}}, http.StatusOK},
+		{"event stream", "/v1/queue/abc/events", http.Header{"Accept": {"text/event-stream"}}, http.StatusOK},
+		{"bulk admin", "/v1/admin/bulk", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package relay
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"privmsg-relay/internal/federation"
+	"privmsg-relay/internal/onion"
+	"privmsg-relay/internal/queue"
+)
+
+// authenticatePeers refuses requests that claim to come from another relay
+// unless that relay's certificate is pinned for the region it names
+func (s *Server) authenticatePeers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedBy := r.Header.Get(federation.ForwardedHeader)
+		if s.federation == nil || (forwardedBy == "" && r.Header.Get(onion.HopsHeader) == "") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := s.federation.VerifyPeer(r.TLS, forwardedBy); err != nil {
+			slog.Warn("Federation request refused", "region", forwardedBy, "error", err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardForeignQueues sends requests for queues homed in another region to
+// that region, so clients can use their nearest endpoint for any queue
+func (s *Server) forwardForeignQueues(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := unversionedPath(r.URL.Path)
+		if s.federation == nil || !strings.HasPrefix(path, "/queue/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Path is [/v1]/queue/{queueID}[/...]
+		queueID, _, _ := strings.Cut(strings.TrimPrefix(path, "/queue/"), "/")
+		homeRegion := queue.HomeRegion(queueID)
+		if queueID == "create" || s.federation.IsLocal(homeRegion) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := s.federation.Forward(w, r, homeRegion); err != nil {
+			http.Error(w, err.Error(), http.StatusMisdirectedRequest)
+		}
+	})
+}
+
+// RegionsResponse lists deployment endpoints for nearest-region selection
+type RegionsResponse struct {
+	Regions []federation.RegionStatus `json:"regions"`
+}
+
+func (s *Server) handleRegions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RegionsResponse{
+		Regions: s.federation.Regions(),
+	})
+}
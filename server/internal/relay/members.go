@@ -0,0 +1,60 @@
+package relay
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"privmsg-relay/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleAddMembers mints send tokens for group members (an empty body adds one)
+func (s *Server) handleAddMembers(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	var req queue.MembersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := s.queueManager.AddMembers(r.Context(), queueID, accessToken, req)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleListMembers(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	response, err := s.queueManager.ListMembers(r.Context(), queueID, accessToken)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleRevokeMember cuts off one member; everyone else keeps their token
+func (s *Server) handleRevokeMember(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	if err := s.queueManager.RevokeMember(r.Context(), queueID, accessToken, chi.URLParam(r, "memberID")); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,48 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"privmsg-relay/internal/logging"
+	"privmsg-relay/internal/queue"
+)
+
+const (
+	mixPollInterval = time.Second // How often due batches are looked for
+	mixBatchLimit   = 100         // Batches claimed per poll
+)
+
+// ReleaseMixBatches releases the batches of mixed-delivery queues as they
+// come due and pushes them to this replica's subscribers, until ctx is
+// cancelled
+func (s *Server) ReleaseMixBatches(ctx context.Context) {
+	ticker := time.NewTicker(mixPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		due, err := s.queueManager.DueMixBatches(ctx, mixBatchLimit)
+		if err != nil {
+			slog.Error("Loading due batches failed", "error", err)
+		}
+		for _, queueID := range due {
+			batch, err := s.queueManager.ReleaseMixBatch(ctx, queueID)
+			if err != nil {
+				if !errors.Is(err, queue.ErrQueueNotFound) {
+					slog.Error("Releasing batch failed", "queue", logging.QueueRef(queueID), "error", err)
+				}
+				continue
+			}
+			for i := range batch.Messages {
+				s.notifySubscribers(queueID, &batch.Messages[i], batch.BurnAfterRead)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package relay
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"privmsg-relay/internal/identity"
+	"privmsg-relay/internal/queue"
+)
+
+// NoticeResponse is returned by GET /notice
+type NoticeResponse struct {
+	PublicKey string              `json:"public_key"` // Base64 Ed25519 key notices are signed with
+	KeyID     string              `json:"key_id"`
+	Notice    *queue.SignedNotice `json:"notice"` // null when nothing is active
+}
+
+// handleGetNotice lets clients fetch the active notice and the verification key
+func (s *Server) handleGetNotice(w http.ResponseWriter, r *http.Request) {
+	pub := s.queueManager.NoticePublicKey()
+	if pub == nil {
+		s.writeError(w, queue.ErrNoticesDisabled)
+		return
+	}
+
+	signed, err := s.queueManager.CurrentNotice()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NoticeResponse{
+		PublicKey: base64.StdEncoding.EncodeToString(pub),
+		KeyID:     identity.KeyID(pub),
+		Notice:    signed,
+	})
+}
+
+// handlePublishNotice signs and broadcasts an operator notice
+func (s *Server) handlePublishNotice(w http.ResponseWriter, r *http.Request) {
+	var req queue.NoticeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	signed, err := s.queueManager.PublishNotice(req)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(signed.Notice)
+}
+
+// handleClearNotice withdraws the active notice
+func (s *Server) handleClearNotice(w http.ResponseWriter, r *http.Request) {
+	if err := s.queueManager.ClearNotice(); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RelayNotices pushes notices published on any replica to this replica's
+// WebSocket clients until ctx is cancelled
+func (s *Server) RelayNotices(ctx context.Context) {
+	for signed := range s.queueManager.SubscribeNotices(ctx) {
+		sent := s.broadcast(queue.WSMessage{
+			Type:      queue.WSTypeNotice,
+			Notice:    signed,
+			Timestamp: time.Now(),
+		})
+		slog.Info("Broadcast notice", "kind", signed.Notice.Kind, "id", signed.Notice.ID, "clients", sent)
+	}
+}
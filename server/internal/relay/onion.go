@@ -0,0 +1,144 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"privmsg-relay/internal/federation"
+	"privmsg-relay/internal/onion"
+	"privmsg-relay/internal/policy"
+	"privmsg-relay/internal/queue"
+)
+
+// onionHopTimeout bounds the wait for the rest of the route
+const onionHopTimeout = 30 * time.Second
+
+// OnionKeyResponse publishes the key senders wrap this relay's layer with
+type OnionKeyResponse struct {
+	PublicKey []byte `json:"public_key"`       // X25519, derived from the identity key
+	Region    string `json:"region,omitempty"` // Name other relays forward to this one by
+}
+
+func (s *Server) handleOnionKey(w http.ResponseWriter, r *http.Request) {
+	response := OnionKeyResponse{PublicKey: s.onionKey.Public[:]}
+	if s.federation != nil {
+		response.Region = s.federation.Region()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleOnion removes this relay's layer and either passes the rest to the
+// next region or, at the last hop, sends the message
+// Only the status comes back along the route, so relays on the way learn
+// whether the message was accepted and nothing else
+func (s *Server) handleOnion(w http.ResponseWriter, r *http.Request) {
+	hops := 0
+	if header := r.Header.Get(onion.HopsHeader); header != "" {
+		n, err := strconv.Atoi(header)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid hop count", http.StatusBadRequest)
+			return
+		}
+		hops = n
+	}
+	if hops >= onion.MaxHops {
+		http.Error(w, "route is too long", http.StatusBadRequest)
+		return
+	}
+
+	limit := s.maxBinaryBody()*4/3 + onion.MaxHops*onion.MaxOverhead // Base64 payload inside the innermost layer
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) > limit {
+		http.Error(w, errBodyTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	layer, err := s.onionKey.Open(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if layer.Delivery != nil {
+		s.deliverOnion(w, r, layer.Delivery)
+		return
+	}
+	s.forwardOnion(w, r, layer, hops+1)
+}
+
+// forwardOnion passes the next layer on and answers with the status it gets
+func (s *Server) forwardOnion(w http.ResponseWriter, r *http.Request, layer *onion.Layer, hops int) {
+	if s.federation == nil {
+		http.Error(w, federation.ErrUnknownRegion.Error(), http.StatusMisdirectedRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), onionHopTimeout)
+	defer cancel()
+	header := http.Header{}
+	header.Set("Content-Type", rawContentType)
+	header.Set(onion.HopsHeader, strconv.Itoa(hops))
+	resp, err := s.federation.Post(ctx, layer.Next, apiPrefix+"/onion", header, layer.Inner)
+	if errors.Is(err, federation.ErrUnknownRegion) {
+		http.Error(w, err.Error(), http.StatusMisdirectedRequest)
+		return
+	}
+	if err != nil {
+		slog.Warn("Onion forward failed", "region", layer.Next, "error", err)
+		http.Error(w, "next hop unavailable", http.StatusBadGateway)
+		return
+	}
+	resp.Body.Close()
+	w.WriteHeader(resp.StatusCode)
+}
+
+// deliverOnion sends the innermost layer's message to a local queue
+func (s *Server) deliverOnion(w http.ResponseWriter, r *http.Request, delivery *onion.Delivery) {
+	if s.federation != nil && !s.federation.IsLocal(queue.HomeRegion(delivery.QueueID)) {
+		http.Error(w, "queue is homed in another region", http.StatusMisdirectedRequest)
+		return
+	}
+	if delivery.TTLSeconds < 0 {
+		http.Error(w, "ttl_seconds must not be negative", http.StatusBadRequest)
+		return
+	}
+	if !s.checkPolicy(w, r, policy.ActionSend, len(delivery.Payload), s.queueNamespace(r.Context(), delivery.QueueID)) {
+		return
+	}
+
+	response, err := s.queueManager.SendMessage(r.Context(), delivery.QueueID, delivery.Payload, queue.SendOptions{
+		SendToken: delivery.SendToken,
+		TTL:       time.Duration(delivery.TTLSeconds) * time.Second,
+	})
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	if !response.Held {
+		s.notifySubscribers(delivery.QueueID, &queue.Message{
+			ID:         response.MessageID,
+			QueueID:    delivery.QueueID,
+			Seq:        response.Seq,
+			Payload:    delivery.Payload,
+			ReceivedAt: response.SentAt,
+			ExpiresAt:  response.ExpiresAt,
+
+			PayloadHash: response.PayloadHash,
+		}, response.BurnAfterRead)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
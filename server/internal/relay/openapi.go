@@ -0,0 +1,98 @@
+package relay
+
+import (
+	"bytes"
+	_ "embed"
+	"io"
+	"mime"
+	"net/http"
+
+	"privmsg-relay/internal/apispec"
+	"privmsg-relay/internal/queue"
+)
+
+// openapiJSON describes every /v1 endpoint; keep it in step with apiRoutes
+//
+//go:embed openapi.json
+var openapiJSON []byte
+
+// apiSpec is the parsed document validateRequests checks against
+var apiSpec = apispec.MustLoad(openapiJSON)
+
+// handleOpenAPI serves the API description
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(openapiJSON)
+}
+
+// validateRequests rejects API requests whose parameters or JSON body do
+// not match the OpenAPI document, before any handler or Redis call runs
+// Binary and raw bodies are left to the handlers' decoders
+func (s *Server) validateRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := apiSpec.Find(r.Method, unversionedPath(r.URL.Path))
+		if op == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := op.ValidateParams(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if op.RequestBody == nil || (contentType != "" && contentType != "application/json") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Buffer the body for the handler; one too large to buffer is left
+		// for the handler to reject
+		limit := s.validationLimit(op)
+		data, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+		if err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if int64(len(data)) > limit {
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(data))
+
+		if err := op.ValidateJSON(data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// maxJSONBody is how much of a JSON body validateRequests buffers for
+// operations that carry no message payload
+const maxJSONBody = 64 * 1024
+
+// validationLimit is how much of op's JSON body validateRequests buffers
+// before any authorization, so only operations carrying payloads get room
+// for them: a base64 message for a send, one per item for a batch send
+func (s *Server) validationLimit(op *apispec.Operation) int64 {
+	message := s.maxBinaryBody() * 4 / 3
+	switch op.ID {
+	case "sendBatch":
+		return queue.MaxBatchSize * message
+	case "sendMessage":
+		return message
+	case "uploadPrekeys":
+		// Identity key, signed prekey and signature, and the one-time prekeys, base64 with their fields
+		return (queue.MaxOneTimePrekeys + 3) * (queue.MaxPrekeySize*4/3 + 64)
+	}
+	return maxJSONBody
+}
+
+// readCloser reads from a replacement reader but closes the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,69 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"privmsg-relay/internal/federation"
+	"privmsg-relay/internal/onion"
+	"privmsg-relay/internal/policy"
+)
+
+// checkPolicy evaluates the operator policy for a request acting for the
+// tenant namespace
+// Returns false (after writing the response) if the policy rejects it
+func (s *Server) checkPolicy(w http.ResponseWriter, r *http.Request, action string, size int, namespace string) bool {
+	if err := s.policyError(r, action, size, namespace); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// policyError evaluates the operator policy and returns the denial, if any
+func (s *Server) policyError(r *http.Request, action string, size int, namespace string) error {
+	if s.policy == nil {
+		return nil
+	}
+
+	rateClass := "ip"
+	if rateLimitExempt(r) {
+		rateClass = "token"
+	}
+
+	decision := s.policy.Evaluate(policy.Input{
+		Action:    action,
+		Size:      size,
+		RateClass: rateClass,
+		Namespace: namespace,
+		Channel:   policyChannel(r),
+	})
+	if decision.Allow {
+		return nil
+	}
+	if decision.Reason != "" {
+		return fmt.Errorf("%w: %s", policy.ErrDenied, decision.Reason)
+	}
+	return policy.ErrDenied
+}
+
+// queueNamespace is the policy namespace of a request to a queue: the
+// tenant that owns it; the lookup is skipped when there is no policy
+func (s *Server) queueNamespace(ctx context.Context, queueID string) string {
+	if s.policy == nil {
+		return ""
+	}
+	return s.queueManager.QueueTenant(ctx, queueID)
+}
+
+// policyChannel names the transport a request arrived on
+func policyChannel(r *http.Request) string {
+	switch {
+	case r.Header.Get(federation.ForwardedHeader) != "" || r.Header.Get(onion.HopsHeader) != "":
+		return policy.ChannelFederation
+	case isWebSocketUpgrade(r):
+		return policy.ChannelWS
+	}
+	return policy.ChannelHTTP
+}
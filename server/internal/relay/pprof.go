@@ -0,0 +1,16 @@
+package relay
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// profilerHandler serves net/http/pprof under /debug/pprof and expvar
+// under /debug/vars, for the separate profiling listener
+func profilerHandler() http.Handler {
+	r := chi.NewRouter()
+	r.Mount("/debug", middleware.Profiler())
+	return r
+}
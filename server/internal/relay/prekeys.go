@@ -0,0 +1,62 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"privmsg-relay/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleUploadPrekeys publishes the owner's identity key, signed prekey
+// and one-time prekeys
+func (s *Server) handleUploadPrekeys(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	var req queue.PrekeyUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := s.queueManager.UploadPrekeys(r.Context(), queueID, accessToken, req)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handlePrekeyStatus(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	response, err := s.queueManager.PrekeyStatus(r.Context(), queueID, accessToken)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleClaimPrekeys hands a sender a bundle to start a session with;
+// the one-time prekey in it is never handed out again
+func (s *Server) handleClaimPrekeys(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	sendToken := bearerToken(r)
+
+	bundle, err := s.queueManager.ClaimPrekeys(r.Context(), queueID, sendToken)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bundle)
+}
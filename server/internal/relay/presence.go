@@ -0,0 +1,57 @@
+package relay
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"privmsg-relay/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleEnablePresence opts a queue into presence queries (requires admin)
+func (s *Server) handleEnablePresence(w http.ResponseWriter, r *http.Request) {
+	s.setPresence(w, r, true)
+}
+
+// handleDisablePresence opts a queue back out of presence queries
+func (s *Server) handleDisablePresence(w http.ResponseWriter, r *http.Request) {
+	s.setPresence(w, r, false)
+}
+
+func (s *Server) setPresence(w http.ResponseWriter, r *http.Request, enabled bool) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	if err := s.queueManager.SetPresence(r.Context(), queueID, accessToken, enabled); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePresence answers a sender's "is anyone connected?" frame for a
+// queue whose owner opted in; only this relay's connections count
+func (s *Server) handlePresence(ctx context.Context, client *wsClient, msg *queue.WSMessage) {
+	if msg.QueueID == "" {
+		client.writeError(msg, http.StatusBadRequest, "queue_id required")
+		return
+	}
+	if err := s.queueManager.AuthorizePresence(ctx, msg.QueueID, msg.AccessToken); err != nil {
+		s.writeWSError(client, msg, err)
+		return
+	}
+
+	s.wsMutex.RLock()
+	online := len(s.wsConnections[msg.QueueID]) > 0 || len(s.sseStreams[msg.QueueID]) > 0
+	s.wsMutex.RUnlock()
+
+	client.writeJSON(queue.WSMessage{
+		Type:      queue.WSTypePresence,
+		QueueID:   msg.QueueID,
+		Online:    &online,
+		Timestamp: time.Now(),
+	})
+}
@@ -0,0 +1,78 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"privmsg-relay/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// VAPIDKeyResponse publishes the key browsers pass to pushManager.subscribe
+type VAPIDKeyResponse struct {
+	PublicKey string `json:"public_key"` // base64url uncompressed P-256 point
+}
+
+// handleVAPIDKey returns the relay's Web Push application server key
+func (s *Server) handleVAPIDKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VAPIDKeyResponse{PublicKey: s.push.VAPIDPublicKey()})
+}
+
+// handleRegisterPush adds a device to wake when the queue receives a message
+func (s *Server) handleRegisterPush(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	var req queue.PushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !s.push.Supports(req.Platform) {
+		http.Error(w, "push platform not enabled on this relay", http.StatusBadRequest)
+		return
+	}
+	if err := s.push.ValidateToken(req.Platform, req.Token); err != nil {
+		http.Error(w, "invalid push token: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	registration, err := s.queueManager.RegisterPush(r.Context(), queueID, accessToken, req)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(registration)
+}
+
+func (s *Server) handleListPush(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	response, err := s.queueManager.ListPush(r.Context(), queueID, accessToken)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleUnregisterPush(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	deviceID := chi.URLParam(r, "deviceID")
+	accessToken := bearerToken(r)
+
+	if err := s.queueManager.UnregisterPush(r.Context(), queueID, accessToken, deviceID); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
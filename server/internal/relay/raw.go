@@ -0,0 +1,72 @@
+package relay
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"privmsg-relay/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// rawContentType marks a body that is the bare ciphertext, with no envelope
+const rawContentType = "application/octet-stream"
+
+// isRawBody reports whether a send request carries the bare payload
+func isRawBody(r *http.Request) bool {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return contentType == rawContentType
+}
+
+// rawSendRequest builds a send request from a bare payload body of at most
+// maxSize bytes
+// The optional message lifetime comes from ?ttl_seconds=
+func rawSendRequest(r *http.Request, maxSize int) (queue.SendMessageRequest, error) {
+	var req queue.SendMessageRequest
+	if ttl := r.URL.Query().Get("ttl_seconds"); ttl != "" {
+		seconds, err := strconv.ParseInt(ttl, 10, 64)
+		if err != nil {
+			return req, err
+		}
+		req.TTLSeconds = seconds
+	}
+	req.Priority = queue.Priority(r.URL.Query().Get("priority"))
+
+	payload, err := io.ReadAll(io.LimitReader(r.Body, int64(maxSize)+1))
+	if err != nil {
+		return req, err
+	}
+	if len(payload) > maxSize {
+		return req, errBodyTooLarge
+	}
+	req.Payload = payload
+	return req, nil
+}
+
+// handleRawMessage returns one message's stored ciphertext as the body
+// The sequence number and payload hash travel in headers instead
+// Range and If-Range requests fetch part of the payload, so clients can
+// resume an interrupted download of a large attachment; on burn-after-read
+// queues the first request claims the message, so only it succeeds
+func (s *Server) handleRawMessage(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	messageID := chi.URLParam(r, "messageID")
+
+	message, err := s.queueManager.GetMessage(r.Context(), queueID, messageID, bearerToken(r))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", rawContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Message-Seq", strconv.FormatInt(message.Seq, 10))
+	if message.PayloadHash != "" {
+		// The payload never changes, so its hash is a strong validator for If-Range
+		w.Header().Set("ETag", `"`+message.PayloadHash+`"`)
+	}
+	http.ServeContent(w, r, "", message.ReceivedAt, bytes.NewReader(message.Payload))
+}
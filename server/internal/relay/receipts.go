@@ -0,0 +1,24 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleGetReceipt reports a sent message's delivery status to its sender
+// The receipt token is the only credential; the response names no queue
+func (s *Server) handleGetReceipt(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	response, err := s.queueManager.GetReceipt(r.Context(), token)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
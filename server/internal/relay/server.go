@@ -2,21 +2,41 @@ package relay
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"privmsg-relay/internal/anontoken"
+	"privmsg-relay/internal/authhook"
+	"privmsg-relay/internal/federation"
+	"privmsg-relay/internal/logging"
+	"privmsg-relay/internal/noise"
+	"privmsg-relay/internal/onion"
+	"privmsg-relay/internal/policy"
+	"privmsg-relay/internal/push"
 	"privmsg-relay/internal/queue"
+	"privmsg-relay/internal/realip"
+	"privmsg-relay/internal/webhook"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Server is the relay server that handles HTTP and WebSocket connections
@@ -25,20 +45,176 @@ type Server struct {
 	queueManager *queue.Manager
 	upgrader     websocket.Upgrader
 
+	// Anonymous rate-limit tokens (nil when disabled)
+	anonTokens            *anontoken.Service
+	anonTokenIssuerSecret string
+
+	// Blind-signed vouchers for elevated queue limits (nil when disabled)
+	vouchers            *anontoken.Service
+	voucherIssuerSecret string
+
+	// Enterprise authorization hook (nil in public builds)
+	authHook authhook.Hook
+
+	// Operator accept/reject policy (nil = accept everything)
+	policy *policy.Engine
+
+	// Multi-region forwarding (nil in single-region deployments)
+	federation *federation.Forwarder
+
+	// Key for this relay's layer of onion-routed sends (nil = onion routing disabled)
+	onionKey *onion.Key
+
+	// Static key for Noise-encrypted WebSocket connections (nil = Noise not offered)
+	wsNoiseKey *noise.Keypair
+
+	// Long-term identity signing critical responses (nil = /server-info disabled, responses unsigned)
+	identityKey ed25519.PrivateKey
+
+	// Outbound webhook delivery (nil = owners cannot register webhooks)
+	webhooks *webhook.Dispatcher
+
+	// Mobile wake-ups (nil = devices cannot register for push)
+	push *push.Dispatcher
+
+	// Collapse not-found and access errors into one response
+	uniformErrors bool
+
+	// Refuse queue creation without a tenant API key (tenancy must be enabled)
+	tenantKeyRequired bool
+
+	// Operator API bearer token (empty = admin API disabled)
+	adminToken   string
+	adminConsole bool
+	counters     requestCounters
+
 	// WebSocket connections mapped by queue ID
-	wsConnections map[string][]*websocket.Conn
+	wsConnections map[string][]*wsClient
+	wsClients     map[*wsClient]struct{}  // Every open connection, subscribed or not
+	sseStreams    map[string][]*sseStream // Server-Sent Events streams by queue ID
+	signalPeers   map[string][]*wsClient  // Sender connections that signaled a queue, by queue ID
+	wsPerIP       map[string]int          // Open connections by client IP
 	wsMutex       sync.RWMutex
+
+	// WebSocket limits (0 = unlimited)
+	wsMaxPerIP         int
+	wsMaxSubscriptions int
+	wsSignalMaxBytes   int           // Largest signal payload (0 = signaling disabled)
+	wsSignalRate       int           // Signals per second one connection may send
+	wsCoverMinInterval time.Duration // Shortest mean gap between decoys (0 = cover traffic disabled)
+
+	// Listener state, set by Start and Shutdown
+	tlsConfig       *tls.Config
+	acmeChallenge   http.Handler
+	acmeHTTPPort    int
+	limits          HTTPLimits
+	realIP          *realip.Resolver
+	proxyProtocol   bool
+	accessLog       bool
+	pprof           bool
+	pprofAddr       string
+	legacySunset    time.Time
+	pprofServer     *http.Server
+	httpServer      *http.Server
+	challengeServer *http.Server
+	stopped         bool
+	httpMu          sync.Mutex
+	wsHandlers      sync.WaitGroup // Hijacked connections, which http.Server cannot wait for
+}
+
+// Options holds optional subsystems wired into the server
+type Options struct {
+	AnonTokens            *anontoken.Service    // Enables Private-Token redemption
+	AnonTokenIssuerSecret string                // Enables POST /tokens/issue for an attester
+	Vouchers              *anontoken.Service    // Enables voucher redemption; must use its own key
+	VoucherIssuerSecret   string                // Enables POST /vouchers/issue for the voucher seller
+	AuthHook              authhook.Hook         // Authorizes queue creation and privileged operations
+	Policy                *policy.Engine        // Evaluated on create and send
+	Federation            *federation.Forwarder // Forwards requests for foreign-region queues
+	OnionKey              *onion.Key            // Accepts onion-routed sends at POST /onion
+	WSNoiseKey            *noise.Keypair        // Offers the Noise WebSocket subprotocols with this static key
+	IdentityKey           ed25519.PrivateKey    // Serves /server-info and signs queue creation and prekey responses
+	Webhooks              *webhook.Dispatcher   // Enables per-queue webhook registration
+	Push                  *push.Dispatcher      // Enables FCM/APNs device registration
+	UniformErrors         bool                  // Hide whether a queue exists from unauthorized callers
+	TenantKeyRequired     bool                  // Only tenants' API keys may create queues
+	AdminToken            string                // Enables the /admin API
+	AdminConsole          bool                  // Serves the operator console at /admin/console
+	WSCompression         bool                  // Negotiates permessage-deflate on WebSocket connections
+	WSMaxConnectionsPerIP int                   // Concurrent WebSocket connections per client IP (0 = unlimited)
+	WSMaxSubscriptions    int                   // Queues one WebSocket connection may subscribe to (0 = unlimited)
+	WSSignalMaxBytes      int                   // Largest ephemeral signal payload (0 = signaling disabled)
+	WSSignalRate          int                   // Signals per second one WebSocket connection may send (0 = unlimited)
+	WSCoverMinInterval    time.Duration         // Shortest mean gap between decoy frames a client may ask for (0 = cover traffic disabled)
+	TLS                   *tls.Config           // Serves HTTPS directly (nil = plain HTTP)
+	ACMEChallenge         http.Handler          // Served on ACMEHTTPPort for HTTP-01 challenges (nil = no second listener)
+	ACMEHTTPPort          int                   // Usually 80
+	Limits                HTTPLimits            // Timeouts and size limits for the HTTP server
+	RealIP                *realip.Resolver      // Trusted proxies whose forwarding headers are honored (nil = none)
+	ProxyProtocol         bool                  // Trusted proxies prefix connections with a PROXY protocol header
+	AccessLog             bool                  // Log one privacy-safe line per request (false = no request logging)
+	Pprof                 bool                  // Serves /debug/pprof, behind AdminToken unless PprofAddr is set
+	PprofAddr             string                // Separate listener for /debug/pprof, e.g. 127.0.0.1:6060 (empty = main port)
+	LegacySunset          time.Time             // Announced removal date of the unversioned API paths (zero = none announced)
+}
+
+// HTTPLimits bounds how long and how much a client may take per request
+// WebSocket and event stream connections manage their own deadlines
+type HTTPLimits struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
 }
 
 // NewServer creates a new relay server
-func NewServer(queueManager *queue.Manager) *Server {
+func NewServer(queueManager *queue.Manager, opts Options) *Server {
 	s := &Server{
-		router:        chi.NewRouter(),
-		queueManager:  queueManager,
-		wsConnections: make(map[string][]*websocket.Conn),
+		router:                chi.NewRouter(),
+		queueManager:          queueManager,
+		anonTokens:            opts.AnonTokens,
+		anonTokenIssuerSecret: opts.AnonTokenIssuerSecret,
+		vouchers:              opts.Vouchers,
+		voucherIssuerSecret:   opts.VoucherIssuerSecret,
+		authHook:              opts.AuthHook,
+		policy:                opts.Policy,
+		federation:            opts.Federation,
+		onionKey:              opts.OnionKey,
+		wsNoiseKey:            opts.WSNoiseKey,
+		identityKey:           opts.IdentityKey,
+		webhooks:              opts.Webhooks,
+		push:                  opts.Push,
+		uniformErrors:         opts.UniformErrors,
+		tenantKeyRequired:     opts.TenantKeyRequired,
+		adminToken:            opts.AdminToken,
+		adminConsole:          opts.AdminConsole,
+		counters:              requestCounters{started: time.Now()},
+		wsConnections:         make(map[string][]*wsClient),
+		wsClients:             make(map[*wsClient]struct{}),
+		sseStreams:            make(map[string][]*sseStream),
+		signalPeers:           make(map[string][]*wsClient),
+		wsPerIP:               make(map[string]int),
+		wsMaxPerIP:            opts.WSMaxConnectionsPerIP,
+		wsMaxSubscriptions:    opts.WSMaxSubscriptions,
+		wsSignalMaxBytes:      opts.WSSignalMaxBytes,
+		wsSignalRate:          opts.WSSignalRate,
+		wsCoverMinInterval:    opts.WSCoverMinInterval,
+		tlsConfig:             opts.TLS,
+		acmeChallenge:         opts.ACMEChallenge,
+		acmeHTTPPort:          opts.ACMEHTTPPort,
+		limits:                opts.Limits,
+		realIP:                opts.RealIP,
+		proxyProtocol:         opts.ProxyProtocol,
+		accessLog:             opts.AccessLog,
+		pprof:                 opts.Pprof,
+		pprofAddr:             opts.PprofAddr,
+		legacySunset:          opts.LegacySunset,
 		upgrader: websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
+			ReadBufferSize:    1024,
+			WriteBufferSize:   1024,
+			EnableCompression: opts.WSCompression,
+			Subprotocols:      wsProtocols(opts.WSNoiseKey != nil),
 			CheckOrigin: func(r *http.Request) bool {
 				// Allow all origins (in production, restrict this)
 				return true
@@ -53,22 +229,44 @@ func NewServer(queueManager *queue.Manager) *Server {
 // setupRoutes configures the HTTP routes
 func (s *Server) setupRoutes() {
 	// Middleware
-	s.router.Use(middleware.Logger)
+	s.router.Use(s.requestIDs)
+	if s.realIP != nil {
+		s.router.Use(s.realIP.Middleware) // First, so logs and limits see the real client
+	}
+	s.router.Use(traceRequests)
+	if s.accessLog {
+		s.router.Use(accessLog)
+	}
 	s.router.Use(middleware.Recoverer)
-	s.router.Use(middleware.Timeout(60 * time.Second))
+	s.router.Use(requestTimeout(60 * time.Second))
 	s.router.Use(corsMiddleware)
+	s.router.Use(s.countRequests)
+	s.router.Use(s.authenticatePeers)
+	s.router.Use(s.forwardForeignQueues)
+	s.router.Use(s.validateRequests)
 
 	// Health check
 	s.router.Get("/health", s.handleHealth)
+	s.router.Get("/healthz", s.handleHealth)
+	s.router.Get("/readyz", s.handleReady)
 
-	// Queue operations
-	s.router.Post("/queue/create", s.handleCreateQueue)
-	s.router.Post("/queue/{queueID}/send", s.handleSendMessage)
-	s.router.Get("/queue/{queueID}/receive", s.handleReceiveMessages)
-	s.router.Delete("/queue/{queueID}", s.handleDeleteQueue)
+	// API description
+	s.router.Get("/openapi.json", s.handleOpenAPI)
 
-	// WebSocket endpoint
-	s.router.Get("/ws", s.handleWebSocket)
+	// Versioned API; the unversioned paths remain as deprecated aliases
+	s.router.Route(apiPrefix, s.apiRoutes)
+	s.router.Group(func(r chi.Router) {
+		r.Use(s.deprecateLegacy)
+		s.apiRoutes(r)
+	})
+	if s.adminConsole && !consoleIncluded {
+		slog.Warn("ADMIN_CONSOLE set but the console is not included in this build")
+	}
+
+	// Live profiling; on the main port only operators may reach it
+	if s.pprof && s.pprofAddr == "" {
+		s.router.With(s.requireAdmin).Mount("/debug", middleware.Profiler())
+	}
 
 	// Serve static files for SPA (must be last to not interfere with API routes)
 	workDir, _ := os.Getwd()
@@ -76,15 +274,202 @@ func (s *Server) setupRoutes() {
 	s.serveSPA(staticDir)
 }
 
+// apiRoutes registers the API on r; it is mounted once per API version
+func (s *Server) apiRoutes(r chi.Router) {
+	// Multi-region discovery
+	if s.federation != nil {
+		r.Get("/regions", s.handleRegions)
+	}
+
+	// Anonymous tokens
+	if s.anonTokens != nil {
+		r.Get("/tokens/key", s.handleTokenKey)
+		r.Post("/tokens/issue", s.handleIssueToken)
+	}
+
+	// Vouchers for elevated queue limits
+	if s.vouchers != nil {
+		r.Get("/vouchers/key", s.handleVoucherKey)
+		r.Post("/vouchers/issue", s.handleIssueVoucher)
+		r.Post("/queue/{queueID}/voucher", s.handleRedeemVoucher)
+	}
+
+	// Onion-routed sends
+	if s.onionKey != nil {
+		r.With(s.signResponse).Get("/onion/key", s.handleOnionKey)
+		r.With(s.redeemForPolicy).Post("/onion", s.handleOnion)
+	}
+
+	// Contact discovery
+	r.Get("/discovery", s.handleDiscoveryInfo)
+	r.With(s.redeemAnonToken).Post("/discovery/lookup", s.handleDiscoveryLookup)
+
+	// Queue operations
+	r.With(s.signResponse, s.redeemAnonToken).Post("/queue/create", s.handleCreateQueue)
+	r.With(s.redeemForPolicy).Post("/queue/{queueID}/send", s.handleSendMessage)
+	r.With(s.redeemForPolicy).Post("/queue/{queueID}/send-batch", s.handleSendBatch)
+	r.Get("/queue/{queueID}/receive", s.handleReceiveMessages)
+	r.Get("/queue/{queueID}/events", s.handleEvents)
+	r.With(s.redeemForPolicy).Post("/queue/{queueID}/uploads", s.handleCreateUpload)
+	r.Get("/queue/{queueID}/uploads/{uploadID}", s.handleGetUpload)
+	r.Patch("/queue/{queueID}/uploads/{uploadID}", s.handleAppendUpload)
+	r.Post("/queue/{queueID}/uploads/{uploadID}/commit", s.handleCommitUpload)
+	r.Delete("/queue/{queueID}/uploads/{uploadID}", s.handleAbortUpload)
+	r.Get("/queue/{queueID}/message/{messageID}", s.handleRawMessage)
+	r.Get("/queue/{queueID}/message/{messageID}/raw", s.handleRawMessage)
+	r.Post("/queue/{queueID}/ack", s.handleAckBatch)
+	r.Delete("/queue/{queueID}", s.handleDeleteQueue)
+	r.With(s.signResponse).Post("/wipe", s.handleWipe)
+	r.Delete("/queue/{queueID}/messages", s.handlePurgeMessages)
+	r.Get("/queue/{queueID}/info", s.handleQueueInfo)
+	r.Get("/queue/{queueID}/journal", s.handleGetJournal)
+	r.Get("/queue/{queueID}/tokens", s.handleListTokens)
+	r.Post("/queue/{queueID}/tokens", s.handleMintToken)
+	r.Delete("/queue/{queueID}/tokens/{tokenID}", s.handleRevokeToken)
+	r.Post("/queue/{queueID}/macaroon", s.handleIssueMacaroon)
+	r.Post("/queue/{queueID}/send-links", s.handleMintSendLinks)
+	r.Post("/queue/{queueID}/members", s.handleAddMembers)
+	r.Get("/queue/{queueID}/members", s.handleListMembers)
+	r.Delete("/queue/{queueID}/members/{memberID}", s.handleRevokeMember)
+	r.Post("/queue/{queueID}/prekeys", s.handleUploadPrekeys)
+	r.With(s.signResponse).Get("/queue/{queueID}/prekeys", s.handlePrekeyStatus)
+	r.With(s.signResponse).Post("/queue/{queueID}/prekeys/claim", s.handleClaimPrekeys)
+	r.Put("/queue/{queueID}/discovery", s.handleRegisterDiscovery)
+	r.Delete("/queue/{queueID}/discovery", s.handleUnregisterDiscovery)
+	r.Put("/queue/{queueID}/farewell", s.handleSetFarewell)
+	r.Delete("/queue/{queueID}/farewell", s.handleClearFarewell)
+	r.Put("/queue/{queueID}/presence", s.handleEnablePresence)
+	r.Delete("/queue/{queueID}/presence", s.handleDisablePresence)
+	if s.webhooks != nil {
+		r.Put("/queue/{queueID}/webhook", s.handleSetWebhook)
+		r.Get("/queue/{queueID}/webhook", s.handleGetWebhook)
+		r.Delete("/queue/{queueID}/webhook", s.handleDeleteWebhook)
+	}
+	if s.push != nil {
+		r.Post("/queue/{queueID}/push", s.handleRegisterPush)
+		r.Get("/queue/{queueID}/push", s.handleListPush)
+		r.Delete("/queue/{queueID}/push/{deviceID}", s.handleUnregisterPush)
+		if s.push.VAPIDPublicKey() != "" {
+			r.Get("/push/vapid-key", s.handleVAPIDKey)
+		}
+	}
+
+	// Delivery receipts for senders
+	r.Get("/receipt/{token}", s.handleGetReceipt)
+
+	// Operator API
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(s.requireAdmin)
+		r.Post("/bulk", s.handleAdminBulk)
+		r.Post("/notice", s.handlePublishNotice)
+		r.Delete("/notice", s.handleClearNotice)
+		r.Get("/stats", s.handleAdminStats)
+		r.Get("/capacity", s.handleAdminCapacity)
+		r.Get("/maintenance", s.handleGetMaintenance)
+		r.Get("/queue/{queueID}", s.handleAdminInspectQueue)
+		r.Delete("/queue/{queueID}", s.handleAdminDeleteQueue)
+		r.Post("/cleanup", s.handleAdminCleanup)
+		r.Get("/at-rest", s.handleAtRestStatus)
+		r.Post("/at-rest/rotate", s.handleRotateAtRestKey)
+		r.Get("/tenants", s.handleListTenants)
+		r.Post("/tenants", s.handleCreateTenant)
+		r.Get("/tenants/{tenantID}", s.handleGetTenant)
+		r.Delete("/tenants/{tenantID}", s.handleDeleteTenant)
+		r.Post("/tenants/{tenantID}/keys", s.handleCreateTenantKey)
+		r.Delete("/tenants/{tenantID}/keys/{keyID}", s.handleRevokeTenantKey)
+		r.Put("/tenants/{tenantID}/tier", s.handleSetTenantTier)
+		r.Get("/tenants/{tenantID}/usage", s.handleTenantUsage)
+		r.Get("/tiers", s.handleListTiers)
+		r.Put("/maintenance", s.handleSetMaintenance)
+		if s.adminConsole && consoleIncluded {
+			r.Get("/console", s.handleConsole)
+		}
+	})
+	r.Get("/notice", s.handleGetNotice)
+	r.Get("/time", s.handleTime)
+	if s.identityKey != nil {
+		r.With(s.signResponse).Get("/server-info", s.handleServerInfo)
+	}
+
+	// Key transparency log
+	r.Route("/transparency", func(r chi.Router) {
+		r.Get("/head", s.handleTreeHead)
+		r.Get("/entries", s.handleLogEntries)
+		r.Get("/lookup/{subject}", s.handleLogLookup)
+		r.Get("/proof/inclusion", s.handleInclusionProof)
+		r.Get("/proof/consistency", s.handleConsistencyProof)
+		r.Post("/gossip", s.handleGossip)
+		r.Get("/gossip", s.handleGetGossip)
+	})
+
+	// WebSocket endpoint
+	r.Get("/ws", s.handleWebSocket)
+}
+
 // Start starts the HTTP server
+// It returns nil once Shutdown has closed the listener; in-flight requests
+// may still be draining at that point
 func (s *Server) Start(port int) error {
 	addr := fmt.Sprintf("0.0.0.0:%d", port)
-	log.Printf("Starting relay server on %s", addr)
-	return http.ListenAndServe(addr, s.router)
+
+	s.httpMu.Lock()
+	if s.stopped {
+		s.httpMu.Unlock()
+		return nil
+	}
+	s.httpServer = s.newHTTPServer(addr, s.router)
+	s.httpServer.TLSConfig = s.tlsConfig
+	if s.acmeChallenge != nil {
+		s.challengeServer = s.newHTTPServer(fmt.Sprintf("0.0.0.0:%d", s.acmeHTTPPort), s.acmeChallenge)
+	}
+	if s.pprof && s.pprofAddr != "" {
+		s.pprofServer = s.newHTTPServer(s.pprofAddr, profilerHandler())
+	}
+	s.httpMu.Unlock()
+
+	if s.pprofServer != nil {
+		go func() {
+			slog.Info("Serving profiles", "addr", s.pprofServer.Addr)
+			if err := s.pprofServer.ListenAndServe(); err != http.ErrServerClosed {
+				slog.Error("Profiling listener failed", "error", err)
+			}
+		}()
+	}
+
+	if s.challengeServer != nil {
+		go func() {
+			slog.Info("Serving ACME challenges", "addr", s.challengeServer.Addr)
+			if err := s.challengeServer.ListenAndServe(); err != http.ErrServerClosed {
+				slog.Error("ACME challenge listener failed", "error", err)
+			}
+		}()
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if s.proxyProtocol && s.realIP != nil {
+		listener = &realip.Listener{Listener: listener, Resolver: s.realIP}
+	}
+
+	if s.tlsConfig != nil {
+		slog.Info("Starting relay server", "addr", addr, "tls", true)
+		err = s.httpServer.ServeTLS(listener, "", "") // Certificates come from TLSConfig
+	} else {
+		slog.Info("Starting relay server", "addr", addr, "tls", false)
+		err = s.httpServer.Serve(listener)
+	}
+	if err != http.ErrServerClosed {
+		return err
+	}
+	return nil
 }
 
 // HTTP Handlers
 
+// handleHealth is the liveness probe: it answers as long as the process
+// serves HTTP, whatever the state of its dependencies
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -93,11 +478,79 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// readinessTimeout bounds the dependency checks behind /readyz
+const readinessTimeout = 2 * time.Second
+
+// handleReady is the readiness probe: 503 while Redis is unreachable or
+// read-only, or once shutdown has begun, so no new traffic is routed here
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	s.httpMu.Lock()
+	stopping := s.stopped
+	s.httpMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	checks := s.queueManager.CheckReadiness(ctx)
+
+	status, code := "ready", http.StatusOK
+	for name, check := range checks {
+		if !check.OK {
+			status, code = "not ready", http.StatusServiceUnavailable
+			if check.Cause() != nil {
+				slog.Warn("Readiness check failed", "check", name, "error", check.Cause())
+			}
+		}
+	}
+	if stopping {
+		status, code = "shutting down", http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{
+		"status": status,
+		"checks": checks,
+		"time":   time.Now().Format(time.RFC3339),
+	})
+}
+
 func (s *Server) handleCreateQueue(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, authhook.OpCreateQueue, "") {
+		return
+	}
+
+	tenantID, err := s.authenticateTenant(r)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	// Enforce per-IP creation limit unless an anonymous token was redeemed
+	// or a tenant's backend creates queues for its users
+	if !rateLimitExempt(r) && tenantID == "" {
+		if err := s.queueManager.CheckCreateRateLimit(clientIP(r)); err != nil {
+			s.writeError(w, err)
+			return
+		}
+	}
+
+	// Parse optional request body (an empty body means default options)
+	var req queue.CreateQueueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !s.checkPolicy(w, r, policy.ActionCreate, 0, tenantID) {
+		return
+	}
+
 	// Create a new queue
-	response, err := s.queueManager.CreateQueue()
+	req.TenantID = tenantID
+	response, err := s.queueManager.CreateQueue(r.Context(), req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.writeError(w, err)
 		return
 	}
 
@@ -109,91 +562,351 @@ func (s *Server) handleCreateQueue(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleSendMessage(w http.ResponseWriter, r *http.Request) {
 	queueID := chi.URLParam(r, "queueID")
 
-	// Parse request
+	// Parse request (a bare octet-stream payload, or a JSON, protobuf,
+	// CBOR or MessagePack envelope)
 	var req queue.SendMessageRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+	var err error
+	if isRawBody(r) {
+		req, err = rawSendRequest(r, s.queueManager.MaxMessageSize())
+	} else {
+		err = decodeBody(r, &req, s.maxBinaryBody())
+	}
 	if err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		writeBodyError(w, err)
+		return
+	}
+
+	if req.TTLSeconds < 0 {
+		http.Error(w, "ttl_seconds must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	if !s.checkPolicy(w, r, policy.ActionSend, len(req.Payload), s.queueNamespace(r.Context(), queueID)) {
 		return
 	}
 
-	// Send message
-	response, err := s.queueManager.SendMessage(queueID, req.Payload)
+	// Send message (the bearer token is only required for send-token queues)
+	response, err := s.queueManager.SendMessage(r.Context(), queueID, req.Payload, queue.SendOptions{
+		SendToken:      bearerToken(r),
+		TTL:            time.Duration(req.TTLSeconds) * time.Second,
+		Priority:       req.Priority,
+		IdempotencyKey: r.Header.Get("Idempotency-Key"),
+	})
 	if err != nil {
-		if err == queue.ErrQueueNotFound {
-			http.Error(w, err.Error(), http.StatusNotFound)
-		} else if err == queue.ErrQueueFull {
-			http.Error(w, err.Error(), http.StatusTooManyRequests)
-		} else if err == queue.ErrMessageTooLarge {
-			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.writeError(w, err)
+		return
+	}
+
+	// Notify WebSocket subscribers (a replay was pushed the first time, a
+	// held message goes out with its batch)
+	if response.Replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	} else if !response.Held {
+		s.notifySubscribers(queueID, &queue.Message{
+			ID:         response.MessageID,
+			QueueID:    queueID,
+			Seq:        response.Seq,
+			Payload:    req.Payload,
+			ReceivedAt: response.SentAt,
+			ExpiresAt:  response.ExpiresAt,
+
+			PayloadHash: response.PayloadHash,
+		}, response.BurnAfterRead)
+	}
+
+	writeBody(w, r, http.StatusCreated, response)
+}
+
+func (s *Server) handleReceiveMessages(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	// Get query parameters
+	opts, err := receiveOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Count only: report what a receive would return without delivering it
+	if r.URL.Query().Get("count_only") == "true" {
+		response, err := s.queueManager.CountMessages(r.Context(), queueID, accessToken, opts)
+		if err != nil {
+			s.writeError(w, err)
+			return
 		}
+		writeBody(w, r, http.StatusOK, response)
 		return
 	}
 
-	// Notify WebSocket subscribers
-	s.notifySubscribers(queueID, &queue.Message{
-		ID:      response.MessageID,
-		QueueID: queueID,
-		Payload: req.Payload,
-		ReceivedAt: response.SentAt,
-	})
+	// Receive messages
+	response, err := s.queueManager.ReceiveMessages(r.Context(), queueID, accessToken, opts)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	writeBody(w, r, http.StatusOK, response)
+}
+
+// receiveOptions parses the receive query parameters
+//
+//	limit   1 to queue.MaxReceiveLimit (default queue.MaxReceiveLimit)
+//	cursor  next_cursor from an earlier receive
+//	since   sequence number to resume after (instead of cursor)
+//	wait    seconds to long-poll, 0 to queue.MaxReceiveWait
+//	visibility_timeout  seconds to hide the returned messages from other
+//	        receives, 1 to queue.MaxVisibilityTimeout (not with cursor or since)
+func receiveOptions(query url.Values) (queue.ReceiveOptions, error) {
+	opts := queue.ReceiveOptions{Cursor: query.Get("cursor")}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > queue.MaxReceiveLimit {
+			return opts, fmt.Errorf("limit must be 1 to %d", queue.MaxReceiveLimit)
+		}
+		opts.Limit = n
+	}
+
+	if since := query.Get("since"); since != "" {
+		if opts.Cursor != "" {
+			return opts, errors.New("use either cursor or since, not both")
+		}
+		seq, err := strconv.ParseInt(since, 10, 64)
+		if err != nil || seq < 0 {
+			return opts, errors.New("since must be a message sequence number")
+		}
+		opts.Cursor = queue.EncodeCursor(seq)
+	}
+
+	if wait := query.Get("wait"); wait != "" {
+		seconds, err := strconv.Atoi(wait)
+		if err != nil || seconds < 0 || time.Duration(seconds)*time.Second > queue.MaxReceiveWait {
+			return opts, fmt.Errorf("wait must be 0 to %d seconds", int(queue.MaxReceiveWait/time.Second))
+		}
+		opts.Wait = time.Duration(seconds) * time.Second
+	}
+
+	if visibility := query.Get("visibility_timeout"); visibility != "" {
+		seconds, err := strconv.Atoi(visibility)
+		if err != nil || seconds < 1 || time.Duration(seconds)*time.Second > queue.MaxVisibilityTimeout {
+			return opts, fmt.Errorf("visibility_timeout must be 1 to %d seconds", int(queue.MaxVisibilityTimeout/time.Second))
+		}
+		if opts.Cursor != "" {
+			return opts, errors.New("visibility_timeout cannot be combined with cursor or since")
+		}
+		opts.VisibilityTimeout = time.Duration(seconds) * time.Second
+	}
+
+	if countOnly := query.Get("count_only"); countOnly != "" && countOnly != "true" && countOnly != "false" {
+		return opts, errors.New("count_only must be true or false")
+	}
+
+	return opts, nil
+}
+
+func (s *Server) handleDeleteQueue(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	if !s.authorize(w, r, authhook.OpDeleteQueue, queueID) {
+		return
+	}
+
+	// Delete queue
+	err := s.queueManager.DeleteQueue(r.Context(), queueID, accessToken)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleWipe destroys every queue the presented tokens administer; the
+// signed response lets the owner keep proof of what was deleted
+func (s *Server) handleWipe(w http.ResponseWriter, r *http.Request) {
+	var req queue.WipeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if s.authHook != nil {
+		queueIDs, err := s.queueManager.WipeTargets(r.Context(), req)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		for _, queueID := range queueIDs {
+			if !s.authorize(w, r, authhook.OpDeleteQueue, queueID) {
+				return
+			}
+		}
+	}
+
+	response, err := s.queueManager.Wipe(r.Context(), req)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handlePurgeMessages(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	response, err := s.queueManager.PurgeMessages(r.Context(), queueID, accessToken)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleQueueInfo(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	response, err := s.queueManager.QueueInfo(r.Context(), queueID, accessToken)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleGetJournal(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	response, err := s.queueManager.GetJournal(r.Context(), queueID, accessToken)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleIssueMacaroon(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	response, err := s.queueManager.IssueMacaroon(r.Context(), queueID, accessToken)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleMintSendLinks(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	// Parse optional count and lifetime (an empty body mints one link)
+	var req queue.SendLinksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := s.queueManager.MintSendLinks(r.Context(), queueID, accessToken, req)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(response)
 }
 
-func (s *Server) handleReceiveMessages(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleSetFarewell(w http.ResponseWriter, r *http.Request) {
 	queueID := chi.URLParam(r, "queueID")
-	accessToken := r.Header.Get("Authorization")
+	accessToken := bearerToken(r)
 
-	// Remove "Bearer " prefix if present
-	if len(accessToken) > 7 && accessToken[:7] == "Bearer " {
-		accessToken = accessToken[7:]
+	var req queue.FarewellRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
 	}
 
-	// Get query parameters
-	since := r.URL.Query().Get("since")
-	limit := 100 // Default limit
+	if err := s.queueManager.SetFarewell(r.Context(), queueID, accessToken, req.Payload); err != nil {
+		s.writeError(w, err)
+		return
+	}
 
-	// Receive messages
-	response, err := s.queueManager.ReceiveMessages(queueID, accessToken, since, limit)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleClearFarewell(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	if err := s.queueManager.ClearFarewell(r.Context(), queueID, accessToken); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleMintToken(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	// Parse optional scope restriction (an empty body mints a receive+ack token)
+	var req queue.MintTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := s.queueManager.MintToken(r.Context(), queueID, accessToken, req.Scopes)
 	if err != nil {
-		if err == queue.ErrQueueNotFound {
-			http.Error(w, err.Error(), http.StatusNotFound)
-		} else if err == queue.ErrInvalidAccessToken {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		s.writeError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(response)
 }
 
-func (s *Server) handleDeleteQueue(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleListTokens(w http.ResponseWriter, r *http.Request) {
 	queueID := chi.URLParam(r, "queueID")
-	accessToken := r.Header.Get("Authorization")
+	accessToken := bearerToken(r)
 
-	// Remove "Bearer " prefix if present
-	if len(accessToken) > 7 && accessToken[:7] == "Bearer " {
-		accessToken = accessToken[7:]
+	response, err := s.queueManager.ListTokens(r.Context(), queueID, accessToken)
+	if err != nil {
+		s.writeError(w, err)
+		return
 	}
 
-	// Delete queue
-	err := s.queueManager.DeleteQueue(queueID, accessToken)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	tokenID := chi.URLParam(r, "tokenID")
+	accessToken := bearerToken(r)
+
+	err := s.queueManager.RevokeToken(r.Context(), queueID, accessToken, tokenID)
 	if err != nil {
-		if err == queue.ErrQueueNotFound {
-			http.Error(w, err.Error(), http.StatusNotFound)
-		} else if err == queue.ErrInvalidAccessToken {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		s.writeError(w, err)
 		return
 	}
 
@@ -203,91 +916,257 @@ func (s *Server) handleDeleteQueue(w http.ResponseWriter, r *http.Request) {
 // WebSocket Handler
 
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// Refuse before upgrading, while a plain HTTP error can still be sent
+	ip := clientIP(r)
+	if !s.acquireConnection(ip) {
+		http.Error(w, errTooManyConnections.Error(), http.StatusTooManyRequests)
+		return
+	}
+	defer s.releaseConnection(ip)
+	s.wsHandlers.Add(1)
+	defer s.wsHandlers.Done()
+
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		slog.Debug("WebSocket upgrade failed", "error", err)
 		return
 	}
 
 	defer conn.Close()
 
+	protocol := conn.Subprotocol()
+	if protocol == "" {
+		protocol = queue.WSProtocol // Clients predating negotiation speak v1
+	}
+	client := &wsClient{conn: conn, binary: protocol == queue.WSBinaryProtocol}
+	if pattern := noisePattern(protocol); pattern != nil {
+		session, err := s.noiseHandshake(conn, pattern, protocol)
+		if err != nil {
+			slog.Debug("Noise handshake failed", "protocol", protocol, "error", err)
+			return
+		}
+		client.noise = session
+		client.binary = true
+	}
+	s.register(client)
+	defer s.unregister(client)
+
+	// The request span lasts as long as the connection
+	span := trace.SpanFromContext(r.Context())
+	span.AddEvent("websocket.open", trace.WithAttributes(attribute.String("websocket.protocol", protocol)))
+	defer span.AddEvent("websocket.close")
+
+	// Reap connections that went away without closing (e.g. lost signal)
+	done := make(chan struct{})
+	defer close(done)
+	client.keepalive(done)
+	go s.watchAcks(client, done)
+	if s.wsCoverMinInterval > 0 {
+		client.cover = make(chan time.Duration, 1)
+		go client.coverTraffic(done)
+	}
+
+	// Say which protocol this connection speaks before anything else
+	client.writeJSON(queue.WSMessage{
+		Type:      queue.WSTypeHello,
+		Protocol:  protocol,
+		Timestamp: time.Now(),
+	})
+
+	// Show newly connected clients the active operator notice
+	if signed, _ := s.queueManager.CurrentNotice(); signed != nil {
+		client.writeJSON(queue.WSMessage{
+			Type:      queue.WSTypeNotice,
+			Notice:    signed,
+			Timestamp: time.Now(),
+		})
+	}
+
 	// Track subscribed queues for this connection
 	subscribedQueues := make(map[string]bool)
 	defer func() {
 		// Unsubscribe from all queues when connection closes
 		for queueID := range subscribedQueues {
-			s.unsubscribe(queueID, conn)
+			s.unsubscribe(queueID, client)
 		}
+		s.leaveSignals(client)
+		// Whatever was pushed but not acked goes back for the next connection
+		s.requeue(client.release(""))
 	}()
 
 	// Read messages from client
 	for {
-		var msg queue.WSMessage
-		err := conn.ReadJSON(&msg)
+		data, err := client.read()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseServiceRestart) {
+				slog.Debug("WebSocket closed unexpectedly", "error", err)
 			}
 			break
 		}
 
-		// Handle message based on type
+		// Any frame from the client proves the connection is alive
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		// A bad frame is reported and skipped; the connection stays usable
+		var msg queue.WSMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			client.writeError(&msg, http.StatusBadRequest, errMalformedFrame.Error())
+			continue
+		}
+
+		// Frame spans are children of the connection's span; the name is
+		// bounded so clients cannot invent span names
+		spanName := "ws unknown"
 		switch msg.Type {
-		case queue.WSTypeSubscribe:
-			// Subscribe to queue updates
-			if msg.QueueID != "" && msg.AccessToken != "" {
-				s.subscribe(msg.QueueID, msg.AccessToken, conn)
-				subscribedQueues[msg.QueueID] = true
-			}
+		case queue.WSTypeSubscribe, queue.WSTypeUnsubscribe, queue.WSTypeAck, queue.WSTypePing, queue.WSTypeSignal, queue.WSTypePresence, queue.WSTypeCover:
+			spanName = "ws " + string(msg.Type)
+		}
+		ctx, span := tracer.Start(r.Context(), spanName)
+		s.handleFrame(ctx, client, &msg, subscribedQueues)
+		span.End()
+	}
+}
 
-		case queue.WSTypeUnsubscribe:
-			// Unsubscribe from queue updates
-			if msg.QueueID != "" {
-				s.unsubscribe(msg.QueueID, conn)
-				delete(subscribedQueues, msg.QueueID)
-			}
+// handleFrame acts on one client frame; subscribed tracks the connection's
+// queues
+func (s *Server) handleFrame(ctx context.Context, client *wsClient, msg *queue.WSMessage, subscribed map[string]bool) {
+	switch msg.Type {
+	case queue.WSTypeSubscribe:
+		// Subscribe to queue updates, catching up on anything already queued
+		if msg.QueueID == "" || msg.AccessToken == "" {
+			client.writeError(msg, http.StatusBadRequest, "queue_id and access_token required")
+			return
+		}
+		if !subscribed[msg.QueueID] && s.wsMaxSubscriptions > 0 && len(subscribed) >= s.wsMaxSubscriptions {
+			client.writeError(msg, http.StatusTooManyRequests, errTooManySubscriptions.Error())
+			return
+		}
+		if err := s.subscribe(ctx, msg.QueueID, msg.AccessToken, msg.Cursor, client); err != nil {
+			s.writeWSError(client, msg, err)
+			return
+		}
+		subscribed[msg.QueueID] = true
 
-		case queue.WSTypeAck:
-			// Client acknowledged message receipt
-			if msg.QueueID != "" && msg.MessageID != "" && msg.AccessToken != "" {
-				// Delete the acknowledged message
-				s.queueManager.DeleteMessage(msg.QueueID, msg.MessageID, msg.AccessToken)
-			}
+	case queue.WSTypeUnsubscribe:
+		// Unsubscribe from queue updates
+		if msg.QueueID == "" {
+			client.writeError(msg, http.StatusBadRequest, "queue_id required")
+			return
+		}
+		s.unsubscribe(msg.QueueID, client)
+		delete(subscribed, msg.QueueID)
+		s.requeue(client.release(msg.QueueID))
 
-		case queue.WSTypePing:
-			// Respond with pong
-			conn.WriteJSON(queue.WSMessage{
-				Type:      queue.WSTypePong,
-				Timestamp: time.Now(),
-			})
+	case queue.WSTypeAck:
+		// Client acknowledged message receipt
+		if msg.QueueID == "" || msg.MessageID == "" || msg.AccessToken == "" {
+			client.writeError(msg, http.StatusBadRequest, "queue_id, message_id and access_token required")
+			return
 		}
+		// Delete the acknowledged message; only then is the delivery settled,
+		// so an ack with a wrong token leaves it pending for requeueing
+		if err := s.queueManager.DeleteMessage(ctx, msg.QueueID, msg.MessageID, msg.AccessToken); err != nil {
+			s.writeWSError(client, msg, err)
+			return
+		}
+		client.acked(msg.QueueID, msg.MessageID)
+		s.acked(msg.QueueID, msg.MessageID)
+
+	case queue.WSTypeSignal:
+		s.handleSignal(ctx, client, msg, subscribed)
+
+	case queue.WSTypePresence:
+		s.handlePresence(ctx, client, msg)
+
+	case queue.WSTypeCover:
+		s.handleCover(client, msg)
+
+	case queue.WSTypePing:
+		// Respond with pong
+		client.writeJSON(queue.WSMessage{
+			Type:      queue.WSTypePong,
+			Timestamp: time.Now(),
+		})
+
+	default:
+		client.writeError(msg, http.StatusBadRequest, errUnknownFrameType.Error())
 	}
 }
 
-// subscribe adds a WebSocket connection to a queue's subscriber list
-func (s *Server) subscribe(queueID, accessToken string, conn *websocket.Conn) {
-	// Verify access token (optional, for added security)
-	// For now, we trust the client
+// subscribe adds a WebSocket connection to a queue's subscriber list and
+// then pushes the messages already queued after cursor (empty = all)
+// Fails without subscribing if the token may not receive
+func (s *Server) subscribe(ctx context.Context, queueID, accessToken, cursor string, client *wsClient) error {
+	// Verify the token before anything is pushed; this has no side effects
+	if _, err := s.queueManager.CountMessages(ctx, queueID, accessToken, queue.ReceiveOptions{Cursor: cursor}); err != nil {
+		return err
+	}
 
 	s.wsMutex.Lock()
-	defer s.wsMutex.Unlock()
+	subscribed := false
+	for _, c := range s.wsConnections[queueID] {
+		subscribed = subscribed || c == client
+	}
+	if !subscribed {
+		s.wsConnections[queueID] = append(s.wsConnections[queueID], client)
+	}
+	s.wsMutex.Unlock()
+
+	slog.Debug("Client subscribed", "queue", logging.QueueRef(queueID))
 
-	if s.wsConnections[queueID] == nil {
-		s.wsConnections[queueID] = []*websocket.Conn{}
+	// Subscribed first so nothing sent meanwhile is missed; a message that
+	// arrives during catch-up may be pushed twice, and clients already
+	// dedupe by message ID
+	s.sendBacklog(ctx, queueID, accessToken, cursor, client)
+	return nil
+}
+
+// sendBacklog pushes the queued messages after cursor as message frames,
+// leaving out those a visibility-timeout consumer holds
+func (s *Server) sendBacklog(ctx context.Context, queueID, accessToken, cursor string, client *wsClient) {
+	for {
+		backlog, err := s.queueManager.ReceiveMessages(ctx, queueID, accessToken, queue.ReceiveOptions{Cursor: cursor, SkipLeased: true})
+		if err != nil {
+			return
+		}
+		for i := range backlog.Messages {
+			if client.deliver(&backlog.Messages[i]) != nil {
+				return
+			}
+		}
+		if !backlog.HasMore {
+			return
+		}
+		cursor = backlog.NextCursor
 	}
-	s.wsConnections[queueID] = append(s.wsConnections[queueID], conn)
+}
 
-	log.Printf("Client subscribed to queue %s", queueID)
+// messageFrame builds the WebSocket frame that delivers message
+func messageFrame(message *queue.Message) queue.WSMessage {
+	frame := queue.WSMessage{
+		Type:        queue.WSTypeMessage,
+		QueueID:     message.QueueID,
+		MessageID:   message.ID,
+		Seq:         message.Seq,
+		Payload:     message.Payload,
+		PayloadHash: message.PayloadHash,
+		SenderID:    message.SenderID,
+		Timestamp:   time.Now(),
+	}
+	if message.Seq > 0 {
+		frame.Cursor = queue.EncodeCursor(message.Seq)
+	}
+	return frame
 }
 
 // unsubscribe removes a WebSocket connection from a queue's subscriber list
-func (s *Server) unsubscribe(queueID string, conn *websocket.Conn) {
+func (s *Server) unsubscribe(queueID string, client *wsClient) {
 	s.wsMutex.Lock()
 	defer s.wsMutex.Unlock()
 
 	connections := s.wsConnections[queueID]
 	for i, c := range connections {
-		if c == conn {
+		if c == client {
 			// Remove connection
 			s.wsConnections[queueID] = append(connections[:i], connections[i+1:]...)
 			break
@@ -299,43 +1178,79 @@ func (s *Server) unsubscribe(queueID string, conn *websocket.Conn) {
 		delete(s.wsConnections, queueID)
 	}
 
-	log.Printf("Client unsubscribed from queue %s", queueID)
+	slog.Debug("Client unsubscribed", "queue", logging.QueueRef(queueID))
 }
 
 // notifySubscribers sends a new message notification to all subscribers of a queue
-func (s *Server) notifySubscribers(queueID string, message *queue.Message) {
+// (WebSocket connections and event streams)
+// Burn-after-read messages are claimed first, so pushing them also deletes them
+func (s *Server) notifySubscribers(queueID string, message *queue.Message, burn bool) {
+	// Deliver from copies, so a slow client never holds up subscribes
 	s.wsMutex.RLock()
-	defer s.wsMutex.RUnlock()
+	connections := slices.Clone(s.wsConnections[queueID])
+	streams := slices.Clone(s.sseStreams[queueID])
+	s.wsMutex.RUnlock()
+	if len(connections) == 0 && len(streams) == 0 {
+		return
+	}
 
-	connections := s.wsConnections[queueID]
-	if len(connections) == 0 {
+	// A visibility-timeout consumer may have leased it since it was sent
+	if s.queueManager.Leased(context.Background(), queueID, message.ID) {
 		return
 	}
 
-	// Create notification message
-	notification := queue.WSMessage{
-		Type:      queue.WSTypeMessage,
-		QueueID:   queueID,
-		MessageID: message.ID,
-		Payload:   message.Payload,
-		Timestamp: time.Now(),
+	if burn {
+		claimed, err := s.queueManager.ClaimMessage(context.Background(), queueID, message.ID)
+		if err != nil {
+			slog.Error("Claiming burn-after-read message failed", "queue", logging.QueueRef(queueID), "error", err)
+			return
+		}
+		if !claimed {
+			return // A concurrent receive already delivered it
+		}
 	}
 
-	// Send to all subscribers (synchronously to avoid concurrent writes)
-	for _, conn := range connections {
-		err := conn.WriteJSON(notification)
+	// Send to all subscribers
+	for _, client := range connections {
+		err := client.deliver(message)
 		if err != nil {
-			log.Printf("Error sending WebSocket message: %v", err)
+			slog.Debug("Sending WebSocket message failed", "error", err)
+			continue
+		}
+		s.queueManager.RecordEvent(queueID, queue.EventNotified, message.ID)
+	}
+	for _, stream := range streams {
+		if stream.push(message) {
+			s.queueManager.RecordEvent(queueID, queue.EventNotified, message.ID)
 		}
 	}
 }
 
+// bearerToken extracts the token from the Authorization header, with or without "Bearer " prefix
+func bearerToken(r *http.Request) string {
+	token := r.Header.Get("Authorization")
+	if len(token) > 7 && token[:7] == "Bearer " {
+		token = token[7:]
+	}
+	return token
+}
+
+// clientIP returns the remote address of the request without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // CORS middleware
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token, Private-Token, Tenant-Key, X-Auth-Token, X-Privmsg-Nonce, Idempotency-Key, Upload-Offset, Range, If-Range, traceparent, tracestate")
+		w.Header().Set("Access-Control-Expose-Headers", "Idempotent-Replayed, Message-Seq, ETag, Upload-Offset, Content-Range, Accept-Ranges, X-Request-ID, Deprecation, Sunset, Link, X-Privmsg-Signature, X-Privmsg-Signed-At, X-Privmsg-Key-ID")
 		w.Header().Set("Access-Control-Max-Age", "86400")
 
 		if r.Method == "OPTIONS" {
@@ -355,9 +1270,22 @@ func (s *Server) serveSPA(staticDir http.FileSystem) {
 	// Serve static files with SPA fallback
 	s.router.Get("/*", func(w http.ResponseWriter, r *http.Request) {
 		// Don't serve static files for API routes
-		if strings.HasPrefix(r.URL.Path, "/queue") ||
+		if strings.HasPrefix(r.URL.Path, apiPrefix+"/") ||
+			strings.HasPrefix(r.URL.Path, "/queue") ||
 			strings.HasPrefix(r.URL.Path, "/ws") ||
-			strings.HasPrefix(r.URL.Path, "/health") {
+			strings.HasPrefix(r.URL.Path, "/tokens") ||
+			strings.HasPrefix(r.URL.Path, "/regions") ||
+			strings.HasPrefix(r.URL.Path, "/discovery") ||
+			strings.HasPrefix(r.URL.Path, "/onion") ||
+			strings.HasPrefix(r.URL.Path, "/admin") ||
+			strings.HasPrefix(r.URL.Path, "/notice") ||
+			strings.HasPrefix(r.URL.Path, "/time") ||
+			strings.HasPrefix(r.URL.Path, "/server-info") ||
+			strings.HasPrefix(r.URL.Path, "/transparency") ||
+			strings.HasPrefix(r.URL.Path, "/wipe") ||
+			strings.HasPrefix(r.URL.Path, "/debug") ||
+			strings.HasPrefix(r.URL.Path, "/health") ||
+			strings.HasPrefix(r.URL.Path, "/readyz") {
 			http.NotFound(w, r)
 			return
 		}
@@ -381,18 +1309,99 @@ func (s *Server) serveSPA(staticDir http.FileSystem) {
 	})
 }
 
+// newHTTPServer applies the configured limits to a listener
+func (s *Server) newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: s.limits.ReadHeaderTimeout,
+		ReadTimeout:       s.limits.ReadTimeout,
+		WriteTimeout:      s.limits.WriteTimeout,
+		IdleTimeout:       s.limits.IdleTimeout,
+		MaxHeaderBytes:    s.limits.MaxHeaderBytes,
+	}
+}
+
 // Shutdown gracefully shuts down the server
+// The listener stops accepting at once; requests in flight get until ctx is
+// done to finish, after which the remaining connections are cut
 func (s *Server) Shutdown(ctx context.Context) error {
-	// Close all WebSocket connections
-	s.wsMutex.Lock()
-	defer s.wsMutex.Unlock()
+	s.httpMu.Lock()
+	s.stopped = true
+	httpServer := s.httpServer
+	challengeServer := s.challengeServer
+	pprofServer := s.pprofServer
+	s.httpMu.Unlock()
+
+	if challengeServer != nil {
+		challengeServer.Close()
+	}
+	if pprofServer != nil {
+		pprofServer.Close() // A profile in progress is not worth waiting for
+	}
+
+	// Streaming connections never finish on their own, so end them first
+	s.closeStreams()
 
-	for queueID, connections := range s.wsConnections {
-		for _, conn := range connections {
-			conn.Close()
+	if httpServer != nil {
+		if err := httpServer.Shutdown(ctx); err != nil {
+			httpServer.Close()
+			return fmt.Errorf("failed to drain connections: %w", err)
 		}
+	}
+
+	// WebSocket handlers finish the close handshake and put back unacked
+	// messages on the way out
+	handlersDone := make(chan struct{})
+	go func() {
+		s.wsHandlers.Wait()
+		close(handlersDone)
+	}()
+	select {
+	case <-handlersDone:
+		return nil
+	case <-ctx.Done():
+		s.cutWebSockets()
+		return fmt.Errorf("failed to drain connections: %w", ctx.Err())
+	}
+}
+
+// closeStreams asks every WebSocket client to reconnect elsewhere and ends
+// every event stream
+func (s *Server) closeStreams() {
+	s.wsMutex.Lock()
+	clients := make([]*wsClient, 0, len(s.wsClients))
+	for client := range s.wsClients {
+		clients = append(clients, client)
+	}
+	for queueID := range s.wsConnections {
 		delete(s.wsConnections, queueID)
 	}
 
-	return nil
+	// End event streams; their handlers unsubscribe on the way out
+	for _, streams := range s.sseStreams {
+		for _, stream := range streams {
+			stream.close()
+		}
+	}
+	s.wsMutex.Unlock()
+
+	// WebSocket connections are hijacked, so http.Server does not track them
+	for _, client := range clients {
+		go func() {
+			if client.closeRestarting() != nil {
+				client.conn.Close()
+			}
+		}()
+	}
+}
+
+// cutWebSockets drops the connections of clients that never answered the
+// close frame
+func (s *Server) cutWebSockets() {
+	s.wsMutex.RLock()
+	defer s.wsMutex.RUnlock()
+	for client := range s.wsClients {
+		client.conn.Close()
+	}
 }
@@ -0,0 +1,230 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+
+	"privmsg-relay/internal/queue"
+)
+
+// testRedis connects to the Redis at REDIS_TEST_ADDR, skipping the test
+// when none is configured
+func testRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	addr := os.Getenv("REDIS_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_TEST_ADDR not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("Redis at %s unreachable: %v", addr, err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// testServer serves a relay backed by the Redis at REDIS_TEST_ADDR,
+// skipping the test when none is configured
+func testServer(t *testing.T) (*queue.Manager, *httptest.Server) {
+	t.Helper()
+	return testServerWith(t, testRedis(t), Options{})
+}
+
+// testServerWith serves a relay with the given subsystems
+func testServerWith(t *testing.T, client *redis.Client, opts Options) (*queue.Manager, *httptest.Server) {
+	t.Helper()
+	manager := queue.NewManager(client)
+	server := httptest.NewServer(NewServer(manager, opts).router)
+	t.Cleanup(server.Close)
+	return manager, server
+}
+
+// dialWS opens a WebSocket to the test relay and reads past its hello
+func dialWS(t *testing.T, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if hello := readFrame(t, conn); hello.Type != queue.WSTypeHello {
+		t.Fatalf("first frame = %q, want %q", hello.Type, queue.WSTypeHello)
+	}
+	return conn
+}
+
+// readFrame reads the next frame, failing the test if none comes in time
+func readFrame(t *testing.T, conn *websocket.Conn) queue.WSMessage {
+	t.Helper()
+	var frame queue.WSMessage
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+// framesUntilPong pings and returns every frame the relay sent before the pong
+func framesUntilPong(t *testing.T, conn *websocket.Conn) []queue.WSMessage {
+	t.Helper()
+	if err := conn.WriteJSON(queue.WSMessage{Type: queue.WSTypePing}); err != nil {
+		t.Fatal(err)
+	}
+	var frames []queue.WSMessage
+	for {
+		frame := readFrame(t, conn)
+		if frame.Type == queue.WSTypePong {
+			return frames
+		}
+		frames = append(frames, frame)
+	}
+}
+
+// createTestQueue creates a queue that is deleted when the test ends
+func createTestQueue(t *testing.T, m *queue.Manager) *queue.CreateQueueResponse {
+	t.Helper()
+	ctx := context.Background()
+	created, err := m.CreateQueue(ctx, queue.CreateQueueRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.DeleteQueue(ctx, created.QueueID, created.AccessToken) })
+	return created
+}
+
+// sendTestMessage sends a message and returns its ID
+func sendTestMessage(t *testing.T, m *queue.Manager, queueID, text string) string {
+	t.Helper()
+	sent, err := m.SendMessage(context.Background(), queueID, []byte(text), queue.SendOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sent.MessageID
+}
+
+func TestWSBacklogSkipsLeasedMessages(t *testing.T) {
+	m, server := testServer(t)
+	created := createTestQueue(t, m)
+	leasedID := sendTestMessage(t, m, created.QueueID, "held by a visibility-timeout consumer")
+	freeID := sendTestMessage(t, m, created.QueueID, "free for anyone")
+
+	leased, err := m.ReceiveMessages(context.Background(), created.QueueID, created.AccessToken, queue.ReceiveOptions{Limit: 1, VisibilityTimeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leased.Messages) != 1 || leased.Messages[0].ID != leasedID {
+		t.Fatalf("leased %v, want only %s", leased.Messages, leasedID)
+	}
+
+	conn := dialWS(t, server)
+	if err := conn.WriteJSON(queue.WSMessage{Type: queue.WSTypeSubscribe, QueueID: created.QueueID, AccessToken: created.AccessToken}); err != nil {
+		t.Fatal(err)
+	}
+	var pushed []string
+	for _, frame := range framesUntilPong(t, conn) {
+		if frame.Type != queue.WSTypeMessage {
+			t.Fatalf("unexpected %q frame: %s", frame.Type, frame.Error)
+		}
+		pushed = append(pushed, frame.MessageID)
+	}
+	if len(pushed) != 1 || pushed[0] != freeID {
+		t.Errorf("pushed %v, want only %s", pushed, freeID)
+	}
+}
+
+// postMessage sends a message through the HTTP API, so subscribers are pushed it
+func postMessage(t *testing.T, server *httptest.Server, queueID, text string) string {
+	t.Helper()
+	body, _ := json.Marshal(queue.SendMessageRequest{Payload: []byte(text)})
+	resp, err := http.Post(server.URL+"/v1/queue/"+queueID+"/send", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var sent queue.SendMessageResponse
+	if resp.StatusCode != http.StatusCreated || json.NewDecoder(resp.Body).Decode(&sent) != nil {
+		t.Fatalf("send: status %d", resp.StatusCode)
+	}
+	return sent.MessageID
+}
+
+func TestWSBurnAfterReadRedelivery(t *testing.T) {
+	tests := []struct {
+		name      string
+		ackToken  func(created *queue.CreateQueueResponse) string // Empty = no ack
+		requeued  bool
+		ackFailed bool
+	}{
+		{"never acked", func(*queue.CreateQueueResponse) string { return "" }, true, false},
+		{"acked with a wrong token", func(*queue.CreateQueueResponse) string { return "not-the-access-token" }, true, true},
+		{"acked", func(c *queue.CreateQueueResponse) string { return c.AccessToken }, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, server := testServer(t)
+			ctx := context.Background()
+			created, err := m.CreateQueue(ctx, queue.CreateQueueRequest{BurnAfterRead: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { m.DeleteQueue(ctx, created.QueueID, created.AccessToken) })
+
+			conn := dialWS(t, server)
+			if err := conn.WriteJSON(queue.WSMessage{Type: queue.WSTypeSubscribe, QueueID: created.QueueID, AccessToken: created.AccessToken}); err != nil {
+				t.Fatal(err)
+			}
+			framesUntilPong(t, conn) // Subscribed, with nothing queued yet
+
+			messageID := postMessage(t, server, created.QueueID, "burn after reading")
+			if frame := readFrame(t, conn); frame.Type != queue.WSTypeMessage || frame.MessageID != messageID {
+				t.Fatalf("got %q frame for %q, want the pushed message %s", frame.Type, frame.MessageID, messageID)
+			}
+
+			if token := tt.ackToken(created); token != "" {
+				conn.WriteJSON(queue.WSMessage{Type: queue.WSTypeAck, QueueID: created.QueueID, MessageID: messageID, AccessToken: token})
+				frames := framesUntilPong(t, conn)
+				if failed := len(frames) == 1 && frames[0].Type == queue.WSTypeError; failed != tt.ackFailed {
+					t.Fatalf("ack answered with %v, want an error frame: %v", frames, tt.ackFailed)
+				}
+			}
+			conn.Close()
+
+			// The connection is gone; anything it never acked goes back on the queue
+			got := queuedAfterClose(t, m, created, tt.requeued)
+			if requeued := len(got) == 1 && got[0].ID == messageID; requeued != tt.requeued || len(got) > 1 {
+				t.Errorf("after close the queue holds %d messages, want the pushed one requeued: %v", len(got), tt.requeued)
+			}
+		})
+	}
+}
+
+// queuedAfterClose receives what a closed connection left on the queue,
+// polling until something shows up when expected, or after a grace period
+// in which a wrong requeue would have landed
+func queuedAfterClose(t *testing.T, m *queue.Manager, created *queue.CreateQueueResponse, expected bool) []queue.Message {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	if !expected {
+		time.Sleep(200 * time.Millisecond)
+	}
+	for {
+		response, err := m.ReceiveMessages(context.Background(), created.QueueID, created.AccessToken, queue.ReceiveOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Messages) > 0 || !expected || time.Now().After(deadline) {
+			return response.Messages
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,86 @@
+package relay
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"privmsg-relay/internal/identity"
+	"privmsg-relay/internal/queue"
+)
+
+// ServerInfoResponse describes the relay's long-term identity
+type ServerInfoResponse struct {
+	PublicKey       []byte `json:"public_key"` // Ed25519 identity key; signs critical responses, notices and GET /time
+	KeyID           string `json:"key_id"`
+	X25519PublicKey []byte `json:"x25519_public_key"` // Montgomery form of PublicKey, for onion layers and Noise handshakes
+	Region          string `json:"region,omitempty"`
+}
+
+func (s *Server) handleServerInfo(w http.ResponseWriter, r *http.Request) {
+	pub := s.identityKey.Public().(ed25519.PublicKey)
+	x25519, _ := identity.X25519(s.identityKey)
+	response := ServerInfoResponse{
+		PublicKey:       pub,
+		KeyID:           identity.KeyID(pub),
+		X25519PublicKey: x25519[:],
+	}
+	if s.federation != nil {
+		response.Region = s.federation.Region()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// signedResponseWriter holds a response back until it can be signed
+type signedResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *signedResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *signedResponseWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(data)
+}
+
+// signResponse signs whatever the handler answers, errors included, so a
+// proxy cannot turn a success into a failure unnoticed either
+func (s *Server) signResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.identityKey == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		nonce := r.Header.Get(identity.NonceHeader)
+		if !identity.ValidNonce(nonce) {
+			http.Error(w, queue.ErrInvalidNonce.Error(), http.StatusBadRequest)
+			return
+		}
+
+		buffered := &signedResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(buffered, r)
+		if buffered.status == 0 {
+			buffered.status = http.StatusOK
+		}
+
+		signedAt := time.Now().Unix()
+		statement := identity.ResponseStatement(r.Method, r.URL.Path, buffered.status, signedAt, nonce, buffered.body.Bytes())
+		w.Header().Set(identity.SignatureHeader, base64.StdEncoding.EncodeToString(ed25519.Sign(s.identityKey, statement)))
+		w.Header().Set(identity.SignedAtHeader, strconv.FormatInt(signedAt, 10))
+		w.Header().Set(identity.KeyIDHeader, identity.KeyID(s.identityKey.Public().(ed25519.PublicKey)))
+		w.WriteHeader(buffered.status)
+		w.Write(buffered.body.Bytes())
+	})
+}
@@ -0,0 +1,125 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"privmsg-relay/internal/queue"
+)
+
+// Errors reported in error frames for rejected signals
+var (
+	errSignalingDisabled = errors.New("signaling disabled")
+	errSignalTooLarge    = errors.New("signal too large")
+	errSignalRateLimited = errors.New("too many signals on this connection")
+)
+
+// allowSignal counts a signal against the connection's budget of limit
+// signals per second; only the read loop calls it, so it needs no lock
+func (c *wsClient) allowSignal(limit int, now time.Time) bool {
+	if now.Sub(c.signalWindow) >= time.Second {
+		c.signalWindow, c.signalCount = now, 0
+	}
+	c.signalCount++
+	return limit <= 0 || c.signalCount <= limit
+}
+
+// handleSignal relays an ephemeral frame (typing, read receipts, call
+// setup) without storing it anywhere; nobody listening means it is dropped
+// A subscriber's signal reaches the queue's other subscribers and every
+// connection that has signaled the queue as a sender. A sender's signal
+// reaches the subscribers only, so senders never see each other's
+func (s *Server) handleSignal(ctx context.Context, client *wsClient, msg *queue.WSMessage, subscribed map[string]bool) {
+	if s.wsSignalMaxBytes <= 0 {
+		client.writeError(msg, http.StatusNotFound, errSignalingDisabled.Error())
+		return
+	}
+	if msg.QueueID == "" || len(msg.Payload) == 0 {
+		client.writeError(msg, http.StatusBadRequest, "queue_id and payload required")
+		return
+	}
+	if len(msg.Payload) > s.wsSignalMaxBytes {
+		client.writeError(msg, http.StatusRequestEntityTooLarge, errSignalTooLarge.Error())
+		return
+	}
+	if !client.allowSignal(s.wsSignalRate, time.Now()) {
+		client.writeError(msg, http.StatusTooManyRequests, errSignalRateLimited.Error())
+		return
+	}
+
+	fromSubscriber := subscribed[msg.QueueID]
+	if !fromSubscriber && !client.signaled[msg.QueueID] {
+		// A sender is checked once per queue; later signals cost no Redis round trip
+		if s.wsMaxSubscriptions > 0 && len(client.signaled) >= s.wsMaxSubscriptions {
+			client.writeError(msg, http.StatusTooManyRequests, errTooManySubscriptions.Error())
+			return
+		}
+		if err := s.queueManager.AuthorizeSignal(ctx, msg.QueueID, msg.AccessToken); err != nil {
+			s.writeWSError(client, msg, err)
+			return
+		}
+		s.joinSignals(msg.QueueID, client)
+	}
+
+	frame := queue.WSMessage{
+		Type:      queue.WSTypeSignal,
+		QueueID:   msg.QueueID,
+		Payload:   msg.Payload,
+		Timestamp: time.Now(),
+	}
+	for _, peer := range s.signalTargets(msg.QueueID, client, fromSubscriber) {
+		peer.writeJSON(frame)
+	}
+}
+
+// signalTargets lists the connections a signal from client reaches
+func (s *Server) signalTargets(queueID string, client *wsClient, fromSubscriber bool) []*wsClient {
+	s.wsMutex.RLock()
+	defer s.wsMutex.RUnlock()
+
+	var targets []*wsClient
+	for _, c := range s.wsConnections[queueID] {
+		if c != client {
+			targets = append(targets, c)
+		}
+	}
+	if fromSubscriber {
+		for _, c := range s.signalPeers[queueID] {
+			if c != client {
+				targets = append(targets, c)
+			}
+		}
+	}
+	return targets
+}
+
+// joinSignals makes a sender's connection receive its queue's subscriber signals
+func (s *Server) joinSignals(queueID string, client *wsClient) {
+	s.wsMutex.Lock()
+	defer s.wsMutex.Unlock()
+	if client.signaled == nil {
+		client.signaled = make(map[string]bool)
+	}
+	client.signaled[queueID] = true
+	s.signalPeers[queueID] = append(s.signalPeers[queueID], client)
+}
+
+// leaveSignals drops a closed connection from every queue it signaled
+func (s *Server) leaveSignals(client *wsClient) {
+	s.wsMutex.Lock()
+	defer s.wsMutex.Unlock()
+	for queueID := range client.signaled {
+		peers := s.signalPeers[queueID]
+		for i, c := range peers {
+			if c == client {
+				s.signalPeers[queueID] = append(peers[:i], peers[i+1:]...)
+				break
+			}
+		}
+		if len(s.signalPeers[queueID]) == 0 {
+			delete(s.signalPeers, queueID)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"privmsg-relay/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Header carrying a tenant API key on queue creation
+const tenantKeyHeader = "Tenant-Key"
+
+// TenantList is returned by GET /admin/tenants
+type TenantList struct {
+	Tenants []queue.Tenant `json:"tenants"`
+}
+
+// TierList is returned by GET /admin/tiers
+type TierList struct {
+	Tiers       []queue.Tier `json:"tiers"`
+	DefaultTier string       `json:"default_tier,omitempty"`
+}
+
+// authenticateTenant returns the tenant whose API key a create request
+// carries ("" for none); the key is ignored while tenancy is off
+func (s *Server) authenticateTenant(r *http.Request) (string, error) {
+	if !s.queueManager.TenancyEnabled() {
+		return "", nil
+	}
+	apiKey := r.Header.Get(tenantKeyHeader)
+	if apiKey == "" {
+		if s.tenantKeyRequired {
+			return "", queue.ErrTenantKeyRequired
+		}
+		return "", nil
+	}
+	return s.queueManager.AuthenticateTenant(r.Context(), apiKey)
+}
+
+// handleListTenants lists tenants with their live queue counts
+//
+//	GET /admin/tenants
+func (s *Server) handleListTenants(w http.ResponseWriter, r *http.Request) {
+	tenants, err := s.queueManager.ListTenants(r.Context())
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TenantList{Tenants: tenants})
+}
+
+// handleCreateTenant registers a tenant
+//
+//	POST /admin/tenants
+func (s *Server) handleCreateTenant(w http.ResponseWriter, r *http.Request) {
+	var req queue.CreateTenantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tenant, err := s.queueManager.CreateTenant(r.Context(), req)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tenant)
+}
+
+// handleGetTenant shows one tenant
+//
+//	GET /admin/tenants/{tenantID}
+func (s *Server) handleGetTenant(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.queueManager.GetTenant(r.Context(), chi.URLParam(r, "tenantID"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tenant)
+}
+
+// handleDeleteTenant revokes a tenant's keys and forgets it
+//
+//	DELETE /admin/tenants/{tenantID}
+func (s *Server) handleDeleteTenant(w http.ResponseWriter, r *http.Request) {
+	if err := s.queueManager.DeleteTenant(r.Context(), chi.URLParam(r, "tenantID")); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCreateTenantKey issues an API key, shown only in this response
+//
+//	POST /admin/tenants/{tenantID}/keys
+func (s *Server) handleCreateTenantKey(w http.ResponseWriter, r *http.Request) {
+	key, err := s.queueManager.CreateTenantKey(r.Context(), chi.URLParam(r, "tenantID"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+// handleRevokeTenantKey invalidates one API key
+//
+//	DELETE /admin/tenants/{tenantID}/keys/{keyID}
+func (s *Server) handleRevokeTenantKey(w http.ResponseWriter, r *http.Request) {
+	err := s.queueManager.RevokeTenantKey(r.Context(), chi.URLParam(r, "tenantID"), chi.URLParam(r, "keyID"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSetTenantTier moves a tenant to another quota tier
+//
+//	PUT /admin/tenants/{tenantID}/tier
+func (s *Server) handleSetTenantTier(w http.ResponseWriter, r *http.Request) {
+	var req queue.SetTenantTierRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tenant, err := s.queueManager.SetTenantTier(r.Context(), chi.URLParam(r, "tenantID"), req.Tier)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tenant)
+}
+
+// handleTenantUsage reports what a tenant used in one month (?period=YYYY-MM,
+// default this month)
+//
+//	GET /admin/tenants/{tenantID}/usage
+func (s *Server) handleTenantUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := s.queueManager.GetTenantUsage(r.Context(), chi.URLParam(r, "tenantID"), r.URL.Query().Get("period"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
+
+// handleListTiers lists the quota tiers tenants can be put on
+//
+//	GET /admin/tiers
+func (s *Server) handleListTiers(w http.ResponseWriter, r *http.Request) {
+	if !s.queueManager.TenancyEnabled() {
+		s.writeError(w, queue.ErrTenancyDisabled)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TierList{Tiers: s.queueManager.Tiers(), DefaultTier: s.queueManager.DefaultTier()})
+}
@@ -0,0 +1,20 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// handleTime returns the relay clock signed with its identity key
+// Clients with a bad clock use it to offset the deadlines they put in tokens
+func (s *Server) handleTime(w http.ResponseWriter, r *http.Request) {
+	signed, err := s.queueManager.SignServerTime(r.URL.Query().Get("nonce"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(signed)
+}
@@ -0,0 +1,107 @@
+package relay
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSOptions configures the native TLS listener
+type TLSOptions struct {
+	CertFile     string // PEM certificate chain
+	KeyFile      string // PEM private key
+	ClientCAFile string // PEM CAs for client certificates (empty = none asked for)
+	RequireCert  bool   // Reject clients without a certificate (otherwise verify if given)
+
+	// Supplies the certificate instead of CertFile and KeyFile, e.g. one
+	// fetched from a secret store and reloaded when it changes
+	GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+}
+
+// LoadTLSConfig builds a hardened server TLS configuration from files, or
+// from opts.GetCertificate
+func LoadTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	var config *tls.Config
+	if opts.GetCertificate != nil {
+		config = harden(&tls.Config{GetCertificate: opts.GetCertificate})
+	} else {
+		if opts.CertFile == "" || opts.KeyFile == "" {
+			return nil, errors.New("both a certificate and a key file are required")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate: %w", err)
+		}
+		config = harden(&tls.Config{Certificates: []tls.Certificate{cert}})
+	}
+
+	if opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("client CA file contains no certificates")
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if opts.RequireCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return config, nil
+}
+
+// ACMEOptions configures automatic certificates from Let's Encrypt
+type ACMEOptions struct {
+	Domains  []string // Host names to obtain certificates for; others are refused
+	CacheDir string   // Where account keys and certificates persist across restarts
+	Email    string   // Contact for expiry notices (optional)
+}
+
+// LoadACMEConfig returns a TLS configuration that obtains and renews
+// certificates on demand, and the handler that must serve port 80 for the
+// HTTP-01 challenge (it redirects every other request to HTTPS)
+func LoadACMEConfig(opts ACMEOptions) (*tls.Config, http.Handler, error) {
+	if len(opts.Domains) == 0 {
+		return nil, nil, errors.New("at least one domain is required")
+	}
+	if opts.CacheDir == "" {
+		return nil, nil, errors.New("a cache directory is required")
+	}
+	if err := os.MkdirAll(opts.CacheDir, 0700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create ACME cache directory: %w", err)
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(opts.CacheDir),
+		HostPolicy: autocert.HostWhitelist(opts.Domains...),
+		Email:      opts.Email,
+	}
+	return harden(manager.TLSConfig()), manager.HTTPHandler(nil), nil
+}
+
+// harden limits a server configuration to TLS 1.2+ with forward-secret
+// AEAD cipher suites
+func harden(config *tls.Config) *tls.Config {
+	config.MinVersion = tls.VersionTLS12
+	config.CurvePreferences = []tls.CurveID{tls.X25519, tls.CurveP256}
+	// TLS 1.3 suites are not configurable and are all acceptable
+	config.CipherSuites = []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+	}
+	return config
+}
@@ -0,0 +1,155 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"privmsg-relay/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// LogEntriesResponse is returned by the entry listing and subject lookup
+type LogEntriesResponse struct {
+	Entries []queue.LogRecord `json:"entries"`
+}
+
+// GossipResponse is returned by GET /transparency/gossip
+type GossipResponse struct {
+	Heads []queue.GossipedHead `json:"heads"`
+}
+
+// queryInt64 parses a required integer query parameter
+func queryInt64(r *http.Request, name string) (int64, error) {
+	value, err := strconv.ParseInt(r.URL.Query().Get(name), 10, 64)
+	if err != nil {
+		return 0, queue.ErrInvalidLogRange
+	}
+	return value, nil
+}
+
+// handleTreeHead returns the signed head of the key transparency log
+func (s *Server) handleTreeHead(w http.ResponseWriter, r *http.Request) {
+	head, err := s.queueManager.TreeHead(r.Context())
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(head)
+}
+
+// handleLogEntries returns the entries from start to end, end exclusive
+func (s *Server) handleLogEntries(w http.ResponseWriter, r *http.Request) {
+	start, err := queryInt64(r, "start")
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	end, err := queryInt64(r, "end")
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	entries, err := s.queueManager.LogEntries(r.Context(), start, end)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LogEntriesResponse{Entries: entries})
+}
+
+// handleLogLookup returns the entries logged for one subject, so a client
+// can see every key bundle the relay ever published for a queue
+func (s *Server) handleLogLookup(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.queueManager.LogLookup(r.Context(), chi.URLParam(r, "subject"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(LogEntriesResponse{Entries: entries})
+}
+
+// handleInclusionProof proves an entry is in the tree of tree_size entries
+func (s *Server) handleInclusionProof(w http.ResponseWriter, r *http.Request) {
+	index, err := queryInt64(r, "index")
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	size, err := queryInt64(r, "tree_size")
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	proof, err := s.queueManager.InclusionProof(r.Context(), index, size)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(proof)
+}
+
+// handleConsistencyProof proves the log of second entries extends the log of first
+func (s *Server) handleConsistencyProof(w http.ResponseWriter, r *http.Request) {
+	first, err := queryInt64(r, "first")
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	second, err := queryInt64(r, "second")
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	proof, err := s.queueManager.ConsistencyProof(r.Context(), first, second)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(proof)
+}
+
+// handleGossip accepts a signed tree head a client saw; a head of this
+// relay's that its log does not match is kept and answered with 409
+func (s *Server) handleGossip(w http.ResponseWriter, r *http.Request) {
+	var req queue.GossipedHead
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.queueManager.Gossip(r.Context(), clientIP(r), req); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetGossip returns the latest gossiped tree heads, newest first
+func (s *Server) handleGetGossip(w http.ResponseWriter, r *http.Request) {
+	heads, err := s.queueManager.GossipedHeads(r.Context())
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(GossipResponse{Heads: heads})
+}
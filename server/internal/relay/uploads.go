@@ -0,0 +1,127 @@
+package relay
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"privmsg-relay/internal/policy"
+	"privmsg-relay/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleCreateUpload starts a chunked upload (same authorization as send)
+func (s *Server) handleCreateUpload(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+
+	var req queue.CreateUploadRequest
+	if err := decodeBody(r, &req, s.maxBinaryBody()); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	status, err := s.queueManager.CreateUpload(r.Context(), queueID, bearerToken(r), req)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	writeUploadStatus(w, r, http.StatusCreated, status)
+}
+
+// handleGetUpload reports how far an upload got, for resuming it
+func (s *Server) handleGetUpload(w http.ResponseWriter, r *http.Request) {
+	status, err := s.queueManager.GetUpload(r.Context(), chi.URLParam(r, "queueID"), chi.URLParam(r, "uploadID"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	writeUploadStatus(w, r, http.StatusOK, status)
+}
+
+// handleAppendUpload stores one chunk; the body is raw bytes and the
+// Upload-Offset header says where it starts
+func (s *Server) handleAppendUpload(w http.ResponseWriter, r *http.Request) {
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Upload-Offset header required", http.StatusBadRequest)
+		return
+	}
+	chunk, err := io.ReadAll(io.LimitReader(r.Body, int64(s.queueManager.MaxMessageSize())+1))
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	status, err := s.queueManager.AppendUpload(r.Context(), chi.URLParam(r, "queueID"), chi.URLParam(r, "uploadID"), offset, chunk)
+	if err != nil {
+		// Tell the client where to resume
+		if status != nil {
+			w.Header().Set("Upload-Offset", strconv.FormatInt(status.Offset, 10))
+		}
+		s.writeError(w, err)
+		return
+	}
+
+	writeUploadStatus(w, r, http.StatusOK, status)
+}
+
+// handleCommitUpload sends a completed upload as one message
+func (s *Server) handleCommitUpload(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	uploadID := chi.URLParam(r, "uploadID")
+
+	// Policy sees the full payload size, exactly as for a single send
+	status, err := s.queueManager.GetUpload(r.Context(), queueID, uploadID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if !s.checkPolicy(w, r, policy.ActionSend, int(status.Size), s.queueNamespace(r.Context(), queueID)) {
+		return
+	}
+
+	response, payload, err := s.queueManager.CommitUpload(r.Context(), queueID, uploadID, bearerToken(r))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	if response.Replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	} else if !response.Held {
+		s.notifySubscribers(queueID, &queue.Message{
+			ID:         response.MessageID,
+			QueueID:    queueID,
+			Seq:        response.Seq,
+			Payload:    payload,
+			ReceivedAt: response.SentAt,
+			ExpiresAt:  response.ExpiresAt,
+
+			PayloadHash: response.PayloadHash,
+		}, response.BurnAfterRead)
+	}
+
+	writeBody(w, r, http.StatusCreated, response)
+}
+
+// handleAbortUpload discards an upload
+func (s *Server) handleAbortUpload(w http.ResponseWriter, r *http.Request) {
+	err := s.queueManager.AbortUpload(r.Context(), chi.URLParam(r, "queueID"), chi.URLParam(r, "uploadID"))
+	if err != nil && !errors.Is(err, queue.ErrUploadNotFound) {
+		s.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeUploadStatus sends an upload status with its offset also in the
+// Upload-Offset header
+func writeUploadStatus(w http.ResponseWriter, r *http.Request, code int, status *queue.UploadStatus) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(status.Offset, 10))
+	writeBody(w, r, code, status)
+}
@@ -0,0 +1,39 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiPrefix is where the current API version is mounted
+// Breaking changes ship under a new prefix; the old one keeps working
+const apiPrefix = "/v1"
+
+// legacyDeprecatedAt is when the unversioned paths were superseded by /v1
+var legacyDeprecatedAt = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+
+// deprecateLegacy marks responses on the unversioned paths as deprecated
+// (RFC 9745) and points at the /v1 equivalent; a Sunset date (RFC 8594) is
+// announced once the operator has picked one
+func (s *Server) deprecateLegacy(next http.Handler) http.Handler {
+	deprecation := fmt.Sprintf("@%d", legacyDeprecatedAt.Unix())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", deprecation)
+		if !s.legacySunset.IsZero() {
+			w.Header().Set("Sunset", s.legacySunset.UTC().Format(http.TimeFormat))
+		}
+		w.Header().Set("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", apiPrefix, r.URL.EscapedPath()))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// unversionedPath strips the API version prefix, so middleware that looks
+// at paths treats /v1/queue/... and legacy /queue/... alike
+func unversionedPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, apiPrefix); ok && (rest == "" || rest[0] == '/') {
+		return rest
+	}
+	return path
+}
@@ -0,0 +1,63 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"privmsg-relay/internal/anontoken"
+	"privmsg-relay/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleVoucherKey publishes the key vouchers are blind-signed with
+//
+//	GET /vouchers/key
+func (s *Server) handleVoucherKey(w http.ResponseWriter, r *http.Request) {
+	writeIssuerKey(w, s.vouchers)
+}
+
+// handleIssueVoucher blind-signs a voucher for the seller, who took payment
+// without learning which voucher the buyer will redeem
+//
+//	POST /vouchers/issue
+func (s *Server) handleIssueVoucher(w http.ResponseWriter, r *http.Request) {
+	issueBlind(w, r, s.vouchers, s.voucherIssuerSecret)
+}
+
+// handleRedeemVoucher spends a voucher to raise a queue's limits
+//
+//	POST /queue/{queueID}/voucher
+func (s *Server) handleRedeemVoucher(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	accessToken := bearerToken(r)
+
+	var req queue.RedeemVoucherRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	voucher, err := anontoken.DecodeToken(req.Voucher)
+	if err != nil {
+		s.writeError(w, queue.ErrInvalidVoucher)
+		return
+	}
+
+	resp, err := s.queueManager.ElevateQueue(r.Context(), queueID, accessToken, func() error {
+		switch err := s.vouchers.Redeem(voucher); err {
+		case anontoken.ErrInvalidToken:
+			return queue.ErrInvalidVoucher
+		case anontoken.ErrTokenSpent:
+			return queue.ErrVoucherSpent
+		default:
+			return err
+		}
+	})
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,345 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"privmsg-relay/internal/logging"
+	"privmsg-relay/internal/queue"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket keepalive timing
+// The server pings every wsPingPeriod; a connection that sends nothing
+// (not even a pong) for wsPongWait is considered dead and closed
+const (
+	wsWriteWait  = 10 * time.Second    // Longest a single write may block
+	wsPongWait   = 60 * time.Second    // Read deadline, extended by every frame received
+	wsPingPeriod = wsPongWait * 9 / 10 // Must be shorter than wsPongWait
+)
+
+// WebSocket redelivery
+// A pushed message that is not acked within wsAckTimeout is pushed again,
+// up to wsMaxRedeliveries times; after that it is given up on and waits
+// for the next HTTP receive or subscribe
+const (
+	wsAckTimeout      = 30 * time.Second
+	wsMaxRedeliveries = 5
+)
+
+// Shutdown close frames carry a reconnect hint spread over
+// wsReconnectSpread, so clients do not all return at the same instant
+const (
+	wsReconnectSpread = 10 * time.Second
+	wsCloseWait       = time.Second // Longest a close frame may take to send
+)
+
+// wsCompressAbove is the smallest frame worth deflating when compression
+// was negotiated; pongs and acks cost more to compress than they save
+const wsCompressAbove = 512
+
+// Errors reported in WebSocket error frames that have no manager equivalent
+var (
+	errMalformedFrame       = errors.New("malformed frame")
+	errUnknownFrameType     = errors.New("unknown frame type")
+	errTooManySubscriptions = errors.New("too many subscriptions on this connection")
+	errTooManyConnections   = errors.New("too many WebSocket connections from this address")
+)
+
+// wsDelivery is a message pushed to a client and not yet acked
+type wsDelivery struct {
+	message  *queue.Message
+	sentAt   time.Time
+	attempts int
+}
+
+// wsClient wraps a WebSocket connection so that notifications, broadcasts
+// and pongs from different goroutines never write concurrently
+type wsClient struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	binary  bool            // Negotiated queue.WSBinaryProtocol: messages go out as binary frames
+	noise   *wsNoiseSession // Set after a Noise handshake: every frame is encrypted
+
+	pendingMu sync.Mutex
+	pending   map[string]*wsDelivery // Unacked pushes by queue and message ID
+
+	// Signaling state, touched only by the connection's read loop
+	signaled     map[string]bool // Queues this connection signaled as a sender
+	signalWindow time.Time
+	signalCount  int
+
+	// Requested mean gap between decoys (nil = cover traffic disabled)
+	cover chan time.Duration
+}
+
+func deliveryKey(queueID, messageID string) string {
+	return queueID + "/" + messageID
+}
+
+// deliver pushes a message and holds it until the client acks it
+// A failed write still counts as pending, so the message is put back when
+// the connection closes
+func (c *wsClient) deliver(message *queue.Message) error {
+	c.pendingMu.Lock()
+	if c.pending == nil {
+		c.pending = make(map[string]*wsDelivery)
+	}
+	c.pending[deliveryKey(message.QueueID, message.ID)] = &wsDelivery{message: message, sentAt: time.Now()}
+	c.pendingMu.Unlock()
+
+	return c.writeMessage(message)
+}
+
+// writeMessage sends a message frame in the negotiated format
+func (c *wsClient) writeMessage(message *queue.Message) error {
+	if !c.binary {
+		return c.writeJSON(messageFrame(message))
+	}
+	data, err := queue.EncodeWSBinary(messageFrame(message))
+	if err != nil {
+		return err
+	}
+	return c.write(websocket.BinaryMessage, data)
+}
+
+// acked stops redelivering a message
+func (c *wsClient) acked(queueID, messageID string) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	delete(c.pending, deliveryKey(queueID, messageID))
+}
+
+// release forgets the unacked messages of one queue (every queue when
+// queueID is empty) and returns them
+func (c *wsClient) release(queueID string) []*queue.Message {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	var released []*queue.Message
+	for key, delivery := range c.pending {
+		if queueID == "" || delivery.message.QueueID == queueID {
+			released = append(released, delivery.message)
+			delete(c.pending, key)
+		}
+	}
+	return released
+}
+
+// redeliver pushes again every message whose ack is overdue and returns
+// the ones given up on
+func (c *wsClient) redeliver(now time.Time) []*queue.Message {
+	c.pendingMu.Lock()
+	var due, abandoned []*queue.Message
+	for key, delivery := range c.pending {
+		if now.Sub(delivery.sentAt) < wsAckTimeout {
+			continue
+		}
+		if delivery.attempts >= wsMaxRedeliveries || now.After(delivery.message.ExpiresAt) {
+			abandoned = append(abandoned, delivery.message)
+			delete(c.pending, key)
+			continue
+		}
+		delivery.attempts++
+		delivery.sentAt = now
+		due = append(due, delivery.message)
+	}
+	c.pendingMu.Unlock()
+
+	for _, message := range due {
+		if c.writeMessage(message) != nil {
+			break
+		}
+	}
+	return abandoned
+}
+
+// writeJSON sends a frame; a client that stops reading fails the write
+// after wsWriteWait instead of blocking every sender behind it, and the
+// connection is closed so its read loop exits and unsubscribes it
+func (c *wsClient) writeJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.write(websocket.TextMessage, data)
+}
+
+// write sends one encoded frame under the same rules as writeJSON
+func (c *wsClient) write(messageType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.noise != nil {
+		sealed, err := c.noise.seal(messageType, data)
+		if err != nil {
+			c.conn.Close()
+			return err
+		}
+		messageType, data = websocket.BinaryMessage, sealed
+	}
+	c.conn.EnableWriteCompression(c.noise == nil && len(data) >= wsCompressAbove) // Ciphertext does not compress
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	if err := c.conn.WriteMessage(messageType, data); err != nil {
+		c.conn.Close()
+		return err
+	}
+	return nil
+}
+
+// writeError answers a client frame with an error frame naming the same
+// queue and message; code is the HTTP status the failure would get
+func (c *wsClient) writeError(request *queue.WSMessage, code int, message string) error {
+	return c.writeJSON(queue.WSMessage{
+		Type:      queue.WSTypeError,
+		QueueID:   request.QueueID,
+		MessageID: request.MessageID,
+		Code:      code,
+		Error:     message,
+		Timestamp: time.Now(),
+	})
+}
+
+// closeRestarting starts the close handshake with code 1012 (service
+// restart) and a JSON reason such as {"reconnect_after":4}, in seconds
+// The read loop exits once the client answers; Shutdown cuts it otherwise
+func (c *wsClient) closeRestarting() error {
+	after := 1 + rand.N(int(wsReconnectSpread/time.Second))
+	reason := fmt.Sprintf(`{"reason":"server restarting","reconnect_after":%d}`, after)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseServiceRestart, reason),
+		time.Now().Add(wsCloseWait))
+}
+
+// ping sends a protocol-level ping frame
+func (c *wsClient) ping() error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+}
+
+// keepalive arms the read deadline and pings the client until done is
+// closed; a failed ping closes the connection so the read loop exits
+func (c *wsClient) keepalive(done <-chan struct{}) {
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	go func() {
+		ticker := time.NewTicker(wsPingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := c.ping(); err != nil {
+					c.conn.Close()
+					return
+				}
+			}
+		}
+	}()
+}
+
+// writeWSError reports a manager error in an error frame, hiding the same
+// details writeError hides over HTTP
+func (s *Server) writeWSError(client *wsClient, request *queue.WSMessage, err error) {
+	status, message := s.errorResponse(err)
+	client.writeError(request, status, message)
+}
+
+// watchAcks redelivers a client's overdue messages until done is closed
+func (s *Server) watchAcks(client *wsClient, done <-chan struct{}) {
+	ticker := time.NewTicker(wsAckTimeout / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			s.requeue(client.redeliver(now))
+		}
+	}
+}
+
+// requeue puts back released messages that were claimed for the push
+// (burn-after-read), so the next receive or subscribe delivers them
+// It runs as the connection closes, so it is not tied to the request
+func (s *Server) requeue(messages []*queue.Message) {
+	for _, message := range messages {
+		if err := s.queueManager.RequeueMessage(context.Background(), message.QueueID, message); err != nil {
+			slog.Error("Requeueing unacked message failed", "queue", logging.QueueRef(message.QueueID), "error", err)
+		}
+	}
+}
+
+// acked stops every subscriber of a queue redelivering a message
+func (s *Server) acked(queueID, messageID string) {
+	s.wsMutex.RLock()
+	defer s.wsMutex.RUnlock()
+	for _, client := range s.wsConnections[queueID] {
+		client.acked(queueID, messageID)
+	}
+}
+
+// acquireConnection counts a new connection against its IP's limit
+func (s *Server) acquireConnection(ip string) bool {
+	s.wsMutex.Lock()
+	defer s.wsMutex.Unlock()
+	if s.wsMaxPerIP > 0 && s.wsPerIP[ip] >= s.wsMaxPerIP {
+		return false
+	}
+	s.wsPerIP[ip]++
+	return true
+}
+
+// releaseConnection returns a closed connection's slot
+func (s *Server) releaseConnection(ip string) {
+	s.wsMutex.Lock()
+	defer s.wsMutex.Unlock()
+	if s.wsPerIP[ip]--; s.wsPerIP[ip] <= 0 {
+		delete(s.wsPerIP, ip)
+	}
+}
+
+// register tracks a connection for server-wide broadcasts
+func (s *Server) register(client *wsClient) {
+	s.wsMutex.Lock()
+	defer s.wsMutex.Unlock()
+	s.wsClients[client] = struct{}{}
+}
+
+// unregister stops tracking a closed connection
+func (s *Server) unregister(client *wsClient) {
+	s.wsMutex.Lock()
+	defer s.wsMutex.Unlock()
+	delete(s.wsClients, client)
+}
+
+// broadcast sends a frame to every connected client, subscribed or not
+func (s *Server) broadcast(v interface{}) int {
+	s.wsMutex.RLock()
+	clients := make([]*wsClient, 0, len(s.wsClients))
+	for client := range s.wsClients {
+		clients = append(clients, client)
+	}
+	s.wsMutex.RUnlock()
+
+	sent := 0
+	for _, client := range clients {
+		if client.writeJSON(v) == nil {
+			sent++
+		}
+	}
+	return sent
+}
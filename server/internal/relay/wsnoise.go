@@ -0,0 +1,149 @@
+package relay
+
+import (
+	"errors"
+	"time"
+
+	"privmsg-relay/internal/noise"
+	"privmsg-relay/internal/queue"
+
+	"github.com/gorilla/websocket"
+)
+
+// Noise-encrypted WebSocket connections
+//
+// A client that cannot trust the TLS between itself and the relay (a CDN or
+// a reverse proxy terminates it) can offer queue.WSNoiseIKProtocol or
+// queue.WSNoiseXXProtocol. Right after the upgrade the client, as initiator,
+// runs the handshake in binary frames with empty payloads, using the
+// negotiated subprotocol as the prologue. The relay's static key is the
+// Montgomery form of its identity key, so a client that pins the identity
+// key can use IK; XX sends the key and lets the client check it
+//
+// Every frame after the handshake is one binary WebSocket message holding
+// the encryption of an opcode byte (1 text, 2 binary) followed by the frame,
+// as consecutive Noise messages of noise.MaxMessageSize, the last shorter.
+// Control frames (ping, pong, close) are sent in the clear
+
+// wsNoiseHandshakeWait bounds the whole handshake
+const wsNoiseHandshakeWait = 10 * time.Second
+
+var errNoiseFrame = errors.New("expected a binary Noise frame")
+
+// wsNoiseSession holds one connection's transport ciphers
+type wsNoiseSession struct {
+	send    *noise.CipherState // Used under wsClient.writeMu
+	receive *noise.CipherState // Used only by the read loop
+}
+
+// wsProtocols lists the subprotocols to offer, the Noise ones first when enabled
+func wsProtocols(withNoise bool) []string {
+	if !withNoise {
+		return queue.WSProtocols
+	}
+	return append([]string{queue.WSNoiseIKProtocol, queue.WSNoiseXXProtocol}, queue.WSProtocols...)
+}
+
+// noisePattern returns the handshake a negotiated subprotocol calls for, or
+// nil for a plaintext one
+func noisePattern(protocol string) *noise.Pattern {
+	switch protocol {
+	case queue.WSNoiseIKProtocol:
+		return noise.IK
+	case queue.WSNoiseXXProtocol:
+		return noise.XX
+	default:
+		return nil
+	}
+}
+
+// noiseHandshake answers the client's handshake before any other frame
+func (s *Server) noiseHandshake(conn *websocket.Conn, pattern *noise.Pattern, protocol string) (*wsNoiseSession, error) {
+	handshake, err := noise.NewHandshake(noise.Config{
+		Pattern:  pattern,
+		Prologue: []byte(protocol),
+		Static:   s.wsNoiseKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(wsNoiseHandshakeWait)
+	conn.SetReadDeadline(deadline)
+	conn.SetWriteDeadline(deadline)
+	for !handshake.Finished() {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if messageType != websocket.BinaryMessage {
+			return nil, errNoiseFrame
+		}
+		if _, err := handshake.ReadMessage(data); err != nil {
+			return nil, err
+		}
+		if handshake.Finished() {
+			break
+		}
+
+		reply, err := handshake.WriteMessage(nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, reply); err != nil {
+			return nil, err
+		}
+	}
+
+	send, receive, err := handshake.Split()
+	if err != nil {
+		return nil, err
+	}
+	return &wsNoiseSession{send: send, receive: receive}, nil
+}
+
+// seal encrypts one frame into the body of a binary WebSocket message
+func (n *wsNoiseSession) seal(messageType int, data []byte) ([]byte, error) {
+	plaintext := append([]byte{byte(messageType)}, data...)
+	chunks := (len(plaintext) + noise.MaxPlaintext - 1) / noise.MaxPlaintext
+	out := make([]byte, 0, len(plaintext)+chunks*noise.TagSize)
+	for len(plaintext) > 0 {
+		chunk := plaintext[:min(len(plaintext), noise.MaxPlaintext)]
+		var err error
+		if out, err = n.send.Encrypt(out, nil, chunk); err != nil {
+			return nil, err
+		}
+		plaintext = plaintext[len(chunk):]
+	}
+	return out, nil
+}
+
+// open decrypts a binary WebSocket message and returns the frame inside
+func (n *wsNoiseSession) open(message []byte) ([]byte, error) {
+	var plaintext []byte
+	for len(message) > 0 {
+		chunk := message[:min(len(message), noise.MaxMessageSize)]
+		var err error
+		if plaintext, err = n.receive.Decrypt(plaintext, nil, chunk); err != nil {
+			return nil, err
+		}
+		message = message[len(chunk):]
+	}
+	if len(plaintext) == 0 {
+		return nil, errNoiseFrame
+	}
+	return plaintext[1:], nil
+}
+
+// read returns the next frame from the client, decrypted on Noise
+// connections; only the read loop calls it
+func (c *wsClient) read() ([]byte, error) {
+	messageType, data, err := c.conn.ReadMessage()
+	if err != nil || c.noise == nil {
+		return data, err
+	}
+	if messageType != websocket.BinaryMessage {
+		return nil, errNoiseFrame
+	}
+	return c.noise.open(data)
+}
@@ -0,0 +1,189 @@
+//go:build !minimal
+
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// awsClient calls the Secrets Manager and KMS JSON APIs with SigV4-signed requests
+type awsClient struct {
+	opts   AWSOptions
+	client *http.Client
+}
+
+func newAWSClient(opts AWSOptions) (*awsClient, error) {
+	if opts.AccessKey == "" || opts.SecretKey == "" {
+		return nil, errors.New("AWS needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return &awsClient{opts: opts, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// regionOf returns the region an ARN names, or the configured one
+func (a *awsClient) regionOf(id string) string {
+	if parts := strings.SplitN(id, ":", 6); len(parts) == 6 && parts[0] == "arn" && parts[3] != "" {
+		return parts[3]
+	}
+	return a.opts.Region
+}
+
+// call invokes one action of a JSON API, e.g. service "kms" and target
+// "TrentService.Encrypt"
+func (a *awsClient) call(ctx context.Context, service, region, target string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("https://%s.%s.amazonaws.com/", service, region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	a.sign(req, body, service, region, time.Now().UTC())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("AWS request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("AWS %s returned %s: %s", target, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// sign adds AWS Signature Version 4 headers to req
+func (a *awsClient) sign(req *http.Request, body []byte, service, region string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if a.opts.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.opts.SessionToken)
+	}
+
+	names := []string{"content-type", "host", "x-amz-date"}
+	if a.opts.SessionToken != "" {
+		names = append(names, "x-amz-security-token")
+	}
+	names = append(names, "x-amz-target")
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		"", // No query string
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+a.opts.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.opts.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+// secret returns a Secrets Manager secret, or one field of a JSON secret
+func (a *awsClient) secret(ctx context.Context, id, field string) (string, error) {
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := a.call(ctx, "secretsmanager", a.regionOf(id), "secretsmanager.GetSecretValue", map[string]string{"SecretId": id}, &out); err != nil {
+		return "", err
+	}
+	if field == "" {
+		return out.SecretString, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(out.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object", id)
+	}
+	return fieldValue(fields, field)
+}
+
+// KMSKey wraps data keys with an AWS KMS key, which never leaves KMS
+type KMSKey struct {
+	aws   *awsClient
+	keyID string
+}
+
+func (a *awsClient) kmsKey(keyID string) *KMSKey {
+	return &KMSKey{aws: a, keyID: keyID}
+}
+
+// ID implements atrest.KeyWrapper
+func (k *KMSKey) ID() string {
+	return "awskms:" + k.keyID
+}
+
+// Wrap implements atrest.KeyWrapper
+func (k *KMSKey) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	var out struct {
+		CiphertextBlob []byte `json:"CiphertextBlob"`
+	}
+	in := map[string]interface{}{"KeyId": k.keyID, "Plaintext": dataKey}
+	if err := k.aws.call(ctx, "kms", k.aws.regionOf(k.keyID), "TrentService.Encrypt", in, &out); err != nil {
+		return nil, err
+	}
+	return out.CiphertextBlob, nil
+}
+
+// Unwrap implements atrest.KeyWrapper
+func (k *KMSKey) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var out struct {
+		Plaintext []byte `json:"Plaintext"`
+	}
+	in := map[string]interface{}{"KeyId": k.keyID, "CiphertextBlob": wrapped}
+	if err := k.aws.call(ctx, "kms", k.aws.regionOf(k.keyID), "TrentService.Decrypt", in, &out); err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
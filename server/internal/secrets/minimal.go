@@ -0,0 +1,34 @@
+//go:build minimal
+
+package secrets
+
+import (
+	"context"
+	"time"
+
+	"privmsg-relay/internal/atrest"
+)
+
+// Minimal builds resolve plain values only; configuring a store fails startup
+type vaultClient struct{}
+type awsClient struct{}
+
+func newVaultClient(ctx context.Context, opts VaultOptions) (*vaultClient, error) {
+	return nil, ErrNotIncluded
+}
+
+func newAWSClient(opts AWSOptions) (*awsClient, error) {
+	return nil, ErrNotIncluded
+}
+
+func (v *vaultClient) read(ctx context.Context, path, field string) (string, error) {
+	return "", ErrNotIncluded
+}
+func (v *vaultClient) renewAt() time.Time                              { return time.Time{} }
+func (v *vaultClient) renew(ctx context.Context) error                 { return ErrNotIncluded }
+func (v *vaultClient) transitKey(mount, name string) atrest.KeyWrapper { return nil }
+
+func (a *awsClient) secret(ctx context.Context, id, field string) (string, error) {
+	return "", ErrNotIncluded
+}
+func (a *awsClient) kmsKey(keyID string) atrest.KeyWrapper { return nil }
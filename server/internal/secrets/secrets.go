@@ -0,0 +1,323 @@
+// Package secrets fetches settings that hold secrets from HashiCorp Vault
+// or AWS instead of plaintext environment variables
+//
+// A setting that takes a secret, or the path of a file holding one, may
+// name where to fetch it instead:
+//
+//	vault://secret/data/relay#redis_password   field of a Vault KV (v1 or v2) secret
+//	awssm://prod/relay#redis_password          AWS Secrets Manager secret, a JSON field or (without #) the whole string
+//
+// Key-encryption keys for encryption at rest can stay inside the service,
+// which then wraps and unwraps data keys itself:
+//
+//	vault-transit://relay-at-rest              Vault transit key (mount/name, mount defaults to transit)
+//	awskms://arn:aws:kms:eu-central-1:...      AWS KMS key ID, alias or ARN
+//
+// Fetched values are re-read periodically, and the Vault token is renewed
+// before it expires.
+package secrets
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"privmsg-relay/internal/atrest"
+)
+
+var ErrNotIncluded = errors.New("secret stores not included in this build (built with -tags minimal)")
+
+// Reference schemes
+const (
+	schemeVault        = "vault://"
+	schemeAWSSecrets   = "awssm://"
+	schemeVaultTransit = "vault-transit://"
+	schemeAWSKMS       = "awskms://"
+)
+
+// Options configures the secret stores references may name
+type Options struct {
+	Vault VaultOptions
+	AWS   AWSOptions
+}
+
+// VaultOptions configures the Vault client (Addr empty = Vault disabled)
+type VaultOptions struct {
+	Addr      string // e.g. https://vault.internal:8200
+	Token     string // Static token
+	TokenFile string // Token file, e.g. a Vault Agent sink; re-read on renewal
+	RoleID    string // AppRole login instead of a token
+	SecretID  string
+	Namespace string // Vault Enterprise namespace
+}
+
+// AWSOptions configures the AWS client (Region empty = AWS disabled)
+type AWSOptions struct {
+	Region       string // For secret and key IDs that are not ARNs
+	AccessKey    string
+	SecretKey    string
+	SessionToken string // For temporary credentials
+}
+
+// IsReference reports whether a setting names a secret store rather than
+// holding the value (or file path) itself
+func IsReference(value string) bool {
+	for _, scheme := range []string{schemeVault, schemeAWSSecrets, schemeVaultTransit, schemeAWSKMS} {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitReference splits "scheme://path#field" into path and field
+func splitReference(value, scheme string) (path, field string) {
+	path = strings.TrimPrefix(value, scheme)
+	if i := strings.LastIndex(path, "#"); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+// Resolver fetches references and keeps their values current
+type Resolver struct {
+	vault *vaultClient
+	aws   *awsClient
+
+	mu       sync.RWMutex
+	values   map[string]string // Last value fetched for each reference
+	watchers []func()
+}
+
+// New connects to the configured secret stores; with none configured the
+// resolver only passes plain values through
+func New(ctx context.Context, opts Options) (*Resolver, error) {
+	r := &Resolver{values: make(map[string]string)}
+	if opts.Vault.Addr != "" {
+		vault, err := newVaultClient(ctx, opts.Vault)
+		if err != nil {
+			return nil, err
+		}
+		r.vault = vault
+	}
+	if opts.AWS.Region != "" {
+		aws, err := newAWSClient(opts.AWS)
+		if err != nil {
+			return nil, err
+		}
+		r.aws = aws
+	}
+	return r, nil
+}
+
+// Resolve returns a setting's value, fetching it if it is a reference
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+	secret, err := r.fetch(ctx, value)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	r.values[value] = secret
+	r.mu.Unlock()
+	return secret, nil
+}
+
+// Value returns the latest value of a reference passed to Resolve
+func (r *Resolver) Value(ref string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.values[ref]
+}
+
+// Watch calls fn after a refresh changed any value
+func (r *Resolver) Watch(fn func()) {
+	r.mu.Lock()
+	r.watchers = append(r.watchers, fn)
+	r.mu.Unlock()
+}
+
+// fetch reads one reference from its store
+func (r *Resolver) fetch(ctx context.Context, ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, schemeVault):
+		if r.vault == nil {
+			return "", fmt.Errorf("%s needs VAULT_ADDR", schemeVault)
+		}
+		path, field := splitReference(ref, schemeVault)
+		return r.vault.read(ctx, path, field)
+	case strings.HasPrefix(ref, schemeAWSSecrets):
+		if r.aws == nil {
+			return "", fmt.Errorf("%s needs AWS_REGION", schemeAWSSecrets)
+		}
+		id, field := splitReference(ref, schemeAWSSecrets)
+		return r.aws.secret(ctx, id, field)
+	}
+	return "", fmt.Errorf("%s names a key, not a secret", strings.SplitN(ref, "://", 2)[0])
+}
+
+// KeyWrapper returns the at-rest key-encryption key a setting names: a
+// Vault transit or AWS KMS key, a key fetched from a secret store, or a
+// key file
+func (r *Resolver) KeyWrapper(ctx context.Context, value string) (atrest.KeyWrapper, error) {
+	switch {
+	case strings.HasPrefix(value, schemeVaultTransit):
+		if r.vault == nil {
+			return nil, fmt.Errorf("%s needs VAULT_ADDR", schemeVaultTransit)
+		}
+		name := strings.TrimPrefix(value, schemeVaultTransit)
+		mount := "transit"
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			mount, name = name[:i], name[i+1:]
+		}
+		return r.vault.transitKey(mount, name), nil
+	case strings.HasPrefix(value, schemeAWSKMS):
+		if r.aws == nil {
+			return nil, fmt.Errorf("%s needs AWS_REGION", schemeAWSKMS)
+		}
+		return r.aws.kmsKey(strings.TrimPrefix(value, schemeAWSKMS)), nil
+	case IsReference(value):
+		// Read once: a new key needs a restart with the old one listed as previous
+		encoded, err := r.fetch(ctx, value)
+		if err != nil {
+			return nil, err
+		}
+		return atrest.ParseFileKey(encoded)
+	}
+	return atrest.LoadFileKey(value)
+}
+
+// Refresh re-reads every reference passed to Resolve; values that cannot
+// be read keep their last value
+func (r *Resolver) Refresh(ctx context.Context) error {
+	r.mu.RLock()
+	refs := make([]string, 0, len(r.values))
+	for ref := range r.values {
+		refs = append(refs, ref)
+	}
+	r.mu.RUnlock()
+
+	var errs []error
+	changed := false
+	for _, ref := range refs {
+		secret, err := r.fetch(ctx, ref)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ref, err))
+			continue
+		}
+		r.mu.Lock()
+		if r.values[ref] != secret {
+			r.values[ref] = secret
+			changed = true
+			slog.Info("Secret changed", "ref", ref)
+		}
+		r.mu.Unlock()
+	}
+
+	if changed {
+		r.mu.RLock()
+		watchers := append([]func(){}, r.watchers...)
+		r.mu.RUnlock()
+		for _, fn := range watchers {
+			fn()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run renews the Vault token when due and refreshes values every interval
+// until ctx is done
+func (r *Resolver) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	nextRefresh := time.Now().Add(interval)
+	for {
+		wake := nextRefresh
+		if r.vault != nil {
+			if renewAt := r.vault.renewAt(); !renewAt.IsZero() && renewAt.Before(wake) {
+				wake = renewAt
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(wake)):
+		}
+
+		if r.vault != nil {
+			if renewAt := r.vault.renewAt(); !renewAt.IsZero() && !time.Now().Before(renewAt) {
+				if err := r.vault.renew(ctx); err != nil {
+					slog.Error("Failed to renew Vault token", "error", err)
+				}
+			}
+		}
+		if !time.Now().Before(nextRefresh) {
+			if err := r.Refresh(ctx); err != nil {
+				slog.Error("Failed to refresh secrets", "error", err)
+			}
+			nextRefresh = time.Now().Add(interval)
+		}
+	}
+}
+
+// Certificate is a TLS certificate whose PEM chain and key are fetched from
+// references and reloaded when they change
+type Certificate struct {
+	resolver *Resolver
+	certRef  string
+	keyRef   string
+	current  atomic.Pointer[tls.Certificate]
+}
+
+// Certificate fetches a certificate chain and private key
+func (r *Resolver) Certificate(ctx context.Context, certRef, keyRef string) (*Certificate, error) {
+	if !IsReference(certRef) || !IsReference(keyRef) {
+		return nil, errors.New("the certificate and the key must both be secret references")
+	}
+	if _, err := r.Resolve(ctx, certRef); err != nil {
+		return nil, err
+	}
+	if _, err := r.Resolve(ctx, keyRef); err != nil {
+		return nil, err
+	}
+
+	c := &Certificate{resolver: r, certRef: certRef, keyRef: keyRef}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	r.Watch(func() {
+		if err := c.reload(); err != nil {
+			slog.Error("Failed to reload TLS certificate", "error", err)
+		}
+	})
+	return c, nil
+}
+
+// reload parses the latest values, keeping the old certificate on error
+func (c *Certificate) reload() error {
+	cert, err := tls.X509KeyPair([]byte(c.resolver.Value(c.certRef)), []byte(c.resolver.Value(c.keyRef)))
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+	if old := c.current.Load(); old != nil && string(old.Certificate[0]) == string(cert.Certificate[0]) {
+		return nil
+	}
+	c.current.Store(&cert)
+	slog.Info("Loaded TLS certificate", "ref", c.certRef)
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.current.Load(), nil
+}
@@ -0,0 +1,300 @@
+//go:build !minimal
+
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vaultClient talks to the Vault HTTP API with a token it keeps alive
+type vaultClient struct {
+	addr   *url.URL
+	opts   VaultOptions
+	client *http.Client
+
+	mu        sync.RWMutex
+	token     string
+	ttl       time.Duration // Zero for tokens that never expire
+	renewable bool
+	obtained  time.Time
+}
+
+// vaultResponse is the envelope of every Vault API response
+type vaultResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Auth   *vaultAuth      `json:"auth"`
+	Errors []string        `json:"errors"`
+}
+
+type vaultAuth struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int64  `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+}
+
+func newVaultClient(ctx context.Context, opts VaultOptions) (*vaultClient, error) {
+	addr, err := url.Parse(opts.Addr)
+	if err != nil || addr.Host == "" {
+		return nil, fmt.Errorf("invalid Vault address %q", opts.Addr)
+	}
+	v := &vaultClient{addr: addr, opts: opts, client: &http.Client{Timeout: 30 * time.Second}}
+
+	switch {
+	case opts.RoleID != "":
+		err = v.login(ctx)
+	case opts.TokenFile != "":
+		err = v.readTokenFile(ctx)
+	case opts.Token != "":
+		v.token = opts.Token
+		err = v.lookupSelf(ctx)
+	default:
+		err = errors.New("Vault needs VAULT_TOKEN, VAULT_TOKEN_FILE or VAULT_ROLE_ID")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// do sends one API request and decodes the envelope
+func (v *vaultClient) do(ctx context.Context, method, path string, body interface{}) (*vaultResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	u := *v.addr
+	u.Path = strings.TrimRight(u.Path, "/") + "/v1/" + strings.TrimLeft(path, "/")
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	v.mu.RLock()
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	v.mu.RUnlock()
+	if v.opts.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.opts.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out vaultResponse
+	decodeErr := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&out)
+	if resp.StatusCode != http.StatusOK {
+		if len(out.Errors) > 0 {
+			return nil, fmt.Errorf("Vault returned %s: %s", resp.Status, strings.Join(out.Errors, "; "))
+		}
+		return nil, fmt.Errorf("Vault returned %s", resp.Status)
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to parse Vault response: %w", decodeErr)
+	}
+	return &out, nil
+}
+
+// setAuth takes the token a login or renewal handed out
+func (v *vaultClient) setAuth(auth *vaultAuth) error {
+	if auth == nil || auth.ClientToken == "" {
+		return errors.New("Vault response carries no token")
+	}
+	v.mu.Lock()
+	v.token = auth.ClientToken
+	v.ttl = time.Duration(auth.LeaseDuration) * time.Second
+	v.renewable = auth.Renewable
+	v.obtained = time.Now()
+	v.mu.Unlock()
+	return nil
+}
+
+// login exchanges the AppRole credentials for a token
+func (v *vaultClient) login(ctx context.Context) error {
+	resp, err := v.do(ctx, http.MethodPost, "auth/approle/login", map[string]string{
+		"role_id":   v.opts.RoleID,
+		"secret_id": v.opts.SecretID,
+	})
+	if err != nil {
+		return fmt.Errorf("Vault AppRole login failed: %w", err)
+	}
+	return v.setAuth(resp.Auth)
+}
+
+// readTokenFile picks up the token in TokenFile, which an agent may have replaced
+func (v *vaultClient) readTokenFile(ctx context.Context) error {
+	data, err := os.ReadFile(v.opts.TokenFile)
+	if err != nil {
+		return fmt.Errorf("failed to read Vault token: %w", err)
+	}
+	v.mu.Lock()
+	v.token = strings.TrimSpace(string(data))
+	v.mu.Unlock()
+	return v.lookupSelf(ctx)
+}
+
+// lookupSelf learns how long a token handed to us lives
+func (v *vaultClient) lookupSelf(ctx context.Context) error {
+	resp, err := v.do(ctx, http.MethodGet, "auth/token/lookup-self", nil)
+	if err != nil {
+		return fmt.Errorf("Vault token lookup failed: %w", err)
+	}
+	var data struct {
+		TTL       int64 `json:"ttl"`
+		Renewable bool  `json:"renewable"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return fmt.Errorf("failed to parse Vault token lookup: %w", err)
+	}
+	v.mu.Lock()
+	v.ttl = time.Duration(data.TTL) * time.Second
+	v.renewable = data.Renewable
+	v.obtained = time.Now()
+	v.mu.Unlock()
+	return nil
+}
+
+// renewAt returns when the token should be renewed (zero = never)
+func (v *vaultClient) renewAt() time.Time {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.ttl <= 0 {
+		return time.Time{}
+	}
+	return v.obtained.Add(v.ttl / 2)
+}
+
+// renew extends the token, or gets a new one once it can't be extended
+func (v *vaultClient) renew(ctx context.Context) error {
+	if v.opts.TokenFile != "" {
+		return v.readTokenFile(ctx) // The agent renews it
+	}
+
+	v.mu.RLock()
+	renewable := v.renewable
+	v.mu.RUnlock()
+	if renewable {
+		resp, err := v.do(ctx, http.MethodPost, "auth/token/renew-self", map[string]string{})
+		if err == nil {
+			return v.setAuth(resp.Auth)
+		}
+		if v.opts.RoleID == "" {
+			return err
+		}
+	}
+	if v.opts.RoleID != "" {
+		return v.login(ctx)
+	}
+	return errors.New("Vault token is not renewable and will expire")
+}
+
+// read returns one field of a KV secret
+func (v *vaultClient) read(ctx context.Context, path, field string) (string, error) {
+	if field == "" {
+		return "", fmt.Errorf("vault reference %s needs a #field", path)
+	}
+	resp, err := v.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return "", err
+	}
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return "", fmt.Errorf("failed to parse Vault secret: %w", err)
+	}
+
+	// KV v2 nests the fields under data, next to metadata
+	if inner, ok := data["data"]; ok {
+		if _, ok := data["metadata"]; ok {
+			data = nil
+			if err := json.Unmarshal(inner, &data); err != nil {
+				return "", fmt.Errorf("failed to parse Vault secret: %w", err)
+			}
+		}
+	}
+	return fieldValue(data, field)
+}
+
+// fieldValue returns a JSON field as a string: strings as they are, other
+// values as JSON
+func fieldValue(fields map[string]json.RawMessage, field string) (string, error) {
+	raw, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("secret has no field %q", field)
+	}
+	var value string
+	if json.Unmarshal(raw, &value) == nil {
+		return value, nil
+	}
+	return string(raw), nil
+}
+
+// TransitKey wraps data keys with a Vault transit key, which never leaves Vault
+type TransitKey struct {
+	vault *vaultClient
+	mount string
+	name  string
+}
+
+func (v *vaultClient) transitKey(mount, name string) *TransitKey {
+	return &TransitKey{vault: v, mount: mount, name: name}
+}
+
+// ID implements atrest.KeyWrapper
+func (k *TransitKey) ID() string {
+	return "vault-transit:" + k.mount + "/" + k.name
+}
+
+// Wrap implements atrest.KeyWrapper
+func (k *TransitKey) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	resp, err := k.vault.do(ctx, http.MethodPost, k.mount+"/encrypt/"+k.name, map[string]string{
+		"plaintext": base64.StdEncoding.EncodeToString(dataKey),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil || data.Ciphertext == "" {
+		return nil, errors.New("Vault returned no ciphertext")
+	}
+	return []byte(data.Ciphertext), nil
+}
+
+// Unwrap implements atrest.KeyWrapper
+func (k *TransitKey) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	resp, err := k.vault.do(ctx, http.MethodPost, k.mount+"/decrypt/"+k.name, map[string]string{
+		"ciphertext": string(wrapped),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		Plaintext string `json:"plaintext"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return nil, errors.New("Vault returned no plaintext")
+	}
+	return base64.StdEncoding.DecodeString(data.Plaintext)
+}
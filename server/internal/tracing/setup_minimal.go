@@ -0,0 +1,19 @@
+//go:build minimal
+
+package tracing
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Setup always fails in minimal builds
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	return nil, ErrNotIncluded
+}
+
+// InstrumentRedis is never reached because Setup fails
+func InstrumentRedis(client *redis.Client) error {
+	return ErrNotIncluded
+}
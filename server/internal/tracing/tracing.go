@@ -0,0 +1,16 @@
+// Package tracing exports OpenTelemetry spans over OTLP/HTTP
+//
+// Spans carry route patterns, never raw paths, queue IDs or client addresses
+package tracing
+
+import "errors"
+
+// ErrNotIncluded is returned by Setup in builds without tracing
+var ErrNotIncluded = errors.New("tracing not included in this build (built with -tags minimal)")
+
+// Options configures the exporter
+type Options struct {
+	Endpoint    string  // OTLP/HTTP collector URL, e.g. http://otel-collector:4318
+	SampleRatio float64 // Fraction of new traces recorded (0-1); sampled parents are always followed
+	ServiceName string
+}
@@ -0,0 +1,205 @@
+// Package transparency holds the Merkle tree math of the relay's key
+// transparency log
+//
+// The log follows RFC 6962 (Certificate Transparency): a leaf hashes as
+// SHA-256(0x00 || entry) and an interior node as SHA-256(0x01 || left ||
+// right), and a tree of n leaves splits at the largest power of two below
+// n. Clients check that a key they were handed is in the log with an
+// inclusion proof, and that the log only ever grew with a consistency
+// proof between two signed tree heads. Comparing tree heads with other
+// clients (gossip) shows whether the relay keeps one log for everyone or
+// shows some users a different one.
+package transparency
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/bits"
+	"time"
+)
+
+// ErrInvalidTreeHead is returned for a tree head whose signature does not verify
+var ErrInvalidTreeHead = errors.New("invalid signed tree head")
+
+// HashSize is the size of every hash in the log
+const HashSize = sha256.Size
+
+// Hash is a leaf or node hash
+type Hash [HashSize]byte
+
+// MarshalJSON encodes a hash as base64, like other binary fields
+func (h Hash) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h[:])
+}
+
+// UnmarshalJSON decodes a base64 hash
+func (h *Hash) UnmarshalJSON(data []byte) error {
+	var raw []byte
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) != HashSize {
+		return errors.New("hash must be 32 bytes")
+	}
+	copy(h[:], raw)
+	return nil
+}
+
+// LeafHash hashes one log entry
+func LeafHash(entry []byte) Hash {
+	hash := sha256.New()
+	hash.Write([]byte{0x00})
+	hash.Write(entry)
+	var out Hash
+	hash.Sum(out[:0])
+	return out
+}
+
+// NodeHash hashes two subtrees
+func NodeHash(left, right Hash) Hash {
+	hash := sha256.New()
+	hash.Write([]byte{0x01})
+	hash.Write(left[:])
+	hash.Write(right[:])
+	var out Hash
+	hash.Sum(out[:0])
+	return out
+}
+
+// EmptyRoot is the root of a tree with no leaves
+var EmptyRoot = Hash(sha256.Sum256(nil))
+
+// Split returns the size of the left subtree of a tree of n > 1 leaves:
+// the largest power of two smaller than n
+func Split(n int64) int64 {
+	return 1 << (bits.Len64(uint64(n-1)) - 1)
+}
+
+// SubjectServer names the entries holding the relay's own identity keys
+const SubjectServer = "server"
+
+// QueueSubject names a queue's entries without publishing its ID; anyone
+// who knows the ID can compute it
+func QueueSubject(queueID string) string {
+	sum := sha256.Sum256([]byte("privmsg-kt-v1:" + queueID))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidSubject reports whether subject is SubjectServer or a QueueSubject
+func ValidSubject(subject string) bool {
+	if subject == SubjectServer {
+		return true
+	}
+	raw, err := hex.DecodeString(subject)
+	return err == nil && len(raw) == sha256.Size && subject == hex.EncodeToString(raw)
+}
+
+// TreeHead is the statement a signed tree head carries
+type TreeHead struct {
+	TreeSize  int64     `json:"tree_size"`
+	RootHash  Hash      `json:"root_hash"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// SignedTreeHead carries the TreeHead JSON exactly as signed
+// Clients verify Signature over Payload with the pinned relay key, then parse Payload
+type SignedTreeHead struct {
+	Payload   []byte `json:"payload"`   // JSON-encoded TreeHead
+	Signature []byte `json:"signature"` // Ed25519 over Payload
+	KeyID     string `json:"key_id"`
+}
+
+// Sign produces a signed tree head
+func Sign(key ed25519.PrivateKey, head TreeHead, keyID string) (*SignedTreeHead, error) {
+	payload, err := json.Marshal(head)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedTreeHead{Payload: payload, Signature: ed25519.Sign(key, payload), KeyID: keyID}, nil
+}
+
+// Open verifies a signed tree head and returns its statement
+func (s *SignedTreeHead) Open(pub ed25519.PublicKey) (*TreeHead, error) {
+	if len(pub) != ed25519.PublicKeySize || !ed25519.Verify(pub, s.Payload, s.Signature) {
+		return nil, ErrInvalidTreeHead
+	}
+	var head TreeHead
+	if err := json.Unmarshal(s.Payload, &head); err != nil || head.TreeSize < 0 {
+		return nil, ErrInvalidTreeHead
+	}
+	return &head, nil
+}
+
+// VerifyInclusion checks an inclusion proof for the leaf at index in a
+// tree of size leaves with the given root (RFC 9162, section 2.1.3.2)
+func VerifyInclusion(leaf Hash, index, size int64, proof []Hash, root Hash) bool {
+	if index < 0 || index >= size {
+		return false
+	}
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range proof {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = NodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = NodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && r == root
+}
+
+// VerifyConsistency checks that the tree of second leaves with root
+// secondRoot extends the tree of first leaves with root firstRoot
+// (RFC 9162, section 2.1.4.2)
+func VerifyConsistency(first, second int64, firstRoot, secondRoot Hash, proof []Hash) bool {
+	switch {
+	case first < 0 || first > second:
+		return false
+	case first == second:
+		return len(proof) == 0 && firstRoot == secondRoot
+	case first == 0:
+		return len(proof) == 0
+	case len(proof) == 0:
+		return false
+	}
+
+	if first&(first-1) == 0 {
+		proof = append([]Hash{firstRoot}, proof...)
+	}
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = NodeHash(c, fr)
+			sr = NodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = NodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && fr == firstRoot && sr == secondRoot
+}
@@ -0,0 +1,203 @@
+// Package webhook posts new messages to the HTTPS endpoints queue owners
+// register, so bots can receive without polling or holding a WebSocket
+//
+// The payload is forwarded exactly as stored (still end-to-end encrypted)
+// and signed per the Standard Webhooks spec: Webhook-Signature is
+// "v1,<base64 HMAC-SHA256>" over "<Webhook-Id>.<Webhook-Timestamp>.<body>",
+// keyed with the base64 part of the queue's whsec_ secret
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"privmsg-relay/internal/egress"
+	"privmsg-relay/internal/logging"
+	"privmsg-relay/internal/queue"
+)
+
+// retrySchedule is the wait before each retry of a failed delivery; a
+// message still undelivered after the last one stays in the queue for the
+// owner to receive another way
+var retrySchedule = []time.Duration{
+	10 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	6 * time.Hour,
+}
+
+const (
+	pollInterval    = time.Second
+	deliveryTimeout = 10 * time.Second
+)
+
+// Options tunes the dispatcher
+type Options struct {
+	Workers     int // Concurrent deliveries per replica (default 8)
+	MaxFailures int // Failed attempts in a row before a webhook is disabled (default 20)
+}
+
+// Dispatcher delivers scheduled webhook posts
+// Every replica may run one; deliveries are claimed in Redis, so each is
+// attempted once
+type Dispatcher struct {
+	manager     *queue.Manager
+	client      *http.Client
+	policy      *egress.Policy
+	workers     int
+	maxFailures int
+}
+
+// NewDispatcher creates a dispatcher posting through client, which should
+// be an egress client enforcing policy
+func NewDispatcher(manager *queue.Manager, client *http.Client, policy *egress.Policy, opts Options) *Dispatcher {
+	if opts.Workers <= 0 {
+		opts.Workers = 8
+	}
+	if opts.MaxFailures <= 0 {
+		opts.MaxFailures = 20
+	}
+	return &Dispatcher{
+		manager:     manager,
+		client:      client,
+		policy:      policy,
+		workers:     opts.Workers,
+		maxFailures: opts.MaxFailures,
+	}
+}
+
+// ValidateURL checks a webhook URL against the egress policy before it is stored
+func (d *Dispatcher) ValidateURL(rawURL string) error {
+	_, err := d.policy.ValidateURL(rawURL)
+	return err
+}
+
+// Run delivers due posts until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	slots := make(chan struct{}, d.workers)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Claim only what the free workers can start now
+		free := cap(slots) - len(slots)
+		if free == 0 {
+			continue
+		}
+		due, err := d.manager.DueWebhooks(ctx, free)
+		if err != nil {
+			slog.Error("Loading due webhooks failed", "error", err)
+		}
+		for _, delivery := range due {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(delivery queue.WebhookDelivery) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				d.deliver(ctx, delivery)
+			}(delivery)
+		}
+	}
+}
+
+// deliver makes one attempt and schedules the retry if it fails
+func (d *Dispatcher) deliver(ctx context.Context, delivery queue.WebhookDelivery) {
+	hook, message, err := d.manager.WebhookTarget(ctx, delivery)
+	if err != nil {
+		if !errors.Is(err, queue.ErrNoWebhook) && !errors.Is(err, queue.ErrMessageNotFound) && !errors.Is(err, queue.ErrQueueNotFound) {
+			slog.Error("Loading webhook delivery failed", "queue", logging.QueueRef(delivery.QueueID), "error", err)
+		}
+		return // Nothing left to deliver
+	}
+
+	err = d.post(ctx, hook, message)
+	if err == nil {
+		d.manager.WebhookSucceeded(ctx, delivery)
+		return
+	}
+
+	disabled, recordErr := d.manager.WebhookFailed(ctx, delivery, err.Error(), d.maxFailures)
+	if recordErr != nil {
+		slog.Error("Recording webhook failure failed", "queue", logging.QueueRef(delivery.QueueID), "error", recordErr)
+		return
+	}
+	if disabled {
+		slog.Warn("Webhook disabled after repeated failures", "queue", logging.QueueRef(delivery.QueueID), "failures", d.maxFailures)
+		return
+	}
+	if delivery.Attempt < len(retrySchedule) {
+		if err := d.manager.RetryWebhook(ctx, delivery, time.Now().Add(retrySchedule[delivery.Attempt])); err != nil {
+			slog.Error("Scheduling webhook retry failed", "queue", logging.QueueRef(delivery.QueueID), "error", err)
+		}
+	}
+}
+
+// post sends the message; any 2xx response counts as delivered
+func (d *Dispatcher) post(ctx context.Context, hook *queue.Webhook, message *queue.Message) error {
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+
+	timestamp := time.Now()
+	signature, err := Sign(hook.Secret, message.ID, timestamp, message.Payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(message.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("User-Agent", "privmsg-relay-webhook")
+	req.Header.Set("Webhook-Id", message.ID)
+	req.Header.Set("Webhook-Timestamp", strconv.FormatInt(timestamp.Unix(), 10))
+	req.Header.Set("Webhook-Signature", signature)
+	req.Header.Set("Relay-Queue-Id", message.QueueID)
+	req.Header.Set("Relay-Seq", strconv.FormatInt(message.Seq, 10))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024)) // Lets the connection be reused
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign computes the Webhook-Signature header for a post
+func Sign(secret, id string, timestamp time.Time, body []byte) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, queue.WebhookSecretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook secret: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s.%d.", id, timestamp.Unix())
+	mac.Write(body)
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,311 @@
+package wirefmt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+	"unicode/utf8"
+)
+
+// CBOR major types (RFC 8949)
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+// CBOR tags for timestamps
+const (
+	cborTagDateTime = 0 // RFC 3339 text
+	cborTagEpoch    = 1 // Seconds since the epoch
+)
+
+// MarshalCBOR encodes v as CBOR with shortest-form lengths and integers
+func MarshalCBOR(v interface{}) ([]byte, error) {
+	tree, err := toTree(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := encodeCBOR(&buf, tree); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalCBOR decodes CBOR into v (a pointer) with JSON field rules
+// Byte strings fill []byte fields; tag 0 and tag 1 fill time.Time fields
+func UnmarshalCBOR(data []byte, v interface{}) error {
+	d := cborDecoder{data: data}
+	tree, err := d.value(0)
+	if err != nil {
+		return err
+	}
+	if len(d.data) != 0 {
+		return fmt.Errorf("%w: trailing data", ErrMalformed)
+	}
+	return assign(tree, v)
+}
+
+func encodeCBOR(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(cborSimple<<5 | 22)
+	case bool:
+		if v {
+			buf.WriteByte(cborSimple<<5 | 21)
+		} else {
+			buf.WriteByte(cborSimple<<5 | 20)
+		}
+	case int64:
+		if v >= 0 {
+			writeCBORHead(buf, cborUint, uint64(v))
+		} else {
+			writeCBORHead(buf, cborNegInt, uint64(-1-v))
+		}
+	case uint64:
+		writeCBORHead(buf, cborUint, v)
+	case float64:
+		buf.WriteByte(cborSimple<<5 | 27)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case string:
+		writeCBORHead(buf, cborText, uint64(len(v)))
+		buf.WriteString(v)
+	case []byte:
+		writeCBORHead(buf, cborBytes, uint64(len(v)))
+		buf.Write(v)
+	case time.Time:
+		writeCBORHead(buf, cborTag, cborTagDateTime)
+		return encodeCBOR(buf, v.UTC().Format(time.RFC3339Nano))
+	case []interface{}:
+		writeCBORHead(buf, cborArray, uint64(len(v)))
+		for _, item := range v {
+			if err := encodeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case object:
+		writeCBORHead(buf, cborMap, uint64(len(v)))
+		for _, m := range v {
+			encodeCBOR(buf, m.key)
+			if err := encodeCBOR(buf, m.value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%w: %T", errUnsupported, v)
+	}
+	return nil
+}
+
+// writeCBORHead writes a major type and argument in shortest form
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+// cborDecoder reads definite-length CBOR; indefinite lengths are rejected
+type cborDecoder struct {
+	data []byte
+}
+
+func (d *cborDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)) {
+		return nil, fmt.Errorf("%w: truncated", ErrMalformed)
+	}
+	out := d.data[:n]
+	d.data = d.data[n:]
+	return out, nil
+}
+
+// head reads a major type, its additional info and its argument
+func (d *cborDecoder) head() (major, info byte, arg uint64, err error) {
+	b, err := d.take(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		raw, err := d.take(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		for _, c := range raw {
+			arg = arg<<8 | uint64(c)
+		}
+		return major, info, arg, nil
+	default:
+		return 0, 0, 0, fmt.Errorf("%w: unsupported CBOR length encoding", ErrMalformed)
+	}
+}
+
+func (d *cborDecoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: nested too deeply", ErrMalformed)
+	}
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		if arg > math.MaxInt64 {
+			return arg, nil
+		}
+		return int64(arg), nil
+	case cborNegInt:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer out of range", ErrMalformed)
+		}
+		return -1 - int64(arg), nil
+	case cborBytes:
+		raw, err := d.take(arg)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), raw...), nil
+	case cborText:
+		raw, err := d.take(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(raw) {
+			return nil, fmt.Errorf("%w: invalid UTF-8", ErrMalformed)
+		}
+		return string(raw), nil
+	case cborArray:
+		if arg > uint64(len(d.data)) {
+			return nil, fmt.Errorf("%w: truncated", ErrMalformed)
+		}
+		items := make([]interface{}, arg)
+		for i := range items {
+			if items[i], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case cborMap:
+		if arg > uint64(len(d.data)) {
+			return nil, fmt.Errorf("%w: truncated", ErrMalformed)
+		}
+		obj := make(map[string]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: map keys must be text", ErrMalformed)
+			}
+			if obj[name], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+	case cborTag:
+		inner, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return cborTagged(arg, inner)
+	default:
+		return cborSimpleValue(info, arg)
+	}
+}
+
+// cborTagged interprets timestamp tags and passes other tags through
+func cborTagged(tag uint64, inner interface{}) (interface{}, error) {
+	switch tag {
+	case cborTagDateTime:
+		text, ok := inner.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: tag 0 must wrap text", ErrMalformed)
+		}
+		t, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		return t, nil
+	case cborTagEpoch:
+		switch n := inner.(type) {
+		case int64:
+			return time.Unix(n, 0).UTC(), nil
+		case float64:
+			sec, frac := math.Modf(n)
+			return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+		}
+		return nil, fmt.Errorf("%w: tag 1 must wrap a number", ErrMalformed)
+	default:
+		return inner, nil
+	}
+}
+
+// cborSimpleValue decodes major type 7
+func cborSimpleValue(info byte, arg uint64) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return halfToFloat(uint16(arg)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported CBOR simple value", ErrMalformed)
+	}
+}
+
+// halfToFloat widens an IEEE 754 half-precision float
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
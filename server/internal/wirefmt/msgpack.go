@@ -0,0 +1,355 @@
+package wirefmt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+	"unicode/utf8"
+)
+
+// msgpackExtTimestamp is the MessagePack timestamp extension type
+const msgpackExtTimestamp = -1
+
+// MarshalMsgPack encodes v as MessagePack using the smallest formats
+func MarshalMsgPack(v interface{}) ([]byte, error) {
+	tree, err := toTree(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := encodeMsgPack(&buf, tree); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalMsgPack decodes MessagePack into v (a pointer) with JSON field rules
+// bin values fill []byte fields; timestamp extensions fill time.Time fields
+func UnmarshalMsgPack(data []byte, v interface{}) error {
+	d := msgpackDecoder{data: data}
+	tree, err := d.value(0)
+	if err != nil {
+		return err
+	}
+	if len(d.data) != 0 {
+		return fmt.Errorf("%w: trailing data", ErrMalformed)
+	}
+	return assign(tree, v)
+}
+
+func encodeMsgPack(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case int64:
+		writeMsgPackInt(buf, v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			writeMsgPackInt(buf, int64(v))
+		} else {
+			buf.WriteByte(0xcf)
+			binary.Write(buf, binary.BigEndian, v)
+		}
+	case float64:
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case string:
+		writeMsgPackLength(buf, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		buf.WriteString(v)
+	case []byte:
+		writeMsgPackLength(buf, len(v), 0, 0, 0xc4, 0xc5, 0xc6)
+		buf.Write(v)
+	case time.Time:
+		writeMsgPackTime(buf, v)
+	case []interface{}:
+		writeMsgPackLength(buf, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, item := range v {
+			if err := encodeMsgPack(buf, item); err != nil {
+				return err
+			}
+		}
+	case object:
+		writeMsgPackLength(buf, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		for _, m := range v {
+			encodeMsgPack(buf, m.key)
+			if err := encodeMsgPack(buf, m.value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%w: %T", errUnsupported, v)
+	}
+	return nil
+}
+
+func writeMsgPackInt(buf *bytes.Buffer, n int64) {
+	switch {
+	case n >= 0 && n <= 0x7f:
+		buf.WriteByte(byte(n))
+	case n >= -32 && n < 0:
+		buf.WriteByte(byte(n))
+	case n >= 0 && n <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte(byte(n))
+	case n >= 0 && n <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n >= 0 && n <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	case n >= 0:
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, uint64(n))
+	case n >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(n))
+	case n >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(n))
+	case n >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(n))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+// writeMsgPackLength writes the smallest header for a length; fixBase and
+// fixLimit describe the fix-format (fixLimit 0 = none), size8 may be 0
+func writeMsgPackLength(buf *bytes.Buffer, n int, fixBase byte, fixLimit int, size8, size16, size32 byte) {
+	switch {
+	case n < fixLimit:
+		buf.WriteByte(fixBase | byte(n))
+	case size8 != 0 && n <= math.MaxUint8:
+		buf.WriteByte(size8)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(size16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(size32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+// writeMsgPackTime writes the smallest timestamp extension that fits
+func writeMsgPackTime(buf *bytes.Buffer, t time.Time) {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	switch {
+	case sec >= 0 && sec <= math.MaxUint32 && nsec == 0:
+		buf.Write([]byte{0xd6, 0xff})
+		binary.Write(buf, binary.BigEndian, uint32(sec))
+	case sec >= 0 && sec < 1<<34:
+		buf.Write([]byte{0xd7, 0xff})
+		binary.Write(buf, binary.BigEndian, nsec<<34|uint64(sec))
+	default:
+		buf.Write([]byte{0xc7, 12, 0xff})
+		binary.Write(buf, binary.BigEndian, uint32(nsec))
+		binary.Write(buf, binary.BigEndian, sec)
+	}
+}
+
+// msgpackDecoder reads one MessagePack value at a time
+type msgpackDecoder struct {
+	data []byte
+}
+
+func (d *msgpackDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)) {
+		return nil, fmt.Errorf("%w: truncated", ErrMalformed)
+	}
+	out := d.data[:n]
+	d.data = d.data[n:]
+	return out, nil
+}
+
+// uint reads a big-endian unsigned integer of size bytes
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	raw, err := d.take(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range raw {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+func (d *msgpackDecoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: nested too deeply", ErrMalformed)
+	}
+	b, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := b[0]; {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.mapValue(uint64(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.arrayValue(uint64(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return d.str(uint64(c & 0x1f))
+	}
+
+	switch c := b[0]; c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		raw, err := d.take(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), raw...), nil
+	case 0xca:
+		n, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.uint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		n, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		shift := 64 - 8*size
+		return int64(n<<shift) >> shift, nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.arrayValue(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapValue(n, depth)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (c - 0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(n)
+	default:
+		return nil, fmt.Errorf("%w: unsupported MessagePack type 0x%02x", ErrMalformed, c)
+	}
+}
+
+func (d *msgpackDecoder) str(n uint64) (interface{}, error) {
+	raw, err := d.take(n)
+	if err != nil {
+		return nil, err
+	}
+	if !utf8.Valid(raw) {
+		return nil, fmt.Errorf("%w: invalid UTF-8", ErrMalformed)
+	}
+	return string(raw), nil
+}
+
+func (d *msgpackDecoder) arrayValue(n uint64, depth int) (interface{}, error) {
+	if n > uint64(len(d.data)) {
+		return nil, fmt.Errorf("%w: truncated", ErrMalformed)
+	}
+	items := make([]interface{}, n)
+	for i := range items {
+		var err error
+		if items[i], err = d.value(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func (d *msgpackDecoder) mapValue(n uint64, depth int) (interface{}, error) {
+	if n > uint64(len(d.data)) {
+		return nil, fmt.Errorf("%w: truncated", ErrMalformed)
+	}
+	obj := make(map[string]interface{}, n)
+	for i := uint64(0); i < n; i++ {
+		key, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: map keys must be strings", ErrMalformed)
+		}
+		if obj[name], err = d.value(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// ext decodes an extension value; only timestamps are understood
+func (d *msgpackDecoder) ext(n uint64) (interface{}, error) {
+	typ, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := d.take(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ[0]) != msgpackExtTimestamp {
+		return nil, fmt.Errorf("%w: unsupported extension type %d", ErrMalformed, int8(typ[0]))
+	}
+
+	switch len(raw) {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(raw)), 0).UTC(), nil
+	case 8:
+		v := binary.BigEndian.Uint64(raw)
+		return time.Unix(int64(v&(1<<34-1)), int64(v>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(raw[:4])
+		sec := int64(binary.BigEndian.Uint64(raw[4:]))
+		return time.Unix(sec, int64(nsec)).UTC(), nil
+	default:
+		return nil, fmt.Errorf("%w: bad timestamp length", ErrMalformed)
+	}
+}
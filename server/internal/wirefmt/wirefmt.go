@@ -0,0 +1,252 @@
+// Package wirefmt encodes relay wire types as CBOR or MessagePack
+//
+// Both formats use the JSON data model of the wire types (the same keys,
+// omitempty and "-" rules from the json struct tags) with two exceptions
+// that are the point of using them: []byte fields are native byte strings
+// rather than base64 text, and time.Time fields are native timestamps
+// (CBOR tag 0, MessagePack timestamp extension -1).
+package wirefmt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Media types
+const (
+	ContentTypeCBOR    = "application/cbor"
+	ContentTypeMsgPack = "application/msgpack"
+)
+
+// maxDepth bounds nesting when decoding untrusted input
+const maxDepth = 32
+
+var (
+	ErrMalformed   = errors.New("malformed body")
+	errUnsupported = errors.New("unsupported value")
+)
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// member is one key of an encoded object, in encoding order
+type member struct {
+	key   string
+	value interface{}
+}
+
+// object is an encoded struct or map
+type object []member
+
+// toTree converts a Go value into the format-neutral tree both encoders
+// walk: nil, bool, int64, uint64, float64, string, []byte, time.Time,
+// []interface{} and object
+func toTree(v reflect.Value) (interface{}, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+
+	if v.Type() == timeType {
+		return v.Interface().(time.Time), nil
+	}
+	if v.Type().Implements(marshalerType) {
+		return fromJSONMarshaler(v.Interface().(json.Marshaler))
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.IsNil() {
+				return nil, nil
+			}
+			return v.Bytes(), nil
+		}
+		if v.IsNil() {
+			return nil, nil
+		}
+		fallthrough
+	case reflect.Array:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			item, err := toTree(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("%w: map key %s", errUnsupported, v.Type().Key())
+		}
+		obj := make(object, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value, err := toTree(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, member{iter.Key().String(), value})
+		}
+		sort.Slice(obj, func(i, j int) bool { return obj[i].key < obj[j].key })
+		return obj, nil
+	case reflect.Struct:
+		return structTree(v)
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupported, v.Type())
+	}
+}
+
+// structTree encodes exported fields under their json names
+func structTree(v reflect.Value) (object, error) {
+	t := v.Type()
+	obj := make(object, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fv := v.Field(i)
+		if strings.Contains(opts, "omitempty") && isEmpty(fv) {
+			continue
+		}
+		value, err := toTree(fv)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		obj = append(obj, member{name, value})
+	}
+	return obj, nil
+}
+
+// isEmpty matches encoding/json's omitempty rule
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// fromJSONMarshaler encodes a type with custom JSON through its JSON form
+func fromJSONMarshaler(m json.Marshaler) (interface{}, error) {
+	data, err := m.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return fromGeneric(generic)
+}
+
+// fromGeneric converts a decoded JSON value into the tree
+func fromGeneric(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	case []interface{}:
+		for i := range v {
+			item, err := fromGeneric(v[i])
+			if err != nil {
+				return nil, err
+			}
+			v[i] = item
+		}
+		return v, nil
+	case map[string]interface{}:
+		obj := make(object, 0, len(v))
+		for key, value := range v {
+			item, err := fromGeneric(value)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, member{key, item})
+		}
+		sort.Slice(obj, func(i, j int) bool { return obj[i].key < obj[j].key })
+		return obj, nil
+	default:
+		return v, nil
+	}
+}
+
+// assign stores a decoded tree into v (a pointer) by way of encoding/json,
+// so field matching and type checks are exactly those of a JSON body
+func assign(tree interface{}, v interface{}) error {
+	data, err := json.Marshal(toJSONModel(tree))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// toJSONModel rewrites byte strings and timestamps the way encoding/json
+// expects them for []byte and time.Time fields
+func toJSONModel(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []interface{}:
+		for i := range v {
+			v[i] = toJSONModel(v[i])
+		}
+		return v
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = toJSONModel(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
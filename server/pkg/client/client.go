@@ -0,0 +1,492 @@
+// Package client is a Go SDK for the relay's HTTP API
+//
+// Every call passes through an interceptor chain, so applications can wrap
+// Send/Receive with logging, metrics, retries or an encryption layer:
+//
+//	c := client.New("https://relay.example.com",
+//		client.WithInterceptors(client.Logging(log.Default()), client.Retry(3, time.Second)))
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"privmsg-relay/internal/identity"
+)
+
+// Op identifies which API call an interceptor is wrapping
+type Op string
+
+const (
+	OpCreateQueue Op = "create_queue"
+	OpSend        Op = "send"
+	OpReceive     Op = "receive"
+	OpDeleteQueue Op = "delete_queue"
+	OpAck         Op = "ack"
+)
+
+// Queue is returned when a queue is created
+type Queue struct {
+	QueueID     string    `json:"queue_id"`
+	AccessToken string    `json:"access_token"`
+	SendToken   string    `json:"send_token,omitempty"`
+	DuressToken string    `json:"duress_token,omitempty"` // Receiving with it returns nothing and destroys the queue
+	Macaroon    string    `json:"macaroon,omitempty"`
+	QueueURL    string    `json:"queue_url"`
+	ExpiresAt   time.Time `json:"expires_at"`
+
+	MaxMessages    int `json:"max_messages"`
+	MaxMessageSize int `json:"max_message_size"`
+}
+
+// CreateQueueOptions configures a new queue
+// Zero values use the relay defaults; the relay clamps values to its maximums
+type CreateQueueOptions struct {
+	RequireSendToken bool  `json:"require_send_token,omitempty"`
+	BurnAfterRead    bool  `json:"burn_after_read,omitempty"`
+	Broadcast        bool  `json:"broadcast,omitempty"`     // Readers get tokens via the mint endpoint and ack independently
+	SealedSender     bool  `json:"sealed_sender,omitempty"` // Payloads must be sealed envelopes; messages carry no sender_id
+	MixDelivery      bool  `json:"mix_delivery,omitempty"`  // Messages are delivered in randomly timed batches
+	DuressToken      bool  `json:"duress_token,omitempty"`  // Also issue Queue.DuressToken
+	TTL              int64 `json:"ttl,omitempty"`           // Seconds
+	MaxMessages      int   `json:"max_messages,omitempty"`
+	MaxMessageSize   int   `json:"max_message_size,omitempty"`
+}
+
+// Message is an encrypted message as stored by the relay
+type Message struct {
+	ID         string    `json:"id"`
+	QueueID    string    `json:"queue_id"`
+	Seq        int64     `json:"seq"` // Strictly increasing per queue; a jump means messages expired unread
+	Payload    []byte    `json:"payload"`
+	ReceivedAt time.Time `json:"received_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	System     bool      `json:"system,omitempty"` // Relay-generated notice, not E2E encrypted
+
+	PayloadHash string `json:"payload_sha256,omitempty"` // Hex SHA-256 recorded by the relay at send time
+	SenderID    string `json:"sender_id,omitempty"`      // Group member who sent it, on queues with members (never on sealed-sender queues)
+}
+
+// Call describes one API call as seen by interceptors
+// Interceptors may rewrite fields (e.g. encrypt Payload) before calling next
+type Call struct {
+	Op             Op
+	QueueID        string
+	Token          string              // Access token, or send token for OpSend
+	Payload        []byte              // OpSend
+	TTL            time.Duration       // OpSend: optional shorter message lifetime
+	IdempotencyKey string              // OpSend: retries with the same key are stored once
+	Cursor         string              // OpReceive: NextCursor from the previous receive
+	Wait           time.Duration       // OpReceive: long-poll up to this long for a message
+	Visibility     time.Duration       // OpReceive: hide the returned messages from other consumers until acked or this long passes
+	MessageIDs     []string            // OpAck
+	CreateOpt      *CreateQueueOptions // OpCreateQueue
+}
+
+// Result is what a call produced
+// Interceptors may rewrite fields (e.g. decrypt Messages) before returning
+type Result struct {
+	Queue          *Queue    // OpCreateQueue
+	MessageID      string    // OpSend
+	Seq            int64     // OpSend
+	SentAt         time.Time // OpSend
+	ExpiresAt      time.Time // OpSend
+	PayloadHash    string    // OpSend: hex SHA-256 of the payload the relay stored
+	Receipt        string    // OpSend: token for Client.Receipt (empty if the relay issues none)
+	Messages       []Message // OpReceive
+	HasMore        bool      // OpReceive
+	NextCursor     string    // OpReceive: pass to the next Receive to resume after these messages
+	InvisibleUntil time.Time // OpReceive with Visibility: when unacked messages reappear to other consumers
+	Acked          []string  // OpAck: IDs the relay deleted; the rest were already gone or refused
+}
+
+// Invoker performs a call, either the next interceptor or the HTTP request itself
+type Invoker func(ctx context.Context, call *Call) (*Result, error)
+
+// Interceptor wraps a call; it must call next to continue the chain
+type Interceptor func(ctx context.Context, call *Call, next Invoker) (*Result, error)
+
+// APIError is returned for non-2xx responses
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("relay returned %d: %s", e.StatusCode, e.Message)
+}
+
+// ErrBadSignature is returned when a response the relay signs does not
+// verify against the pinned identity key
+var ErrBadSignature = errors.New("response not signed by the pinned relay key")
+
+// Client talks to one relay
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	interceptors []Interceptor
+	invoke       Invoker
+	identityKey  ed25519.PublicKey
+	tenantKey    string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient replaces the default HTTP client
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithInterceptors appends interceptors; the first one given is outermost
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(c *Client) { c.interceptors = append(c.interceptors, interceptors...) }
+}
+
+// WithIdentityKey pins the relay's Ed25519 identity key, as published at
+// GET /v1/server-info; CreateQueue then fails with ErrBadSignature unless
+// the relay signed the response for this very request
+func WithIdentityKey(pub ed25519.PublicKey) Option {
+	return func(c *Client) { c.identityKey = pub }
+}
+
+// WithTenantKey sends an operator-issued tenant API key when creating
+// queues, attributing them to the tenant
+func WithTenantKey(key string) Option {
+	return func(c *Client) { c.tenantKey = key }
+}
+
+// New creates a client for the relay at baseURL
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.invoke = chain(c.interceptors, c.do)
+	return c
+}
+
+// chain folds interceptors around final so interceptors[0] runs first
+func chain(interceptors []Interceptor, final Invoker) Invoker {
+	invoke := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoke
+		invoke = func(ctx context.Context, call *Call) (*Result, error) {
+			return interceptor(ctx, call, next)
+		}
+	}
+	return invoke
+}
+
+// CreateQueue creates a new queue
+func (c *Client) CreateQueue(ctx context.Context, opts *CreateQueueOptions) (*Queue, error) {
+	result, err := c.invoke(ctx, &Call{Op: OpCreateQueue, CreateOpt: opts})
+	if err != nil {
+		return nil, err
+	}
+	return result.Queue, nil
+}
+
+// Send posts a payload to a queue; sendToken is only needed for send-token queues
+func (c *Client) Send(ctx context.Context, queueID, sendToken string, payload []byte) (*Result, error) {
+	return c.invoke(ctx, &Call{Op: OpSend, QueueID: queueID, Token: sendToken, Payload: payload})
+}
+
+// SendWithTTL posts a self-destructing payload that expires after ttl
+// The relay caps ttl at its configured maximum message lifetime
+func (c *Client) SendWithTTL(ctx context.Context, queueID, sendToken string, payload []byte, ttl time.Duration) (*Result, error) {
+	return c.invoke(ctx, &Call{Op: OpSend, QueueID: queueID, Token: sendToken, Payload: payload, TTL: ttl})
+}
+
+// Receive fetches messages after cursor (empty for all)
+// Pass the previous Result.NextCursor to receive only newer messages
+func (c *Client) Receive(ctx context.Context, queueID, accessToken, cursor string) (*Result, error) {
+	return c.invoke(ctx, &Call{Op: OpReceive, QueueID: queueID, Token: accessToken, Cursor: cursor})
+}
+
+// ReceiveWait is Receive that waits up to wait for a message to arrive
+// when none is queued; the relay caps wait at 30 seconds, so keep it below
+// the HTTP client's timeout (30 seconds by default)
+func (c *Client) ReceiveWait(ctx context.Context, queueID, accessToken, cursor string, wait time.Duration) (*Result, error) {
+	return c.invoke(ctx, &Call{Op: OpReceive, QueueID: queueID, Token: accessToken, Cursor: cursor, Wait: wait})
+}
+
+// Consume receives messages as one of several competing consumers: the
+// messages returned are hidden from other consumers for visibility, and
+// reappear unless acked before Result.InvisibleUntil
+// Delivery is at least once, so processing should tolerate a repeat
+func (c *Client) Consume(ctx context.Context, queueID, accessToken string, visibility, wait time.Duration) (*Result, error) {
+	return c.invoke(ctx, &Call{Op: OpReceive, QueueID: queueID, Token: accessToken, Visibility: visibility, Wait: wait})
+}
+
+// Ack deletes received messages so they are not delivered again
+func (c *Client) Ack(ctx context.Context, queueID, accessToken string, messageIDs ...string) (*Result, error) {
+	return c.invoke(ctx, &Call{Op: OpAck, QueueID: queueID, Token: accessToken, MessageIDs: messageIDs})
+}
+
+// Receipt reports how far a sent message got: "stored", "delivered",
+// "fetched", "acked" or "expired"; pass the Result.Receipt from Send
+// The relay forgets the receipt once it has reported acked or expired
+func (c *Client) Receipt(ctx context.Context, receiptToken string) (string, error) {
+	var resp struct {
+		Status string `json:"status"`
+	}
+	if err := c.request(ctx, http.MethodGet, "/v1/receipt/"+url.PathEscape(receiptToken), "", nil, nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.Status, nil
+}
+
+// DeleteQueue deletes a queue and all its messages
+func (c *Client) DeleteQueue(ctx context.Context, queueID, accessToken string) error {
+	_, err := c.invoke(ctx, &Call{Op: OpDeleteQueue, QueueID: queueID, Token: accessToken})
+	return err
+}
+
+// Wipe destroys every queue the admin tokens belong to, with their messages,
+// tokens, push registrations and webhooks, and returns the queue IDs
+// Nothing is deleted if any token is invalid; with WithIdentityKey the
+// relay's answer is checked against its signature
+func (c *Client) Wipe(ctx context.Context, accessTokens ...string) ([]string, error) {
+	var resp struct {
+		QueueIDs []string `json:"queue_ids"`
+	}
+	body := map[string][]string{"access_tokens": accessTokens}
+	if err := c.signedRequest(ctx, http.MethodPost, "/v1/wipe", nil, body, &resp); err != nil {
+		return nil, err
+	}
+	return resp.QueueIDs, nil
+}
+
+// Elevation is a queue's lifetime and limits after a voucher was redeemed
+type Elevation struct {
+	ExpiresAt      time.Time `json:"expires_at"`
+	MaxMessages    int       `json:"max_messages"`
+	MaxMessageSize int       `json:"max_message_size"`
+}
+
+// RedeemVoucher spends a voucher bought from the relay operator to raise
+// the queue's limits; voucher is the unblinded voucher, encoded like a
+// Private-Token
+func (c *Client) RedeemVoucher(ctx context.Context, queueID, accessToken, voucher string) (*Elevation, error) {
+	var resp Elevation
+	body := map[string]string{"voucher": voucher}
+	if err := c.request(ctx, http.MethodPost, "/v1/queue/"+url.PathEscape(queueID)+"/voucher", accessToken, nil, body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// do is the innermost invoker: it performs the HTTP request
+func (c *Client) do(ctx context.Context, call *Call) (*Result, error) {
+	queuePath := "/v1/queue/" + url.PathEscape(call.QueueID)
+
+	switch call.Op {
+	case OpCreateQueue:
+		var queue Queue
+		opts := call.CreateOpt
+		if opts == nil {
+			opts = &CreateQueueOptions{}
+		}
+		var header http.Header
+		if c.tenantKey != "" {
+			header = http.Header{"Tenant-Key": {c.tenantKey}}
+		}
+		if err := c.signedRequest(ctx, http.MethodPost, "/v1/queue/create", header, opts, &queue); err != nil {
+			return nil, err
+		}
+		return &Result{Queue: &queue}, nil
+
+	case OpSend:
+		var resp struct {
+			MessageID string    `json:"message_id"`
+			Seq       int64     `json:"seq"`
+			SentAt    time.Time `json:"sent_at"`
+			ExpiresAt time.Time `json:"expires_at"`
+
+			PayloadHash  string `json:"payload_sha256"`
+			ReceiptToken string `json:"receipt_token"`
+		}
+		body := struct {
+			Payload    []byte `json:"payload"`
+			TTLSeconds int64  `json:"ttl_seconds,omitempty"`
+		}{call.Payload, int64(call.TTL / time.Second)}
+		var header http.Header
+		if call.IdempotencyKey != "" {
+			header = http.Header{"Idempotency-Key": {call.IdempotencyKey}}
+		}
+		if err := c.request(ctx, http.MethodPost, queuePath+"/send", call.Token, header, body, &resp); err != nil {
+			return nil, err
+		}
+		return &Result{
+			MessageID:   resp.MessageID,
+			Seq:         resp.Seq,
+			SentAt:      resp.SentAt,
+			ExpiresAt:   resp.ExpiresAt,
+			PayloadHash: resp.PayloadHash,
+			Receipt:     resp.ReceiptToken,
+		}, nil
+
+	case OpReceive:
+		var resp struct {
+			Messages   []Message `json:"messages"`
+			HasMore    bool      `json:"has_more"`
+			NextCursor string    `json:"next_cursor"`
+
+			InvisibleUntil *time.Time `json:"invisible_until"`
+		}
+		query := url.Values{}
+		if call.Cursor != "" {
+			query.Set("cursor", call.Cursor)
+		}
+		if call.Wait > 0 {
+			query.Set("wait", strconv.Itoa(int(call.Wait/time.Second)))
+		}
+		if call.Visibility > 0 {
+			query.Set("visibility_timeout", strconv.Itoa(int(max(call.Visibility/time.Second, 1))))
+		}
+		path := queuePath + "/receive"
+		if len(query) > 0 {
+			path += "?" + query.Encode()
+		}
+		if err := c.request(ctx, http.MethodGet, path, call.Token, nil, nil, &resp); err != nil {
+			return nil, err
+		}
+		result := &Result{Messages: resp.Messages, HasMore: resp.HasMore, NextCursor: resp.NextCursor}
+		if resp.InvisibleUntil != nil {
+			result.InvisibleUntil = *resp.InvisibleUntil
+		}
+		return result, nil
+
+	case OpAck:
+		var resp struct {
+			Results []struct {
+				Index  int `json:"index"`
+				Status int `json:"status"`
+			} `json:"results"`
+		}
+		body := struct {
+			MessageIDs []string `json:"message_ids"`
+		}{call.MessageIDs}
+		if err := c.request(ctx, http.MethodPost, queuePath+"/ack", call.Token, nil, body, &resp); err != nil {
+			return nil, err
+		}
+		result := &Result{}
+		for _, item := range resp.Results {
+			if item.Status/100 == 2 && item.Index >= 0 && item.Index < len(call.MessageIDs) {
+				result.Acked = append(result.Acked, call.MessageIDs[item.Index])
+			}
+		}
+		return result, nil
+
+	case OpDeleteQueue:
+		if err := c.request(ctx, http.MethodDelete, queuePath, call.Token, nil, nil, nil); err != nil {
+			return nil, err
+		}
+		return &Result{}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown operation %q", call.Op)
+	}
+}
+
+// request sends JSON body (if any) with extra headers and decodes the JSON response into out (if any)
+func (c *Client) request(ctx context.Context, method, path, token string, header http.Header, body, out interface{}) error {
+	return c.exchange(ctx, method, path, token, header, body, out, nil)
+}
+
+// signedRequest is request for endpoints the relay signs; with a pinned
+// key, it sends a fresh nonce and checks the signature before decoding
+func (c *Client) signedRequest(ctx context.Context, method, path string, header http.Header, body, out interface{}) error {
+	if c.identityKey == nil {
+		return c.request(ctx, method, path, "", header, body, out)
+	}
+	var random [16]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(random[:])
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set(identity.NonceHeader, nonce)
+
+	return c.exchange(ctx, method, path, "", header, body, out, func(resp *http.Response, data []byte) error {
+		signedAt, err := strconv.ParseInt(resp.Header.Get(identity.SignedAtHeader), 10, 64)
+		if err != nil {
+			return ErrBadSignature
+		}
+		if !identity.VerifyResponse(c.identityKey, method, resp.Request.URL.Path, resp.StatusCode, signedAt, nonce, data, resp.Header.Get(identity.SignatureHeader)) {
+			return ErrBadSignature
+		}
+		return nil
+	})
+}
+
+// exchange performs a request; verify, if set, sees the whole response body
+// before anything else does
+func (c *Client) exchange(ctx context.Context, method, path, token string, header http.Header, body, out interface{}, verify func(*http.Response, []byte) error) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if verify != nil {
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if err := verify(resp, data); err != nil {
+			return err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(detail))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
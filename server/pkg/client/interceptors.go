@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Logging logs every call with its duration and outcome
+// Payloads and tokens are never logged
+func Logging(logger *log.Logger) Interceptor {
+	return func(ctx context.Context, call *Call, next Invoker) (*Result, error) {
+		start := time.Now()
+		result, err := next(ctx, call)
+		if err != nil {
+			logger.Printf("relay %s queue=%s failed after %s: %v", call.Op, call.QueueID, time.Since(start), err)
+		} else {
+			logger.Printf("relay %s queue=%s ok in %s", call.Op, call.QueueID, time.Since(start))
+		}
+		return result, err
+	}
+}
+
+// Retry re-invokes calls that failed with a network error, 429 or 5xx,
+// doubling the delay after each attempt
+// Sends get an Idempotency-Key if they have none, so a retried send is stored once
+func Retry(attempts int, backoff time.Duration) Interceptor {
+	return func(ctx context.Context, call *Call, next Invoker) (*Result, error) {
+		if call.Op == OpSend && call.IdempotencyKey == "" {
+			keyed := *call
+			keyed.IdempotencyKey = newIdempotencyKey()
+			call = &keyed
+		}
+
+		delay := backoff
+		for attempt := 1; ; attempt++ {
+			result, err := next(ctx, call)
+			if err == nil || attempt >= attempts || !retryable(err) {
+				return result, err
+			}
+
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			delay *= 2
+		}
+	}
+}
+
+// Transform rewrites payloads on the way out (Send) and back in (Receive),
+// e.g. to plug in an encryption layer
+// System messages from the relay are passed through unchanged
+func Transform(seal func([]byte) ([]byte, error), open func([]byte) ([]byte, error)) Interceptor {
+	return func(ctx context.Context, call *Call, next Invoker) (*Result, error) {
+		if call.Op == OpSend {
+			sealed, err := seal(call.Payload)
+			if err != nil {
+				return nil, err
+			}
+			// Copy so outer interceptors that retry still hold the plaintext
+			sealedCall := *call
+			sealedCall.Payload = sealed
+			call = &sealedCall
+		}
+
+		result, err := next(ctx, call)
+		if err != nil || call.Op != OpReceive {
+			return result, err
+		}
+
+		for i := range result.Messages {
+			if result.Messages[i].System {
+				continue
+			}
+			opened, err := open(result.Messages[i].Payload)
+			if err != nil {
+				return nil, err
+			}
+			result.Messages[i].Payload = opened
+		}
+		return result, nil
+	}
+}
+
+// ErrIntegrity is returned when a payload does not match the relay's recorded hash
+var ErrIntegrity = errors.New("payload integrity check failed")
+
+// VerifyIntegrity checks payloads against the relay's SHA-256: the sent payload
+// against the send response, and received payloads before anything opens them
+// Place it after Transform so it sees the encrypted bytes
+// Messages without a hash (stored by older relays) are passed through
+func VerifyIntegrity() Interceptor {
+	return func(ctx context.Context, call *Call, next Invoker) (*Result, error) {
+		result, err := next(ctx, call)
+		if err != nil {
+			return result, err
+		}
+
+		switch call.Op {
+		case OpSend:
+			if result.PayloadHash != "" && result.PayloadHash != payloadHash(call.Payload) {
+				return nil, fmt.Errorf("%w: message %s was stored altered", ErrIntegrity, result.MessageID)
+			}
+		case OpReceive:
+			for _, message := range result.Messages {
+				if message.PayloadHash != "" && message.PayloadHash != payloadHash(message.Payload) {
+					return nil, fmt.Errorf("%w: message %s", ErrIntegrity, message.ID)
+				}
+			}
+		}
+		return result, nil
+	}
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func payloadHash(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		// 409 is an idempotent send whose first attempt is still running
+		return apiErr.StatusCode == http.StatusTooManyRequests ||
+			apiErr.StatusCode == http.StatusConflict ||
+			apiErr.StatusCode >= 500
+	}
+	return true // Network error
+}
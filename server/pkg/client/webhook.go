@@ -0,0 +1,63 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrWebhookSignature = errors.New("webhook signature does not match")
+	ErrWebhookTimestamp = errors.New("webhook timestamp outside tolerance")
+)
+
+// VerifyWebhook checks that a webhook post came from the relay: the
+// Webhook-Signature header must match body under secret (the whsec_ value
+// returned when the webhook was registered), and Webhook-Timestamp must be
+// within tolerance of now, which stops old posts being replayed
+//
+//	body, _ := io.ReadAll(r.Body)
+//	if err := client.VerifyWebhook(r.Header, body, secret, 5*time.Minute); err != nil {
+//		http.Error(w, "bad signature", http.StatusUnauthorized)
+//		return
+//	}
+func VerifyWebhook(header http.Header, body []byte, secret string, tolerance time.Duration) error {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, "whsec_"))
+	if err != nil {
+		return fmt.Errorf("invalid webhook secret: %w", err)
+	}
+
+	id := header.Get("Webhook-Id")
+	timestamp := header.Get("Webhook-Timestamp")
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrWebhookTimestamp
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrWebhookTimestamp
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	// The header may list several space-separated signatures during secret rotation
+	for _, signature := range strings.Fields(header.Get("Webhook-Signature")) {
+		version, value, ok := strings.Cut(signature, ",")
+		if !ok || version != "v1" {
+			continue
+		}
+		got, err := base64.StdEncoding.DecodeString(value)
+		if err == nil && hmac.Equal(got, expected) {
+			return nil
+		}
+	}
+	return ErrWebhookSignature
+}
@@ -0,0 +1,652 @@
+// Package relaymock is an in-memory relay for testing client applications
+//
+// It speaks the same HTTP and WebSocket protocol as the real relay but keeps
+// everything in memory and lets tests inject faults deterministically:
+//
+//	mock := relaymock.New()
+//	defer mock.Close()
+//	mock.SetLatency(50 * time.Millisecond)
+//	mock.FailNext(relaymock.OpSend, 2, http.StatusTooManyRequests)
+//	c := client.New(mock.URL)
+package relaymock
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"privmsg-relay/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+)
+
+// Op names a protocol operation for fault injection
+type Op string
+
+const (
+	OpCreateQueue Op = "create_queue"
+	OpSend        Op = "send"
+	OpReceive     Op = "receive"
+	OpDeleteQueue Op = "delete_queue"
+	OpAck         Op = "ack"
+	OpWebSocket   Op = "ws"
+)
+
+// Server is an in-memory relay listening on a local port
+type Server struct {
+	URL string
+
+	httpServer *httptest.Server
+	upgrader   websocket.Upgrader
+
+	mu       sync.Mutex
+	queues   map[string]*mockQueue
+	latency  time.Duration
+	failures map[Op][]int // Status codes to return for the next calls of each op
+	wsConns  map[*websocket.Conn]*sync.Mutex
+}
+
+type mockQueue struct {
+	accessToken string
+	sendToken   string
+	burn        bool
+	expiresAt   time.Time
+	messages    []queue.Message
+	seq         int64
+	subscribers map[*websocket.Conn]bool
+	signalers   map[*websocket.Conn]bool             // Sender connections that signaled the queue
+	sent        map[string]queue.SendMessageResponse // By Idempotency-Key
+}
+
+// New starts a mock relay
+func New() *Server {
+	s := &Server{
+		queues:   make(map[string]*mockQueue),
+		failures: make(map[Op][]int),
+		wsConns:  make(map[*websocket.Conn]*sync.Mutex),
+		upgrader: websocket.Upgrader{
+			EnableCompression: true,
+			Subprotocols:      queue.WSProtocols,
+			CheckOrigin:       func(r *http.Request) bool { return true },
+		},
+	}
+
+	router := chi.NewRouter()
+	router.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+	})
+	router.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+	})
+	router.Get("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+	})
+	// Like the relay, the API answers under /v1 and at the legacy paths
+	api := func(r chi.Router) {
+		r.Post("/queue/create", s.fault(OpCreateQueue, s.handleCreateQueue))
+		r.Post("/queue/{queueID}/send", s.fault(OpSend, s.handleSend))
+		r.Get("/queue/{queueID}/receive", s.fault(OpReceive, s.handleReceive))
+		r.Post("/queue/{queueID}/ack", s.fault(OpAck, s.handleAck))
+		r.Delete("/queue/{queueID}", s.fault(OpDeleteQueue, s.handleDeleteQueue))
+		r.Get("/ws", s.fault(OpWebSocket, s.handleWebSocket))
+	}
+	router.Route("/v1", api)
+	api(router)
+
+	s.httpServer = httptest.NewServer(router)
+	s.URL = s.httpServer.URL
+	return s
+}
+
+// Close drops all connections and stops the server
+func (s *Server) Close() {
+	s.DropWebSockets()
+	s.httpServer.Close()
+}
+
+// SetLatency delays every request by d
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// FailNext makes the next n calls of op fail with status (e.g. 429 or 503)
+func (s *Server) FailNext(op Op, n int, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures[op] = append(s.failures[op], status)
+	}
+}
+
+// DropWebSockets abruptly closes every open WebSocket connection
+func (s *Server) DropWebSockets() {
+	s.mu.Lock()
+	conns := make([]*websocket.Conn, 0, len(s.wsConns))
+	for conn := range s.wsConns {
+		conns = append(conns, conn)
+	}
+	s.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+// Messages returns the messages currently stored in a queue
+func (s *Server) Messages(queueID string) []queue.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queues[queueID]
+	if q == nil {
+		return nil
+	}
+	return append([]queue.Message(nil), q.messages...)
+}
+
+// fault applies latency and injected failures before calling next
+func (s *Server) fault(op Op, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		latency := s.latency
+		status := 0
+		if pending := s.failures[op]; len(pending) > 0 {
+			status, s.failures[op] = pending[0], pending[1:]
+		}
+		s.mu.Unlock()
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if status != 0 {
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "1")
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) handleCreateQueue(w http.ResponseWriter, r *http.Request) {
+	var req queue.CreateQueueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	q := &mockQueue{
+		accessToken: randomID(),
+		expiresAt:   time.Now().Add(queue.QueueTTL),
+		subscribers: make(map[*websocket.Conn]bool),
+		signalers:   make(map[*websocket.Conn]bool),
+	}
+	if req.TTL > 0 {
+		q.expiresAt = time.Now().Add(time.Duration(req.TTL) * time.Second)
+	}
+	if req.RequireSendToken {
+		q.sendToken = randomID()
+	}
+	q.burn = req.BurnAfterRead
+
+	queueID := randomID()
+	s.mu.Lock()
+	s.queues[queueID] = q
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, queue.CreateQueueResponse{
+		QueueID:        queueID,
+		AccessToken:    q.accessToken,
+		SendToken:      q.sendToken,
+		QueueURL:       "/v1/queue/" + queueID,
+		ExpiresAt:      q.expiresAt,
+		MaxMessages:    queue.MaxMessagesInQueue,
+		MaxMessageSize: queue.MaxMessageSize,
+	})
+}
+
+func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+
+	var req queue.SendMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.TTLSeconds < 0 {
+		http.Error(w, "ttl_seconds must not be negative", http.StatusBadRequest)
+		return
+	}
+	if len(req.Payload) > queue.MaxMessageSize {
+		http.Error(w, queue.ErrMessageTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	s.mu.Lock()
+	q := s.queues[queueID]
+	switch {
+	case q == nil:
+		s.mu.Unlock()
+		http.Error(w, queue.ErrQueueNotFound.Error(), http.StatusNotFound)
+		return
+	case q.sendToken != "" && bearerToken(r) != q.sendToken:
+		s.mu.Unlock()
+		http.Error(w, queue.ErrInvalidSendToken.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if replay, ok := q.sent[idempotencyKey]; ok && idempotencyKey != "" {
+		s.mu.Unlock()
+		w.Header().Set("Idempotent-Replayed", "true")
+		writeJSON(w, http.StatusCreated, replay)
+		return
+	}
+	if len(q.messages) >= queue.MaxMessagesInQueue {
+		s.mu.Unlock()
+		http.Error(w, queue.ErrQueueFull.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	now := time.Now()
+	ttl := queue.MessageTTL
+	if req.TTLSeconds > 0 {
+		ttl = min(ttl, time.Duration(req.TTLSeconds)*time.Second)
+	}
+	q.seq++
+	message := queue.Message{
+		ID:         randomID(),
+		QueueID:    queueID,
+		Seq:        q.seq,
+		Payload:    req.Payload,
+		ReceivedAt: now,
+		ExpiresAt:  now.Add(ttl),
+
+		PayloadHash: queue.PayloadHash(req.Payload),
+	}
+	subscribers := make([]*websocket.Conn, 0, len(q.subscribers))
+	for conn := range q.subscribers {
+		subscribers = append(subscribers, conn)
+	}
+	// Burn-after-read messages pushed over WS are never stored
+	if !q.burn || len(subscribers) == 0 {
+		q.messages = append(q.messages, message)
+	}
+	response := queue.SendMessageResponse{
+		MessageID:   message.ID,
+		Seq:         message.Seq,
+		SentAt:      now,
+		ExpiresAt:   message.ExpiresAt,
+		PayloadHash: message.PayloadHash,
+	}
+	if idempotencyKey != "" {
+		if q.sent == nil {
+			q.sent = make(map[string]queue.SendMessageResponse)
+		}
+		q.sent[idempotencyKey] = response
+	}
+	s.mu.Unlock()
+
+	for _, conn := range subscribers {
+		s.writeWSMessage(conn, &message)
+	}
+
+	writeJSON(w, http.StatusCreated, response)
+}
+
+func (s *Server) handleReceive(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	query := r.URL.Query()
+	after, err := queue.DecodeCursor(query.Get("cursor"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if since := query.Get("since"); since != "" {
+		if after, err = strconv.ParseInt(since, 10, 64); err != nil || after < 0 {
+			http.Error(w, "since must be a message sequence number", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := queue.MaxReceiveLimit
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > queue.MaxReceiveLimit {
+			http.Error(w, "limit out of range", http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	q := s.queues[queueID]
+	if q == nil || bearerToken(r) != q.accessToken {
+		s.mu.Unlock()
+		http.Error(w, queue.ErrInvalidAccessToken.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	q.dropExpired(time.Now())
+
+	// Same cursor semantics as the relay: resume after the cursor's sequence number
+	start := len(q.messages)
+	for i, message := range q.messages {
+		if message.Seq > after {
+			start = i
+			break
+		}
+	}
+	messages := append([]queue.Message{}, q.messages[start:]...)
+	if query.Get("count_only") == "true" {
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, queue.ReceiveCountResponse{Count: len(messages), NextCursor: queue.EncodeCursor(after)})
+		return
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	if q.burn {
+		q.messages = append(q.messages[:start], q.messages[start+len(messages):]...)
+	}
+	next := after
+	if len(messages) > 0 {
+		next = messages[len(messages)-1].Seq
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, queue.ReceiveMessagesResponse{Messages: messages, HasMore: hasMore, NextCursor: queue.EncodeCursor(next)})
+}
+
+// dropExpired removes messages whose TTL has passed; callers hold s.mu
+func (q *mockQueue) dropExpired(now time.Time) {
+	kept := q.messages[:0]
+	for _, message := range q.messages {
+		if now.Before(message.ExpiresAt) {
+			kept = append(kept, message)
+		}
+	}
+	q.messages = kept
+}
+
+func (s *Server) handleAck(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+	var req queue.BatchAckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.MessageIDs) == 0 || len(req.MessageIDs) > queue.MaxBatchSize {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queues[queueID]
+	if q == nil || bearerToken(r) != q.accessToken {
+		http.Error(w, queue.ErrInvalidAccessToken.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	response := queue.BatchResponse{Results: make([]queue.BatchItemResult, len(req.MessageIDs))}
+	for i, messageID := range req.MessageIDs {
+		response.Results[i] = queue.BatchItemResult{Index: i, Status: http.StatusNotFound, Error: queue.ErrMessageNotFound.Error()}
+		for j, message := range q.messages {
+			if message.ID == messageID {
+				q.messages = append(q.messages[:j], q.messages[j+1:]...)
+				response.Results[i] = queue.BatchItemResult{Index: i, Status: http.StatusNoContent}
+				break
+			}
+		}
+		if response.Results[i].Status == http.StatusNoContent {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+	status := http.StatusOK
+	if response.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	writeJSON(w, status, response)
+}
+
+func (s *Server) handleDeleteQueue(w http.ResponseWriter, r *http.Request) {
+	queueID := chi.URLParam(r, "queueID")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queues[queueID]
+	if q == nil || bearerToken(r) != q.accessToken {
+		http.Error(w, queue.ErrInvalidAccessToken.Error(), http.StatusUnauthorized)
+		return
+	}
+	delete(s.queues, queueID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.wsConns[conn] = &sync.Mutex{}
+	s.mu.Unlock()
+
+	protocol := conn.Subprotocol()
+	if protocol == "" {
+		protocol = queue.WSProtocol
+	}
+	s.writeWS(conn, queue.WSMessage{Type: queue.WSTypeHello, Protocol: protocol, Timestamp: time.Now()})
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.wsConns, conn)
+		for _, q := range s.queues {
+			delete(q.subscribers, conn)
+			delete(q.signalers, conn)
+		}
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg queue.WSMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.writeWSError(conn, &msg, http.StatusBadRequest, "malformed frame")
+			continue
+		}
+
+		switch msg.Type {
+		case queue.WSTypeSubscribe:
+			// Like the relay: reject bad tokens, then push what is already queued
+			after, err := queue.DecodeCursor(msg.Cursor)
+			s.mu.Lock()
+			q := s.queues[msg.QueueID]
+			if q == nil || q.accessToken != msg.AccessToken || err != nil {
+				s.mu.Unlock()
+				if err != nil {
+					s.writeWSError(conn, &msg, http.StatusBadRequest, err.Error())
+				} else {
+					s.writeWSError(conn, &msg, http.StatusUnauthorized, queue.ErrInvalidAccessToken.Error())
+				}
+				continue
+			}
+			q.subscribers[conn] = true
+			q.dropExpired(time.Now())
+			var backlog []queue.Message
+			kept := q.messages[:0]
+			for _, message := range q.messages {
+				if message.Seq > after {
+					backlog = append(backlog, message)
+					if q.burn {
+						continue
+					}
+				}
+				kept = append(kept, message)
+			}
+			q.messages = kept
+			s.mu.Unlock()
+
+			for i := range backlog {
+				s.writeWSMessage(conn, &backlog[i])
+			}
+
+		case queue.WSTypeUnsubscribe:
+			s.mu.Lock()
+			if q := s.queues[msg.QueueID]; q != nil {
+				delete(q.subscribers, conn)
+			}
+			s.mu.Unlock()
+
+		case queue.WSTypeAck:
+			s.mu.Lock()
+			q := s.queues[msg.QueueID]
+			if q == nil || q.accessToken != msg.AccessToken {
+				s.mu.Unlock()
+				s.writeWSError(conn, &msg, http.StatusUnauthorized, queue.ErrInvalidAccessToken.Error())
+				continue
+			}
+			for i, message := range q.messages {
+				if message.ID == msg.MessageID {
+					q.messages = append(q.messages[:i], q.messages[i+1:]...)
+					break
+				}
+			}
+			s.mu.Unlock()
+
+		case queue.WSTypeSignal:
+			// Relayed like the relay does, without its size and rate limits
+			s.mu.Lock()
+			q := s.queues[msg.QueueID]
+			if q == nil || (!q.subscribers[conn] && q.sendToken != "" && q.sendToken != msg.AccessToken) {
+				s.mu.Unlock()
+				s.writeWSError(conn, &msg, http.StatusUnauthorized, queue.ErrInvalidSendToken.Error())
+				continue
+			}
+			var peers []*websocket.Conn
+			for peer := range q.subscribers {
+				peers = append(peers, peer)
+			}
+			if q.subscribers[conn] {
+				for peer := range q.signalers {
+					peers = append(peers, peer)
+				}
+			} else {
+				q.signalers[conn] = true
+			}
+			s.mu.Unlock()
+
+			frame := queue.WSMessage{Type: queue.WSTypeSignal, QueueID: msg.QueueID, Payload: msg.Payload, Timestamp: time.Now()}
+			for _, peer := range peers {
+				if peer != conn {
+					s.writeWS(peer, frame)
+				}
+			}
+
+		case queue.WSTypeCover:
+			// Accepted, but the mock sends no decoys
+
+		case queue.WSTypePing:
+			s.writeWS(conn, queue.WSMessage{Type: queue.WSTypePong, Timestamp: time.Now()})
+
+		default:
+			s.writeWSError(conn, &msg, http.StatusBadRequest, "unknown frame type")
+		}
+	}
+}
+
+// messageFrame builds the WebSocket frame that delivers message
+func messageFrame(message *queue.Message) queue.WSMessage {
+	return queue.WSMessage{
+		Type:        queue.WSTypeMessage,
+		QueueID:     message.QueueID,
+		MessageID:   message.ID,
+		Seq:         message.Seq,
+		Cursor:      queue.EncodeCursor(message.Seq),
+		Payload:     message.Payload,
+		PayloadHash: message.PayloadHash,
+		Timestamp:   time.Now(),
+	}
+}
+
+// writeWSError answers a client frame with an error frame, like the relay
+func (s *Server) writeWSError(conn *websocket.Conn, request *queue.WSMessage, code int, message string) {
+	s.writeWS(conn, queue.WSMessage{
+		Type:      queue.WSTypeError,
+		QueueID:   request.QueueID,
+		MessageID: request.MessageID,
+		Code:      code,
+		Error:     message,
+		Timestamp: time.Now(),
+	})
+}
+
+// writeWS serializes writes per connection, like the relay does
+func (s *Server) writeWS(conn *websocket.Conn, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	s.writeWSFrame(conn, websocket.TextMessage, data)
+}
+
+// writeWSMessage pushes a message, as a binary frame if the client
+// negotiated queue.WSBinaryProtocol
+func (s *Server) writeWSMessage(conn *websocket.Conn, message *queue.Message) {
+	if conn.Subprotocol() != queue.WSBinaryProtocol {
+		s.writeWS(conn, messageFrame(message))
+		return
+	}
+	data, err := queue.EncodeWSBinary(messageFrame(message))
+	if err != nil {
+		return
+	}
+	s.writeWSFrame(conn, websocket.BinaryMessage, data)
+}
+
+func (s *Server) writeWSFrame(conn *websocket.Conn, messageType int, data []byte) {
+	s.mu.Lock()
+	writeMu := s.wsConns[conn]
+	s.mu.Unlock()
+	if writeMu == nil {
+		return
+	}
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	conn.WriteMessage(messageType, data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func bearerToken(r *http.Request) string {
+	token := r.Header.Get("Authorization")
+	if len(token) > 7 && token[:7] == "Bearer " {
+		token = token[7:]
+	}
+	return token
+}
+
+func randomID() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
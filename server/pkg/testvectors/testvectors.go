@@ -0,0 +1,498 @@
+// Package testvectors holds canonical encodings of every relay request,
+// response and WebSocket frame
+//
+// Each vector pairs a Go value with its canonical JSON (object keys sorted,
+// no insignificant whitespace) and its CBOR encoding of the same data model
+// (RFC 8949 core deterministic; binary fields stay base64 text exactly as
+// in JSON). Client implementations in other languages can load vectors.json,
+// decode each encoding, re-encode it and compare bytes.
+//
+// Regenerate vectors.json after changing a wire type:
+//
+//	go run ./cmd/testvectors > pkg/testvectors/vectors.json
+package testvectors
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"privmsg-relay/internal/macaroon"
+	"privmsg-relay/internal/queue"
+)
+
+// Kind groups vectors by where they appear on the wire
+type Kind string
+
+const (
+	KindRequest  Kind = "request"
+	KindResponse Kind = "response"
+	KindWSFrame  Kind = "ws_frame"
+)
+
+// Vector is one canonical example
+type Vector struct {
+	Name        string      `json:"name"`
+	Kind        Kind        `json:"kind"`
+	Endpoint    string      `json:"endpoint"`
+	Description string      `json:"description"`
+	Value       interface{} `json:"-"`
+	JSON        string      `json:"json"`     // Canonical JSON text
+	CBORHex     string      `json:"cbor_hex"` // Deterministic CBOR, hex encoded
+}
+
+// epoch is the fixed timestamp used throughout so encodings never change
+var epoch = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// Fixed identifiers of realistic length
+const (
+	queueID     = "4f6e65206964656e74696669657220746f2072756c65207468656d20616c6c21"
+	accessToken = "a0a1a2a3a4a5a6a7a8a9aaabacadaeafb0b1b2b3b4b5b6b7b8b9babbbcbdbebf"
+	sendToken   = "c0c1c2c3c4c5c6c7c8c9cacbcccdcecfd0d1d2d3d4d5d6d7d8d9dadbdcdddedf"
+	messageID   = "00112233445566778899aabbccddeeff"
+)
+
+// macaroonRootKey mints the macaroon vectors; it is 32 bytes of 0x6d
+var macaroonRootKey = bytes.Repeat([]byte{0x6d}, 32)
+
+// Caveats of the attenuated macaroon vector
+var macaroonCaveats = []string{"op = receive,ack", "time < " + epoch.Add(time.Hour).Format(time.RFC3339)}
+
+// All returns every vector with its encodings filled in
+func All() ([]Vector, error) {
+	vectors := definitions()
+	for i := range vectors {
+		canonical, cbor, err := Encode(vectors[i].Value)
+		if err != nil {
+			return nil, fmt.Errorf("vector %s: %w", vectors[i].Name, err)
+		}
+		vectors[i].JSON = string(canonical)
+		vectors[i].CBORHex = hex.EncodeToString(cbor)
+	}
+	return vectors, nil
+}
+
+// Encode produces the canonical JSON and CBOR encodings of a wire value
+func Encode(v interface{}) (canonicalJSON, cbor []byte, err error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	return Canonicalize(raw)
+}
+
+// Canonicalize re-encodes arbitrary JSON canonically, e.g. a server response
+// captured in a test, so it can be compared byte for byte with a vector
+func Canonicalize(raw []byte) (canonicalJSON, cbor []byte, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, nil, err
+	}
+
+	// encoding/json sorts map keys, which is all canonical JSON needs here
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(generic); err != nil {
+		return nil, nil, err
+	}
+	canonicalJSON = bytes.TrimSuffix(out.Bytes(), []byte("\n"))
+
+	var buf bytes.Buffer
+	if err := encodeCBOR(&buf, generic); err != nil {
+		return nil, nil, err
+	}
+	return canonicalJSON, buf.Bytes(), nil
+}
+
+// Find returns the vector with the given name
+func Find(name string) (*Vector, error) {
+	vectors, err := All()
+	if err != nil {
+		return nil, err
+	}
+	for i := range vectors {
+		if vectors[i].Name == name {
+			return &vectors[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no test vector named %q", name)
+}
+
+// Match reports whether raw JSON (e.g. a captured server response) is
+// canonically equal to the named vector
+func Match(name string, raw []byte) error {
+	vector, err := Find(name)
+	if err != nil {
+		return err
+	}
+	canonical, _, err := Canonicalize(raw)
+	if err != nil {
+		return fmt.Errorf("failed to canonicalize: %w", err)
+	}
+	if string(canonical) != vector.JSON {
+		return fmt.Errorf("%s mismatch:\n got: %s\nwant: %s", name, canonical, vector.JSON)
+	}
+	return nil
+}
+
+func definitions() []Vector {
+	signedNotice := &queue.SignedNotice{
+		Payload:   []byte(`{"id":"0102030405060708","kind":"degraded","message":"Délai de livraison élevé <10 min>","until":"2025-01-02T05:04:05Z","issued_at":"2025-01-02T03:04:05Z"}`),
+		Signature: bytes.Repeat([]byte{0x5a}, 64),
+		KeyID:     "0f1e2d3c4b5a6978",
+	}
+
+	// version | ephemeral key | nonce | box, with a two-byte message
+	sealedEnvelope := append([]byte{queue.SealedEnvelopeVersion}, bytes.Repeat([]byte{0x11}, 32)...)
+	sealedEnvelope = append(sealedEnvelope, bytes.Repeat([]byte{0x22}, 24)...)
+	sealedEnvelope = append(sealedEnvelope, bytes.Repeat([]byte{0x33}, 18)...)
+
+	attenuated := macaroon.New(macaroonRootKey, queueID)
+	for _, caveat := range macaroonCaveats {
+		attenuated.AddCaveat(caveat)
+	}
+
+	return []Vector{
+		// Requests
+		{
+			Name: "create_queue.request.empty", Kind: KindRequest, Endpoint: "POST /v1/queue/create",
+			Description: "Empty object; an empty body is accepted too",
+			Value:       queue.CreateQueueRequest{},
+		},
+		{
+			Name: "create_queue.request.all_options", Kind: KindRequest, Endpoint: "POST /v1/queue/create",
+			Description: "Every optional field set",
+			Value: queue.CreateQueueRequest{
+				RequireSendToken: true,
+				BurnAfterRead:    true,
+				TTL:              3600,
+				MaxMessages:      10,
+				MaxMessageSize:   65536,
+			},
+		},
+		{
+			Name: "send.request.text", Kind: KindRequest, Endpoint: "POST /v1/queue/{id}/send",
+			Description: "Payload bytes are standard base64 with padding",
+			Value:       queue.SendMessageRequest{Payload: []byte("hello")},
+		},
+		{
+			Name: "send.request.binary_payload", Kind: KindRequest, Endpoint: "POST /v1/queue/{id}/send",
+			Description: "Bytes that produce '+' and '/' in base64 must not be URL-safe encoded",
+			Value:       queue.SendMessageRequest{Payload: []byte{0x00, 0xfb, 0xff, 0xfe, 0x3e, 0x3f}},
+		},
+		{
+			Name: "send.request.empty_payload", Kind: KindRequest, Endpoint: "POST /v1/queue/{id}/send",
+			Description: "Empty payload is the empty string, not null",
+			Value:       queue.SendMessageRequest{Payload: []byte{}},
+		},
+		{
+			Name: "send.request.null_payload", Kind: KindRequest, Endpoint: "POST /v1/queue/{id}/send",
+			Description: "A missing payload decodes as null; the relay stores it as empty",
+			Value:       queue.SendMessageRequest{},
+		},
+		{
+			Name: "send.request.ttl", Kind: KindRequest, Endpoint: "POST /v1/queue/{id}/send",
+			Description: "Self-destructing message with a sender-chosen lifetime",
+			Value:       queue.SendMessageRequest{Payload: []byte("burn"), TTLSeconds: 300},
+		},
+		{
+			Name: "send.request.sealed_envelope", Kind: KindRequest, Endpoint: "POST /v1/queue/{id}/send",
+			Description: "Sealed-sender envelope: version 0x01, ephemeral X25519 key, nonce, then the box; nothing outside the box names the sender",
+			Value:       queue.SendMessageRequest{Payload: sealedEnvelope},
+		},
+		{
+			Name: "send_batch.request", Kind: KindRequest, Endpoint: "POST /v1/queue/{id}/send-batch",
+			Value: queue.BatchSendRequest{Messages: []queue.SendMessageRequest{
+				{Payload: []byte("hello")},
+				{Payload: []byte{0x00, 0xfb, 0xff}, TTLSeconds: 3600},
+			}},
+		},
+		{
+			Name: "ack_batch.request", Kind: KindRequest, Endpoint: "POST /v1/queue/{id}/ack",
+			Value: queue.BatchAckRequest{MessageIDs: []string{messageID, "ffeeddccbbaa99887766554433221100"}},
+		},
+		{
+			Name: "farewell.request", Kind: KindRequest, Endpoint: "PUT /v1/queue/{id}/farewell",
+			Value: queue.FarewellRequest{Payload: []byte{0x00, 0xfb, 0xff}},
+		},
+		{
+			Name: "mint_token.request.scoped", Kind: KindRequest, Endpoint: "POST /v1/queue/{id}/tokens",
+			Value: queue.MintTokenRequest{Scopes: []queue.Capability{queue.CapReceive}},
+		},
+		{
+			Name: "send_links.request", Kind: KindRequest, Endpoint: "POST /v1/queue/{id}/send-links",
+			Value: queue.SendLinksRequest{Count: 2, TTLSeconds: 86400},
+		},
+		{
+			Name: "create_upload.request", Kind: KindRequest, Endpoint: "POST /v1/queue/{id}/uploads",
+			Value: queue.CreateUploadRequest{Size: 4194304, TTLSeconds: 3600},
+		},
+
+		// Responses
+		{
+			Name: "create_queue.response", Kind: KindResponse, Endpoint: "POST /v1/queue/create",
+			Value: queue.CreateQueueResponse{
+				QueueID:        queueID,
+				AccessToken:    accessToken,
+				QueueURL:       "/v1/queue/" + queueID,
+				ExpiresAt:      epoch.Add(queue.QueueTTL),
+				MaxMessages:    queue.MaxMessagesInQueue,
+				MaxMessageSize: queue.MaxMessageSize,
+			},
+		},
+		{
+			Name: "create_queue.response.send_token", Kind: KindResponse, Endpoint: "POST /v1/queue/create",
+			Description: "Queue created with require_send_token",
+			Value: queue.CreateQueueResponse{
+				QueueID:        queueID,
+				AccessToken:    accessToken,
+				SendToken:      sendToken,
+				QueueURL:       "/v1/queue/" + queueID,
+				ExpiresAt:      epoch.Add(time.Hour),
+				MaxMessages:    10,
+				MaxMessageSize: 65536,
+			},
+		},
+		{
+			Name: "send.response", Kind: KindResponse, Endpoint: "POST /v1/queue/{id}/send",
+			Value: queue.SendMessageResponse{
+				MessageID:   messageID,
+				Seq:         42,
+				SentAt:      epoch,
+				ExpiresAt:   epoch.Add(queue.MessageTTL),
+				PayloadHash: queue.PayloadHash([]byte("hello")),
+			},
+		},
+		{
+			Name: "send_batch.response.partial", Kind: KindResponse, Endpoint: "POST /v1/queue/{id}/send-batch",
+			Description: "HTTP 207: the first item was stored, the second hit the queue limit and is not rolled back",
+			Value: queue.BatchResponse{
+				Results: []queue.BatchItemResult{
+					{Index: 0, Status: 201, Message: &queue.SendMessageResponse{
+						MessageID:   messageID,
+						Seq:         42,
+						SentAt:      epoch,
+						ExpiresAt:   epoch.Add(queue.MessageTTL),
+						PayloadHash: queue.PayloadHash([]byte("hello")),
+					}},
+					{Index: 1, Status: 429, Error: "queue is full"},
+				},
+				Succeeded: 1,
+				Failed:    1,
+			},
+		},
+		{
+			Name: "ack_batch.response", Kind: KindResponse, Endpoint: "POST /v1/queue/{id}/ack",
+			Value: queue.BatchResponse{
+				Results:   []queue.BatchItemResult{{Index: 0, Status: 204}, {Index: 1, Status: 204}},
+				Succeeded: 2,
+			},
+		},
+		{
+			Name: "send.response.queue_gone", Kind: KindResponse, Endpoint: "POST /v1/queue/{id}/send",
+			Description: "HTTP 410 for a deleted or expired queue whose owner left a farewell",
+			Value:       queue.QueueGoneResponse{Error: "queue gone", Farewell: []byte{0x00, 0xfb, 0xff}},
+		},
+		{
+			Name: "receive.response.empty", Kind: KindResponse, Endpoint: "GET /v1/queue/{id}/receive",
+			Description: "No messages is an empty array, never null; next_cursor is always set",
+			Value:       queue.ReceiveMessagesResponse{Messages: []queue.Message{}, NextCursor: queue.EncodeCursor(0)},
+		},
+		{
+			Name: "receive.response.messages", Kind: KindResponse, Endpoint: "GET /v1/queue/{id}/receive",
+			Description: "A system notice followed by an ordinary message",
+			Value: queue.ReceiveMessagesResponse{
+				Messages: []queue.Message{
+					{
+						ID:         "notice-0102030405060708",
+						QueueID:    queueID,
+						Payload:    mustJSON(signedNotice),
+						ReceivedAt: epoch,
+						ExpiresAt:  epoch.Add(2 * time.Hour),
+						System:     true,
+					},
+					{
+						ID:         messageID,
+						QueueID:    queueID,
+						Seq:        42,
+						Payload:    []byte{0x00, 0xfb, 0xff},
+						ReceivedAt: epoch,
+						ExpiresAt:  epoch.Add(queue.MessageTTL),
+
+						PayloadHash: queue.PayloadHash([]byte{0x00, 0xfb, 0xff}),
+					},
+				},
+				HasMore:    true,
+				NextCursor: queue.EncodeCursor(42),
+			},
+		},
+		{
+			Name: "receive.response.sealed_sender", Kind: KindResponse, Endpoint: "GET /v1/queue/{id}/receive",
+			Description: "On a sealed-sender queue the message is the envelope as sent, with no sender_id even when a member token sent it",
+			Value: queue.ReceiveMessagesResponse{
+				Messages: []queue.Message{
+					{
+						ID:         messageID,
+						QueueID:    queueID,
+						Seq:        7,
+						Payload:    sealedEnvelope,
+						ReceivedAt: epoch,
+						ExpiresAt:  epoch.Add(queue.MessageTTL),
+
+						PayloadHash: queue.PayloadHash(sealedEnvelope),
+					},
+				},
+				NextCursor: queue.EncodeCursor(7),
+			},
+		},
+		{
+			Name: "receive.response.count_only", Kind: KindResponse, Endpoint: "GET /v1/queue/{id}/receive",
+			Description: "?count_only=true counts pending messages past the cursor without delivering them",
+			Value:       queue.ReceiveCountResponse{Count: 3, NextCursor: queue.EncodeCursor(42)},
+		},
+		{
+			Name: "queue_info.response", Kind: KindResponse, Endpoint: "GET /v1/queue/{id}/info",
+			Value: queue.QueueInfoResponse{
+				MessageCount: 2,
+				TotalBytes:   5 * 1024 * 1024,
+				CreatedAt:    epoch,
+				ExpiresAt:    epoch.Add(queue.QueueTTL),
+				LastActive:   epoch.Add(time.Minute),
+			},
+		},
+		{
+			Name: "purge_messages.response", Kind: KindResponse, Endpoint: "DELETE /v1/queue/{id}/messages",
+			Value: queue.PurgeMessagesResponse{Purged: 2},
+		},
+		{
+			Name: "upload.response.in_progress", Kind: KindResponse, Endpoint: "PATCH /v1/queue/{id}/uploads/{upload_id}",
+			Description: "Offset is also sent as the Upload-Offset header; resume by appending from it",
+			Value: queue.UploadStatus{
+				UploadID:  messageID,
+				Size:      4194304,
+				Offset:    1048576,
+				ExpiresAt: epoch.Add(queue.UploadTTL),
+			},
+		},
+		{
+			Name: "mint_token.response", Kind: KindResponse, Endpoint: "POST /v1/queue/{id}/tokens",
+			Value: queue.MintTokenResponse{
+				TokenID:     "0011223344556677",
+				AccessToken: accessToken,
+				Scopes:      queue.DefaultMintScopes,
+				ExpiresAt:   epoch.Add(queue.QueueTTL),
+			},
+		},
+		{
+			Name: "list_tokens.response", Kind: KindResponse, Endpoint: "GET /v1/queue/{id}/tokens",
+			Value: queue.ListTokensResponse{Tokens: []queue.TokenInfo{
+				{TokenID: "0011223344556677", Scopes: queue.AllCapabilities},
+			}},
+		},
+		{
+			Name: "send_links.response", Kind: KindResponse, Endpoint: "POST /v1/queue/{id}/send-links",
+			Value: queue.SendLinksResponse{
+				SendURL: "/v1/queue/" + queueID + "/send",
+				Links:   []queue.SendLink{{SendToken: sendToken, ExpiresAt: epoch.Add(24 * time.Hour)}},
+			},
+		},
+		{
+			Name: "journal.response", Kind: KindResponse, Endpoint: "GET /v1/queue/{id}/journal",
+			Value: queue.JournalResponse{
+				Events: []queue.JournalEvent{
+					{Type: queue.EventStored, MessageID: messageID, At: epoch},
+					{Type: queue.EventFetched, MessageID: messageID, At: epoch.Add(time.Second)},
+				},
+				Retention: 3600,
+			},
+		},
+		{
+			Name: "time.response", Kind: KindResponse, Endpoint: "GET /v1/time",
+			Description: "Payload is the exact signed ServerTime JSON, base64 encoded",
+			Value: queue.SignedTime{
+				Payload:   []byte(`{"time":"2025-01-02T03:04:05Z","nonce":"b64-nonce_01","max_skew_seconds":300}`),
+				Signature: bytes.Repeat([]byte{0x5a}, 64),
+				KeyID:     "0f1e2d3c4b5a6978",
+				PublicKey: bytes.Repeat([]byte{0x3c}, 32),
+			},
+		},
+
+		// WebSocket frames
+		{
+			Name: "ws.hello", Kind: KindWSFrame, Endpoint: "/v1/ws",
+			Description: "First frame the relay sends; protocol is the negotiated subprotocol",
+			Value:       queue.WSMessage{Type: queue.WSTypeHello, Protocol: queue.WSProtocol, Timestamp: epoch},
+		},
+		{
+			Name: "ws.subscribe", Kind: KindWSFrame, Endpoint: "/v1/ws",
+			Value: queue.WSMessage{Type: queue.WSTypeSubscribe, QueueID: queueID, AccessToken: accessToken, Timestamp: epoch},
+		},
+		{
+			Name: "ws.subscribe.cursor", Kind: KindWSFrame, Endpoint: "/v1/ws",
+			Description: "Only messages after the cursor are pushed as backlog; without one every queued message is",
+			Value:       queue.WSMessage{Type: queue.WSTypeSubscribe, QueueID: queueID, AccessToken: accessToken, Cursor: queue.EncodeCursor(41), Timestamp: epoch},
+		},
+		{
+			Name: "ws.subscribe.macaroon", Kind: KindWSFrame, Endpoint: "/v1/ws",
+			Description: "A macaroon goes wherever an access token does; this one is minted for the queue with 32 bytes of 0x6d as root key, then narrowed to receive and ack for an hour",
+			Value:       queue.WSMessage{Type: queue.WSTypeSubscribe, QueueID: queueID, AccessToken: attenuated.Encode(), Timestamp: epoch},
+		},
+		{
+			Name: "ws.unsubscribe", Kind: KindWSFrame, Endpoint: "/v1/ws",
+			Value: queue.WSMessage{Type: queue.WSTypeUnsubscribe, QueueID: queueID, Timestamp: epoch},
+		},
+		{
+			Name: "ws.ack", Kind: KindWSFrame, Endpoint: "/v1/ws",
+			Value: queue.WSMessage{Type: queue.WSTypeAck, QueueID: queueID, AccessToken: accessToken, MessageID: messageID, Timestamp: epoch},
+		},
+		{
+			Name: "ws.ping.zero_timestamp", Kind: KindWSFrame, Endpoint: "/v1/ws",
+			Description: "Clients may omit the timestamp; Go encodes the zero time as year 1",
+			Value:       queue.WSMessage{Type: queue.WSTypePing},
+		},
+		{
+			Name: "ws.pong", Kind: KindWSFrame, Endpoint: "/v1/ws",
+			Value: queue.WSMessage{Type: queue.WSTypePong, Timestamp: epoch},
+		},
+		{
+			Name: "ws.message", Kind: KindWSFrame, Endpoint: "/v1/ws",
+			Value: queue.WSMessage{
+				Type:        queue.WSTypeMessage,
+				QueueID:     queueID,
+				MessageID:   messageID,
+				Seq:         42,
+				Cursor:      queue.EncodeCursor(42),
+				Payload:     []byte("hello"),
+				PayloadHash: queue.PayloadHash([]byte("hello")),
+				Timestamp:   epoch,
+			},
+		},
+		{
+			Name: "ws.error", Kind: KindWSFrame, Endpoint: "/v1/ws",
+			Value: queue.WSMessage{Type: queue.WSTypeError, QueueID: queueID, Code: 401, Error: "invalid access token", Timestamp: epoch},
+		},
+		{
+			Name: "ws.error.malformed", Kind: KindWSFrame, Endpoint: "/v1/ws",
+			Description: "Answers a frame that is not valid JSON; the connection stays open",
+			Value:       queue.WSMessage{Type: queue.WSTypeError, Code: 400, Error: "malformed frame", Timestamp: epoch},
+		},
+		{
+			Name: "ws.notice", Kind: KindWSFrame, Endpoint: "/v1/ws",
+			Description: "Notice payload is the exact signed JSON bytes, base64 encoded; it contains non-ASCII and '<' '>'",
+			Value:       queue.WSMessage{Type: queue.WSTypeNotice, Notice: signedNotice, Timestamp: epoch},
+		},
+	}
+}
+
+func mustJSON(v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
@@ -0,0 +1,260 @@
+package testvectors
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+
+	"privmsg-relay/internal/macaroon"
+	"privmsg-relay/internal/pbwire"
+	"privmsg-relay/internal/queue"
+	"privmsg-relay/internal/wirefmt"
+)
+
+// committed loads vectors.json as shipped to client implementations
+func committed(t *testing.T) map[string]Vector {
+	t.Helper()
+	data, err := os.ReadFile("vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		Vectors []Vector `json:"vectors"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]Vector, len(file.Vectors))
+	for _, vector := range file.Vectors {
+		byName[vector.Name] = vector
+	}
+	return byName
+}
+
+// all returns the vectors built from the current wire types
+func all(t *testing.T) []Vector {
+	t.Helper()
+	vectors, err := All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vectors
+}
+
+// decodeAs decodes a vector's JSON into a fresh value of its Go type
+func decodeAs(t *testing.T, vector Vector) interface{} {
+	t.Helper()
+	target := reflect.New(reflect.TypeOf(vector.Value))
+	if err := json.Unmarshal([]byte(vector.JSON), target.Interface()); err != nil {
+		t.Fatalf("decoding %s: %v", vector.Name, err)
+	}
+	return target.Interface()
+}
+
+// canonicalJSON encodes v canonically
+func canonicalJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	canonical, _, err := Encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(canonical)
+}
+
+// nilEmptyBytes replaces every empty byte slice reachable from v with nil
+func nilEmptyBytes(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			nilEmptyBytes(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				nilEmptyBytes(v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Len() == 0 && v.CanSet() {
+				v.SetZero()
+			}
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			nilEmptyBytes(v.Index(i))
+		}
+	}
+}
+
+func TestVectorsFileIsCurrent(t *testing.T) {
+	file := committed(t)
+	vectors := all(t)
+	if len(file) != len(vectors) {
+		t.Errorf("vectors.json has %d vectors, the wire types give %d", len(file), len(vectors))
+	}
+	for _, vector := range vectors {
+		shipped, ok := file[vector.Name]
+		if !ok {
+			t.Errorf("%s is missing from vectors.json", vector.Name)
+			continue
+		}
+		if shipped.JSON != vector.JSON || shipped.CBORHex != vector.CBORHex {
+			t.Errorf("%s drifted from vectors.json; regenerate it with go run ./cmd/testvectors", vector.Name)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, vector := range all(t) {
+		t.Run(vector.Name, func(t *testing.T) {
+			decoded := decodeAs(t, vector)
+			canonical, cbor, err := Encode(decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(canonical) != vector.JSON {
+				t.Errorf("re-encoded JSON:\n got: %s\nwant: %s", canonical, vector.JSON)
+			}
+			if hex.EncodeToString(cbor) != vector.CBORHex {
+				t.Errorf("re-encoded CBOR differs from the vector")
+			}
+		})
+	}
+}
+
+func TestWireFormats(t *testing.T) {
+	formats := []struct {
+		name      string
+		marshal   func(interface{}) ([]byte, error)
+		unmarshal func([]byte, interface{}) error
+		emptyNil  bool // proto3 cannot tell empty bytes from absent ones
+	}{
+		{"cbor", wirefmt.MarshalCBOR, wirefmt.UnmarshalCBOR, false},
+		{"msgpack", wirefmt.MarshalMsgPack, wirefmt.UnmarshalMsgPack, false},
+		{"protobuf", pbwire.Marshal, pbwire.Unmarshal, true},
+	}
+	for _, format := range formats {
+		for _, vector := range all(t) {
+			t.Run(format.name+"/"+vector.Name, func(t *testing.T) {
+				value := decodeAs(t, vector)
+				data, err := format.marshal(value)
+				if errors.Is(err, pbwire.ErrUnsupported) {
+					t.Skip("no protobuf encoding")
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				decoded := reflect.New(reflect.TypeOf(vector.Value)).Interface()
+				if err := format.unmarshal(data, decoded); err != nil {
+					t.Fatal(err)
+				}
+				want := vector.JSON
+				if format.emptyNil {
+					expected := decodeAs(t, vector)
+					nilEmptyBytes(reflect.ValueOf(expected).Elem())
+					want = canonicalJSON(t, expected)
+				}
+				if got := canonicalJSON(t, decoded); got != want {
+					t.Errorf("after a %s round trip:\n got: %s\nwant: %s", format.name, got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestCursors(t *testing.T) {
+	for _, vector := range all(t) {
+		// The cursor each vector carries, and the sequence number it must
+		// name when the vector says (-1 when it does not)
+		var cursor string
+		want := int64(-1)
+		switch value := vector.Value.(type) {
+		case queue.ReceiveMessagesResponse:
+			cursor, want = value.NextCursor, 0
+			for _, message := range value.Messages {
+				want = max(want, message.Seq)
+			}
+		case queue.ReceiveCountResponse:
+			cursor = value.NextCursor
+		case queue.WSMessage:
+			cursor = value.Cursor
+			if value.Type == queue.WSTypeMessage {
+				want = value.Seq
+			}
+		}
+		if cursor == "" {
+			continue
+		}
+
+		t.Run(vector.Name, func(t *testing.T) {
+			seq, err := queue.DecodeCursor(cursor)
+			if err != nil {
+				t.Fatalf("DecodeCursor(%q): %v", cursor, err)
+			}
+			if want >= 0 && seq != want {
+				t.Errorf("cursor %q names seq %d, want %d", cursor, seq, want)
+			}
+			if again := queue.EncodeCursor(seq); again != cursor {
+				t.Errorf("EncodeCursor(%d) = %q, want %q", seq, again, cursor)
+			}
+		})
+	}
+}
+
+func TestMacaroonVector(t *testing.T) {
+	vector, ok := committed(t)["ws.subscribe.macaroon"]
+	if !ok {
+		t.Fatal("vectors.json has no macaroon vector")
+	}
+	var frame queue.WSMessage
+	if err := json.Unmarshal([]byte(vector.JSON), &frame); err != nil {
+		t.Fatal(err)
+	}
+
+	mac, err := macaroon.Decode(frame.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mac.ID != frame.QueueID {
+		t.Errorf("macaroon ID = %q, want the queue ID %q", mac.ID, frame.QueueID)
+	}
+	if mac.Encode() != frame.AccessToken {
+		t.Error("macaroon does not re-encode to the vector's token")
+	}
+
+	var seen []string
+	err = mac.Verify(macaroonRootKey, func(caveat string) error {
+		seen = append(seen, caveat)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Verify with the vector's root key: %v", err)
+	}
+	if !slices.Equal(seen, macaroonCaveats) {
+		t.Errorf("caveats = %q, want %q", seen, macaroonCaveats)
+	}
+
+	wrongKey := bytes.Repeat([]byte{0x6e}, 32)
+	if err := mac.Verify(wrongKey, func(string) error { return nil }); !errors.Is(err, macaroon.ErrBadSignature) {
+		t.Errorf("Verify with another key: %v, want %v", err, macaroon.ErrBadSignature)
+	}
+
+	// Attenuating it further must chain from the vector's signature
+	narrowed, err := macaroon.Attenuate(frame.AccessToken, "op = receive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := macaroon.Decode(narrowed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Verify(macaroonRootKey, func(string) error { return nil }); err != nil {
+		t.Errorf("Verify after attenuating: %v", err)
+	}
+}
@@ -6,6 +6,7 @@
  * Notifications are created by the main app when the tab is in the background.
  * This worker only handles:
  * - App shell caching for offline support
+ * - Web Push wake-ups from the relay (content-free, shown as "Nová správa")
  * - Notification click handling (focus window & navigate)
  */
 
@@ -103,6 +104,27 @@ self.addEventListener('fetch', (event) => {
   );
 });
 
+// Push event - the relay signals that a queue has new messages
+// The push carries no content; the app fetches and decrypts when opened
+self.addEventListener('push', (event) => {
+  console.log('[SW] Push received');
+
+  event.waitUntil(
+    clients.matchAll({ type: 'window', includeUncontrolled: true })
+      .then(clientList => {
+        // A visible tab receives the message over WebSocket and notifies itself
+        if (clientList.some(client => client.visibilityState === 'visible')) {
+          return;
+        }
+        return self.registration.showNotification('Nová správa', {
+          body: 'Otvorte aplikáciu na zobrazenie správy',
+          icon: '/icons/icon-192x192.png',
+          tag: 'privmsg-wake', // Replaces the previous wake-up notification
+        });
+      })
+  );
+});
+
 // Notification click event - focus window and navigate to conversation
 self.addEventListener('notificationclick', (event) => {
   console.log('[SW] Notification clicked');
@@ -15,12 +15,20 @@ import {
   type NotificationSettings,
 } from '../utils/notificationManager';
 import { isServiceWorkerActive } from '../utils/serviceWorker';
+import {
+  isWebPushSupported,
+  getPushSubscription,
+  enableWebPush,
+  disableWebPush,
+} from '../utils/webPush';
+import { DEFAULT_RELAY_URL } from '../network/api';
 
 export function SettingsView() {
   const { setView } = useAppStore();
   const [settings, setSettings] = useState<NotificationSettings | null>(null);
   const [permissionState, setPermissionState] = useState<NotificationPermission>('default');
   const [isPWAInstalled, setIsPWAInstalled] = useState(false);
+  const [webPushEnabled, setWebPushEnabled] = useState(false);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
 
@@ -37,6 +45,7 @@ export function SettingsView() {
 
       setSettings(currentSettings);
       setPermissionState(permission);
+      setWebPushEnabled((await getPushSubscription()) !== null);
 
       // Check if PWA is installed
       const isInstalled = isServiceWorkerActive() ||
@@ -76,6 +85,25 @@ export function SettingsView() {
     }
   }
 
+  async function handleToggleWebPush(enabled: boolean) {
+    try {
+      setError(null);
+      if (enabled) {
+        const available = await enableWebPush(DEFAULT_RELAY_URL);
+        if (!available) {
+          setError('Server nepodporuje notifikácie pri zatvorenej karte');
+          return;
+        }
+      } else {
+        await disableWebPush();
+      }
+      setWebPushEnabled(enabled);
+    } catch (err) {
+      console.error('Failed to toggle Web Push:', err);
+      setError('Nepodarilo sa zmeniť nastavenie notifikácií pri zatvorenej karte');
+    }
+  }
+
   async function handleRequestPermission() {
     try {
       setError(null);
@@ -214,6 +242,23 @@ export function SettingsView() {
                 </div>
               )}
 
+              {/* Web Push Toggle */}
+              {permissionState === 'granted' && isWebPushSupported() && (
+                <div className="settings-item">
+                  <label className="settings-toggle">
+                    <input
+                      type="checkbox"
+                      checked={webPushEnabled}
+                      onChange={(e) => handleToggleWebPush(e.target.checked)}
+                    />
+                    <span className="toggle-label">Notifikácie aj pri zatvorenej karte</span>
+                  </label>
+                  <p className="settings-help">
+                    Server pošle cez push službu prehliadača len signál bez obsahu správy
+                  </p>
+                </div>
+              )}
+
               {/* Test Notification */}
               {permissionState === 'granted' && (
                 <div className="settings-item">
@@ -0,0 +1,85 @@
+/**
+ * Onion wrapping for multi-hop sends
+ *
+ * A message routed through several relays is wrapped once per relay,
+ * innermost layer first. Each relay opens only its own layer, which names
+ * the next relay's region or, for the last relay, the destination queue,
+ * so no single relay sees both the sender and the queue.
+ *
+ * Layer: 0x01 | ephemeral public key (32) | nonce (24) | nacl.box(content)
+ * Content: 0x01 | region length | region | next layer   (forward)
+ *          0x02 | delivery JSON                         (deliver)
+ */
+
+import nacl from 'tweetnacl';
+import { encodeBase64 } from 'tweetnacl-util';
+
+const VERSION = 0x01;
+const KIND_FORWARD = 0x01;
+const KIND_DELIVER = 0x02;
+
+/**
+ * One relay on the route
+ */
+export interface OnionHop {
+  publicKey: Uint8Array;  // From GET /v1/onion/key on that relay
+  region: string;         // Name the previous relay forwards to it by (unused for the first hop)
+}
+
+/**
+ * What the last relay sends
+ */
+export interface OnionDelivery {
+  queueId: string;
+  sendToken?: string;
+  payload: Uint8Array;
+  ttlSeconds?: number;
+}
+
+function seal(relayKey: Uint8Array, content: Uint8Array): Uint8Array {
+  const ephemeral = nacl.box.keyPair();
+  const nonce = nacl.randomBytes(nacl.box.nonceLength);
+  const box = nacl.box(content, nonce, relayKey, ephemeral.secretKey);
+
+  const layer = new Uint8Array(1 + 32 + nonce.length + box.length);
+  layer[0] = VERSION;
+  layer.set(ephemeral.publicKey, 1);
+  layer.set(nonce, 33);
+  layer.set(box, 33 + nonce.length);
+  return layer;
+}
+
+/**
+ * Wrap a delivery for a route of 1 to 3 relays, first hop first
+ * POST the result to the first relay's /v1/onion
+ */
+export function wrapOnion(route: OnionHop[], delivery: OnionDelivery): Uint8Array {
+  if (route.length < 1 || route.length > 3) {
+    throw new Error('An onion route has 1 to 3 relays');
+  }
+
+  const json = new TextEncoder().encode(JSON.stringify({
+    queue_id: delivery.queueId,
+    send_token: delivery.sendToken,
+    payload: encodeBase64(delivery.payload),
+    ttl_seconds: delivery.ttlSeconds,
+  }));
+  const deliver = new Uint8Array(1 + json.length);
+  deliver[0] = KIND_DELIVER;
+  deliver.set(json, 1);
+  let layer = seal(route[route.length - 1].publicKey, deliver);
+
+  for (let i = route.length - 2; i >= 0; i--) {
+    const region = new TextEncoder().encode(route[i + 1].region);
+    if (region.length < 1 || region.length > 255) {
+      throw new Error('Region names are 1 to 255 bytes');
+    }
+    const forward = new Uint8Array(2 + region.length + layer.length);
+    forward[0] = KIND_FORWARD;
+    forward[1] = region.length;
+    forward.set(region, 2);
+    forward.set(layer, 2 + region.length);
+    layer = seal(route[i].publicKey, forward);
+  }
+  return layer;
+}
@@ -7,6 +7,7 @@
 import { createAPIClient, RelayAPI } from '../network/api';
 import { saveQueue, getQueue, type StoredQueue } from '../storage/db';
 import { generateRandomId } from '../crypto/identity';
+import { registerQueueForPush } from '../utils/webPush';
 
 /**
  * Queue information returned after creation
@@ -48,6 +49,11 @@ export async function createReceiveQueue(relayUrl: string): Promise<QueueInfo> {
 
     await saveQueue(storedQueue);
 
+    // Wake this browser for the new queue too (no-op without Web Push)
+    registerQueueForPush(storedQueue).catch(error => {
+      console.error('Failed to register new queue for Web Push:', error);
+    });
+
     return queueInfo;
   } catch (error) {
     console.error('Failed to create queue:', error);
@@ -6,6 +6,10 @@
  * - Sending messages
  * - Receiving messages
  * - Deleting queues
+ * - Publishing and claiming prekey bundles
+ * - Contact discovery by hashed identifier
+ * - Onion-routed sends through several relays
+ * - Registering Web Push subscriptions
  */
 
 /**
@@ -21,6 +25,7 @@ export interface CreateQueueResponse {
 export interface SendMessageResponse {
   message_id: string;
   sent_at: string;
+  receipt_token?: string;  // Poll /v1/receipt/{token} for delivery status
 }
 
 export interface ReceiveMessagesResponse {
@@ -33,6 +38,63 @@ export interface ReceiveMessagesResponse {
   has_more: boolean;
 }
 
+export interface PushRegistration {
+  id: string;
+  platform: string;
+  tag?: string;
+  created_at: string;
+}
+
+// Keys are base64 encoded, like KeyBundle in crypto/identity
+export interface Prekey {
+  key_id: number;
+  public_key: string;
+}
+
+export interface SignedPrekey extends Prekey {
+  signature: string;  // Not checked by the relay; verify it against identity_key
+}
+
+export interface PrekeyUpload {
+  identity_key?: string;
+  signed_prekey?: SignedPrekey;
+  one_time_prekeys?: Prekey[];
+}
+
+export interface PrekeyStatus {
+  identity_key: boolean;
+  signed_prekey: boolean;
+  one_time_prekeys: number;  // Not yet claimed
+}
+
+export interface PrekeyBundleResponse {
+  identity_key: string;
+  signed_prekey: SignedPrekey;
+  one_time_prekey?: Prekey;  // Absent once they run out
+}
+
+export interface DiscoveryInfo {
+  salt: string;         // Base64; hash identifiers as SHA-256(salt || identifier)
+  prefix_size: number;  // Bytes of the hash that name its bucket
+}
+
+export interface DiscoveryEntry {
+  tag: string;              // Hex hash bytes after the prefix
+  sealed_queue_id: string;  // Base64 nonce || AES-256-GCM ciphertext of the queue ID
+}
+
+export interface OnionKey {
+  public_key: string;  // Base64 X25519 key for this relay's layer
+  region?: string;     // Name other relays forward to this one by
+}
+
+export interface ServerInfo {
+  public_key: string;         // Base64 Ed25519 identity key; signs critical responses
+  key_id: string;
+  x25519_public_key: string;  // Base64 Montgomery form, for onion layers and Noise
+  region?: string;
+}
+
 /**
  * API Client configuration
  */
@@ -55,7 +117,7 @@ export class RelayAPI {
    * Create a new message queue
    */
   async createQueue(): Promise<CreateQueueResponse> {
-    const response = await fetch(`${this.baseUrl}/queue/create`, {
+    const response = await fetch(`${this.baseUrl}/v1/queue/create`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
@@ -73,7 +135,7 @@ export class RelayAPI {
    * Send a message to a queue
    */
   async sendMessage(queueId: string, payload: Uint8Array): Promise<SendMessageResponse> {
-    const url = `${this.baseUrl}/queue/${queueId}/send`;
+    const url = `${this.baseUrl}/v1/queue/${queueId}/send`;
     console.log(`🌐 API: Sending message to ${url}`, {
       queueId,
       payloadSize: payload.length,
@@ -132,7 +194,7 @@ export class RelayAPI {
     if (since) params.append('since', since);
     if (limit) params.append('limit', limit.toString());
 
-    const url = `${this.baseUrl}/queue/${queueId}/receive${params.toString() ? '?' + params.toString() : ''}`;
+    const url = `${this.baseUrl}/v1/queue/${queueId}/receive${params.toString() ? '?' + params.toString() : ''}`;
 
     const response = await fetch(url, {
       method: 'GET',
@@ -158,7 +220,7 @@ export class RelayAPI {
    * Delete a queue
    */
   async deleteQueue(queueId: string, accessToken: string): Promise<void> {
-    const response = await fetch(`${this.baseUrl}/queue/${queueId}`, {
+    const response = await fetch(`${this.baseUrl}/v1/queue/${queueId}`, {
       method: 'DELETE',
       headers: {
         'Authorization': `Bearer ${accessToken}`,
@@ -175,6 +237,209 @@ export class RelayAPI {
     }
   }
 
+  /**
+   * Opt a queue into presence queries, or back out (off by default)
+   */
+  async setPresence(queueId: string, accessToken: string, enabled: boolean): Promise<void> {
+    const response = await fetch(`${this.baseUrl}/v1/queue/${queueId}/presence`, {
+      method: enabled ? 'PUT' : 'DELETE',
+      headers: {
+        'Authorization': `Bearer ${accessToken}`,
+      },
+    });
+
+    if (!response.ok) {
+      throw new Error(`Failed to update presence: ${response.statusText}`);
+    }
+  }
+
+  /**
+   * Publish prekeys so senders can start a session without us online
+   */
+  async uploadPrekeys(queueId: string, accessToken: string, upload: PrekeyUpload): Promise<PrekeyStatus> {
+    const response = await fetch(`${this.baseUrl}/v1/queue/${queueId}/prekeys`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${accessToken}`,
+      },
+      body: JSON.stringify(upload),
+    });
+
+    if (!response.ok) {
+      throw new Error(`Failed to upload prekeys: ${response.statusText}`);
+    }
+
+    return response.json();
+  }
+
+  /**
+   * Claim a queue's prekey bundle, or null if its owner has not published one
+   * The one-time prekey in it is never handed to anyone else
+   */
+  async claimPrekeys(queueId: string, sendToken?: string): Promise<PrekeyBundleResponse | null> {
+    const response = await fetch(`${this.baseUrl}/v1/queue/${queueId}/prekeys/claim`, {
+      method: 'POST',
+      headers: sendToken ? { 'Authorization': `Bearer ${sendToken}` } : {},
+    });
+    if (response.status === 404) {
+      return null;
+    }
+    if (!response.ok) {
+      throw new Error(`Failed to claim prekeys: ${response.statusText}`);
+    }
+
+    return response.json();
+  }
+
+  /**
+   * Get the salt contact identifiers are hashed with
+   */
+  async getDiscoveryInfo(): Promise<DiscoveryInfo> {
+    const response = await fetch(`${this.baseUrl}/v1/discovery`);
+    if (!response.ok) {
+      throw new Error(`Failed to get discovery info: ${response.statusText}`);
+    }
+
+    return response.json();
+  }
+
+  /**
+   * Make a queue findable by hex identifier hashes, replacing earlier ones
+   */
+  async registerDiscovery(queueId: string, accessToken: string, hashes: string[]): Promise<void> {
+    const response = await fetch(`${this.baseUrl}/v1/queue/${queueId}/discovery`, {
+      method: 'PUT',
+      headers: {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${accessToken}`,
+      },
+      body: JSON.stringify({ hashes }),
+    });
+
+    if (!response.ok) {
+      throw new Error(`Failed to register for discovery: ${response.statusText}`);
+    }
+  }
+
+  /**
+   * Fetch whole discovery buckets by hex hash prefix
+   * Callers match tags and open sealed queue IDs themselves
+   */
+  async lookupDiscovery(prefixes: string[]): Promise<Record<string, DiscoveryEntry[]>> {
+    const response = await fetch(`${this.baseUrl}/v1/discovery/lookup`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ prefixes }),
+    });
+
+    if (!response.ok) {
+      if (response.status === 429) {
+        throw new Error('Rate limit exceeded');
+      }
+      throw new Error(`Failed to look up contacts: ${response.statusText}`);
+    }
+
+    const result = await response.json();
+    return result.buckets;
+  }
+
+  /**
+   * Get the relay's identity key, to pin on first contact
+   * Signed responses carry X-Privmsg-Signature over the request, status and body
+   */
+  async getServerInfo(): Promise<ServerInfo> {
+    const response = await fetch(`${this.baseUrl}/v1/server-info`);
+    if (!response.ok) {
+      throw new Error(`Failed to get server info: ${response.statusText}`);
+    }
+
+    return response.json();
+  }
+
+  /**
+   * Get the key this relay's onion layer is wrapped with
+   */
+  async getOnionKey(): Promise<OnionKey> {
+    const response = await fetch(`${this.baseUrl}/v1/onion/key`);
+    if (!response.ok) {
+      throw new Error(`Failed to get onion key: ${response.statusText}`);
+    }
+
+    return response.json();
+  }
+
+  /**
+   * Send an onion built with wrapOnion; this relay must be the route's first hop
+   * Only the status comes back, so there is no message ID or receipt
+   */
+  async sendOnion(onion: Uint8Array): Promise<void> {
+    const response = await fetch(`${this.baseUrl}/v1/onion`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/octet-stream',
+      },
+      body: onion,
+    });
+
+    if (!response.ok) {
+      throw new Error(`Failed to send onion: ${response.statusText}`);
+    }
+  }
+
+  /**
+   * Get the relay's VAPID public key, or null if Web Push is not enabled
+   */
+  async getVAPIDKey(): Promise<string | null> {
+    const response = await fetch(`${this.baseUrl}/v1/push/vapid-key`);
+    if (response.status === 404) {
+      return null;
+    }
+    if (!response.ok) {
+      throw new Error(`Failed to get VAPID key: ${response.statusText}`);
+    }
+
+    const result = await response.json();
+    return result.public_key;
+  }
+
+  /**
+   * Register a Web Push subscription to be woken when the queue receives a message
+   */
+  async registerPush(
+    queueId: string,
+    accessToken: string,
+    subscription: PushSubscriptionJSON,
+    tag?: string
+  ): Promise<PushRegistration> {
+    const response = await fetch(`${this.baseUrl}/v1/queue/${queueId}/push`, {
+      method: 'POST',
+      headers: {
+        'Authorization': `Bearer ${accessToken}`,
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({
+        platform: 'webpush',
+        token: subscription.endpoint,
+        keys: subscription.keys,
+        tag,
+      }),
+    });
+
+    if (!response.ok) {
+      if (response.status === 404) {
+        throw new Error('Queue not found');
+      } else if (response.status === 401) {
+        throw new Error('Invalid access token');
+      }
+      throw new Error(`Failed to register push: ${response.statusText}`);
+    }
+
+    return response.json();
+  }
+
   /**
    * Check server health
    */
@@ -15,8 +15,18 @@ export enum WSMessageType {
   ERROR = 'error',
   PING = 'ping',
   PONG = 'pong',
+  HELLO = 'hello',
+  NOTICE = 'notice',
+  SIGNAL = 'signal',
+  PRESENCE = 'presence',
+  COVER = 'cover',
 }
 
+/**
+ * WebSocket subprotocol spoken by this client
+ */
+export const WS_PROTOCOL = 'privmsg.v1';
+
 /**
  * WebSocket message structure
  */
@@ -25,11 +35,22 @@ export interface WSMessage {
   queue_id?: string;
   access_token?: string;
   message_id?: string;
+  cursor?: string; // Subscribe: resume after this cursor; message: cursor after it
   payload?: string; // Base64-encoded payload from Go server
   error?: string;
+  code?: number; // HTTP status matching an error frame
+  protocol?: string; // Hello: the negotiated subprotocol
+  online?: boolean; // Presence answer: the queue has a connected subscriber
+  interval?: number; // Cover request: mean seconds between decoys (0 stops them)
   timestamp: string;
 }
 
+/**
+ * Padding in the decoy sent back for each relay decoy, so the answers look
+ * like acks on the wire
+ */
+const COVER_REPLY_BYTES = 128;
+
 /**
  * Message callback type
  */
@@ -39,6 +60,16 @@ export type MessageCallback = (message: {
   payload: Uint8Array;
 }) => void;
 
+/**
+ * Signal callback type (ephemeral payloads: typing, read receipts, call setup)
+ */
+export type SignalCallback = (signal: { queueId: string; payload: Uint8Array }) => void;
+
+/**
+ * Presence callback type
+ */
+export type PresenceCallback = (presence: { queueId: string; online: boolean }) => void;
+
 /**
  * Error callback type
  */
@@ -55,8 +86,11 @@ export class WebSocketClient {
   private reconnectDelay = 1000; // Start with 1 second
   private reconnectTimer: ReturnType<typeof setTimeout> | null = null;
   private pingInterval: ReturnType<typeof setInterval> | null = null;
-  private subscriptions = new Map<string, { accessToken: string; callback: MessageCallback }>();
+  private subscriptions = new Map<string, { accessToken: string; callback: MessageCallback; cursor?: string }>();
   private onErrorCallback: ErrorCallback | null = null;
+  private onSignalCallback: SignalCallback | null = null;
+  private onPresenceCallback: PresenceCallback | null = null;
+  private coverInterval = 0; // Mean seconds between relay decoys (0 = none)
 
   constructor(relayUrl: string) {
     // Convert HTTP/HTTPS URL to WebSocket URL (ws/wss)
@@ -68,7 +102,7 @@ export class WebSocketClient {
       // Already a ws:// or wss:// URL
       this.relayUrl = relayUrl;
     }
-    console.log(`WebSocket will connect to: ${this.relayUrl}/ws`);
+    console.log(`WebSocket will connect to: ${this.relayUrl}/v1/ws`);
   }
 
   /**
@@ -77,7 +111,7 @@ export class WebSocketClient {
   connect(): Promise<void> {
     return new Promise((resolve, reject) => {
       try {
-        this.ws = new WebSocket(`${this.relayUrl}/ws`);
+        this.ws = new WebSocket(`${this.relayUrl}/v1/ws`, [WS_PROTOCOL]);
 
         this.ws.onopen = () => {
           console.log('WebSocket connected');
@@ -89,6 +123,9 @@ export class WebSocketClient {
 
           // Resubscribe to all queues
           this.resubscribeAll();
+          if (this.coverInterval > 0) {
+            this.requestCoverTraffic(this.coverInterval);
+          }
 
           resolve();
         };
@@ -102,9 +139,15 @@ export class WebSocketClient {
           reject(error);
         };
 
-        this.ws.onclose = () => {
+        this.ws.onclose = (event) => {
           console.log('WebSocket closed');
           this.stopPingInterval();
+
+          // A restarting relay says when to come back (code 1012, service restart)
+          if (event.code === 1012) {
+            this.reconnectAfterRestart(event.reason);
+            return;
+          }
           this.attemptReconnect();
         };
       } catch (error) {
@@ -182,6 +225,62 @@ export class WebSocketClient {
     }
   }
 
+  /**
+   * Send an ephemeral signal to a queue's connections; it is never stored,
+   * so it is lost if nobody is connected
+   * sendToken is only needed for queues that require one
+   */
+  sendSignal(queueId: string, payload: Uint8Array, sendToken?: string): void {
+    this.sendMessage({
+      type: WSMessageType.SIGNAL,
+      queue_id: queueId,
+      access_token: sendToken,
+      payload: btoa(String.fromCharCode(...payload)),
+      timestamp: new Date().toISOString(),
+    });
+  }
+
+  /**
+   * Ask whether a queue's owner is connected; only answered for queues
+   * that opted into presence, and rate limited per queue
+   */
+  queryPresence(queueId: string, sendToken?: string): void {
+    this.sendMessage({
+      type: WSMessageType.PRESENCE,
+      queue_id: queueId,
+      access_token: sendToken,
+      timestamp: new Date().toISOString(),
+    });
+  }
+
+  /**
+   * Ask the relay for decoy frames at random times, intervalSeconds apart
+   * on average, so an observer cannot tell an active conversation from an
+   * idle one (0 stops them); kept across reconnects
+   */
+  requestCoverTraffic(intervalSeconds: number): void {
+    this.coverInterval = intervalSeconds;
+    this.sendMessage({
+      type: WSMessageType.COVER,
+      interval: intervalSeconds,
+      timestamp: new Date().toISOString(),
+    });
+  }
+
+  /**
+   * Set presence callback
+   */
+  onPresence(callback: PresenceCallback): void {
+    this.onPresenceCallback = callback;
+  }
+
+  /**
+   * Set signal callback
+   */
+  onSignal(callback: SignalCallback): void {
+    this.onSignalCallback = callback;
+  }
+
   /**
    * Set error callback
    */
@@ -213,10 +312,44 @@ export class WebSocketClient {
           this.handleIncomingMessage(message);
           break;
 
+        case WSMessageType.SIGNAL:
+          if (message.queue_id && message.payload && this.onSignalCallback) {
+            this.onSignalCallback({
+              queueId: message.queue_id,
+              payload: Uint8Array.from(atob(message.payload), (c) => c.charCodeAt(0)),
+            });
+          }
+          break;
+
+        case WSMessageType.PRESENCE:
+          if (message.queue_id && this.onPresenceCallback) {
+            this.onPresenceCallback({ queueId: message.queue_id, online: message.online === true });
+          }
+          break;
+
+        case WSMessageType.COVER:
+          // Answer like an ack, so our replies have cover too
+          this.sendMessage({
+            type: WSMessageType.COVER,
+            payload: btoa(String.fromCharCode(...crypto.getRandomValues(new Uint8Array(COVER_REPLY_BYTES)))),
+            timestamp: new Date().toISOString(),
+          });
+          break;
+
         case WSMessageType.PONG:
           // Pong received, connection is alive
           break;
 
+        case WSMessageType.HELLO:
+          if (message.protocol !== WS_PROTOCOL) {
+            console.warn('Relay speaks an unexpected protocol:', message.protocol);
+          }
+          break;
+
+        case WSMessageType.NOTICE:
+          // Operator notices are not shown by this client yet
+          break;
+
         case WSMessageType.ERROR:
           console.error('WebSocket error from server:', message.error);
           if (this.onErrorCallback) {
@@ -251,6 +384,11 @@ export class WebSocketClient {
         .map((c) => c.charCodeAt(0))
     );
 
+    // Remember where we got to so a resubscribe only replays newer messages
+    if (message.cursor) {
+      subscription.cursor = message.cursor;
+    }
+
     // Call the subscription callback
     subscription.callback({
       queueId: message.queue_id,
@@ -305,12 +443,30 @@ export class WebSocketClient {
     }, delay);
   }
 
+  private reconnectAfterRestart(reason: string): void {
+    let seconds = 1;
+    try {
+      seconds = JSON.parse(reason).reconnect_after ?? seconds;
+    } catch {
+      // Older relays send no hint
+    }
+
+    console.log(`Relay restarting, reconnecting in ${seconds}s`);
+    this.reconnectAttempts = 0;
+    this.reconnectTimer = setTimeout(() => {
+      this.connect().catch((error) => {
+        console.error('Reconnect failed:', error);
+      });
+    }, seconds * 1000);
+  }
+
   private resubscribeAll(): void {
-    for (const [queueId, { accessToken }] of this.subscriptions) {
+    for (const [queueId, { accessToken, cursor }] of this.subscriptions) {
       this.sendMessage({
         type: WSMessageType.SUBSCRIBE,
         queue_id: queueId,
         access_token: accessToken,
+        cursor,
         timestamp: new Date().toISOString(),
       });
     }
@@ -355,6 +355,16 @@ export async function getQueue(queueId: string): Promise<StoredQueue | undefined
   return db.queues.get(queueId);
 }
 
+/**
+ * Get queues that have not expired
+ */
+export async function getActiveQueues(): Promise<StoredQueue[]> {
+  return db.queues
+    .where('expiresAt')
+    .above(new Date())
+    .toArray();
+}
+
 /**
  * Delete expired queues
  */
@@ -0,0 +1,114 @@
+/**
+ * Web Push
+ *
+ * Subscribes the browser to the relay's Web Push wake-ups so new messages
+ * are announced even when the tab is closed.
+ * Privacy: the push carries no message content, and it is encrypted to this
+ * browser, so the browser's push service learns only that something arrived.
+ */
+
+import { createAPIClient } from '../network/api';
+import { getActiveQueues, type StoredQueue } from '../storage/db';
+
+/**
+ * Check if the browser supports Web Push
+ */
+export function isWebPushSupported(): boolean {
+  return 'serviceWorker' in navigator && 'PushManager' in window;
+}
+
+/**
+ * Get the current push subscription, if any
+ */
+export async function getPushSubscription(): Promise<PushSubscription | null> {
+  if (!isWebPushSupported()) {
+    return null;
+  }
+  const registration = await navigator.serviceWorker.ready;
+  return registration.pushManager.getSubscription();
+}
+
+/**
+ * Subscribe to Web Push and register every active queue with its relay
+ * Returns false if the relay does not offer Web Push
+ */
+export async function enableWebPush(relayUrl: string): Promise<boolean> {
+  if (!isWebPushSupported()) {
+    return false;
+  }
+
+  const api = createAPIClient(relayUrl);
+  const vapidKey = await api.getVAPIDKey();
+  if (!vapidKey) {
+    console.log('Relay does not offer Web Push');
+    return false;
+  }
+
+  const registration = await navigator.serviceWorker.ready;
+  let subscription = await registration.pushManager.getSubscription();
+  if (subscription && !sameKey(subscription, vapidKey)) {
+    // Relay key changed - the old subscription can no longer be used
+    await subscription.unsubscribe();
+    subscription = null;
+  }
+  if (!subscription) {
+    subscription = await registration.pushManager.subscribe({
+      userVisibleOnly: true, // Browsers require every push to show a notification
+      applicationServerKey: base64UrlToBytes(vapidKey),
+    });
+  }
+
+  const queues = await getActiveQueues();
+  await Promise.all(queues.map(queue => registerQueue(queue, subscription)));
+  console.log(`✅ Web Push enabled for ${queues.length} queues`);
+  return true;
+}
+
+/**
+ * Unsubscribe from Web Push
+ * The relay drops the registrations the next time a push is rejected
+ */
+export async function disableWebPush(): Promise<void> {
+  const subscription = await getPushSubscription();
+  if (subscription) {
+    await subscription.unsubscribe();
+  }
+}
+
+/**
+ * Register a newly created queue if Web Push is enabled
+ */
+export async function registerQueueForPush(queue: StoredQueue): Promise<void> {
+  const subscription = await getPushSubscription();
+  if (subscription) {
+    await registerQueue(queue, subscription);
+  }
+}
+
+async function registerQueue(queue: StoredQueue, subscription: PushSubscription): Promise<void> {
+  try {
+    await createAPIClient(queue.relayUrl).registerPush(queue.queueId, queue.accessToken, subscription.toJSON());
+  } catch (error) {
+    console.error('Failed to register queue for Web Push:', error);
+  }
+}
+
+function sameKey(subscription: PushSubscription, vapidKey: string): boolean {
+  const current = subscription.options.applicationServerKey;
+  if (!current) {
+    return false;
+  }
+  const expected = base64UrlToBytes(vapidKey);
+  const actual = new Uint8Array(current);
+  return actual.length === expected.length && actual.every((b, i) => b === expected[i]);
+}
+
+function base64UrlToBytes(value: string): Uint8Array<ArrayBuffer> {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+  const binary = atob(base64 + '='.repeat((4 - base64.length % 4) % 4));
+  const bytes = new Uint8Array(binary.length);
+  for (let i = 0; i < binary.length; i++) {
+    bytes[i] = binary.charCodeAt(i);
+  }
+  return bytes;
+}